@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"ai-dev-agent/service/diff"
+	"ai-dev-agent/service/store"
+)
+
+// runAttempts shows the output of each attempt of a session, failed ones
+// included, as diffs against the files before the session. A file the
+// session never wrote is compared with the tree as it is now.
+func runAttempts(ctx context.Context, config *Config, cmd *Command) error {
+	st, err := openStore(config.WorkDir)
+	if err != nil {
+		return fmt.Errorf("state: %w", err)
+	}
+	defer st.Close()
+
+	sess, err := st.GetSession(cmd.Files[0])
+	if err != nil {
+		return fmt.Errorf("session %s: %w", cmd.Files[0], err)
+	}
+	only := 0
+	if len(cmd.Files) == 2 {
+		if only, err = strconv.Atoi(cmd.Files[1]); err != nil || only < 1 {
+			return fmt.Errorf("invalid attempt number %q", cmd.Files[1])
+		}
+	}
+	attempts, err := st.Attempts(sess.ID)
+	if err != nil {
+		return fmt.Errorf("attempts: %w", err)
+	}
+	files, err := st.SessionFiles(sess.ID)
+	if err != nil {
+		return fmt.Errorf("session files: %w", err)
+	}
+	before := make(map[string]string, len(files))
+	for _, f := range files {
+		before[f.Path] = f.Before
+	}
+
+	fmt.Printf("Session:  %s (%s)\n", sess.ID, sess.Mode)
+	if len(attempts) == 0 {
+		fmt.Println("\nNo attempts recorded.")
+		return nil
+	}
+	shown := false
+	for _, a := range attempts {
+		if only != 0 && a.Attempt != only {
+			continue
+		}
+		shown = true
+		fmt.Println()
+		printAttempt(config, a, before)
+	}
+	if !shown {
+		return fmt.Errorf("session %s has no attempt %d", sess.ID, only)
+	}
+	return nil
+}
+
+func printAttempt(config *Config, a store.Attempt, before map[string]string) {
+	if a.Stage == "" {
+		fmt.Printf("✅ Attempt %d: succeeded\n", a.Attempt)
+	} else {
+		fmt.Printf("❌ Attempt %d: failed at %s\n", a.Attempt, a.Stage)
+		fmt.Printf("    %s\n", strings.ReplaceAll(truncate(a.Error, 500), "\n", "\n    "))
+	}
+	if len(a.Files) == 0 {
+		fmt.Println("    no output")
+		return
+	}
+	paths := make([]string, 0, len(a.Files))
+	for p := range a.Files {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+	for _, p := range paths {
+		base, ok := before[filepath.ToSlash(p)]
+		if !ok {
+			current, _ := os.ReadFile(filepath.Join(config.WorkDir, p))
+			base = string(current)
+		}
+		patch := diff.Unified(p, base, a.Files[p], 3)
+		if patch == "" {
+			fmt.Printf("%s: no changes\n", p)
+			continue
+		}
+		fmt.Print(patch)
+	}
+}
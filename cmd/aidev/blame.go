@@ -0,0 +1,132 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"ai-dev-agent/service/diff"
+	"ai-dev-agent/service/gitrepo"
+	"ai-dev-agent/service/provenance"
+	"ai-dev-agent/service/store"
+)
+
+// runBlameAI annotates each line of a file with the agent session that last
+// wrote it, alongside its git blame. Lines are traced back through every
+// recorded session: a line survives a session when it matches an unchanged
+// line of the session's output, and belongs to the session when the
+// session added it.
+func runBlameAI(ctx context.Context, config *Config, cmd *Command) error {
+	path := filepath.ToSlash(filepath.Clean(cmd.Files[0]))
+	data, err := os.ReadFile(filepath.Join(config.WorkDir, path))
+	if err != nil {
+		return err
+	}
+	st, err := openStore(config.WorkDir)
+	if err != nil {
+		return fmt.Errorf("state: %w", err)
+	}
+	defer st.Close()
+
+	sessions, err := st.ListSessions(store.SessionFilter{File: path})
+	if err != nil {
+		return fmt.Errorf("list sessions: %w", err)
+	}
+
+	lines := diff.Lines(string(data))
+	owner := make([]int, len(lines)) // index into sessions, -1 for human lines
+	pos := make([]int, len(lines))   // position in the version being traced
+	for i := range lines {
+		owner[i], pos[i] = -1, i
+	}
+	current := lines
+	for si, sess := range sessions { // newest first
+		file, ok := sessionFile(st, sess.ID, path)
+		if !ok {
+			continue
+		}
+		after, before := diff.Lines(file.After), diff.Lines(file.Before)
+		toAfter := diff.Align(after, current)
+		toBefore := diff.Align(before, after)
+		for i := range lines {
+			if pos[i] < 0 {
+				continue
+			}
+			a := toAfter[pos[i]]
+			switch {
+			case a < 0: // written after the session
+				pos[i] = -1
+			case toBefore[a] < 0: // added by the session
+				owner[i], pos[i] = si, -1
+			default:
+				pos[i] = toBefore[a]
+			}
+		}
+		current = before
+	}
+
+	var blame []gitrepo.BlameLine
+	if b, err := gitrepo.NewClient(gitrepo.Config{}).Blame(ctx, config.WorkDir, path); err == nil && len(b) == len(lines) {
+		blame = b
+	}
+
+	// Number the sessions that still own lines, oldest first.
+	refs := make(map[int]int)
+	var used []int
+	for si := len(sessions) - 1; si >= 0; si-- {
+		for _, o := range owner {
+			if o == si {
+				used = append(used, si)
+				refs[si] = len(used)
+				break
+			}
+		}
+	}
+
+	ai := 0
+	for i, line := range lines {
+		tag := "      "
+		if owner[i] >= 0 {
+			tag = fmt.Sprintf("🤖 [%d]", refs[owner[i]])
+			ai++
+		}
+		commit, author := "", ""
+		if blame != nil {
+			commit, author = shortCommit(blame[i].Commit), blame[i].Author
+			if strings.Trim(blame[i].Commit, "0") == "" {
+				commit, author = "--------", "uncommitted"
+			}
+		}
+		fmt.Printf("%4d %s %-8s %-12s │ %s\n", i+1, tag, commit, truncate(author, 12), line)
+	}
+
+	fmt.Printf("\n%s: %d of %d line(s) last written by the agent\n", path, ai, len(lines))
+	for _, si := range used {
+		sess := sessions[si]
+		fmt.Printf("  [%d] %s  %s  %s  %s", refs[si], sess.ID, sess.StartedAt.Local().Format("2006-01-02 15:04"), sess.Mode, sess.Model)
+		if signed, fingerprint, err := provenance.Verify(provenanceDir(config.WorkDir), sess.ID); err == nil && signed {
+			fmt.Printf("  signed %s", fingerprint)
+		}
+		fmt.Println()
+		if sess.Instruction != "" {
+			fmt.Printf("      %s\n", truncate(firstLine(sess.Instruction), 100))
+		}
+	}
+	return nil
+}
+
+// sessionFile returns the recorded versions of path in a session.
+func sessionFile(st *store.Store, sessionID, path string) (store.SessionFile, bool) {
+	files, err := st.SessionFiles(sessionID)
+	if err != nil {
+		return store.SessionFile{}, false
+	}
+	for _, f := range files {
+		if filepath.ToSlash(filepath.Clean(f.Path)) == path {
+			return f, true
+		}
+	}
+	return store.SessionFile{}, false
+}
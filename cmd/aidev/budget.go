@@ -0,0 +1,182 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"ai-dev-agent/service/llm"
+)
+
+// ErrSpendLimit is returned when a cumulative spend limit is reached.
+var ErrSpendLimit = errors.New("spend limit reached")
+
+// Money is a dollar amount in .aidev.yaml, written as 20, 20.5 or "$20".
+type Money float64
+
+// UnmarshalYAML accepts a number with an optional leading "$".
+func (m *Money) UnmarshalYAML(node *yaml.Node) error {
+	v, err := strconv.ParseFloat(strings.TrimPrefix(strings.TrimSpace(node.Value), "$"), 64)
+	if err != nil || v < 0 {
+		return fmt.Errorf("line %d: invalid amount %q", node.Line, node.Value)
+	}
+	*m = Money(v)
+	return nil
+}
+
+// spendPeriod is a window a spend limit applies to.
+type spendPeriod struct {
+	name  string
+	since time.Time
+	limit float64
+}
+
+// spendPeriods returns the configured limits: the calendar day and month
+// in local time.
+func spendPeriods(config *Config, now time.Time) []spendPeriod {
+	day := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	var periods []spendPeriod
+	if config.DayLimit > 0 {
+		periods = append(periods, spendPeriod{"daily", day, config.DayLimit})
+	}
+	if config.MonthLimit > 0 {
+		periods = append(periods, spendPeriod{"monthly", day.AddDate(0, 0, 1-day.Day()), config.MonthLimit})
+	}
+	return periods
+}
+
+// ledgerFile is the spend ledger inside the user's configuration
+// directory.
+const ledgerFile = "aidev/spend.jsonl"
+
+// ledgerEntry is the cost of one LLM call.
+type ledgerEntry struct {
+	Time  time.Time `json:"time"`
+	Model string    `json:"model"`
+	Cost  float64   `json:"cost"`
+}
+
+// ledger is the user's record of what LLM calls cost, shared by every
+// workspace so that spend limits hold across projects. Each call is
+// appended as a line of its own, so concurrent runs keep each other's.
+type ledger struct {
+	path string
+}
+
+// userLedger returns the ledger of the current user.
+func userLedger() (*ledger, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return nil, err
+	}
+	return &ledger{path: filepath.Join(dir, ledgerFile)}, nil
+}
+
+// add records the cost of a call to model. Only models with prices
+// count toward the limits; the others aren't recorded.
+func (l *ledger) add(model string, prompt, completion int) error {
+	info, ok := llm.LookupModel(model)
+	if !ok {
+		return nil
+	}
+	cost, priced := info.Cost(prompt, completion)
+	if !priced {
+		return nil
+	}
+	line, err := json.Marshal(ledgerEntry{Time: time.Now().UTC(), Model: model, Cost: cost})
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(l.path), 0755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(l.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// since returns the cost of the calls made since the given time. A line
+// that doesn't parse, such as one cut short by a crash, is skipped.
+func (l *ledger) since(t time.Time) (float64, error) {
+	f, err := os.Open(l.path)
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	var spent float64
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var e ledgerEntry
+		if json.Unmarshal(scanner.Bytes(), &e) != nil || e.Time.Before(t) {
+			continue
+		}
+		spent += e.Cost
+	}
+	return spent, scanner.Err()
+}
+
+// spendGuard keeps LLM calls within the spend limits: it checks the
+// user's ledger before each call and records the call's cost after it.
+type spendGuard struct {
+	config *Config
+	ledger *ledger
+}
+
+// newSpendGuard opens the user's ledger. Without one, calls aren't
+// recorded, and with spend limits set none are made.
+func newSpendGuard(config *Config) (*spendGuard, error) {
+	l, err := userLedger()
+	if err != nil {
+		if len(spendPeriods(config, time.Now())) > 0 && !config.OverBudget {
+			return nil, fmt.Errorf("spend limits are set but the spend ledger is unavailable: %v (use --override-budget to run anyway)", err)
+		}
+		return nil, nil
+	}
+	return &spendGuard{config: config, ledger: l}, nil
+}
+
+// check refuses an LLM call once the spend of a limit's period has
+// reached the limit, unless --override-budget is given.
+func (g *spendGuard) check() error {
+	if g == nil || g.config.OverBudget {
+		return nil
+	}
+	for _, p := range spendPeriods(g.config, time.Now()) {
+		spent, err := g.ledger.since(p.since)
+		if err != nil {
+			return fmt.Errorf("spend: %w", err)
+		}
+		if g.config.Verbose {
+			fmt.Printf("  %s\n", trf("Spend (%s): $%.2f of $%.2f", tr(p.name), spent, p.limit))
+		}
+		if spent >= p.limit {
+			return fmt.Errorf("%w: %s spend is $%.2f of $%.2f (use --override-budget to run anyway)", ErrSpendLimit, p.name, spent, p.limit)
+		}
+	}
+	return nil
+}
+
+// record adds a call's cost to the ledger.
+func (g *spendGuard) record(model string, prompt, completion int) error {
+	if g == nil {
+		return nil
+	}
+	return g.ledger.add(model, prompt, completion)
+}
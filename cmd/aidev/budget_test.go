@@ -0,0 +1,66 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"ai-dev-agent/service/llm"
+	"ai-dev-agent/service/orchestrator"
+)
+
+func TestSpendLimitBeforeEachCall(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	llm.RegisterModel(llm.ModelInfo{Name: "priced-test", ContextWindow: 8000, MaxOutput: 1000, InputPrice: 1})
+	var calls atomic.Int64
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.Header().Set("Content-Type", "application/json")
+		// A million prompt tokens cost $1.
+		w.Write([]byte(`{"choices":[{"message":{"role":"assistant","content":"ok"},"finish_reason":"stop"}],"usage":{"prompt_tokens":1000000,"completion_tokens":0,"total_tokens":1000000}}`))
+	}))
+	defer srv.Close()
+
+	// Two workspaces share the user's ledger and its daily limit.
+	adapter := func() *llmAdapter {
+		config := &Config{WorkDir: t.TempDir(), DayLimit: 1.5}
+		spend, err := newSpendGuard(config)
+		if err != nil {
+			t.Fatal(err)
+		}
+		client, err := llm.NewClient(llm.Config{APIKey: "key", BaseURL: srv.URL, Model: "priced-test", MaxRetries: 1})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return newLLMAdapter(config, client, newRecorder(nil), spend)
+	}
+	first, second := adapter(), adapter()
+	prompt := orchestrator.UserPrompt("hi")
+
+	if _, err := first.Chat(context.Background(), prompt); err != nil {
+		t.Fatalf("first call ($0 of $1.50 spent): %v", err)
+	}
+	if _, err := second.Chat(context.Background(), prompt); err != nil {
+		t.Fatalf("second call ($1 of $1.50 spent): %v", err)
+	}
+	for _, a := range []*llmAdapter{first, second} {
+		if _, err := a.Chat(context.Background(), prompt); !errors.Is(err, ErrSpendLimit) {
+			t.Errorf("call with $2 of $1.50 spent = %v, want ErrSpendLimit", err)
+		}
+	}
+	if n := calls.Load(); n != 2 {
+		t.Errorf("%d request(s) sent, want 2", n)
+	}
+
+	over := &Config{DayLimit: 1.5, OverBudget: true}
+	spend, err := newSpendGuard(over)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := spend.check(); err != nil {
+		t.Errorf("check with --override-budget = %v, want nil", err)
+	}
+}
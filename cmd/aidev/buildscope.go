@@ -0,0 +1,99 @@
+package main
+
+import (
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"ai-dev-agent/service/deps"
+	"ai-dev-agent/service/index"
+)
+
+// dependentsHook returns the engine hook that finds the importers of
+// changed packages in the project index, so build verification can skip
+// the packages an attempt couldn't affect. Without an index every package
+// is built.
+func dependentsHook(config *Config) func(workDir string, dirs []string) ([]string, bool) {
+	root := config.WorkDir
+	if config.StateRoot != "" {
+		root = config.StateRoot
+	}
+	return func(workDir string, dirs []string) ([]string, bool) {
+		mod, err := deps.ReadGoMod(workDir)
+		if err != nil || mod.Module == "" {
+			return nil, false
+		}
+		st, err := openStore(root)
+		if err != nil {
+			return nil, false
+		}
+		defer st.Close()
+		entries, err := st.LoadIndex()
+		if err != nil || len(entries) == 0 {
+			return nil, false
+		}
+		return importers(entries, mod.Module, dirs), true
+	}
+}
+
+// importers returns the directories of the packages in entries that
+// import a package in one of dirs, directly or through other packages of
+// module. Test files count, so that their packages' tests are compiled.
+func importers(entries []index.Entry, module string, dirs []string) []string {
+	importedBy := make(map[string]map[string]bool) // package dir -> importing dirs
+	for _, e := range entries {
+		if e.Package == "" {
+			continue
+		}
+		dir := path.Dir(e.Path)
+		for _, imp := range e.Imports {
+			var target string
+			switch {
+			case imp == module:
+				target = "."
+			case strings.HasPrefix(imp, module+"/"):
+				target = strings.TrimPrefix(imp, module+"/")
+			default:
+				continue
+			}
+			if importedBy[target] == nil {
+				importedBy[target] = make(map[string]bool)
+			}
+			importedBy[target][dir] = true
+		}
+	}
+
+	seen := make(map[string]bool)
+	queue := append([]string(nil), dirs...)
+	var result []string
+	for len(queue) > 0 {
+		dir := queue[0]
+		queue = queue[1:]
+		for importer := range importedBy[dir] {
+			if !seen[importer] {
+				seen[importer] = true
+				result = append(result, importer)
+				queue = append(queue, importer)
+			}
+		}
+	}
+	return result
+}
+
+// goBuildEnv is the environment of verification builds. Attempts rebuild
+// the same packages, so they must share a build cache: when the user has
+// none, a fixed one in the temp directory is used. VCS stamping is off,
+// since it runs git for every build and changes with every write.
+func goBuildEnv() map[string]string {
+	env := make(map[string]string)
+	if flags := os.Getenv("GOFLAGS"); !strings.Contains(flags, "-buildvcs") {
+		env["GOFLAGS"] = strings.TrimSpace(flags + " -buildvcs=false")
+	}
+	if os.Getenv("GOCACHE") == "" {
+		if _, err := os.UserCacheDir(); err != nil {
+			env["GOCACHE"] = filepath.Join(os.TempDir(), "aidev-gocache")
+		}
+	}
+	return env
+}
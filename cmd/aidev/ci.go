@@ -0,0 +1,150 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"ai-dev-agent/service/errparse"
+	"ai-dev-agent/service/gitrepo"
+	"ai-dev-agent/service/orchestrator"
+	"ai-dev-agent/service/server"
+)
+
+// maxCIFiles bounds how many files from a failure log are sent to the model.
+const maxCIFiles = 10
+
+// ciLogBytes is how much of the failure log goes into the instruction; a
+// longer log is condensed to its errors and summary.
+const ciLogBytes = 6000
+
+var logFilePattern = regexp.MustCompile(`([\w./\\-]+\.go):\d+`)
+
+// runCIFix checks out the failing commit in a throwaway sandbox, runs the
+// fix loop on the files the log points at and opens a pull request against
+// the failing branch.
+func runCIFix(ctx context.Context, config *Config, job *server.Job) *orchestrator.Result {
+	ci := job.CI
+	fmt.Printf("▶ %s (%s) CI fix %s@%s %s\n", job.ID, job.Client, ci.Repo, shortCommit(ci.Commit), ci.Job)
+	result := fixCIFailure(ctx, config, ci)
+	printFinished(job, result)
+	if result.Success {
+		fmt.Printf("  🔗 %s\n", result.Output)
+	}
+	return result
+}
+
+func fixCIFailure(ctx context.Context, config *Config, ci *server.CIFailure) *orchestrator.Result {
+	sandbox, err := os.MkdirTemp("", "aidev-ci-")
+	if err != nil {
+		return &orchestrator.Result{Error: err}
+	}
+	defer os.RemoveAll(sandbox)
+
+	git := gitrepo.NewClient(gitrepo.DefaultConfig())
+	if err := git.Checkout(ctx, ci.Repo, ci.Commit, sandbox); err != nil {
+		return &orchestrator.Result{Error: fmt.Errorf("checkout: %w", err)}
+	}
+	files := failingFiles(ci.Log, sandbox)
+	if len(files) == 0 {
+		return &orchestrator.Result{Error: fmt.Errorf("no source files in %s are referenced by the failure log", ci.Repo)}
+	}
+
+	jc := *config
+	jc.WorkDir = sandbox
+	jc.NoDeps = true
+	jc.NoBackup = true
+	jc.ReadOnly = false
+	result := executeJob(ctx, &jc, orchestrator.Request{
+		Mode:        orchestrator.ModeFix,
+		Files:       files,
+		Instruction: ciInstruction(ci),
+		WorkDir:     sandbox,
+	})
+	if !result.Success || len(result.FilesWritten) == 0 {
+		return result
+	}
+
+	branch := "aidev/ci-fix-" + shortCommit(ci.Commit)
+	title := fmt.Sprintf("Fix CI failure in %s", ciJobName(ci))
+	if err := git.Commit(ctx, sandbox, branch, title, result.FilesWritten); err != nil {
+		return failed(result, err)
+	}
+	if err := git.Push(ctx, sandbox, branch); err != nil {
+		return failed(result, err)
+	}
+	url, err := git.OpenPullRequest(ctx, gitrepo.PullRequest{
+		Remote: ci.Repo,
+		Head:   branch,
+		Base:   ci.Branch,
+		Title:  title,
+		Body: fmt.Sprintf("The CI job %s failed on %s. This change was generated by aidev from the failure log.\n\nFiles changed:\n- %s",
+			ciJobName(ci), ci.Commit, strings.Join(result.FilesWritten, "\n- ")),
+	})
+	if err != nil {
+		return failed(result, err)
+	}
+	result.Output = url
+	return result
+}
+
+// Helper functions
+
+// failingFiles returns the Go files under dir that the log references.
+func failingFiles(log, dir string) []string {
+	return referencedFiles(logFilePattern, log, dir)
+}
+
+// referencedFiles returns the files under dir that pattern's first group
+// matches in text. CI runners log absolute paths of their own checkout,
+// so leading path elements are dropped until the remainder exists in dir.
+func referencedFiles(pattern *regexp.Regexp, text, dir string) []string {
+	var files []string
+	seen := make(map[string]bool)
+	for _, m := range pattern.FindAllStringSubmatch(text, -1) {
+		parts := strings.Split(filepath.ToSlash(m[1]), "/")
+		for i := range parts {
+			rel := filepath.Join(parts[i:]...)
+			if rel == "" || strings.HasPrefix(rel, "..") || seen[rel] {
+				continue
+			}
+			if info, err := os.Stat(filepath.Join(dir, rel)); err == nil && !info.IsDir() {
+				seen[rel] = true
+				files = append(files, rel)
+				break
+			}
+		}
+		if len(files) == maxCIFiles {
+			break
+		}
+	}
+	return files
+}
+
+func ciInstruction(ci *server.CIFailure) string {
+	log := errparse.Condense(ci.Log, ciLogBytes)
+	return fmt.Sprintf("The CI job %s failed on commit %s. Fix the code so the job passes. Failure log:\n%s", ciJobName(ci), ci.Commit, log)
+}
+
+func ciJobName(ci *server.CIFailure) string {
+	if ci.Job == "" {
+		return "CI"
+	}
+	return ci.Job
+}
+
+func shortCommit(commit string) string {
+	if len(commit) > 8 {
+		return commit[:8]
+	}
+	return commit
+}
+
+func failed(result *orchestrator.Result, err error) *orchestrator.Result {
+	result.Success = false
+	result.Error = err
+	return result
+}
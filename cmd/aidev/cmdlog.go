@@ -0,0 +1,211 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"ai-dev-agent/service/executor"
+	"ai-dev-agent/service/store"
+)
+
+// commandEnvVars are the environment variables recorded with each command:
+// the ones that most often make a build differ between the agent and a
+// user's shell.
+var commandEnvVars = []string{
+	"PATH", "HOME", "GOROOT", "GOPATH", "GOFLAGS", "GOOS", "GOARCH", "CGO_ENABLED",
+	"GOPROXY", "GOPRIVATE", "GONOSUMDB", "GOTOOLCHAIN", "GOWORK", "GOENV", "GOCACHE",
+}
+
+// commandEnv returns the recorded environment of a command run with opts:
+// the variables of interest as the agent had them, and those opts set.
+func commandEnv(opts executor.Options) map[string]string {
+	env := make(map[string]string)
+	for _, name := range commandEnvVars {
+		if v, ok := os.LookupEnv(name); ok {
+			env[name] = v
+		}
+	}
+	for k, v := range opts.Env {
+		env[k] = v
+	}
+	return env
+}
+
+// runCmdlog lists the commands the agent ran, shows one, or runs one
+// again: aidev cmdlog [session-id] | show <id> | run <id>.
+func runCmdlog(ctx context.Context, config *Config, cmd *Command) error {
+	st, err := openStore(config.WorkDir)
+	if err != nil {
+		return fmt.Errorf("state: %w", err)
+	}
+	defer st.Close()
+
+	if len(cmd.Files) > 0 && (cmd.Files[0] == "show" || cmd.Files[0] == "run") {
+		if len(cmd.Files) != 2 {
+			return fmt.Errorf("usage: aidev cmdlog %s <id>", cmd.Files[0])
+		}
+		id, err := strconv.ParseInt(strings.TrimPrefix(cmd.Files[1], "#"), 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid command id %q", cmd.Files[1])
+		}
+		c, err := st.GetCommand(id)
+		if err != nil {
+			return fmt.Errorf("command %d: %w", id, err)
+		}
+		if cmd.Files[0] == "run" {
+			return rerunCommand(ctx, c)
+		}
+		showCommand(c)
+		return nil
+	}
+
+	session := ""
+	if len(cmd.Files) > 0 {
+		session = cmd.Files[0]
+	}
+	limit := cmd.Limit
+	if limit == 0 {
+		limit = 20
+	}
+	commands, err := st.Commands(session, limit)
+	if err != nil {
+		return fmt.Errorf("list commands: %w", err)
+	}
+	if len(commands) == 0 {
+		fmt.Println(tr("No commands recorded."))
+		return nil
+	}
+	for _, c := range commands {
+		fmt.Printf("%s #%-4d %s  %s  %8s  %s\n", exitGlyph(c.ExitCode), c.ID,
+			c.CreatedAt.Local().Format("2006-01-02 15:04:05"), trf("exit %d", c.ExitCode),
+			c.Duration.Round(time.Millisecond), c.Command)
+		if config.Verbose {
+			fmt.Printf("    %s\n", trf("session %s in %s", c.SessionID, c.Dir))
+		}
+	}
+	return nil
+}
+
+// showCommand prints a recorded command and how its environment differs
+// from the current one.
+func showCommand(c *store.Command) {
+	fmt.Printf("%s %s\n", exitGlyph(c.ExitCode), c.Command)
+	fmt.Printf("  %-12s %s\n", tr("Session:"), c.SessionID)
+	fmt.Printf("  %-12s %s\n", tr("Directory:"), c.Dir)
+	fmt.Printf("  %-12s %s\n", tr("Run at:"), c.CreatedAt.Local().Format("2006-01-02 15:04:05"))
+	fmt.Printf("  %-12s %d\n", tr("Exit code:"), c.ExitCode)
+	fmt.Printf("  %-12s %s\n", tr("Duration:"), c.Duration.Round(time.Millisecond))
+
+	diffs := envDiff(c.Env)
+	if len(diffs) == 0 {
+		fmt.Printf("\n  %s\n", tr("Environment: as in this shell"))
+	} else {
+		fmt.Printf("\n  %s\n", tr("Environment of the agent's run, where it differs from this shell:"))
+		for _, d := range diffs {
+			fmt.Printf("    %s\n", d)
+		}
+	}
+	fmt.Printf("\n  %s\n", trf("Run it again with: aidev cmdlog run %d", c.ID))
+}
+
+// rerunCommand runs a recorded command again, in its directory and with
+// its recorded environment, on the terminal.
+func rerunCommand(ctx context.Context, c *store.Command) error {
+	if len(c.Args) == 0 {
+		return fmt.Errorf("command %d has no recorded arguments", c.ID)
+	}
+	if _, err := os.Stat(c.Dir); err != nil {
+		return fmt.Errorf("directory %s: %w", c.Dir, err)
+	}
+
+	run := exec.CommandContext(ctx, c.Args[0], c.Args[1:]...)
+	run.Dir = c.Dir
+	run.Env = recordedEnviron(c.Env)
+	run.Stdin, run.Stdout, run.Stderr = os.Stdin, os.Stdout, os.Stderr
+
+	fmt.Printf("▶ %s  (%s)\n", c.Command, c.Dir)
+	start := time.Now()
+	err := run.Run()
+	elapsed := time.Since(start).Round(time.Millisecond)
+	exitCode := 0
+	var exitErr *exec.ExitError
+	switch {
+	case errors.As(err, &exitErr):
+		exitCode = exitErr.ExitCode()
+	case err != nil:
+		return err
+	}
+
+	fmt.Printf("\n%s %s\n", exitGlyph(exitCode), trf("exit %d in %s; the agent's run exited %d in %s", exitCode, elapsed, c.ExitCode, c.Duration.Round(time.Millisecond)))
+	return nil
+}
+
+// Helper functions
+
+// envDiff lists the recorded variables whose value differs from the
+// current environment.
+func envDiff(recorded map[string]string) []string {
+	names := append([]string(nil), commandEnvVars...)
+	for name := range recorded {
+		if !containsString(names, name) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	var diffs []string
+	for _, name := range names {
+		was, wasSet := recorded[name]
+		now, nowSet := os.LookupEnv(name)
+		switch {
+		case wasSet == nowSet && was == now:
+		case !wasSet:
+			diffs = append(diffs, trf("%s: unset (now %q)", name, now))
+		case !nowSet:
+			diffs = append(diffs, trf("%s: %q (now unset)", name, was))
+		default:
+			diffs = append(diffs, trf("%s: %q (now %q)", name, was, now))
+		}
+	}
+	return diffs
+}
+
+// recordedEnviron is the current environment with the recorded variables
+// restored to their values in the agent's run.
+func recordedEnviron(recorded map[string]string) []string {
+	var env []string
+	for _, kv := range os.Environ() {
+		name, _, _ := strings.Cut(kv, "=")
+		if _, ok := recorded[name]; ok || containsString(commandEnvVars, name) {
+			continue
+		}
+		env = append(env, kv)
+	}
+	for name, value := range recorded {
+		env = append(env, name+"="+value)
+	}
+	return env
+}
+
+func exitGlyph(exitCode int) string {
+	if exitCode == 0 {
+		return glyph("✅")
+	}
+	return glyph("❌")
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,425 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"ai-dev-agent/service/deps"
+	"ai-dev-agent/service/diagnose"
+	"ai-dev-agent/service/llm"
+	"ai-dev-agent/service/orchestrator"
+)
+
+// projectConfigFile is the per-project configuration file, committed
+// with the project. localConfigFile holds personal overrides and is kept
+// out of version control. The .aidev.yaml of the home directory holds the
+// user's defaults for every project.
+const (
+	projectConfigFile = ".aidev.yaml"
+	localConfigFile   = ".aidev.local.yaml"
+)
+
+// ProjectConfig is the content of .aidev.yaml, and of the global and
+// local files layered with it.
+type ProjectConfig struct {
+	// APIKey belongs in .aidev.local.yaml or the global file only.
+	APIKey string `yaml:"api_key"`
+	// APIKeyEnv names the environment variable holding the API key, so
+	// a file may say which key to use without holding it.
+	APIKeyEnv string            `yaml:"api_key_env"`
+	Model     string            `yaml:"model"`
+	ModelFor  map[string]string `yaml:"model_for"`
+	Routes    []llm.Route       `yaml:"routes"`
+	JWT       bool              `yaml:"jwt"`
+	// Retries and Timeout apply to each model request, as --retries and
+	// --timeout do.
+	Retries *int   `yaml:"retries"`
+	Timeout string `yaml:"timeout"`
+	// WorkDir is the project to run in when no -w is given. Only the
+	// global file may set it.
+	WorkDir string `yaml:"workdir"`
+	// Ignore are patterns of paths scans and the index skip, beyond
+	// node_modules, vendor and the like, e.g. "*.pb.go".
+	Ignore []string `yaml:"ignore"`
+	// Backup false is --no-backup. BackupKeep is how many backups of each
+	// file are kept in .ai-backup; 0 keeps them all.
+	Backup     *bool `yaml:"backup"`
+	BackupKeep int   `yaml:"backup_keep"`
+	// Models registers context limits of models the registry lacks, and
+	// prices for the run summary.
+	Models []llm.ModelInfo `yaml:"models"`
+	// Worktree runs writing commands in a separate git worktree.
+	Worktree bool `yaml:"worktree"`
+	// MaxWriteFiles and MaxWriteBytes cap what one attempt may write.
+	MaxWriteFiles int `yaml:"max_write_files"`
+	MaxWriteBytes int `yaml:"max_write_bytes"`
+	// MaxFeedbackTokens bounds the build output quoted in retry prompts.
+	MaxFeedbackTokens int `yaml:"max_feedback_tokens"`
+	// MaxDiffMultiple bounds minimal-diff changes, in multiples of the
+	// expected change.
+	MaxDiffMultiple float64 `yaml:"max_diff_multiple"`
+	// PreserveComments restores comments and layout the model dropped.
+	PreserveComments bool `yaml:"preserve_comments"`
+	// Constraints apply to every run of a command, e.g. refactor: [api-stable].
+	Constraints map[string][]string `yaml:"constraints"`
+	// ProviderOptions are extra request body fields, e.g. num_ctx: 32768.
+	ProviderOptions map[string]interface{} `yaml:"provider_options"`
+	// Profiles are named presets selected with --profile; Profile is the
+	// one used when no --profile is given.
+	Profiles map[string]Profile `yaml:"profiles"`
+	Profile  string             `yaml:"profile"`
+	// Tasks are named recurring operations selected with --task.
+	Tasks map[string]Task `yaml:"tasks"`
+	// SpendLimitDaily and SpendLimitMonthly cap the priced usage of all
+	// the user's runs, in any project, per calendar day and month.
+	SpendLimitDaily   Money `yaml:"spend_limit_daily"`
+	SpendLimitMonthly Money `yaml:"spend_limit_monthly"`
+	// RetentionMaxAge and RetentionMaxSize bound .ai-backup and the state
+	// database; gc applies them, and runs do once a day.
+	RetentionMaxAge  Age      `yaml:"retention_max_age"`
+	RetentionMaxSize ByteSize `yaml:"retention_max_size"`
+	// GitExclude is where the first write adds .ai-backup and .aidev to
+	// git's ignore rules: gitignore, local (.git/info/exclude), global
+	// (core.excludesFile) or off. Unset, the user is asked.
+	GitExclude string `yaml:"git_exclude"`
+	// VerifyPTY runs verification commands on a pseudo-terminal, and
+	// VerifyStdin forwards the terminal's input to them, for tools that
+	// prompt or only color their output on a TTY.
+	VerifyPTY   bool `yaml:"verify_pty"`
+	VerifyStdin bool `yaml:"verify_stdin"`
+	// RunTests runs the tests of a change before accepting it, as
+	// --run-tests does.
+	RunTests bool `yaml:"run_tests"`
+	// VerifyMatrix builds each change again under every combination of
+	// these variables' values, e.g. CGO_ENABLED: ["0", "1"] and GOOS:
+	// [linux, darwin].
+	VerifyMatrix map[string][]string `yaml:"verify_matrix"`
+	// ReviewPolicy sets the severity of kinds of review findings, e.g.
+	// unhandled errors are blocking and naming is a nitpick.
+	ReviewPolicy orchestrator.ReviewPolicy `yaml:"review_policy"`
+	// MigrationPolicy names the file of the team's migration policy
+	// (dialect, rule severities, guidelines) for review --migrations.
+	MigrationPolicy string `yaml:"migration_policy"`
+	// OpenAPISpec is the spec diagnose compares with the handlers, by
+	// default the first of openapi.yaml, swagger.yaml and the like found.
+	// OpenAPISource is the side taken as right, code or spec; diagnose
+	// fixes the other.
+	OpenAPISpec   string `yaml:"openapi_spec"`
+	OpenAPISource string `yaml:"openapi_source"`
+	// CrossPlatforms are GOOS/GOARCH targets, e.g. windows/amd64, diagnose
+	// also builds the project for.
+	CrossPlatforms []string `yaml:"cross_platforms"`
+	// Architecture names the file of layering rules deps checks, by
+	// default architecture.yaml.
+	Architecture string `yaml:"architecture"`
+	// Layering are rules such as "service/* must not import cmd/*" that
+	// deps checks and changes must keep to, along with the architecture
+	// file's.
+	Layering []string `yaml:"layering"`
+	// Refuse are rules of paths and content never sent to the LLM, e.g.
+	// {path: deploy/prod/, reason: production secrets}, beyond the
+	// built-in private key and terraform state rules. A request that
+	// would send them stops.
+	Refuse orchestrator.Refusals `yaml:"refuse"`
+}
+
+// configLayer is a configuration file and the top-level keys it sets.
+type configLayer struct {
+	file string // as shown to the user
+	path string
+	keys map[string]bool
+}
+
+// configFile is a configuration file that may exist.
+type configFile struct {
+	name, path string
+}
+
+// configFiles lists the configuration files of the project rooted at root
+// in order of precedence, lowest first: the global file, .aidev.yaml and
+// .aidev.local.yaml. In the home directory the global file is the
+// project's.
+func configFiles(root string) []configFile {
+	var files []configFile
+	abs, _ := filepath.Abs(filepath.Join(root, projectConfigFile))
+	if path := globalConfigPath(); path != "" && path != abs {
+		files = append(files, configFile{globalConfigName(path), path})
+	}
+	for _, name := range []string{projectConfigFile, localConfigFile} {
+		files = append(files, configFile{name, filepath.Join(root, name)})
+	}
+	return files
+}
+
+// globalConfigPath returns the user's global configuration file,
+// ~/.aidev.yaml, or "" when the user has no home directory.
+func globalConfigPath() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, projectConfigFile)
+}
+
+// globalConfigName shortens the global file's path under the home
+// directory to ~.
+func globalConfigName(path string) string {
+	if home, err := os.UserHomeDir(); err == nil {
+		if rel, err := filepath.Rel(home, path); err == nil && !strings.HasPrefix(rel, "..") {
+			return filepath.Join("~", rel)
+		}
+	}
+	return path
+}
+
+// globalWorkDir returns the workdir of the global file, with a leading ~
+// expanded, or "" if it sets none. Errors are left to loadConfigLayers.
+func globalWorkDir() string {
+	path := globalConfigPath()
+	if path == "" {
+		return ""
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return ""
+	}
+	var pc ProjectConfig
+	if yaml.Unmarshal(data, &pc) != nil {
+		return ""
+	}
+	if rest, ok := strings.CutPrefix(pc.WorkDir, "~/"); ok {
+		if home, err := os.UserHomeDir(); err == nil {
+			return filepath.Join(home, rest)
+		}
+	}
+	return pc.WorkDir
+}
+
+// loadProjectConfig reads the global file, then .aidev.yaml from root and
+// .aidev.local.yaml over it. Missing files yield an empty configuration.
+func loadProjectConfig(root string) (*ProjectConfig, error) {
+	pc, layers, err := loadConfigLayers(root)
+	for _, layer := range layers {
+		if layer.file == projectConfigFile && layer.keys["api_key"] {
+			fmt.Printf("%s %s\n", glyph("⚠"), trf("%s holds an API key and is shared with the project; move it to %s", projectConfigFile, localConfigFile))
+		}
+	}
+	return pc, err
+}
+
+// loadConfigLayers reads the configuration files in order of precedence,
+// lowest first. A later file replaces scalars and lists and merges maps
+// by key.
+func loadConfigLayers(root string) (*ProjectConfig, []configLayer, error) {
+	pc := &ProjectConfig{}
+	var layers []configLayer
+	for _, f := range configFiles(root) {
+		data, err := os.ReadFile(f.path)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		var doc map[string]yaml.Node
+		if err := yaml.Unmarshal(data, &doc); err != nil {
+			return nil, nil, fmt.Errorf("%s: %w", f.name, err)
+		}
+		if err := yaml.Unmarshal(data, pc); err != nil {
+			return nil, nil, fmt.Errorf("%s: %w", f.name, err)
+		}
+		layer := configLayer{file: f.name, path: f.path, keys: make(map[string]bool)}
+		for key := range doc {
+			layer.keys[key] = true
+		}
+		// The project's files are found in the workdir, too late to
+		// choose it.
+		if layer.keys["workdir"] && f.path != globalConfigPath() {
+			return nil, nil, fmt.Errorf("%s: workdir may only be set in the global configuration (%s)", f.name, globalConfigName(globalConfigPath()))
+		}
+		layers = append(layers, layer)
+	}
+	return pc, layers, nil
+}
+
+// applyProjectConfig merges the project file and the selected profile
+// into config. Flags given on the command line take precedence.
+func applyProjectConfig(config *Config, pc *ProjectConfig) error {
+	if config.APIKey == "" {
+		config.APIKey = pc.APIKey
+	}
+	if config.APIKey == "" && pc.APIKeyEnv != "" {
+		config.APIKey = os.Getenv(pc.APIKeyEnv)
+		config.KeyEnv = pc.APIKeyEnv
+	}
+	if !config.ModelSet && pc.Model != "" {
+		config.Model = pc.Model
+	}
+	for task, model := range pc.ModelFor {
+		if _, ok := config.ModelFor[task]; !ok {
+			if config.ModelFor == nil {
+				config.ModelFor = make(map[string]string)
+			}
+			config.ModelFor[task] = model
+		}
+	}
+	if pc.Retries != nil && !config.Given["--retries"] {
+		if *pc.Retries < 1 {
+			return fmt.Errorf("retries: %d must be at least 1", *pc.Retries)
+		}
+		config.MaxRetries = *pc.Retries
+	}
+	if pc.Timeout != "" && !config.Given["--timeout"] {
+		d, err := time.ParseDuration(pc.Timeout)
+		if err != nil || d <= 0 {
+			return fmt.Errorf("timeout: %q is not a positive duration, e.g. 90s or 5m", pc.Timeout)
+		}
+		config.Timeout = d
+	}
+	config.Ignore = pc.Ignore
+	if pc.Backup != nil && !*pc.Backup {
+		config.NoBackup = true
+	}
+	if pc.BackupKeep < 0 {
+		return fmt.Errorf("backup_keep: %d must not be negative", pc.BackupKeep)
+	}
+	config.BackupKeep = pc.BackupKeep
+	config.Routes = pc.Routes
+	config.Tasks = pc.Tasks
+	config.Policy = pc.ReviewPolicy
+	config.MigPolicy = pc.MigrationPolicy
+	if pc.JWT {
+		config.JWT = true
+	}
+	if pc.Worktree {
+		config.Worktree = true
+	}
+	config.MaxFiles = pc.MaxWriteFiles
+	config.MaxBytes = pc.MaxWriteBytes
+	config.Feedback = pc.MaxFeedbackTokens
+	config.Constrain = pc.Constraints
+	config.DiffMult = pc.MaxDiffMultiple
+	if pc.PreserveComments {
+		config.Preserve = true
+	}
+	config.DayLimit = float64(pc.SpendLimitDaily)
+	config.MonthLimit = float64(pc.SpendLimitMonthly)
+	config.RetainAge = time.Duration(pc.RetentionMaxAge)
+	config.RetainSize = int64(pc.RetentionMaxSize)
+	if pc.VerifyPTY {
+		config.VerifyPTY = true
+	}
+	if pc.VerifyStdin {
+		config.VerifyIn = true
+	}
+	if pc.RunTests {
+		config.RunTests = true
+	}
+	config.EnvMatrix = pc.VerifyMatrix
+	switch pc.GitExclude {
+	case "", gitExcludeIgnore, gitExcludeLocal, gitExcludeGlobal, gitExcludeOff:
+		config.GitExclude = pc.GitExclude
+	default:
+		return fmt.Errorf("git_exclude: unknown value %q (gitignore, local, global or off)", pc.GitExclude)
+	}
+	switch pc.OpenAPISource {
+	case "", diagnose.APISourceCode, diagnose.APISourceSpec:
+		config.APISpec, config.APISource = pc.OpenAPISpec, pc.OpenAPISource
+	default:
+		return fmt.Errorf("openapi_source: unknown value %q (code or spec)", pc.OpenAPISource)
+	}
+	for _, platform := range pc.CrossPlatforms {
+		if goos, goarch, ok := strings.Cut(platform, "/"); !ok || goos == "" || goarch == "" {
+			return fmt.Errorf("cross_platforms: %q is not GOOS/GOARCH, e.g. windows/amd64", platform)
+		}
+	}
+	config.Platforms = pc.CrossPlatforms
+	config.ArchFile = pc.Architecture
+	rules, err := deps.ParseRules(pc.Layering)
+	if err != nil {
+		return fmt.Errorf("layering: %w", err)
+	}
+	config.Layering = rules
+	if err := pc.Refuse.Validate(); err != nil {
+		return fmt.Errorf("refuse: %w", err)
+	}
+	config.Refuse = pc.Refuse
+	for key, value := range pc.ProviderOptions {
+		if _, ok := config.ProvOpts[key]; !ok {
+			if config.ProvOpts == nil {
+				config.ProvOpts = make(map[string]interface{})
+			}
+			config.ProvOpts[key] = value
+		}
+	}
+	for _, m := range pc.Models {
+		// An entry may only add prices to a known model.
+		if known, ok := llm.LookupModel(m.Name); ok {
+			if m.ContextWindow == 0 {
+				m.ContextWindow = known.ContextWindow
+			}
+			if m.MaxOutput == 0 {
+				m.MaxOutput = known.MaxOutput
+			}
+			m.Vision = m.Vision || known.Vision
+		}
+		if m.Name != "" && m.ContextWindow > 0 {
+			llm.RegisterModel(m)
+		}
+	}
+
+	if config.Profile == "" {
+		config.Profile = pc.Profile
+	}
+	if config.Profile != "" {
+		return applyProfile(config, config.Profile, pc.Profiles)
+	}
+	return nil
+}
+
+// optionValue reads a --provider-opt value as JSON (numbers, booleans,
+// objects), or else as a plain string.
+func optionValue(s string) interface{} {
+	var v interface{}
+	if err := json.Unmarshal([]byte(s), &v); err == nil {
+		return v
+	}
+	return s
+}
+
+// constraintsFor returns the project's constraints for the command
+// followed by the ones given with --constraint.
+func constraintsFor(config *Config, cmd *Command) []string {
+	constraints := append([]string(nil), config.Constrain[cmd.Type]...)
+	return append(constraints, cmd.Constraints...)
+}
+
+// router builds the model router. An explicit --model disables the
+// size-based routes; --model-for overrides always apply.
+func (c *Config) router() *llm.Router {
+	r := &llm.Router{Default: c.Model, Overrides: c.ModelFor}
+	if !c.ModelSet {
+		r.Routes = c.Routes
+	}
+	return r
+}
+
+// inputSize returns the combined size of the target files.
+func inputSize(workDir string, files []string) int {
+	size := 0
+	for _, f := range files {
+		if !filepath.IsAbs(f) {
+			f = filepath.Join(workDir, f)
+		}
+		if info, err := os.Stat(f); err == nil {
+			size += int(info.Size())
+		}
+	}
+	return size
+}
@@ -0,0 +1,362 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// runConfig runs the config subcommands.
+func runConfig(ctx context.Context, config *Config, cmd *Command) error {
+	switch cmd.Files[0] {
+	case "show":
+		if cmd.Effective {
+			return showEffectiveConfig(config.WorkDir)
+		}
+		return showConfigFiles(config.WorkDir)
+	case "get":
+		if len(cmd.Files) != 2 {
+			return fmt.Errorf("usage: aidev config get <key>")
+		}
+		return getConfig(config.WorkDir, cmd.Files[1])
+	case "set":
+		if len(cmd.Files) < 3 {
+			return fmt.Errorf("usage: aidev config set <key> <value> [--local|--global]")
+		}
+		return setConfig(config.WorkDir, cmd.Files[1], strings.Join(cmd.Files[2:], " "), cmd.Local, cmd.Global)
+	default:
+		return fmt.Errorf("unknown config command %q (want show, get or set)", cmd.Files[0])
+	}
+}
+
+// showConfigFiles prints each configuration file of the project.
+func showConfigFiles(root string) error {
+	_, layers, err := loadConfigLayers(root)
+	if err != nil {
+		return err
+	}
+	if len(layers) == 0 {
+		fmt.Println(trf("No configuration files (%s, %s).", projectConfigFile, localConfigFile))
+		return nil
+	}
+	for i, layer := range layers {
+		data, err := os.ReadFile(layer.path)
+		if err != nil {
+			return err
+		}
+		var doc yaml.Node
+		if err := yaml.Unmarshal(data, &doc); err != nil {
+			return fmt.Errorf("%s: %w", layer.file, err)
+		}
+		if len(doc.Content) > 0 {
+			maskSecrets(doc.Content[0])
+		}
+		out, err := encodeYAML(&doc)
+		if err != nil {
+			return err
+		}
+		if i > 0 {
+			fmt.Println()
+		}
+		fmt.Printf("# %s\n%s", layer.file, out)
+	}
+	return nil
+}
+
+// showEffectiveConfig prints the merged configuration with the file each
+// value comes from. Flags and profiles apply on top of it per run.
+func showEffectiveConfig(root string) error {
+	pc, layers, err := loadConfigLayers(root)
+	if err != nil {
+		return err
+	}
+	var merged yaml.Node
+	if err := merged.Encode(pc); err != nil {
+		return err
+	}
+
+	out := &yaml.Node{Kind: yaml.MappingNode}
+	for i := 0; i+1 < len(merged.Content); i += 2 {
+		key, value := merged.Content[i], merged.Content[i+1]
+		var sources []string
+		for _, layer := range layers {
+			if layer.keys[key.Value] {
+				sources = append(sources, layer.file)
+			}
+		}
+		if len(sources) == 0 {
+			continue
+		}
+		// Only maps merge across files; otherwise the last file wins.
+		if value.Kind != yaml.MappingNode {
+			sources = sources[len(sources)-1:]
+		}
+		key.LineComment = strings.Join(sources, " + ")
+		out.Content = append(out.Content, key, value)
+	}
+	if len(out.Content) == 0 {
+		fmt.Println(trf("No configuration files (%s, %s).", projectConfigFile, localConfigFile))
+		return nil
+	}
+	maskSecrets(out)
+
+	data, err := encodeYAML(out)
+	if err != nil {
+		return err
+	}
+	fmt.Print(string(data))
+	return nil
+}
+
+// maskSecrets hides the API key of a configuration mapping.
+func maskSecrets(m *yaml.Node) {
+	if m.Kind != yaml.MappingNode {
+		return
+	}
+	for i := 0; i+1 < len(m.Content); i += 2 {
+		if m.Content[i].Value == "api_key" && m.Content[i+1].Value != "" {
+			m.Content[i+1].Value = "********"
+		}
+	}
+}
+
+// encodeYAML encodes node with the two-space indentation of .aidev.yaml.
+func encodeYAML(node *yaml.Node) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(node); err != nil {
+		return nil, err
+	}
+	err := enc.Close()
+	return buf.Bytes(), err
+}
+
+// configKey resolves a key such as "model" or "model_for.fix" against the
+// fields of ProjectConfig. Map fields take the entry after the dot.
+func configKey(key string) (field reflect.StructField, entry string, err error) {
+	name, entry, dotted := strings.Cut(key, ".")
+	t := reflect.TypeOf(ProjectConfig{})
+	var names []string
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag, _, _ := strings.Cut(f.Tag.Get("yaml"), ",")
+		names = append(names, tag)
+		if tag != name {
+			continue
+		}
+		if dotted && (f.Type.Kind() != reflect.Map || entry == "") {
+			return f, "", fmt.Errorf("%s is not a map", name)
+		}
+		return f, entry, nil
+	}
+	sort.Strings(names)
+	return field, "", fmt.Errorf("unknown config key %q (keys: %s)", name, strings.Join(names, ", "))
+}
+
+// getConfig prints the effective value of key.
+func getConfig(root, key string) error {
+	if _, _, err := configKey(key); err != nil {
+		return err
+	}
+	pc, _, err := loadConfigLayers(root)
+	if err != nil {
+		return err
+	}
+	var doc yaml.Node
+	if err := doc.Encode(pc); err != nil {
+		return err
+	}
+	maskSecrets(&doc)
+	value := &doc
+	for _, part := range strings.Split(key, ".") {
+		if value = mappingValue(value, part); value == nil {
+			return fmt.Errorf("%s is not set", key)
+		}
+	}
+	if value.Kind == yaml.ScalarNode {
+		if value.Tag == "!!null" {
+			return fmt.Errorf("%s is not set", key)
+		}
+		fmt.Println(value.Value)
+		return nil
+	}
+	data, err := encodeYAML(value)
+	if err != nil {
+		return err
+	}
+	fmt.Print(string(data))
+	return nil
+}
+
+// setConfig writes key to .aidev.yaml, or .aidev.local.yaml when local or
+// for the API key, or the global file when global. The value is checked
+// against the key's type and the resulting configuration must load before
+// the file is written.
+func setConfig(root, key, raw string, local, global bool) error {
+	field, entry, err := configKey(key)
+	if err != nil {
+		return err
+	}
+	typ := field.Type
+	if entry != "" {
+		typ = typ.Elem()
+	} else if typ.Kind() == reflect.Map {
+		return fmt.Errorf("%s is a map: use %s.<name>", key, key)
+	}
+	value, err := parseConfigValue(typ, raw)
+	if err != nil {
+		return fmt.Errorf("%s: %w", key, err)
+	}
+
+	files := configFiles(root)
+	target := files[len(files)-2] // .aidev.yaml
+	switch {
+	case local && global:
+		return fmt.Errorf("--local and --global are exclusive")
+	case global:
+		if path := globalConfigPath(); path == "" {
+			return fmt.Errorf("no home directory for the global file")
+		}
+		target = files[0]
+	case key == "workdir":
+		return fmt.Errorf("workdir may only be set in the global configuration: add --global")
+	case local || key == "api_key":
+		target = files[len(files)-1]
+	}
+	file, path := target.name, target.path
+	var doc yaml.Node
+	data, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return fmt.Errorf("%s: %w", file, err)
+	}
+	if len(doc.Content) == 0 {
+		doc = yaml.Node{Kind: yaml.DocumentNode, Content: []*yaml.Node{{Kind: yaml.MappingNode}}}
+	}
+
+	var node yaml.Node
+	if err := node.Encode(value); err != nil {
+		return err
+	}
+	m := doc.Content[0]
+	name, _, _ := strings.Cut(key, ".")
+	if entry != "" {
+		sub := mappingValue(m, name)
+		if sub == nil || sub.Kind != yaml.MappingNode {
+			sub = &yaml.Node{Kind: yaml.MappingNode}
+			setMappingValue(m, name, sub)
+		}
+		m, name = sub, entry
+	}
+	setMappingValue(m, name, &node)
+
+	out, err := encodeYAML(&doc)
+	if err != nil {
+		return err
+	}
+	// Check the merged configuration, so a profile may be selected in
+	// one file and defined in the other.
+	check := &ProjectConfig{}
+	for _, f := range files {
+		content := out
+		if f.path != path {
+			if content, err = os.ReadFile(f.path); os.IsNotExist(err) {
+				continue
+			} else if err != nil {
+				return err
+			}
+		}
+		if err := yaml.Unmarshal(content, check); err != nil {
+			return fmt.Errorf("%s: %w", f.name, err)
+		}
+	}
+	if err := applyProjectConfig(&Config{}, check); err != nil {
+		return fmt.Errorf("%s: %w", key, err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, out, 0644); err != nil {
+		return err
+	}
+	fmt.Printf("%s %s\n", glyph("✅"), trf("Set %s in %s", key, file))
+	return nil
+}
+
+// parseConfigValue converts a command-line value to typ: YAML scalars for
+// numbers, booleans and amounts, comma-separated lists, and JSON or text
+// for provider options.
+func parseConfigValue(typ reflect.Type, raw string) (interface{}, error) {
+	switch typ.Kind() {
+	case reflect.Ptr:
+		return parseConfigValue(typ.Elem(), raw)
+	case reflect.String:
+		return raw, nil
+	case reflect.Interface:
+		return optionValue(raw), nil
+	case reflect.Slice:
+		if typ.Elem().Kind() != reflect.String {
+			return nil, fmt.Errorf("lists of %s can't be set from the command line; edit %s", typ.Elem(), projectConfigFile)
+		}
+		var list []string
+		for _, item := range strings.Split(raw, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				list = append(list, item)
+			}
+		}
+		return list, nil
+	case reflect.Bool, reflect.Int, reflect.Int64, reflect.Float64:
+		v := reflect.New(typ)
+		if err := yaml.Unmarshal([]byte(raw), v.Interface()); err != nil {
+			// Amounts, ages and sizes explain their own format.
+			if _, ok := v.Interface().(yaml.Unmarshaler); ok {
+				return nil, errors.New(strings.TrimPrefix(err.Error(), "line 1: "))
+			}
+			return nil, fmt.Errorf("invalid %s value %q", typ.Kind(), raw)
+		}
+		return v.Elem().Interface(), nil
+	default:
+		return nil, fmt.Errorf("%s values can't be set from the command line; edit %s", typ, projectConfigFile)
+	}
+}
+
+// mappingValue returns the value of key in mapping m, or nil.
+func mappingValue(m *yaml.Node, key string) *yaml.Node {
+	if m.Kind == yaml.DocumentNode && len(m.Content) > 0 {
+		m = m.Content[0]
+	}
+	if m.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(m.Content); i += 2 {
+		if m.Content[i].Value == key {
+			return m.Content[i+1]
+		}
+	}
+	return nil
+}
+
+// setMappingValue replaces or appends key in mapping m, keeping the
+// comments of an existing entry.
+func setMappingValue(m *yaml.Node, key string, value *yaml.Node) {
+	for i := 0; i+1 < len(m.Content); i += 2 {
+		if m.Content[i].Value == key {
+			old := m.Content[i+1]
+			value.LineComment, value.HeadComment, value.FootComment = old.LineComment, old.HeadComment, old.FootComment
+			m.Content[i+1] = value
+			return
+		}
+	}
+	m.Content = append(m.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: key}, value)
+}
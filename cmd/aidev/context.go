@@ -0,0 +1,42 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"ai-dev-agent/service/orchestrator"
+	"ai-dev-agent/service/store"
+	"ai-dev-agent/service/summarize"
+)
+
+// contextCompressor returns the engine hook that summarizes context files
+// with the model routed for the "summarize" task.
+func contextCompressor(config *Config, svc *services) (func(ctx context.Context, files map[string]string) (map[string]string, error), error) {
+	model := config.router().Select("summarize", 0)
+	var chatter summarize.Chatter = orchestrator.TextChatter{LLM: svc.llm}
+	if model != config.Model {
+		client, err := newLLMClient(config, model)
+		if err != nil {
+			return nil, fmt.Errorf("llm (summarize): %w", err)
+		}
+		chatter = orchestrator.TextChatter{LLM: newLLMAdapter(config, client, svc.recorder, svc.llm.spend)}
+	}
+
+	var cache summarize.Cache
+	if svc.recorder.store != nil {
+		cache = storeCache{svc.recorder.store}
+	}
+	return summarize.New(chatter, model, cache, summarize.DefaultConfig()).Compress, nil
+}
+
+// storeCache adapts the state store's cache table.
+type storeCache struct{ st *store.Store }
+
+func (c storeCache) Get(key string) (string, bool) {
+	value, err := c.st.CacheGet(key)
+	return value, err == nil
+}
+
+func (c storeCache) Put(key, value string) {
+	c.st.CachePut(key, value)
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"strings"
+
+	"ai-dev-agent/service/fence"
+	"ai-dev-agent/service/llm"
+)
+
+// maxContinuations bounds the requests made to finish a response cut off
+// at the model's output limit.
+const maxContinuations = 3
+
+// continuePrompt asks the model to resume a truncated response.
+const continuePrompt = "Your response was cut off at the output limit. Continue exactly where you stopped: " +
+	"don't repeat anything, don't reopen the code block you were in, and add no commentary."
+
+// minOverlap is the shortest repeated text stitch removes; shorter matches
+// are likely coincidental.
+const minOverlap = 16
+
+// continuation returns the conversation asking the model to continue
+// response.
+func continuation(messages []llm.Message, response string) []llm.Message {
+	out := append([]llm.Message(nil), messages...)
+	return append(out,
+		llm.Message{Role: "assistant", Content: response},
+		llm.Message{Role: "user", Content: continuePrompt})
+}
+
+// stitch returns the part of piece that continues response. Models often
+// repeat the last lines they sent, or reopen the code block they were in;
+// both are dropped.
+func stitch(response, piece string) string {
+	if blocks := fence.Parse(response); len(blocks) > 0 && !blocks[len(blocks)-1].Closed {
+		trimmed := strings.TrimLeft(piece, " \t\r\n")
+		line, rest, _ := strings.Cut(trimmed, "\n")
+		if reopened := fence.Parse(line + "\n"); len(reopened) == 1 && reopened[0].Start == 0 && strings.TrimSpace(reopened[0].Code) == "" {
+			piece = rest
+			if !strings.HasSuffix(response, "\n") {
+				piece = "\n" + piece
+			}
+		}
+	}
+	for k := min(len(response), len(piece), 1000); k >= minOverlap; k-- {
+		if strings.HasSuffix(response, piece[:k]) {
+			return piece[k:]
+		}
+	}
+	return piece
+}
@@ -0,0 +1,239 @@
+package main
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"runtime/debug"
+	"strings"
+	"sync"
+	"time"
+
+	"ai-dev-agent/service/orchestrator"
+	"ai-dev-agent/service/store"
+)
+
+// recentEvents keeps the last engine events of the process for a crash
+// bundle, whether or not --events logs them.
+var recentEvents = &eventRing{max: 200}
+
+type eventRing struct {
+	mu     sync.Mutex
+	max    int
+	events []orchestrator.Event
+}
+
+func (r *eventRing) add(ev orchestrator.Event) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.events) == r.max {
+		r.events = append(r.events[:0], r.events[1:]...)
+	}
+	r.events = append(r.events, ev)
+}
+
+func (r *eventRing) snapshot() []orchestrator.Event {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]orchestrator.Event(nil), r.events...)
+}
+
+// crash is what went wrong: a recovered panic with its stack, or an error.
+type crash struct {
+	panicked interface{}
+	stack    []byte
+	err      error
+}
+
+// reported wraps an error the user can act on, so it isn't taken for a
+// crash: an operation that failed as its output already told, such as a
+// change that never passed verification, or a setting given wrong.
+type reported struct{ err error }
+
+func (r reported) Error() string { return r.err.Error() }
+func (r reported) Unwrap() error { return r.err }
+
+func reportedError(err error) error {
+	if err == nil {
+		return nil
+	}
+	return reported{err}
+}
+
+// unexpectedError reports whether err is worth a crash bundle: not a
+// reported failure, an invalid configuration, an interruption, a limit or
+// refusal the user set, or something missing.
+func unexpectedError(err error) bool {
+	var r reported
+	var invalid *configError
+	switch {
+	case err == nil, errors.As(err, &r), errors.As(err, &invalid):
+		return false
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		return false
+	case errors.Is(err, ErrSpendLimit), errors.Is(err, orchestrator.ErrRefused):
+		return false
+	case errors.Is(err, fs.ErrNotExist), errors.Is(err, store.ErrNotFound):
+		return false
+	}
+	return true
+}
+
+// writeCrashBundle writes .aidev/crash-<ts>.zip with what a maintainer
+// needs to look into c: the configuration with secrets masked, the last
+// engine events, the stack and the versions of the tool and its
+// toolchain. It returns the bundle's path.
+func writeCrashBundle(config *Config, cmd *Command, c crash) (string, error) {
+	root := config.WorkDir
+	if config.StateRoot != "" {
+		root = config.StateRoot
+	}
+	dir := filepath.Join(root, stateDir)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+	now := time.Now()
+	path := filepath.Join(dir, "crash-"+now.Format("20060102-150405.000")+".zip")
+	f, err := os.Create(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "time: %s\ncommand: %s (%d file(s))\n", now.Format(time.RFC3339), cmd.Type, len(cmd.Files))
+	if c.err != nil {
+		fmt.Fprintf(&b, "error: %v\nchain:", c.err)
+		for e := c.err; e != nil; e = errors.Unwrap(e) {
+			fmt.Fprintf(&b, " %T", e)
+		}
+		b.WriteString("\n")
+	} else {
+		fmt.Fprintf(&b, "panic: %v\n", c.panicked)
+	}
+	files := []struct{ name, content string }{
+		{"crash.txt", b.String()},
+		{"stack.txt", crashStacks(c)},
+		{"config.json", sanitizedConfig(config)},
+		{"events.ndjson", eventLines(recentEvents.snapshot())},
+		{"versions.txt", versions()},
+	}
+
+	zw := zip.NewWriter(f)
+	for _, file := range files {
+		w, err := zw.CreateHeader(&zip.FileHeader{Name: file.name, Method: zip.Deflate, Modified: now})
+		if err != nil {
+			return "", err
+		}
+		if _, err := w.Write([]byte(redactSecrets(config, file.content))); err != nil {
+			return "", err
+		}
+	}
+	if err := zw.Close(); err != nil {
+		return "", err
+	}
+	return path, f.Close()
+}
+
+// reportCrash writes the bundle of c and tells the user what to do with
+// it. A bundle that can't be written is reported instead.
+func reportCrash(config *Config, cmd *Command, c crash) {
+	if c.err == nil {
+		fmt.Fprintf(os.Stderr, "%s %s\n", glyph("💥"), trf("aidev crashed: %v", c.panicked))
+	}
+	path, err := writeCrashBundle(config, cmd, c)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s %s\n", glyph("⚠"), trf("Couldn't write a diagnostic bundle: %v", err))
+		return
+	}
+	fmt.Fprintf(os.Stderr, "%s %s\n", glyph("📦"), trf("A diagnostic bundle is in %s.", path))
+	fmt.Fprintln(os.Stderr, tr("It holds the configuration with secrets masked, the last events of the run, the stack trace and versions, but none of your files or prompts."))
+	fmt.Fprintln(os.Stderr, tr("Look it over, then attach it to a bug report with the command you ran."))
+}
+
+// crashStacks returns the panicking goroutine's stack, then every
+// goroutine's.
+func crashStacks(c crash) string {
+	var b strings.Builder
+	if c.stack != nil {
+		fmt.Fprintf(&b, "panic: %v\n\n%s\n", c.panicked, c.stack)
+	}
+	buf := make([]byte, 1<<20)
+	buf = buf[:runtime.Stack(buf, true)]
+	b.WriteString("all goroutines:\n\n")
+	b.Write(buf)
+	return b.String()
+}
+
+// sanitizedConfig returns the configuration as JSON with its secrets
+// masked.
+func sanitizedConfig(config *Config) string {
+	sc := *config
+	if sc.APIKey != "" {
+		sc.APIKey = "********"
+	}
+	sc.ProvOpts = nil // free-form; may carry credentials
+	if u, err := url.Parse(sc.Repo); err == nil && u.User != nil {
+		u.User = url.User("********")
+		sc.Repo = u.String()
+	}
+	sc.EventLog = nil
+	data, err := json.MarshalIndent(sc, "", "  ")
+	if err != nil {
+		return fmt.Sprintf("encode: %v\n", err)
+	}
+	return string(data) + "\n"
+}
+
+func eventLines(events []orchestrator.Event) string {
+	var b strings.Builder
+	enc := json.NewEncoder(&b)
+	for _, ev := range events {
+		enc.Encode(ev)
+	}
+	return b.String()
+}
+
+// versions lists the tool's build and the toolchain it runs.
+func versions() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "aidev %s\n%s %s/%s\n", Version, runtime.Version(), runtime.GOOS, runtime.GOARCH)
+	for _, tool := range [][]string{{"go", "version"}, {"git", "--version"}} {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		out, err := exec.CommandContext(ctx, tool[0], tool[1:]...).Output()
+		cancel()
+		if err != nil {
+			fmt.Fprintf(&b, "%s: %v\n", tool[0], err)
+			continue
+		}
+		b.Write(out)
+	}
+	if info, ok := debug.ReadBuildInfo(); ok {
+		fmt.Fprintf(&b, "\n%s", info)
+	}
+	return b.String()
+}
+
+// redactSecrets masks the API key and the secrets of the environment
+// wherever they appear in text.
+func redactSecrets(config *Config, text string) string {
+	secrets := []string{config.APIKey}
+	for _, name := range []string{"GLM_API_KEY", "GITHUB_TOKEN", "GITLAB_TOKEN", "GITEA_TOKEN", "JIRA_TOKEN", "AIDEV_WEBHOOK_SECRET"} {
+		secrets = append(secrets, os.Getenv(name))
+	}
+	for _, s := range secrets {
+		// Short values would mask unrelated text and protect little.
+		if len(s) >= 8 {
+			text = strings.ReplaceAll(text, s, "********")
+		}
+	}
+	return text
+}
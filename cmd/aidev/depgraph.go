@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"ai-dev-agent/service/deps"
+	"ai-dev-agent/service/diagnose"
+	"ai-dev-agent/service/filesystem"
+	"ai-dev-agent/service/index"
+)
+
+// Graph formats of deps --graph.
+const (
+	graphDOT     = "dot"
+	graphMermaid = "mermaid"
+)
+
+// runDeps reports the import cycles of the module and the imports its
+// layering rules forbid or, with --graph, writes its dependency graph.
+// The graph comes from the index, brought up to date first.
+func runDeps(ctx context.Context, config *Config, cmd *Command) error {
+	root := config.WorkDir
+	if len(cmd.Files) > 0 {
+		root = cmd.Files[0]
+	}
+	mod, err := deps.ReadGoMod(root)
+	if err != nil {
+		return fmt.Errorf("deps: %w", err)
+	}
+
+	fileMgr, err := filesystem.NewManager(filesystem.Config{RootDir: root, IgnorePatterns: config.Ignore})
+	if err != nil {
+		return fmt.Errorf("filesystem: %w", err)
+	}
+	st, err := openStore(fileMgr.GetRoot())
+	if err != nil {
+		return fmt.Errorf("state: %w", err)
+	}
+	defer st.Close()
+	ix := index.New(fileMgr)
+	entries, err := st.LoadIndex()
+	if err != nil {
+		return fmt.Errorf("load index: %w", err)
+	}
+	ix.Restore(entries)
+	if _, err := ix.Build(ctx, index.BuildOptions{}); err != nil {
+		return fmt.Errorf("index: %w", err)
+	}
+	if err := st.SaveIndex(ix.Entries()); err != nil {
+		return fmt.Errorf("save index: %w", err)
+	}
+	graph := deps.NewGraph(mod, ix.Entries())
+
+	switch config.Graph {
+	case graphDOT:
+		fmt.Print(graph.DOT())
+		return nil
+	case graphMermaid:
+		fmt.Print(graph.Mermaid())
+		return nil
+	}
+
+	rules, archFile, err := layeringRules(config, fileMgr.GetRoot())
+	if err != nil {
+		return err
+	}
+	issues := diagnose.ArchitectureIssues(fileMgr.GetRoot(), graph, rules)
+
+	fmt.Printf("\n%s %s\n", glyph("📊"), trf("%d package(s) in %s", len(graph.Packages), mod.Module))
+	if len(rules) > 0 {
+		fmt.Printf("   %s\n", trf("%d layering rule(s) from %s", len(rules), archFile))
+	}
+	if len(issues) == 0 {
+		fmt.Printf("   %s %s\n", glyph("✅"), tr("No import cycles or layering violations."))
+		return nil
+	}
+	fmt.Println()
+	printIssues(issues, config.Verbose)
+	return fmt.Errorf("found %d issue(s)", len(issues))
+}
+
+// layeringRules returns the layering rules of .aidev.yaml followed by
+// those of the architecture file, the one .aidev.yaml names or else
+// architecture.yaml if the project has one, and where they came from.
+func layeringRules(config *Config, root string) ([]deps.Rule, string, error) {
+	rules := append([]deps.Rule(nil), config.Layering...)
+	var sources []string
+	if len(rules) > 0 {
+		sources = append(sources, projectConfigFile)
+	}
+	file := config.ArchFile
+	if file == "" {
+		file = deps.ArchitectureFile
+		if _, err := os.Stat(filepath.Join(root, file)); err != nil {
+			return rules, strings.Join(sources, ", "), nil
+		}
+	}
+	fileRules, err := deps.LoadArchitecture(filepath.Join(root, file))
+	if err != nil {
+		return nil, "", fmt.Errorf("architecture: %w", err)
+	}
+	return append(rules, fileRules...), strings.Join(append(sources, file), ", "), nil
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"ai-dev-agent/service/deps"
+)
+
+// dependencyHook returns the engine hook that detects imports of modules
+// not yet in go.mod, checks them against OSV and adds them on confirmation.
+func dependencyHook(config *Config) func(ctx context.Context, workDir, modFile string, files map[string]string) error {
+	if config.NoDeps {
+		return nil
+	}
+	checker := deps.NewChecker(deps.DefaultConfig())
+	return func(ctx context.Context, workDir, modFile string, files map[string]string) error {
+		missing, err := deps.MissingImports(workDir, files)
+		if errors.Is(err, deps.ErrNoModule) || len(missing) == 0 {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("\n📦 New imports not in go.mod: %s\n", strings.Join(missing, ", "))
+		modules, unresolved := checker.Resolve(ctx, workDir, missing)
+		for _, imp := range unresolved {
+			fmt.Printf("  ⚠ %s: no module found\n", imp)
+		}
+
+		for _, mod := range modules {
+			vulns, err := checker.Vulnerabilities(ctx, mod)
+			switch {
+			case err != nil:
+				fmt.Printf("  ⚠ %s@%s: vulnerability check unavailable (%v)\n", mod.Path, mod.Version, err)
+			case len(vulns) > 0:
+				fmt.Printf("  ❌ %s@%s: %d known vulnerabilit(ies)\n", mod.Path, mod.Version, len(vulns))
+				for _, v := range vulns {
+					fmt.Printf("      %s %s\n", v.ID, truncate(v.Summary, 80))
+				}
+			default:
+				fmt.Printf("  ✅ %s@%s: no known vulnerabilities\n", mod.Path, mod.Version)
+			}
+
+			if config.DryRun {
+				continue
+			}
+			// --yes never adds a module with known vulnerabilities.
+			ok := config.Yes && err == nil && len(vulns) == 0
+			if !ok {
+				ok = confirm(fmt.Sprintf("  Add %s@%s to go.mod?", mod.Path, mod.Version))
+			}
+			if !ok {
+				fmt.Printf("  Skipped %s\n", mod.Path)
+				continue
+			}
+			if err := checker.Get(ctx, workDir, modFile, mod); err != nil {
+				fmt.Printf("  ❌ %v\n", err)
+				continue
+			}
+			fmt.Printf("  ✅ Added %s@%s\n", mod.Path, mod.Version)
+		}
+		fmt.Println()
+		return nil
+	}
+}
+
+// confirm asks a yes/no question on stdin; anything but "y" is a no.
+func confirm(question string) bool {
+	fmt.Printf("%s [y/N] ", question)
+	answer, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil {
+		fmt.Println()
+		return false
+	}
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes"
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"ai-dev-agent/service/diagnose"
+)
+
+// applyDiagnostics loads the --diagnostics export and turns it into the fix
+// request: target files (narrowed to the named ones, if any), an instruction
+// listing the diagnostics, and their lines by file. No build is run to find
+// the errors; the editor already did.
+func applyDiagnostics(config *Config, cmd *Command) (map[string][]int, error) {
+	data, err := os.ReadFile(config.DiagFile)
+	if err != nil {
+		return nil, fmt.Errorf("diagnostics: %w", err)
+	}
+	issues, err := diagnose.ParseDiagnostics(data, config.WorkDir)
+	if err != nil {
+		return nil, fmt.Errorf("diagnostics: %s: %w", config.DiagFile, err)
+	}
+
+	wanted := make(map[string]bool)
+	for _, f := range cmd.Files {
+		wanted[filepath.Clean(f)] = true
+	}
+	var files []string
+	var list []string
+	lines := make(map[string][]int)
+	skipped := 0
+	for _, issue := range issues {
+		if len(wanted) > 0 && !wanted[issue.File] {
+			continue
+		}
+		if filepath.IsAbs(issue.File) || strings.HasPrefix(issue.File, "..") {
+			skipped++
+			continue
+		}
+		if _, ok := lines[issue.File]; !ok {
+			files = append(files, issue.File)
+		}
+		lines[issue.File] = append(lines[issue.File], issue.Line)
+		list = append(list, fmt.Sprintf("- %s:%d:%d: %s: %s", issue.File, issue.Line, issue.Column, issue.Level, issue.Description))
+	}
+	if skipped > 0 {
+		fmt.Printf("⚠ Skipping %d diagnostic(s) outside %s\n", skipped, config.WorkDir)
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("diagnostics: nothing to fix in the target files")
+	}
+	fmt.Printf("🔍 %d diagnostic(s) in %d file(s) from %s\n", len(list), len(files), config.DiagFile)
+
+	instruction := "Fix these diagnostics reported by the language server:\n" + strings.Join(list, "\n")
+	if cmd.Instruction != "" {
+		instruction = cmd.Instruction + "\n\n" + instruction
+	}
+	cmd.Files, cmd.Instruction = files, instruction
+	return lines, nil
+}
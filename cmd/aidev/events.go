@@ -0,0 +1,70 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+
+	"ai-dev-agent/service/orchestrator"
+)
+
+// eventLog writes orchestrator events for wrappers (editor plugins, CI)
+// that follow a run without scraping its human-oriented output.
+type eventLog struct {
+	mu  sync.Mutex
+	w   io.Writer
+	c   io.Closer // nil for the standard streams
+	enc *json.Encoder
+}
+
+// openEventLog opens the event log in format to target: a file path, "-"
+// for stdout, "fd:N" for an inherited descriptor, or "" for stderr. Only
+// the ndjson format exists.
+func openEventLog(format, target string) (*eventLog, error) {
+	if format != "ndjson" {
+		return nil, fmt.Errorf("unsupported event format %q (want ndjson)", format)
+	}
+	var w io.Writer
+	var c io.Closer
+	switch {
+	case target == "":
+		w = os.Stderr
+	case target == "-":
+		w = os.Stdout
+	case strings.HasPrefix(target, "fd:"):
+		fd, err := strconv.Atoi(strings.TrimPrefix(target, "fd:"))
+		if err != nil || fd < 0 {
+			return nil, fmt.Errorf("invalid event descriptor %q", target)
+		}
+		f := os.NewFile(uintptr(fd), target)
+		if f == nil {
+			return nil, fmt.Errorf("invalid event descriptor %q", target)
+		}
+		w, c = f, f
+	default:
+		f, err := os.OpenFile(target, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
+		if err != nil {
+			return nil, fmt.Errorf("open event log: %w", err)
+		}
+		w, c = f, f
+	}
+	return &eventLog{w: w, c: c, enc: json.NewEncoder(w)}, nil
+}
+
+// emit writes one event per line. Write errors are ignored so a closed
+// reader never fails the run.
+func (l *eventLog) emit(ev orchestrator.Event) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.enc.Encode(ev)
+}
+
+func (l *eventLog) close() {
+	if l.c != nil {
+		l.c.Close()
+	}
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"ai-dev-agent/service/orchestrator"
+	"ai-dev-agent/service/refactor"
+)
+
+// runExtract extracts lines of a file: statements into a function, or
+// declarations into the package --into names. The splice is mechanical;
+// the LLM then names the function, tidies its parameters and writes the
+// doc comments, verified by the build and the tests. Offline the
+// function keeps its placeholder name.
+func runExtract(ctx context.Context, config *Config, cmd *Command) error {
+	if len(cmd.Files) != 1 {
+		return fmt.Errorf("usage: aidev extract <file>:<start>-<end> [--into <dir>]")
+	}
+	file, start, end, err := parseLineRange(cmd.Files[0])
+	if err != nil {
+		return err
+	}
+	m, err := refactor.Load(config.WorkDir)
+	if err != nil {
+		return fmt.Errorf("extract: %w", err)
+	}
+	into := ""
+	if config.Into != "" {
+		into = strings.TrimSuffix(movePath(config, config.Into), "/")
+	}
+	result, extracted, err := m.Extract(movePath(config, file), start, end, into)
+	if err != nil {
+		return reportedError(fmt.Errorf("extract: %w", err))
+	}
+
+	printRefactorPlan(result)
+	if config.DryRun {
+		return nil
+	}
+	if err := applyRefactor(config, result); err != nil {
+		return err
+	}
+	if config.Offline {
+		verification := verifyRefactor(ctx, config, true)
+		fmt.Printf("\n  %s %s\n", passMark(verification), verification.Summary())
+		if len(result.Conflicts) > 0 || !verification.Passed() {
+			return fmt.Errorf("%d conflict(s) and %d build or test error(s) are left to resolve", len(result.Conflicts), len(verification.Issues))
+		}
+		if extracted.Func != "" {
+			fmt.Printf("%s %s\n", glyph("ℹ"), trf("Kept the placeholder name %s (offline).", extracted.Func))
+		}
+		return nil
+	}
+
+	files := []string{extracted.File}
+	for _, f := range result.Changed() {
+		if !containsString(files, f) {
+			files = append(files, f)
+		}
+	}
+	config.RunTests = true
+	fmt.Printf("\n%s %s\n", glyph("🔧"), trf("Naming and documenting the extracted code in %s", extracted.File))
+	return finishRefactor(ctx, config, cmd, orchestrator.ModeRefactor, files, extractInstruction(cmd, result, extracted))
+}
+
+// parseLineRange parses file:start-end, or file:line.
+func parseLineRange(arg string) (file string, start, end int, err error) {
+	colon := strings.LastIndex(arg, ":")
+	if colon < 0 {
+		return "", 0, 0, fmt.Errorf("%s: give the lines to extract as file:start-end", arg)
+	}
+	file = arg[:colon]
+	first, last, isRange := strings.Cut(arg[colon+1:], "-")
+	if start, err = strconv.Atoi(first); err == nil {
+		end = start
+		if isRange {
+			end, err = strconv.Atoi(last)
+		}
+	}
+	if err != nil || start < 1 || end < start {
+		return "", 0, 0, fmt.Errorf("%s: invalid line range", arg)
+	}
+	return file, start, end, nil
+}
+
+// extractInstruction tells the LLM what the mechanical extraction left to
+// do.
+func extractInstruction(cmd *Command, result *refactor.Result, extracted *refactor.Extracted) string {
+	var b strings.Builder
+	if extracted.Func != "" {
+		fmt.Fprintf(&b, "`aidev extract %s` moved the lines into the function %s in %s, called in their place, mechanically.\n", cmd.Files[0], extracted.Func, extracted.File)
+		fmt.Fprintf(&b, "- Rename %s after what it does, at its declaration and its call.\n", extracted.Func)
+		b.WriteString("- Tidy its parameters and results: drop the ones it doesn't need, and order and name them naturally.\n")
+		b.WriteString("- Write its doc comment.\n")
+	} else {
+		fmt.Fprintf(&b, "`aidev extract %s` moved %s to %s, with their references updated, mechanically.\n", cmd.Files[0], strings.Join(extracted.Decls, ", "), extracted.File)
+		b.WriteString("- Write or fix the doc comments of the moved declarations for their new package.\n")
+	}
+	if len(result.Conflicts) > 0 {
+		b.WriteString("- Resolve what the extraction couldn't:\n")
+		for _, c := range result.Conflicts {
+			fmt.Fprintf(&b, "  - %s\n", c)
+		}
+	}
+	b.WriteString("Keep the behavior unchanged and don't undo the extraction.")
+	return b.String()
+}
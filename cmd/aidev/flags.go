@@ -0,0 +1,60 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// flagError is an invalid command-line flag value, with the form a valid
+// one takes.
+type flagError struct {
+	Flag  string
+	Value string
+	Want  string
+}
+
+func (e *flagError) Error() string {
+	if e.Want == "" {
+		return fmt.Sprintf("%s takes no value (got %q)", e.Flag, e.Value)
+	}
+	return fmt.Sprintf("invalid value %q for %s: want %s", e.Value, e.Flag, e.Want)
+}
+
+// parseInlineFlag parses --name=value at args[i] as if it were given as
+// --name value.
+func parseInlineFlag(config *Config, cmd *Command, args []string, i int, name, value string) (int, error) {
+	expanded := append(append(args[:i:i], name, value), args[i+1:]...)
+	next, err := parseFlag(config, cmd, expanded, i)
+	if err != nil {
+		return 0, err
+	}
+	if next != i+2 {
+		return 0, &flagError{Flag: name, Value: value}
+	}
+	return i + 1, nil
+}
+
+// intFlag parses the value of the flag at args[i] as a whole number.
+func intFlag(args []string, i int) (int, error) {
+	if i+1 >= len(args) {
+		return 0, fmt.Errorf("missing value for %s", args[i])
+	}
+	n, err := strconv.Atoi(args[i+1])
+	if err != nil {
+		return 0, &flagError{Flag: args[i], Value: args[i+1], Want: "a whole number, e.g. 3"}
+	}
+	return n, nil
+}
+
+// durationFlag parses the value of the flag at args[i] as a duration.
+func durationFlag(args []string, i int) (time.Duration, error) {
+	if i+1 >= len(args) {
+		return 0, fmt.Errorf("missing value for %s", args[i])
+	}
+	d, err := time.ParseDuration(args[i+1])
+	if err != nil {
+		return 0, &flagError{Flag: args[i], Value: args[i+1], Want: "a duration such as 90s, 5m or 1h30m"}
+	}
+	return d, nil
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"ai-dev-agent/service/diagnose"
+	"ai-dev-agent/service/store"
+)
+
+// footprintHistory is how many earlier footprints diagnose compares with.
+const footprintHistory = 5
+
+// footprints returns the footprints earlier diagnose runs recorded,
+// newest first; none if there is no store.
+func footprints(st *store.Store) []diagnose.Footprint {
+	if st == nil {
+		return nil
+	}
+	recorded, err := st.Footprints(footprintHistory)
+	if err != nil {
+		return nil
+	}
+	history := make([]diagnose.Footprint, len(recorded))
+	for i, f := range recorded {
+		history[i] = diagnose.Footprint{BuildTime: f.BuildTime, BinarySize: f.BinarySize, Binaries: f.Binaries, Modules: f.Modules, CreatedAt: f.CreatedAt}
+	}
+	return history
+}
+
+// recordFootprint adds the footprint of a diagnose run to the store.
+func recordFootprint(st *store.Store, fp *diagnose.Footprint) error {
+	if st == nil || fp == nil {
+		return nil
+	}
+	return st.AddFootprint(store.Footprint{BuildTime: fp.BuildTime, BinarySize: fp.BinarySize, Binaries: fp.Binaries, Modules: fp.Modules, CreatedAt: fp.CreatedAt})
+}
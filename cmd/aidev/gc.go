@@ -0,0 +1,222 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"ai-dev-agent/service/filesystem"
+	"ai-dev-agent/service/store"
+)
+
+// defaultRetainAge is what gc removes when the project sets no retention.
+const defaultRetainAge = 30 * 24 * time.Hour
+
+// gcInterval is how often runs apply the retention settings on their own.
+const gcInterval = 24 * time.Hour
+
+// gcLastRunKey holds the time of the last automatic collection in the
+// state cache.
+const gcLastRunKey = "gc:last-run"
+
+// Age is a retention period in .aidev.yaml: a Go duration, or days and
+// weeks such as 30d or 2w.
+type Age time.Duration
+
+// UnmarshalYAML parses a duration with optional d and w units.
+func (a *Age) UnmarshalYAML(node *yaml.Node) error {
+	d, err := parseAge(node.Value)
+	if err != nil {
+		return fmt.Errorf("line %d: %w", node.Line, err)
+	}
+	*a = Age(d)
+	return nil
+}
+
+// MarshalYAML writes the age as it would be typed.
+func (a Age) MarshalYAML() (interface{}, error) {
+	return a.String(), nil
+}
+
+// String formats whole days as such, e.g. 30d.
+func (a Age) String() string {
+	d := time.Duration(a)
+	if d > 0 && d%(24*time.Hour) == 0 {
+		return fmt.Sprintf("%dd", d/(24*time.Hour))
+	}
+	return d.String()
+}
+
+// ByteSize is a size in .aidev.yaml, in bytes or with a KB, MB or GB
+// unit (powers of 1024).
+type ByteSize int64
+
+// UnmarshalYAML parses a size with an optional unit.
+func (b *ByteSize) UnmarshalYAML(node *yaml.Node) error {
+	n, err := parseByteSize(node.Value)
+	if err != nil {
+		return fmt.Errorf("line %d: %w", node.Line, err)
+	}
+	*b = ByteSize(n)
+	return nil
+}
+
+// MarshalYAML writes the size with the largest exact unit.
+func (b ByteSize) MarshalYAML() (interface{}, error) {
+	for _, u := range []struct {
+		name string
+		size int64
+	}{{"GB", 1 << 30}, {"MB", 1 << 20}, {"KB", 1 << 10}} {
+		if b > 0 && int64(b)%u.size == 0 {
+			return fmt.Sprintf("%d%s", int64(b)/u.size, u.name), nil
+		}
+	}
+	return int64(b), nil
+}
+
+// gcReport totals what a collection removed.
+type gcReport struct {
+	backups filesystem.BackupPruneStats
+	state   store.PruneStats
+}
+
+func (r gcReport) empty() bool {
+	return r.backups.Backups+r.state.Sessions+r.state.CacheEntries+r.state.Backups == 0 && r.bytes() == 0
+}
+
+func (r gcReport) bytes() int64 {
+	return r.backups.Bytes + r.state.Bytes
+}
+
+// runGC applies the retention settings now, reporting the space reclaimed.
+func runGC(ctx context.Context, config *Config, cmd *Command) error {
+	age, size := config.RetainAge, config.RetainSize
+	if age == 0 && size == 0 {
+		age = defaultRetainAge
+		fmt.Printf("  %s %s\n", glyph("ℹ"), trf("No retention settings; removing what is older than %s.", Age(age).String()))
+	}
+
+	st, err := openStore(config.WorkDir)
+	if err != nil {
+		return fmt.Errorf("state: %w", err)
+	}
+	defer st.Close()
+
+	report, err := collectGarbage(config.WorkDir, st, age, size)
+	if err != nil {
+		return err
+	}
+	if report.empty() {
+		fmt.Printf("%s %s\n", glyph("✅"), tr("Nothing to remove."))
+		return nil
+	}
+	fmt.Printf("%s %s\n", glyph("✅"), trf("Reclaimed %s", formatBytes(report.bytes())))
+	fmt.Printf("   %s\n", trf("Backups: %d", report.backups.Backups))
+	fmt.Printf("   %s\n", trf("Sessions and their transcripts: %d", report.state.Sessions))
+	fmt.Printf("   %s\n", trf("Cache entries: %d", report.state.CacheEntries))
+	return nil
+}
+
+// autoGC applies the retention settings at most once per gcInterval, so
+// .ai-backup and the state database stay bounded without running gc.
+func autoGC(root string, st *store.Store, config *Config) {
+	if st == nil || config.ReadOnly || config.RetainAge == 0 && config.RetainSize == 0 {
+		return
+	}
+	if last, err := st.CacheGet(gcLastRunKey); err == nil {
+		if t, err := time.Parse(time.RFC3339, last); err == nil && time.Since(t) < gcInterval {
+			return
+		}
+	}
+	st.CachePut(gcLastRunKey, time.Now().UTC().Format(time.RFC3339))
+
+	report, err := collectGarbage(root, st, config.RetainAge, config.RetainSize)
+	if err != nil {
+		fmt.Printf("  %s %s\n", glyph("⚠"), trf("Retention: %v", err))
+		return
+	}
+	if !report.empty() {
+		fmt.Printf("  %s %s\n", glyph("ℹ"), trf("Retention: reclaimed %s of old backups and sessions", formatBytes(report.bytes())))
+	}
+}
+
+// collectGarbage removes the backups of root and the state in st that
+// are older than age (zero keeps them), then the oldest backups until
+// they take at most size bytes (zero for no limit). Provenance manifests
+// are kept for blame-ai.
+func collectGarbage(root string, st *store.Store, age time.Duration, size int64) (gcReport, error) {
+	var report gcReport
+	var before time.Time
+	if age > 0 {
+		before = time.Now().Add(-age)
+	}
+
+	fileMgr, err := filesystem.NewManager(filesystem.Config{RootDir: root})
+	if err != nil {
+		return report, fmt.Errorf("filesystem: %w", err)
+	}
+	if report.backups, err = fileMgr.PruneBackups(before, size); err != nil {
+		return report, fmt.Errorf("backups: %w", err)
+	}
+	// Pruned after the backups, so entries of removed backup files go too.
+	if report.state, err = st.Prune(before); err != nil {
+		return report, fmt.Errorf("state: %w", err)
+	}
+	return report, nil
+}
+
+// Helper functions
+
+func parseAge(s string) (time.Duration, error) {
+	s = strings.TrimSpace(s)
+	for unit, size := range map[string]time.Duration{"d": 24 * time.Hour, "w": 7 * 24 * time.Hour} {
+		if n, ok := strings.CutSuffix(s, unit); ok {
+			v, err := strconv.ParseFloat(n, 64)
+			if err != nil || v < 0 {
+				return 0, fmt.Errorf("invalid age %q", s)
+			}
+			return time.Duration(v * float64(size)), nil
+		}
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("invalid age %q (e.g. 30d, 2w or 72h)", s)
+	}
+	return d, nil
+}
+
+func parseByteSize(s string) (int64, error) {
+	s = strings.TrimSpace(s)
+	upper := strings.ToUpper(s)
+	mult := int64(1)
+	for _, u := range []struct {
+		suffix string
+		size   int64
+	}{{"GIB", 1 << 30}, {"MIB", 1 << 20}, {"KIB", 1 << 10}, {"GB", 1 << 30}, {"MB", 1 << 20}, {"KB", 1 << 10}, {"G", 1 << 30}, {"M", 1 << 20}, {"K", 1 << 10}, {"B", 1}} {
+		if strings.HasSuffix(upper, u.suffix) {
+			upper, mult = strings.TrimSuffix(upper, u.suffix), u.size
+			break
+		}
+	}
+	v, err := strconv.ParseFloat(strings.TrimSpace(upper), 64)
+	if err != nil || v < 0 {
+		return 0, fmt.Errorf("invalid size %q (e.g. 500MB or 2GB)", s)
+	}
+	return int64(v * float64(mult)), nil
+}
+
+func formatBytes(n int64) string {
+	switch {
+	case n >= 1<<30:
+		return fmt.Sprintf("%.1f GB", float64(n)/(1<<30))
+	case n >= 1<<20:
+		return fmt.Sprintf("%.1f MB", float64(n)/(1<<20))
+	case n >= 1<<10:
+		return fmt.Sprintf("%.1f KB", float64(n)/(1<<10))
+	}
+	return fmt.Sprintf("%d B", n)
+}
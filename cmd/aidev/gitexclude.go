@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"ai-dev-agent/service/gitrepo"
+	"ai-dev-agent/service/store"
+)
+
+// artifactDirs are the directories the agent writes into the project:
+// backups and the state database. They never belong in a commit.
+var artifactDirs = []string{".ai-backup/", stateDir + "/"}
+
+// Where git_exclude in .aidev.yaml adds the artifact directories. Unset,
+// the user is asked on the first write whether to add them to .gitignore.
+const (
+	gitExcludeIgnore = "gitignore" // .gitignore of the project
+	gitExcludeLocal  = "local"     // .git/info/exclude, never shared
+	gitExcludeGlobal = "global"    // the user's core.excludesFile
+	gitExcludeOff    = "off"
+)
+
+// gitExcludeDeclinedKey records in the state cache that the user said no,
+// so the question isn't asked again.
+const gitExcludeDeclinedKey = "git-exclude:declined"
+
+// excludeArtifacts makes sure git ignores the artifact directories of
+// root before the agent first writes there. Outside a git repository, or
+// when they are ignored already, there is nothing to do.
+func excludeArtifacts(ctx context.Context, root string, st *store.Store, config *Config) {
+	mode := config.GitExclude
+	if mode == gitExcludeOff {
+		return
+	}
+	git := gitrepo.NewClient(gitrepo.Config{})
+	if _, err := git.Root(ctx, root); err != nil {
+		return
+	}
+	ignored, err := git.Ignored(ctx, root, artifactDirs)
+	if err != nil {
+		return
+	}
+	var missing []string
+	for _, dir := range artifactDirs {
+		if !ignored[dir] {
+			missing = append(missing, dir)
+		}
+	}
+	if len(missing) == 0 {
+		return
+	}
+
+	if mode == "" {
+		if st != nil {
+			if _, err := st.CacheGet(gitExcludeDeclinedKey); err == nil {
+				return
+			}
+		}
+		if !stdinIsTerminal() {
+			fmt.Printf("  %s %s\n", glyph("ℹ"), trf("%s are not ignored by git; set git_exclude in %s to add them", strings.Join(missing, ", "), projectConfigFile))
+			return
+		}
+		if !confirm(fmt.Sprintf("%s %s", glyph("ℹ"), trf("Add %s to .gitignore so backups are never committed?", strings.Join(missing, ", ")))) {
+			if st != nil {
+				st.CachePut(gitExcludeDeclinedKey, "1")
+			}
+			return
+		}
+		mode = gitExcludeIgnore
+	}
+
+	file, err := excludeFile(ctx, git, root, mode)
+	if err == nil {
+		err = appendLines(file, missing)
+	}
+	if err != nil {
+		fmt.Printf("  %s %s\n", glyph("⚠"), trf("Could not exclude %s from git: %v", strings.Join(missing, ", "), err))
+		return
+	}
+	fmt.Printf("  %s %s\n", glyph("✅"), trf("Excluded %s from git in %s", strings.Join(missing, ", "), file))
+}
+
+// excludeFile returns the ignore file mode writes to.
+func excludeFile(ctx context.Context, git *gitrepo.Client, root, mode string) (string, error) {
+	switch mode {
+	case gitExcludeIgnore:
+		return filepath.Join(root, ".gitignore"), nil
+	case gitExcludeLocal:
+		dir, err := git.GitDir(ctx, root)
+		if err != nil {
+			return "", err
+		}
+		return filepath.Join(dir, "info", "exclude"), nil
+	case gitExcludeGlobal:
+		return git.ExcludesFile(ctx, root)
+	}
+	return "", fmt.Errorf("unknown git_exclude %q (gitignore, local, global or off)", mode)
+}
+
+// Helper functions
+
+// appendLines adds lines to the end of file, creating it if needed.
+func appendLines(file string, lines []string) error {
+	data, err := os.ReadFile(file)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if len(data) > 0 && !strings.HasSuffix(string(data), "\n") {
+		data = append(data, '\n')
+	}
+	data = append(data, strings.Join(lines, "\n")+"\n"...)
+	if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(file, data, 0644)
+}
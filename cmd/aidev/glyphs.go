@@ -0,0 +1,70 @@
+package main
+
+import (
+	"os"
+	"runtime"
+	"strings"
+)
+
+// ascii replaces emoji and box-drawing characters with plain-text markers,
+// for CI logs and terminals that garble them. It is set by --ascii or
+// detected from the terminal.
+var ascii = detectASCII()
+
+// asciiGlyphs are the plain-text markers of the glyphs in CLI output.
+var asciiGlyphs = map[string]string{
+	"✅": "[OK]",
+	"❌": "[FAIL]",
+	"⚠": "[WARN]",
+	"ℹ": "[INFO]",
+	"📝": "*",
+	"🔍": "[DIAG]",
+	"🔧": "[FIX]",
+	"🐛": "[DEBUG]",
+	"🔑": "[KEY]",
+	"📊": "[STATS]",
+	"💡": "[HINT]",
+	"🔴": "[CRIT]",
+	"🟠": "[ERR]",
+	"🟡": "[WARN]",
+	"💥": "[CRASH]",
+	"📦": "[BUNDLE]",
+}
+
+// detectASCII reports whether the terminal is unlikely to render emoji:
+// a dumb terminal, a non-UTF-8 locale, or a Windows console other than
+// Windows Terminal.
+func detectASCII() bool {
+	if os.Getenv("TERM") == "dumb" {
+		return true
+	}
+	for _, name := range []string{"LC_ALL", "LC_CTYPE", "LANG"} {
+		if v := os.Getenv(name); v != "" {
+			v = strings.ToLower(v)
+			if v == "c" || v == "posix" || strings.Contains(v, ".") && !strings.Contains(v, "utf-8") && !strings.Contains(v, "utf8") {
+				return true
+			}
+			break
+		}
+	}
+	return runtime.GOOS == "windows" && os.Getenv("WT_SESSION") == ""
+}
+
+// glyph returns g, or its plain-text marker in ASCII mode.
+func glyph(g string) string {
+	if !ascii {
+		return g
+	}
+	if m, ok := asciiGlyphs[g]; ok {
+		return m
+	}
+	return g
+}
+
+// rule returns the horizontal line framing reports.
+func rule() string {
+	if ascii {
+		return strings.Repeat("-", 40)
+	}
+	return strings.Repeat("━", 40)
+}
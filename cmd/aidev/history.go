@@ -0,0 +1,136 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"ai-dev-agent/service/diff"
+	"ai-dev-agent/service/provenance"
+	"ai-dev-agent/service/store"
+)
+
+func runHistory(ctx context.Context, config *Config, cmd *Command) error {
+	st, err := openStore(config.WorkDir)
+	if err != nil {
+		return fmt.Errorf("state: %w", err)
+	}
+	defer st.Close()
+
+	limit := cmd.Limit
+	if limit == 0 {
+		limit = 20
+	}
+	sessions, err := st.ListSessions(store.SessionFilter{
+		File:  filepath.ToSlash(cmd.FilterFile),
+		Grep:  cmd.Grep,
+		Limit: limit,
+	})
+	if err != nil {
+		return fmt.Errorf("list sessions: %w", err)
+	}
+
+	if len(sessions) == 0 {
+		fmt.Println("No operations recorded.")
+		return nil
+	}
+
+	for _, sess := range sessions {
+		status := "✅"
+		if !sess.Success {
+			status = "❌"
+		}
+		files, _ := st.SessionFiles(sess.ID)
+		paths := make([]string, 0, len(files))
+		for _, f := range files {
+			paths = append(paths, f.Path)
+		}
+
+		fmt.Printf("%s %s  %s  %-8s attempts=%d\n", status, sess.ID,
+			sess.StartedAt.Local().Format("2006-01-02 15:04"), sess.Mode, sess.Attempts)
+		if sess.Instruction != "" {
+			fmt.Printf("    %s\n", truncate(firstLine(sess.Instruction), 100))
+		}
+		if len(paths) > 0 {
+			fmt.Printf("    files: %s\n", strings.Join(paths, ", "))
+		}
+		if !sess.Success && sess.Error != "" && config.Verbose {
+			fmt.Printf("    error: %s\n", truncate(firstLine(sess.Error), 100))
+		}
+	}
+	return nil
+}
+
+func runShow(ctx context.Context, config *Config, cmd *Command) error {
+	st, err := openStore(config.WorkDir)
+	if err != nil {
+		return fmt.Errorf("state: %w", err)
+	}
+	defer st.Close()
+
+	sess, err := st.GetSession(cmd.Files[0])
+	if err != nil {
+		return fmt.Errorf("session %s: %w", cmd.Files[0], err)
+	}
+
+	status := "succeeded"
+	if !sess.Success {
+		status = "failed"
+	}
+	fmt.Printf("Session:  %s\n", sess.ID)
+	fmt.Printf("Mode:     %s (%s after %d attempt(s))\n", sess.Mode, status, sess.Attempts)
+	fmt.Printf("Model:    %s\n", sess.Model)
+	fmt.Printf("Started:  %s\n", sess.StartedAt.Local().Format("2006-01-02 15:04:05"))
+	if !sess.FinishedAt.IsZero() {
+		fmt.Printf("Duration: %v\n", sess.FinishedAt.Sub(sess.StartedAt).Round(time.Millisecond))
+	}
+	if usage, err := st.SessionUsage(sess.ID); err == nil && usage.TotalTokens > 0 {
+		fmt.Printf("Tokens:   %d (prompt %d, completion %d)\n", usage.TotalTokens, usage.PromptTokens, usage.CompletionTokens)
+	}
+	if sess.Instruction != "" {
+		fmt.Printf("\nInstruction:\n  %s\n", strings.ReplaceAll(sess.Instruction, "\n", "\n  "))
+	}
+	if sess.Error != "" {
+		fmt.Printf("\nError:\n  %s\n", strings.ReplaceAll(sess.Error, "\n", "\n  "))
+	}
+
+	if m, err := provenance.Read(provenanceDir(config.WorkDir), sess.ID); err == nil {
+		signed, fingerprint, verr := provenance.Verify(provenanceDir(config.WorkDir), sess.ID)
+		switch {
+		case verr != nil:
+			fmt.Printf("Provenance: %d file(s), ⚠ %v\n", len(m.Files), verr)
+		case signed:
+			fmt.Printf("Provenance: %d file(s), signed by %s\n", len(m.Files), fingerprint)
+		default:
+			fmt.Printf("Provenance: %d file(s), unsigned\n", len(m.Files))
+		}
+	}
+
+	files, err := st.SessionFiles(sess.ID)
+	if err != nil {
+		return fmt.Errorf("session files: %w", err)
+	}
+	if len(files) == 0 {
+		fmt.Println("\nNo files changed.")
+		return nil
+	}
+	fmt.Println()
+	for _, f := range files {
+		patch := diff.Unified(f.Path, f.Before, f.After, 3)
+		if patch == "" {
+			fmt.Printf("%s: no changes\n", f.Path)
+			continue
+		}
+		fmt.Print(patch)
+	}
+	return nil
+}
+
+func firstLine(s string) string {
+	if i := strings.IndexByte(s, '\n'); i >= 0 {
+		return s[:i] + " …"
+	}
+	return s
+}
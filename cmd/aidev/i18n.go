@@ -0,0 +1,349 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// lang is the language of user-facing output, chosen by --lang or the
+// locale. English text is the message key, so a message missing from a
+// catalog falls back to English.
+var lang = detectLang()
+
+// catalogs translates English messages by language.
+var catalogs = map[string]map[string]string{
+	"zh": zhMessages,
+}
+
+// detectLang picks the output language from the locale variables.
+func detectLang() string {
+	for _, name := range []string{"LC_ALL", "LC_MESSAGES", "LANG"} {
+		if v := os.Getenv(name); v != "" {
+			if strings.HasPrefix(strings.ToLower(v), "zh") {
+				return "zh"
+			}
+			return "en"
+		}
+	}
+	return "en"
+}
+
+// setLang selects the output language given to --lang.
+func setLang(name string) error {
+	name = strings.ToLower(name)
+	if i := strings.IndexAny(name, "_-."); i > 0 {
+		name = name[:i]
+	}
+	if _, ok := catalogs[name]; !ok && name != "en" {
+		return fmt.Errorf("unsupported language %q (want en or zh)", name)
+	}
+	lang = name
+	return nil
+}
+
+// tr translates a message into the output language.
+func tr(msg string) string {
+	if t, ok := catalogs[lang][msg]; ok {
+		return t
+	}
+	return msg
+}
+
+// trf translates a format string and formats it.
+func trf(format string, args ...interface{}) string {
+	return fmt.Sprintf(tr(format), args...)
+}
+
+// usageColumn is where flag descriptions start in the usage text.
+const usageColumn = 26
+
+// trUsage translates usage text line by line: section headers whole, and
+// the descriptions after a command, flag or example column.
+func trUsage(text string) string {
+	if lang == "en" {
+		return text
+	}
+	lines := strings.Split(text, "\n")
+	for i, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		if t, ok := catalogs[lang][trimmed]; ok {
+			lines[i] = strings.Replace(line, trimmed, t, 1)
+			continue
+		}
+		// A description follows a "# " comment, a run of spaces, or a
+		// flag that fills its column.
+		cols := []int{strings.Index(line, " # ") + 1, strings.LastIndex(strings.TrimRight(line, " "), "  ") + 2, usageColumn}
+		for _, col := range cols {
+			if col <= 0 || col >= len(line) {
+				continue
+			}
+			if t, ok := catalogs[lang][line[col:]]; ok {
+				lines[i] = line[:col] + t
+				break
+			}
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+var zhMessages = map[string]string{
+	// Usage
+	"AI Dev Agent - AI-powered code assistant": "AI Dev Agent - AI 编程助手",
+	"Usage:":    "用法:",
+	"Commands:": "命令:",
+	"Examples:": "示例:",
+	"Flags:":    "选项:",
+	"A value follows its flag or an =, e.g. --timeout 5m or --timeout=5m": "值跟在选项之后或等号之后，例如 --timeout 5m 或 --timeout=5m",
+	"Configuration:": "配置:",
+	"Environment:":   "环境变量:",
+	"Refactor code":  "重构代码",
+	"Fix bugs":       "修复缺陷",
+	"Generate code":  "生成代码",
+	"Explain code":   "解释代码",
+	"Review code":    "审查代码",
+	"Generate tests": "生成测试",
+	"Run the tests with -race and fix the data races found":                            "使用 -race 运行测试并修复发现的数据竞争",
+	"Make the changes \"// TODO(ai): ...\" comments ask for, and remove them":          "按 \"// TODO(ai): ...\" 注释的要求修改代码，并删除这些注释",
+	"Find the probable cause of a crash log or stack trace":                            "查找崩溃日志或堆栈跟踪的可能原因",
+	"Diagnose project issues and auto-fix":                                             "诊断项目问题并自动修复",
+	"Build the workspace file index":                                                   "构建工作区文件索引",
+	"List past operations":                                                             "列出历史操作",
+	"Show the changes of a past operation":                                             "显示某次历史操作的改动",
+	"Show the output of each attempt of a past operation, failed ones included":        "显示某次历史操作每次尝试的输出，包括失败的尝试",
+	"Apply an attempt's files onto the tree, merging edits made since":                 "将某次尝试的文件应用到工作树，并合并之后的修改",
+	"Report token usage per model":                                                     "按模型统计 token 用量",
+	"Show which lines of a file the agent last wrote":                                  "显示文件中最后由助手写入的行",
+	"Run an HTTP job server with a priority queue":                                     "运行带优先级队列的 HTTP 任务服务",
+	"Re-send the recorded requests of a deterministic run":                             "重新发送确定性运行记录的请求",
+	"Show or change the project configuration (show, get, set)":                        "显示或修改项目配置（show、get、set）",
+	"Remove old backups, sessions and cache entries":                                   "删除旧的备份、会话和缓存条目",
+	"List the commands the agent ran; show or run one again (show, run)":               "列出代理运行过的命令；查看或重新运行其中一条（show、run）",
+	"Check imports for cycles and layering violations; draw the graph":                 "检查导入的循环和分层违规；绘制依赖图",
+	"Move a file or package, or rename a symbol, updating references":                  "移动文件或包，或重命名符号，并更新引用",
+	"Extract lines into a function or another package, then name and document it":      "将代码行提取为函数或移到另一个包，再为其命名并编写文档",
+	"# Include runtime check":                                                          "# 包含运行时检查",
+	"# Skip the OpenAPI drift check":                                                   "# 跳过 OpenAPI 偏差检查",
+	"# Also build for linux, darwin and windows":                                       "# 同时为 linux、darwin 和 windows 构建",
+	"# Keep the index current":                                                         "# 持续更新索引",
+	"# Import paths follow the package":                                                "# 导入路径随包更新",
+	"# Rename a method everywhere":                                                     "# 在所有位置重命名方法",
+	"# Lines last written by the agent":                                                "# 最后由助手写入的行",
+	"# Review the branch's changes only":                                               "# 只审查分支的改动",
+	"Review SQL migrations for data loss and locking; blocking findings fail (review)": "审查 SQL 迁移的数据丢失和锁表风险；有阻塞问题时失败 (review)",
+	"The migration checks found %d problem(s):":                                        "迁移检查发现 %d 个问题:",
+	"# Tests, fixtures and golden files, checked for coverage":                         "# 生成测试、测试夹具和黄金文件，并检查覆盖率",
+	"# Also count the mutants the tests catch":                                         "# 同时统计测试能发现的变异体",
+	"# Fix data races until -race is quiet":                                            "# 修复数据竞争，直到 -race 不再报告",
+	"# What attempt 2 wrote":                                                           "# 第 2 次尝试写入的内容",
+	"# Resolve its TODO(ai) comments":                                                  "# 处理其中的 TODO(ai) 注释",
+	"# Explain a panic, then fix the function it starts in":                            "# 解释 panic，然后修复其起始的函数",
+	"Fix the implicated function after the triage (triage)":                            "分诊后修复涉及的函数 (triage)",
+	"Implicated frames:":                                                               "涉及的栈帧:",
+	"Fixing %s at %s:%d":                                                               "正在修复 %s (%s:%d)",
+	"Running the tests under the race detector (%s)...":                                "正在使用竞争检测器运行测试 (%s)...",
+	"No data races found.":                                                             "未发现数据竞争。",
+	"%d data race(s) found":                                                            "发现 %d 个数据竞争",
+	"Skipping the race at %s: its stacks are outside the project":                      "跳过 %s 处的竞争: 其调用栈不在项目内",
+	"Fixing the race at %s (%s)":                                                       "正在修复 %s 处的竞争 (%s)",
+	"No fix for the race at %s: %v":                                                    "未能修复 %s 处的竞争: %v",
+	"# Token usage of the last week":                                                   "# 最近一周的 token 用量",
+	"# Merged settings and their files":                                                "# 合并后的设置及其来源文件",
+	"# Every project":                                                                  "# 所有项目",
+	"# Fix what gopls/tsserver reported":                                               "# 修复 gopls/tsserver 报告的问题",
+	"# Re-send a --deterministic run's requests":                                       "# 重新发送 --deterministic 运行的请求",
+	"GLM API key":                       "GLM API 密钥",
+	"Model name (default: glm-4-flash)": "模型名称（默认: glm-4-flash）",
+	"Settings preset: fast, careful or one from .aidev.yaml":                        "设置预设: fast、careful 或 .aidev.yaml 中定义的",
+	"Recurring task: null-checks, wrap-errors, add-context or one from .aidev.yaml": "常用任务：null-checks、wrap-errors、add-context 或 .aidev.yaml 中定义的任务",
+	"Run even when a daily or monthly spend limit is reached":                       "即使达到每日或每月花费上限也继续运行",
+	"Stream responses (stalled streams are retried)":                                "流式输出响应（停滞的流会重试）",
+	"Max retries (default: 3)":                                                      "最大重试次数（默认: 3）",
+	"Timeout (default: 2m)":                                                         "超时时间（默认: 2m）",
+	"Verbose output":                                                                "详细输出",
+	"Verify changes without writing files":                                          "只验证改动，不写入文件",
+	"Don't create backups":                                                          "不创建备份",
+	"Verify changes in a staging copy before writing":                               "写入前在暂存副本中验证改动",
+	"Run implementer, reviewer and tester agents in sequence":                       "依次运行实现、审查和测试代理",
+	"Working directory; repeat it to work across several roots":                     "工作目录；可重复指定以同时处理多个根目录",
+	"Take the roots from a YAML file (roots: [{path, name}])":                       "从 YAML 文件读取根目录 (roots: [{path, name}])",
+	"Work on a project on another machine over ssh, verifying it there":             "通过 ssh 处理另一台机器上的项目，并在那里验证",
+	"Include a reference file (summarized when large)":                              "包含参考文件（过大时摘要）",
+	"Pin sampling where supported and record requests for replay":                   "在支持时固定采样并记录请求以便重放",
+	"Seed of a deterministic run (implies --deterministic, default: 0)":             "确定性运行的随机种子（隐含 --deterministic，默认: 0）",
+	"Send an image (PNG, JPEG, GIF) to a vision model (repeatable)":                 "向视觉模型发送图片（PNG、JPEG、GIF，可重复）",
+	"Restore comments and layout the model dropped (Go)":                            "恢复模型丢失的注释和格式（Go）",
+	"Stream progress events as JSON lines":                                          "以 JSON 行输出进度事件",
+	"Write the package dependency graph: dot or mermaid (deps)":                     "输出包依赖图: dot 或 mermaid（deps）",
+	"Package directory to extract into (extract)":                                   "提取到的包目录（extract）",
+	"Only operations touching path (history)":                                       "只显示涉及该路径的操作（history）",
+	"Attempt of the session to apply (salvage)":                                     "要应用的会话尝试（salvage）",
+	"Only these files of the attempt (salvage, default: all)":                       "只应用该尝试中的这些文件（salvage，默认: 全部）",
+	"Show the merged configuration and its sources (config show)":                   "显示合并后的配置及其来源（config show）",
+	"Write .aidev.local.yaml instead of .aidev.yaml (config set)":                   "写入 .aidev.local.yaml 而非 .aidev.yaml（config set）",
+	"Write the global file instead of .aidev.yaml (config set)":                     "写入全局配置文件而非 .aidev.yaml（config set）",
+	"Only operations matching text (history)":                                       "只显示匹配文本的操作（history）",
+	"Review only the changes against --base (review)":                               "只审查相对 --base 的改动（review）",
+	"Base of the --diff review (default: HEAD)":                                     "--diff 审查的基准（默认: HEAD）",
+	"Fix the errors in an LSP diagnostics export (fix)":                             "修复 LSP 诊断导出中的错误（fix）",
+	"Disable LLM calls; only local commands are available":                          "禁用 LLM 调用，只能使用本地命令",
+	"Output language: en or zh (default: from LANG)":                                "输出语言: en 或 zh（默认取自 LANG）",
+	"Model for a task (mode, review, test), e.g. fix=glm-4-plus":                    "按任务指定模型（模式、review、test），如 fix=glm-4-plus",
+	"Authenticate with JWT tokens signed from an id.secret key":                     "使用由 id.secret 密钥签发的 JWT 认证",
+	"Cancel a stream idle for this long (default: 30s)":                             "流空闲超过该时长则取消（默认: 30s）",
+	"Sign the provenance manifest (ed25519 PEM key)":                                "签名溯源清单（ed25519 PEM 密钥）",
+	"Max review rounds in a pipeline (default: 2)":                                  "流水线的最大审查轮数（默认: 2）",
+	"Model for a pipeline role (implementer, reviewer, tester)":                     "流水线角色使用的模型（implementer、reviewer、tester）",
+	"Skip the tester role in a pipeline":                                            "流水线中跳过测试角色",
+	"Add new dependencies without asking (unless vulnerable)":                       "不询问直接添加新依赖（有漏洞时除外）",
+	"Don't check generated code for new dependencies":                               "不检查生成代码引入的新依赖",
+	"Keep running and update incrementally (index)":                                 "持续运行并增量更新（index）",
+	"Constrain the change: free text or a preset (repeatable):":                     "约束改动: 自由文本或预设（可重复）:",
+	"Event destination: a file, - (stdout) or fd:N (default: stderr)":               "事件输出: 文件、-（stdout）或 fd:N（默认: stderr）",
+	"Max entries to list (history, cmdlog, default: 20),":                           "最多列出的条目数（history、cmdlog，默认: 20），",
+	"or days to report (usage, default: 30)":                                        "或统计的天数（usage，默认: 30）",
+	"Listen address (serve, default: 127.0.0.1:8421)":                               "监听地址（serve，默认: 127.0.0.1:8421）",
+	"Jobs run at once (serve, default: 2)":                                          "同时运行的任务数（serve，默认: 2）",
+	"Jobs run at once per client (serve, default: 1)":                               "每个客户端同时运行的任务数（serve，默认: 1）",
+	"Bearer tokens with workspace roots and access (serve)":                         "含工作区根目录和权限的 Bearer 令牌（serve）",
+	"Work on a remote repository in a cached shallow clone":                         "在缓存的浅克隆中处理远程仓库",
+	"Write changes in a separate git worktree and branch":                           "在独立的 git worktree 和分支中写入改动",
+	"Stash uncommitted edits to target files during the run":                        "运行期间暂存目标文件中未提交的修改",
+	"Refuse every write to the project (explain, review, diagnose)":                 "拒绝对项目的任何写入（explain、review、diagnose）",
+	"Run the affected tests, then the whole suite, before accepting a change":       "接受改动前先运行受影响的测试，再运行全部测试",
+	"Check new tests against mutants of the code and strengthen them (test)":        "用代码的变异体检验新测试并加强测试 (test)",
+	"Mutants: %d of %d killed":                                                      "变异体: 已发现 %d 个，共 %d 个",
+	"Survived: %s:%d %s: %s became %s":                                              "未发现: %s:%d %s: %s 变为 %s",
+	"Push the changes to a new branch (with --repo)":                                "将改动推送到新分支（配合 --repo）",
+	"Also open a pull or merge request against ref (with --repo)":                   "同时针对 ref 创建拉取请求或合并请求（配合 --repo）",
+	"Repository the CI webhook may fix (serve, repeatable, required)":               "CI webhook 可修复的仓库（serve，可重复，必填）",
+	"Enables the CI webhook (serve) and verifies its signatures":                    "启用 CI webhook（serve）并校验其签名",
+	"Pushes fix branches and opens pull requests (serve)":                           "推送修复分支并创建拉取请求（serve）",
+	"The same on GitLab, as merge requests":                                         "在 GitLab 上同样操作，创建合并请求",
+	"The same on Gitea":                                                             "在 Gitea 上同样操作",
+	"Self-hosted forges, e.g. gitlab=git.corp.com,gitea=code.corp.com":              "自托管的代码托管平台，例如 gitlab=git.corp.com,gitea=code.corp.com",
+	"Fix a Jira (PROJ-123) or GitHub (owner/repo#123) issue from its text":          "根据 Jira (PROJ-123) 或 GitHub (owner/repo#123) 问题的内容进行修复",
+	"Jira site of --issue keys; JIRA_USER and JIRA_TOKEN sign in":                   "--issue 键所在的 Jira 站点；JIRA_USER 和 JIRA_TOKEN 用于登录",
+	"Files from the issue: %s":                                                      "来自问题的文件：%s",
+	"Findings: %d blocking (%s)":                                                    "发现：%d 个阻塞 (%s)",
+	"Plain-text markers instead of emoji (default: by terminal)":                    "使用纯文本标记代替 emoji（默认按终端判断）",
+	"Extra request field for the provider (repeatable), e.g. do_sample=false":       "发送给服务商的额外请求字段（可重复），如 do_sample=false",
+	"API key (required for most commands)":                                          "API 密钥（大多数命令需要）",
+	"Same as --offline":                                                             "等同于 --offline",
+
+	// Results
+	"Operation completed successfully!":                   "操作成功完成！",
+	"Operation failed!":                                   "操作失败！",
+	"Files changed:":                                      "已修改的文件:",
+	"%d file(s), +%d -%d lines":                           "%d 个文件，+%d -%d 行",
+	"Dry run, files that would change:":                   "试运行，将被修改的文件:",
+	"Attempts: %d":                                        "尝试次数: %d",
+	"Verification:":                                       "验证:",
+	"Tokens: %d (%d prompt, %d completion) in %d call(s)": "Token: %d（提示 %d，补全 %d），共 %d 次调用",
+	"Cost: $%.4f":                                         "费用: $%.4f",
+	"Duration: %v":                                        "耗时: %v",
+	"Explanation:":                                        "说明:",
+
+	// Diagnose
+	"Running project diagnosis...":                             "正在诊断项目...",
+	"Project: %s":                                              "项目: %s",
+	"%s doesn't accept images, using %s":                       "%s 不支持图片输入，改用 %s",
+	"Response cut off at the output limit, continuing (%d/%d)": "响应达到输出上限被截断，继续生成（%d/%d）",
+	"Response still cut off after %d continuations":            "续写 %d 次后响应仍被截断",
+	"Replaying %d request(s) of session %s (%s)":               "重放会话 %[2]s（%[3]s）的 %[1]d 个请求",
+	"identical":                                              "一致",
+	"differs (+%d -%d lines)":                                "不一致（+%d -%d 行）",
+	"%d of %d response(s) identical":                         "%d/%d 个响应一致",
+	"Spend (%s): $%.2f of $%.2f":                             "花费（%s）: $%.2f / $%.2f",
+	"No retention settings; removing what is older than %s.": "未设置保留策略；删除早于 %s 的内容。",
+	"Nothing to remove.":                                     "没有需要删除的内容。",
+	"Reclaimed %s":                                           "已释放 %s",
+	"Backups: %d":                                            "备份：%d",
+	"Sessions and their transcripts: %d":                     "会话及其记录：%d",
+	"Cache entries: %d":                                      "缓存条目：%d",
+	"Retention: %v":                                          "保留策略：%v",
+	"Retention: reclaimed %s of old backups and sessions":    "保留策略：已从旧备份和会话中释放 %s",
+	"No commands recorded.":                                  "没有记录的命令。",
+	"exit %d":                                                "退出码 %d",
+	"session %s in %s":                                       "会话 %s，目录 %s",
+	"Session:":                                               "会话:",
+	"Directory:":                                             "目录:",
+	"Run at:":                                                "运行于:",
+	"Exit code:":                                             "退出码:",
+	"Duration:":                                              "耗时:",
+	"Environment: as in this shell":                          "环境：与当前 shell 相同",
+	"Environment of the agent's run, where it differs from this shell:": "代理运行时与当前 shell 不同的环境变量：",
+	"Run it again with: aidev cmdlog run %d":                            "重新运行：aidev cmdlog run %d",
+	"exit %d in %s; the agent's run exited %d in %s":                    "退出码 %d，用时 %s；代理运行时退出码 %d，用时 %s",
+	"%s: unset (now %q)": "%s：未设置（当前为 %q）",
+	"%s: %q (now unset)": "%s：%q（当前未设置）",
+	"%s: %q (now %q)":    "%s：%q（当前为 %q）",
+	"%s are not ignored by git; set git_exclude in %s to add them": "%s 未被 git 忽略；可在 %s 中设置 git_exclude 来添加",
+	"Add %s to .gitignore so backups are never committed?":         "将 %s 添加到 .gitignore，以免提交备份？",
+	"Could not exclude %s from git: %v":                            "无法在 git 中排除 %s：%v",
+	"Excluded %s from git in %s":                                   "已在 %[2]s 中将 %[1]s 排除出 git",
+	"daily":                                                        "每日",
+	"monthly":                                                      "每月",
+	"No configuration files (%s, %s).":                             "没有配置文件（%s、%s）。",
+	"Set %s in %s":                                                 "已在 %[2]s 中设置 %[1]s",
+	"%s holds an API key and is shared with the project; move it to %s": "%s 中包含 API 密钥且随项目共享，请移到 %s",
+	"Diagnostic Report":                    "诊断报告",
+	"Status:":                              "状态:",
+	"Build: OK":                            "构建: 通过",
+	"Build: Failed":                        "构建: 失败",
+	"Tests: OK":                            "测试: 通过",
+	"Tests: Failed":                        "测试: 失败",
+	"Issues: %d total":                     "问题: 共 %d 个",
+	"%d critical":                          "%d 个严重",
+	"%d errors":                            "%d 个错误",
+	"%d warnings":                          "%d 个警告",
+	"Detailed Issues:":                     "问题详情:",
+	"... and %d more issues":               "... 另有 %d 个问题",
+	"No issues found. Project is healthy!": "未发现问题，项目状态良好！",
+	"Found %d issue(s). Run with --verbose for details.": "发现 %d 个问题，使用 --verbose 查看详情。",
+	"Auto-fix skipped (offline).":                        "已跳过自动修复（离线）。",
+	"Attempting auto-fix with AI...":                     "正在尝试使用 AI 自动修复...",
+	"No auto-fixable issues found.":                      "没有可自动修复的问题。",
+	"Auto-fix encountered issues: %v":                    "自动修复遇到问题: %v",
+	"Footprint not recorded: %v":                         "未记录构建开销: %v",
+	"%d package(s) in %s":                                "%[2]s 中有 %[1]d 个包",
+	"%d layering rule(s) from %s":                        "来自 %[2]s 的 %[1]d 条分层规则",
+	"No import cycles or layering violations.":           "没有导入循环或分层违规。",
+	"Nothing to change.":                                 "没有需要修改的内容。",
+	"%d file(s) to change, %d reference(s) updated":      "将修改 %d 个文件，更新 %d 处引用",
+	"%d conflict(s):":                                    "%d 个冲突:",
+	"Verifying the build...":                             "正在验证构建...",
+	"Resolving %d problem(s) in %s":                      "正在解决 %[2]s 中的 %[1]d 个问题",
+	"Kept the placeholder name %s (offline).":            "已保留占位名 %s（离线）。",
+	"Naming and documenting the extracted code in %s":    "正在为 %s 中提取出的代码命名并编写文档",
+	"Attempt %d of %s:":                                  "%[2]s 的第 %[1]d 次尝试:",
+	"%s: already applied":                                "%s: 已应用",
+	"%s: conflicts with edits made since":                "%s: 与之后的修改冲突",
+	"%s: merged with edits made since":                   "%s: 已与之后的修改合并",
+	"Resolving the TODO at %s:%d: %s":                    "正在处理 %s:%d 的 TODO: %s",
+	"The TODO at %s:%d is left: %v":                      "%s:%d 的 TODO 未能处理: %v",
+	"No TODO(ai) comments found.":                        "未找到 TODO(ai) 注释。",
+
+	// telemetry
+	"Telemetry is on.": "遥测已开启。",
+	"Recorded: how often each command runs, succeeds and retries, with the version and platform. Never code, prompts, paths or errors.": "记录内容：每个命令的运行、成功和重试次数，以及版本和平台。从不记录代码、提示词、路径或错误。",
+	"Telemetry is off; its statistics are deleted.":         "遥测已关闭，其统计数据已删除。",
+	"Telemetry is off. Turn it on with: aidev telemetry on": "遥测已关闭。开启方式：aidev telemetry on",
+	"DO_NOT_TRACK is set, which keeps it off.":              "已设置 DO_NOT_TRACK，遥测保持关闭。",
+	"Statistics:":                "统计数据:",
+	"Reported daily to:":         "每日上报至:",
+	"Kept on this machine only.": "仅保存在本机。",
+	"No commands recorded yet.":  "尚未记录任何命令。",
+	"Since":                      "起始于",
+	"Show, turn on or turn off anonymous usage statistics (status, on, off)": "查看、开启或关闭匿名使用统计（status、on、off）",
+	"# Count command runs, successes and retries":                            "# 统计命令的运行、成功和重试次数",
+	"Reports usage statistics there daily, if on; kept local otherwise":      "开启遥测时每日向此地址上报使用统计；否则仅保存在本地",
+	"Keeps telemetry off": "保持遥测关闭",
+
+	// crash bundles
+	"aidev crashed: %v":                      "aidev 崩溃: %v",
+	"Couldn't write a diagnostic bundle: %v": "无法写入诊断包: %v",
+	"A diagnostic bundle is in %s.":          "诊断包位于 %s。",
+	"It holds the configuration with secrets masked, the last events of the run, the stack trace and versions, but none of your files or prompts.": "其中包含已屏蔽密钥的配置、本次运行的最近事件、堆栈跟踪和版本信息，不含你的文件或提示词。",
+	"Look it over, then attach it to a bug report with the command you ran.":                                                                       "请先检查其内容，再连同所运行的命令一起附到缺陷报告中。",
+}
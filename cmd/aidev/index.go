@@ -0,0 +1,114 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"ai-dev-agent/service/filesystem"
+	"ai-dev-agent/service/index"
+	"ai-dev-agent/service/orchestrator"
+)
+
+func runIndex(ctx context.Context, config *Config, cmd *Command) error {
+	root := config.WorkDir
+	if len(cmd.Files) > 0 {
+		root = cmd.Files[0]
+	}
+
+	fileMgr, err := filesystem.NewManager(filesystem.Config{RootDir: root, IgnorePatterns: config.Ignore})
+	if err != nil {
+		return fmt.Errorf("filesystem: %w", err)
+	}
+
+	st, err := openStore(fileMgr.GetRoot())
+	if err != nil {
+		return fmt.Errorf("state: %w", err)
+	}
+	defer st.Close()
+
+	ix := index.New(fileMgr)
+	entries, err := st.LoadIndex()
+	if err != nil {
+		return fmt.Errorf("load index: %w", err)
+	}
+	ix.Restore(entries)
+
+	// Import the index written by earlier versions, then drop the file.
+	legacyPath := filepath.Join(fileMgr.GetRoot(), stateDir, "index.json")
+	if len(entries) == 0 {
+		if err := ix.Load(legacyPath); err != nil {
+			fmt.Printf("  ⚠ Ignoring unreadable index: %v\n", err)
+		}
+	}
+
+	fmt.Printf("\n📇 Indexing %s...\n", fileMgr.GetRoot())
+	spin := startSpinner("Scanning...")
+	stats, err := ix.Build(ctx, index.BuildOptions{OnProgress: func(p index.Progress) {
+		spin.update(progressStatus(p))
+		if config.EventLog != nil {
+			config.EventLog.emit(orchestrator.Event{
+				Type:  orchestrator.EventProgress,
+				Time:  time.Now(),
+				Stage: p.Phase,
+				Done:  p.Files,
+				Total: p.Total,
+				Bytes: p.Bytes,
+				EtaMs: p.ETA.Milliseconds(),
+			})
+		}
+	}})
+	spin.stop()
+	if err != nil {
+		return fmt.Errorf("index: %w", err)
+	}
+	fmt.Printf("   %d file(s): %d added, %d updated, %d unchanged, %d removed (%v)\n",
+		stats.Files, stats.Added, stats.Updated, stats.Unchanged, stats.Removed, stats.Duration)
+
+	if err := st.SaveIndex(ix.Entries()); err != nil {
+		return fmt.Errorf("save index: %w", err)
+	}
+	os.Remove(legacyPath)
+
+	if !config.Watch {
+		return nil
+	}
+
+	fmt.Println("   Watching for changes (Ctrl-C to stop)...")
+	err = ix.Watch(ctx, index.WatchOptions{
+		OnChange: func(c index.Change) {
+			switch {
+			case c.Removed:
+				fmt.Printf("   - %s\n", c.Path)
+			case c.Changed:
+				fmt.Printf("   ~ %s\n", c.Path)
+			default:
+				if config.Verbose {
+					fmt.Printf("   = %s (content unchanged)\n", c.Path)
+				}
+			}
+		},
+		OnError: func(err error) {
+			fmt.Printf("   ⚠ watch: %v\n", err)
+		},
+	})
+	if saveErr := st.SaveIndex(ix.Entries()); saveErr != nil && err == nil {
+		err = saveErr
+	}
+	return err
+}
+
+// progressStatus describes an index build for the spinner, e.g.
+// "Indexing 120/3400 files, 4.2/96.0 MB, about 12s left".
+func progressStatus(p index.Progress) string {
+	if p.Phase == "scan" {
+		return "Scanning..."
+	}
+	status := fmt.Sprintf("Indexing %d/%d files, %.1f/%.1f MB", p.Files, p.Total, float64(p.Bytes)/(1<<20), float64(p.TotalBytes)/(1<<20))
+	if p.ETA >= time.Second {
+		status += fmt.Sprintf(", about %s left", p.ETA.Round(time.Second))
+	}
+	return status
+}
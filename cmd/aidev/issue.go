@@ -0,0 +1,57 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"ai-dev-agent/service/tracker"
+)
+
+// issueFilePattern matches Go file names mentioned in an issue, with or
+// without a line.
+var issueFilePattern = regexp.MustCompile(`([\w./\\-]+\.go)\b`)
+
+// applyIssue fetches the --issue of cmd and makes its title, description
+// and discussion the instruction, followed by any given with -i. Without
+// target files, the files the issue mentions are fixed.
+func applyIssue(ctx context.Context, config *Config, cmd *Command) error {
+	if cmd.Issue == "" {
+		return nil
+	}
+	issue, err := tracker.NewClient(tracker.DefaultConfig()).Fetch(ctx, cmd.Issue)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("🎫 %s: %s\n", issue.Ref, issue.Title)
+	cmd.Issue = issue.Ref
+	cmd.IssueURL = issue.URL
+
+	instruction := issue.Instruction()
+	if len(cmd.Files) == 0 {
+		cmd.Files = referencedFiles(issueFilePattern, instruction, config.WorkDir)
+		if len(cmd.Files) == 0 {
+			return fmt.Errorf("%s mentions no files in %s; name the files to %s", issue.Ref, config.WorkDir, cmd.Type)
+		}
+		fmt.Printf("  %s\n", trf("Files from the issue: %s", strings.Join(cmd.Files, ", ")))
+	}
+	if cmd.Instruction != "" {
+		instruction += "\n\n" + cmd.Instruction
+	}
+	cmd.Instruction = instruction
+	return nil
+}
+
+// issueLink is the line a pull request uses to refer to the issue it
+// resolves.
+func issueLink(cmd *Command) string {
+	if cmd.Issue == "" {
+		return ""
+	}
+	if tracker.IsJira(cmd.Issue) {
+		// Jira links commits and pull requests that mention the key.
+		return fmt.Sprintf("Resolves %s (%s)", cmd.Issue, cmd.IssueURL)
+	}
+	return "Fixes " + cmd.Issue
+}
@@ -3,39 +3,141 @@ package main
 
 import (
         "context"
+        "errors"
         "fmt"
         "os"
         "os/signal"
         "path/filepath"
+        "runtime/debug"
+        "sort"
         "strings"
+        "sync"
         "syscall"
         "time"
 
+        "ai-dev-agent/service/deps"
         "ai-dev-agent/service/diagnose"
+        "ai-dev-agent/service/diff"
         "ai-dev-agent/service/executor"
         "ai-dev-agent/service/filesystem"
         "ai-dev-agent/service/llm"
         "ai-dev-agent/service/orchestrator"
         "ai-dev-agent/service/prompt"
+        "ai-dev-agent/service/provenance"
+        "ai-dev-agent/service/remotefs"
+        "ai-dev-agent/service/store"
+        "ai-dev-agent/service/vision"
 )
 
 var Version = "1.0.0"
 
 type Config struct {
         APIKey     string
+        KeyEnv     string // environment variable the key came from, from api_key_env
         Model      string
         MaxRetries int
         Timeout    time.Duration
         Verbose    bool
         DryRun     bool
         NoBackup   bool
+        BackupKeep int      // backups kept per file; 0 keeps all
+        Ignore     []string // scan ignore patterns beyond the defaults
         WorkDir    string
+        Watch      bool
+        Staged     bool
+        SignKey    string
+        Yes        bool
+        NoDeps     bool
+        Pipeline   bool
+        Rounds     int
+        RoleModels map[string]string
+        NoTests    bool
+        ModelSet   bool
+        Offline    bool
+        JWT        bool
+        Stream     bool
+        StreamIdle time.Duration
+        Addr       string
+        Workers    int
+        ClientCap  int
+        Tokens     string
+        HookRepos  []string
+        Repo       string
+        Push       bool
+        PR         bool
+        Worktree   bool
+        Stash      bool
+        Diff       bool
+        Base       string
+        DiagFile   string
+        StateRoot  string
+        MaxFiles   int // per attempt; 0 uses the engine default
+        MaxBytes   int
+        Feedback   int // max retry feedback tokens; 0 uses the engine default
+        Constrain  map[string][]string // default constraints by command
+        DiffMult   float64 // minimal-diff limit; 0 uses the engine default
+        Preserve   bool
+        Events     string // event log format (ndjson)
+        EventsTo   string // event log target; "" is stderr
+        EventLog   *eventLog // opened from Events and EventsTo
+        ReadOnly   bool
+        ModelFor   map[string]string
+        ProvOpts   map[string]interface{} // extra request body fields
+        Determ     bool // pin sampling and record requests for replay
+        Seed       int
+        Profile    string
+        DayLimit   float64 // spend limits in dollars; 0 is unlimited
+        MonthLimit float64
+        OverBudget bool
+        RetainAge  time.Duration // retention: state older than this is removed; 0 keeps it
+        RetainSize int64         // retention: cap on .ai-backup in bytes; 0 is unlimited
+        GitExclude string        // where to ignore .ai-backup and .aidev; "" asks
+        VerifyPTY  bool          // run verification commands on a pseudo-terminal
+        VerifyIn   bool          // forward stdin to verification commands
+        RunTests   bool          // run the tests once the build passes
+        Mutate     bool          // check generated tests against mutants (test)
+        TriageFix  bool          // fix the implicated function after triage
+        Tasks      map[string]Task // named tasks from .aidev.yaml
+        Policy     orchestrator.ReviewPolicy
+        Migrations bool   // review database migrations for safety
+        MigPolicy  string // migration policy file, from .aidev.yaml
+        APISpec    string // OpenAPI spec diagnose compares with the handlers
+        APISource  string // side of the API taken as right: code or spec
+        EnvMatrix  map[string][]string // environments builds are also verified under
+        Platforms  []string        // GOOS/GOARCH targets diagnose also builds for
+        Graph      string          // deps --graph format: dot or mermaid
+        Into       string          // extract --into: directory of the package to extract into
+        ArchFile   string          // architecture file of layering rules, from .aidev.yaml
+        Layering   []deps.Rule     // layering rules of .aidev.yaml
+        Refuse     orchestrator.Refusals // refusal rules of .aidev.yaml, beyond the defaults
+        Workspace  string          // --workspace file listing the roots
+        RootName   string          // name of the primary root (WorkDir)
+        Roots      []workspaceRoot // further roots of a multi-root run
+        SSH        string          // --ssh [user@]host:dir of a remote project
+        Given      map[string]bool // flags given on the command line
+        Routes     []llm.Route
 }
 
 type Command struct {
         Type        string
         Files       []string
+        Context     []string
         Instruction string
+        Constraints []string // preset names or free text
+        Images      []string // image files sent with the prompt
+        Task        string   // named task expanded into the instruction
+        Issue       string   // issue whose text is the instruction
+        IssueURL    string
+        Effective   bool     // config show: the merged configuration
+        Local       bool     // config set: write .aidev.local.yaml
+        Global      bool     // config set: write the global file
+        Attempt     int      // salvage: the attempt to apply
+        Pick        []string // salvage --files: the attempt's files to apply; all if empty
+
+        // History filters
+        FilterFile string
+        Grep       string
+        Limit      int
 }
 
 func main() {
@@ -62,6 +164,13 @@ func main() {
 
         ctx, cancel := context.WithCancel(context.Background())
         defer cancel()
+        defer func() {
+                if p := recover(); p != nil {
+                        recordTelemetry(config, cmd, fmt.Errorf("panic"))
+                        reportCrash(config, cmd, crash{panicked: p, stack: debug.Stack()})
+                        os.Exit(2)
+                }
+        }()
 
         sigChan := make(chan os.Signal, 1)
         signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
@@ -71,8 +180,13 @@ func main() {
                 cancel()
         }()
 
-        if err := run(ctx, config, cmd); err != nil {
+        err = run(ctx, config, cmd)
+        recordTelemetry(config, cmd, err)
+        if err != nil {
                 fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+                if unexpectedError(err) {
+                        reportCrash(config, cmd, crash{err: err})
+                }
                 os.Exit(1)
         }
 }
@@ -82,54 +196,12 @@ func parseArgs(args []string) (*Config, *Command, error) {
         cmd := &Command{}
         i := 0
 
-        for i < len(args) {
-                arg := args[i]
-                if !strings.HasPrefix(arg, "-") {
-                        break
-                }
-                switch arg {
-                case "-k", "--api-key":
-                        if i+1 >= len(args) {
-                                return nil, nil, fmt.Errorf("missing value for %s", arg)
-                        }
-                        config.APIKey = args[i+1]
-                        i += 2
-                case "-m", "--model":
-                        if i+1 >= len(args) {
-                                return nil, nil, fmt.Errorf("missing value for %s", arg)
-                        }
-                        config.Model = args[i+1]
-                        i += 2
-                case "--retries":
-                        if i+1 >= len(args) {
-                                return nil, nil, fmt.Errorf("missing value for %s", arg)
-                        }
-                        fmt.Sscanf(args[i+1], "%d", &config.MaxRetries)
-                        i += 2
-                case "--timeout":
-                        if i+1 >= len(args) {
-                                return nil, nil, fmt.Errorf("missing value for %s", arg)
-                        }
-                        config.Timeout, _ = time.ParseDuration(args[i+1])
-                        i += 2
-                case "-V", "--verbose":
-                        config.Verbose = true
-                        i++
-                case "--dry-run":
-                        config.DryRun = true
-                        i++
-                case "--no-backup":
-                        config.NoBackup = true
-                        i++
-                case "-w", "--workdir":
-                        if i+1 >= len(args) {
-                                return nil, nil, fmt.Errorf("missing value for %s", arg)
-                        }
-                        config.WorkDir = args[i+1]
-                        i += 2
-                default:
-                        return nil, nil, fmt.Errorf("unknown flag: %s", arg)
+        for i < len(args) && strings.HasPrefix(args[i], "-") {
+                next, err := parseFlag(config, cmd, args, i)
+                if err != nil {
+                        return nil, nil, err
                 }
+                i = next
         }
 
         if i >= len(args) {
@@ -140,7 +212,7 @@ func parseArgs(args []string) (*Config, *Command, error) {
         i++
 
         switch cmd.Type {
-        case "refactor", "fix", "generate", "explain", "review", "test", "diagnose":
+        case "refactor", "fix", "generate", "explain", "review", "test", "races", "todos", "triage", "diagnose", "index", "history", "show", "attempts", "salvage", "usage", "blame-ai", "serve", "replay", "config", "gc", "cmdlog", "deps", "mv", "extract", "telemetry":
         default:
                 return nil, nil, fmt.Errorf("unknown command: %s", cmd.Type)
         }
@@ -153,170 +225,1210 @@ func parseArgs(args []string) (*Config, *Command, error) {
                         }
                         break
                 }
+                if strings.HasPrefix(args[i], "-") && args[i] != "-" {
+                        next, err := parseFlag(config, cmd, args, i)
+                        if err != nil {
+                                return nil, nil, err
+                        }
+                        i = next
+                        continue
+                }
                 cmd.Files = append(cmd.Files, args[i])
                 i++
         }
 
-        if len(cmd.Files) == 0 && cmd.Type != "generate" && cmd.Type != "diagnose" {
+        if config.Diff && cmd.Type != "review" {
+                return nil, nil, fmt.Errorf("--diff is only supported by review")
+        }
+        if config.DiagFile != "" && cmd.Type != "fix" {
+                return nil, nil, fmt.Errorf("--diagnostics is only supported by fix")
+        }
+        if cmd.Task != "" && isLocalCommand(cmd.Type) {
+                return nil, nil, fmt.Errorf("--task needs a command that takes an instruction")
+        }
+        if config.Migrations && (cmd.Type != "review" || config.Diff) {
+                return nil, nil, fmt.Errorf("--migrations is only supported by review, without --diff")
+        }
+        if config.Mutate && cmd.Type != "test" {
+                return nil, nil, fmt.Errorf("--mutate is only supported by test")
+        }
+        if config.Into != "" && cmd.Type != "extract" {
+                return nil, nil, fmt.Errorf("--into is only supported by extract")
+        }
+        if config.TriageFix && cmd.Type != "triage" {
+                return nil, nil, fmt.Errorf("--fix is only supported by triage")
+        }
+        if cmd.Type == "triage" && len(cmd.Files) != 1 {
+                return nil, nil, fmt.Errorf("usage: aidev triage <log file | -> [--fix]")
+        }
+        if cmd.Type == "test" && (config.Staged || config.DryRun || config.Pipeline) {
+                return nil, nil, fmt.Errorf("test runs the new tests in place and can't be combined with --staged, --dry-run or --pipeline")
+        }
+        if cmd.Issue != "" && cmd.Type != "fix" && cmd.Type != "refactor" && cmd.Type != "generate" {
+                return nil, nil, fmt.Errorf("--issue is only supported by fix, refactor and generate")
+        }
+        if len(cmd.Images) > 0 && (cmd.Type != "refactor" && cmd.Type != "fix" && cmd.Type != "generate" || config.Diff) {
+                return nil, nil, fmt.Errorf("--image is only supported by refactor, fix and generate")
+        }
+        if len(cmd.Files) == 0 && cmd.Type != "generate" && cmd.Type != "serve" && cmd.Type != "races" && !config.Diff && config.DiagFile == "" && cmd.Issue == "" && !isLocalCommand(cmd.Type) {
                 return nil, nil, fmt.Errorf("no target files specified")
         }
+        if cmd.Type == "show" && len(cmd.Files) != 1 {
+                return nil, nil, fmt.Errorf("usage: aidev show <session-id>")
+        }
+        if cmd.Type == "attempts" && (len(cmd.Files) < 1 || len(cmd.Files) > 2) {
+                return nil, nil, fmt.Errorf("usage: aidev attempts <session-id> [attempt]")
+        }
+        if cmd.Type == "salvage" && (len(cmd.Files) != 1 || cmd.Attempt == 0) {
+                return nil, nil, fmt.Errorf("usage: aidev salvage <session-id> --attempt <n> [--files <path,...>]")
+        }
+        if (cmd.Attempt != 0 || len(cmd.Pick) > 0) && cmd.Type != "salvage" {
+                return nil, nil, fmt.Errorf("--attempt and --files are only supported by salvage")
+        }
+        if cmd.Type == "telemetry" && (len(cmd.Files) != 1 || !containsString([]string{"status", "on", "off"}, cmd.Files[0])) {
+                return nil, nil, fmt.Errorf("usage: aidev telemetry status|on|off")
+        }
+        if cmd.Type == "blame-ai" && len(cmd.Files) != 1 {
+                return nil, nil, fmt.Errorf("usage: aidev blame-ai <file>")
+        }
+        if cmd.Type == "replay" && len(cmd.Files) != 1 {
+                return nil, nil, fmt.Errorf("usage: aidev replay <session-id>")
+        }
+        if cmd.Type == "config" && len(cmd.Files) == 0 {
+                return nil, nil, fmt.Errorf("usage: aidev config show [--effective] | get <key> | set <key> <value> [--local|--global]")
+        }
 
-        // Diagnose command doesn't require API key
-        if cmd.Type != "diagnose" {
+        if !config.Offline && os.Getenv("AIDEV_OFFLINE") != "" && os.Getenv("AIDEV_OFFLINE") != "0" {
+                config.Offline = true
+        }
+        if config.Offline && !isLocalCommand(cmd.Type) {
+                return nil, nil, fmt.Errorf("%s needs the LLM API and is unavailable offline (local commands: %s)", cmd.Type, strings.Join(localCommands, ", "))
+        }
+        if err := validateRemote(config); err != nil {
+                return nil, nil, err
+        }
+        if err := validateReadOnly(config, cmd); err != nil {
+                return nil, nil, err
+        }
+
+        if err := loadWorkspace(config); err != nil {
+                return nil, nil, err
+        }
+        if config.WorkDir == "" {
+                config.WorkDir = globalWorkDir()
+        }
+        if config.WorkDir == "" {
+                config.WorkDir, _ = os.Getwd()
+        }
+        if err := setupWorkspace(config, cmd); err != nil {
+                return nil, nil, err
+        }
+        if err := validateSSH(config, cmd); err != nil {
+                return nil, nil, err
+        }
+
+        // A remote project's settings are read once it has been fetched.
+        if config.Repo == "" {
+                pc, err := loadProjectConfig(config.WorkDir)
+                if err != nil {
+                        return nil, nil, err
+                }
+                if err := applyProjectConfig(config, pc); err != nil {
+                        return nil, nil, err
+                }
+                if err := applyTask(config, cmd); err != nil {
+                        return nil, nil, err
+                }
+                if err := validateConfig(config, cmd); err != nil {
+                        return nil, nil, err
+                }
+        }
+
+        // Local commands don't require API key
+        if !isLocalCommand(cmd.Type) {
+                // A key named by api_key_env never falls back to another.
+                if config.APIKey == "" && config.KeyEnv != "" {
+                        return nil, nil, fmt.Errorf("API key required: %s, named by api_key_env, is unset", config.KeyEnv)
+                }
                 if config.APIKey == "" {
                         config.APIKey = os.Getenv("GLM_API_KEY")
                         if config.APIKey == "" {
                                 config.APIKey = os.Getenv("ZHIPUAI_API_KEY")
                         }
                         if config.APIKey == "" {
-                                return nil, nil, fmt.Errorf("API key required (GLM_API_KEY or -k flag)")
+                                return nil, nil, fmt.Errorf("API key required (GLM_API_KEY, -k flag or api_key in .aidev.local.yaml)")
                         }
                 }
         }
 
-        if config.WorkDir == "" {
-                config.WorkDir, _ = os.Getwd()
+        return config, cmd, nil
+}
+
+// parseFlag parses the flag at args[i] and returns the index of the next argument.
+func parseFlag(config *Config, cmd *Command, args []string, i int) (int, error) {
+        arg := args[i]
+        if name, value, ok := strings.Cut(arg, "="); ok && strings.HasPrefix(name, "--") {
+                return parseInlineFlag(config, cmd, args, i, name, value)
+        }
+        if config.Given == nil {
+                config.Given = make(map[string]bool)
+        }
+        config.Given[arg] = true
+        switch arg {
+        case "-k", "--api-key":
+                if i+1 >= len(args) {
+                        return 0, fmt.Errorf("missing value for %s", arg)
+                }
+                config.APIKey = args[i+1]
+                return i + 2, nil
+        case "-m", "--model":
+                if i+1 >= len(args) {
+                        return 0, fmt.Errorf("missing value for %s", arg)
+                }
+                config.Model = args[i+1]
+                config.ModelSet = true
+                return i + 2, nil
+        case "--provider-opt":
+                if i+1 >= len(args) {
+                        return 0, fmt.Errorf("missing value for %s", arg)
+                }
+                key, value, ok := strings.Cut(args[i+1], "=")
+                if !ok || key == "" {
+                        return 0, fmt.Errorf("invalid %s %q (want key=value)", arg, args[i+1])
+                }
+                if config.ProvOpts == nil {
+                        config.ProvOpts = make(map[string]interface{})
+                }
+                config.ProvOpts[key] = optionValue(value)
+                return i + 2, nil
+        case "--model-for":
+                if i+1 >= len(args) {
+                        return 0, fmt.Errorf("missing value for %s", arg)
+                }
+                task, model, ok := strings.Cut(args[i+1], "=")
+                if !ok || model == "" {
+                        return 0, fmt.Errorf("invalid %s %q (want task=model)", arg, args[i+1])
+                }
+                if config.ModelFor == nil {
+                        config.ModelFor = make(map[string]string)
+                }
+                config.ModelFor[task] = model
+                return i + 2, nil
+        case "--retries":
+                n, err := intFlag(args, i)
+                if err != nil {
+                        return 0, err
+                }
+                config.MaxRetries = n
+                return i + 2, nil
+        case "--timeout":
+                d, err := durationFlag(args, i)
+                if err != nil {
+                        return 0, err
+                }
+                config.Timeout = d
+                return i + 2, nil
+        case "-V", "--verbose":
+                config.Verbose = true
+                return i + 1, nil
+        case "--dry-run":
+                config.DryRun = true
+                return i + 1, nil
+        case "--no-backup":
+                config.NoBackup = true
+                return i + 1, nil
+        case "-w", "--workdir":
+                if i+1 >= len(args) {
+                        return 0, fmt.Errorf("missing value for %s", arg)
+                }
+                // Every -w after the first adds a root.
+                if config.WorkDir != "" {
+                        config.Roots = append(config.Roots, workspaceRoot{Dir: args[i+1]})
+                } else {
+                        config.WorkDir = args[i+1]
+                }
+                return i + 2, nil
+        case "--workspace":
+                if i+1 >= len(args) {
+                        return 0, fmt.Errorf("missing value for %s", arg)
+                }
+                config.Workspace = args[i+1]
+                return i + 2, nil
+        case "--ssh":
+                if i+1 >= len(args) {
+                        return 0, fmt.Errorf("missing value for %s", arg)
+                }
+                config.SSH = args[i+1]
+                return i + 2, nil
+        case "--watch":
+                config.Watch = true
+                return i + 1, nil
+        case "--staged":
+                config.Staged = true
+                return i + 1, nil
+        case "-y", "--yes":
+                config.Yes = true
+                return i + 1, nil
+        case "--no-deps":
+                config.NoDeps = true
+                return i + 1, nil
+        case "--pipeline":
+                config.Pipeline = true
+                return i + 1, nil
+        case "--rounds":
+                n, err := intFlag(args, i)
+                if err != nil {
+                        return 0, err
+                }
+                config.Rounds = n
+                return i + 2, nil
+        case "--role-model":
+                if i+1 >= len(args) {
+                        return 0, fmt.Errorf("missing value for %s", arg)
+                }
+                role, model, ok := strings.Cut(args[i+1], "=")
+                if !ok || model == "" {
+                        return 0, fmt.Errorf("invalid %s %q (want role=model)", arg, args[i+1])
+                }
+                if config.RoleModels == nil {
+                        config.RoleModels = make(map[string]string)
+                }
+                config.RoleModels[role] = model
+                return i + 2, nil
+        case "--addr":
+                if i+1 >= len(args) {
+                        return 0, fmt.Errorf("missing value for %s", arg)
+                }
+                config.Addr = args[i+1]
+                return i + 2, nil
+        case "--workers":
+                n, err := intFlag(args, i)
+                if err != nil {
+                        return 0, err
+                }
+                config.Workers = n
+                return i + 2, nil
+        case "--client-cap":
+                n, err := intFlag(args, i)
+                if err != nil {
+                        return 0, err
+                }
+                config.ClientCap = n
+                return i + 2, nil
+        case "--tokens":
+                if i+1 >= len(args) {
+                        return 0, fmt.Errorf("missing value for %s", arg)
+                }
+                config.Tokens = args[i+1]
+                return i + 2, nil
+        case "--repo":
+                if i+1 >= len(args) {
+                        return 0, fmt.Errorf("missing value for %s", arg)
+                }
+                config.Repo = args[i+1]
+                return i + 2, nil
+        case "--diff":
+                config.Diff = true
+                return i + 1, nil
+        case "--diagnostics":
+                if i+1 >= len(args) {
+                        return 0, fmt.Errorf("missing value for %s", arg)
+                }
+                config.DiagFile = args[i+1]
+                return i + 2, nil
+        case "--base":
+                if i+1 >= len(args) {
+                        return 0, fmt.Errorf("missing value for %s", arg)
+                }
+                config.Base = args[i+1]
+                return i + 2, nil
+        case "--stash":
+                config.Stash = true
+                return i + 1, nil
+        case "--read-only":
+                config.ReadOnly = true
+                return i + 1, nil
+        case "--run-tests":
+                config.RunTests = true
+                return i + 1, nil
+        case "--migrations":
+                config.Migrations = true
+                return i + 1, nil
+        case "--mutate":
+                config.Mutate = true
+                return i + 1, nil
+        case "--fix":
+                config.TriageFix = true
+                return i + 1, nil
+        case "--worktree":
+                config.Worktree = true
+                return i + 1, nil
+        case "--push":
+                config.Push = true
+                return i + 1, nil
+        case "--pr":
+                config.PR = true
+                return i + 1, nil
+        case "--webhook-repo":
+                if i+1 >= len(args) {
+                        return 0, fmt.Errorf("missing value for %s", arg)
+                }
+                config.HookRepos = append(config.HookRepos, args[i+1])
+                return i + 2, nil
+        case "--stream":
+                config.Stream = true
+                return i + 1, nil
+        case "--stream-idle":
+                d, err := durationFlag(args, i)
+                if err != nil {
+                        return 0, err
+                }
+                config.StreamIdle = d
+                config.Stream = true
+                return i + 2, nil
+        case "--jwt":
+                config.JWT = true
+                return i + 1, nil
+        case "--offline":
+                config.Offline = true
+                return i + 1, nil
+        case "--no-tests":
+                config.NoTests = true
+                return i + 1, nil
+        case "--sign-key":
+                if i+1 >= len(args) {
+                        return 0, fmt.Errorf("missing value for %s", arg)
+                }
+                config.SignKey = args[i+1]
+                return i + 2, nil
+        case "--ascii":
+                ascii = true
+                return i + 1, nil
+        case "--effective":
+                cmd.Effective = true
+                return i + 1, nil
+        case "--local":
+                cmd.Local = true
+                return i + 1, nil
+        case "--global":
+                cmd.Global = true
+                return i + 1, nil
+        case "--override-budget":
+                config.OverBudget = true
+                return i + 1, nil
+        case "--issue":
+                if i+1 >= len(args) {
+                        return 0, fmt.Errorf("missing value for %s", arg)
+                }
+                cmd.Issue = args[i+1]
+                return i + 2, nil
+        case "--task":
+                if i+1 >= len(args) {
+                        return 0, fmt.Errorf("missing value for %s", arg)
+                }
+                cmd.Task = args[i+1]
+                return i + 2, nil
+        case "--profile":
+                if i+1 >= len(args) {
+                        return 0, fmt.Errorf("missing value for %s", arg)
+                }
+                config.Profile = args[i+1]
+                return i + 2, nil
+        case "--deterministic":
+                config.Determ = true
+                return i + 1, nil
+        case "--seed":
+                n, err := intFlag(args, i)
+                if err != nil {
+                        return 0, err
+                }
+                config.Seed = n
+                config.Determ = true
+                return i + 2, nil
+        case "--lang":
+                if i+1 >= len(args) {
+                        return 0, fmt.Errorf("missing value for %s", arg)
+                }
+                if err := setLang(args[i+1]); err != nil {
+                        return 0, err
+                }
+                return i + 2, nil
+        case "--preserve-comments":
+                config.Preserve = true
+                return i + 1, nil
+        case "--events":
+                if i+1 >= len(args) {
+                        return 0, fmt.Errorf("missing value for %s", arg)
+                }
+                config.Events = args[i+1]
+                return i + 2, nil
+        case "--into":
+                if i+1 >= len(args) {
+                        return 0, fmt.Errorf("missing value for %s", arg)
+                }
+                config.Into = args[i+1]
+                return i + 2, nil
+        case "--graph":
+                if i+1 >= len(args) {
+                        return 0, fmt.Errorf("missing value for %s", arg)
+                }
+                switch args[i+1] {
+                case graphDOT, graphMermaid:
+                default:
+                        return 0, fmt.Errorf("--graph %s: unknown format (dot or mermaid)", args[i+1])
+                }
+                config.Graph = args[i+1]
+                return i + 2, nil
+        case "--events-to":
+                if i+1 >= len(args) {
+                        return 0, fmt.Errorf("missing value for %s", arg)
+                }
+                config.EventsTo = args[i+1]
+                return i + 2, nil
+        case "--constraint":
+                if i+1 >= len(args) {
+                        return 0, fmt.Errorf("missing value for %s", arg)
+                }
+                cmd.Constraints = append(cmd.Constraints, args[i+1])
+                return i + 2, nil
+        case "--image":
+                if i+1 >= len(args) {
+                        return 0, fmt.Errorf("missing value for %s", arg)
+                }
+                cmd.Images = append(cmd.Images, args[i+1])
+                return i + 2, nil
+        case "-c", "--context":
+                if i+1 >= len(args) {
+                        return 0, fmt.Errorf("missing value for %s", arg)
+                }
+                cmd.Context = append(cmd.Context, args[i+1])
+                return i + 2, nil
+        case "--file":
+                if i+1 >= len(args) {
+                        return 0, fmt.Errorf("missing value for %s", arg)
+                }
+                cmd.FilterFile = args[i+1]
+                return i + 2, nil
+        case "--grep":
+                if i+1 >= len(args) {
+                        return 0, fmt.Errorf("missing value for %s", arg)
+                }
+                cmd.Grep = args[i+1]
+                return i + 2, nil
+        case "-n", "--limit":
+                n, err := intFlag(args, i)
+                if err != nil {
+                        return 0, err
+                }
+                cmd.Limit = n
+                return i + 2, nil
+        case "--attempt":
+                n, err := intFlag(args, i)
+                if err != nil {
+                        return 0, err
+                }
+                if n < 1 {
+                        return 0, fmt.Errorf("--attempt %d: attempts are numbered from 1", n)
+                }
+                cmd.Attempt = n
+                return i + 2, nil
+        case "--files":
+                if i+1 >= len(args) {
+                        return 0, fmt.Errorf("missing value for %s", arg)
+                }
+                for _, f := range strings.Split(args[i+1], ",") {
+                        if f = strings.TrimSpace(f); f != "" {
+                                cmd.Pick = append(cmd.Pick, f)
+                        }
+                }
+                return i + 2, nil
+        default:
+                return 0, fmt.Errorf("unknown flag: %s", arg)
         }
+}
 
-        return config, cmd, nil
+// isLocalCommand reports whether a command runs without the LLM.
+// localCommands work without the LLM API, and therefore offline.
+var localCommands = []string{"diagnose", "index", "history", "show", "attempts", "salvage", "usage", "blame-ai", "config", "gc", "cmdlog", "deps", "mv", "extract", "telemetry"}
+
+func isLocalCommand(command string) bool {
+        for _, c := range localCommands {
+                if c == command {
+                        return true
+                }
+        }
+        return false
+}
+
+// readOnlyCommands never write to the project, so they may run with
+// --read-only; config and cmdlog may too, except for config set and
+// cmdlog run.
+var readOnlyCommands = []string{"explain", "review", "diagnose", "history", "show", "attempts", "usage", "blame-ai", "config", "cmdlog", "deps", "telemetry"}
+
+// validateReadOnly rejects --read-only with a command or flag that writes.
+func validateReadOnly(config *Config, cmd *Command) error {
+        if !config.ReadOnly {
+                return nil
+        }
+        if len(cmd.Files) > 0 && (cmd.Type == "config" && cmd.Files[0] == "set" || cmd.Type == "cmdlog" && cmd.Files[0] == "run") {
+                return fmt.Errorf("%s %s writes files and can't run with --read-only", cmd.Type, cmd.Files[0])
+        }
+        writes := true
+        for _, c := range readOnlyCommands {
+                if c == cmd.Type {
+                        writes = false
+                }
+        }
+        if writes {
+                return fmt.Errorf("%s writes files and can't run with --read-only", cmd.Type)
+        }
+        if config.Stash || config.Worktree {
+                return fmt.Errorf("--stash and --worktree change the repository and can't be combined with --read-only")
+        }
+        return nil
 }
 
 func run(ctx context.Context, config *Config, cmd *Command) error {
-        // Diagnose command doesn't need services initialization
-        if cmd.Type == "diagnose" {
+        if config.Events != "" {
+                log, err := openEventLog(config.Events, config.EventsTo)
+                if err != nil {
+                        return err
+                }
+                defer log.close()
+                config.EventLog = log
+        }
+
+        var remote *remoteRepo
+        if config.Repo != "" {
+                var err error
+                if remote, err = fetchRemote(ctx, config); err != nil {
+                        return err
+                }
+                if err := applyTask(config, cmd); err != nil {
+                        return err
+                }
+                if err := validateConfig(config, cmd); err != nil {
+                        return err
+                }
+        }
+
+        // Local commands don't need services initialization
+        switch cmd.Type {
+        case "diagnose":
                 return runDiagnose(ctx, config, cmd)
+        case "index":
+                return runIndex(ctx, config, cmd)
+        case "history":
+                return runHistory(ctx, config, cmd)
+        case "show":
+                return runShow(ctx, config, cmd)
+        case "attempts":
+                return runAttempts(ctx, config, cmd)
+        case "salvage":
+                return runSalvage(ctx, config, cmd)
+        case "usage":
+                return runUsage(ctx, config, cmd)
+        case "blame-ai":
+                return runBlameAI(ctx, config, cmd)
+        case "serve":
+                return runServe(ctx, config, cmd)
+        case "replay":
+                return runReplay(ctx, config, cmd)
+        case "config":
+                return reportedError(runConfig(ctx, config, cmd))
+        case "gc":
+                return runGC(ctx, config, cmd)
+        case "cmdlog":
+                return runCmdlog(ctx, config, cmd)
+        case "deps":
+                return runDeps(ctx, config, cmd)
+        case "mv":
+                return runMove(ctx, config, cmd)
+        case "extract":
+                return runExtract(ctx, config, cmd)
+        case "telemetry":
+                return runTelemetry(ctx, config, cmd)
+        }
+
+        // A diff review needs the user's tree as is and never writes.
+        if config.Diff {
+                return runDiffReview(ctx, config, cmd)
+        }
+        if config.Migrations {
+                return runMigrationReview(ctx, config, cmd)
+        }
+
+        if err := applyIssue(ctx, config, cmd); err != nil {
+                return err
+        }
+
+        // Editor diagnostics pick the files and lines to fix.
+        var lines map[string][]int
+        if config.DiagFile != "" {
+                var err error
+                if lines, err = applyDiagnostics(config, cmd); err != nil {
+                        return err
+                }
+        }
+
+        // A remote checkout is already isolated from the user's tree, and
+        // a run that only reads it leaves it alone.
+        var wt *worktree
+        guard := remote == nil && !config.DryRun && !config.ReadOnly && !orchestrator.Mode(cmd.Type).ReadOnly()
+        if config.Worktree && guard {
+                var err error
+                if wt, err = openWorktree(ctx, config, cmd); err != nil {
+                        return err
+                }
+                defer wt.close(ctx)
+        } else if guard {
+                stash, err := guardDirty(ctx, config, cmd)
+                if err != nil {
+                        return err
+                }
+                defer stash.restore(ctx)
+        }
+
+        config.Model = config.router().Select(cmd.Type, inputSize(config.WorkDir, cmd.Files))
+        images, err := loadImages(config, cmd.Images)
+        if err != nil {
+                return err
+        }
+        if config.Verbose {
+                if config.Profile != "" {
+                        fmt.Printf("  Profile: %s\n", config.Profile)
+                }
+                fmt.Printf("  Model: %s\n", config.Model)
         }
 
         services, err := initServices(config)
         if err != nil {
                 return fmt.Errorf("init services: %w", err)
         }
-
+        defer services.recorder.close()
+        services.recorder.begin(cmd.Type, cmd.Instruction, config.WorkDir, config.Model)
+
+        ec := engineConfig(config)
+        if len(cmd.Context) > 0 {
+                ec.Compress, err = contextCompressor(config, services)
+                if err != nil {
+                        return err
+                }
+        }
         engine := orchestrator.NewEngine(
                 services.file,
                 services.prompt,
                 services.llm,
                 services.exec,
-                orchestrator.Config{MaxRetries: config.MaxRetries, BuildVerify: !config.DryRun, Logger: newLogger(config.Verbose)},
+                ec,
         )
 
-        var result *orchestrator.Result
-        switch cmd.Type {
-        case "refactor":
-                result = engine.Refactor(ctx, cmd.Files, cmd.Instruction, config.WorkDir)
-        case "fix":
-                result = engine.Fix(ctx, cmd.Files, cmd.Instruction, config.WorkDir)
-        case "generate":
-                result = engine.Generate(ctx, cmd.Files, cmd.Instruction, config.WorkDir)
-        case "explain", "review", "test":
-                result = engine.Refactor(ctx, cmd.Files, cmd.Instruction, config.WorkDir)
-        default:
-                return fmt.Errorf("unsupported command: %s", cmd.Type)
+        result, err := dispatch(ctx, config, cmd, lines, images, services, engine)
+        if err != nil {
+                return err
         }
 
-        printResult(result, config.Verbose)
+        services.recorder.finish(result)
+        printResult(result, services.recorder, config.Verbose)
         if !result.Success {
-                return result.Error
+                return reportedError(result.Error)
+        }
+        if orchestrator.Mode(cmd.Type).ReadOnly() {
+                fmt.Println(result.Output)
+                printFindings(result.Findings)
+                return nil
+        }
+        printMutation(result.Mutation)
+        if remote != nil {
+                return remote.publish(ctx, config, cmd, result)
+        }
+        if wt != nil {
+                return wt.finish(ctx, cmd, result)
         }
         return nil
 }
 
+// dispatch runs cmd on engine and returns its result.
+func dispatch(ctx context.Context, config *Config, cmd *Command, lines map[string][]int, images []*vision.Image, services *services, engine *orchestrator.Engine) (*orchestrator.Result, error) {
+        switch {
+        case config.Pipeline && (cmd.Type == "refactor" || cmd.Type == "fix" || cmd.Type == "generate"):
+                return runPipeline(ctx, config, cmd, images, services, engine)
+        case cmd.Type == "refactor", cmd.Type == "fix", cmd.Type == "generate":
+                return engine.Execute(ctx, &orchestrator.Request{Mode: orchestrator.Mode(cmd.Type), Files: cmd.Files, Context: cmd.Context, Instruction: cmd.Instruction, WorkDir: config.WorkDir, Lines: lines, Constraints: constraintsFor(config, cmd), Images: images, Roots: rootDirs(config)}), nil
+        case cmd.Type == "triage":
+                return runTriage(ctx, config, cmd, services, engine)
+        case cmd.Type == "races":
+                return runRaces(ctx, config, cmd, services, engine)
+        case cmd.Type == "todos":
+                return runTodos(ctx, config, cmd, services, engine)
+        case cmd.Type == "test":
+                return engine.GenerateTests(ctx, &orchestrator.Request{Mode: orchestrator.ModeTest, Files: cmd.Files, Context: cmd.Context, Instruction: cmd.Instruction, WorkDir: config.WorkDir, Constraints: constraintsFor(config, cmd)}), nil
+        case cmd.Type == "explain", cmd.Type == "review":
+                // Analysis modes return the answer without parsing code to write.
+                return engine.Execute(ctx, &orchestrator.Request{Mode: orchestrator.Mode(cmd.Type), Files: cmd.Files, Context: cmd.Context, Instruction: cmd.Instruction, WorkDir: config.WorkDir, Roots: rootDirs(config)}), nil
+        default:
+                return nil, fmt.Errorf("unsupported command: %s", cmd.Type)
+        }
+}
+
+func engineConfig(config *Config) orchestrator.Config {
+        ec := orchestrator.Config{MaxRetries: config.MaxRetries, BuildVerify: true, DryRun: config.DryRun, Logger: newLogger(config.Verbose)}
+        // Both read go.mod and the index from the local disk.
+        if config.SSH == "" {
+                ec.Dependencies = dependencyHook(config)
+                ec.Dependents = dependentsHook(config)
+                rules, _, err := layeringRules(config, config.WorkDir)
+                if err != nil {
+                        fmt.Printf("%s %v\n", glyph("⚠"), err)
+                        rules = config.Layering
+                }
+                ec.Layering = rules
+        }
+        ec.MaxWriteFiles, ec.MaxWriteBytes = config.MaxFiles, config.MaxBytes
+        ec.MaxFeedbackTokens = config.Feedback
+        ec.MaxDiffMultiple = config.DiffMult
+        ec.PreserveComments = config.Preserve
+        ec.RunTests = config.RunTests
+        ec.EnvMatrix = config.EnvMatrix
+        ec.MutationTesting = config.Mutate
+        ec.ReviewPolicy = config.Policy
+        ec.FormatGo = true
+        ec.Refusals = config.Refuse
+        ec.Events = recentEvents.add
+        if log := config.EventLog; log != nil {
+                ec.Events = func(ev orchestrator.Event) {
+                        recentEvents.add(ev)
+                        log.emit(ev)
+                }
+        }
+        if config.Staged || config.DryRun {
+                ec.StagingDir = filepath.Join(config.WorkDir, stateDir, "staging")
+        }
+        return ec
+}
+
 type services struct {
-        file   *fileAdapter
-        prompt *promptAdapter
-        llm    *llmAdapter
-        exec   *execAdapter
+        file     *fileAdapter
+        prompt   *promptAdapter
+        llm      *llmAdapter
+        exec     *execAdapter
+        recorder *recorder
 }
 
 func initServices(config *Config) (*services, error) {
-        fileMgr, err := filesystem.NewManager(filesystem.Config{RootDir: config.WorkDir, BackupEnabled: !config.NoBackup})
+        fileMgr, err := filesystem.NewManager(filesystem.Config{RootDir: config.WorkDir, BackupEnabled: !config.NoBackup, MaxBackups: config.BackupKeep, ReadOnly: config.ReadOnly, IgnorePatterns: config.Ignore})
         if err != nil {
                 return nil, fmt.Errorf("filesystem: %w", err)
         }
 
-        llmClient, err := llm.NewClient(llm.Config{APIKey: config.APIKey, Model: config.Model, Timeout: config.Timeout, MaxRetries: config.MaxRetries})
+        llmClient, err := newLLMClient(config, config.Model)
         if err != nil {
                 return nil, fmt.Errorf("llm: %w", err)
         }
 
         execMgr := executor.NewExecutor(executor.DefaultOptions())
 
+        stateRoot := fileMgr.GetRoot()
+        if config.StateRoot != "" {
+                stateRoot = config.StateRoot
+        }
+        st, err := openStore(stateRoot)
+        if err != nil {
+                fmt.Printf("  %s State store unavailable, history will not be recorded: %v\n", glyph("⚠"), err)
+        }
+        spend, err := newSpendGuard(config)
+        if err == nil {
+                err = spend.check()
+        }
+        if err != nil {
+                if st != nil {
+                        st.Close()
+                }
+                return nil, err
+        }
+        autoGC(fileMgr.GetRoot(), st, config)
+        rec := newRecorder(st)
+        rec.provenanceDir = provenanceDir(stateRoot)
+        if config.SignKey != "" {
+                rec.signKey, err = provenance.LoadKey(config.SignKey)
+                if err != nil {
+                        return nil, fmt.Errorf("sign key: %w", err)
+                }
+        }
+
+        roots, err := openRoots(config)
+        if err != nil {
+                return nil, err
+        }
+        host, err := openRemote(config)
+        if err != nil {
+                return nil, err
+        }
+
+        // Remote checkouts and worktrees are discarded with their artifacts.
+        var firstWrite func()
+        if config.Repo == "" && config.SSH == "" && !config.Worktree && !config.DryRun && !config.ReadOnly {
+                firstWrite = func() { excludeArtifacts(context.Background(), fileMgr.GetRoot(), st, config) }
+        }
+
         return &services{
-                file:   &fileAdapter{mgr: fileMgr},
-                prompt: &promptAdapter{builder: prompt.NewBuilder(prompt.DefaultConfig())},
-                llm:    &llmAdapter{client: llmClient},
-                exec:   &execAdapter{exec: execMgr},
+                file:     &fileAdapter{mgr: fileMgr, rec: rec, firstWrite: firstWrite, roots: roots, primary: config.RootName, remote: host},
+                prompt:   newPromptAdapter(config.Model),
+                llm:      newLLMAdapter(config, llmClient, rec, spend),
+                exec:     &execAdapter{exec: execMgr, opts: verifyOptions(config), rec: rec, remote: host, root: config.WorkDir},
+                recorder: rec,
         }, nil
 }
 
-type fileAdapter struct{ mgr *filesystem.Manager }
+// newLLMClient creates a client for model with the shared connection settings.
+func newLLMClient(config *Config, model string) (*llm.Client, error) {
+        return llm.NewClient(llm.Config{APIKey: config.APIKey, Model: model, Timeout: config.Timeout, MaxRetries: config.MaxRetries, JWT: config.JWT, StreamIdleTimeout: config.StreamIdle, Options: config.ProvOpts, Deterministic: config.Determ, Seed: config.Seed})
+}
+
+type fileAdapter struct {
+        mgr *filesystem.Manager
+        rec *recorder
+        // roots are the further roots of a multi-root run; primary is
+        // the name of mgr's root.
+        roots   []rootFS
+        primary string
+        // remote, when set, holds the project instead of mgr.
+        remote *remotefs.Client
+        // firstWrite runs once, before the first file is written.
+        firstWrite func()
+        once       sync.Once
+}
 
 func (a *fileAdapter) ReadFile(path string) (string, error) {
-        content, err := a.mgr.ReadFile(path)
+        if a.remote != nil {
+                return a.remote.ReadFile(path)
+        }
+        mgr, path := a.route(path)
+        content, err := mgr.ReadFile(path)
         if err != nil {
                 return "", err
         }
         return content.Content, nil
 }
 func (a *fileAdapter) WriteFile(path, content string) error {
-        _, err := a.mgr.WriteFile(path, content, true)
-        return err
+        if a.firstWrite != nil {
+                a.once.Do(a.firstWrite)
+        }
+        if a.remote != nil {
+                return a.writeRemote(path, content)
+        }
+        mgr, rel := a.route(path)
+        var before string
+        if old, err := mgr.ReadFile(rel); err == nil {
+                before = old.Content
+        }
+        backup, err := mgr.WriteFile(rel, content, true)
+        if err != nil {
+                return err
+        }
+        if backup != nil {
+                a.rec.backup(path, mgr.BackupObject(*backup), backup.Checksum)
+        }
+        a.rec.file(path, before, content)
+        return nil
+}
+func (a *fileAdapter) FileExists(path string) bool {
+        if a.remote != nil {
+                return a.remote.FileExists(path)
+        }
+        mgr, path := a.route(path)
+        return mgr.FileExists(path)
 }
-func (a *fileAdapter) FileExists(path string) bool { return a.mgr.FileExists(path) }
 
+// promptAdapter starts a separate draft for every prompt, so concurrent
+// callers never share builder state.
 type promptAdapter struct {
-        builder *prompt.Builder
-        mode    string
-        inst    string
-        files   map[string]string
+        model string
+}
+
+func newPromptAdapter(model string) *promptAdapter {
+        return &promptAdapter{model: model}
 }
 
+// SetMode starts a new prompt.
 func (a *promptAdapter) SetMode(mode string) orchestrator.PromptService {
-        a.mode = mode
-        return a
+        return &promptDraft{model: a.model, mode: mode}
 }
 func (a *promptAdapter) SetInstruction(instruction string) orchestrator.PromptService {
-        a.inst = instruction
-        return a
+        return a.SetMode("").SetInstruction(instruction)
 }
 func (a *promptAdapter) AddFile(path, content string, isMain bool) orchestrator.PromptService {
-        if a.files == nil {
-                a.files = make(map[string]string)
+        return a.SetMode("").AddFile(path, content, isMain)
+}
+func (a *promptAdapter) AddConstraint(constraint string) orchestrator.PromptService {
+        return a.SetMode("").AddConstraint(constraint)
+}
+func (a *promptAdapter) Build() ([]orchestrator.Message, error) {
+        return a.SetMode("").Build()
+}
+
+// promptDraft is one prompt being built.
+type promptDraft struct {
+        model string
+        mode  string
+        inst  string
+        files map[string]string
+        main  map[string]bool
+        cons  []string
+}
+
+func (d *promptDraft) SetMode(mode string) orchestrator.PromptService {
+        return &promptDraft{model: d.model, mode: mode}
+}
+func (d *promptDraft) SetInstruction(instruction string) orchestrator.PromptService {
+        d.inst = instruction
+        return d
+}
+func (d *promptDraft) AddFile(path, content string, isMain bool) orchestrator.PromptService {
+        if d.files == nil {
+                d.files = make(map[string]string)
+                d.main = make(map[string]bool)
         }
-        a.files[path] = content
-        return a
+        d.files[path] = content
+        d.main[path] = isMain
+        return d
 }
-func (a *promptAdapter) Build() (string, error) {
-        b := prompt.NewBuilder(prompt.DefaultConfig())
-        b.SetMode(a.mode)
-        b.SetInstruction(a.inst)
-        for p, c := range a.files {
-                b.AddFile(p, c, true)
+func (d *promptDraft) AddConstraint(constraint string) orchestrator.PromptService {
+        d.cons = append(d.cons, constraint)
+        return d
+}
+func (d *promptDraft) Build() ([]orchestrator.Message, error) {
+        b := prompt.NewBuilder(prompt.ConfigForModel(d.model))
+        b.SetMode(d.mode)
+        b.SetInstruction(d.inst)
+        for p, c := range d.files {
+                b.AddFile(p, c, d.main[p])
+        }
+        for _, c := range d.cons {
+                b.AddConstraint(c)
         }
         result, err := b.Build()
         if err != nil {
-                return "", err
+                return nil, err
         }
         if len(result.Messages) == 0 {
-                return "", fmt.Errorf("no messages in prompt")
+                return nil, fmt.Errorf("no messages in prompt")
+        }
+        messages := make([]orchestrator.Message, len(result.Messages))
+        for i, m := range result.Messages {
+                messages[i] = orchestrator.Message{Role: string(m.Role), Content: m.Content}
         }
-        return result.Messages[len(result.Messages)-1].Content, nil
+        return messages, nil
 }
 
-type llmAdapter struct{ client *llm.Client }
+type llmAdapter struct {
+        client  *llm.Client
+        rec     *recorder
+        stream  bool
+        verbose bool
+        record  bool // record requests for replay
+        seed    int
+        refuse  orchestrator.Refusals
+        spend   *spendGuard // checked before every request
+}
 
-func (a *llmAdapter) Chat(ctx context.Context, prompt string) (string, error) {
-        return a.client.SimpleChat(ctx, prompt)
+func newLLMAdapter(config *Config, client *llm.Client, rec *recorder, spend *spendGuard) *llmAdapter {
+        refuse := append(append(orchestrator.Refusals{}, orchestrator.DefaultRefusals...), config.Refuse...)
+        return &llmAdapter{client: client, rec: rec, stream: config.Stream, verbose: config.Verbose, record: config.Determ, seed: config.Seed, refuse: refuse, spend: spend}
 }
 
-type execAdapter struct{ exec *executor.Executor }
+// Chat sends the whole conversation, system message included.
+func (a *llmAdapter) Chat(ctx context.Context, messages []orchestrator.Message) (string, error) {
+        return a.ChatStream(ctx, messages, nil)
+}
 
-func (a *execAdapter) ExecuteInDir(ctx context.Context, command, dir string) (int, string, string, error) {
-        result, err := a.exec.RunInDir(command, dir)
-        if result == nil {
-                return -1, "", "", err
+// ChatStream is Chat that passes the response to onChunk as it streams
+// (with --stream), or whole once it arrives.
+func (a *llmAdapter) ChatStream(ctx context.Context, messages []orchestrator.Message, onChunk func(string)) (string, error) {
+        parts := make([]string, len(messages))
+        converted := make([]llm.Message, len(messages))
+        for i, m := range messages {
+                parts[i] = m.Content
+                converted[i] = llm.Message{Role: m.Role, Content: m.Content}
+                for _, img := range m.Images {
+                        converted[i].Images = append(converted[i].Images, img.DataURL())
+                }
         }
-        return result.ExitCode, result.Stdout, result.Stderr, err
+        // The engine refuses files by path and content; this catches what
+        // reaches the LLM another way, such as a diff or a log.
+        if err := a.refuse.CheckContent("the prompt", strings.Join(parts, "\n\n")); err != nil {
+                return "", err
+        }
+        a.rec.prompt(strings.Join(parts, "\n\n"))
+
+        // A response cut off at the output limit is continued and stitched
+        // together, so the engine never parses a truncated file.
+        response, finish, err := a.send(ctx, converted, onChunk)
+        for n := 1; err == nil && finish == "length" && n <= maxContinuations; n++ {
+                fmt.Printf("  %s %s\n", glyph("ℹ"), trf("Response cut off at the output limit, continuing (%d/%d)", n, maxContinuations))
+                var piece string
+                piece, finish, err = a.send(ctx, continuation(converted, response), nil)
+                piece = stitch(response, piece)
+                if err == nil && onChunk != nil {
+                        onChunk(piece)
+                }
+                response += piece
+        }
+        if err == nil && finish == "length" {
+                fmt.Printf("  %s %s\n", glyph("⚠"), trf("Response still cut off after %d continuations", maxContinuations))
+        }
+        return response, err
+}
+
+// send makes one request, returning the response and its finish reason.
+func (a *llmAdapter) send(ctx context.Context, messages []llm.Message, onChunk func(string)) (string, string, error) {
+        if err := a.spend.check(); err != nil {
+                return "", "", err
+        }
+        var response, finish string
+        var err error
+        if a.stream {
+                response, finish, err = a.chatStream(ctx, messages, onChunk)
+        } else if response, finish, err = a.chat(ctx, messages); err == nil && onChunk != nil {
+                onChunk(response)
+        }
+        if err == nil && a.record {
+                a.recordRequest(messages, response)
+        }
+        return response, finish, err
+}
+
+// recordRequest stores the body of a request as sent without streaming,
+// so replay can re-issue it.
+func (a *llmAdapter) recordRequest(messages []llm.Message, response string) {
+        body, err := a.client.Body(llm.ChatCompletionRequest{Messages: messages})
+        if err != nil {
+                a.rec.warn(err)
+                return
+        }
+        parts := make([]string, len(messages))
+        for i, m := range messages {
+                parts[i] = m.Content
+        }
+        a.rec.request(a.client.Model(), a.seed, strings.Join(parts, "\n\n"), string(body), response)
+}
+
+func (a *llmAdapter) chat(ctx context.Context, messages []llm.Message) (string, string, error) {
+        resp, err := a.client.ChatCompletion(ctx, llm.ChatCompletionRequest{Messages: messages})
+        if err != nil {
+                return "", "", err
+        }
+        a.usage(resp.Usage.PromptTokens, resp.Usage.CompletionTokens, resp.Usage.TotalTokens)
+        if len(resp.Choices) == 0 {
+                return "", "", fmt.Errorf("no choices in response")
+        }
+        return resp.Choices[0].Message.Content, resp.Choices[0].FinishReason, nil
+}
+
+func (a *llmAdapter) chatStream(ctx context.Context, messages []llm.Message, onChunk func(string)) (string, string, error) {
+        var sb strings.Builder
+        stats, err := a.client.StreamWithStats(ctx, llm.ChatCompletionRequest{Messages: messages}, func(chunk string) error {
+                sb.WriteString(chunk)
+                if onChunk != nil {
+                        onChunk(chunk)
+                }
+                return nil
+        })
+        if stats != nil && a.verbose {
+                fmt.Printf("  Stream: first token %v, %d chunk(s), %.1f tok/s", stats.TimeToFirstToken.Round(time.Millisecond), stats.Chunks, stats.TokensPerSecond())
+                if stats.Retries > 0 {
+                        fmt.Printf(", %d stall retr(ies)", stats.Retries)
+                }
+                fmt.Println()
+        }
+        if err != nil {
+                var serr *llm.StreamError
+                if errors.As(err, &serr) && a.verbose {
+                        fmt.Printf("  Partial output before failure:\n%s\n", truncate(serr.Partial, 500))
+                }
+                return "", "", err
+        }
+        a.usage(stats.PromptTokens, stats.CompletionTokens, stats.TotalTokens)
+        return sb.String(), stats.FinishReason, nil
+}
+
+// usage records the tokens of a request and adds its cost to the spend
+// ledger.
+func (a *llmAdapter) usage(prompt, completion, total int) {
+        a.rec.usage(a.client.Model(), prompt, completion, total)
+        if err := a.spend.record(a.client.Model(), prompt, completion); err != nil {
+                fmt.Printf("  %s spend: %v\n", glyph("⚠"), err)
+        }
+}
+
+type execAdapter struct {
+        exec *executor.Executor
+        opts executor.Options
+        rec  *recorder
+        // remote, when set, runs commands on its host; local directories
+        // under root map to the same directories of the remote project.
+        remote *remotefs.Client
+        root   string
+}
+
+// verifyOptions are the executor options of verification commands.
+func verifyOptions(config *Config) executor.Options {
+        opts := executor.DefaultOptions()
+        opts.PTY = config.VerifyPTY
+        opts.Retry = executor.NetworkRetryPolicy()
+        opts.Env = goBuildEnv()
+        if config.VerifyIn {
+                opts.Stdin = os.Stdin
+        }
+        return opts
+}
+
+// ExecuteInDir runs name with args in dir, stopping it when ctx is done.
+func (a *execAdapter) ExecuteInDir(ctx context.Context, dir, name string, args ...string) (*diagnose.VerificationResult, error) {
+        return a.ExecuteInDirEnv(ctx, nil, dir, name, args...)
+}
+
+// ExecuteInDirEnv is ExecuteInDir with env set over the environment; on
+// a remote host, through env(1).
+func (a *execAdapter) ExecuteInDirEnv(ctx context.Context, env map[string]string, dir, name string, args ...string) (*diagnose.VerificationResult, error) {
+        opts := a.opts
+        opts.WorkingDir = dir
+        run, runArgs := name, args
+        if len(env) > 0 {
+                opts.Env = make(map[string]string, len(a.opts.Env)+len(env))
+                for k, v := range a.opts.Env {
+                        opts.Env[k] = v
+                }
+                for k, v := range env {
+                        opts.Env[k] = v
+                }
+        }
+        if a.remote != nil {
+                if len(env) > 0 {
+                        run, runArgs = "env", append(strings.Fields(orchestrator.FormatEnv(env)), append([]string{name}, args...)...)
+                }
+                var err error
+                if run, runArgs, err = a.remoteCommand(dir, run, runArgs); err != nil {
+                        return nil, err
+                }
+                opts.WorkingDir = ""
+        }
+        result, err := a.exec.ExecuteArgsWithOptions(ctx, opts, run, runArgs...)
+        if result != nil {
+                a.rec.command(store.Command{
+                        Command:   result.Command,
+                        Args:      append([]string{name}, args...),
+                        Dir:       dir,
+                        Env:       commandEnv(opts),
+                        ExitCode:  result.ExitCode,
+                        Duration:  result.Duration,
+                        CreatedAt: result.QueuedAt,
+                })
+        }
+        if err != nil {
+                return nil, err
+        }
+        return diagnose.NewVerificationResult(result.Command, result.ExitCode, result.Combined, result.Duration), nil
 }
 
 type logger struct{ verbose bool }
@@ -326,34 +1438,71 @@ func (l *logger) Info(format string, args ...interface{}) {
         fmt.Printf("  %s\n", fmt.Sprintf(format, args...))
 }
 func (l *logger) Error(format string, args ...interface{}) {
-        fmt.Printf("  ❌ %s\n", fmt.Sprintf(format, args...))
+        fmt.Printf("  %s %s\n", glyph("❌"), fmt.Sprintf(format, args...))
 }
 func (l *logger) Debug(format string, args ...interface{}) {
         if l.verbose {
-                fmt.Printf("  🐛 %s\n", fmt.Sprintf(format, args...))
+                fmt.Printf("  %s %s\n", glyph("🐛"), fmt.Sprintf(format, args...))
         }
 }
 
-func printResult(result *orchestrator.Result, verbose bool) {
+func printResult(result *orchestrator.Result, rec *recorder, verbose bool) {
         fmt.Println()
-        fmt.Println("━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━")
+        fmt.Println(rule())
         if result.Success {
-                fmt.Println("  ✅ Operation completed successfully!")
+                fmt.Printf("  %s %s\n", glyph("✅"), tr("Operation completed successfully!"))
         } else {
-                fmt.Println("  ❌ Operation failed!")
+                fmt.Printf("  %s %s\n", glyph("❌"), tr("Operation failed!"))
         }
         if len(result.FilesWritten) > 0 {
-                fmt.Println("\n  Files changed:")
+                fmt.Printf("\n  %s\n", tr("Files changed:"))
+                stats := rec.diffStats()
+                var total diff.Stats
                 for _, f := range result.FilesWritten {
-                        fmt.Printf("    📝 %s\n", f)
+                        s, ok := stats[filepath.ToSlash(f)]
+                        if !ok {
+                                fmt.Printf("    %s %s\n", glyph("📝"), f)
+                                continue
+                        }
+                        fmt.Printf("    %s %s  +%d -%d\n", glyph("📝"), f, s.Added, s.Removed)
+                        total.Added += s.Added
+                        total.Removed += s.Removed
+                }
+                fmt.Printf("    %s\n", trf("%d file(s), +%d -%d lines", len(result.FilesWritten), total.Added, total.Removed))
+        }
+        if len(result.Candidates) > 0 {
+                fmt.Printf("\n  %s\n", tr("Dry run, files that would change:"))
+                paths := make([]string, 0, len(result.Candidates))
+                for p := range result.Candidates {
+                        paths = append(paths, p)
+                }
+                sort.Strings(paths)
+                for _, p := range paths {
+                        fmt.Printf("    %s %s\n", glyph("📝"), p)
+                }
+        }
+        fmt.Printf("\n  %s\n", trf("Attempts: %d", result.Attempts))
+        if verbose {
+                for _, h := range result.History {
+                        fmt.Printf("    %d. %s: %s\n", h.Attempt, h.Stage, truncate(firstLine(h.Error), 100))
+                }
+        }
+        if len(result.Verifications) > 0 {
+                fmt.Printf("\n  %s\n", tr("Verification:"))
+                for _, v := range result.Verifications {
+                        mark := glyph("✅")
+                        if !v.Passed() {
+                                mark = glyph("❌")
+                        }
+                        fmt.Printf("    %s %s\n", mark, v.Summary())
                 }
         }
-        fmt.Printf("\n  Attempts: %d\n", result.Attempts)
-        fmt.Printf("  Duration: %v\n", result.Duration)
+        printTokenUsage(rec.usageTotals())
+        fmt.Printf("  %s\n", trf("Duration: %v", result.Duration))
         if verbose && result.Explanation != "" {
-                fmt.Printf("\n  Explanation:\n    %s\n", truncate(result.Explanation, 200))
+                fmt.Printf("\n  %s\n    %s\n", tr("Explanation:"), truncate(result.Explanation, 200))
         }
-        fmt.Println("━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━")
+        fmt.Println(rule())
 }
 
 func runDiagnose(ctx context.Context, config *Config, cmd *Command) error {
@@ -370,8 +1519,15 @@ func runDiagnose(ctx context.Context, config *Config, cmd *Command) error {
                 projectPath = cmd.Files[0]
         }
 
-        fmt.Println("\n🔍 Running project diagnosis...")
-        fmt.Printf("   Project: %s\n\n", projectPath)
+        fmt.Printf("\n%s %s\n", glyph("🔍"), tr("Running project diagnosis..."))
+        fmt.Printf("   %s\n\n", trf("Project: %s", projectPath))
+
+        // Footprints are kept in the project's state store; without one
+        // there is nothing to compare with.
+        st, err := openStore(projectPath)
+        if err == nil {
+                defer st.Close()
+        }
 
         diagConfig := diagnose.Config{
                 ProjectPath:  projectPath,
@@ -382,8 +1538,15 @@ func runDiagnose(ctx context.Context, config *Config, cmd *Command) error {
                 CheckTests:   true,
                 CheckRuntime: false, // Skip runtime check by default
                 CheckLint:    true,
+                CheckAPI:     true,
+                APISpec:      config.APISpec,
+                APISource:    config.APISource,
+                Platforms:    config.Platforms,
+                CheckFootprint: true,
+                History:      footprints(st),
                 AutoFix:      true,
                 Verbose:      config.Verbose,
+                Retry:        executor.NetworkRetryPolicy(),
         }
 
         // Parse instruction for options
@@ -398,6 +1561,12 @@ func runDiagnose(ctx context.Context, config *Config, cmd *Command) error {
                 if strings.Contains(opts, "no-test") {
                         diagConfig.CheckTests = false
                 }
+                if strings.Contains(opts, "no-api") {
+                        diagConfig.CheckAPI = false
+                }
+                if strings.Contains(opts, "cross") && len(diagConfig.Platforms) == 0 {
+                        diagConfig.Platforms = diagnose.DefaultPlatforms
+                }
         }
 
         diag := diagnose.NewDiagnoser(diagConfig)
@@ -405,19 +1574,24 @@ func runDiagnose(ctx context.Context, config *Config, cmd *Command) error {
         if err != nil {
                 return fmt.Errorf("diagnosis failed: %w", err)
         }
+        if err := recordFootprint(st, result.Footprint); err != nil && config.Verbose {
+                fmt.Printf("   %s %s\n", glyph("⚠"), trf("Footprint not recorded: %v", err))
+        }
 
         printDiagnosticResult(result, config.Verbose)
 
         // If auto-fix is enabled and there are issues, attempt to fix
-        if diagConfig.AutoFix && result.TotalIssues > 0 {
-                fmt.Println("\n🔧 Attempting auto-fix with AI...")
+        if diagConfig.AutoFix && result.TotalIssues > 0 && config.Offline {
+                fmt.Printf("\n   %s %s\n", glyph("ℹ"), tr("Auto-fix skipped (offline)."))
+        } else if diagConfig.AutoFix && result.TotalIssues > 0 {
+                fmt.Printf("\n%s %s\n", glyph("🔧"), tr("Attempting auto-fix with AI..."))
                 fixable := diag.GetFixableIssues()
                 if len(fixable) > 0 {
                         if err := autoFixIssues(ctx, config, diag, fixable); err != nil {
-                                fmt.Printf("   ⚠ Auto-fix encountered issues: %v\n", err)
+                                fmt.Printf("   %s %s\n", glyph("⚠"), trf("Auto-fix encountered issues: %v", err))
                         }
                 } else {
-                        fmt.Println("   ℹ No auto-fixable issues found.")
+                        fmt.Printf("   %s %s\n", glyph("ℹ"), tr("No auto-fixable issues found."))
                 }
         }
 
@@ -446,7 +1620,7 @@ func autoFixIssues(ctx context.Context, config *Config, diag *diagnose.Diagnoser
         }
 
         // Debug output
-        fmt.Printf("   🔑 API Key status: ")
+        fmt.Printf("   %s API Key status: ", glyph("🔑"))
         if apiKey != "" {
                 fmt.Printf("found (length: %d)\n", len(apiKey))
         } else {
@@ -461,63 +1635,78 @@ func autoFixIssues(ctx context.Context, config *Config, diag *diagnose.Diagnoser
         config.APIKey = apiKey
 
         // Debug: verify API key is set
-        fmt.Printf("   🔧 Initializing services with API key (length: %d)...\n", len(config.APIKey))
+        fmt.Printf("   %s Initializing services with API key (length: %d)...\n", glyph("🔧"), len(config.APIKey))
 
         services, err := initServices(config)
         if err != nil {
-                fmt.Printf("   ❌ initServices failed: %v\n", err)
+                fmt.Printf("   %s initServices failed: %v\n", glyph("❌"), err)
                 return fmt.Errorf("init services: %w", err)
         }
+        defer services.recorder.close()
+        services.recorder.begin("fix", "diagnose auto-fix", config.WorkDir, config.Model)
 
         engine := orchestrator.NewEngine(
                 services.file,
                 services.prompt,
                 services.llm,
                 services.exec,
-                orchestrator.Config{MaxRetries: config.MaxRetries, BuildVerify: !config.DryRun, Logger: newLogger(config.Verbose)},
+                engineConfig(config),
         )
 
         fixedCount := 0
         for file, fileIssues := range issuesByFile {
                 // Build instruction from issues
                 var issueDescs []string
+                var lines []int
                 for _, issue := range fileIssues {
                         issueDescs = append(issueDescs, fmt.Sprintf("- Line %d: %s (%s)", issue.Line, issue.Title, issue.Description))
+                        if issue.Line > 0 {
+                                lines = append(lines, issue.Line)
+                        }
                 }
 
                 instruction := fmt.Sprintf("Fix the following issues in this file:\n%s", strings.Join(issueDescs, "\n"))
 
-                fmt.Printf("\n   📝 Fixing %s (%d issue(s))...\n", file, len(fileIssues))
-
-                result := engine.Fix(ctx, []string{file}, instruction, config.WorkDir)
+                fmt.Printf("\n   %s Fixing %s (%d issue(s))...\n", glyph("📝"), file, len(fileIssues))
+
+                // With line numbers the prompt carries only the declarations
+                // around the issues.
+                result := engine.Execute(ctx, &orchestrator.Request{
+                        Mode:        orchestrator.ModeFix,
+                        Files:       []string{file},
+                        Instruction: instruction,
+                        WorkDir:     config.WorkDir,
+                        Lines:       map[string][]int{file: lines},
+                })
+                services.recorder.finish(result)
                 if result.Success {
-                        fmt.Printf("   ✅ Fixed %s\n", file)
+                        fmt.Printf("   %s Fixed %s\n", glyph("✅"), file)
                         fixedCount += len(fileIssues)
                 } else {
-                        fmt.Printf("   ❌ Failed to fix %s: %v\n", file, result.Error)
+                        fmt.Printf("   %s Failed to fix %s: %v\n", glyph("❌"), file, result.Error)
                 }
         }
 
-        fmt.Printf("\n   📊 Fixed %d issue(s) across %d file(s)\n", fixedCount, len(issuesByFile))
+        fmt.Printf("\n   %s Fixed %d issue(s) across %d file(s)\n", glyph("📊"), fixedCount, len(issuesByFile))
         return nil
 }
 
 func printDiagnosticResult(result *diagnose.DiagnosticResult, verbose bool) {
-        fmt.Println("━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━")
-        fmt.Println("  🔍 Diagnostic Report")
-        fmt.Println("━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━")
-        fmt.Printf("\n  Project: %s\n", result.ProjectPath)
-        fmt.Printf("  Duration: %s\n\n", result.Duration)
+        fmt.Println(rule())
+        fmt.Printf("  %s %s\n", glyph("🔍"), tr("Diagnostic Report"))
+        fmt.Println(rule())
+        fmt.Printf("\n  %s\n", trf("Project: %s", result.ProjectPath))
+        fmt.Printf("  %s\n\n", trf("Duration: %v", result.Duration))
 
         // Status summary
-        fmt.Println("  Status:")
+        fmt.Printf("  %s\n", tr("Status:"))
         if result.BuildSuccess {
-                fmt.Println("    ✅ Build: OK")
+                fmt.Printf("    %s %s\n", glyph("✅"), tr("Build: OK"))
         } else {
-                fmt.Println("    ❌ Build: Failed")
+                fmt.Printf("    %s %s\n", glyph("❌"), tr("Build: Failed"))
         }
         if result.TestSuccess {
-                fmt.Println("    ✅ Tests: OK")
+                fmt.Printf("    %s %s\n", glyph("✅"), tr("Tests: OK"))
         } else if !result.TestSuccess && len(result.Issues) > 0 {
                 hasTestIssues := false
                 for _, issue := range result.Issues {
@@ -527,68 +1716,41 @@ func printDiagnosticResult(result *diagnose.DiagnosticResult, verbose bool) {
                         }
                 }
                 if hasTestIssues {
-                        fmt.Println("    ❌ Tests: Failed")
+                        fmt.Printf("    %s %s\n", glyph("❌"), tr("Tests: Failed"))
                 }
         }
 
         // Issues summary
-        fmt.Printf("\n  Issues: %d total", result.TotalIssues)
+        fmt.Printf("\n  %s", trf("Issues: %d total", result.TotalIssues))
         if result.CriticalCount > 0 {
-                fmt.Printf(" | 🔴 %d critical", result.CriticalCount)
+                fmt.Printf(" | %s %s", glyph("🔴"), trf("%d critical", result.CriticalCount))
         }
         if result.ErrorCount > 0 {
-                fmt.Printf(" | 🟠 %d errors", result.ErrorCount)
+                fmt.Printf(" | %s %s", glyph("🟠"), trf("%d errors", result.ErrorCount))
         }
         if result.WarningCount > 0 {
-                fmt.Printf(" | 🟡 %d warnings", result.WarningCount)
+                fmt.Printf(" | %s %s", glyph("🟡"), trf("%d warnings", result.WarningCount))
         }
         fmt.Println()
 
         // Detailed issues
         if len(result.Issues) > 0 {
-                fmt.Println("\n  Detailed Issues:")
-                for i, issue := range result.Issues {
-                        if i >= 20 && !verbose {
-                                fmt.Printf("    ... and %d more issues\n", len(result.Issues)-20)
-                                break
-                        }
-
-                        levelIcon := "ℹ"
-                        switch issue.Level {
-                        case diagnose.LevelCritical:
-                                levelIcon = "🔴"
-                        case diagnose.LevelError:
-                                levelIcon = "🟠"
-                        case diagnose.LevelWarning:
-                                levelIcon = "🟡"
-                        }
-
-                        if issue.File != "" {
-                                fmt.Printf("    %s [%s] %s:%d - %s\n", levelIcon, issue.Category, issue.File, issue.Line, issue.Title)
-                        } else {
-                                fmt.Printf("    %s [%s] %s\n", levelIcon, issue.Category, issue.Title)
-                        }
-                        if verbose && issue.Description != "" {
-                                fmt.Printf("       %s\n", truncate(issue.Description, 100))
-                        }
-                        if issue.Suggestion != "" {
-                                fmt.Printf("       💡 %s\n", issue.Suggestion)
-                        }
-                }
+                fmt.Printf("\n  %s\n", tr("Detailed Issues:"))
+                printIssues(result.Issues, verbose)
         }
 
-        fmt.Println("\n━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━")
+        fmt.Println("\n" + rule())
 
         if result.TotalIssues == 0 {
-                fmt.Println("  ✅ No issues found. Project is healthy!")
+                fmt.Printf("  %s %s\n", glyph("✅"), tr("No issues found. Project is healthy!"))
         } else {
-                fmt.Printf("  ⚠ Found %d issue(s). Run with --verbose for details.\n", result.TotalIssues)
+                fmt.Printf("  %s %s\n", glyph("⚠"), trf("Found %d issue(s). Run with --verbose for details.", result.TotalIssues))
         }
-        fmt.Println("━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━")
+        fmt.Println(rule())
 }
 
 func printUsage() {
-        fmt.Println(`AI Dev Agent - AI-powered code assistant
+        fmt.Println(trUsage(`AI Dev Agent - AI-powered code assistant
 
 Usage:
   aidev <command> <files...> [flags] [-- instruction]
@@ -600,27 +1762,201 @@ Commands:
   explain     Explain code
   review      Review code
   test        Generate tests
+  races       Run the tests with -race and fix the data races found
+  todos       Make the changes "// TODO(ai): ..." comments ask for, and remove them
+  triage      Find the probable cause of a crash log or stack trace
   diagnose    Diagnose project issues and auto-fix
+  index       Build the workspace file index
+  history     List past operations
+  show        Show the changes of a past operation
+  attempts    Show the output of each attempt of a past operation, failed ones included
+  salvage     Apply an attempt's files onto the tree, merging edits made since
+  usage       Report token usage per model
+  blame-ai    Show which lines of a file the agent last wrote
+  serve       Run an HTTP job server with a priority queue
+  replay      Re-send the recorded requests of a deterministic run
+  config      Show or change the project configuration (show, get, set)
+  gc          Remove old backups, sessions and cache entries
+  cmdlog      List the commands the agent ran; show or run one again (show, run)
+  deps        Check imports for cycles and layering violations; draw the graph
+  mv          Move a file or package, or rename a symbol, updating references
+  extract     Extract lines into a function or another package, then name and document it
+  telemetry   Show, turn on or turn off anonymous usage statistics (status, on, off)
 
 Examples:
   aidev refactor server/handler.go
   aidev fix server/auth.go -- "Fix nil pointer"
   aidev generate api/user.go -- "Generate CRUD handlers"
+  aidev generate ui/page.tsx --image mockup.png -- "Implement this screen"
   aidev diagnose ./my-project
   aidev diagnose . -- "runtime"   # Include runtime check
+  aidev diagnose . -- "no-api"    # Skip the OpenAPI drift check
+  aidev diagnose . -- "cross"     # Also build for linux, darwin and windows
+  aidev index --watch             # Keep the index current
+  aidev deps --graph dot | dot -Tsvg > deps.svg
+  aidev mv service/old service/new          # Import paths follow the package
+  aidev mv service/store.Store.Open OpenDB  # Rename a method everywhere
+  aidev extract server/handler.go:120-180 --into internal/auth
+  aidev history --file server/auth.go --grep "nil"
+  aidev show 20240101-120000-ab12cd
+  aidev attempts 20240101-120000-ab12cd 2  # What attempt 2 wrote
+  aidev salvage 20240101-120000-ab12cd --attempt 2 --files server/auth.go
+  aidev blame-ai server/auth.go   # Lines last written by the agent
+  aidev replay 20240101-120000-ab12cd  # Re-send a --deterministic run's requests
+  aidev review --diff --base main # Review the branch's changes only
+  aidev review --migrations db/migrations/0042_orders.sql
+  aidev usage -n 7                # Token usage of the last week
+  aidev config show --effective   # Merged settings and their files
+  aidev config set model glm-4-plus
+  aidev telemetry on              # Count command runs, successes and retries
+  aidev config set model_for.review glm-4-air --local
+  aidev config set ignore "*.pb.go,testdata" --global  # Every project
+  aidev serve --addr 127.0.0.1:8421 --workers 2
+  aidev fix auth.go --pipeline --role-model reviewer=glm-4-plus -- "Fix token refresh"
+  aidev fix --diagnostics diags.json  # Fix what gopls/tsserver reported
+  aidev fix auth.go --profile careful -- "Fix token refresh"
+  aidev fix store.go --task wrap-errors
+  aidev fix --issue PROJ-123
+  aidev test render/page.go       # Tests, fixtures and golden files, checked for coverage
+  aidev test --mutate parse.go    # Also count the mutants the tests catch
+  aidev races ./...               # Fix data races until -race is quiet
+  aidev todos server/auth.go      # Resolve its TODO(ai) comments
+  aidev triage crash.log --fix    # Explain a panic, then fix the function it starts in
+  aidev refactor store.go --constraint api-stable --constraint "keep the SQL unchanged"
+  aidev fix auth.go --events ndjson --events-to fd:3 3>events.ndjson -- "Fix token refresh"
+  aidev fix auth.go --repo https://github.com/org/proj@main --pr -- "Fix token refresh"
 
 Flags:
+  A value follows its flag or an =, e.g. --timeout 5m or --timeout=5m
   -k, --api-key <key>     GLM API key
   -m, --model <name>      Model name (default: glm-4-flash)
+      --profile <name>    Settings preset: fast, careful or one from .aidev.yaml
+      --task <name>       Recurring task: null-checks, wrap-errors, add-context or one from .aidev.yaml
+      --issue <ref>       Fix a Jira (PROJ-123) or GitHub (owner/repo#123) issue from its text
+      --override-budget   Run even when a daily or monthly spend limit is reached
+      --model-for <t=m>   Model for a task (mode, review, test), e.g. fix=glm-4-plus
+      --provider-opt k=v  Extra request field for the provider (repeatable), e.g. do_sample=false
+      --deterministic     Pin sampling where supported and record requests for replay
+      --seed <n>          Seed of a deterministic run (implies --deterministic, default: 0)
+      --jwt               Authenticate with JWT tokens signed from an id.secret key
+      --stream            Stream responses (stalled streams are retried)
+      --stream-idle <dur> Cancel a stream idle for this long (default: 30s)
       --retries <n>       Max retries (default: 3)
       --timeout <dur>     Timeout (default: 2m)
   -V, --verbose           Verbose output
-      --dry-run           Don't write files
+      --dry-run           Verify changes without writing files
       --no-backup         Don't create backups
-  -w, --workdir <dir>     Working directory
+      --staged            Verify changes in a staging copy before writing
+      --sign-key <file>   Sign the provenance manifest (ed25519 PEM key)
+      --pipeline          Run implementer, reviewer and tester agents in sequence
+      --rounds <n>        Max review rounds in a pipeline (default: 2)
+      --role-model <r=m>  Model for a pipeline role (implementer, reviewer, tester)
+      --no-tests          Skip the tester role in a pipeline
+  -y, --yes               Add new dependencies without asking (unless vulnerable)
+      --no-deps           Don't check generated code for new dependencies
+  -w, --workdir <dir>     Working directory; repeat it to work across several roots
+      --workspace <file>  Take the roots from a YAML file (roots: [{path, name}])
+      --ssh <host:dir>    Work on a project on another machine over ssh, verifying it there
+      --watch             Keep running and update incrementally (index)
+  -c, --context <file>    Include a reference file (summarized when large)
+      --image <file>      Send an image (PNG, JPEG, GIF) to a vision model (repeatable)
+      --constraint <c>    Constrain the change: free text or a preset (repeatable):
+                          api-stable (checked on refactor), no-deps (checked),
+                          minimal-diff (checked)
+      --preserve-comments Restore comments and layout the model dropped (Go)
+      --graph <format>    Write the package dependency graph: dot or mermaid (deps)
+      --into <dir>        Package directory to extract into (extract)
+      --events ndjson     Stream progress events as JSON lines
+      --events-to <dst>   Event destination: a file, - (stdout) or fd:N (default: stderr)
+      --effective         Show the merged configuration and its sources (config show)
+      --local             Write .aidev.local.yaml instead of .aidev.yaml (config set)
+      --global            Write the global file instead of .aidev.yaml (config set)
+      --file <path>       Only operations touching path (history)
+      --grep <text>       Only operations matching text (history)
+  -n, --limit <n>         Max entries to list (history, cmdlog, default: 20),
+                          or days to report (usage, default: 30)
+      --attempt <n>       Attempt of the session to apply (salvage)
+      --files <p,...>     Only these files of the attempt (salvage, default: all)
+      --addr <host:port>  Listen address (serve, default: 127.0.0.1:8421)
+      --workers <n>       Jobs run at once (serve, default: 2)
+      --client-cap <n>    Jobs run at once per client (serve, default: 1)
+      --tokens <file>     Bearer tokens with workspace roots and access (serve)
+      --repo <url[@ref]>  Work on a remote repository in a cached shallow clone
+      --worktree          Write changes in a separate git worktree and branch
+      --diff              Review only the changes against --base (review)
+      --migrations        Review SQL migrations for data loss and locking; blocking findings fail (review)
+      --base <ref>        Base of the --diff review (default: HEAD)
+      --diagnostics <f>   Fix the errors in an LSP diagnostics export (fix)
+      --stash             Stash uncommitted edits to target files during the run
+      --read-only         Refuse every write to the project (explain, review, diagnose)
+      --run-tests         Run the affected tests, then the whole suite, before accepting a change
+      --mutate            Check new tests against mutants of the code and strengthen them (test)
+      --fix               Fix the implicated function after the triage (triage)
+      --push              Push the changes to a new branch (with --repo)
+      --pr                Also open a pull or merge request against ref (with --repo)
+      --webhook-repo <u>  Repository the CI webhook may fix (serve, repeatable, required)
+      --offline           Disable LLM calls; only local commands are available
+      --lang <code>       Output language: en or zh (default: from LANG)
+      --ascii             Plain-text markers instead of emoji (default: by terminal)
+
+Configuration:
+  ~/.aidev.yaml           Global defaults under .aidev.yaml, e.g. api_key_env, workdir
+  .aidev.local.yaml       Personal overrides of .aidev.yaml (uncommitted), e.g. api_key
+  .aidev.yaml             Project settings: model, model_for, routes, jwt, models, worktree,
+                          api_key_env, retries, timeout, ignore, backup, backup_keep,
+                          max_write_files, max_write_bytes, max_feedback_tokens,
+                          constraints (by command), max_diff_multiple, preserve_comments,
+                          provider_options, profiles, profile, tasks,
+                          spend_limit_daily, spend_limit_monthly,
+                          retention_max_age, retention_max_size, git_exclude,
+                          verify_pty, verify_stdin, run_tests, review_policy,
+                          migration_policy, openapi_spec, openapi_source,
+                          verify_matrix, cross_platforms, architecture, layering, refuse
 
 Environment:
-  GLM_API_KEY             API key (required for most commands)`)
+  GLM_API_KEY             API key (required for most commands)
+  AIDEV_OFFLINE=1         Same as --offline
+  AIDEV_WEBHOOK_SECRET    Enables the CI webhook (serve) and verifies its signatures
+  GITHUB_TOKEN            Pushes fix branches and opens pull requests (serve)
+  GITLAB_TOKEN            The same on GitLab, as merge requests
+  GITEA_TOKEN             The same on Gitea
+  AIDEV_FORGES            Self-hosted forges, e.g. gitlab=git.corp.com,gitea=code.corp.com
+  JIRA_URL                Jira site of --issue keys; JIRA_USER and JIRA_TOKEN sign in
+  AIDEV_TELEMETRY_URL     Reports usage statistics there daily, if on; kept local otherwise
+  DO_NOT_TRACK=1          Keeps telemetry off`))
+}
+
+// printIssues lists issues with their level, location and suggestion, the
+// first 20 unless verbose.
+func printIssues(issues []diagnose.Issue, verbose bool) {
+        for i, issue := range issues {
+                if i >= 20 && !verbose {
+                        fmt.Printf("    %s\n", trf("... and %d more issues", len(issues)-20))
+                        break
+                }
+
+                levelIcon := glyph("ℹ")
+                switch issue.Level {
+                case diagnose.LevelCritical:
+                        levelIcon = glyph("🔴")
+                case diagnose.LevelError:
+                        levelIcon = glyph("🟠")
+                case diagnose.LevelWarning:
+                        levelIcon = glyph("🟡")
+                }
+
+                if issue.File != "" {
+                        fmt.Printf("    %s [%s] %s:%d - %s\n", levelIcon, issue.Category, issue.File, issue.Line, issue.Title)
+                } else {
+                        fmt.Printf("    %s [%s] %s\n", levelIcon, issue.Category, issue.Title)
+                }
+                if verbose && issue.Description != "" {
+                        fmt.Printf("       %s\n", truncate(issue.Description, 100))
+                }
+                if issue.Suggestion != "" {
+                        fmt.Printf("       %s %s\n", glyph("💡"), issue.Suggestion)
+                }
+        }
 }
 
 func truncate(s string, max int) string {
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"ai-dev-agent/service/filesystem"
+	"ai-dev-agent/service/orchestrator"
+)
+
+// reviewLLM answers every prompt with a review whose suggestion carries
+// a whole replacement file, which a write mode would apply.
+type reviewLLM struct {
+	prompts []string
+}
+
+const reviewAnswer = `issue: main.go:4: the error from Close is dropped
+nitpick: main.go:1: the package comment is missing
+suggestion: main.go:3: return early
+
+--- FILE: main.go ---
+` + "```go" + `
+package main
+
+func main() {}
+` + "```\n"
+
+func (l *reviewLLM) Chat(ctx context.Context, messages []orchestrator.Message) (string, error) {
+	var b strings.Builder
+	for _, m := range messages {
+		b.WriteString(m.Content)
+		b.WriteString("\n")
+	}
+	l.prompts = append(l.prompts, b.String())
+	return reviewAnswer, nil
+}
+
+// newDispatchTest writes main.go to a temporary workspace and returns a
+// config for it with the file and prompt services run uses.
+func newDispatchTest(t *testing.T) (*Config, *services) {
+	t.Helper()
+	dir := t.TempDir()
+	main := "package main\n\nfunc main() {\n\tf.Close()\n}\n"
+	if err := os.WriteFile(filepath.Join(dir, "main.go"), []byte(main), 0644); err != nil {
+		t.Fatal(err)
+	}
+	config := &Config{WorkDir: dir, MaxRetries: 1}
+	mgr, err := filesystem.NewManager(filesystem.Config{RootDir: dir, BackupEnabled: true, ReadOnly: config.ReadOnly})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &services{
+		file:     &fileAdapter{mgr: mgr, rec: newRecorder(nil)},
+		prompt:   newPromptAdapter(""),
+		recorder: newRecorder(nil),
+	}
+	return config, s
+}
+
+func TestDispatchAnalysisWritesNothing(t *testing.T) {
+	for _, mode := range []string{"explain", "review"} {
+		t.Run(mode, func(t *testing.T) {
+			llm := &reviewLLM{}
+			config, s := newDispatchTest(t)
+			engine := orchestrator.NewEngine(s.file, s.prompt, llm, nil, engineConfig(config))
+			cmd := &Command{Type: mode, Files: []string{"main.go"}, Instruction: "check the error handling"}
+
+			result, err := dispatch(context.Background(), config, cmd, nil, nil, s, engine)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !result.Success {
+				t.Fatalf("%s failed: %v", mode, result.Error)
+			}
+			if len(result.FilesWritten) > 0 || len(s.recorder.written) > 0 {
+				t.Errorf("%s wrote %v", mode, result.FilesWritten)
+			}
+			got, err := os.ReadFile(filepath.Join(config.WorkDir, "main.go"))
+			if err != nil || !strings.Contains(string(got), "f.Close()") {
+				t.Errorf("main.go after %s = %q, %v; want it unchanged", mode, got, err)
+			}
+			if _, err := os.Stat(filepath.Join(config.WorkDir, ".ai-backup")); err == nil {
+				t.Errorf("%s created a backup", mode)
+			}
+			if result.Output != reviewAnswer {
+				t.Errorf("%s output = %q, want the model's answer", mode, result.Output)
+			}
+			if mode == "review" && len(result.Findings) != 3 {
+				t.Errorf("review findings = %+v, want the 3 of the answer", result.Findings)
+			}
+		})
+	}
+}
+
+func TestDispatchReviewPolicy(t *testing.T) {
+	llm := &reviewLLM{}
+	config, s := newDispatchTest(t)
+	config.Policy = orchestrator.ReviewPolicy{
+		{Match: "package comment", Severity: orchestrator.SeverityIgnore},
+		{Match: "error .* dropped", Severity: orchestrator.SeverityNonBlocking},
+		{Match: "return early", Severity: orchestrator.SeverityBlocking},
+	}
+	if err := config.Policy.Compile(); err != nil {
+		t.Fatal(err)
+	}
+	engine := orchestrator.NewEngine(s.file, s.prompt, llm, nil, engineConfig(config))
+	cmd := &Command{Type: "review", Files: []string{"main.go"}}
+
+	result, err := dispatch(context.Background(), config, cmd, nil, nil, s, engine)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !result.Success {
+		t.Fatalf("review failed: %v", result.Error)
+	}
+	if len(llm.prompts) != 1 || !strings.Contains(llm.prompts[0], config.Policy.Prompt()) {
+		t.Errorf("review prompt doesn't carry the policy %q", config.Policy.Prompt())
+	}
+	type finding struct {
+		label    string
+		blocking bool
+		line     int
+	}
+	var got []finding
+	for _, f := range result.Findings {
+		got = append(got, finding{f.Label, f.Blocking, f.Line})
+	}
+	want := []finding{
+		{orchestrator.LabelIssue, false, 4},
+		{orchestrator.LabelIssue, true, 3},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("findings = %+v, want %+v", got, want)
+	}
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"ai-dev-agent/service/migration"
+	"ai-dev-agent/service/orchestrator"
+)
+
+// runMigrationReview reviews database migrations for safety. The SQL
+// files are checked for destructive and locking operations by the rules
+// of the team's migration policy; the reviewer is given the migrations,
+// the policy and those findings to add what the checks can't see. Any
+// blocking finding fails the command, so that CI stops the migration.
+func runMigrationReview(ctx context.Context, config *Config, cmd *Command) error {
+	policy := &migration.Policy{}
+	if config.MigPolicy != "" {
+		path := config.MigPolicy
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(config.WorkDir, path)
+		}
+		var err error
+		if policy, err = migration.LoadPolicy(path); err != nil {
+			return fmt.Errorf("migration_policy: %w", err)
+		}
+	}
+
+	contents := make(map[string]string, len(cmd.Files))
+	var checked []orchestrator.Finding
+	size := 0
+	for _, path := range cmd.Files {
+		data, err := os.ReadFile(filepath.Join(config.WorkDir, path))
+		if err != nil {
+			return err
+		}
+		contents[path] = string(data)
+		size += len(data)
+		if strings.EqualFold(filepath.Ext(path), ".sql") {
+			checked = append(checked, migration.Check(path, string(data), policy)...)
+		}
+	}
+	if len(checked) > 0 {
+		fmt.Printf("%s %s\n", glyph("🔍"), trf("The migration checks found %d problem(s):", len(checked)))
+		for _, f := range checked {
+			fmt.Printf("  %s\n", formatFinding(f))
+		}
+		fmt.Println()
+	}
+
+	config.Model = config.router().Select(cmd.Type, size)
+	services, err := initServices(config)
+	if err != nil {
+		return fmt.Errorf("init services: %w", err)
+	}
+	defer services.recorder.close()
+	instruction := migrationInstruction(cmd, checked)
+	services.recorder.begin(cmd.Type, instruction, config.WorkDir, config.Model)
+
+	builder := services.prompt.SetMode("review").SetInstruction(instruction).AddConstraint(policy.Prompt())
+	if len(config.Policy) > 0 {
+		builder = builder.AddConstraint(config.Policy.Prompt())
+	}
+	for _, path := range cmd.Files {
+		builder = builder.AddFile(path, contents[path], true)
+	}
+	messages, err := builder.Build()
+	if err != nil {
+		return err
+	}
+
+	result := &orchestrator.Result{Attempts: 1}
+	result.Output, result.Error = services.llm.Chat(ctx, messages)
+	result.Success = result.Error == nil
+	services.recorder.finish(result)
+	if result.Error != nil {
+		return result.Error
+	}
+	fmt.Println(result.Output)
+	result.Findings = append(checked, config.Policy.Apply(orchestrator.ParseFindings(result.Output))...)
+	if config.EventLog != nil {
+		for i := range result.Findings {
+			config.EventLog.emit(orchestrator.Event{Type: orchestrator.EventFinding, Time: time.Now(), Finding: &result.Findings[i]})
+		}
+	}
+	printFindings(result.Findings)
+	if _, blocking := orchestrator.CountFindings(result.Findings); blocking > 0 {
+		return fmt.Errorf("%d blocking finding(s) in the migrations", blocking)
+	}
+	return nil
+}
+
+// Helper functions
+
+func migrationInstruction(cmd *Command, checked []orchestrator.Finding) string {
+	var b strings.Builder
+	b.WriteString("Review these database migrations for safety on a production database: data loss, long locks and table rewrites, changes the running release can't handle, backfills that should run in batches, foreign keys without indexes, and down migrations that can't restore the schema.")
+	if len(checked) > 0 {
+		b.WriteString(" Static checks already reported the findings below; don't repeat them, but add what they miss.")
+		for _, f := range checked {
+			fmt.Fprintf(&b, "\n- %s", formatFinding(f))
+		}
+	}
+	if cmd.Instruction != "" {
+		b.WriteString("\n\n" + cmd.Instruction)
+	}
+	return b.String()
+}
+
+// formatFinding writes a finding as a conventional comment.
+func formatFinding(f orchestrator.Finding) string {
+	label := f.Label
+	if len(f.Decorations) > 0 {
+		label += " (" + strings.Join(f.Decorations, ", ") + ")"
+	}
+	return fmt.Sprintf("%s: %s:%d: %s", label, f.File, f.Line, f.Subject)
+}
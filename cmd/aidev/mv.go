@@ -0,0 +1,285 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"ai-dev-agent/service/diagnose"
+	"ai-dev-agent/service/executor"
+	"ai-dev-agent/service/filesystem"
+	"ai-dev-agent/service/orchestrator"
+	"ai-dev-agent/service/refactor"
+)
+
+// runMove moves a file or a package, or renames a symbol, and updates
+// what refers to it. The change itself is mechanical; the LLM is only
+// asked to resolve the conflicts it reports and the build errors left
+// after it, unless offline.
+func runMove(ctx context.Context, config *Config, cmd *Command) error {
+	if len(cmd.Files) != 2 {
+		return fmt.Errorf("usage: aidev mv <file | dir | pkg.Symbol[.Member]> <destination | NewName>")
+	}
+	from, to := movePath(config, cmd.Files[0]), movePath(config, cmd.Files[1])
+	m, err := refactor.Load(config.WorkDir)
+	if err != nil {
+		return fmt.Errorf("mv: %w", err)
+	}
+
+	var result *refactor.Result
+	info, statErr := os.Stat(filepath.Join(config.WorkDir, filepath.FromSlash(from)))
+	switch {
+	case statErr == nil && info.IsDir():
+		result, err = m.MovePackage(from, to)
+	case statErr == nil:
+		result, err = m.MoveFile(from, to)
+	default:
+		dir, symbol := splitSymbol(cmd.Files[0])
+		newName := cmd.Files[1][strings.LastIndex(cmd.Files[1], ".")+1:]
+		result, err = m.Rename(dir, symbol, newName)
+	}
+	if err != nil {
+		return reportedError(fmt.Errorf("mv: %w", err))
+	}
+	if len(result.Changed()) == 0 {
+		fmt.Printf("%s %s\n", glyph("ℹ"), tr("Nothing to change."))
+		return nil
+	}
+
+	printRefactorPlan(result)
+	if config.DryRun {
+		return nil
+	}
+	if err := applyRefactor(config, result); err != nil {
+		return err
+	}
+	verification := verifyRefactor(ctx, config, false)
+	fmt.Printf("\n  %s %s\n", passMark(verification), verification.Summary())
+	if len(result.Conflicts) == 0 && verification.Passed() {
+		return nil
+	}
+	if config.Offline {
+		return fmt.Errorf("%d conflict(s) and %d build error(s) are left to resolve", len(result.Conflicts), len(verification.Issues))
+	}
+	return resolveMove(ctx, config, cmd, result, verification)
+}
+
+// movePath makes a path argument relative to the project.
+func movePath(config *Config, arg string) string {
+	if filepath.IsAbs(arg) {
+		if rel, err := filepath.Rel(config.WorkDir, arg); err == nil {
+			arg = rel
+		}
+	}
+	trailing := strings.HasSuffix(arg, "/")
+	arg = filepath.ToSlash(filepath.Clean(arg))
+	if trailing {
+		arg += "/"
+	}
+	return arg
+}
+
+// splitSymbol splits "service/store.Store.Open" into the package directory
+// "service/store" and the symbol "Store.Open". A symbol without a
+// directory is of the root package.
+func splitSymbol(arg string) (dir, symbol string) {
+	slash := strings.LastIndex(arg, "/")
+	if slash < 0 {
+		return ".", arg
+	}
+	elem, symbol, _ := strings.Cut(arg[slash+1:], ".")
+	return path.Join(arg[:slash], elem), symbol
+}
+
+func printRefactorPlan(result *refactor.Result) {
+	fmt.Printf("\n%s %s\n", glyph("🔧"), trf("%d file(s) to change, %d reference(s) updated", len(result.Changed()), result.References))
+	moved := make([]string, 0, len(result.Moves))
+	for from := range result.Moves {
+		moved = append(moved, from)
+	}
+	sort.Strings(moved)
+	for _, from := range moved {
+		fmt.Printf("   %s %s -> %s\n", glyph("📝"), from, result.Moves[from])
+	}
+	for _, file := range result.Changed() {
+		if _, ok := result.Files[file]; ok && !isMoveTarget(result, file) {
+			fmt.Printf("   %s %s\n", glyph("📝"), file)
+		}
+	}
+	if len(result.Conflicts) > 0 {
+		fmt.Printf("\n%s %s\n", glyph("⚠"), trf("%d conflict(s):", len(result.Conflicts)))
+		for _, c := range result.Conflicts {
+			fmt.Printf("   %s\n", c)
+		}
+	}
+}
+
+func isMoveTarget(result *refactor.Result, file string) bool {
+	for _, to := range result.Moves {
+		if to == file {
+			return true
+		}
+	}
+	return false
+}
+
+// applyRefactor writes a refactor result: edited files with a backup, then the moved
+// files at their new path, and removes what they left behind, including
+// emptied directories.
+func applyRefactor(config *Config, result *refactor.Result) error {
+	fileMgr, err := filesystem.NewManager(filesystem.Config{RootDir: config.WorkDir, BackupEnabled: !config.NoBackup, MaxBackups: config.BackupKeep, IgnorePatterns: config.Ignore})
+	if err != nil {
+		return fmt.Errorf("filesystem: %w", err)
+	}
+	root := fileMgr.GetRoot()
+	// Moves bypass the file manager, so their paths are checked against the
+	// root before anything is written.
+	type move struct{ from, src, dst string }
+	moves := make([]move, 0, len(result.Moves))
+	for from, to := range result.Moves {
+		src, err := fileMgr.Resolve(from)
+		if err != nil {
+			return fmt.Errorf("move %s: %w", from, err)
+		}
+		dst, err := fileMgr.Resolve(to)
+		if err != nil {
+			return fmt.Errorf("move %s to %s: %w", from, to, err)
+		}
+		moves = append(moves, move{from, src, dst})
+	}
+	for _, file := range result.Changed() {
+		content, edited := result.Files[file]
+		if !edited {
+			continue
+		}
+		if _, err := fileMgr.WriteFile(file, content, true); err != nil {
+			return fmt.Errorf("write %s: %w", file, err)
+		}
+	}
+	dirs := make(map[string]bool)
+	for _, mv := range moves {
+		if _, edited := result.Files[result.Moves[mv.from]]; edited {
+			err = os.Remove(mv.src)
+		} else if err = os.MkdirAll(filepath.Dir(mv.dst), 0755); err == nil {
+			err = os.Rename(mv.src, mv.dst)
+		}
+		if err != nil {
+			return fmt.Errorf("move %s: %w", mv.from, err)
+		}
+		for dir := filepath.Dir(mv.src); dir != root && len(dir) > len(root); dir = filepath.Dir(dir) {
+			dirs[dir] = true
+		}
+	}
+	emptied := make([]string, 0, len(dirs))
+	for dir := range dirs {
+		emptied = append(emptied, dir)
+	}
+	// Deepest first, so a parent is empty by the time it's removed.
+	sort.Slice(emptied, func(i, j int) bool { return len(emptied[i]) > len(emptied[j]) })
+	for _, dir := range emptied {
+		os.Remove(dir) // fails unless empty
+	}
+	return nil
+}
+
+// verifyRefactor builds the module and compiles its tests or, with
+// tests, runs them.
+func verifyRefactor(ctx context.Context, config *Config, tests bool) *diagnose.VerificationResult {
+	opts := verifyOptions(config)
+	exec := &execAdapter{exec: executor.NewExecutor(opts), opts: opts, rec: newRecorder(nil), root: config.WorkDir}
+	fmt.Printf("\n%s %s\n", glyph("🔍"), tr("Verifying the build..."))
+	v, err := exec.ExecuteInDir(ctx, config.WorkDir, "go", "build", "./...")
+	if err == nil && v.Passed() {
+		args := []string{"test", "-count=1", "./..."}
+		if !tests {
+			args = []string{"test", "-count=1", "-run", "^$", "./..."}
+		}
+		v, err = exec.ExecuteInDir(ctx, config.WorkDir, "go", args...)
+	}
+	if err != nil {
+		return &diagnose.VerificationResult{Command: "go build ./...", ExitCode: -1, Output: err.Error()}
+	}
+	return v
+}
+
+// resolveMove asks the LLM to fix the files of the conflicts and build
+// errors the mechanical change left.
+func resolveMove(ctx context.Context, config *Config, cmd *Command, result *refactor.Result, verification *diagnose.VerificationResult) error {
+	var files, problems []string
+	add := func(file string) {
+		if file = filepath.ToSlash(filepath.Clean(file)); !containsString(files, file) {
+			if _, err := os.Stat(filepath.Join(config.WorkDir, file)); err == nil {
+				files = append(files, file)
+			}
+		}
+	}
+	for _, c := range result.Conflicts {
+		file := c.File
+		if to, ok := result.Moves[file]; ok {
+			file = to
+		}
+		add(file)
+		problems = append(problems, "- "+c.String())
+	}
+	for _, issue := range verification.Issues {
+		if issue.File != "" {
+			add(issue.File)
+		}
+		problems = append(problems, "- "+issue.RawOutput)
+	}
+	if len(files) == 0 {
+		return fmt.Errorf("the build fails after the move: %w", verification.Err())
+	}
+
+	fmt.Printf("\n%s %s\n", glyph("🔧"), trf("Resolving %d problem(s) in %s", len(problems), strings.Join(files, ", ")))
+	instruction := fmt.Sprintf("`aidev mv %s` was applied mechanically. Resolve what it left broken without undoing it:\n%s",
+		strings.Join(cmd.Files, " "), strings.Join(problems, "\n"))
+	return finishRefactor(ctx, config, cmd, orchestrator.ModeFix, files, instruction)
+}
+
+// finishRefactor has the LLM complete a mechanical refactor already
+// applied: files are those it may change, instruction what's left to do.
+func finishRefactor(ctx context.Context, config *Config, cmd *Command, mode orchestrator.Mode, files []string, instruction string) error {
+	if config.APIKey == "" {
+		config.APIKey = os.Getenv("GLM_API_KEY")
+		if config.APIKey == "" {
+			config.APIKey = os.Getenv("ZHIPUAI_API_KEY")
+		}
+		if config.APIKey == "" {
+			return fmt.Errorf("%s needs the LLM to finish (set GLM_API_KEY, or run with --offline)", cmd.Type)
+		}
+	}
+	config.Model = config.router().Select(string(mode), inputSize(config.WorkDir, files))
+	services, err := initServices(config)
+	if err != nil {
+		return fmt.Errorf("init services: %w", err)
+	}
+	defer services.recorder.close()
+	services.recorder.begin(cmd.Type, instruction, config.WorkDir, config.Model)
+	engine := orchestrator.NewEngine(services.file, services.prompt, services.llm, services.exec, engineConfig(config))
+
+	res := engine.Execute(ctx, &orchestrator.Request{
+		Mode:        mode,
+		Files:       files,
+		Instruction: instruction,
+		WorkDir:     config.WorkDir,
+		Constraints: constraintsFor(config, cmd),
+	})
+	services.recorder.finish(res)
+	printResult(res, services.recorder, config.Verbose)
+	if !res.Success {
+		return res.Error
+	}
+	return nil
+}
+
+func passMark(v *diagnose.VerificationResult) string {
+	if v.Passed() {
+		return glyph("✅")
+	}
+	return glyph("❌")
+}
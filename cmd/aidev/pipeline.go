@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"ai-dev-agent/service/orchestrator"
+	"ai-dev-agent/service/vision"
+)
+
+// roleTasks maps pipeline roles to the routing task of their model.
+// The implementer uses the mode's model.
+var roleTasks = map[string]string{"implementer": "", "reviewer": "review", "tester": "test"}
+
+func runPipeline(ctx context.Context, config *Config, cmd *Command, images []*vision.Image, svc *services, engine *orchestrator.Engine) (*orchestrator.Result, error) {
+	pc := orchestrator.DefaultPipelineConfig()
+	if config.Rounds > 0 {
+		pc.MaxRounds = config.Rounds
+	}
+	if config.NoTests {
+		pc.Tester = nil
+	}
+
+	roles := map[string]*orchestrator.Role{"implementer": &pc.Implementer, "reviewer": &pc.Reviewer, "tester": pc.Tester}
+	for name := range config.RoleModels {
+		if _, ok := roleTasks[name]; !ok {
+			return nil, fmt.Errorf("unknown pipeline role: %s", name)
+		}
+	}
+	router := config.router()
+	for name, role := range roles {
+		model := config.RoleModels[name]
+		if model == "" && roleTasks[name] != "" {
+			model = router.Select(roleTasks[name], 0)
+		}
+		if role == nil || model == "" || model == config.Model {
+			continue
+		}
+		client, err := newLLMClient(config, model)
+		if err != nil {
+			return nil, fmt.Errorf("llm (%s): %w", name, err)
+		}
+		role.LLM = newLLMAdapter(config, client, svc.recorder, svc.llm.spend)
+	}
+
+	req := &orchestrator.Request{
+		Mode:        orchestrator.Mode(cmd.Type),
+		Files:       cmd.Files,
+		Context:     cmd.Context,
+		Instruction: cmd.Instruction,
+		WorkDir:     config.WorkDir,
+		Constraints: constraintsFor(config, cmd),
+		Images:      images,
+	}
+	result := engine.RunPipeline(ctx, req, pc)
+
+	if len(result.Reviews) > 0 {
+		fmt.Println("\n  Reviews:")
+		for _, r := range result.Reviews {
+			verdict := "✅ approved"
+			if !r.Approved {
+				verdict = "❌ rejected"
+			}
+			fmt.Printf("    round %d: %s\n", r.Round, verdict)
+			if !r.Approved && config.Verbose {
+				fmt.Printf("      %s\n", truncate(r.Feedback, 200))
+			}
+		}
+	}
+	return result.Result, nil
+}
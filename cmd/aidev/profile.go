@@ -0,0 +1,97 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Profile bundles settings selected together with --profile. Unset fields
+// leave the setting alone; flags given on the command line take
+// precedence.
+type Profile struct {
+	Model         string `yaml:"model"`
+	Retries       *int   `yaml:"retries"`
+	Timeout       string `yaml:"timeout"`
+	Pipeline      *bool  `yaml:"pipeline"` // implementer and reviewer agents
+	Rounds        *int   `yaml:"rounds"`
+	Tests         *bool  `yaml:"tests"` // tester agent in a pipeline
+	Staged        *bool  `yaml:"staged"`
+	Stream        *bool  `yaml:"stream"`
+	Deterministic *bool  `yaml:"deterministic"`
+}
+
+// builtinProfiles are available in every project; .aidev.yaml may
+// redefine them.
+var builtinProfiles = map[string]Profile{
+	"fast":    {Model: "glm-4-flash", Retries: intPtr(1), Pipeline: boolPtr(false)},
+	"careful": {Model: "glm-4-plus", Pipeline: boolPtr(true), Tests: boolPtr(true), Staged: boolPtr(true)},
+}
+
+// applyProfile applies the named profile, from the project's profiles or
+// the built-in ones. A profile's model is used as if given with --model.
+func applyProfile(config *Config, name string, profiles map[string]Profile) error {
+	p, ok := profiles[name]
+	if !ok {
+		if p, ok = builtinProfiles[name]; !ok {
+			return fmt.Errorf("unknown profile %q (available: %s)", name, strings.Join(profileNames(profiles), ", "))
+		}
+	}
+
+	given := config.Given
+	if p.Model != "" && !config.ModelSet {
+		config.Model = p.Model
+		config.ModelSet = true
+	}
+	if p.Retries != nil && !given["--retries"] {
+		config.MaxRetries = *p.Retries
+	}
+	if p.Timeout != "" && !given["--timeout"] {
+		d, err := time.ParseDuration(p.Timeout)
+		if err != nil {
+			return fmt.Errorf("profile %s: timeout: %w", name, err)
+		}
+		config.Timeout = d
+	}
+	if p.Pipeline != nil && !given["--pipeline"] {
+		config.Pipeline = *p.Pipeline
+	}
+	if p.Rounds != nil && !given["--rounds"] {
+		config.Rounds = *p.Rounds
+	}
+	if p.Tests != nil && !given["--no-tests"] {
+		config.NoTests = !*p.Tests
+	}
+	if p.Staged != nil && !given["--staged"] {
+		config.Staged = *p.Staged
+	}
+	if p.Stream != nil && !given["--stream"] && !given["--stream-idle"] {
+		config.Stream = *p.Stream
+	}
+	if p.Deterministic != nil && !given["--deterministic"] && !given["--seed"] {
+		config.Determ = *p.Deterministic
+	}
+	return nil
+}
+
+// profileNames lists the project's and built-in profile names.
+func profileNames(profiles map[string]Profile) []string {
+	var names []string
+	for name := range builtinProfiles {
+		if _, ok := profiles[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	for name := range profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Helper functions
+
+func intPtr(n int) *int { return &n }
+
+func boolPtr(b bool) *bool { return &b }
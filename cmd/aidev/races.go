@@ -0,0 +1,201 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"ai-dev-agent/service/errparse"
+	"ai-dev-agent/service/orchestrator"
+)
+
+// raceReportBytes is how much of a race report goes into the instruction.
+const raceReportBytes = 6000
+
+// runRaces runs the tests of cmd's packages (./... by default) under the
+// race detector and fixes each race it reports with the files of its
+// stacks, then runs the detector again to confirm. Races that remain are
+// retried, with a note that the last fix didn't remove them, until the
+// detector is quiet or the retry budget is spent.
+func runRaces(ctx context.Context, config *Config, cmd *Command, svc *services, engine *orchestrator.Engine) (*orchestrator.Result, error) {
+	start := time.Now()
+	patterns := cmd.Files
+	if len(patterns) == 0 {
+		patterns = []string{"./..."}
+	}
+	total := &orchestrator.Result{}
+	tried := make(map[string]int)
+	for round := 1; round <= config.MaxRetries+1; round++ {
+		fmt.Printf("%s %s\n", glyph("🔍"), trf("Running the tests under the race detector (%s)...", strings.Join(patterns, " ")))
+		args := append([]string{"test", "-race", "-count=1"}, patterns...)
+		verification, err := svc.exec.ExecuteInDir(ctx, config.WorkDir, "go", args...)
+		if verification == nil {
+			return nil, fmt.Errorf("go test -race: %w", err)
+		}
+		total.Verifications = append(total.Verifications, verification)
+		races := distinctRaces(errparse.ParseRaces(verification.Output))
+		if len(races) == 0 {
+			if !verification.Passed() {
+				return failed(total, fmt.Errorf("tests failed without a race report: %s", firstFailure(verification.Output))), nil
+			}
+			fmt.Printf("%s %s\n", glyph("✅"), tr("No data races found."))
+			total.Success = true
+			total.Duration = time.Since(start)
+			return total, nil
+		}
+		if round > config.MaxRetries {
+			total.Duration = time.Since(start)
+			return failed(total, fmt.Errorf("%d data race(s) remain after %d round(s) of fixes", len(races), config.MaxRetries)), nil
+		}
+		fmt.Printf("%s %s\n", glyph("⚠"), trf("%d data race(s) found", len(races)))
+
+		for _, race := range races {
+			files := raceFiles(race, config.WorkDir)
+			where := raceLocation(race, config.WorkDir)
+			if len(files) == 0 {
+				fmt.Printf("  %s\n", trf("Skipping the race at %s: its stacks are outside the project", where))
+				continue
+			}
+			fmt.Printf("%s %s\n", glyph("🔧"), trf("Fixing the race at %s (%s)", where, strings.Join(files, ", ")))
+			result := engine.Execute(ctx, &orchestrator.Request{
+				Mode:        orchestrator.ModeFix,
+				Files:       files,
+				Instruction: raceInstruction(cmd, race, config.WorkDir, tried[race.Key()]),
+				WorkDir:     config.WorkDir,
+				Constraints: constraintsFor(config, cmd),
+			})
+			tried[race.Key()]++
+			accumulate(total, result)
+			if !result.Success {
+				fmt.Printf("  %s %s\n", glyph("❌"), trf("No fix for the race at %s: %v", where, result.Error))
+			}
+		}
+	}
+	return total, nil
+}
+
+// Helper functions
+
+// accumulate adds the result of one run of a command that runs the engine
+// several times to the command's total, numbering its attempts on from
+// the total's.
+func accumulate(total, result *orchestrator.Result) {
+	for _, h := range result.History {
+		h.Attempt += total.Attempts
+		total.History = append(total.History, h)
+	}
+	total.Attempts += result.Attempts
+	total.Verifications = append(total.Verifications, result.Verifications...)
+	for _, path := range result.FilesWritten {
+		if !containsString(total.FilesWritten, path) {
+			total.FilesWritten = append(total.FilesWritten, path)
+		}
+	}
+	for path, content := range result.Candidates {
+		if total.Candidates == nil {
+			total.Candidates = make(map[string]string)
+		}
+		total.Candidates[path] = content
+	}
+}
+
+// distinctRaces drops reports of a race already reported, such as by
+// another test.
+func distinctRaces(races []errparse.Race) []errparse.Race {
+	seen := make(map[string]bool)
+	var distinct []errparse.Race
+	for _, r := range races {
+		if !seen[r.Key()] {
+			seen[r.Key()] = true
+			distinct = append(distinct, r)
+		}
+	}
+	return distinct
+}
+
+// raceFiles returns the project files of a race's stacks, relative to
+// workDir, code before tests.
+func raceFiles(race errparse.Race, workDir string) []string {
+	var code, tests []string
+	for _, path := range race.Files() {
+		rel, ok := projectPath(path, workDir)
+		if !ok {
+			continue
+		}
+		if strings.HasSuffix(rel, "_test.go") {
+			tests = append(tests, rel)
+		} else {
+			code = append(code, rel)
+		}
+	}
+	return append(code, tests...)
+}
+
+// raceLocation names the first access of a race.
+func raceLocation(race errparse.Race, workDir string) string {
+	frames := race.Accesses
+	if len(frames) == 0 {
+		frames = race.Frames
+	}
+	if len(frames) == 0 {
+		return "?"
+	}
+	path, ok := projectPath(frames[0].File, workDir)
+	if !ok {
+		path = frames[0].File
+	}
+	return fmt.Sprintf("%s:%d", path, frames[0].Line)
+}
+
+func raceInstruction(cmd *Command, race errparse.Race, workDir string, tries int) string {
+	var b strings.Builder
+	b.WriteString("Fix this data race reported by the Go race detector")
+	if race.Test != "" {
+		fmt.Fprintf(&b, " in %s", race.Test)
+	}
+	b.WriteString(". Synchronize the conflicting accesses (a mutex, atomics or a channel, whichever fits the code) rather than removing the concurrency, and change the tests only if the race is in the test itself.")
+	if tries > 0 {
+		fmt.Fprintf(&b, "\nThe race detector still reports this race after %d earlier fix(es); the accesses are not synchronized yet.", tries)
+	}
+	report := race.Report
+	if abs, err := filepath.Abs(workDir); err == nil {
+		report = strings.ReplaceAll(report, abs+string(filepath.Separator), "")
+	}
+	fmt.Fprintf(&b, "\n\n%s", errparse.Condense(report, raceReportBytes))
+	if cmd.Instruction != "" {
+		b.WriteString("\n\n" + cmd.Instruction)
+	}
+	return b.String()
+}
+
+// projectPath returns path relative to workDir when it is a file of the
+// project.
+func projectPath(path, workDir string) (string, bool) {
+	abs, err := filepath.Abs(workDir)
+	if err != nil {
+		return "", false
+	}
+	rel, err := filepath.Rel(abs, path)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", false
+	}
+	if _, err := os.Stat(filepath.Join(abs, rel)); err != nil {
+		return "", false
+	}
+	return filepath.ToSlash(rel), true
+}
+
+// firstFailure returns the first line of test output that reports a
+// failure, or the first line.
+func firstFailure(output string) string {
+	lines := strings.Split(strings.TrimSpace(output), "\n")
+	for _, line := range lines {
+		if strings.Contains(line, "FAIL") || strings.Contains(line, "panic:") {
+			return strings.TrimSpace(line)
+		}
+	}
+	return lines[0]
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"ai-dev-agent/service/gitrepo"
+	"ai-dev-agent/service/orchestrator"
+)
+
+// remoteRepo is a remote project checked out in the repo cache.
+type remoteRepo struct {
+	url string
+	ref string
+	dir string
+	git *gitrepo.Client
+}
+
+// validateRemote checks the --repo, --push and --pr combination.
+func validateRemote(config *Config) error {
+	if config.Repo == "" {
+		if config.Push || config.PR {
+			return fmt.Errorf("--push and --pr need --repo")
+		}
+		return nil
+	}
+	if config.Offline {
+		return fmt.Errorf("--repo needs network access and is unavailable offline")
+	}
+	if _, ref := gitrepo.ParseSpec(config.Repo); config.PR && ref == "" {
+		return fmt.Errorf("--pr needs the base branch: --repo <url>@<branch>")
+	}
+	return nil
+}
+
+// fetchRemote syncs the --repo checkout in the cache and makes it the
+// workdir, with the remote project's own .aidev.yaml applied.
+func fetchRemote(ctx context.Context, config *Config) (*remoteRepo, error) {
+	url, ref := gitrepo.ParseSpec(config.Repo)
+	cache, err := os.UserCacheDir()
+	if err != nil {
+		return nil, fmt.Errorf("repo cache: %w", err)
+	}
+	r := &remoteRepo{
+		url: url,
+		ref: ref,
+		dir: gitrepo.CacheDir(filepath.Join(cache, "aidev", "repos"), url),
+		git: gitrepo.NewClient(gitrepo.DefaultConfig()),
+	}
+
+	fmt.Printf("📦 Fetching %s\n", config.Repo)
+	// History and backups in the cache outlive each sync.
+	if err := r.git.Sync(ctx, url, ref, r.dir, stateDir, ".ai-backup"); err != nil {
+		return nil, fmt.Errorf("fetch %s: %w", config.Repo, err)
+	}
+	if config.Verbose {
+		fmt.Printf("  Checkout: %s\n", r.dir)
+	}
+	config.WorkDir = r.dir
+
+	pc, err := loadProjectConfig(r.dir)
+	if err != nil {
+		return nil, reportedError(err)
+	}
+	if err := applyProjectConfig(config, pc); err != nil {
+		return nil, reportedError(err)
+	}
+	return r, nil
+}
+
+// publish commits the written files to a new branch and, as requested,
+// pushes it and opens a pull request.
+func (r *remoteRepo) publish(ctx context.Context, config *Config, cmd *Command, result *orchestrator.Result) error {
+	if !config.Push && !config.PR {
+		if len(result.FilesWritten) > 0 {
+			fmt.Printf("ℹ Changes are in %s (use --push or --pr to publish them)\n", r.dir)
+		}
+		return nil
+	}
+	if config.DryRun || len(result.FilesWritten) == 0 {
+		fmt.Println("ℹ No changes to publish")
+		return nil
+	}
+
+	branch := fmt.Sprintf("aidev/%s-%s", cmd.Type, time.Now().Format("20060102-150405"))
+	title := strings.SplitN(strings.TrimSpace(cmd.Instruction), "\n", 2)[0]
+	if title == "" {
+		title = fmt.Sprintf("%s %s", cmd.Type, strings.Join(cmd.Files, ", "))
+	}
+	if err := r.git.Commit(ctx, r.dir, branch, title, result.FilesWritten); err != nil {
+		return err
+	}
+	if err := r.git.Push(ctx, r.dir, branch); err != nil {
+		return err
+	}
+	fmt.Printf("🚀 Pushed %s\n", branch)
+	if !config.PR {
+		return nil
+	}
+
+	url, err := r.git.OpenPullRequest(ctx, gitrepo.PullRequest{
+		Remote: r.url,
+		Head:   branch,
+		Base:   r.ref,
+		Title:  title,
+		Body:   publishBody(cmd, result),
+	})
+	if err != nil {
+		return err
+	}
+	fmt.Printf("🔗 %s\n", url)
+	return nil
+}
+
+// publishBody is the description of the pull request of a run.
+func publishBody(cmd *Command, result *orchestrator.Result) string {
+	body := fmt.Sprintf("Generated by `aidev %s`.\n\nFiles changed:\n- %s", cmd.Type, strings.Join(result.FilesWritten, "\n- "))
+	if link := issueLink(cmd); link != "" {
+		body = link + "\n\n" + body
+	}
+	return body
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"ai-dev-agent/service/diff"
+)
+
+// runReplay re-sends the requests recorded by a --deterministic run and
+// compares the responses with the recorded ones.
+func runReplay(ctx context.Context, config *Config, cmd *Command) error {
+	st, err := openStore(config.WorkDir)
+	if err != nil {
+		return fmt.Errorf("state: %w", err)
+	}
+	defer st.Close()
+
+	sess, err := st.GetSession(cmd.Files[0])
+	if err != nil {
+		return fmt.Errorf("session %s: %w", cmd.Files[0], err)
+	}
+	requests, err := st.SessionRequests(sess.ID)
+	if err != nil {
+		return fmt.Errorf("session requests: %w", err)
+	}
+	if len(requests) == 0 {
+		return fmt.Errorf("session %s has no recorded requests (run with --deterministic to record them)", sess.ID)
+	}
+
+	fmt.Printf("%s\n", trf("Replaying %d request(s) of session %s (%s)", len(requests), sess.ID, sess.Mode))
+	identical := 0
+	for i, r := range requests {
+		client, err := newLLMClient(config, r.Model)
+		if err != nil {
+			return err
+		}
+		resp, err := client.Replay(ctx, []byte(r.Body))
+		if err != nil {
+			return fmt.Errorf("request %d: %w", i+1, err)
+		}
+		if len(resp.Choices) == 0 {
+			return fmt.Errorf("request %d: no choices in response", i+1)
+		}
+		response := resp.Choices[0].Message.Content
+
+		fmt.Printf("  %d/%d  %s  seed %d  prompt %.12s  ", i+1, len(requests), r.Model, r.Seed, r.PromptHash)
+		if response == r.Response {
+			identical++
+			fmt.Printf("%s %s\n", glyph("✅"), tr("identical"))
+			continue
+		}
+		stats := diff.Count(r.Response, response)
+		fmt.Printf("%s %s\n", glyph("⚠"), trf("differs (+%d -%d lines)", stats.Added, stats.Removed))
+		if config.Verbose {
+			fmt.Print(diff.Unified("response", r.Response, response, 3))
+		}
+	}
+	fmt.Printf("\n%s\n", trf("%d of %d response(s) identical", identical, len(requests)))
+	return nil
+}
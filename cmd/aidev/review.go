@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"ai-dev-agent/service/gitrepo"
+	"ai-dev-agent/service/orchestrator"
+)
+
+// diffContextLines is how much unchanged code surrounds each reviewed hunk.
+const diffContextLines = 10
+
+var diffFilePattern = regexp.MustCompile(`(?m)^\+\+\+ b/(.+)$`)
+
+// runDiffReview reviews only the changes against --base instead of whole
+// files. Changed files are summarized from the workspace index (package and
+// imports), so the model sees their surroundings without their full text.
+func runDiffReview(ctx context.Context, config *Config, cmd *Command) error {
+	base := config.Base
+	if base == "" {
+		base = "HEAD"
+	}
+	patch, err := gitrepo.NewClient(gitrepo.Config{}).Diff(ctx, config.WorkDir, base, diffContextLines, cmd.Files)
+	if err != nil {
+		return fmt.Errorf("diff: %w", err)
+	}
+	if strings.TrimSpace(patch) == "" {
+		fmt.Printf("No changes against %s.\n", base)
+		return nil
+	}
+
+	config.Model = config.router().Select(cmd.Type, len(patch))
+	services, err := initServices(config)
+	if err != nil {
+		return fmt.Errorf("init services: %w", err)
+	}
+	defer services.recorder.close()
+	instruction := cmd.Instruction
+	if instruction == "" {
+		instruction = fmt.Sprintf("Review the changes against %s. Point out bugs, risky changes and missing tests, citing file and line.", base)
+	}
+	services.recorder.begin(cmd.Type, instruction, config.WorkDir, config.Model)
+
+	builder := services.prompt.SetMode("review").SetInstruction(instruction).AddFile("changes.diff", patch, true)
+	if len(config.Policy) > 0 {
+		builder = builder.AddConstraint(config.Policy.Prompt())
+	}
+	if summary := indexSummary(services, diffFilePattern.FindAllStringSubmatch(patch, -1)); summary != "" {
+		builder = builder.AddFile("changed-files.txt", summary, false)
+	}
+	messages, err := builder.Build()
+	if err != nil {
+		return err
+	}
+	if config.Verbose {
+		fmt.Printf("  Reviewing %d bytes of diff against %s\n", len(patch), base)
+	}
+
+	result := &orchestrator.Result{Attempts: 1}
+	result.Output, result.Error = services.llm.Chat(ctx, messages)
+	result.Success = result.Error == nil
+	services.recorder.finish(result)
+	if result.Error != nil {
+		return result.Error
+	}
+	fmt.Println(result.Output)
+	result.Findings = config.Policy.Apply(orchestrator.ParseFindings(result.Output))
+	if config.EventLog != nil {
+		for i := range result.Findings {
+			config.EventLog.emit(orchestrator.Event{Type: orchestrator.EventFinding, Time: time.Now(), Finding: &result.Findings[i]})
+		}
+	}
+	printFindings(result.Findings)
+	return nil
+}
+
+// printFindings tallies the findings of a review by label.
+func printFindings(findings []orchestrator.Finding) {
+	if len(findings) == 0 {
+		return
+	}
+	byLabel, blocking := orchestrator.CountFindings(findings)
+	var counts []string
+	for _, label := range orchestrator.Labels {
+		if n := byLabel[label]; n > 0 {
+			counts = append(counts, fmt.Sprintf("%d %s", n, label))
+		}
+	}
+	fmt.Printf("\n%s\n", trf("Findings: %d blocking (%s)", blocking, strings.Join(counts, ", ")))
+}
+
+// indexSummary describes the changed files from the workspace index.
+func indexSummary(svc *services, matches [][]string) string {
+	if svc.recorder.store == nil {
+		return ""
+	}
+	entries, err := svc.recorder.store.LoadIndex()
+	if err != nil || len(entries) == 0 {
+		return ""
+	}
+	var sb strings.Builder
+	for _, m := range matches {
+		for _, e := range entries {
+			if e.Path != m[1] || e.Package == "" {
+				continue
+			}
+			fmt.Fprintf(&sb, "%s: package %s", e.Path, e.Package)
+			if len(e.Imports) > 0 {
+				fmt.Fprintf(&sb, "; imports %s", strings.Join(e.Imports, ", "))
+			}
+			sb.WriteString("\n")
+		}
+	}
+	return sb.String()
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"ai-dev-agent/service/diff"
+	"ai-dev-agent/service/filesystem"
+	"ai-dev-agent/service/gitrepo"
+	"ai-dev-agent/service/store"
+)
+
+// salvaged is a file of an attempt merged onto the current tree.
+type salvaged struct {
+	path     string
+	current  string
+	content  string
+	merged   bool // with edits made since the session
+	conflict bool
+}
+
+// runSalvage applies files of one attempt of a session onto the tree. A
+// file still as the session left it, or as it was before, is replaced;
+// edits made to it since are merged with the attempt's version relative to
+// what the session left, and clashing hunks are left between conflict
+// markers. Files are written with a backup.
+func runSalvage(ctx context.Context, config *Config, cmd *Command) error {
+	st, err := openStore(config.WorkDir)
+	if err != nil {
+		return fmt.Errorf("state: %w", err)
+	}
+	defer st.Close()
+
+	sess, err := st.GetSession(cmd.Files[0])
+	if err != nil {
+		return fmt.Errorf("session %s: %w", cmd.Files[0], err)
+	}
+	attempt, err := findAttempt(st, sess.ID, cmd.Attempt)
+	if err != nil {
+		return err
+	}
+	paths, err := salvagePaths(config, attempt, cmd.Pick)
+	if err != nil {
+		return err
+	}
+	files, err := st.SessionFiles(sess.ID)
+	if err != nil {
+		return fmt.Errorf("session files: %w", err)
+	}
+	recorded := make(map[string]store.SessionFile, len(files))
+	for _, f := range files {
+		recorded[filepath.ToSlash(f.Path)] = f
+	}
+
+	var plan []salvaged
+	for _, p := range paths {
+		s, err := salvageFile(ctx, config, sess.ID, attempt, p, recorded)
+		if err != nil {
+			return fmt.Errorf("%s: %w", p, err)
+		}
+		plan = append(plan, s)
+	}
+
+	fmt.Printf("\n%s %s\n", glyph("🔧"), trf("Attempt %d of %s:", attempt.Attempt, sess.ID))
+	var conflicts []string
+	for _, s := range plan {
+		switch {
+		case s.content == s.current:
+			fmt.Printf("   %s %s\n", glyph("ℹ"), trf("%s: already applied", s.path))
+		case s.conflict:
+			fmt.Printf("   %s %s\n", glyph("⚠"), trf("%s: conflicts with edits made since", s.path))
+			conflicts = append(conflicts, s.path)
+		case s.merged:
+			fmt.Printf("   %s %s\n", glyph("📝"), trf("%s: merged with edits made since", s.path))
+		default:
+			fmt.Printf("   %s %s\n", glyph("📝"), s.path)
+		}
+	}
+	if config.DryRun {
+		fmt.Println()
+		for _, s := range plan {
+			fmt.Print(diff.Unified(s.path, s.current, s.content, 3))
+		}
+		return nil
+	}
+
+	fileMgr, err := filesystem.NewManager(filesystem.Config{RootDir: config.WorkDir, BackupEnabled: !config.NoBackup, MaxBackups: config.BackupKeep, IgnorePatterns: config.Ignore})
+	if err != nil {
+		return fmt.Errorf("filesystem: %w", err)
+	}
+	for _, s := range plan {
+		if s.content == s.current {
+			continue
+		}
+		if _, err := fileMgr.WriteFile(s.path, s.content, true); err != nil {
+			return fmt.Errorf("write %s: %w", s.path, err)
+		}
+	}
+	if len(conflicts) > 0 {
+		return fmt.Errorf("%d file(s) left with conflict markers: %s", len(conflicts), strings.Join(conflicts, ", "))
+	}
+	return nil
+}
+
+// findAttempt returns attempt n of a session.
+func findAttempt(st *store.Store, sessionID string, n int) (*store.Attempt, error) {
+	attempts, err := st.Attempts(sessionID)
+	if err != nil {
+		return nil, fmt.Errorf("attempts: %w", err)
+	}
+	for i := range attempts {
+		if attempts[i].Attempt == n {
+			if len(attempts[i].Files) == 0 {
+				return nil, fmt.Errorf("attempt %d of %s failed at %s before writing anything", n, sessionID, attempts[i].Stage)
+			}
+			return &attempts[i], nil
+		}
+	}
+	if len(attempts) == 0 {
+		return nil, fmt.Errorf("session %s has no recorded attempts", sessionID)
+	}
+	return nil, fmt.Errorf("session %s has no attempt %d (see aidev attempts %s)", sessionID, n, sessionID)
+}
+
+// salvagePaths returns the files of the attempt picked, or all of them.
+func salvagePaths(config *Config, attempt *store.Attempt, pick []string) ([]string, error) {
+	byPath := make(map[string]string, len(attempt.Files))
+	all := make([]string, 0, len(attempt.Files))
+	for p := range attempt.Files {
+		byPath[filepath.ToSlash(filepath.Clean(p))] = p
+		all = append(all, p)
+	}
+	sort.Strings(all)
+	if len(pick) == 0 {
+		return all, nil
+	}
+	var paths []string
+	for _, arg := range pick {
+		p, ok := byPath[movePath(config, arg)]
+		if !ok {
+			return nil, fmt.Errorf("attempt %d didn't write %s (it wrote %s)", attempt.Attempt, arg, strings.Join(all, ", "))
+		}
+		if !containsString(paths, p) {
+			paths = append(paths, p)
+		}
+	}
+	return paths, nil
+}
+
+// salvageFile merges the attempt's version of a file onto the tree's.
+func salvageFile(ctx context.Context, config *Config, sessionID string, attempt *store.Attempt, path string, recorded map[string]store.SessionFile) (salvaged, error) {
+	s := salvaged{path: path, content: attempt.Files[path]}
+	data, err := os.ReadFile(filepath.Join(config.WorkDir, path))
+	if err != nil && !os.IsNotExist(err) {
+		return s, err
+	}
+	s.current = string(data)
+
+	// A file the session never wrote has nothing to merge against.
+	f, ok := recorded[filepath.ToSlash(path)]
+	if !ok || s.current == f.After || s.current == f.Before {
+		return s, nil
+	}
+	names := [3]string{"current", "session " + sessionID, fmt.Sprintf("attempt %d", attempt.Attempt)}
+	s.content, s.conflict, err = gitrepo.Merge(ctx, s.current, f.After, s.content, names)
+	s.merged = true
+	return s, err
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"runtime/debug"
+
+	"ai-dev-agent/service/llm"
+	"ai-dev-agent/service/orchestrator"
+	"ai-dev-agent/service/server"
+)
+
+func runServe(ctx context.Context, config *Config, cmd *Command) error {
+	sc := server.DefaultConfig()
+	if config.Addr != "" {
+		sc.Addr = config.Addr
+	}
+	if config.Workers > 0 {
+		sc.Queue.Workers = config.Workers
+	}
+	if config.ClientCap > 0 {
+		sc.Queue.ClientCap = config.ClientCap
+	}
+	sc.Root = config.WorkDir
+	if config.Tokens != "" {
+		tokens, err := server.LoadTokens(config.Tokens)
+		if err != nil {
+			return fmt.Errorf("load tokens: %w", err)
+		}
+		sc.Tokens = tokens
+	}
+	sc.Webhook.Secret = os.Getenv("AIDEV_WEBHOOK_SECRET")
+	sc.Webhook.Repos = config.HookRepos
+	sc.Info = serverInfo(config)
+
+	srv := server.New(sc, func(ctx context.Context, job *server.Job) (result *orchestrator.Result) {
+		// A job that panics fails alone instead of taking the server down.
+		defer func() {
+			if p := recover(); p != nil {
+				reportCrash(config, cmd, crash{panicked: p, stack: debug.Stack()})
+				result = &orchestrator.Result{Error: fmt.Errorf("job %s panicked: %v", job.ID, p)}
+			}
+		}()
+		return runJob(ctx, config, job)
+	})
+	fmt.Printf("🚀 Serving on http://%s (workers %d, per-client cap %d)\n", sc.Addr, sc.Queue.Workers, sc.Queue.ClientCap)
+	if len(sc.Tokens) == 0 {
+		fmt.Printf("⚠ No --tokens file: every client gets read-write access to %s\n", sc.Root)
+	}
+	if sc.Webhook.Secret != "" {
+		fmt.Printf("🔔 CI webhook on http://%s/v1/webhooks/ci\n", sc.Addr)
+		if len(sc.Webhook.Repos) == 0 {
+			fmt.Println("⚠ No --webhook-repo: the CI webhook refuses every delivery")
+		}
+	}
+	return srv.ListenAndServe(ctx)
+}
+
+// serverInfo is what the server reports of itself: the version, the
+// models jobs may be routed to and the limits of a job's attempts.
+func serverInfo(config *Config) server.Info {
+	var models []string
+	for _, m := range usedModels(config) {
+		if !containsString(models, m.name) {
+			models = append(models, m.name)
+		}
+	}
+	limits := server.Limits{
+		MaxRetries:    config.MaxRetries,
+		Timeout:       config.Timeout.String(),
+		MaxWriteFiles: config.MaxFiles,
+		MaxWriteBytes: config.MaxBytes,
+	}
+	if limits.MaxWriteFiles == 0 {
+		limits.MaxWriteFiles = orchestrator.DefaultMaxWriteFiles
+	}
+	if limits.MaxWriteBytes == 0 {
+		limits.MaxWriteBytes = orchestrator.DefaultMaxWriteBytes
+	}
+	if m, ok := llm.LookupModel(config.Model); ok {
+		limits.ContextWindow = m.ContextWindow
+	}
+	return server.Info{
+		Version:   Version,
+		Providers: []server.Provider{{Name: "glm", Models: models}},
+		Limits:    limits,
+	}
+}
+
+// runJob executes one queued request with its own services, so jobs never
+// share prompt or recorder state.
+func runJob(ctx context.Context, config *Config, job *server.Job) *orchestrator.Result {
+	if job.CI != nil {
+		return runCIFix(ctx, config, job)
+	}
+	jc := *config
+	// Jobs can't answer prompts; new dependencies are left to the build
+	// feedback loop.
+	jc.NoDeps = true
+	jc.VerifyIn = false
+	// The server has already scoped the workdir to the token's root.
+	req := job.Request
+	jc.WorkDir = req.WorkDir
+	jc.ReadOnly = job.ReadOnly
+
+	fmt.Printf("▶ %s (%s, %s) %s %v\n", job.ID, job.Client, job.Priority, req.Mode, req.Files)
+	result := executeJob(ctx, &jc, req)
+	printFinished(job, result)
+	return result
+}
+
+// executeJob runs req in jc.WorkDir with the model routed for it.
+func executeJob(ctx context.Context, jc *Config, req orchestrator.Request) *orchestrator.Result {
+	jc.Model = jc.router().Select(string(req.Mode), inputSize(jc.WorkDir, req.Files))
+	svc, err := initServices(jc)
+	if err != nil {
+		return &orchestrator.Result{Error: fmt.Errorf("init services: %w", err)}
+	}
+	defer svc.recorder.close()
+	svc.recorder.begin(string(req.Mode), req.Instruction, jc.WorkDir, jc.Model)
+
+	ec := engineConfig(jc)
+	if len(req.Context) > 0 {
+		ec.Compress, err = contextCompressor(jc, svc)
+		if err != nil {
+			return &orchestrator.Result{Error: err}
+		}
+	}
+	engine := orchestrator.NewEngine(svc.file, svc.prompt, svc.llm, svc.exec, ec)
+	result := engine.Execute(ctx, &req)
+	svc.recorder.finish(result)
+	return result
+}
+
+func printFinished(job *server.Job, result *orchestrator.Result) {
+	status := "✅"
+	if !result.Success {
+		status = "❌"
+	}
+	fmt.Printf("%s %s finished in %v\n", status, job.ID, result.Duration)
+	if result.Error != nil {
+		fmt.Printf("  %v\n", result.Error)
+	}
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// spinnerFrames animate the status line; asciiSpinnerFrames replace them
+// in ASCII mode.
+var (
+	spinnerFrames      = []string{"⠋", "⠙", "⠹", "⠸", "⠼", "⠴", "⠦", "⠧", "⠇", "⠏"}
+	asciiSpinnerFrames = []string{"|", "/", "-", "\\"}
+)
+
+// spinner redraws one status line while a long step runs. It draws
+// nothing unless stdout is a terminal, so logs and pipes stay clean.
+type spinner struct {
+	mu     sync.Mutex
+	status string
+	width  int // of the last line drawn
+	stopc  chan struct{}
+	done   chan struct{}
+}
+
+// startSpinner shows status until stop is called.
+func startSpinner(status string) *spinner {
+	s := &spinner{status: status}
+	if !stdoutIsTerminal() {
+		return s
+	}
+	s.stopc, s.done = make(chan struct{}), make(chan struct{})
+	go s.run()
+	return s
+}
+
+// update replaces the status shown.
+func (s *spinner) update(status string) {
+	s.mu.Lock()
+	s.status = status
+	s.mu.Unlock()
+}
+
+// stop clears the status line.
+func (s *spinner) stop() {
+	if s.stopc == nil {
+		return
+	}
+	close(s.stopc)
+	<-s.done
+	s.stopc = nil
+}
+
+func (s *spinner) run() {
+	defer close(s.done)
+	frames := spinnerFrames
+	if ascii {
+		frames = asciiSpinnerFrames
+	}
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+	for i := 0; ; i++ {
+		s.mu.Lock()
+		line := fmt.Sprintf("   %s %s", frames[i%len(frames)], s.status)
+		s.mu.Unlock()
+		s.draw(line)
+		select {
+		case <-s.stopc:
+			s.draw("")
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// draw overwrites the status line with line.
+func (s *spinner) draw(line string) {
+	pad := s.width - len([]rune(line))
+	if pad < 0 {
+		pad = 0
+	}
+	fmt.Print("\r" + line + strings.Repeat(" ", pad) + "\r")
+	s.width = len([]rune(line))
+}
+
+// Helper functions
+
+func stdoutIsTerminal() bool {
+	fi, err := os.Stdout.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice != 0
+}
+
+// stdinIsTerminal also rules out /dev/null, a character device too.
+func stdinIsTerminal() bool {
+	fi, err := os.Stdin.Stat()
+	if err != nil || fi.Mode()&os.ModeCharDevice == 0 {
+		return false
+	}
+	null, err := os.Stat(os.DevNull)
+	return err != nil || !os.SameFile(fi, null)
+}
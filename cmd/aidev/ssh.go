@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+
+	"ai-dev-agent/service/remotefs"
+)
+
+// validateSSH checks that the command and flags of a --ssh run support a
+// remote project. History and settings stay in the local workdir.
+func validateSSH(config *Config, cmd *Command) error {
+	if config.SSH == "" {
+		return nil
+	}
+	if _, _, err := remotefs.ParseSpec(config.SSH); err != nil {
+		return err
+	}
+	switch {
+	case cmd.Type != "refactor" && cmd.Type != "fix" && cmd.Type != "generate" && cmd.Type != "explain" && cmd.Type != "review":
+		return fmt.Errorf("%s works on the local project; --ssh needs refactor, fix, generate, explain or review", cmd.Type)
+	case len(config.Roots) > 0:
+		return fmt.Errorf("--ssh works on one remote project and can't be used with multiple roots")
+	case config.Repo != "" || config.Worktree || config.Staged || config.DryRun || config.Stash || config.Pipeline || config.Diff:
+		return fmt.Errorf("--repo, --worktree, --staged, --dry-run, --stash, --pipeline and --diff need a local project and can't be used with --ssh")
+	}
+	return nil
+}
+
+// openRemote connects to the --ssh host, or returns nil without one.
+func openRemote(config *Config) (*remotefs.Client, error) {
+	if config.SSH == "" {
+		return nil, nil
+	}
+	target, root, err := remotefs.ParseSpec(config.SSH)
+	if err != nil {
+		return nil, err
+	}
+	rc := remotefs.DefaultConfig()
+	rc.Target, rc.Root = target, root
+	rc.BackupEnabled = !config.NoBackup
+	rc.ReadOnly = config.ReadOnly
+	client, err := remotefs.NewClient(rc)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), config.Timeout)
+	defer cancel()
+	if err := client.Check(ctx); err != nil {
+		return nil, err
+	}
+	return client, nil
+}
+
+// writeRemote writes a file of the remote project. Its backup stays on
+// the host, so only the contents are recorded.
+func (a *fileAdapter) writeRemote(path, content string) error {
+	before, err := a.remote.ReadFile(path)
+	if err != nil && err != remotefs.ErrFileNotFound {
+		return err
+	}
+	if err := a.remote.WriteFile(path, content); err != nil {
+		return err
+	}
+	a.rec.file(path, before, content)
+	return nil
+}
+
+// remoteCommand returns the ssh command that runs name with args on the
+// host, in the remote directory matching the local dir.
+func (a *execAdapter) remoteCommand(dir, name string, args []string) (string, []string, error) {
+	rel := "."
+	if dir != "" {
+		var err error
+		if rel, err = filepath.Rel(a.root, dir); err != nil {
+			return "", nil, err
+		}
+	}
+	return a.remote.Command(filepath.ToSlash(rel), name, args...)
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"ai-dev-agent/service/gitrepo"
+)
+
+// autoStash holds uncommitted edits to the target files for one run.
+type autoStash struct {
+	git     *gitrepo.Client
+	dir     string
+	message string
+}
+
+// guardDirty warns when target files have uncommitted changes, which the
+// agent's writes would mix with. With --stash the changes are stashed and
+// restored by the returned stash; otherwise it is nil. Outside a git
+// repository there is nothing to check.
+func guardDirty(ctx context.Context, config *Config, cmd *Command) (*autoStash, error) {
+	if len(cmd.Files) == 0 {
+		return nil, nil
+	}
+	git := gitrepo.NewClient(gitrepo.Config{})
+	if _, err := git.Root(ctx, config.WorkDir); err != nil {
+		return nil, nil
+	}
+	dirty, err := git.Modified(ctx, config.WorkDir, cmd.Files)
+	if err != nil || len(dirty) == 0 {
+		return nil, nil
+	}
+
+	if !config.Stash {
+		fmt.Println("⚠ Target files have uncommitted changes; the agent's edits will be mixed with them:")
+		for _, f := range dirty {
+			fmt.Printf("    %s\n", f)
+		}
+		fmt.Println("  Commit them first, or use --stash or --worktree to keep them apart.")
+		return nil, nil
+	}
+
+	s := &autoStash{git: git, dir: config.WorkDir, message: "aidev auto-stash " + time.Now().Format("20060102-150405")}
+	if err := git.Stash(ctx, s.dir, s.message, cmd.Files); err != nil {
+		return nil, fmt.Errorf("stash: %w", err)
+	}
+	fmt.Printf("📦 Stashed uncommitted changes to %d file(s)\n", len(dirty))
+	return s, nil
+}
+
+// restore merges the stashed edits back over the agent's changes. On
+// conflict the files keep markers and the stash is kept as a backup.
+func (s *autoStash) restore(ctx context.Context) {
+	if s == nil {
+		return
+	}
+	conflicts, err := s.git.Unstash(ctx, s.dir, s.message)
+	switch {
+	case err != nil:
+		fmt.Printf("⚠ Could not restore your changes (%v); they are kept in the stash %q\n", err, s.message)
+	case len(conflicts) > 0:
+		fmt.Println("⚠ Your changes conflict with the agent's; resolve the markers in:")
+		for _, f := range conflicts {
+			fmt.Printf("    %s\n", f)
+		}
+		fmt.Printf("  The originals are kept in the stash %q\n", s.message)
+	default:
+		fmt.Println("📦 Restored your uncommitted changes")
+	}
+}
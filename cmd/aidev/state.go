@@ -0,0 +1,256 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"ai-dev-agent/service/orchestrator"
+	"ai-dev-agent/service/provenance"
+	"ai-dev-agent/service/store"
+)
+
+// stateDir holds the agent's per-project state.
+const stateDir = ".aidev"
+
+// openStore opens the state database of the project rooted at root.
+func openStore(root string) (*store.Store, error) {
+	return store.Open(filepath.Join(root, stateDir))
+}
+
+// provenanceDir returns the directory holding run manifests.
+func provenanceDir(root string) string {
+	return filepath.Join(root, stateDir, "provenance")
+}
+
+// recorder persists session state to the store and writes the run's
+// provenance manifest. A recorder without a store still writes manifests,
+// so state-keeping never blocks an operation.
+type recorder struct {
+	mu      sync.Mutex
+	store   *store.Store
+	session *store.Session
+	prompts []string
+	written map[string]string // path -> content hash
+	changes map[string]*fileChange
+	models  map[string]*modelUsage
+
+	provenanceDir string
+	signKey       ed25519.PrivateKey
+}
+
+func newRecorder(st *store.Store) *recorder {
+	return &recorder{
+		store:   st,
+		written: make(map[string]string),
+		changes: make(map[string]*fileChange),
+		models:  make(map[string]*modelUsage),
+	}
+}
+
+// fileChange spans a file's first and last written versions in a run.
+type fileChange struct {
+	before, after string
+}
+
+// modelUsage totals the token usage of one model in a run.
+type modelUsage struct {
+	calls, prompt, completion int
+}
+
+func (r *recorder) begin(mode, instruction, workDir, model string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.session = &store.Session{
+		ID:          store.NewSessionID(),
+		Mode:        mode,
+		Instruction: instruction,
+		WorkDir:     workDir,
+		Model:       model,
+		StartedAt:   time.Now(),
+	}
+	if r.store != nil {
+		r.warn(r.store.SaveSession(r.session))
+	}
+}
+
+func (r *recorder) sessionID() string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.session == nil {
+		return ""
+	}
+	return r.session.ID
+}
+
+func (r *recorder) file(path, before, after string) {
+	id := r.sessionID()
+	if id == "" {
+		return
+	}
+	r.mu.Lock()
+	key := filepath.ToSlash(path)
+	r.written[key] = provenance.Hash(after)
+	if c, ok := r.changes[key]; ok {
+		c.after = after
+	} else {
+		r.changes[key] = &fileChange{before: before, after: after}
+	}
+	r.mu.Unlock()
+	if r.store != nil {
+		r.warn(r.store.AddSessionFile(store.SessionFile{SessionID: id, Path: path, Before: before, After: after}))
+	}
+}
+
+func (r *recorder) prompt(text string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.prompts = append(r.prompts, provenance.Hash(text))
+}
+
+// request records an LLM request of a deterministic run for replay.
+func (r *recorder) request(model string, seed int, prompt, body, response string) {
+	id := r.sessionID()
+	if r.store == nil || id == "" {
+		return
+	}
+	r.warn(r.store.AddRequest(store.Request{
+		SessionID:  id,
+		Model:      model,
+		Seed:       seed,
+		PromptHash: provenance.Hash(prompt),
+		Body:       body,
+		Response:   response,
+	}))
+}
+
+func (r *recorder) usage(model string, prompt, completion, total int) {
+	r.mu.Lock()
+	u, ok := r.models[model]
+	if !ok {
+		u = &modelUsage{}
+		r.models[model] = u
+	}
+	u.calls++
+	u.prompt += prompt
+	u.completion += completion
+	r.mu.Unlock()
+	if r.store == nil {
+		return
+	}
+	r.warn(r.store.RecordUsage(store.Usage{
+		SessionID:        r.sessionID(),
+		Model:            model,
+		PromptTokens:     prompt,
+		CompletionTokens: completion,
+		TotalTokens:      total,
+	}))
+}
+
+// command records a command run during the session.
+func (r *recorder) command(c store.Command) {
+	if r.store == nil {
+		return
+	}
+	c.SessionID = r.sessionID()
+	r.warn(r.store.AddCommand(c))
+}
+
+func (r *recorder) backup(path, backupPath, checksum string) {
+	if r.store == nil {
+		return
+	}
+	r.warn(r.store.AddBackup(store.Backup{Path: path, BackupPath: backupPath, Checksum: checksum}))
+}
+
+func (r *recorder) finish(result *orchestrator.Result) {
+	if result.Attempts > 1 {
+		retriesMade.Add(int64(result.Attempts - 1))
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.session == nil {
+		return
+	}
+	r.session.FinishedAt = time.Now()
+	r.session.Success = result.Success
+	if r.store != nil {
+		for _, a := range r.attempts(result) {
+			r.warn(r.store.AddAttempt(a))
+		}
+	}
+	r.session.Attempts += result.Attempts
+	if result.Error != nil {
+		r.session.Error = result.Error.Error()
+	}
+	if r.store != nil {
+		r.warn(r.store.SaveSession(r.session))
+	}
+	if len(r.written) > 0 && r.provenanceDir != "" {
+		_, err := provenance.Write(r.provenanceDir, r.manifest(), r.signKey)
+		r.warn(err)
+	}
+}
+
+// attempts returns the attempts of a run with their output, numbered on
+// from the session's earlier runs: the failed ones, and the last if it
+// succeeded and wrote files.
+func (r *recorder) attempts(result *orchestrator.Result) []store.Attempt {
+	var attempts []store.Attempt
+	for _, h := range result.History {
+		attempts = append(attempts, store.Attempt{
+			SessionID: r.session.ID,
+			Attempt:   r.session.Attempts + h.Attempt,
+			Stage:     h.Stage,
+			Error:     h.Error,
+			Files:     h.Files,
+		})
+	}
+	if result.Success {
+		files := result.Candidates
+		if files == nil {
+			files = make(map[string]string)
+			for _, path := range result.FilesWritten {
+				if c, ok := r.changes[filepath.ToSlash(path)]; ok {
+					files[path] = c.after
+				}
+			}
+		}
+		if len(files) > 0 {
+			attempts = append(attempts, store.Attempt{SessionID: r.session.ID, Attempt: r.session.Attempts + result.Attempts, Files: files})
+		}
+	}
+	return attempts
+}
+
+func (r *recorder) manifest() *provenance.Manifest {
+	m := &provenance.Manifest{
+		SessionID:    r.session.ID,
+		Tool:         "aidev",
+		Version:      Version,
+		Mode:         r.session.Mode,
+		Model:        r.session.Model,
+		PromptHashes: r.prompts,
+		Timestamp:    r.session.FinishedAt.UTC(),
+	}
+	for path, hash := range r.written {
+		m.Files = append(m.Files, provenance.FileRecord{Path: path, SHA256: hash})
+	}
+	sort.Slice(m.Files, func(i, j int) bool { return m.Files[i].Path < m.Files[j].Path })
+	return m
+}
+
+func (r *recorder) close() {
+	if r.store != nil {
+		r.store.Close()
+	}
+}
+
+func (r *recorder) warn(err error) {
+	if err != nil {
+		fmt.Printf("  ⚠ state: %v\n", err)
+	}
+}
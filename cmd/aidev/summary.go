@@ -0,0 +1,65 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+
+	"ai-dev-agent/service/diff"
+	"ai-dev-agent/service/llm"
+)
+
+// diffStats returns the added and removed lines of each file written in
+// the run, from its first to its last version.
+func (r *recorder) diffStats() map[string]diff.Stats {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	stats := make(map[string]diff.Stats, len(r.changes))
+	for path, c := range r.changes {
+		stats[path] = diff.Count(c.before, c.after)
+	}
+	return stats
+}
+
+// usageTotal is the token usage of one model in a run.
+type usageTotal struct {
+	Model      string
+	Calls      int
+	Prompt     int
+	Completion int
+}
+
+// usageTotals returns the run's token usage by model, sorted by name.
+func (r *recorder) usageTotals() []usageTotal {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	totals := make([]usageTotal, 0, len(r.models))
+	for model, u := range r.models {
+		totals = append(totals, usageTotal{Model: model, Calls: u.calls, Prompt: u.prompt, Completion: u.completion})
+	}
+	sort.Slice(totals, func(i, j int) bool { return totals[i].Model < totals[j].Model })
+	return totals
+}
+
+// printTokenUsage prints token usage and, when every model used has prices,
+// the cost of the run.
+func printTokenUsage(totals []usageTotal) {
+	if len(totals) == 0 {
+		return
+	}
+	var calls, prompt, completion int
+	var cost float64
+	priced := true
+	for _, t := range totals {
+		calls += t.Calls
+		prompt += t.Prompt
+		completion += t.Completion
+		info, _ := llm.LookupModel(t.Model)
+		c, ok := info.Cost(t.Prompt, t.Completion)
+		priced = priced && ok
+		cost += c
+	}
+	fmt.Printf("\n  %s\n", trf("Tokens: %d (%d prompt, %d completion) in %d call(s)", prompt+completion, prompt, completion, calls))
+	if priced {
+		fmt.Printf("  %s\n", trf("Cost: $%.4f", cost))
+	}
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Task is a named recurring operation selected with --task: its
+// instruction, the constraints it runs under and how its changes are
+// verified. The instruction may use the placeholders {file}, {files} and
+// {instruction}, the text given with -i or --.
+type Task struct {
+	Instruction string   `yaml:"instruction"`
+	Constraints []string `yaml:"constraints"`
+	Retries     *int     `yaml:"retries"`
+	Staged      *bool    `yaml:"staged"`
+	RunTests    *bool    `yaml:"run_tests"`
+}
+
+// builtinTasks are available in every project; .aidev.yaml may redefine
+// them.
+var builtinTasks = map[string]Task{
+	"null-checks": {
+		Instruction: "Add nil checks to {files} wherever a pointer, map, interface or slice element is dereferenced without one, returning an error or the zero value as the surrounding code does. {instruction}",
+		Constraints: []string{"minimal-diff", "api-stable"},
+		RunTests:    boolPtr(true),
+	},
+	"wrap-errors": {
+		Instruction: "In {files}, wrap every error returned from a call with fmt.Errorf and %w, adding what was being done, e.g. \"read config: %w\". Leave errors that are created or already wrapped as they are. {instruction}",
+		Constraints: []string{"minimal-diff", "api-stable", "no-deps"},
+	},
+	"add-context": {
+		Instruction: "In {files}, add a ctx context.Context first parameter to the functions that do I/O or call functions taking one, and pass it through from their callers in these files. {instruction}",
+		Constraints: []string{"no-deps"},
+		RunTests:    boolPtr(true),
+	},
+}
+
+// applyTask expands the --task of cmd, from the project's tasks or the
+// built-in ones, into its instruction and settings. Flags given on the
+// command line win over the task's settings.
+func applyTask(config *Config, cmd *Command) error {
+	if cmd.Task == "" {
+		return nil
+	}
+	t, ok := config.Tasks[cmd.Task]
+	if !ok {
+		if t, ok = builtinTasks[cmd.Task]; !ok {
+			return fmt.Errorf("unknown task %q (available: %s)", cmd.Task, strings.Join(taskNames(config.Tasks), ", "))
+		}
+	}
+	if t.Instruction == "" {
+		return fmt.Errorf("task %s has no instruction", cmd.Task)
+	}
+
+	file := ""
+	if len(cmd.Files) > 0 {
+		file = cmd.Files[0]
+	}
+	instruction := strings.NewReplacer(
+		"{file}", file,
+		"{files}", strings.Join(cmd.Files, ", "),
+		"{instruction}", cmd.Instruction,
+	).Replace(t.Instruction)
+	if cmd.Instruction != "" && !strings.Contains(t.Instruction, "{instruction}") {
+		instruction += "\n\n" + cmd.Instruction
+	}
+	cmd.Instruction = strings.TrimSpace(instruction)
+
+	// The task's constraints come first, like the project's.
+	cmd.Constraints = append(append([]string(nil), t.Constraints...), cmd.Constraints...)
+
+	given := config.Given
+	if t.Retries != nil && !given["--retries"] {
+		config.MaxRetries = *t.Retries
+	}
+	if t.Staged != nil && !given["--staged"] {
+		config.Staged = *t.Staged
+	}
+	if t.RunTests != nil && !given["--run-tests"] {
+		config.RunTests = *t.RunTests
+	}
+	return nil
+}
+
+// taskNames lists the project's and built-in task names.
+func taskNames(tasks map[string]Task) []string {
+	var names []string
+	for name := range builtinTasks {
+		if _, ok := tasks[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	for name := range tasks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"sync/atomic"
+	"time"
+
+	"ai-dev-agent/service/telemetry"
+)
+
+// telemetryURLEnv names the endpoint usage statistics are reported to.
+// Unset, they are kept on this machine only.
+const telemetryURLEnv = "AIDEV_TELEMETRY_URL"
+
+// retriesMade counts the attempts after the first of the runs this process
+// finished, for telemetry.
+var retriesMade atomic.Int64
+
+// runTelemetry shows, turns on or turns off the usage statistics.
+func runTelemetry(ctx context.Context, config *Config, cmd *Command) error {
+	path, err := telemetry.Path()
+	if err != nil {
+		return fmt.Errorf("telemetry: %w", err)
+	}
+	stats, err := telemetry.Load(path)
+	if err != nil {
+		return fmt.Errorf("telemetry: %w", err)
+	}
+
+	switch cmd.Files[0] {
+	case "on":
+		stats.Enable()
+		if err := stats.Save(path); err != nil {
+			return fmt.Errorf("telemetry: %w", err)
+		}
+		fmt.Printf("%s %s\n", glyph("✅"), tr("Telemetry is on."))
+		fmt.Println(tr("Recorded: how often each command runs, succeeds and retries, with the version and platform. Never code, prompts, paths or errors."))
+	case "off":
+		stats.Disable()
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("telemetry: %w", err)
+		}
+		fmt.Printf("%s %s\n", glyph("✅"), tr("Telemetry is off; its statistics are deleted."))
+	case "status":
+		if !stats.Enabled || telemetryOptedOut() {
+			fmt.Println(tr("Telemetry is off. Turn it on with: aidev telemetry on"))
+			if telemetryOptedOut() {
+				fmt.Println(tr("DO_NOT_TRACK is set, which keeps it off."))
+			}
+			return nil
+		}
+		fmt.Println(tr("Telemetry is on."))
+		fmt.Printf("%s %s\n", tr("Statistics:"), path)
+		if endpoint := os.Getenv(telemetryURLEnv); endpoint != "" {
+			fmt.Printf("%s %s\n", tr("Reported daily to:"), endpoint)
+		} else {
+			fmt.Println(tr("Kept on this machine only."))
+		}
+		printTelemetry(stats)
+	}
+	return nil
+}
+
+func printTelemetry(stats *telemetry.Stats) {
+	if len(stats.Commands) == 0 {
+		fmt.Println(tr("No commands recorded yet."))
+		return
+	}
+	names := make([]string, 0, len(stats.Commands))
+	for name := range stats.Commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	fmt.Printf("\n%s %s\n", tr("Since"), stats.Since.Local().Format("2006-01-02"))
+	fmt.Printf("%-12s %6s %9s %8s\n", "COMMAND", "RUNS", "SUCCESS", "RETRIES")
+	for _, name := range names {
+		c := stats.Commands[name]
+		fmt.Printf("%-12s %6d %8.0f%% %8d\n", name, c.Runs, 100*float64(c.Succeeded)/float64(c.Runs), c.Retries)
+	}
+}
+
+// telemetryOptedOut reports whether the environment asks not to be
+// tracked, which overrides telemetry on.
+func telemetryOptedOut() bool {
+	v := os.Getenv("DO_NOT_TRACK")
+	return v != "" && v != "0"
+}
+
+// recordTelemetry adds a finished command to the usage statistics, if they
+// are on, and reports them when due. Offline, they are only kept, to be
+// reported by the next run that isn't. It never fails the command.
+func recordTelemetry(config *Config, cmd *Command, err error) {
+	if cmd.Type == "telemetry" || telemetryOptedOut() {
+		return
+	}
+	path, perr := telemetry.Path()
+	if perr != nil {
+		return
+	}
+	stats, perr := telemetry.Load(path)
+	if perr != nil || !stats.Enabled {
+		return
+	}
+	stats.Record(cmd.Type, err == nil, int(retriesMade.Load()))
+	if endpoint := os.Getenv(telemetryURLEnv); endpoint != "" && !config.Offline && stats.Due(time.Now()) {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		stats.Send(ctx, endpoint, Version)
+		cancel()
+	}
+	stats.Save(path)
+}
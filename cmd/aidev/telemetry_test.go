@@ -0,0 +1,60 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"ai-dev-agent/service/telemetry"
+)
+
+func TestRecordTelemetryOffline(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	t.Setenv("DO_NOT_TRACK", "")
+	var posts atomic.Int64
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		posts.Add(1)
+	}))
+	defer srv.Close()
+	t.Setenv(telemetryURLEnv, srv.URL)
+
+	path, err := telemetry.Path()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stats := &telemetry.Stats{}
+	stats.Enable()
+	if err := stats.Save(path); err != nil {
+		t.Fatal(err)
+	}
+	load := func() *telemetry.Stats {
+		t.Helper()
+		stats, err := telemetry.Load(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return stats
+	}
+
+	cmd := &Command{Type: "review"}
+	recordTelemetry(&Config{Offline: true}, cmd, nil)
+	if n := posts.Load(); n != 0 {
+		t.Fatalf("offline run posted the statistics %d time(s)", n)
+	}
+	stats = load()
+	if c := stats.Commands["review"]; c == nil || c.Runs != 1 {
+		t.Errorf("offline run not recorded: %+v", stats.Commands)
+	}
+	if !stats.Reported.IsZero() {
+		t.Errorf("offline run marked the statistics reported at %v", stats.Reported)
+	}
+
+	recordTelemetry(&Config{}, cmd, nil)
+	if n := posts.Load(); n != 1 {
+		t.Fatalf("online run posted the statistics %d time(s), want 1", n)
+	}
+	if stats = load(); stats.Commands["review"].Runs != 2 || stats.Reported.IsZero() {
+		t.Errorf("after the online run: %+v, reported %v", stats.Commands["review"], stats.Reported)
+	}
+}
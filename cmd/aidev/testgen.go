@@ -0,0 +1,19 @@
+package main
+
+import (
+	"fmt"
+
+	"ai-dev-agent/service/orchestrator"
+)
+
+// printMutation reports how many mutants the generated tests caught and
+// where the ones they missed are.
+func printMutation(report *orchestrator.MutationReport) {
+	if report == nil || len(report.Mutants) == 0 {
+		return
+	}
+	fmt.Printf("\n%s\n", trf("Mutants: %d of %d killed", report.Killed, len(report.Mutants)))
+	for _, m := range report.Survivors() {
+		fmt.Printf("  %s\n", trf("Survived: %s:%d %s: %s became %s", m.File, m.Line, m.Func, m.From, m.To))
+	}
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"ai-dev-agent/service/orchestrator"
+)
+
+// todoMarker starts a comment asking the agent for a change where it
+// stands.
+const todoMarker = "TODO(ai):"
+
+// todo is a TODO(ai) comment of a file.
+type todo struct {
+	file       string
+	line, end  int  // first and last line of the comment
+	col        int  // offset of the comment in its first line
+	standalone bool // on lines of its own, not after code
+	text       string
+}
+
+func (t todo) key() string { return t.file + "\x00" + t.text }
+
+// runTodos resolves the TODO(ai) comments of cmd's files one at a time:
+// each comment's text is the instruction of a fix sent with the
+// declaration it stands in, and the comment is removed once the change
+// passes verification. Files are scanned again after each change, as
+// lines move.
+func runTodos(ctx context.Context, config *Config, cmd *Command, svc *services, engine *orchestrator.Engine) (*orchestrator.Result, error) {
+	total := &orchestrator.Result{}
+	tried := make(map[string]bool)
+	found, unresolved := 0, 0
+	for {
+		todos, err := findTodos(svc.file, cmd.Files)
+		if err != nil {
+			return nil, err
+		}
+		var t *todo
+		for i := range todos {
+			if !tried[todos[i].key()] {
+				t = &todos[i]
+				break
+			}
+		}
+		if t == nil {
+			break
+		}
+		tried[t.key()] = true
+		found++
+
+		fmt.Printf("%s %s\n", glyph("🔧"), trf("Resolving the TODO at %s:%d: %s", t.file, t.line, truncate(firstLine(t.text), 80)))
+		lines := make([]int, 0, t.end-t.line+1)
+		for l := t.line; l <= t.end; l++ {
+			lines = append(lines, l)
+		}
+		result := engine.Execute(ctx, &orchestrator.Request{
+			Mode:        orchestrator.ModeFix,
+			Files:       []string{t.file},
+			Context:     cmd.Context,
+			Instruction: todoInstruction(cmd, t),
+			WorkDir:     config.WorkDir,
+			Lines:       map[string][]int{t.file: lines},
+			Constraints: constraintsFor(config, cmd),
+		})
+		accumulate(total, result)
+		if !result.Success {
+			unresolved++
+			fmt.Printf("  %s %s\n", glyph("❌"), trf("The TODO at %s:%d is left: %v", t.file, t.line, result.Error))
+			continue
+		}
+		if !config.DryRun {
+			if err := removeTodo(svc.file, *t); err != nil {
+				return nil, fmt.Errorf("%s: remove the TODO: %w", t.file, err)
+			}
+		}
+	}
+
+	if found == 0 {
+		fmt.Printf("%s %s\n", glyph("ℹ"), tr("No TODO(ai) comments found."))
+	}
+	if unresolved > 0 {
+		return failed(total, fmt.Errorf("%d of %d TODO(ai) comment(s) unresolved", unresolved, found)), nil
+	}
+	total.Success, total.Error = true, nil
+	return total, nil
+}
+
+// findTodos returns the TODO(ai) comments of files, in order.
+func findTodos(fs orchestrator.FileService, files []string) ([]todo, error) {
+	var todos []todo
+	for _, file := range files {
+		src, err := fs.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		todos = append(todos, scanTodos(file, src)...)
+	}
+	return todos, nil
+}
+
+// scanTodos finds the TODO(ai) comments of a file. A comment on lines of
+// its own goes on over the // lines after it, up to a blank comment line
+// or another TODO(ai).
+func scanTodos(file, src string) []todo {
+	var todos []todo
+	lines := strings.Split(src, "\n")
+	for i := 0; i < len(lines); i++ {
+		at := strings.Index(lines[i], "//")
+		for at >= 0 && !strings.HasPrefix(strings.TrimSpace(lines[i][at+2:]), todoMarker) {
+			next := strings.Index(lines[i][at+2:], "//")
+			if next < 0 {
+				at = -1
+			} else {
+				at += 2 + next
+			}
+		}
+		if at < 0 {
+			continue
+		}
+		t := todo{file: file, line: i + 1, end: i + 1, col: at}
+		t.standalone = strings.TrimSpace(lines[i][:at]) == ""
+		text := []string{strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(lines[i][at+2:]), todoMarker))}
+		for t.standalone && i+1 < len(lines) {
+			next := strings.TrimSpace(lines[i+1])
+			rest := strings.TrimSpace(strings.TrimPrefix(next, "//"))
+			if !strings.HasPrefix(next, "//") || rest == "" || strings.HasPrefix(rest, todoMarker) {
+				break
+			}
+			text = append(text, rest)
+			i++
+			t.end = i + 1
+		}
+		t.text = strings.Join(text, "\n")
+		todos = append(todos, t)
+	}
+	return todos
+}
+
+func todoInstruction(cmd *Command, t *todo) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Resolve this TODO(ai) comment of %s, where it stands:\n%s\n", t.file, t.text)
+	b.WriteString("Make the change it asks for there, keep the rest as it is, and remove the TODO(ai) comment.")
+	if cmd.Instruction != "" {
+		fmt.Fprintf(&b, "\n%s", cmd.Instruction)
+	}
+	return b.String()
+}
+
+// removeTodo removes a resolved TODO(ai) comment the change left in
+// place, found by its text as lines may have moved.
+func removeTodo(fs orchestrator.FileService, t todo) error {
+	src, err := fs.ReadFile(t.file)
+	if err != nil {
+		return err
+	}
+	for _, left := range scanTodos(t.file, src) {
+		if left.text != t.text {
+			continue
+		}
+		lines := strings.Split(src, "\n")
+		if left.standalone {
+			lines = append(lines[:left.line-1], lines[left.end:]...)
+		} else {
+			lines[left.line-1] = strings.TrimRight(lines[left.line-1][:left.col], " \t")
+		}
+		return fs.WriteFile(t.file, strings.Join(lines, "\n"))
+	}
+	return nil
+}
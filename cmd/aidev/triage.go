@@ -0,0 +1,170 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"ai-dev-agent/service/errparse"
+	"ai-dev-agent/service/index"
+	"ai-dev-agent/service/orchestrator"
+)
+
+// maxTriageFiles bounds how many implicated files are sent to the model.
+const maxTriageFiles = 5
+
+// triageLogBytes is how much of the log goes into the instruction.
+const triageLogBytes = 6000
+
+// triageFrame is a frame of the log located in the workspace.
+type triageFrame struct {
+	errparse.Frame
+	Path string // workspace-relative
+}
+
+// runTriage reads the crash log or stack trace of cmd (- for stdin), maps
+// its frames to files of the workspace and asks for the probable cause.
+// With --fix, the function of the innermost project frame is then fixed,
+// given the log and the triage.
+func runTriage(ctx context.Context, config *Config, cmd *Command, svc *services, engine *orchestrator.Engine) (*orchestrator.Result, error) {
+	log, err := readLog(cmd.Files[0])
+	if err != nil {
+		return nil, err
+	}
+	var entries []index.Entry
+	if svc.recorder.store != nil {
+		entries, _ = svc.recorder.store.LoadIndex()
+	}
+	frames := locateFrames(errparse.ParseStack(log), config.WorkDir, entries)
+	if len(frames) == 0 {
+		return nil, fmt.Errorf("no frame of %s points at a file of %s", cmd.Files[0], config.WorkDir)
+	}
+
+	fmt.Printf("%s %s\n", glyph("🔍"), tr("Implicated frames:"))
+	var files []string
+	for _, f := range frames {
+		fn := f.Func
+		if fn == "" {
+			fn = "?"
+		}
+		fmt.Printf("  %s:%d  %s\n", f.Path, f.Line, fn)
+		if !containsString(files, f.Path) && len(files) < maxTriageFiles {
+			files = append(files, f.Path)
+		}
+	}
+
+	condensed := errparse.Condense(log, triageLogBytes)
+	triage := engine.Execute(ctx, &orchestrator.Request{
+		Mode:        orchestrator.ModeExplain,
+		Files:       files,
+		Context:     cmd.Context,
+		Instruction: triageInstruction(cmd, frames, condensed),
+		WorkDir:     config.WorkDir,
+	})
+	if !triage.Success || !config.TriageFix {
+		if triage.Success {
+			fmt.Printf("\n%s\n", triage.Output)
+		}
+		return triage, nil
+	}
+	fmt.Printf("\n%s\n\n", triage.Output)
+
+	top := frames[0]
+	fmt.Printf("%s %s\n", glyph("🔧"), trf("Fixing %s at %s:%d", orFunc(top.Func), top.Path, top.Line))
+	lines := make(map[string][]int)
+	for _, f := range frames {
+		if f.Path == top.Path {
+			lines[top.Path] = append(lines[top.Path], f.Line)
+		}
+	}
+	fix := engine.Execute(ctx, &orchestrator.Request{
+		Mode:        orchestrator.ModeFix,
+		Files:       []string{top.Path},
+		Context:     cmd.Context,
+		Instruction: fmt.Sprintf("Fix the failure in %s (%s:%d) that this log shows.\n\nLog:\n%s\n\nTriage:\n%s", orFunc(top.Func), top.Path, top.Line, condensed, triage.Output),
+		WorkDir:     config.WorkDir,
+		Lines:       lines,
+		Constraints: constraintsFor(config, cmd),
+	})
+	fix.Attempts += triage.Attempts
+	return fix, nil
+}
+
+// Helper functions
+
+// readLog reads path, or standard input for -.
+func readLog(path string) (string, error) {
+	var data []byte
+	var err error
+	if path == "-" {
+		data, err = io.ReadAll(os.Stdin)
+	} else {
+		data, err = os.ReadFile(path)
+	}
+	if err != nil {
+		return "", fmt.Errorf("read log: %w", err)
+	}
+	return string(data), nil
+}
+
+// locateFrames keeps the frames that point at files of the workspace. A
+// path as printed on the machine that crashed matches the longest indexed
+// path it ends with; failing that, leading directories are dropped until
+// the rest names a file of workDir.
+func locateFrames(frames []errparse.Frame, workDir string, entries []index.Entry) []triageFrame {
+	var located []triageFrame
+	for _, f := range frames {
+		file := strings.TrimPrefix(filepath.ToSlash(f.File), "./")
+		path := ""
+		if filepath.IsAbs(f.File) {
+			path, _ = projectPath(f.File, workDir)
+		}
+		if path == "" && len(entries) > 0 {
+			path = indexedFile(file, entries)
+		}
+		if path == "" {
+			parts := strings.Split(file, "/")
+			for i := 0; i < len(parts) && path == ""; i++ {
+				path, _ = projectPath(filepath.Join(workDir, filepath.FromSlash(strings.Join(parts[i:], "/"))), workDir)
+			}
+		}
+		if path != "" {
+			located = append(located, triageFrame{Frame: f, Path: path})
+		}
+	}
+	return located
+}
+
+// indexedFile returns the longest indexed path that file ends with.
+func indexedFile(file string, entries []index.Entry) string {
+	best := ""
+	for _, e := range entries {
+		if (file == e.Path || strings.HasSuffix(file, "/"+e.Path)) && len(e.Path) > len(best) {
+			best = e.Path
+		}
+	}
+	return best
+}
+
+func triageInstruction(cmd *Command, frames []triageFrame, log string) string {
+	var b strings.Builder
+	b.WriteString("Triage this crash or error log. Explain the probable cause: the frame where the failure starts, the state that leads to it and why, then where and how to fix it. Say how sure you are, and what else to check if the code shown doesn't explain it.\n\nFrames in the project:")
+	for _, f := range frames {
+		fmt.Fprintf(&b, "\n- %s:%d %s", f.Path, f.Line, f.Func)
+	}
+	fmt.Fprintf(&b, "\n\nLog:\n%s", log)
+	if cmd.Instruction != "" {
+		b.WriteString("\n\n" + cmd.Instruction)
+	}
+	return b.String()
+}
+
+func orFunc(fn string) string {
+	if fn == "" {
+		return "the code"
+	}
+	return fn
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+func runUsage(ctx context.Context, config *Config, cmd *Command) error {
+	st, err := openStore(config.WorkDir)
+	if err != nil {
+		return fmt.Errorf("state: %w", err)
+	}
+	defer st.Close()
+
+	days := cmd.Limit
+	if days == 0 {
+		days = 30
+	}
+	usage, err := st.UsageByModel(time.Now().AddDate(0, 0, -days))
+	if err != nil {
+		return fmt.Errorf("usage: %w", err)
+	}
+	if len(usage) == 0 {
+		fmt.Printf("No LLM usage in the last %d day(s).\n", days)
+		return nil
+	}
+
+	fmt.Printf("Token usage, last %d day(s):\n\n", days)
+	fmt.Printf("  %-20s %8s %12s %12s %12s\n", "MODEL", "CALLS", "PROMPT", "COMPLETION", "TOTAL")
+	var calls, total int
+	for _, u := range usage {
+		fmt.Printf("  %-20s %8d %12d %12d %12d\n", u.Model, u.Calls, u.PromptTokens, u.CompletionTokens, u.TotalTokens)
+		calls += u.Calls
+		total += u.TotalTokens
+	}
+	fmt.Printf("\n  %d call(s), %d token(s)\n", calls, total)
+
+	periods := spendPeriods(config, time.Now())
+	if len(periods) == 0 {
+		return nil
+	}
+	spend, err := userLedger()
+	if err != nil {
+		return fmt.Errorf("spend: %w", err)
+	}
+	for _, p := range periods {
+		spent, err := spend.since(p.since)
+		if err != nil {
+			return fmt.Errorf("spend: %w", err)
+		}
+		fmt.Printf("  %s\n", trf("Spend (%s): $%.2f of $%.2f", tr(p.name), spent, p.limit))
+	}
+	return nil
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+
+	"ai-dev-agent/service/gitrepo"
+	"ai-dev-agent/service/llm"
+)
+
+// configError reports every problem found in a configuration at once, so
+// that a user fixes them in one go rather than one run at a time.
+type configError struct {
+	problems []string
+}
+
+func (e *configError) Error() string {
+	return "invalid configuration:\n  - " + strings.Join(e.problems, "\n  - ")
+}
+
+// validateConfig checks the merged configuration of flags, .aidev.yaml
+// and the profile before anything runs.
+func validateConfig(config *Config, cmd *Command) error {
+	var problems []string
+	add := func(format string, args ...interface{}) {
+		problems = append(problems, fmt.Sprintf(format, args...))
+	}
+
+	if config.MaxRetries < 1 {
+		add("%s %d: must be at least 1", configSource(config, "--retries", "retries"), config.MaxRetries)
+	}
+	if config.Timeout <= 0 {
+		add("%s %s: must be positive, e.g. 90s or 5m", configSource(config, "--timeout", "timeout"), config.Timeout)
+	}
+	if config.StreamIdle < 0 {
+		add("--stream-idle %s: must not be negative", config.StreamIdle)
+	}
+	if config.Rounds < 0 {
+		add("%s %d: must not be negative", configSource(config, "--rounds", "rounds"), config.Rounds)
+	}
+	for _, n := range []struct {
+		name  string
+		value int
+	}{
+		{"--workers", config.Workers}, {"--client-cap", config.ClientCap}, {"--limit", cmd.Limit},
+		{"max_write_files", config.MaxFiles}, {"max_write_bytes", config.MaxBytes},
+		{"max_feedback_tokens", config.Feedback},
+	} {
+		if n.value < 0 {
+			add("%s %d: must not be negative", n.name, n.value)
+		}
+	}
+	if config.DiffMult < 0 {
+		add("max_diff_multiple %g: must not be negative", config.DiffMult)
+	}
+	if _, err := gitrepo.ParseForges(os.Getenv("AIDEV_FORGES")); err != nil {
+		add("AIDEV_FORGES: %v", err)
+	}
+	if err := config.Policy.Compile(); err != nil {
+		add("%v", err)
+	}
+	names := make([]string, 0, len(config.EnvMatrix))
+	for name := range config.EnvMatrix {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if !envName.MatchString(name) {
+			add("verify_matrix: %q is not an environment variable name", name)
+		} else if len(config.EnvMatrix[name]) == 0 {
+			add("verify_matrix: %s has no values", name)
+		}
+	}
+	if config.DryRun && config.Given["--no-backup"] {
+		add("--dry-run writes nothing, so --no-backup has no effect: drop one of them")
+	}
+
+	// Local commands never call a model.
+	if !isLocalCommand(cmd.Type) {
+		for _, m := range usedModels(config) {
+			if _, ok := llm.LookupModel(m.name); !ok {
+				add("%s %q: unknown model; add it under models in %s with its context_window", m.source, m.name, projectConfigFile)
+			}
+		}
+	}
+
+	if len(problems) == 0 {
+		return nil
+	}
+	return &configError{problems: problems}
+}
+
+// Helper functions
+
+var envName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// configSource names where a setting came from: its flag, or else the
+// profile that set it.
+func configSource(config *Config, flag, profileKey string) string {
+	if config.Given[flag] || config.Profile == "" {
+		return flag
+	}
+	return fmt.Sprintf("profile %s: %s", config.Profile, profileKey)
+}
+
+type namedModel struct {
+	source string
+	name   string
+}
+
+// usedModels lists the models the configuration may call, in a stable
+// order.
+func usedModels(config *Config) []namedModel {
+	source := "model"
+	if config.Given["-m"] || config.Given["--model"] {
+		source = "--model"
+	}
+	models := []namedModel{{source, config.Model}}
+	for _, set := range []struct {
+		source string
+		models map[string]string
+	}{{"model_for", config.ModelFor}, {"--role-model", config.RoleModels}} {
+		keys := make([]string, 0, len(set.models))
+		for k := range set.models {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			models = append(models, namedModel{set.source + " " + k, set.models[k]})
+		}
+	}
+	for i, r := range config.Routes {
+		models = append(models, namedModel{fmt.Sprintf("routes[%d]", i), r.Model})
+	}
+	return models
+}
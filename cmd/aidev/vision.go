@@ -0,0 +1,42 @@
+package main
+
+import (
+	"fmt"
+
+	"ai-dev-agent/service/llm"
+	"ai-dev-agent/service/vision"
+)
+
+// defaultVisionModel serves image prompts when neither the selected model
+// nor model_for.vision accepts images.
+const defaultVisionModel = "glm-4v-plus"
+
+// loadImages reads the --image files, downscaled to the vision limits, and
+// switches config.Model to a vision model if the selected one is text-only.
+func loadImages(config *Config, paths []string) ([]*vision.Image, error) {
+	if len(paths) == 0 {
+		return nil, nil
+	}
+	images := make([]*vision.Image, 0, len(paths))
+	for _, path := range paths {
+		img, err := vision.Load(path, vision.DefaultConfig())
+		if err != nil {
+			return nil, fmt.Errorf("image: %w", err)
+		}
+		if config.Verbose {
+			fmt.Printf("  Image: %s (%dx%d, %s, %d KB)\n", path, img.Width, img.Height, img.MIME, len(img.Data)/1024)
+		}
+		images = append(images, img)
+	}
+
+	if info, ok := llm.LookupModel(config.Model); ok && info.Vision {
+		return images, nil
+	}
+	model := config.ModelFor["vision"]
+	if model == "" {
+		model = defaultVisionModel
+	}
+	fmt.Printf("  %s %s\n", glyph("ℹ"), trf("%s doesn't accept images, using %s", config.Model, model))
+	config.Model = model
+	return images, nil
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"ai-dev-agent/service/filesystem"
+)
+
+// workspaceRoot is a further project of a multi-root run, given with a
+// repeated -w or in a --workspace file. Its files are addressed as
+// name/path, e.g. sdk/client.go.
+type workspaceRoot struct {
+	Name string `yaml:"name"` // default: the directory's base name
+	Dir  string `yaml:"path"`
+}
+
+// workspaceFile is the content of a --workspace file. The first root is
+// the primary one: state, history and settings are kept there.
+type workspaceFile struct {
+	Roots []workspaceRoot `yaml:"roots"`
+}
+
+// loadWorkspace reads the --workspace file into the workdir and roots.
+// Its paths are relative to the file.
+func loadWorkspace(config *Config) error {
+	if config.Workspace == "" {
+		return nil
+	}
+	if config.WorkDir != "" {
+		return fmt.Errorf("--workspace lists the roots itself and can't be combined with -w")
+	}
+	data, err := os.ReadFile(config.Workspace)
+	if err != nil {
+		return fmt.Errorf("workspace: %w", err)
+	}
+	var wf workspaceFile
+	if err := yaml.Unmarshal(data, &wf); err != nil {
+		return fmt.Errorf("workspace %s: %w", config.Workspace, err)
+	}
+	if len(wf.Roots) == 0 {
+		return fmt.Errorf("workspace %s: no roots", config.Workspace)
+	}
+	base := filepath.Dir(config.Workspace)
+	for i, r := range wf.Roots {
+		if r.Dir == "" {
+			return fmt.Errorf("workspace %s: root %d has no path", config.Workspace, i+1)
+		}
+		if !filepath.IsAbs(r.Dir) {
+			r.Dir = filepath.Join(base, r.Dir)
+		}
+		if i == 0 {
+			config.WorkDir = r.Dir
+			config.RootName = r.Name
+			continue
+		}
+		config.Roots = append(config.Roots, r)
+	}
+	return nil
+}
+
+// setupWorkspace resolves the roots of a multi-root run and checks that
+// the command and flags support it.
+func setupWorkspace(config *Config, cmd *Command) error {
+	if len(config.Roots) == 0 {
+		return nil
+	}
+	switch {
+	case cmd.Type != "refactor" && cmd.Type != "fix" && cmd.Type != "generate" && cmd.Type != "explain" && cmd.Type != "review":
+		return fmt.Errorf("%s works on one project; multiple roots need refactor, fix, generate, explain or review", cmd.Type)
+	case config.Repo != "" || config.Worktree || config.Staged || config.DryRun || config.Stash || config.Pipeline || config.Diff:
+		return fmt.Errorf("--repo, --worktree, --staged, --dry-run, --stash, --pipeline and --diff work on one project and can't be used with multiple roots")
+	}
+
+	primary, err := filepath.Abs(config.WorkDir)
+	if err != nil {
+		return err
+	}
+	config.WorkDir = primary
+	if config.RootName == "" {
+		config.RootName = filepath.Base(primary)
+	}
+	names := map[string]string{config.RootName: primary}
+	for i := range config.Roots {
+		r := &config.Roots[i]
+		if r.Dir, err = filepath.Abs(r.Dir); err != nil {
+			return err
+		}
+		if info, err := os.Stat(r.Dir); err != nil || !info.IsDir() {
+			return fmt.Errorf("root %s is not a directory", r.Dir)
+		}
+		if r.Name == "" {
+			r.Name = filepath.Base(r.Dir)
+		}
+		if strings.ContainsAny(r.Name, `/\`) {
+			return fmt.Errorf("root name %q can't contain a path separator", r.Name)
+		}
+		if other, ok := names[r.Name]; ok {
+			return fmt.Errorf("roots %s and %s are both named %s; name them in a --workspace file", other, r.Dir, r.Name)
+		}
+		names[r.Name] = r.Dir
+	}
+	return nil
+}
+
+// rootDirs maps the further roots of a multi-root run by name, as the
+// engine takes them.
+func rootDirs(config *Config) map[string]string {
+	if len(config.Roots) == 0 {
+		return nil
+	}
+	dirs := make(map[string]string, len(config.Roots))
+	for _, r := range config.Roots {
+		dirs[r.Name] = r.Dir
+	}
+	return dirs
+}
+
+// rootFS is the file manager of a further root; each root is its own
+// sandbox.
+type rootFS struct {
+	name string
+	mgr  *filesystem.Manager
+}
+
+// route returns the file manager of the root holding path and the path
+// within it. A path starting with a further root's name lies in that
+// root; any other, with or without the primary root's name, in the
+// primary one.
+func (a *fileAdapter) route(path string) (*filesystem.Manager, string) {
+	if len(a.roots) == 0 {
+		return a.mgr, path
+	}
+	name, rest, ok := strings.Cut(filepath.ToSlash(path), "/")
+	if !ok {
+		return a.mgr, path
+	}
+	for _, r := range a.roots {
+		if r.name == name {
+			return r.mgr, rest
+		}
+	}
+	if name == a.primary {
+		return a.mgr, rest
+	}
+	return a.mgr, path
+}
+
+// openRoots creates the file managers of the further roots.
+func openRoots(config *Config) ([]rootFS, error) {
+	var roots []rootFS
+	for _, r := range config.Roots {
+		mgr, err := filesystem.NewManager(filesystem.Config{RootDir: r.Dir, BackupEnabled: !config.NoBackup, MaxBackups: config.BackupKeep, ReadOnly: config.ReadOnly, IgnorePatterns: config.Ignore})
+		if err != nil {
+			return nil, fmt.Errorf("root %s: %w", r.Name, err)
+		}
+		roots = append(roots, rootFS{name: r.Name, mgr: mgr})
+	}
+	return roots, nil
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"time"
+
+	"ai-dev-agent/service/gitrepo"
+	"ai-dev-agent/service/orchestrator"
+)
+
+// worktree is a git worktree holding one task's changes on its own branch,
+// so the user's working tree and its uncommitted edits are never touched.
+type worktree struct {
+	git       *gitrepo.Client
+	repo      string // top level of the user's working tree
+	path      string
+	dir       string // workdir inside the worktree; written paths are relative to it
+	branch    string
+	committed bool
+}
+
+// openWorktree adds a worktree for cmd at HEAD and points config.WorkDir at
+// the matching directory inside it. History stays with the user's tree.
+func openWorktree(ctx context.Context, config *Config, cmd *Command) (*worktree, error) {
+	git := gitrepo.NewClient(gitrepo.Config{})
+	workDir, err := filepath.Abs(config.WorkDir)
+	if err != nil {
+		return nil, err
+	}
+	// git reports the top level with symlinks resolved.
+	if real, err := filepath.EvalSymlinks(workDir); err == nil {
+		workDir = real
+	}
+	repo, err := git.Root(ctx, workDir)
+	if err != nil {
+		return nil, fmt.Errorf("--worktree needs a git repository: %w", err)
+	}
+	gitDir, err := git.GitDir(ctx, repo)
+	if err != nil {
+		return nil, err
+	}
+	rel, err := filepath.Rel(repo, workDir)
+	if err != nil {
+		return nil, err
+	}
+
+	name := fmt.Sprintf("%s-%s", cmd.Type, time.Now().Format("20060102-150405"))
+	wt := &worktree{
+		git:    git,
+		repo:   repo,
+		path:   filepath.Join(gitDir, "aidev", "worktrees", name),
+		branch: "aidev/" + name,
+	}
+	if err := git.AddWorktree(ctx, repo, wt.path, wt.branch); err != nil {
+		return nil, err
+	}
+	if config.Verbose {
+		fmt.Printf("  Worktree: %s (%s)\n", wt.path, wt.branch)
+	}
+	wt.dir = filepath.Join(wt.path, rel)
+	config.StateRoot = workDir
+	config.WorkDir = wt.dir
+	return wt, nil
+}
+
+// finish commits the written files to the task branch and tells the user
+// how to review and merge it.
+func (w *worktree) finish(ctx context.Context, cmd *Command, result *orchestrator.Result) error {
+	if len(result.FilesWritten) == 0 {
+		return nil
+	}
+	message := fmt.Sprintf("aidev %s", cmd.Type)
+	if cmd.Instruction != "" {
+		message += ": " + cmd.Instruction
+	}
+	if err := w.git.Commit(ctx, w.dir, "", message, result.FilesWritten); err != nil {
+		return err
+	}
+	w.committed = true
+	fmt.Printf("\n🌿 Changes committed to branch %s\n", w.branch)
+	fmt.Printf("   Review: git diff HEAD...%s\n", w.branch)
+	fmt.Printf("   Merge:  git merge %s\n", w.branch)
+	return nil
+}
+
+// close removes the worktree, and its branch unless it holds changes.
+func (w *worktree) close(ctx context.Context) {
+	if err := w.git.RemoveWorktree(ctx, w.repo, w.path); err != nil {
+		fmt.Printf("  ⚠ Could not remove worktree %s: %v\n", w.path, err)
+	}
+	if !w.committed {
+		w.git.DeleteBranch(ctx, w.repo, w.branch)
+	}
+}
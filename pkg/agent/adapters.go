@@ -0,0 +1,164 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+
+	"ai-dev-agent/service/diagnose"
+	"ai-dev-agent/service/executor"
+	"ai-dev-agent/service/filesystem"
+	"ai-dev-agent/service/llm"
+	"ai-dev-agent/service/orchestrator"
+	"ai-dev-agent/service/prompt"
+)
+
+// The services below connect the engine to the workspace, the prompt
+// builder, the model and the shell, like the adapters of the aidev
+// command without its recording and terminal output.
+
+type fileService struct {
+	mgr *filesystem.Manager
+}
+
+func (s *fileService) ReadFile(path string) (string, error) {
+	content, err := s.mgr.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	return content.Content, nil
+}
+
+func (s *fileService) WriteFile(path, content string) error {
+	_, err := s.mgr.WriteFile(path, content, true)
+	return err
+}
+
+func (s *fileService) FileExists(path string) bool { return s.mgr.FileExists(path) }
+
+// promptService starts a separate draft for every prompt, so concurrent
+// operations never share builder state.
+type promptService struct {
+	model string
+}
+
+func (s *promptService) SetMode(mode string) orchestrator.PromptService {
+	return &promptDraft{model: s.model, mode: mode}
+}
+
+func (s *promptService) SetInstruction(instruction string) orchestrator.PromptService {
+	return s.SetMode("").SetInstruction(instruction)
+}
+
+func (s *promptService) AddFile(path, content string, isMain bool) orchestrator.PromptService {
+	return s.SetMode("").AddFile(path, content, isMain)
+}
+
+func (s *promptService) AddConstraint(constraint string) orchestrator.PromptService {
+	return s.SetMode("").AddConstraint(constraint)
+}
+
+func (s *promptService) Build() ([]orchestrator.Message, error) {
+	return s.SetMode("").Build()
+}
+
+// promptDraft is one prompt being built.
+type promptDraft struct {
+	model string
+	mode  string
+	inst  string
+	files map[string]string
+	main  map[string]bool
+	cons  []string
+}
+
+func (d *promptDraft) SetMode(mode string) orchestrator.PromptService {
+	return &promptDraft{model: d.model, mode: mode}
+}
+
+func (d *promptDraft) SetInstruction(instruction string) orchestrator.PromptService {
+	d.inst = instruction
+	return d
+}
+
+func (d *promptDraft) AddFile(path, content string, isMain bool) orchestrator.PromptService {
+	if d.files == nil {
+		d.files = make(map[string]string)
+		d.main = make(map[string]bool)
+	}
+	d.files[path] = content
+	d.main[path] = isMain
+	return d
+}
+
+func (d *promptDraft) AddConstraint(constraint string) orchestrator.PromptService {
+	d.cons = append(d.cons, constraint)
+	return d
+}
+
+func (d *promptDraft) Build() ([]orchestrator.Message, error) {
+	b := prompt.NewBuilder(prompt.ConfigForModel(d.model))
+	b.SetMode(d.mode)
+	b.SetInstruction(d.inst)
+	for p, c := range d.files {
+		b.AddFile(p, c, d.main[p])
+	}
+	for _, c := range d.cons {
+		b.AddConstraint(c)
+	}
+	result, err := b.Build()
+	if err != nil {
+		return nil, err
+	}
+	if len(result.Messages) == 0 {
+		return nil, fmt.Errorf("no messages in prompt")
+	}
+	messages := make([]orchestrator.Message, len(result.Messages))
+	for i, m := range result.Messages {
+		messages[i] = orchestrator.Message{Role: string(m.Role), Content: m.Content}
+	}
+	return messages, nil
+}
+
+type llmService struct {
+	client *llm.Client
+}
+
+func (s *llmService) Chat(ctx context.Context, messages []orchestrator.Message) (string, error) {
+	converted := make([]llm.Message, len(messages))
+	for i, m := range messages {
+		converted[i] = llm.Message{Role: m.Role, Content: m.Content}
+		for _, img := range m.Images {
+			converted[i].Images = append(converted[i].Images, img.DataURL())
+		}
+	}
+	resp, err := s.client.ChatCompletion(ctx, llm.ChatCompletionRequest{Messages: converted})
+	if err != nil {
+		return "", err
+	}
+	if len(resp.Choices) == 0 {
+		return "", fmt.Errorf("no choices in response")
+	}
+	return resp.Choices[0].Message.Content, nil
+}
+
+type execService struct {
+	exec *executor.Executor
+}
+
+// ExecuteInDir runs name with args in dir, stopping it when ctx is done.
+func (s *execService) ExecuteInDir(ctx context.Context, dir, name string, args ...string) (*diagnose.VerificationResult, error) {
+	return s.ExecuteInDirEnv(ctx, nil, dir, name, args...)
+}
+
+// ExecuteInDirEnv is ExecuteInDir with env set over the environment.
+func (s *execService) ExecuteInDirEnv(ctx context.Context, env map[string]string, dir, name string, args ...string) (*diagnose.VerificationResult, error) {
+	opts := executor.DefaultOptions()
+	opts.WorkingDir = dir
+	opts.Env = env
+	opts.Retry = executor.NetworkRetryPolicy()
+	result, err := s.exec.ExecuteArgsWithOptions(ctx, opts, name, args...)
+	if err != nil {
+		return nil, err
+	}
+	return diagnose.NewVerificationResult(result.Command, result.ExitCode, result.Combined, result.Duration), nil
+}
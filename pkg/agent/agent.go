@@ -0,0 +1,214 @@
+// Package agent embeds the AI Dev Agent in Go programs.
+//
+// An Agent refactors, fixes and generates code in a workspace with the same
+// engine as the aidev command: it prompts the model, parses the code it
+// returns, writes the files (with backups) and verifies the build,
+// retrying with the build errors when verification fails.
+//
+//	a, err := agent.New(agent.WithWorkDir("."), agent.WithModel("glm-4-plus"))
+//	if err != nil {
+//		return err
+//	}
+//	result, err := a.Fix(ctx, "Fix the nil pointer in Login", "server/auth.go")
+//
+// The package follows semantic versioning, reported by Version: exported
+// identifiers, including the aliased engine types, change incompatibly
+// only with a new major version.
+package agent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"ai-dev-agent/service/diagnose"
+	"ai-dev-agent/service/executor"
+	"ai-dev-agent/service/filesystem"
+	"ai-dev-agent/service/llm"
+	"ai-dev-agent/service/orchestrator"
+)
+
+// Version is the version of the package API.
+const Version = "1.0.0"
+
+// ErrNoAPIKey is returned by New when no API key is given or set in the
+// environment.
+var ErrNoAPIKey = errors.New("agent: API key required (WithAPIKey, GLM_API_KEY or ZHIPUAI_API_KEY)")
+
+// Engine types, shared with the aidev command.
+type (
+	// Request describes an operation for Run.
+	Request = orchestrator.Request
+	// Result reports the outcome of an operation.
+	Result = orchestrator.Result
+	// Mode is the kind of operation.
+	Mode = orchestrator.Mode
+	// Event reports the progress of an operation to WithEvents.
+	Event = orchestrator.Event
+	// EventType identifies an Event.
+	EventType = orchestrator.EventType
+	// Logger receives the engine's progress messages.
+	Logger = orchestrator.Logger
+	// Diagnosis is the result of Diagnose.
+	Diagnosis = diagnose.DiagnosticResult
+	// Issue is a problem found by Diagnose.
+	Issue = diagnose.Issue
+)
+
+// Modes.
+const (
+	ModeRefactor = orchestrator.ModeRefactor
+	ModeFix      = orchestrator.ModeFix
+	ModeGenerate = orchestrator.ModeGenerate
+)
+
+// Event types.
+const (
+	EventStart    = orchestrator.EventStart
+	EventAttempt  = orchestrator.EventAttempt
+	EventResponse = orchestrator.EventResponse
+	EventWrite    = orchestrator.EventWrite
+	EventVerify   = orchestrator.EventVerify
+	EventFailure  = orchestrator.EventFailure
+	EventDone     = orchestrator.EventDone
+	EventProgress = orchestrator.EventProgress
+)
+
+// Agent runs operations in one workspace. It is safe for concurrent use
+// on different files.
+type Agent struct {
+	opts   options
+	engine *orchestrator.Engine
+}
+
+// New creates an agent. The API key defaults to GLM_API_KEY (or
+// ZHIPUAI_API_KEY) and the workspace to the current directory.
+func New(opts ...Option) (*Agent, error) {
+	o := defaultOptions()
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if o.apiKey == "" {
+		o.apiKey = os.Getenv("GLM_API_KEY")
+	}
+	if o.apiKey == "" {
+		o.apiKey = os.Getenv("ZHIPUAI_API_KEY")
+	}
+	if o.apiKey == "" {
+		return nil, ErrNoAPIKey
+	}
+	if o.workDir == "" {
+		dir, err := os.Getwd()
+		if err != nil {
+			return nil, err
+		}
+		o.workDir = dir
+	}
+
+	files, err := filesystem.NewManager(filesystem.Config{RootDir: o.workDir, BackupEnabled: o.backups})
+	if err != nil {
+		return nil, fmt.Errorf("agent: workspace: %w", err)
+	}
+	client, err := llm.NewClient(llm.Config{
+		APIKey:     o.apiKey,
+		BaseURL:    o.baseURL,
+		Model:      o.model,
+		Timeout:    o.timeout,
+		MaxRetries: o.maxRetries,
+		Options:    o.providerOptions,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("agent: llm: %w", err)
+	}
+
+	ec := orchestrator.DefaultConfig()
+	ec.MaxRetries = o.maxRetries
+	ec.BuildVerify = o.buildVerify
+	ec.DryRun = o.dryRun
+	ec.Logger = o.logger
+	ec.Events = o.events
+	ec.FormatGo = true
+
+	engine := orchestrator.NewEngine(
+		&fileService{mgr: files},
+		&promptService{model: o.model},
+		&llmService{client: client},
+		&execService{exec: executor.NewExecutor(executor.DefaultOptions())},
+		ec,
+	)
+	return &Agent{opts: o, engine: engine}, nil
+}
+
+// WorkDir returns the workspace root.
+func (a *Agent) WorkDir() string {
+	return a.opts.workDir
+}
+
+// Run executes req. The error is the result's error when the operation
+// failed; the result is returned either way.
+func (a *Agent) Run(ctx context.Context, req Request) (*Result, error) {
+	if req.WorkDir == "" {
+		req.WorkDir = a.opts.workDir
+	}
+	result := a.engine.Execute(ctx, &req)
+	if !result.Success {
+		return result, result.Error
+	}
+	return result, nil
+}
+
+// Refactor rewrites files according to instruction, preserving behavior.
+func (a *Agent) Refactor(ctx context.Context, instruction string, files ...string) (*Result, error) {
+	return a.Run(ctx, Request{Mode: ModeRefactor, Files: files, Instruction: instruction})
+}
+
+// Fix fixes the bugs described by instruction in files.
+func (a *Agent) Fix(ctx context.Context, instruction string, files ...string) (*Result, error) {
+	return a.Run(ctx, Request{Mode: ModeFix, Files: files, Instruction: instruction})
+}
+
+// Generate writes new code to files according to instruction.
+func (a *Agent) Generate(ctx context.Context, instruction string, files ...string) (*Result, error) {
+	return a.Run(ctx, Request{Mode: ModeGenerate, Files: files, Instruction: instruction})
+}
+
+// Diagnose checks the workspace's configuration, dependencies, build,
+// vet and tests without changing anything. Fix the issues it finds with
+// Fix.
+func (a *Agent) Diagnose(ctx context.Context) (*Diagnosis, error) {
+	d := diagnose.NewDiagnoser(diagnose.Config{
+		ProjectPath: a.opts.workDir,
+		Timeout:     a.opts.diagnoseTimeout,
+		CheckConfig: true,
+		CheckDeps:   true,
+		CheckBuild:  true,
+		CheckTests:  true,
+		CheckLint:   true,
+		Retry:       executor.NetworkRetryPolicy(),
+	})
+	return d.Run(ctx)
+}
+
+// Helper functions
+
+func defaultOptions() options {
+	return options{
+		model:           "glm-4-flash",
+		maxRetries:      3,
+		timeout:         2 * time.Minute,
+		backups:         true,
+		buildVerify:     true,
+		logger:          nopLogger{},
+		diagnoseTimeout: 5 * time.Minute,
+	}
+}
+
+// nopLogger discards the engine's messages; embedders opt in with
+// WithLogger.
+type nopLogger struct{}
+
+func (nopLogger) Info(string, ...interface{})  {}
+func (nopLogger) Error(string, ...interface{}) {}
+func (nopLogger) Debug(string, ...interface{}) {}
@@ -0,0 +1,92 @@
+package agent
+
+import "time"
+
+// Option configures an Agent.
+type Option func(*options)
+
+type options struct {
+	apiKey          string
+	baseURL         string
+	model           string
+	workDir         string
+	maxRetries      int
+	timeout         time.Duration
+	dryRun          bool
+	backups         bool
+	buildVerify     bool
+	providerOptions map[string]interface{}
+	logger          Logger
+	events          func(Event)
+	diagnoseTimeout time.Duration
+}
+
+// WithAPIKey sets the provider API key.
+func WithAPIKey(key string) Option {
+	return func(o *options) { o.apiKey = key }
+}
+
+// WithBaseURL sets the provider's OpenAI-compatible API root (default:
+// the Zhipu GLM API).
+func WithBaseURL(url string) Option {
+	return func(o *options) { o.baseURL = url }
+}
+
+// WithModel sets the model (default: glm-4-flash).
+func WithModel(name string) Option {
+	return func(o *options) { o.model = name }
+}
+
+// WithWorkDir sets the workspace root that file paths are relative to.
+func WithWorkDir(dir string) Option {
+	return func(o *options) { o.workDir = dir }
+}
+
+// WithMaxRetries sets how many attempts an operation gets (default: 3).
+func WithMaxRetries(n int) Option {
+	return func(o *options) { o.maxRetries = n }
+}
+
+// WithTimeout bounds each model request (default: 2m).
+func WithTimeout(d time.Duration) Option {
+	return func(o *options) { o.timeout = d }
+}
+
+// WithDryRun verifies changes without writing them; the verified files
+// are returned in Result.Candidates.
+func WithDryRun() Option {
+	return func(o *options) { o.dryRun = true }
+}
+
+// WithoutBackups stops the agent from backing up files it overwrites.
+func WithoutBackups() Option {
+	return func(o *options) { o.backups = false }
+}
+
+// WithoutBuildVerify accepts changes without building the workspace.
+func WithoutBuildVerify() Option {
+	return func(o *options) { o.buildVerify = false }
+}
+
+// WithProviderOptions adds provider-specific fields to every request
+// body, e.g. do_sample or num_ctx.
+func WithProviderOptions(opts map[string]interface{}) Option {
+	return func(o *options) { o.providerOptions = opts }
+}
+
+// WithLogger receives the engine's progress messages, which are discarded
+// by default.
+func WithLogger(l Logger) Option {
+	return func(o *options) { o.logger = l }
+}
+
+// WithEvents receives typed progress events. The callback runs on the
+// goroutine of the operation.
+func WithEvents(fn func(Event)) Option {
+	return func(o *options) { o.events = fn }
+}
+
+// WithDiagnoseTimeout bounds each check run by Diagnose (default: 5m).
+func WithDiagnoseTimeout(d time.Duration) Option {
+	return func(o *options) { o.diagnoseTimeout = d }
+}
@@ -0,0 +1,201 @@
+// Package astmerge restores the comments and layout a model dropped when
+// rewriting a Go file, so diffs show only intentional changes.
+package astmerge
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/printer"
+	"go/token"
+	"sort"
+	"strings"
+)
+
+// Merge returns after with the original text of every top-level
+// declaration whose code is unchanged from before (keeping its comments
+// and blank lines), the doc comments of changed declarations that lost
+// theirs, and the package comment. The result is gofmt'ed if before was,
+// so a file kept in its own style stays that way. It returns after
+// unchanged if either version doesn't parse.
+func Merge(before, after string) (string, error) {
+	old, err := parseFile(before)
+	if err != nil {
+		return after, nil
+	}
+	cur, err := parseFile(after)
+	if err != nil {
+		return after, nil
+	}
+
+	oldDecls := make(map[string]*decl)
+	for _, d := range old.decls {
+		oldDecls[d.key] = d
+	}
+
+	type edit struct {
+		start, end int
+		text       string
+	}
+	var edits []edit
+	for _, d := range cur.decls {
+		o, ok := oldDecls[d.key]
+		if !ok {
+			continue
+		}
+		switch {
+		case o.code == d.code:
+			// Unchanged: keep the original text, comments and all.
+			edits = append(edits, edit{d.start, d.end, before[o.start:o.end]})
+		case d.doc == "" && o.doc != "":
+			edits = append(edits, edit{d.start, d.start, o.doc + "\n"})
+		}
+	}
+	if cur.file.Doc == nil && old.file.Doc != nil {
+		start := old.fset.Position(old.file.Doc.Pos()).Offset
+		end := old.fset.Position(old.file.Doc.End()).Offset
+		pkg := cur.fset.Position(cur.file.Package).Offset
+		edits = append(edits, edit{pkg, pkg, before[start:end] + "\n"})
+	}
+
+	sort.Slice(edits, func(i, j int) bool { return edits[i].start > edits[j].start })
+	out := after
+	for _, e := range edits {
+		out = out[:e.start] + e.text + out[e.end:]
+	}
+	if !gofmted(before) {
+		if _, err := parser.ParseFile(token.NewFileSet(), "", out, parser.SkipObjectResolution); err != nil {
+			return "", fmt.Errorf("merged file does not parse: %w", err)
+		}
+		return out, nil
+	}
+	formatted, err := format.Source([]byte(out))
+	if err != nil {
+		return "", fmt.Errorf("merged file does not parse: %w", err)
+	}
+	return string(formatted), nil
+}
+
+// Helper functions
+
+func gofmted(src string) bool {
+	formatted, err := format.Source([]byte(src))
+	return err == nil && string(formatted) == src
+}
+
+type parsedFile struct {
+	fset  *token.FileSet
+	file  *ast.File
+	decls []*decl
+}
+
+// decl is a top-level declaration with its text span (doc comment
+// included) and its code printed without comments.
+type decl struct {
+	key        string
+	start, end int
+	doc        string
+	code       string
+}
+
+func parseFile(src string) (*parsedFile, error) {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "", src, parser.ParseComments|parser.SkipObjectResolution)
+	if err != nil {
+		return nil, err
+	}
+	p := &parsedFile{fset: fset, file: file}
+	seen := make(map[string]int)
+	for _, d := range file.Decls {
+		// Keys stay unique for repeated names such as init funcs.
+		key := declKey(d)
+		seen[key]++
+		if n := seen[key]; n > 1 {
+			key = fmt.Sprintf("%s#%d", key, n)
+		}
+		start, doc := d.Pos(), ""
+		if g := docOf(d); g != nil {
+			start = g.Pos()
+			doc = src[fset.Position(g.Pos()).Offset:fset.Position(g.End()).Offset]
+		}
+		p.decls = append(p.decls, &decl{
+			key:   key,
+			start: fset.Position(start).Offset,
+			end:   fset.Position(d.End()).Offset,
+			doc:   doc,
+			code:  printCode(fset, d),
+		})
+	}
+	return p, nil
+}
+
+func docOf(d ast.Decl) *ast.CommentGroup {
+	switch d := d.(type) {
+	case *ast.FuncDecl:
+		return d.Doc
+	case *ast.GenDecl:
+		return d.Doc
+	}
+	return nil
+}
+
+// printCode prints a declaration without comments and with whitespace
+// collapsed, for comparison.
+func printCode(fset *token.FileSet, d ast.Decl) string {
+	switch d := d.(type) {
+	case *ast.FuncDecl:
+		c := *d
+		c.Doc = nil
+		return collapse(fset, &c)
+	case *ast.GenDecl:
+		c := *d
+		c.Doc = nil
+		return collapse(fset, &c)
+	}
+	return collapse(fset, d)
+}
+
+func collapse(fset *token.FileSet, node ast.Node) string {
+	var buf bytes.Buffer
+	if err := printer.Fprint(&buf, fset, node); err != nil {
+		return ""
+	}
+	return strings.Join(strings.Fields(buf.String()), " ")
+}
+
+func declKey(d ast.Decl) string {
+	switch d := d.(type) {
+	case *ast.FuncDecl:
+		if d.Recv != nil && len(d.Recv.List) > 0 {
+			return fmt.Sprintf("method %s.%s", recvName(d.Recv.List[0].Type), d.Name.Name)
+		}
+		return "func " + d.Name.Name
+	case *ast.GenDecl:
+		if len(d.Specs) > 0 {
+			switch s := d.Specs[0].(type) {
+			case *ast.TypeSpec:
+				return "type " + s.Name.Name
+			case *ast.ValueSpec:
+				return d.Tok.String() + " " + s.Names[0].Name
+			}
+		}
+		return d.Tok.String()
+	}
+	return "decl"
+}
+
+func recvName(expr ast.Expr) string {
+	switch e := expr.(type) {
+	case *ast.StarExpr:
+		return recvName(e.X)
+	case *ast.IndexExpr:
+		return recvName(e.X)
+	case *ast.IndexListExpr:
+		return recvName(e.X)
+	case *ast.Ident:
+		return e.Name
+	}
+	return "?"
+}
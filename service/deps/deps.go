@@ -0,0 +1,279 @@
+// Package deps detects third-party imports that a Go module does not yet
+// require, resolves them to modules and checks them against OSV before
+// they are added. It also builds the import graph of the module's
+// packages and checks it for cycles and against layering rules.
+package deps
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go/parser"
+	"go/token"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Errors
+var (
+	ErrNoModule   = errors.New("no go.mod found")
+	ErrUnresolved = errors.New("no module provides the import")
+)
+
+// DefaultOSVURL is the OSV query endpoint.
+const DefaultOSVURL = "https://api.osv.dev/v1/query"
+
+// Module is a resolved module version.
+type Module struct {
+	Path    string
+	Version string
+	Imports []string // imports that made the module necessary
+}
+
+// Vulnerability is an OSV advisory affecting a module version.
+type Vulnerability struct {
+	ID      string `json:"id"`
+	Summary string `json:"summary"`
+}
+
+// GoMod is the subset of go.mod the checker needs.
+type GoMod struct {
+	Module  string
+	Require map[string]string
+}
+
+// Config holds checker configuration.
+type Config struct {
+	OSVURL  string
+	Timeout time.Duration
+}
+
+// DefaultConfig returns a default configuration.
+func DefaultConfig() Config {
+	return Config{OSVURL: DefaultOSVURL, Timeout: 30 * time.Second}
+}
+
+// Checker inspects candidate files for new dependencies.
+type Checker struct {
+	config Config
+	client *http.Client
+}
+
+// NewChecker creates a new checker.
+func NewChecker(config Config) *Checker {
+	if config.OSVURL == "" {
+		config.OSVURL = DefaultOSVURL
+	}
+	if config.Timeout == 0 {
+		config.Timeout = 30 * time.Second
+	}
+	return &Checker{config: config, client: &http.Client{Timeout: config.Timeout}}
+}
+
+// ReadGoMod parses the module path and requirements of dir/go.mod.
+func ReadGoMod(dir string) (*GoMod, error) {
+	f, err := os.Open(filepath.Join(dir, "go.mod"))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, ErrNoModule
+		}
+		return nil, err
+	}
+	defer f.Close()
+
+	mod := &GoMod{Require: make(map[string]string)}
+	inRequire := false
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if i := strings.Index(line, "//"); i >= 0 {
+			line = strings.TrimSpace(line[:i])
+		}
+		fields := strings.Fields(line)
+		switch {
+		case len(fields) == 0:
+		case inRequire && fields[0] == ")":
+			inRequire = false
+		case inRequire && len(fields) >= 2:
+			mod.Require[fields[0]] = fields[1]
+		case fields[0] == "module" && len(fields) >= 2:
+			mod.Module = strings.Trim(fields[1], `"`)
+		case fields[0] == "require" && len(fields) >= 2 && fields[1] == "(":
+			inRequire = true
+		case fields[0] == "require" && len(fields) >= 3:
+			mod.Require[fields[1]] = fields[2]
+		}
+	}
+	return mod, scanner.Err()
+}
+
+// Provides reports whether the module or one of its requirements
+// provides the import path.
+func (m *GoMod) Provides(importPath string) bool {
+	if within(importPath, m.Module) {
+		return true
+	}
+	for path := range m.Require {
+		if within(importPath, path) {
+			return true
+		}
+	}
+	return false
+}
+
+// MissingImports returns the third-party imports of the Go files in files
+// (path -> content) that the module in workDir does not require yet.
+func MissingImports(workDir string, files map[string]string) ([]string, error) {
+	mod, err := ReadGoMod(workDir)
+	if err != nil {
+		return nil, err
+	}
+
+	seen := make(map[string]bool)
+	fset := token.NewFileSet()
+	for path, content := range files {
+		if filepath.Ext(path) != ".go" {
+			continue
+		}
+		f, err := parser.ParseFile(fset, path, content, parser.ImportsOnly)
+		if err != nil {
+			continue
+		}
+		for _, imp := range f.Imports {
+			p, err := strconv.Unquote(imp.Path.Value)
+			if err != nil || isStdlib(p) || mod.Provides(p) {
+				continue
+			}
+			seen[p] = true
+		}
+	}
+
+	missing := make([]string, 0, len(seen))
+	for p := range seen {
+		missing = append(missing, p)
+	}
+	sort.Strings(missing)
+	return missing, nil
+}
+
+// Resolve maps import paths to the latest versions of the modules that
+// provide them. Imports that cannot be resolved are returned separately.
+func (c *Checker) Resolve(ctx context.Context, workDir string, imports []string) ([]Module, []string) {
+	byPath := make(map[string]*Module)
+	var unresolved []string
+	for _, imp := range imports {
+		mod, err := c.resolve(ctx, workDir, imp)
+		if err != nil {
+			unresolved = append(unresolved, imp)
+			continue
+		}
+		if existing, ok := byPath[mod.Path]; ok {
+			existing.Imports = append(existing.Imports, imp)
+			continue
+		}
+		mod.Imports = []string{imp}
+		byPath[mod.Path] = &mod
+	}
+
+	modules := make([]Module, 0, len(byPath))
+	for _, mod := range byPath {
+		modules = append(modules, *mod)
+	}
+	sort.Slice(modules, func(i, j int) bool { return modules[i].Path < modules[j].Path })
+	return modules, unresolved
+}
+
+// resolve tries successively shorter prefixes of the import path until
+// one names a module.
+func (c *Checker) resolve(ctx context.Context, workDir, importPath string) (Module, error) {
+	for candidate := importPath; strings.Contains(candidate, "/"); candidate = candidate[:strings.LastIndex(candidate, "/")] {
+		cmd := exec.CommandContext(ctx, "go", "list", "-m", "-json", candidate+"@latest")
+		cmd.Dir = workDir
+		out, err := cmd.Output()
+		if err != nil {
+			continue
+		}
+		var info struct {
+			Path    string
+			Version string
+		}
+		if err := json.Unmarshal(out, &info); err == nil && info.Path != "" {
+			return Module{Path: info.Path, Version: info.Version}, nil
+		}
+	}
+	return Module{}, fmt.Errorf("%s: %w", importPath, ErrUnresolved)
+}
+
+// Vulnerabilities queries OSV for advisories affecting the module version.
+func (c *Checker) Vulnerabilities(ctx context.Context, mod Module) ([]Vulnerability, error) {
+	query := map[string]interface{}{
+		"package": map[string]string{"name": mod.Path, "ecosystem": "Go"},
+		"version": strings.TrimPrefix(mod.Version, "v"),
+	}
+	body, err := json.Marshal(query)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.config.OSVURL, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("osv query: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("osv query: status %d", resp.StatusCode)
+	}
+
+	var result struct {
+		Vulns []Vulnerability `json:"vulns"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("osv response: %w", err)
+	}
+	return result.Vulns, nil
+}
+
+// Get adds the module version to go.mod, or to modFile and the go.sum
+// beside it if not empty, leaving workDir's own untouched.
+func (c *Checker) Get(ctx context.Context, workDir, modFile string, mod Module) error {
+	args := []string{"get"}
+	if modFile != "" {
+		args = append(args, "-modfile="+modFile)
+	}
+	cmd := exec.CommandContext(ctx, "go", append(args, mod.Path+"@"+mod.Version)...)
+	cmd.Dir = workDir
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("go get %s: %s", mod.Path, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// Helper functions
+
+// isStdlib reports whether the import path belongs to the standard
+// library, whose first element never contains a dot.
+func isStdlib(path string) bool {
+	first := path
+	if i := strings.IndexByte(path, '/'); i >= 0 {
+		first = path[:i]
+	}
+	return !strings.Contains(first, ".")
+}
+
+func within(importPath, modulePath string) bool {
+	return modulePath != "" && (importPath == modulePath || strings.HasPrefix(importPath, modulePath+"/"))
+}
@@ -0,0 +1,235 @@
+package deps
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+
+	"ai-dev-agent/service/index"
+)
+
+// Package is a package of the module in the import graph.
+type Package struct {
+	Path    string              // directory relative to the module root, "." for the root
+	Files   []string            // its Go files, tests excluded
+	Imports map[string][]string // import path -> files importing it
+}
+
+// Graph is the import graph of a module's packages, built from the index.
+type Graph struct {
+	Module   string
+	Packages map[string]*Package
+	require  []string // required modules, longest first
+}
+
+// NewGraph builds the import graph of the module from the Go files of the
+// index. Test files are left out, as are vendor and testdata directories:
+// none of them are imported by the module's packages.
+func NewGraph(mod *GoMod, entries []index.Entry) *Graph {
+	g := &Graph{Module: mod.Module, Packages: make(map[string]*Package)}
+	for req := range mod.Require {
+		g.require = append(g.require, req)
+	}
+	sort.Slice(g.require, func(i, j int) bool { return len(g.require[i]) > len(g.require[j]) })
+
+	for _, e := range entries {
+		if !strings.HasSuffix(e.Path, ".go") || strings.HasSuffix(e.Path, "_test.go") || skipDir(e.Path) {
+			continue
+		}
+		dir := path.Dir(e.Path)
+		pkg := g.Packages[dir]
+		if pkg == nil {
+			pkg = &Package{Path: dir, Imports: make(map[string][]string)}
+			g.Packages[dir] = pkg
+		}
+		pkg.Files = append(pkg.Files, e.Path)
+		for _, imp := range e.Imports {
+			pkg.Imports[imp] = append(pkg.Imports[imp], e.Path)
+		}
+	}
+	return g
+}
+
+// Local returns the directory of an import path within the module.
+func (g *Graph) Local(importPath string) (string, bool) {
+	switch {
+	case importPath == g.Module:
+		return ".", true
+	case within(importPath, g.Module):
+		return importPath[len(g.Module)+1:], true
+	}
+	return "", false
+}
+
+// ModuleOf returns the required module providing an import path, the path
+// itself if no requirement does, or "" for the standard library.
+func (g *Graph) ModuleOf(importPath string) string {
+	for _, req := range g.require {
+		if within(importPath, req) {
+			return req
+		}
+	}
+	if isStdlib(importPath) {
+		return ""
+	}
+	return importPath
+}
+
+// Edges returns the module's packages each package imports, sorted.
+func (g *Graph) Edges(pkg *Package) []string {
+	var edges []string
+	for imp := range pkg.Imports {
+		if dir, ok := g.Local(imp); ok && g.Packages[dir] != nil && dir != pkg.Path {
+			edges = append(edges, dir)
+		}
+	}
+	sort.Strings(edges)
+	return edges
+}
+
+// Cycles returns the import cycles among the module's packages: each is a
+// strongly connected set of packages, sorted, and the cycles are ordered
+// by their first package.
+func (g *Graph) Cycles() [][]string {
+	// Tarjan's algorithm.
+	var (
+		cycles  [][]string
+		stack   []string
+		onStack = make(map[string]bool)
+		order   = make(map[string]int)
+		low     = make(map[string]int)
+		visit   func(string)
+	)
+	visit = func(p string) {
+		order[p] = len(order)
+		low[p] = order[p]
+		stack = append(stack, p)
+		onStack[p] = true
+		for _, q := range g.Edges(g.Packages[p]) {
+			if _, seen := order[q]; !seen {
+				visit(q)
+				low[p] = min(low[p], low[q])
+			} else if onStack[q] {
+				low[p] = min(low[p], order[q])
+			}
+		}
+		if low[p] != order[p] {
+			return
+		}
+		var scc []string
+		for {
+			q := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			onStack[q] = false
+			scc = append(scc, q)
+			if q == p {
+				break
+			}
+		}
+		if len(scc) > 1 {
+			sort.Strings(scc)
+			cycles = append(cycles, scc)
+		}
+	}
+	for _, p := range g.sortedPackages() {
+		if _, seen := order[p]; !seen {
+			visit(p)
+		}
+	}
+	sort.Slice(cycles, func(i, j int) bool { return cycles[i][0] < cycles[j][0] })
+	return cycles
+}
+
+// DOT writes the graph in Graphviz's DOT language. The modules the
+// packages import are nodes too, with dashed edges.
+func (g *Graph) DOT() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "digraph %q {\n\trankdir=LR;\n\tnode [shape=box];\n", g.Module)
+	g.walk(func(from, to string, external bool) {
+		if to == "" {
+			fmt.Fprintf(&b, "\t%q;\n", from)
+		} else if external {
+			fmt.Fprintf(&b, "\t%q -> %q [style=dashed];\n", from, to)
+		} else {
+			fmt.Fprintf(&b, "\t%q -> %q;\n", from, to)
+		}
+	})
+	b.WriteString("}\n")
+	return b.String()
+}
+
+// Mermaid writes the graph as a Mermaid flowchart.
+func (g *Graph) Mermaid() string {
+	ids := make(map[string]string)
+	id := func(name string) string {
+		if ids[name] == "" {
+			ids[name] = fmt.Sprintf("n%d", len(ids))
+			return fmt.Sprintf(`%s["%s"]`, ids[name], strings.ReplaceAll(name, `"`, "'"))
+		}
+		return ids[name]
+	}
+	var b strings.Builder
+	b.WriteString("graph LR\n")
+	g.walk(func(from, to string, external bool) {
+		if to == "" {
+			fmt.Fprintf(&b, "  %s\n", id(from))
+		} else if external {
+			fmt.Fprintf(&b, "  %s -.-> %s\n", id(from), id(to))
+		} else {
+			fmt.Fprintf(&b, "  %s --> %s\n", id(from), id(to))
+		}
+	})
+	return b.String()
+}
+
+// walk calls edge for every edge of the graph in a stable order, and with
+// an empty to for packages that import nothing outside the standard
+// library.
+func (g *Graph) walk(edge func(from, to string, external bool)) {
+	for _, p := range g.sortedPackages() {
+		pkg := g.Packages[p]
+		edges := g.Edges(pkg)
+		for _, q := range edges {
+			edge(p, q, false)
+		}
+		var external []string
+		seen := make(map[string]bool)
+		for imp := range pkg.Imports {
+			if _, ok := g.Local(imp); ok {
+				continue
+			}
+			if m := g.ModuleOf(imp); m != "" && !seen[m] {
+				seen[m] = true
+				external = append(external, m)
+			}
+		}
+		sort.Strings(external)
+		for _, m := range external {
+			edge(p, m, true)
+		}
+		if len(edges)+len(external) == 0 {
+			edge(p, "", false)
+		}
+	}
+}
+
+func (g *Graph) sortedPackages() []string {
+	paths := make([]string, 0, len(g.Packages))
+	for p := range g.Packages {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// skipDir reports whether a file is in a directory the go command ignores
+// when matching ./...
+func skipDir(file string) bool {
+	for _, elem := range strings.Split(path.Dir(file), "/") {
+		if elem == "vendor" || elem == "testdata" || strings.HasPrefix(elem, "_") || (strings.HasPrefix(elem, ".") && elem != ".") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,208 @@
+package deps
+
+import (
+	"fmt"
+	"go/parser"
+	"go/token"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ArchitectureFile declares the layering rules of a project.
+const ArchitectureFile = "architecture.yaml"
+
+// Rule forbids packages to import others, e.g. "service/* must not import
+// cmd/*". Patterns are package directories relative to the module root,
+// or import paths outside it, in path.Match syntax; one ending in /* or
+// /... also matches every package below.
+type Rule struct {
+	From string
+	To   string
+}
+
+// String writes the rule the way ParseRule reads it.
+func (r Rule) String() string {
+	return r.From + " must not import " + r.To
+}
+
+// Violation is an import a rule forbids.
+type Violation struct {
+	Rule    Rule
+	Package string // importing package, relative to the module root
+	File    string
+	Import  string
+}
+
+// ParseRule reads a rule of the form "<packages> must not import <packages>".
+func ParseRule(s string) (Rule, error) {
+	from, to, ok := strings.Cut(s, " must not import ")
+	from, to = strings.TrimSpace(from), strings.TrimSpace(to)
+	if !ok || from == "" || to == "" {
+		return Rule{}, fmt.Errorf("rule %q: want \"<packages> must not import <packages>\"", s)
+	}
+	for _, p := range []string{from, to} {
+		if _, err := path.Match(p, ""); err != nil {
+			return Rule{}, fmt.Errorf("rule %q: pattern %q: %w", s, p, err)
+		}
+	}
+	return Rule{From: from, To: to}, nil
+}
+
+// ParseRules reads a list of rules, stopping at the first bad one.
+func ParseRules(list []string) ([]Rule, error) {
+	rules := make([]Rule, 0, len(list))
+	for _, s := range list {
+		r, err := ParseRule(s)
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, r)
+	}
+	return rules, nil
+}
+
+// LoadArchitecture reads the rules of an architecture file:
+//
+//	rules:
+//	  - service/* must not import cmd/*
+//	  - pkg/... must not import service/...
+func LoadArchitecture(file string) ([]Rule, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	var arch struct {
+		Rules []string `yaml:"rules"`
+	}
+	if err := yaml.Unmarshal(data, &arch); err != nil {
+		return nil, fmt.Errorf("%s: %w", file, err)
+	}
+	rules, err := ParseRules(arch.Rules)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", file, err)
+	}
+	return rules, nil
+}
+
+// Violations returns the imports of the graph's packages the rules
+// forbid, by file.
+func (g *Graph) Violations(rules []Rule) []Violation {
+	var violations []Violation
+	for _, p := range g.sortedPackages() {
+		pkg := g.Packages[p]
+		for imp, files := range pkg.Imports {
+			for _, file := range files {
+				violations = append(violations, g.CheckImports(rules, p, file, []string{imp})...)
+			}
+		}
+	}
+	sort.SliceStable(violations, func(i, j int) bool {
+		if violations[i].File != violations[j].File {
+			return violations[i].File < violations[j].File
+		}
+		return violations[i].Import < violations[j].Import
+	})
+	return violations
+}
+
+// CheckImports returns the imports of a file of package pkg the rules
+// forbid.
+func (g *Graph) CheckImports(rules []Rule, pkg, file string, imports []string) []Violation {
+	var violations []Violation
+	for _, imp := range imports {
+		target, local := g.Local(imp)
+		if !local {
+			target = imp
+		}
+		for _, r := range rules {
+			if matchPackage(r.From, pkg) && (matchPackage(r.To, target) || matchPackage(r.To, imp)) {
+				violations = append(violations, Violation{Rule: r, Package: pkg, File: file, Import: imp})
+			}
+		}
+	}
+	return violations
+}
+
+// matchPackage reports whether a package matches a rule pattern.
+func matchPackage(pattern, pkg string) bool {
+	if ok, _ := path.Match(pattern, pkg); ok {
+		return true
+	}
+	for _, suffix := range []string{"/*", "/..."} {
+		if base, ok := strings.CutSuffix(pattern, suffix); ok {
+			if pkg == base || strings.HasPrefix(pkg, base+"/") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// NewViolations returns the imports the files of after (path -> content,
+// relative to workDir) add over before that the rules forbid. Imports a
+// file already had are left alone: they aren't the change's doing.
+func NewViolations(workDir string, rules []Rule, before, after map[string]string) ([]Violation, error) {
+	if len(rules) == 0 {
+		return nil, nil
+	}
+	mod, err := ReadGoMod(workDir)
+	if err != nil {
+		return nil, err
+	}
+	g := NewGraph(mod, nil)
+	var violations []Violation
+	for file, content := range after {
+		if filepath.Ext(file) != ".go" {
+			continue
+		}
+		rel := file
+		if filepath.IsAbs(file) {
+			if rel, err = filepath.Rel(workDir, file); err != nil {
+				continue
+			}
+		}
+		rel = filepath.ToSlash(rel)
+		had := make(map[string]bool)
+		for _, imp := range fileImports(file, before[file]) {
+			had[imp] = true
+		}
+		var added []string
+		for _, imp := range fileImports(file, content) {
+			if !had[imp] {
+				added = append(added, imp)
+			}
+		}
+		violations = append(violations, g.CheckImports(rules, path.Dir(rel), rel, added)...)
+	}
+	sort.Slice(violations, func(i, j int) bool {
+		if violations[i].File != violations[j].File {
+			return violations[i].File < violations[j].File
+		}
+		return violations[i].Import < violations[j].Import
+	})
+	return violations, nil
+}
+
+// fileImports returns the imports of a Go file, none if it doesn't parse.
+func fileImports(path, content string) []string {
+	if content == "" {
+		return nil
+	}
+	f, err := parser.ParseFile(token.NewFileSet(), path, content, parser.ImportsOnly)
+	if err != nil {
+		return nil
+	}
+	imports := make([]string, 0, len(f.Imports))
+	for _, imp := range f.Imports {
+		if p, err := strconv.Unquote(imp.Path.Value); err == nil {
+			imports = append(imports, p)
+		}
+	}
+	return imports
+}
@@ -0,0 +1,77 @@
+package diagnose
+
+import (
+	"fmt"
+	"go/parser"
+	"go/token"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"ai-dev-agent/service/deps"
+)
+
+// ArchitectureIssues reports the import cycles of a module's graph and
+// the imports its layering rules forbid, each on the importing file of
+// the module rooted at root.
+func ArchitectureIssues(root string, g *deps.Graph, rules []deps.Rule) []Issue {
+	var issues []Issue
+	for _, cycle := range g.Cycles() {
+		issue := Issue{
+			ID:          "arch-cycle-" + sanitizeID(strings.Join(cycle, "-")),
+			Category:    CategoryArchitecture,
+			Level:       LevelError,
+			Title:       fmt.Sprintf("Import cycle: %s", strings.Join(cycle, " <-> ")),
+			Description: fmt.Sprintf("The packages %s import each other, which Go doesn't allow", strings.Join(cycle, ", ")),
+			Suggestion:  "Move what both need into a package of its own, or have one side depend on an interface",
+		}
+		// The issue is on a file of the first package importing the next.
+		in := make(map[string]bool, len(cycle))
+		for _, p := range cycle {
+			in[p] = true
+		}
+		pkg := g.Packages[cycle[0]]
+		imports := make([]string, 0, len(pkg.Imports))
+		for imp := range pkg.Imports {
+			imports = append(imports, imp)
+		}
+		sort.Strings(imports)
+		for _, imp := range imports {
+			if dir, ok := g.Local(imp); ok && in[dir] && dir != pkg.Path {
+				file := pkg.Imports[imp][0]
+				issue.File, issue.Line = file, importLine(root, file, imp)
+				break
+			}
+		}
+		issues = append(issues, issue)
+	}
+	for _, v := range g.Violations(rules) {
+		issues = append(issues, Issue{
+			ID:          fmt.Sprintf("arch-layer-%s-%s", sanitizeID(v.File), sanitizeID(v.Import)),
+			Category:    CategoryArchitecture,
+			Level:       LevelError,
+			Title:       fmt.Sprintf("Layering violation: %s imports %s", v.Package, v.Import),
+			Description: fmt.Sprintf("The rule %q forbids the import", v.Rule),
+			Suggestion:  fmt.Sprintf("Remove the import of %s: move the code that needs it to a package allowed to import it, or depend on an interface declared in %s", v.Import, v.Package),
+			File:        v.File,
+			Line:        importLine(root, v.File, v.Import),
+		})
+	}
+	return issues
+}
+
+// importLine returns the line of a file's import of path, or 0.
+func importLine(root, file, path string) int {
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, filepath.Join(root, file), nil, parser.ImportsOnly)
+	if err != nil {
+		return 0
+	}
+	for _, imp := range f.Imports {
+		if p, err := strconv.Unquote(imp.Path.Value); err == nil && p == path {
+			return fset.Position(imp.Pos()).Line
+		}
+	}
+	return 0
+}
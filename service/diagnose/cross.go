@@ -0,0 +1,58 @@
+package diagnose
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"runtime"
+	"strings"
+)
+
+// DefaultPlatforms are the GOOS/GOARCH targets of the cross-compilation
+// check when none are configured.
+var DefaultPlatforms = []string{"linux/amd64", "darwin/arm64", "windows/amd64"}
+
+// checkCross builds the project for each of Config.Platforms other than
+// the host, which the build check covers. Cgo is disabled, since a cross
+// build has no C toolchain for the target; the errors are of the Go code.
+func (d *Diagnoser) checkCross(ctx context.Context) {
+	for _, platform := range d.config.Platforms {
+		goos, goarch, _ := strings.Cut(platform, "/")
+		if goos == runtime.GOOS && goarch == runtime.GOARCH {
+			continue
+		}
+		env := []string{"GOOS=" + goos, "GOARCH=" + goarch, "CGO_ENABLED=0"}
+		build := d.verifyEnv(ctx, env, "go", "build", "-o", os.DevNull, "./...")
+		if ctx.Err() != nil {
+			return
+		}
+		if build.Passed() {
+			if d.config.Verbose {
+				fmt.Printf("✓ Builds for %s\n", platform)
+			}
+			continue
+		}
+		for _, issue := range build.Issues {
+			d.addIssue(crossIssue(platform, goos, issue))
+		}
+	}
+}
+
+// crossIssue marks a build issue as one of platform and suggests the
+// usual remedy for it.
+func crossIssue(platform, goos string, issue Issue) Issue {
+	issue.ID = fmt.Sprintf("cross-%s-%s", sanitizeID(platform), issue.ID)
+	issue.Title = fmt.Sprintf("[%s] %s", platform, issue.Title)
+	msg := issue.Description
+	switch {
+	case strings.Contains(msg, "build constraints exclude all Go files"):
+		issue.Suggestion = fmt.Sprintf("Add an implementation for %s: a file without the build constraint, or one for %s", goos, goos)
+	case strings.Contains(msg, "syscall.") || strings.Contains(msg, "unix.") || strings.Contains(msg, "windows."):
+		issue.Suggestion = fmt.Sprintf("Move the system call behind a build constraint (a _unix.go and a _windows.go file, say) with an implementation for %s, or use a portable API from os or os/exec", goos)
+	case strings.Contains(msg, "undefined"):
+		issue.Suggestion = fmt.Sprintf("The identifier isn't defined on %s; define it in a file built for %s too", goos, goos)
+	default:
+		issue.Suggestion = fmt.Sprintf("Check the code for APIs or file names that don't exist on %s, and use filepath rather than / in paths", goos)
+	}
+	return issue
+}
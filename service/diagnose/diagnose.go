@@ -12,6 +12,9 @@ import (
 	"regexp"
 	"strings"
 	"time"
+
+	"ai-dev-agent/service/errparse"
+	"ai-dev-agent/service/executor"
 )
 
 // IssueLevel represents the severity of an issue.
@@ -35,6 +38,8 @@ const (
 	CategoryTest      IssueCategory = "test"      // Test issues
 	CategoryLint      IssueCategory = "lint"      // Lint issues
 	CategorySecurity  IssueCategory = "security"  // Security issues
+	CategoryAPI       IssueCategory = "api"       // API spec drift
+	CategoryArchitecture IssueCategory = "architecture" // Import cycles and layering
 )
 
 // Issue represents a detected issue.
@@ -70,6 +75,11 @@ type DiagnosticResult struct {
 	TestSuccess    bool      `json:"test_success"`
 	RunSuccess     bool      `json:"run_success"`
 	Summary        string    `json:"summary"`
+	// Verifications holds the build, vet and test runs.
+	Verifications []VerificationResult `json:"verifications,omitempty"`
+	// Footprint is measured when the project builds and CheckFootprint
+	// is set.
+	Footprint *Footprint `json:"footprint,omitempty"`
 }
 
 // Config holds diagnostic configuration.
@@ -85,12 +95,34 @@ type Config struct {
 	AutoFix        bool
 	MaxFixAttempts int
 	Verbose        bool
+	// CheckAPI compares the OpenAPI spec, APISpec or else the first of
+	// openapi.SpecFiles found, with the handlers the code registers.
+	// APISource is the side taken as right: with "code" (the default)
+	// drift is reported on the spec, so that auto-fix updates the spec,
+	// and with "spec" on the handlers.
+	CheckAPI  bool
+	APISpec   string
+	APISource string
+	// Platforms are GOOS/GOARCH targets, e.g. windows/amd64, the project
+	// is also built for; none skips the cross-compilation check.
+	Platforms []string
+	// CheckFootprint measures the build time and binary size of a project
+	// that builds, warning of growth over the median of History, earlier
+	// footprints newest first.
+	CheckFootprint bool
+	History        []Footprint
+	// Retry reruns build, vet and test checks that failed on a transient
+	// error such as a module download; the zero policy runs them once.
+	Retry executor.RetryPolicy
 }
 
 // Diagnoser performs project diagnosis.
 type Diagnoser struct {
-	config Config
-	issues []Issue
+	config        Config
+	issues        []Issue
+	verifications []VerificationResult
+	buildTime     time.Duration // of a build check that passed
+	footprint     *Footprint
 }
 
 // NewDiagnoser creates a new diagnoser.
@@ -122,29 +154,30 @@ func (d *Diagnoser) Run(ctx context.Context) (*DiagnosticResult, error) {
 	}
 	defer os.Chdir(originalDir)
 
-	// Run diagnostic checks
-	if d.config.CheckConfig {
-		d.checkConfig(ctx)
-	}
-
-	if d.config.CheckDeps {
-		d.checkDependencies(ctx)
-	}
-
-	if d.config.CheckBuild {
-		result.BuildSuccess = d.checkBuild(ctx)
-	}
-
-	if d.config.CheckLint {
-		d.checkLint(ctx)
-	}
-
-	if d.config.CheckTests {
-		result.TestSuccess = d.checkTests(ctx)
-	}
-
-	if d.config.CheckRuntime {
-		result.RunSuccess = d.checkRuntime(ctx)
+	// Run diagnostic checks, stopping once ctx is done: a check whose
+	// commands were killed reports nothing useful.
+	checks := []struct {
+		enabled bool
+		run     func(context.Context)
+	}{
+		{d.config.CheckConfig, d.checkConfig},
+		{d.config.CheckDeps, d.checkDependencies},
+		{d.config.CheckBuild, func(ctx context.Context) { result.BuildSuccess = d.checkBuild(ctx) }},
+		{d.config.CheckBuild && d.config.CheckFootprint, d.checkFootprint},
+		{len(d.config.Platforms) > 0, d.checkCross},
+		{d.config.CheckLint, d.checkLint},
+		{d.config.CheckAPI, d.checkAPI},
+		{d.config.CheckTests, func(ctx context.Context) { result.TestSuccess = d.checkTests(ctx) }},
+		{d.config.CheckRuntime, func(ctx context.Context) { result.RunSuccess = d.checkRuntime(ctx) }},
+	}
+	for _, check := range checks {
+		if !check.enabled {
+			continue
+		}
+		check.run(ctx)
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
 	}
 
 	// Compile results
@@ -152,6 +185,8 @@ func (d *Diagnoser) Run(ctx context.Context) (*DiagnosticResult, error) {
 	result.EndTime = endTime
 	result.Duration = endTime.Sub(startTime).String()
 	result.Issues = d.issues
+	result.Verifications = d.verifications
+	result.Footprint = d.footprint
 	result.TotalIssues = len(d.issues)
 
 	for _, issue := range d.issues {
@@ -227,8 +262,9 @@ func (d *Diagnoser) analyzeGoMod(content string) {
 // checkDependencies checks project dependencies.
 func (d *Diagnoser) checkDependencies(ctx context.Context) {
 	// Run go mod verify
-	cmd := exec.CommandContext(ctx, "go", "mod", "verify")
+	cmd, cancel := d.command(ctx, "go", "mod", "verify")
 	output, err := cmd.CombinedOutput()
+	cancel()
 	if err != nil {
 		d.addIssue(Issue{
 			ID:          "dep-verify-failed",
@@ -242,8 +278,9 @@ func (d *Diagnoser) checkDependencies(ctx context.Context) {
 	}
 
 	// Check for unused dependencies
-	cmd = exec.CommandContext(ctx, "go", "mod", "tidy", "-v")
+	cmd, cancel = d.command(ctx, "go", "mod", "tidy", "-v")
 	output, _ = cmd.CombinedOutput()
+	cancel()
 	if strings.Contains(string(output), "unused") {
 		d.addIssue(Issue{
 			ID:          "dep-unused",
@@ -259,16 +296,14 @@ func (d *Diagnoser) checkDependencies(ctx context.Context) {
 
 // checkBuild checks if the project builds successfully.
 func (d *Diagnoser) checkBuild(ctx context.Context) bool {
-	cmd := exec.CommandContext(ctx, "go", "build", "-v", "./...")
-	output, err := cmd.CombinedOutput()
-	
-	if err != nil {
-		issues := d.parseBuildErrors(string(output))
-		for _, issue := range issues {
+	build := d.verify(ctx, "go", "build", "-v", "./...")
+	if !build.Passed() {
+		for _, issue := range build.Issues {
 			d.addIssue(issue)
 		}
 		return false
 	}
+	d.buildTime = build.Duration
 
 	if d.config.Verbose {
 		fmt.Println("✓ Build successful")
@@ -277,12 +312,9 @@ func (d *Diagnoser) checkBuild(ctx context.Context) bool {
 }
 
 // parseBuildErrors parses build error output into issues.
-func (d *Diagnoser) parseBuildErrors(output string) []Issue {
+func parseBuildErrors(output string) []Issue {
 	var issues []Issue
 
-	// Parse Go compiler errors
-	// Format: file.go:line:column: error message
-	errorPattern := regexp.MustCompile(`^([^:]+):(\d+):(\d+):\s*(.+)$`)
 	// Parse undefined errors
 	undefinedPattern := regexp.MustCompile(`undefined:\s*(\w+)`)
 	// Parse import errors
@@ -295,18 +327,18 @@ func (d *Diagnoser) parseBuildErrors(output string) []Issue {
 			continue
 		}
 
-		// Check for standard error format
-		if matches := errorPattern.FindStringSubmatch(line); matches != nil {
+		// Check for standard error format: file.go:line:column: error message
+		if diag, ok := errparse.ParseLine(line); ok {
 			issue := Issue{
 				Category:  CategoryBuild,
 				Level:     LevelError,
-				File:      matches[1],
-				Line:      parseInt(matches[2]),
-				Column:    parseInt(matches[3]),
+				File:      diag.File,
+				Line:      diag.Line,
+				Column:    diag.Column,
 				RawOutput: line,
 			}
 
-			errMsg := matches[4]
+			errMsg := diag.Message
 
 			// Categorize the error
 			if strings.Contains(errMsg, "undefined") {
@@ -324,18 +356,18 @@ func (d *Diagnoser) parseBuildErrors(output string) []Issue {
 					issue.Suggestion = "Check if the package exists and run 'go mod tidy'"
 				}
 			} else if strings.Contains(errMsg, "declared but not used") {
-				issue.ID = fmt.Sprintf("build-unused-%s-%d", sanitizeID(matches[1]), issue.Line)
+				issue.ID = fmt.Sprintf("build-unused-%s-%d", sanitizeID(issue.File), issue.Line)
 				issue.Title = "Unused variable/declaration"
 				issue.Description = errMsg
 				issue.Level = LevelWarning
 				issue.Suggestion = "Remove unused declaration or use the variable"
 			} else if strings.Contains(errMsg, "cannot use") {
-				issue.ID = fmt.Sprintf("build-type-mismatch-%s-%d", sanitizeID(matches[1]), issue.Line)
+				issue.ID = fmt.Sprintf("build-type-mismatch-%s-%d", sanitizeID(issue.File), issue.Line)
 				issue.Title = "Type mismatch"
 				issue.Description = errMsg
 				issue.Suggestion = "Check type compatibility"
 			} else {
-				issue.ID = fmt.Sprintf("build-error-%s-%d", sanitizeID(matches[1]), issue.Line)
+				issue.ID = fmt.Sprintf("build-error-%s-%d", sanitizeID(issue.File), issue.Line)
 				issue.Title = "Build error"
 				issue.Description = errMsg
 			}
@@ -363,18 +395,14 @@ func (d *Diagnoser) checkLint(ctx context.Context) {
 	// Check if golangci-lint is available
 	if _, err := exec.LookPath("golangci-lint"); err != nil {
 		// Fallback to go vet
-		cmd := exec.CommandContext(ctx, "go", "vet", "./...")
-		output, err := cmd.CombinedOutput()
-		if err != nil {
-			issues := d.parseVetErrors(string(output))
-			for _, issue := range issues {
-				d.addIssue(issue)
-			}
+		for _, issue := range d.verify(ctx, "go", "vet", "./...").Issues {
+			d.addIssue(issue)
 		}
 		return
 	}
 
-	cmd := exec.CommandContext(ctx, "golangci-lint", "run", "--timeout", "5m", "--issues-exit-code", "1")
+	cmd, cancel := d.command(ctx, "golangci-lint", "run", "--timeout", "5m", "--issues-exit-code", "1")
+	defer cancel()
 	output, err := cmd.CombinedOutput()
 	if err != nil {
 		issues := d.parseLintErrors(string(output))
@@ -385,23 +413,23 @@ func (d *Diagnoser) checkLint(ctx context.Context) {
 }
 
 // parseVetErrors parses go vet output.
-func (d *Diagnoser) parseVetErrors(output string) []Issue {
+func parseVetErrors(output string) []Issue {
 	var issues []Issue
 
-	errorPattern := regexp.MustCompile(`^([^:]+):(\d+):\s*(.+)$`)
 	lines := strings.Split(output, "\n")
 
 	for _, line := range lines {
 		line = strings.TrimSpace(line)
-		if matches := errorPattern.FindStringSubmatch(line); matches != nil {
+		if diag, ok := errparse.ParseLine(line); ok {
 			issue := Issue{
-				ID:          fmt.Sprintf("vet-%s-%s", sanitizeID(matches[1]), matches[2]),
+				ID:          fmt.Sprintf("vet-%s-%d", sanitizeID(diag.File), diag.Line),
 				Category:    CategoryLint,
 				Level:       LevelWarning,
 				Title:       "go vet issue",
-				Description: matches[3],
-				File:        matches[1],
-				Line:        parseInt(matches[2]),
+				Description: diag.Message,
+				File:        diag.File,
+				Line:        diag.Line,
+				Column:      diag.Column,
 				RawOutput:   line,
 			}
 			issues = append(issues, issue)
@@ -467,12 +495,9 @@ func (d *Diagnoser) getLintSuggestion(linter, message string) string {
 
 // checkTests runs tests and captures failures.
 func (d *Diagnoser) checkTests(ctx context.Context) bool {
-	cmd := exec.CommandContext(ctx, "go", "test", "-v", "-json", "./...")
-	output, err := cmd.CombinedOutput()
-
-	if err != nil {
-		issues := d.parseTestErrors(string(output))
-		for _, issue := range issues {
+	tests := d.verify(ctx, "go", "test", "-v", "-json", "./...")
+	if !tests.Passed() {
+		for _, issue := range tests.Issues {
 			d.addIssue(issue)
 		}
 		return false
@@ -485,7 +510,7 @@ func (d *Diagnoser) checkTests(ctx context.Context) bool {
 }
 
 // parseTestErrors parses test output for failures.
-func (d *Diagnoser) parseTestErrors(output string) []Issue {
+func parseTestErrors(output string) []Issue {
 	var issues []Issue
 
 	type TestEvent struct {
@@ -527,7 +552,7 @@ func (d *Diagnoser) parseTestErrors(output string) []Issue {
 // checkRuntime attempts to run the project and capture errors.
 func (d *Diagnoser) checkRuntime(ctx context.Context) bool {
 	// Find main package
-	mainFile := d.findMainFile()
+	mainFile := d.findMainFile(ctx)
 	if mainFile == "" {
 		// No main file, skip runtime check
 		return true
@@ -537,7 +562,8 @@ func (d *Diagnoser) checkRuntime(ctx context.Context) bool {
 	runCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
 	defer cancel()
 
-	cmd := exec.CommandContext(runCtx, "go", "run", mainFile)
+	cmd, cancelCmd := d.command(runCtx, "go", "run", mainFile)
+	defer cancelCmd()
 	output, err := cmd.CombinedOutput()
 
 	if err != nil && runCtx.Err() != context.DeadlineExceeded {
@@ -553,7 +579,7 @@ func (d *Diagnoser) checkRuntime(ctx context.Context) bool {
 }
 
 // findMainFile finds the main.go file.
-func (d *Diagnoser) findMainFile() string {
+func (d *Diagnoser) findMainFile(ctx context.Context) string {
 	// Check common locations
 	locations := []string{
 		"main.go",
@@ -570,6 +596,9 @@ func (d *Diagnoser) findMainFile() string {
 
 	// Search for main.go
 	filepath.Walk(".", func(path string, info os.FileInfo, err error) error {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
 		if err != nil {
 			return nil
 		}
@@ -680,6 +709,13 @@ func (d *Diagnoser) generateSummary() string {
 		}
 	}
 
+	if d.config.CheckAPI {
+		apiIssues := d.countByCategory(CategoryAPI)
+		if apiIssues > 0 {
+			parts = append(parts, fmt.Sprintf("  - API: %d", apiIssues))
+		}
+	}
+
 	if d.config.CheckTests {
 		testIssues := d.countByCategory(CategoryTest)
 		if testIssues > 0 {
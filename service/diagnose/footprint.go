@@ -0,0 +1,169 @@
+package diagnose
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Growth of a footprint measure over the baseline that is reported, as a
+// fraction of the baseline and in absolute terms: both must be exceeded,
+// so that noise in small numbers isn't.
+var (
+	SizeGrowth    = 0.10
+	MinSizeGrowth = int64(256 << 10)
+	TimeGrowth    = 0.50
+	MinTimeGrowth = 2 * time.Second
+)
+
+// footprintWindow is how many earlier footprints the baseline is the
+// median of.
+const footprintWindow = 5
+
+// Footprint is what building the project costs: the time the build check
+// took, the size of the binaries of its main packages, and the modules
+// they link.
+type Footprint struct {
+	BuildTime  time.Duration    `json:"build_time"`
+	BinarySize int64            `json:"binary_size"`
+	Binaries   map[string]int64 `json:"binaries,omitempty"` // size by name
+	Modules    []string         `json:"modules,omitempty"`
+	CreatedAt  time.Time        `json:"created_at"`
+}
+
+// checkFootprint measures the footprint of a project that built and
+// compares it with the median of Config.History. The binaries are built
+// into a temporary directory, from the build check's cache.
+func (d *Diagnoser) checkFootprint(ctx context.Context) {
+	if d.buildTime == 0 {
+		return // the build failed or didn't run
+	}
+	fp := &Footprint{BuildTime: d.buildTime, Binaries: make(map[string]int64), CreatedAt: time.Now()}
+
+	dir, err := os.MkdirTemp("", "aidev-footprint-")
+	if err != nil {
+		return
+	}
+	defer os.RemoveAll(dir)
+	cmd, cancel := d.command(ctx, "go", "build", "-o", dir+string(filepath.Separator), "./...")
+	err = cmd.Run()
+	cancel()
+	if err != nil {
+		return
+	}
+	entries, _ := os.ReadDir(dir)
+	for _, e := range entries {
+		if info, err := e.Info(); err == nil && info.Mode().IsRegular() {
+			fp.Binaries[e.Name()] = info.Size()
+			fp.BinarySize += info.Size()
+		}
+	}
+
+	cmd, cancel = d.command(ctx, "go", "list", "-deps", "-f", "{{with .Module}}{{.Path}}{{end}}", "./...")
+	output, err := cmd.Output()
+	cancel()
+	if err == nil {
+		seen := make(map[string]bool)
+		for _, m := range strings.Fields(string(output)) {
+			if !seen[m] {
+				seen[m] = true
+				fp.Modules = append(fp.Modules, m)
+			}
+		}
+		sort.Strings(fp.Modules)
+	}
+	d.footprint = fp
+
+	if d.config.Verbose {
+		fmt.Printf("✓ Built in %s, %s of binaries, %d module(s)\n", fp.BuildTime.Round(time.Millisecond), formatSize(fp.BinarySize), len(fp.Modules))
+	}
+	if len(d.config.History) == 0 {
+		return
+	}
+	for _, issue := range footprintRegressions(fp, d.config.History) {
+		d.addIssue(issue)
+	}
+}
+
+// footprintRegressions compares a footprint with the median of the
+// newest footprintWindow of history, newest first. The modules added are
+// those missing from the newest, since that is where they came in.
+func footprintRegressions(fp *Footprint, history []Footprint) []Issue {
+	if len(history) > footprintWindow {
+		history = history[:footprintWindow]
+	}
+	var sizes, times []int64
+	for _, h := range history {
+		if h.BinarySize > 0 {
+			sizes = append(sizes, h.BinarySize)
+		}
+		times = append(times, int64(h.BuildTime))
+	}
+
+	var added []string
+	previous := make(map[string]bool)
+	for _, m := range history[0].Modules {
+		previous[m] = true
+	}
+	for _, m := range fp.Modules {
+		if !previous[m] {
+			added = append(added, m)
+		}
+	}
+	cause := "Check the dependencies generated code added"
+	if len(added) > 0 {
+		cause = fmt.Sprintf("Modules linked since the last run: %s. Check that generated code needs them", strings.Join(added, ", "))
+	}
+
+	var issues []Issue
+	if len(sizes) > 0 && fp.BinarySize > 0 {
+		base := median(sizes)
+		if growth := fp.BinarySize - base; growth > MinSizeGrowth && float64(growth) > SizeGrowth*float64(base) {
+			issues = append(issues, Issue{
+				ID:          "footprint-binary-size",
+				Category:    CategoryBuild,
+				Level:       LevelWarning,
+				Title:       fmt.Sprintf("Binaries grew by %.0f%%", 100*float64(growth)/float64(base)),
+				Description: fmt.Sprintf("The binaries are %s, up from %s over recent runs", formatSize(fp.BinarySize), formatSize(base)),
+				Suggestion:  cause,
+			})
+		}
+	}
+	base := time.Duration(median(times))
+	if growth := fp.BuildTime - base; base > 0 && growth > MinTimeGrowth && float64(growth) > TimeGrowth*float64(base) {
+		issues = append(issues, Issue{
+			ID:          "footprint-build-time",
+			Category:    CategoryBuild,
+			Level:       LevelWarning,
+			Title:       fmt.Sprintf("Build took %.0f%% longer", 100*float64(growth)/float64(base)),
+			Description: fmt.Sprintf("The build took %s, up from %s over recent runs; a cold build cache also does this", fp.BuildTime.Round(time.Millisecond), base.Round(time.Millisecond)),
+			Suggestion:  cause,
+		})
+	}
+	return issues
+}
+
+// Helper functions
+
+func median(values []int64) int64 {
+	if len(values) == 0 {
+		return 0
+	}
+	sorted := append([]int64(nil), values...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	return sorted[len(sorted)/2]
+}
+
+func formatSize(n int64) string {
+	switch {
+	case n >= 1<<20:
+		return fmt.Sprintf("%.1f MiB", float64(n)/(1<<20))
+	case n >= 1<<10:
+		return fmt.Sprintf("%.1f KiB", float64(n)/(1<<10))
+	}
+	return fmt.Sprintf("%d B", n)
+}
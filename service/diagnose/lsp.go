@@ -0,0 +1,181 @@
+package diagnose
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// ErrNoDiagnostics is returned when a diagnostics export holds nothing
+// worth fixing.
+var ErrNoDiagnostics = errors.New("no error or warning diagnostics found")
+
+// lspDiagnostic is one editor diagnostic. It covers both the LSP shape
+// (gopls: zero-based range, numeric severity) and the tsserver shape
+// (one-based start, text and category).
+type lspDiagnostic struct {
+	File  string `json:"file"`
+	Range struct {
+		Start struct {
+			Line      int `json:"line"`
+			Character int `json:"character"`
+		} `json:"start"`
+	} `json:"range"`
+	Severity int    `json:"severity"`
+	Message  string `json:"message"`
+	Source   string `json:"source"`
+
+	Start *struct {
+		Line   int `json:"line"`
+		Offset int `json:"offset"`
+	} `json:"start"`
+	Text     string `json:"text"`
+	Category string `json:"category"`
+}
+
+// lspFile is a textDocument/publishDiagnostics notification's params.
+type lspFile struct {
+	URI         string          `json:"uri"`
+	File        string          `json:"file"`
+	Diagnostics []lspDiagnostic `json:"diagnostics"`
+}
+
+// ParseDiagnostics reads diagnostics exported from an editor's language
+// server and returns the errors and warnings as issues, with files relative
+// to root. Accepted shapes are a publishDiagnostics params object or a list
+// of them, an object mapping file URIs to diagnostic lists, and a flat list
+// of diagnostics that each carry a "file".
+func ParseDiagnostics(data []byte, root string) ([]Issue, error) {
+	var entries []json.RawMessage
+	if err := json.Unmarshal(data, &entries); err != nil {
+		var one lspFile
+		if err := json.Unmarshal(data, &one); err != nil {
+			return nil, fmt.Errorf("parse diagnostics: %w", err)
+		}
+		if one.URI == "" && one.File == "" {
+			var byURI map[string][]lspDiagnostic
+			if err := json.Unmarshal(data, &byURI); err != nil {
+				return nil, fmt.Errorf("parse diagnostics: %w", err)
+			}
+			var issues []Issue
+			for uri, diags := range byURI {
+				issues = append(issues, fileIssues(root, uri, diags)...)
+			}
+			return nonEmpty(issues)
+		}
+		entries = []json.RawMessage{data}
+	}
+
+	var issues []Issue
+	for _, entry := range entries {
+		var f lspFile
+		if err := json.Unmarshal(entry, &f); err != nil {
+			return nil, fmt.Errorf("parse diagnostics: %w", err)
+		}
+		if f.Diagnostics == nil {
+			// An entry of a flat list is a diagnostic itself.
+			var d lspDiagnostic
+			if err := json.Unmarshal(entry, &d); err != nil {
+				return nil, fmt.Errorf("parse diagnostics: %w", err)
+			}
+			f.Diagnostics = []lspDiagnostic{d}
+		}
+		issues = append(issues, fileIssues(root, firstNonEmpty(f.URI, f.File), f.Diagnostics)...)
+	}
+	return nonEmpty(issues)
+}
+
+func fileIssues(root, file string, diags []lspDiagnostic) []Issue {
+	var issues []Issue
+	for _, d := range diags {
+		if issue, ok := d.issue(root, firstNonEmpty(d.File, file)); ok {
+			issues = append(issues, issue)
+		}
+	}
+	return issues
+}
+
+func nonEmpty(issues []Issue) ([]Issue, error) {
+	if len(issues) == 0 {
+		return nil, ErrNoDiagnostics
+	}
+	sort.SliceStable(issues, func(i, j int) bool {
+		if issues[i].File != issues[j].File {
+			return issues[i].File < issues[j].File
+		}
+		return issues[i].Line < issues[j].Line
+	})
+	return issues, nil
+}
+
+func (d lspDiagnostic) issue(root, file string) (Issue, bool) {
+	level, message, line, column := LevelError, d.Message, d.Range.Start.Line+1, d.Range.Start.Character+1
+	switch d.Severity {
+	case 2:
+		level = LevelWarning
+	case 3, 4:
+		return Issue{}, false
+	}
+	if d.Start != nil {
+		line, column, message = d.Start.Line, d.Start.Offset, d.Text
+		switch d.Category {
+		case "warning":
+			level = LevelWarning
+		case "suggestion", "message":
+			return Issue{}, false
+		}
+	}
+	if file == "" || message == "" {
+		return Issue{}, false
+	}
+	file = diagnosticPath(root, file)
+
+	title := message
+	if i := strings.IndexByte(title, '\n'); i >= 0 {
+		title = title[:i]
+	}
+	if d.Source != "" {
+		title = d.Source + ": " + title
+	}
+	return Issue{
+		ID:          sanitizeID(fmt.Sprintf("lsp-%s-%d-%d", file, line, column)),
+		Category:    CategoryBuild,
+		Level:       level,
+		Title:       title,
+		Description: message,
+		File:        file,
+		Line:        line,
+		Column:      column,
+	}, true
+}
+
+// Helper functions
+
+// diagnosticPath turns a file URI or path into a path relative to root
+// where possible.
+func diagnosticPath(root, file string) string {
+	if u, err := url.Parse(file); err == nil && u.Scheme == "file" {
+		file = filepath.FromSlash(u.Path)
+	}
+	if filepath.IsAbs(file) && root != "" {
+		if absRoot, err := filepath.Abs(root); err == nil {
+			if rel, err := filepath.Rel(absRoot, file); err == nil {
+				return rel
+			}
+		}
+	}
+	return filepath.Clean(file)
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
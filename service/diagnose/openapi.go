@@ -0,0 +1,105 @@
+package diagnose
+
+import (
+	"context"
+	"fmt"
+
+	"ai-dev-agent/service/openapi"
+)
+
+// API sources: the side of the spec and the code taken as right.
+const (
+	APISourceCode = "code"
+	APISourceSpec = "spec"
+)
+
+// checkAPI reports the drift between the OpenAPI spec and the handlers.
+// Each issue is on the file of the side to change, so that auto-fix
+// brings it back in sync with the other.
+func (d *Diagnoser) checkAPI(ctx context.Context) {
+	specFile := d.config.APISpec
+	if specFile == "" {
+		if specFile = openapi.FindSpec("."); specFile == "" {
+			return
+		}
+	}
+	spec, err := openapi.LoadSpec(specFile)
+	if err != nil {
+		d.addIssue(Issue{
+			ID:          "api-spec-invalid",
+			Category:    CategoryAPI,
+			Level:       LevelError,
+			Title:       "OpenAPI spec unreadable",
+			Description: err.Error(),
+			File:        specFile,
+		})
+		return
+	}
+	routes, err := openapi.FindRoutes(".")
+	if err != nil || ctx.Err() != nil {
+		return
+	}
+	if d.config.Verbose {
+		fmt.Printf("✓ %d route(s) in the code, %d operation(s) in %s\n", len(routes), len(spec.Operations), specFile)
+	}
+	for _, drift := range openapi.Compare(spec, routes) {
+		d.addIssue(apiIssue(d.config.APISource, spec, routes, drift))
+	}
+}
+
+// apiIssue turns a drift into an issue on the side source says is wrong.
+func apiIssue(source string, spec *openapi.Spec, routes []openapi.Route, drift openapi.Drift) Issue {
+	issue := Issue{Category: CategoryAPI, Level: LevelWarning, Description: drift.Detail}
+	var method, path string
+	if op := drift.Operation; op != nil {
+		method, path = op.Method, op.Path
+	} else {
+		method, path = drift.Route.Method, drift.Route.Path
+	}
+	issue.ID = fmt.Sprintf("api-%s-%s-%s", drift.Kind, sanitizeID(method), sanitizeID(path))
+
+	// onSpec puts the issue on the spec, at the operation or else at paths.
+	onSpec := func() {
+		issue.File, issue.Line = spec.File, spec.PathsLine
+		if drift.Operation != nil {
+			issue.Line = drift.Operation.Line
+		}
+	}
+	onCode := func(r *openapi.Route) {
+		if r != nil {
+			issue.File, issue.Line = r.File, r.Line
+		}
+	}
+
+	switch drift.Kind {
+	case openapi.DriftUndocumented:
+		issue.Title = fmt.Sprintf("Route missing from the API spec: %s", path)
+		if source == APISourceSpec {
+			onCode(drift.Route)
+			issue.Suggestion = "Remove the route, or describe it in " + spec.File
+		} else {
+			onSpec()
+			issue.Suggestion = fmt.Sprintf("Describe the route (handler %s) under paths in %s", drift.Route.Handler, spec.File)
+		}
+	case openapi.DriftUnimplemented:
+		issue.Level = LevelError
+		issue.Title = fmt.Sprintf("API operation without a handler: %s %s", method, path)
+		if source == APISourceSpec {
+			onCode(openapi.NearestRoute(routes, spec.BasePath+path))
+			issue.Suggestion = "Implement and register a handler for the operation"
+		} else {
+			onSpec()
+			issue.Suggestion = "Remove the operation from the spec, or implement it"
+		}
+	default:
+		issue.Title = fmt.Sprintf("API type mismatch: %s %s", method, path)
+		if source == APISourceSpec {
+			onCode(drift.Route)
+			issue.Suggestion = fmt.Sprintf("Change handler %s to use the spec's schema", drift.Route.Handler)
+		} else {
+			onSpec()
+			issue.Suggestion = fmt.Sprintf("Change the operation's schema to match handler %s", drift.Route.Handler)
+		}
+	}
+	return issue
+}
@@ -0,0 +1,140 @@
+package diagnose
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// MaxVerifyOutput bounds the output a VerificationResult keeps; issues are
+// parsed from the full output first.
+const MaxVerifyOutput = 16 << 10
+
+// VerificationResult is the outcome of a build, vet or test command. The
+// diagnoser records one per check and the orchestrator one per build
+// verification, so both report failures the same way.
+type VerificationResult struct {
+	Command   string        `json:"command"`
+	ExitCode  int           `json:"exit_code"`
+	Issues    []Issue       `json:"issues,omitempty"`
+	Duration  time.Duration `json:"duration"`
+	Output    string        `json:"output,omitempty"`
+	Truncated bool          `json:"truncated,omitempty"`
+}
+
+// NewVerificationResult records a finished command and parses its output
+// into issues with the parser for the command: go vet, go test -json, or
+// the compiler otherwise.
+func NewVerificationResult(command string, exitCode int, output string, duration time.Duration) *VerificationResult {
+	r := &VerificationResult{Command: command, ExitCode: exitCode, Duration: duration}
+	if exitCode != 0 {
+		switch {
+		case strings.Contains(command, "go vet"):
+			r.Issues = parseVetErrors(output)
+		case strings.Contains(command, "go test") && strings.Contains(command, "-json"):
+			r.Issues = parseTestErrors(output)
+		default:
+			r.Issues = parseBuildErrors(output)
+		}
+	}
+	if len(output) > MaxVerifyOutput {
+		output = output[:MaxVerifyOutput]
+		r.Truncated = true
+	}
+	r.Output = output
+	return r
+}
+
+// Passed reports whether the command exited successfully.
+func (r *VerificationResult) Passed() bool {
+	return r.ExitCode == 0
+}
+
+// Err returns the failure with the command's output as its message, or nil
+// if the command passed.
+func (r *VerificationResult) Err() error {
+	if r.Passed() {
+		return nil
+	}
+	out := strings.TrimSpace(r.Output)
+	if out == "" {
+		return fmt.Errorf("%s: exit code %d", r.Command, r.ExitCode)
+	}
+	if r.Truncated {
+		out += "\n... (truncated)"
+	}
+	return fmt.Errorf("%s", out)
+}
+
+// Summary is a one-line report, e.g. "go build ./...: failed (exit 1, 3 issues, 1.2s)".
+func (r *VerificationResult) Summary() string {
+	if r.Passed() {
+		return fmt.Sprintf("%s: ok (%s)", r.Command, r.Duration.Round(time.Millisecond))
+	}
+	return fmt.Sprintf("%s: failed (exit %d, %d issue(s), %s)", r.Command, r.ExitCode, len(r.Issues), r.Duration.Round(time.Millisecond))
+}
+
+// commandWaitDelay bounds how long a killed command's output is awaited,
+// so processes it started and left holding the output can't hang a check.
+const commandWaitDelay = 5 * time.Second
+
+// command prepares an external command for a check. It is killed when ctx
+// is done or the configured timeout passes; call cancel when it is done.
+func (d *Diagnoser) command(ctx context.Context, name string, args ...string) (*exec.Cmd, context.CancelFunc) {
+	ctx, cancel := context.WithTimeout(ctx, d.config.Timeout)
+	cmd := exec.CommandContext(ctx, name, args...)
+	cmd.WaitDelay = commandWaitDelay
+	return cmd, cancel
+}
+
+// verify runs a check in the project directory and records its result.
+// A check failing on a transient error is run again as Config.Retry
+// allows; the result is that of the last run.
+func (d *Diagnoser) verify(ctx context.Context, name string, args ...string) *VerificationResult {
+	return d.verifyEnv(ctx, nil, name, args...)
+}
+
+// verifyEnv is verify with env (NAME=value pairs) added to the check's
+// environment and its command.
+func (d *Diagnoser) verifyEnv(ctx context.Context, env []string, name string, args ...string) *VerificationResult {
+	start := time.Now()
+	var output []byte
+	exitCode := 0
+	for attempt := 1; ; attempt++ {
+		output, exitCode = d.runCheck(ctx, env, name, args...)
+		if !d.config.Retry.Retryable(attempt, exitCode, string(output)) || !d.config.Retry.Wait(ctx, attempt) {
+			break
+		}
+	}
+	command := strings.Join(append(append(append([]string(nil), env...), name), args...), " ")
+	r := NewVerificationResult(command, exitCode, string(output), time.Since(start))
+	d.verifications = append(d.verifications, *r)
+	return r
+}
+
+// runCheck runs a check command once, returning its output and exit code.
+func (d *Diagnoser) runCheck(ctx context.Context, env []string, name string, args ...string) ([]byte, int) {
+	cmd, cancel := d.command(ctx, name, args...)
+	defer cancel()
+	if len(env) > 0 {
+		cmd.Env = append(os.Environ(), env...)
+	}
+	output, err := cmd.CombinedOutput()
+	if err == nil {
+		return output, 0
+	}
+	exitCode := -1
+	if exitErr, ok := err.(*exec.ExitError); ok {
+		exitCode = exitErr.ExitCode()
+	}
+	if len(output) == 0 {
+		output = []byte(err.Error())
+	}
+	if ctx.Err() == nil && cmd.ProcessState != nil && !cmd.ProcessState.Exited() {
+		output = append(output, fmt.Sprintf("\n(killed after the %s check timeout)", d.config.Timeout)...)
+	}
+	return output, exitCode
+}
@@ -0,0 +1,333 @@
+// Package diff computes line-based differences between file versions.
+package diff
+
+import (
+	"fmt"
+	"strings"
+)
+
+// OpKind identifies a diff operation.
+type OpKind int
+
+const (
+	OpEqual OpKind = iota
+	OpDelete
+	OpInsert
+)
+
+// Op is a single line-level edit.
+type Op struct {
+	Kind OpKind
+	Line string
+}
+
+// Stats summarizes a diff.
+type Stats struct {
+	Added   int
+	Removed int
+}
+
+// Lines splits text into lines without trailing newline characters.
+func Lines(text string) []string {
+	if text == "" {
+		return nil
+	}
+	lines := strings.Split(text, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// maxEdits bounds the Myers search; beyond it the changed region is
+// reported as a full replacement, which keeps memory bounded on rewrites.
+const maxEdits = 4000
+
+// Compute returns the shortest edit script turning a into b (Myers' algorithm).
+func Compute(a, b []string) []Op {
+	// Common prefix and suffix never need the search.
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+
+	var ops []Op
+	for _, line := range a[:prefix] {
+		ops = append(ops, Op{Kind: OpEqual, Line: line})
+	}
+	ops = append(ops, myers(a[prefix:len(a)-suffix], b[prefix:len(b)-suffix])...)
+	for _, line := range a[len(a)-suffix:] {
+		ops = append(ops, Op{Kind: OpEqual, Line: line})
+	}
+	return ops
+}
+
+func myers(a, b []string) []Op {
+	n, m := len(a), len(b)
+	max := n + m
+	if max == 0 {
+		return nil
+	}
+	if max > maxEdits {
+		max = maxEdits
+	}
+
+	offset := n + m
+	v := make([]int, 2*offset+2)
+	var trace []window
+
+	for d := 0; d <= max; d++ {
+		trace = append(trace, snapshot(v, offset-d-1, offset+d+2))
+
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+				x = v[offset+k+1]
+			} else {
+				x = v[offset+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			v[offset+k] = x
+			if x >= n && y >= m {
+				return backtrack(trace, a, b, offset)
+			}
+		}
+	}
+
+	ops := make([]Op, 0, n+m)
+	for _, line := range a {
+		ops = append(ops, Op{Kind: OpDelete, Line: line})
+	}
+	for _, line := range b {
+		ops = append(ops, Op{Kind: OpInsert, Line: line})
+	}
+	return ops
+}
+
+// window is the slice of the Myers V array that round d can reach.
+type window struct {
+	base int
+	v    []int
+}
+
+func snapshot(v []int, from, to int) window {
+	if from < 0 {
+		from = 0
+	}
+	if to > len(v) {
+		to = len(v)
+	}
+	w := window{base: from, v: make([]int, to-from)}
+	copy(w.v, v[from:to])
+	return w
+}
+
+func (w window) at(i int) int {
+	return w.v[i-w.base]
+}
+
+func backtrack(trace []window, a, b []string, offset int) []Op {
+	var ops []Op
+	x, y := len(a), len(b)
+
+	for d := len(trace) - 1; d >= 0; d-- {
+		v := trace[d]
+		k := x - y
+		var prevK int
+		if k == -d || (k != d && v.at(offset+k-1) < v.at(offset+k+1)) {
+			prevK = k + 1
+		} else {
+			prevK = k - 1
+		}
+		prevX := v.at(offset + prevK)
+		prevY := prevX - prevK
+
+		for x > prevX && y > prevY {
+			x--
+			y--
+			ops = append(ops, Op{Kind: OpEqual, Line: a[x]})
+		}
+		if d > 0 {
+			if x == prevX {
+				y--
+				ops = append(ops, Op{Kind: OpInsert, Line: b[y]})
+			} else {
+				x--
+				ops = append(ops, Op{Kind: OpDelete, Line: a[x]})
+			}
+		}
+	}
+
+	for i, j := 0, len(ops)-1; i < j; i, j = i+1, j-1 {
+		ops[i], ops[j] = ops[j], ops[i]
+	}
+	return ops
+}
+
+// Count returns added/removed line counts between two texts.
+func Count(before, after string) Stats {
+	var stats Stats
+	for _, op := range Compute(Lines(before), Lines(after)) {
+		switch op.Kind {
+		case OpInsert:
+			stats.Added++
+		case OpDelete:
+			stats.Removed++
+		}
+	}
+	return stats
+}
+
+// Align matches the lines of b to unchanged lines of a. The result holds,
+// for each line of b, its index in a, or -1 for inserted lines.
+func Align(a, b []string) []int {
+	match := make([]int, len(b))
+	i, j := 0, 0
+	for _, op := range Compute(a, b) {
+		switch op.Kind {
+		case OpEqual:
+			match[j] = i
+			i++
+			j++
+		case OpDelete:
+			i++
+		case OpInsert:
+			match[j] = -1
+			j++
+		}
+	}
+	return match
+}
+
+// Unified renders a unified diff with the given number of context lines.
+// It returns an empty string when the texts are identical.
+func Unified(path string, before, after string, context int) string {
+	ops := Compute(Lines(before), Lines(after))
+
+	changed := false
+	for _, op := range ops {
+		if op.Kind != OpEqual {
+			changed = true
+			break
+		}
+	}
+	if !changed {
+		return ""
+	}
+
+	var sb strings.Builder
+	from, to := "a/"+path, "b/"+path
+	if before == "" {
+		from = "/dev/null"
+	}
+	if after == "" {
+		to = "/dev/null"
+	}
+	fmt.Fprintf(&sb, "--- %s\n+++ %s\n", from, to)
+
+	for _, h := range hunks(ops, context) {
+		fmt.Fprintf(&sb, "@@ -%d,%d +%d,%d @@\n", h.oldStart, h.oldLines, h.newStart, h.newLines)
+		for _, op := range h.ops {
+			switch op.Kind {
+			case OpEqual:
+				sb.WriteString(" ")
+			case OpDelete:
+				sb.WriteString("-")
+			case OpInsert:
+				sb.WriteString("+")
+			}
+			sb.WriteString(op.Line)
+			sb.WriteString("\n")
+		}
+	}
+	return sb.String()
+}
+
+type hunk struct {
+	oldStart, oldLines int
+	newStart, newLines int
+	ops                []Op
+}
+
+func hunks(ops []Op, context int) []hunk {
+	var result []hunk
+	oldLine, newLine := 1, 1
+	i := 0
+
+	for i < len(ops) {
+		if ops[i].Kind == OpEqual {
+			oldLine++
+			newLine++
+			i++
+			continue
+		}
+
+		// Start a hunk with up to `context` lines of leading context.
+		start := i - context
+		if start < 0 {
+			start = 0
+		}
+		for start < i && ops[start].Kind != OpEqual {
+			start++
+		}
+		lead := i - start
+		h := hunk{oldStart: oldLine - lead, newStart: newLine - lead}
+
+		end := i
+		for end < len(ops) {
+			if ops[end].Kind != OpEqual {
+				end++
+				continue
+			}
+			run := end
+			for run < len(ops) && ops[run].Kind == OpEqual {
+				run++
+			}
+			if run == len(ops) || run-end > 2*context {
+				tail := end + context
+				if tail > run {
+					tail = run
+				}
+				end = tail
+				break
+			}
+			end = run
+		}
+
+		h.ops = ops[start:end]
+		for _, op := range h.ops {
+			if op.Kind != OpInsert {
+				h.oldLines++
+			}
+			if op.Kind != OpDelete {
+				h.newLines++
+			}
+		}
+		if h.oldLines == 0 {
+			h.oldStart--
+		}
+		if h.newLines == 0 {
+			h.newStart--
+		}
+
+		for _, op := range ops[i:end] {
+			if op.Kind != OpInsert {
+				oldLine++
+			}
+			if op.Kind != OpDelete {
+				newLine++
+			}
+		}
+		result = append(result, h)
+		i = end
+	}
+	return result
+}
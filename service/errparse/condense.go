@@ -0,0 +1,118 @@
+package errparse
+
+import (
+	"fmt"
+	"strings"
+)
+
+// summaryLines is how many final lines Condense always keeps; go build and
+// go test end with the package results.
+const summaryLines = 8
+
+// Condense shortens build or test output to about maxBytes for a prompt.
+// Output within the limit is returned as is. Otherwise the output of
+// passing tests (go test -v) and other noise is dropped first; if that is
+// not enough, error lines and the final summary are kept and the lines in
+// between are elided.
+func Condense(output string, maxBytes int) string {
+	if maxBytes <= 0 || len(output) <= maxBytes {
+		return output
+	}
+	lines := dropPassing(strings.Split(strings.TrimRight(output, "\n"), "\n"))
+	if text := strings.Join(lines, "\n"); len(text) <= maxBytes {
+		return text
+	}
+
+	keep := make([]bool, len(lines))
+	for i, line := range lines {
+		if important(line) {
+			keep[i] = true
+			// Indented lines under an error belong to it.
+			for j := i + 1; j < len(lines) && strings.HasPrefix(lines[j], "\t"); j++ {
+				keep[j] = true
+			}
+		}
+	}
+	tail := len(lines) - summaryLines
+	if tail < 0 {
+		tail = 0
+	}
+	tailText := strings.Join(lines[tail:], "\n")
+
+	budget := maxBytes - len(tailText)
+	var sb strings.Builder
+	omitted := 0
+	flush := func() {
+		if omitted > 0 {
+			fmt.Fprintf(&sb, "... (%d lines omitted)\n", omitted)
+			omitted = 0
+		}
+	}
+	for i := 0; i < tail; i++ {
+		if !keep[i] || sb.Len()+len(lines[i]) > budget {
+			omitted++
+			continue
+		}
+		flush()
+		sb.WriteString(lines[i])
+		sb.WriteString("\n")
+	}
+	flush()
+	sb.WriteString(tailText)
+	out := sb.String()
+	if len(out) > maxBytes {
+		// The summary alone is too long; keep its end.
+		out = "... (truncated)\n" + out[len(out)-maxBytes:]
+	}
+	return out
+}
+
+// dropPassing removes the output of tests that passed or were skipped,
+// RUN/PAUSE/CONT markers, and package lines without failures.
+func dropPassing(lines []string) []string {
+	var out []string
+	started := make(map[string]int) // test name -> index in out of its output
+	for _, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case strings.HasPrefix(trimmed, "=== RUN"):
+			started[strings.TrimSpace(strings.TrimPrefix(trimmed, "=== RUN"))] = len(out)
+			continue
+		case strings.HasPrefix(trimmed, "=== PAUSE"), strings.HasPrefix(trimmed, "=== CONT"), strings.HasPrefix(trimmed, "=== NAME"):
+			continue
+		case strings.HasPrefix(trimmed, "--- PASS:"), strings.HasPrefix(trimmed, "--- SKIP:"):
+			name := testName(trimmed)
+			if start, ok := started[name]; ok && start <= len(out) {
+				out = out[:start]
+			}
+			delete(started, name)
+			continue
+		case trimmed == "PASS", strings.HasPrefix(line, "ok  "), strings.HasPrefix(line, "?   ") && strings.HasSuffix(line, "[no test files]"):
+			continue
+		}
+		out = append(out, line)
+	}
+	return out
+}
+
+// testName returns the test a "--- PASS: TestX (0.00s)" line reports.
+func testName(line string) string {
+	_, rest, _ := strings.Cut(line, ":")
+	name, _, _ := strings.Cut(strings.TrimSpace(rest), " ")
+	return name
+}
+
+// important reports whether a line states an error or failure.
+func important(line string) bool {
+	if _, ok := ParseLine(line); ok {
+		return true
+	}
+	trimmed := strings.TrimSpace(line)
+	for _, prefix := range []string{"--- FAIL", "FAIL", "panic:", "fatal error:", "# "} {
+		if strings.HasPrefix(trimmed, prefix) {
+			return true
+		}
+	}
+	lower := strings.ToLower(trimmed)
+	return strings.Contains(lower, "error") || strings.Contains(lower, "expected")
+}
@@ -0,0 +1,72 @@
+// Package errparse parses compiler and vet output into file/line/message
+// diagnostics, for diagnose's issues and the orchestrator's retry prompts.
+package errparse
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Diagnostic is one compiler or vet message.
+type Diagnostic struct {
+	File    string // as printed, without a leading "./"
+	Line    int
+	Column  int // 0 if not printed
+	Message string
+	Notes   []string // indented lines that follow, e.g. "other declaration of x"
+}
+
+var linePattern = regexp.MustCompile(`^(?:vet: )?([^\s:][^:]*):(\d+)(?::(\d+))?:\s*(.+)$`)
+
+// ParseLine parses one "file:line[:col]: message" line.
+func ParseLine(line string) (Diagnostic, bool) {
+	m := linePattern.FindStringSubmatch(strings.TrimSpace(line))
+	if m == nil {
+		return Diagnostic{}, false
+	}
+	d := Diagnostic{File: strings.TrimPrefix(m[1], "./"), Message: m[4]}
+	d.Line, _ = strconv.Atoi(m[2])
+	if m[3] != "" {
+		d.Column, _ = strconv.Atoi(m[3])
+	}
+	return d, true
+}
+
+// Parse returns the diagnostics in output in order, attaching indented
+// continuation lines to the diagnostic before them. Package headers
+// ("# pkg") and other lines are skipped.
+func Parse(output string) []Diagnostic {
+	var diags []Diagnostic
+	for _, line := range strings.Split(output, "\n") {
+		if strings.HasPrefix(line, "\t") {
+			if len(diags) > 0 {
+				last := &diags[len(diags)-1]
+				last.Notes = append(last.Notes, strings.TrimSpace(line))
+			}
+			continue
+		}
+		if d, ok := ParseLine(line); ok {
+			diags = append(diags, d)
+		}
+	}
+	return diags
+}
+
+// String formats d as the compiler does.
+func (d Diagnostic) String() string {
+	if d.Column > 0 {
+		return fmt.Sprintf("%s:%d:%d: %s", d.File, d.Line, d.Column, d.Message)
+	}
+	return fmt.Sprintf("%s:%d: %s", d.File, d.Line, d.Message)
+}
+
+// SameFile reports whether a diagnostic's file and path name the same
+// file, allowing either to be relative to a parent of the other's
+// directory.
+func SameFile(file, path string) bool {
+	file = strings.TrimPrefix(strings.ReplaceAll(file, `\`, "/"), "./")
+	path = strings.TrimPrefix(strings.ReplaceAll(path, `\`, "/"), "./")
+	return file == path || strings.HasSuffix(file, "/"+path) || strings.HasSuffix(path, "/"+file)
+}
@@ -0,0 +1,106 @@
+package errparse
+
+import (
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Race is one report of the race detector (go test -race).
+type Race struct {
+	Report string  // the report as printed, without its separators
+	Test   string  // the test it was detected in, when go test says
+	Frames []Frame // every stack frame, in the order printed
+	// Accesses are the top frames of the conflicting accesses, e.g. the
+	// write and the previous read.
+	Accesses []Frame
+}
+
+// Frame is a stack frame of a race report or a log's stack trace.
+type Frame struct {
+	Func string
+	File string // as printed, absolute in Go stacks
+	Line int
+}
+
+const raceSeparator = "=================="
+
+var (
+	framePattern  = regexp.MustCompile(`^\s+(\S.*\.go):(\d+)(?: \+0x[0-9a-f]+)?$`)
+	accessPattern = regexp.MustCompile(`^(?:Previous )?(?:[Rr]ead|[Ww]rite|[Aa]tomic \w+) at 0x[0-9a-f]+`)
+	failPattern   = regexp.MustCompile(`^\s*--- FAIL: (\S+)`)
+)
+
+// ParseRaces returns the race reports in go test output, in order. A
+// report is tied to the test that go test fails for it next.
+func ParseRaces(output string) []Race {
+	var races []Race
+	var current *Race
+	var report []string
+	access := false
+	untested := 0 // races[untested:] aren't tied to a test yet
+	lines := strings.Split(output, "\n")
+	for i, line := range lines {
+		if current == nil {
+			if strings.TrimSpace(line) == "WARNING: DATA RACE" {
+				current, report = &Race{}, []string{line}
+				continue
+			}
+			if m := failPattern.FindStringSubmatch(line); m != nil {
+				for j := untested; j < len(races); j++ {
+					races[j].Test = m[1]
+				}
+				untested = len(races)
+			}
+			continue
+		}
+		if strings.TrimSpace(line) == raceSeparator {
+			current.Report = strings.TrimSpace(strings.Join(report, "\n"))
+			races = append(races, *current)
+			current = nil
+			continue
+		}
+		report = append(report, line)
+		if accessPattern.MatchString(line) {
+			access = true
+			continue
+		}
+		m := framePattern.FindStringSubmatch(line)
+		if m == nil || i == 0 {
+			continue
+		}
+		f := Frame{Func: strings.TrimSpace(lines[i-1]), File: m[1]}
+		f.Line, _ = strconv.Atoi(m[2])
+		current.Frames = append(current.Frames, f)
+		if access {
+			current.Accesses = append(current.Accesses, f)
+			access = false
+		}
+	}
+	return races
+}
+
+// Files returns the distinct files of the report's frames, in order.
+func (r Race) Files() []string {
+	seen := make(map[string]bool)
+	var files []string
+	for _, f := range r.Frames {
+		if !seen[f.File] {
+			seen[f.File] = true
+			files = append(files, f.File)
+		}
+	}
+	return files
+}
+
+// Key identifies the race by where its accesses happen, so that a race
+// reported by several tests, or again after a fix, is recognized.
+func (r Race) Key() string {
+	keys := make([]string, len(r.Accesses))
+	for i, f := range r.Accesses {
+		keys[i] = f.File + ":" + strconv.Itoa(f.Line)
+	}
+	sort.Strings(keys)
+	return strings.Join(keys, " ")
+}
@@ -0,0 +1,76 @@
+package errparse
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var (
+	// goFramePattern matches the location line of a Go stack frame; the
+	// function is on the line before.
+	goFramePattern = regexp.MustCompile(`^\s+(\S+\.go):(\d+)(?: \+0x[0-9a-f]+)?$`)
+	// pyFramePattern matches a Python traceback frame.
+	pyFramePattern = regexp.MustCompile(`^\s*File "([^"]+)", line (\d+)(?:, in (\S+))?`)
+	// jsFramePattern matches a JavaScript or Java-style "at fn (file:line)"
+	// frame.
+	jsFramePattern = regexp.MustCompile(`^\s*at (?:(\S+) )?\(?([^\s()]+\.\w+):(\d+)(?::\d+)?\)?$`)
+	// fileLinePattern matches any other file:line reference in a log.
+	fileLinePattern = regexp.MustCompile(`([\w./\\-]+\.[A-Za-z]\w*):(\d+)`)
+)
+
+// ParseStack returns the frames of the stack traces in a log, and the
+// file:line references of its other lines, in the order they appear.
+// Go, Python and JavaScript traces name the frames' functions. Repeated
+// locations are kept once.
+func ParseStack(log string) []Frame {
+	var frames []Frame
+	seen := make(map[string]bool)
+	add := frameAdder(&frames, seen)
+	lines := strings.Split(log, "\n")
+	for i, line := range lines {
+		line = strings.TrimRight(line, "\r")
+		if m := goFramePattern.FindStringSubmatch(line); m != nil {
+			fn := ""
+			if i > 0 {
+				fn = strings.TrimSpace(lines[i-1])
+				// main.(*Server).handle(0xc000010000, ...) -> main.(*Server).handle
+				if j := strings.LastIndex(fn, "("); j > 0 && strings.HasSuffix(fn, ")") {
+					fn = fn[:j]
+				}
+				// created by main.main in goroutine 1 -> main.main
+				fn = strings.TrimPrefix(fn, "created by ")
+				if j := strings.Index(fn, " in goroutine "); j > 0 {
+					fn = fn[:j]
+				}
+			}
+			add(fn, m[1], m[2])
+			continue
+		}
+		if m := pyFramePattern.FindStringSubmatch(line); m != nil {
+			add(m[3], m[1], m[2])
+			continue
+		}
+		if m := jsFramePattern.FindStringSubmatch(line); m != nil {
+			add(m[1], m[2], m[3])
+			continue
+		}
+		for _, m := range fileLinePattern.FindAllStringSubmatch(line, -1) {
+			add("", m[1], m[2])
+		}
+	}
+	return frames
+}
+
+// Helper functions
+
+func frameAdder(frames *[]Frame, seen map[string]bool) func(fn, file, line string) {
+	return func(fn, file, line string) {
+		n, err := strconv.Atoi(line)
+		if err != nil || seen[file+":"+line] {
+			return
+		}
+		seen[file+":"+line] = true
+		*frames = append(*frames, Frame{Func: fn, File: file, Line: n})
+	}
+}
@@ -0,0 +1,197 @@
+// Package excerpt cuts Go source down to the declarations enclosing given
+// lines, so a fix prompt carries only the code around the errors, and
+// splices the edited declarations back into the file.
+package excerpt
+
+import (
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"sort"
+	"strings"
+
+	"ai-dev-agent/service/errparse"
+)
+
+// Errors
+var (
+	ErrNoRegion      = errors.New("line is not inside a declaration")
+	ErrRegionCount   = errors.New("replacement count does not match regions")
+	ErrInvalidSplice = errors.New("spliced file does not parse")
+)
+
+// Region is one top-level declaration of a file.
+type Region struct {
+	Name      string // e.g. "func (s *Server) Start" or "import"
+	Start     int    // byte offset, doc comment included
+	End       int    // byte offset just past the declaration
+	StartLine int
+	EndLine   int
+}
+
+// Regions returns the declarations enclosing lines, in file order, plus
+// the import declarations so that fixes can add imports.
+func Regions(src string, lines []int) ([]Region, error) {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "", src, parser.ParseComments)
+	if err != nil {
+		return nil, err
+	}
+
+	var regions []Region
+	seen := make(map[ast.Decl]bool)
+	add := func(decl ast.Decl) {
+		if seen[decl] {
+			return
+		}
+		seen[decl] = true
+		start := decl.Pos()
+		if doc := declDoc(decl); doc != nil {
+			start = doc.Pos()
+		}
+		regions = append(regions, Region{
+			Name:      declName(decl),
+			Start:     fset.Position(start).Offset,
+			End:       fset.Position(decl.End()).Offset,
+			StartLine: fset.Position(start).Line,
+			EndLine:   fset.Position(decl.End()).Line,
+		})
+	}
+
+	for _, line := range lines {
+		found := false
+		for _, decl := range file.Decls {
+			if fset.Position(decl.Pos()).Line <= line && line <= fset.Position(decl.End()).Line {
+				add(decl)
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("%w: line %d", ErrNoRegion, line)
+		}
+	}
+	for _, decl := range file.Decls {
+		if gen, ok := decl.(*ast.GenDecl); ok && gen.Tok == token.IMPORT {
+			add(decl)
+		}
+	}
+	sort.Slice(regions, func(i, j int) bool { return regions[i].Start < regions[j].Start })
+	return regions, nil
+}
+
+// Render formats the regions of src for a prompt, each under a header
+// naming its position.
+func Render(src string, regions []Region) string {
+	var sb strings.Builder
+	for i, r := range regions {
+		fmt.Fprintf(&sb, "// --- region %d: %s (lines %d-%d) ---\n", i+1, r.Name, r.StartLine, r.EndLine)
+		sb.WriteString(src[r.Start:r.End])
+		sb.WriteString("\n\n")
+	}
+	return sb.String()
+}
+
+// Size returns the number of source bytes the regions cover.
+func Size(regions []Region) int {
+	n := 0
+	for _, r := range regions {
+		n += r.End - r.Start
+	}
+	return n
+}
+
+// Splice replaces each region with its replacement and checks that the
+// result still parses.
+func Splice(src string, regions []Region, replacements []string) (string, error) {
+	if len(replacements) != len(regions) {
+		return "", fmt.Errorf("%w: got %d, want %d", ErrRegionCount, len(replacements), len(regions))
+	}
+	var sb strings.Builder
+	prev := 0
+	for i, r := range regions {
+		sb.WriteString(src[prev:r.Start])
+		sb.WriteString(strings.TrimSpace(stripHeader(replacements[i])))
+		prev = r.End
+	}
+	sb.WriteString(src[prev:])
+	out := sb.String()
+	if _, err := parser.ParseFile(token.NewFileSet(), "", out, parser.ParseComments); err != nil {
+		return "", fmt.Errorf("%w: %v", ErrInvalidSplice, err)
+	}
+	return out, nil
+}
+
+// ErrorLines returns the lines of path referenced as "path:line" in msg,
+// as compiler and vet output does.
+func ErrorLines(msg, path string) []int {
+	var lines []int
+	seen := make(map[int]bool)
+	for _, d := range errparse.Parse(msg) {
+		if errparse.SameFile(d.File, path) && !seen[d.Line] {
+			seen[d.Line] = true
+			lines = append(lines, d.Line)
+		}
+	}
+	return lines
+}
+
+// Helper functions
+
+// stripHeader drops a region header the model echoed back.
+func stripHeader(code string) string {
+	code = strings.TrimLeft(code, "\n")
+	if strings.HasPrefix(code, "// --- region ") {
+		if i := strings.IndexByte(code, '\n'); i >= 0 {
+			return code[i+1:]
+		}
+	}
+	return code
+}
+
+func declDoc(decl ast.Decl) *ast.CommentGroup {
+	switch d := decl.(type) {
+	case *ast.FuncDecl:
+		return d.Doc
+	case *ast.GenDecl:
+		return d.Doc
+	}
+	return nil
+}
+
+func declName(decl ast.Decl) string {
+	switch d := decl.(type) {
+	case *ast.FuncDecl:
+		if d.Recv != nil && len(d.Recv.List) > 0 {
+			return fmt.Sprintf("func (%s) %s", exprString(d.Recv.List[0].Type), d.Name.Name)
+		}
+		return "func " + d.Name.Name
+	case *ast.GenDecl:
+		if len(d.Specs) == 1 {
+			switch s := d.Specs[0].(type) {
+			case *ast.TypeSpec:
+				return "type " + s.Name.Name
+			case *ast.ValueSpec:
+				return d.Tok.String() + " " + s.Names[0].Name
+			}
+		}
+		return d.Tok.String()
+	}
+	return "declaration"
+}
+
+func exprString(expr ast.Expr) string {
+	switch e := expr.(type) {
+	case *ast.StarExpr:
+		return "*" + exprString(e.X)
+	case *ast.Ident:
+		return e.Name
+	case *ast.IndexExpr:
+		return exprString(e.X)
+	case *ast.IndexListExpr:
+		return exprString(e.X)
+	}
+	return "?"
+}
@@ -5,9 +5,11 @@ import (
         "bytes"
         "context"
         "fmt"
+        "io"
         "os"
         "os/exec"
         "strings"
+        "sync"
         "time"
 )
 
@@ -26,11 +28,25 @@ type Result struct {
         Stdout    string
         Stderr    string
         Combined  string
-        Duration  time.Duration
+        Duration  time.Duration // from process start until it finished
         TimedOut  bool
         Cancelled bool
         Success   bool
         PID       int
+        Attempts  int // runs under the retry policy; the rest is of the last
+
+        QueuedAt   time.Time // when the command was requested
+        StartedAt  time.Time // when its process was running
+        FinishedAt time.Time // when it exited and its output was read
+        Phases     []Phase
+}
+
+// Phase is a span of a command's execution: "start" until the process
+// runs, "run" until it exits or is killed on timeout or cancellation, and
+// "kill" until a killed command has finished.
+type Phase struct {
+        Name     string
+        Duration time.Duration
 }
 
 // Options holds execution options.
@@ -40,6 +56,15 @@ type Options struct {
         Timeout    time.Duration
         Shell      bool
         Input      string
+        // Stdin is forwarded to the command, in place of Input.
+        Stdin io.Reader
+        // PTY runs the command on a pseudo-terminal, for tools that only
+        // prompt or color their output on a TTY. Stdout then holds both
+        // output streams and Stderr is empty.
+        PTY bool
+        // Retry runs the command again when it fails in a way the policy
+        // deems transient.
+        Retry RetryPolicy
 }
 
 // DefaultOptions returns default options.
@@ -50,6 +75,9 @@ func DefaultOptions() Options {
         }
 }
 
+// waitDelay bounds how long output is awaited after a command is killed.
+const waitDelay = 5 * time.Second
+
 // Executor handles command execution.
 type Executor struct {
         defaultOptions Options
@@ -75,46 +103,103 @@ func (e *Executor) ExecuteWithOptions(ctx context.Context, command string, opts
                 return nil, ErrCommandEmpty
         }
 
-        result := &Result{
-                Command:  command,
-                ExitCode: -1,
-        }
-
-        var cmd *exec.Cmd
-        if opts.Shell {
-                cmd = exec.CommandContext(ctx, "sh", "-c", command)
-        } else {
+        name, args := "sh", []string{"-c", command}
+        if !opts.Shell {
                 parts := strings.Fields(command)
                 if len(parts) == 0 {
                         return nil, ErrCommandEmpty
                 }
-                cmd = exec.CommandContext(ctx, parts[0], parts[1:]...)
+                name, args = parts[0], parts[1:]
+        }
+        return e.run(ctx, command, name, args, opts)
+}
+
+// ExecuteArgs runs name with args as given, without a shell, so no
+// argument is split, expanded or interpreted.
+func (e *Executor) ExecuteArgs(ctx context.Context, name string, args ...string) (*Result, error) {
+        return e.ExecuteArgsWithOptions(ctx, e.defaultOptions, name, args...)
+}
+
+// ExecuteArgsWithOptions is ExecuteArgs with custom options; opts.Shell
+// is ignored.
+func (e *Executor) ExecuteArgsWithOptions(ctx context.Context, opts Options, name string, args ...string) (*Result, error) {
+        if name == "" {
+                return nil, ErrCommandEmpty
+        }
+        return e.run(ctx, QuoteArgs(name, args...), name, args, opts)
+}
+
+// run runs name with args, shown as command, as often as opts.Retry
+// allows, returning the result of the last run.
+func (e *Executor) run(ctx context.Context, command, name string, args []string, opts Options) (*Result, error) {
+        for attempt := 1; ; attempt++ {
+                result := &Result{Command: command, ExitCode: -1, QueuedAt: time.Now(), Attempts: attempt}
+                result, err := e.runOnce(ctx, exec.CommandContext(ctx, name, args...), result, opts)
+                if err != nil || !opts.Retry.Retryable(attempt, result.ExitCode, result.Combined) || !opts.Retry.Wait(ctx, attempt) {
+                        return result, err
+                }
         }
+}
 
+// runOnce starts cmd with opts and waits for it, filling in result.
+func (e *Executor) runOnce(ctx context.Context, cmd *exec.Cmd, result *Result, opts Options) (*Result, error) {
         if opts.WorkingDir != "" {
                 cmd.Dir = opts.WorkingDir
         }
+        // A killed shell can leave its children holding the output pipes;
+        // stop waiting for them shortly after.
+        cmd.WaitDelay = waitDelay
 
         cmd.Env = os.Environ()
         for k, v := range opts.Env {
                 cmd.Env = append(cmd.Env, fmt.Sprintf("%s=%s", k, v))
         }
 
-        var stdoutBuf, stderrBuf, combinedBuf bytes.Buffer
-        cmd.Stdout = ioMultiWriter(&stdoutBuf, &combinedBuf)
-        cmd.Stderr = ioMultiWriter(&stderrBuf, &combinedBuf)
+        var input io.Reader
+        if opts.Stdin != nil {
+                input = opts.Stdin
+        } else if opts.Input != "" {
+                input = strings.NewReader(opts.Input)
+        }
 
-        if opts.Input != "" {
-                cmd.Stdin = strings.NewReader(opts.Input)
+        var stdoutBuf, stderrBuf, combinedBuf bytes.Buffer
+        var term *terminal
+        if opts.PTY {
+                var err error
+                if term, err = attachTerminal(cmd, &combinedBuf); err != nil {
+                        return result, err
+                }
+        } else {
+                cmd.Stdout = ioMultiWriter(&stdoutBuf, &combinedBuf)
+                cmd.Stderr = ioMultiWriter(&stderrBuf, &combinedBuf)
+                cmd.Stdin = input
         }
 
-        start := time.Now()
-        err := cmd.Run()
-        result.Duration = time.Since(start)
+        if err := cmd.Start(); err != nil {
+                if term != nil {
+                        term.abort()
+                }
+                return result, err
+        }
+        result.StartedAt = time.Now()
+        killed := watchKill(ctx)
+        if term != nil {
+                term.start(input)
+        }
+        err := cmd.Wait()
+        if term != nil {
+                term.close()
+        }
+        result.finish(killed())
 
         result.Stdout = stdoutBuf.String()
         result.Stderr = stderrBuf.String()
         result.Combined = combinedBuf.String()
+        if term != nil {
+                // The terminal ends lines with CRLF.
+                result.Combined = strings.ReplaceAll(result.Combined, "\r\n", "\n")
+                result.Stdout = result.Combined
+        }
 
         if cmd.Process != nil {
                 result.PID = cmd.Process.Pid
@@ -183,18 +268,24 @@ func (e *Executor) RunStream(ctx context.Context, command string, handler func(l
         stdoutPipe, _ := cmd.StdoutPipe()
         stderrPipe, _ := cmd.StderrPipe()
 
-        result := &Result{Command: command, ExitCode: -1}
+        result := &Result{Command: command, ExitCode: -1, QueuedAt: time.Now()}
 
         if err := cmd.Start(); err != nil {
                 return nil, err
         }
+        result.StartedAt = time.Now()
+        killed := watchKill(ctx)
 
         if cmd.Process != nil {
                 result.PID = cmd.Process.Pid
         }
 
-        // Read output in goroutines
+        // Read output in goroutines; Wait closes the pipes, so it may only
+        // be called once both are drained.
+        var readers sync.WaitGroup
+        readers.Add(2)
         go func() {
+                defer readers.Done()
                 buf := make([]byte, 1024)
                 for {
                         n, err := stdoutPipe.Read(buf)
@@ -216,6 +307,7 @@ func (e *Executor) RunStream(ctx context.Context, command string, handler func(l
         }()
 
         go func() {
+                defer readers.Done()
                 buf := make([]byte, 1024)
                 for {
                         n, err := stderrPipe.Read(buf)
@@ -228,14 +320,14 @@ func (e *Executor) RunStream(ctx context.Context, command string, handler func(l
                 }
         }()
 
+        readers.Wait()
         err := cmd.Wait()
-        start := time.Now()
+        result.finish(killed())
 
         if cmd.ProcessState != nil {
                 result.ExitCode = cmd.ProcessState.ExitCode()
                 result.Success = result.ExitCode == 0
         }
-        result.Duration = time.Since(start)
 
         if err != nil {
                 if ctx.Err() == context.DeadlineExceeded {
@@ -262,7 +354,64 @@ func GetCommandPath(command string) (string, error) {
         return exec.LookPath(command)
 }
 
+// finish records that the command finished now, killed at killedAt or,
+// if that is zero, on its own.
+func (r *Result) finish(killedAt time.Time) {
+        r.FinishedAt = time.Now()
+        r.Duration = r.FinishedAt.Sub(r.StartedAt)
+        ranUntil := r.FinishedAt
+        if !killedAt.IsZero() && killedAt.Before(r.FinishedAt) {
+                ranUntil = killedAt
+        }
+        r.Phases = []Phase{
+                {Name: "start", Duration: r.StartedAt.Sub(r.QueuedAt)},
+                {Name: "run", Duration: ranUntil.Sub(r.StartedAt)},
+        }
+        if ranUntil.Before(r.FinishedAt) {
+                r.Phases = append(r.Phases, Phase{Name: "kill", Duration: r.FinishedAt.Sub(ranUntil)})
+        }
+}
+
+// QuoteArgs formats a command for display, quoting the arguments a shell
+// would split or expand.
+func QuoteArgs(name string, args ...string) string {
+        words := make([]string, 0, len(args)+1)
+        for _, arg := range append([]string{name}, args...) {
+                words = append(words, shellQuote(arg))
+        }
+        return strings.Join(words, " ")
+}
+
 // Helper
+
+func shellQuote(s string) string {
+        if s == "" {
+                return "''"
+        }
+        if strings.Trim(s, "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789_-./:=@%+,") == "" {
+                return s
+        }
+        return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// watchKill notes when ctx is done, which kills a command started with
+// it. The returned function stops watching and returns that time, or the
+// zero time if ctx was still live.
+func watchKill(ctx context.Context) func() time.Time {
+        var at time.Time
+        done := make(chan struct{})
+        stop := context.AfterFunc(ctx, func() {
+                at = time.Now()
+                close(done)
+        })
+        return func() time.Time {
+                if !stop() {
+                        <-done
+                }
+                return at
+        }
+}
+
 func ioMultiWriter(writers ...*bytes.Buffer) *multiWriter {
         return &multiWriter{writers: writers}
 }
@@ -0,0 +1,75 @@
+package executor
+
+import (
+	"errors"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// ErrPTYUnsupported is returned for Options.PTY where pseudo-terminals
+// aren't available.
+var ErrPTYUnsupported = errors.New("pseudo-terminals are not supported on this platform")
+
+// terminal is the pseudo-terminal a command runs on: the command holds
+// the slave side as its stdin, stdout and stderr, and the executor reads
+// its output from and writes its input to the master side.
+type terminal struct {
+	master, slave *os.File
+	output        io.Writer
+	done          chan struct{} // closed when the output is read
+}
+
+// attachTerminal puts cmd on a new pseudo-terminal whose output is
+// copied to output once the command is started.
+func attachTerminal(cmd *exec.Cmd, output io.Writer) (*terminal, error) {
+	master, slave, err := openPTY()
+	if err != nil {
+		return nil, err
+	}
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = slave, slave, slave
+	setControllingTerminal(cmd)
+	hasTerm := false
+	for _, kv := range cmd.Env {
+		hasTerm = hasTerm || strings.HasPrefix(kv, "TERM=")
+	}
+	if !hasTerm {
+		cmd.Env = append(cmd.Env, "TERM=xterm-256color")
+	}
+	return &terminal{master: master, slave: slave, output: output, done: make(chan struct{})}, nil
+}
+
+// start hands the terminal over to the started command and forwards
+// input, if any, to it. Reading input stops at the first read after the
+// command finished.
+func (t *terminal) start(input io.Reader) {
+	// With the parent's copy of the slave closed, reading the master
+	// fails once the command and its children have exited.
+	t.slave.Close()
+	go func() {
+		io.Copy(t.output, t.master)
+		close(t.done)
+	}()
+	if input != nil {
+		go io.Copy(t.master, input)
+	}
+}
+
+// close waits a little for output still buffered after the command
+// exited, then closes the terminal.
+func (t *terminal) close() {
+	select {
+	case <-t.done:
+	case <-time.After(waitDelay):
+	}
+	t.master.Close()
+	<-t.done
+}
+
+// abort closes a terminal whose command failed to start.
+func (t *terminal) abort() {
+	t.slave.Close()
+	t.master.Close()
+}
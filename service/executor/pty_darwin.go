@@ -0,0 +1,39 @@
+package executor
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+// openPTY opens a new pseudo-terminal pair from /dev/ptmx.
+func openPTY() (master, slave *os.File, err error) {
+	master, err = os.OpenFile("/dev/ptmx", os.O_RDWR|syscall.O_NOCTTY|syscall.O_CLOEXEC, 0)
+	if err != nil {
+		return nil, nil, err
+	}
+	conn, err := master.SyscallConn()
+	if err == nil {
+		err = ioctl(conn, syscall.TIOCPTYGRANT, nil)
+	}
+	if err == nil {
+		err = ioctl(conn, syscall.TIOCPTYUNLK, nil)
+	}
+	name := make([]byte, 128)
+	if err == nil {
+		err = ioctl(conn, syscall.TIOCPTYGNAME, unsafe.Pointer(&name[0]))
+	}
+	if err == nil {
+		if i := bytes.IndexByte(name, 0); i >= 0 {
+			name = name[:i]
+		}
+		slave, err = os.OpenFile(string(name), os.O_RDWR|syscall.O_NOCTTY|syscall.O_CLOEXEC, 0)
+	}
+	if err != nil {
+		master.Close()
+		return nil, nil, fmt.Errorf("pty: %w", err)
+	}
+	return master, slave, nil
+}
@@ -0,0 +1,33 @@
+package executor
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+// openPTY opens a new pseudo-terminal pair from /dev/ptmx.
+func openPTY() (master, slave *os.File, err error) {
+	master, err = os.OpenFile("/dev/ptmx", os.O_RDWR|syscall.O_NOCTTY|syscall.O_CLOEXEC, 0)
+	if err != nil {
+		return nil, nil, err
+	}
+	conn, err := master.SyscallConn()
+	if err == nil {
+		var unlock int32
+		err = ioctl(conn, syscall.TIOCSPTLCK, unsafe.Pointer(&unlock))
+	}
+	var n uint32
+	if err == nil {
+		err = ioctl(conn, syscall.TIOCGPTN, unsafe.Pointer(&n))
+	}
+	if err == nil {
+		slave, err = os.OpenFile(fmt.Sprintf("/dev/pts/%d", n), os.O_RDWR|syscall.O_NOCTTY|syscall.O_CLOEXEC, 0)
+	}
+	if err != nil {
+		master.Close()
+		return nil, nil, fmt.Errorf("pty: %w", err)
+	}
+	return master, slave, nil
+}
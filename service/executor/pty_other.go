@@ -0,0 +1,14 @@
+//go:build !linux && !darwin
+
+package executor
+
+import (
+	"os"
+	"os/exec"
+)
+
+func openPTY() (master, slave *os.File, err error) {
+	return nil, nil, ErrPTYUnsupported
+}
+
+func setControllingTerminal(cmd *exec.Cmd) {}
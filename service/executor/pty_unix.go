@@ -0,0 +1,31 @@
+//go:build linux || darwin
+
+package executor
+
+import (
+	"os/exec"
+	"syscall"
+	"unsafe"
+)
+
+// setControllingTerminal starts cmd in a new session with its stdin, the
+// terminal, as the controlling terminal, so it sees a TTY and gets job
+// control signals from it.
+func setControllingTerminal(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true, Setctty: true, Ctty: 0}
+}
+
+// ioctl runs an ioctl on the file descriptor of a terminal device.
+func ioctl(conn syscall.RawConn, req uintptr, arg unsafe.Pointer) error {
+	var errno syscall.Errno
+	err := conn.Control(func(fd uintptr) {
+		_, _, errno = syscall.Syscall(syscall.SYS_IOCTL, fd, req, uintptr(arg))
+	})
+	if err != nil {
+		return err
+	}
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
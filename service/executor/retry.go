@@ -0,0 +1,89 @@
+package executor
+
+import (
+	"context"
+	"strings"
+	"time"
+)
+
+// networkErrors mark output of a failure caused by the network, such as a
+// module or package download, rather than by the command's input.
+var networkErrors = []string{
+	"dial tcp", "i/o timeout", "TLS handshake timeout", "connection reset by peer",
+	"no such host", "Temporary failure in name resolution", "unexpected EOF",
+	"502 Bad Gateway", "503 Service Unavailable", "504 Gateway Timeout",
+	"ETIMEDOUT", "ECONNRESET", "EAI_AGAIN",
+}
+
+// RetryPolicy runs a failed command again when the failure looks
+// transient. The zero policy runs every command once.
+type RetryPolicy struct {
+	// MaxAttempts is the number of runs in total; 0 or 1 runs once.
+	MaxAttempts int
+	// Backoff is the wait before the second run; it doubles for each
+	// further run, up to MaxBackoff if set.
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+	// ExitCodes are the exit codes to retry; empty retries any failure.
+	ExitCodes []int
+	// Patterns, when set, further require the output to contain one of
+	// them, so a command failing on its input isn't retried.
+	Patterns []string
+}
+
+// NetworkRetryPolicy retries commands that failed on a network error up
+// to twice, for tools that download modules or packages.
+func NetworkRetryPolicy() RetryPolicy {
+	return RetryPolicy{MaxAttempts: 3, Backoff: 2 * time.Second, MaxBackoff: 10 * time.Second, Patterns: networkErrors}
+}
+
+// Retryable reports whether a run that was the given attempt, starting
+// at 1, and failed with exitCode and output should be run again.
+func (p RetryPolicy) Retryable(attempt, exitCode int, output string) bool {
+	if exitCode == 0 || attempt >= p.MaxAttempts {
+		return false
+	}
+	if len(p.ExitCodes) > 0 {
+		listed := false
+		for _, code := range p.ExitCodes {
+			listed = listed || code == exitCode
+		}
+		if !listed {
+			return false
+		}
+	}
+	if len(p.Patterns) == 0 {
+		return true
+	}
+	for _, pattern := range p.Patterns {
+		if strings.Contains(output, pattern) {
+			return true
+		}
+	}
+	return false
+}
+
+// Delay returns the wait after the given failed attempt.
+func (p RetryPolicy) Delay(attempt int) time.Duration {
+	d := p.Backoff
+	for i := 1; i < attempt && (p.MaxBackoff <= 0 || d < p.MaxBackoff); i++ {
+		d *= 2
+	}
+	if p.MaxBackoff > 0 && d > p.MaxBackoff {
+		d = p.MaxBackoff
+	}
+	return d
+}
+
+// Wait sleeps for the delay after attempt, returning false if ctx is
+// done first.
+func (p RetryPolicy) Wait(ctx context.Context, attempt int) bool {
+	t := time.NewTimer(p.Delay(attempt))
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
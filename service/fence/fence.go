@@ -0,0 +1,152 @@
+// Package fence parses fenced code blocks in markdown. As in CommonMark, a
+// block only closes on a fence of the same character at least as long as
+// the one that opened it, so a ```` block can hold ``` examples, as
+// generated READMEs and docs do.
+package fence
+
+import "strings"
+
+// Block is a fenced code block.
+type Block struct {
+	Info   string // info string after the opening fence, e.g. "go"
+	Lang   string // first word of Info
+	Code   string // content between the fences
+	Start  int    // offset of the opening fence line
+	End    int    // offset just past the closing fence (len(text) if unclosed)
+	Closed bool   // false when the text ended inside the block
+}
+
+// Parse returns the fenced code blocks of text in order.
+func Parse(text string) []Block {
+	var blocks []Block
+	var open *Block
+	var char byte
+	var size, codeStart int
+
+	for pos := 0; pos < len(text); {
+		end := strings.IndexByte(text[pos:], '\n')
+		next := len(text)
+		if end >= 0 {
+			end += pos
+			next = end + 1
+		} else {
+			end = len(text)
+		}
+		line := strings.TrimRight(text[pos:end], "\r")
+
+		if open == nil {
+			if c, n, info, ok := openingFence(line); ok {
+				open = &Block{Info: info, Lang: firstWord(info), Start: pos}
+				char, size, codeStart = c, n, next
+			}
+		} else if closingFence(line, char, size) {
+			open.Code = text[codeStart:pos]
+			open.End, open.Closed = end, true
+			blocks = append(blocks, *open)
+			open = nil
+		} else if cut, ok := trailingFence(line, char, size); ok {
+			// Models sometimes close a block right after the last line.
+			open.Code = text[codeStart : pos+cut]
+			open.End, open.Closed = end, true
+			blocks = append(blocks, *open)
+			open = nil
+		}
+		pos = next
+	}
+	if open != nil {
+		if codeStart < len(text) {
+			open.Code = text[codeStart:]
+		}
+		open.End = len(text)
+		blocks = append(blocks, *open)
+	}
+	return blocks
+}
+
+// Strip returns text without its fenced code blocks.
+func Strip(text string) string {
+	var sb strings.Builder
+	prev := 0
+	for _, b := range Parse(text) {
+		sb.WriteString(text[prev:b.Start])
+		prev = b.End
+	}
+	sb.WriteString(text[prev:])
+	return sb.String()
+}
+
+// For returns a backtick fence longer than any backtick run at the start
+// of a line of content, so content can be fenced without closing early.
+func For(content string) string {
+	size := 3
+	if !strings.Contains(content, "```") {
+		return "```"
+	}
+	for content != "" {
+		line, rest, _ := strings.Cut(content, "\n")
+		if n := run(strings.TrimLeft(line, " \t"), '`'); n >= size {
+			size = n + 1
+		}
+		content = rest
+	}
+	return strings.Repeat("`", size)
+}
+
+// Helper functions
+
+// openingFence reports whether line opens a block: three or more backticks
+// or tildes, optionally indented, and an info string (without backticks
+// for a backtick fence).
+func openingFence(line string) (char byte, size int, info string, ok bool) {
+	s := strings.TrimLeft(line, " \t")
+	if len(s) < 3 || (s[0] != '`' && s[0] != '~') {
+		return 0, 0, "", false
+	}
+	char = s[0]
+	size = run(s, char)
+	if size < 3 {
+		return 0, 0, "", false
+	}
+	info = strings.TrimSpace(s[size:])
+	if char == '`' && strings.IndexByte(info, '`') >= 0 {
+		return 0, 0, "", false
+	}
+	return char, size, info, true
+}
+
+// closingFence reports whether line is only a fence of char at least size
+// long.
+func closingFence(line string, char byte, size int) bool {
+	s := strings.TrimSpace(line)
+	n := run(s, char)
+	return n >= size && n == len(s)
+}
+
+// trailingFence reports whether line ends with a fence of exactly size
+// after code, returning where the fence starts.
+func trailingFence(line string, char byte, size int) (int, bool) {
+	s := strings.TrimRight(line, " \t")
+	n := 0
+	for n < len(s) && s[len(s)-1-n] == char {
+		n++
+	}
+	if n != size || n == len(s) {
+		return 0, false
+	}
+	return len(s) - n, true
+}
+
+func run(s string, char byte) int {
+	n := 0
+	for n < len(s) && s[n] == char {
+		n++
+	}
+	return n
+}
+
+func firstWord(s string) string {
+	if fields := strings.Fields(s); len(fields) > 0 {
+		return fields[0]
+	}
+	return ""
+}
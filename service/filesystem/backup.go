@@ -0,0 +1,288 @@
+package filesystem
+
+import (
+	"encoding/json"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Backups are content-addressed: BackupDir/objects holds each distinct
+// content once, named by its checksum, and BackupDir/manifest.json lists
+// which path was backed up to which content when. Writing the same
+// content again adds no copy.
+const (
+	backupObjectsDir   = "objects"
+	backupManifestFile = "manifest.json"
+)
+
+// backupManifest lists the backups of a workspace, oldest first.
+type backupManifest struct {
+	Backups []Backup `json:"backups"`
+}
+
+// Backup is one backup of a file: which path it was taken of, when, and
+// the content it holds, by checksum. Identical contents share an object,
+// so a backup is restored by its entry, not its object.
+type Backup struct {
+	Path      string    `json:"path"` // workspace-relative, slash-separated
+	Checksum  string    `json:"checksum"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// createBackup backs up filePath, returning the backup, or nil if the
+// file can't be backed up. When the file's newest backup has the same
+// content, that backup is moved up instead.
+func (m *Manager) createBackup(filePath string) *Backup {
+	content, _ := os.ReadFile(filePath)
+	if content == nil {
+		return nil
+	}
+	relPath, err := filepath.Rel(m.config.RootDir, filePath)
+	if err != nil {
+		return nil
+	}
+	relPath = filepath.ToSlash(relPath)
+	checksum := sha256Hash(content)
+
+	m.backupMu.Lock()
+	defer m.backupMu.Unlock()
+
+	object := m.backupObject(checksum)
+	if _, err := os.Stat(object); os.IsNotExist(err) {
+		if err := writeFileAtomic(object, content); err != nil {
+			return nil
+		}
+	}
+
+	manifest := m.loadBackupManifest()
+	if i := manifest.latest(relPath); i >= 0 && manifest.Backups[i].Checksum == checksum {
+		manifest.Backups = append(manifest.Backups[:i], manifest.Backups[i+1:]...)
+	}
+	backup := Backup{Path: relPath, Checksum: checksum, CreatedAt: time.Now().UTC()}
+	manifest.Backups = append(manifest.Backups, backup)
+	m.pruneBackups(manifest, relPath)
+	if err := m.saveBackupManifest(manifest); err != nil {
+		return nil
+	}
+	return &backup
+}
+
+// pruneBackups keeps the newest MaxBackups backups of path and removes
+// the objects no backup refers to any more.
+func (m *Manager) pruneBackups(manifest *backupManifest, path string) {
+	if m.config.MaxBackups <= 0 {
+		return
+	}
+	kept := manifest.Backups[:0]
+	dropped := make(map[string]bool)
+	excess := -m.config.MaxBackups
+	for _, b := range manifest.Backups {
+		if b.Path == path {
+			excess++
+		}
+	}
+	for _, b := range manifest.Backups {
+		if b.Path == path && excess > 0 {
+			excess--
+			dropped[b.Checksum] = true
+			continue
+		}
+		kept = append(kept, b)
+	}
+	manifest.Backups = kept
+
+	for _, b := range kept {
+		delete(dropped, b.Checksum)
+	}
+	for checksum := range dropped {
+		os.Remove(m.backupObject(checksum))
+	}
+}
+
+// BackupObject returns the path of the object holding the backup's
+// content.
+func (m *Manager) BackupObject(backup Backup) string {
+	return m.backupObject(backup.Checksum)
+}
+
+// backupObject returns the path of the object holding content with
+// checksum, fanned out by its first two characters.
+func (m *Manager) backupObject(checksum string) string {
+	return filepath.Join(m.config.RootDir, m.config.BackupDir, backupObjectsDir, checksum[:2], checksum)
+}
+
+// loadBackupManifest reads the manifest; a missing or unreadable one is
+// empty, since backups are best effort.
+func (m *Manager) loadBackupManifest() *backupManifest {
+	manifest := &backupManifest{}
+	data, err := os.ReadFile(filepath.Join(m.config.RootDir, m.config.BackupDir, backupManifestFile))
+	if err == nil {
+		json.Unmarshal(data, manifest)
+	}
+	return manifest
+}
+
+func (m *Manager) saveBackupManifest(manifest *backupManifest) error {
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(filepath.Join(m.config.RootDir, m.config.BackupDir, backupManifestFile), data)
+}
+
+// latest returns the index of the newest backup of path, or -1.
+func (bm *backupManifest) latest(path string) int {
+	for i := len(bm.Backups) - 1; i >= 0; i-- {
+		if bm.Backups[i].Path == path {
+			return i
+		}
+	}
+	return -1
+}
+
+// writeFileAtomic writes data to a temporary file beside path and renames
+// it into place, so readers never see a partial file.
+func writeFileAtomic(path string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(filepath.Dir(path), ".tmp-*")
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	if err := os.Chmod(f.Name(), 0644); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
+
+// BackupPruneStats reports what PruneBackups removed.
+type BackupPruneStats struct {
+	Backups int   // manifest entries and legacy .bak files
+	Bytes   int64 // reclaimed from disk
+}
+
+// PruneBackups applies a workspace-wide retention policy: backups made
+// before the cutoff are removed (a zero cutoff keeps them), then the
+// oldest until the backups take at most maxSize bytes (zero for no
+// limit). Objects no backup refers to, such as those left by an
+// interrupted write, are removed as well. Backups from before
+// content-addressing, the .bak files, count by their modification time.
+func (m *Manager) PruneBackups(before time.Time, maxSize int64) (BackupPruneStats, error) {
+	var stats BackupPruneStats
+	if m.config.ReadOnly {
+		return stats, ErrReadOnly
+	}
+	m.backupMu.Lock()
+	defer m.backupMu.Unlock()
+
+	backupDir := filepath.Join(m.config.RootDir, m.config.BackupDir)
+	manifest := m.loadBackupManifest()
+
+	// A backup is either a manifest entry or a legacy file; both are
+	// considered oldest first.
+	type backup struct {
+		at     time.Time
+		entry  int    // index into manifest.Backups, or -1
+		legacy string // path of a .bak file
+		size   int64
+	}
+	var backups []backup
+	refs := make(map[string]int)
+	for i, b := range manifest.Backups {
+		backups = append(backups, backup{at: b.CreatedAt, entry: i})
+		refs[b.Checksum]++
+	}
+	objects := make(map[string]int64) // checksum -> size, of objects on disk
+	err := filepath.WalkDir(backupDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return fs.SkipAll
+			}
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		switch {
+		case filepath.Base(filepath.Dir(filepath.Dir(path))) == backupObjectsDir:
+			if strings.HasPrefix(d.Name(), ".tmp-") || refs[d.Name()] == 0 {
+				if os.Remove(path) == nil {
+					stats.Bytes += info.Size()
+				}
+				return nil
+			}
+			objects[d.Name()] = info.Size()
+		case strings.HasSuffix(d.Name(), ".bak"):
+			backups = append(backups, backup{at: info.ModTime(), entry: -1, legacy: path, size: info.Size()})
+		}
+		return nil
+	})
+	if err != nil {
+		return stats, err
+	}
+	sort.SliceStable(backups, func(i, j int) bool { return backups[i].at.Before(backups[j].at) })
+
+	var total int64
+	for _, size := range objects {
+		total += size
+	}
+	for _, b := range backups {
+		total += b.size
+	}
+
+	removed := make(map[int]bool)
+	for _, b := range backups {
+		if !b.at.Before(before) && (maxSize <= 0 || total <= maxSize) {
+			break
+		}
+		stats.Backups++
+		if b.entry < 0 {
+			if os.Remove(b.legacy) == nil {
+				stats.Bytes += b.size
+				total -= b.size
+			}
+			continue
+		}
+		removed[b.entry] = true
+		checksum := manifest.Backups[b.entry].Checksum
+		if refs[checksum]--; refs[checksum] == 0 {
+			if os.Remove(m.backupObject(checksum)) == nil {
+				stats.Bytes += objects[checksum]
+				total -= objects[checksum]
+			}
+		}
+	}
+
+	if len(removed) > 0 {
+		kept := manifest.Backups[:0]
+		for i, b := range manifest.Backups {
+			if !removed[i] {
+				kept = append(kept, b)
+			}
+		}
+		manifest.Backups = kept
+		if err := m.saveBackupManifest(manifest); err != nil {
+			return stats, err
+		}
+	}
+	return stats, nil
+}
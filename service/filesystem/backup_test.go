@@ -0,0 +1,95 @@
+package filesystem
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func newBackupManager(t *testing.T) *Manager {
+	t.Helper()
+	config := DefaultConfig()
+	config.RootDir = t.TempDir()
+	m, err := NewManager(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+func readFile(t *testing.T, m *Manager, path string) string {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join(m.GetRoot(), path))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+// TestRestoreBackupSharedObject backs up two files with the same content,
+// which share an object, and restores each to its own path.
+func TestRestoreBackupSharedObject(t *testing.T) {
+	m := newBackupManager(t)
+	for _, path := range []string{"a.txt", "b.txt"} {
+		if _, err := m.WriteFile(path, "shared\n", true); err != nil {
+			t.Fatal(err)
+		}
+	}
+	backupA, err := m.WriteFile("a.txt", "a v2\n", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	backupB, err := m.WriteFile("b.txt", "b v2\n", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if backupA == nil || backupB == nil {
+		t.Fatal("WriteFile over an existing file made no backup")
+	}
+	if backupA.Path != "a.txt" || backupB.Path != "b.txt" {
+		t.Errorf("backups are of %s and %s, want a.txt and b.txt", backupA.Path, backupB.Path)
+	}
+	if m.BackupObject(*backupA) != m.BackupObject(*backupB) {
+		t.Fatal("identical contents don't share an object")
+	}
+
+	if err := m.RestoreBackup(*backupA); err != nil {
+		t.Fatal(err)
+	}
+	if got := readFile(t, m, "a.txt"); got != "shared\n" {
+		t.Errorf("a.txt = %q after restoring its backup, want %q", got, "shared\n")
+	}
+	if got := readFile(t, m, "b.txt"); got != "b v2\n" {
+		t.Errorf("b.txt = %q after restoring a.txt's backup, want it untouched", got)
+	}
+
+	if err := m.RestoreBackup(*backupB); err != nil {
+		t.Fatal(err)
+	}
+	if got := readFile(t, m, "b.txt"); got != "shared\n" {
+		t.Errorf("b.txt = %q after restoring its backup, want %q", got, "shared\n")
+	}
+}
+
+func TestRestoreBackupInvalid(t *testing.T) {
+	m := newBackupManager(t)
+	if _, err := m.WriteFile("a.txt", "one\n", true); err != nil {
+		t.Fatal(err)
+	}
+	backup, err := m.WriteFile("a.txt", "two\n", true)
+	if err != nil || backup == nil {
+		t.Fatalf("WriteFile = %v, %v", backup, err)
+	}
+
+	escaped := *backup
+	escaped.Path = "../outside.txt"
+	if err := m.RestoreBackup(escaped); !errors.Is(err, ErrPathOutsideRoot) {
+		t.Errorf("RestoreBackup outside the root = %v, want ErrPathOutsideRoot", err)
+	}
+	bad := *backup
+	bad.Checksum = "../../manifest"
+	if err := m.RestoreBackup(bad); !errors.Is(err, ErrInvalidPath) {
+		t.Errorf("RestoreBackup with a bad checksum = %v, want ErrInvalidPath", err)
+	}
+}
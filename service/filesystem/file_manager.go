@@ -2,6 +2,7 @@
 package filesystem
 
 import (
+	"context"
 	"crypto/sha256"
 	"encoding/hex"
 	"fmt"
@@ -9,8 +10,8 @@ import (
 	"os"
 	"path/filepath"
 	"regexp"
-	"sort"
 	"strings"
+	"sync"
 	"time"
 )
 
@@ -20,6 +21,7 @@ var (
 	ErrDirectoryNotFound = fmt.Errorf("directory not found")
 	ErrInvalidPath       = fmt.Errorf("invalid path")
 	ErrPathOutsideRoot   = fmt.Errorf("path outside root directory")
+	ErrReadOnly          = fmt.Errorf("workspace is read-only")
 )
 
 // FileInfo represents file information.
@@ -49,6 +51,13 @@ type Config struct {
 	BackupEnabled bool
 	MaxFileSize   int64
 	MaxBackups    int
+	ReadOnly      bool // reject all writes
+	// IgnorePatterns are skipped by scans along with
+	// DefaultIgnorePatterns, e.g. "*.pb.go" or "testdata".
+	IgnorePatterns []string
+	// ScanWorkers is how many directories ScanDirectory reads at once;
+	// zero or 1 walks sequentially.
+	ScanWorkers int
 }
 
 // DefaultConfig returns default config.
@@ -65,13 +74,15 @@ func DefaultConfig() Config {
 var DefaultIgnorePatterns = []string{
 	"node_modules", "vendor", ".git", ".svn", ".hg",
 	".idea", ".vscode", "dist", "build", "out", "target",
-	".cache", "*.log", ".DS_Store", ".ai-backup",
+	".cache", "*.log", ".DS_Store", ".ai-backup", ".aidev",
 }
 
 // Manager manages file operations.
 type Manager struct {
 	config         Config
+	realRoot       string // RootDir with symlinks resolved
 	ignorePatterns []*regexp.Regexp
+	backupMu       sync.Mutex // guards the backup manifest
 }
 
 // NewManager creates a new file manager.
@@ -93,11 +104,17 @@ func NewManager(config Config) (*Manager, error) {
 	if config.BackupDir == "" {
 		config.BackupDir = ".ai-backup"
 	}
+	if config.ScanWorkers <= 0 {
+		config.ScanWorkers = 1
+	}
 
-	m := &Manager{config: config}
+	m := &Manager{config: config, realRoot: absRoot}
+	if real, err := filepath.EvalSymlinks(absRoot); err == nil {
+		m.realRoot = real
+	}
 
 	m.ignorePatterns = make([]*regexp.Regexp, 0)
-	for _, pattern := range DefaultIgnorePatterns {
+	for _, pattern := range append(append([]string(nil), DefaultIgnorePatterns...), config.IgnorePatterns...) {
 		regex, _ := patternToRegex(pattern)
 		if regex != nil {
 			m.ignorePatterns = append(m.ignorePatterns, regex)
@@ -151,18 +168,21 @@ func (m *Manager) ReadFile(path string) (*FileContent, error) {
 	}, nil
 }
 
-// WriteFile writes a file with backup.
-func (m *Manager) WriteFile(path, content string, createDirs bool) (*string, error) {
+// WriteFile writes a file with backup, returning the backup of the content
+// it replaced, if one was made.
+func (m *Manager) WriteFile(path, content string, createDirs bool) (*Backup, error) {
+	if m.config.ReadOnly {
+		return nil, ErrReadOnly
+	}
 	absPath, err := m.resolvePath(path)
 	if err != nil {
 		return nil, err
 	}
 
-	var backupPath *string
+	var backup *Backup
 
 	if _, err := os.Stat(absPath); err == nil && m.config.BackupEnabled {
-		bp := m.createBackup(absPath)
-		backupPath = &bp
+		backup = m.createBackup(absPath)
 	}
 
 	if createDirs {
@@ -173,7 +193,7 @@ func (m *Manager) WriteFile(path, content string, createDirs bool) (*string, err
 		return nil, err
 	}
 
-	return backupPath, nil
+	return backup, nil
 }
 
 // FileExists checks if file exists.
@@ -186,19 +206,32 @@ func (m *Manager) FileExists(path string) bool {
 	return err == nil
 }
 
-// ScanDirectory scans a directory.
-func (m *Manager) ScanDirectory(path string, recursive bool) ([]FileInfo, error) {
+// ScanDirectory scans a directory, listing it (and without recursive,
+// none of its subdirectories) in lexical pre-order like filepath.WalkDir.
+// With ScanWorkers above 1, recursive scans read directories in a pool of
+// that many workers. The scan stops with ctx's error once ctx is done.
+func (m *Manager) ScanDirectory(ctx context.Context, path string, recursive bool) ([]FileInfo, error) {
 	absPath, err := m.resolvePath(path)
 	if err != nil {
 		return nil, err
 	}
+	if m.config.ScanWorkers > 1 && recursive {
+		return m.scanParallel(ctx, absPath)
+	}
+	return m.walkDirectory(ctx, absPath, recursive)
+}
 
+// walkDirectory is the sequential ScanDirectory.
+func (m *Manager) walkDirectory(ctx context.Context, absPath string, recursive bool) ([]FileInfo, error) {
 	var files []FileInfo
 
-	err = filepath.WalkDir(absPath, func(walkPath string, d fs.DirEntry, err error) error {
+	err := filepath.WalkDir(absPath, func(walkPath string, d fs.DirEntry, err error) error {
 		if err != nil {
 			return err
 		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
 
 		relPath, _ := filepath.Rel(m.config.RootDir, walkPath)
 
@@ -213,17 +246,11 @@ func (m *Manager) ScanDirectory(path string, recursive bool) ([]FileInfo, error)
 			return fs.SkipDir
 		}
 
-		info, _ := d.Info()
-		files = append(files, FileInfo{
-			Path:         relPath,
-			AbsolutePath: walkPath,
-			Name:         d.Name(),
-			Extension:    filepath.Ext(d.Name()),
-			Size:         info.Size(),
-			IsDir:        d.IsDir(),
-			IsFile:       !d.IsDir(),
-			ModTime:      info.ModTime(),
-		})
+		info, err := d.Info()
+		if err != nil {
+			return nil // removed since the directory was read
+		}
+		files = append(files, newFileInfo(relPath, walkPath, info))
 		return nil
 	})
 
@@ -231,8 +258,8 @@ func (m *Manager) ScanDirectory(path string, recursive bool) ([]FileInfo, error)
 }
 
 // ListFiles lists all files.
-func (m *Manager) ListFiles(path string, recursive bool, extensions []string) ([]FileInfo, error) {
-	files, err := m.ScanDirectory(path, recursive)
+func (m *Manager) ListFiles(ctx context.Context, path string, recursive bool, extensions []string) ([]FileInfo, error) {
+	files, err := m.ScanDirectory(ctx, path, recursive)
 	if err != nil {
 		return nil, err
 	}
@@ -265,21 +292,35 @@ func (m *Manager) CopyFile(src, dst string) error {
 	return os.WriteFile(dst, content, 0644)
 }
 
-// RestoreBackup restores from backup.
-func (m *Manager) RestoreBackup(backupPath string) error {
-	content, err := os.ReadFile(backupPath)
+// RestoreBackup writes the content of backup back to the path it was
+// taken of.
+func (m *Manager) RestoreBackup(backup Backup) error {
+	if m.config.ReadOnly {
+		return ErrReadOnly
+	}
+	if _, err := hex.DecodeString(backup.Checksum); err != nil || len(backup.Checksum) < 2 {
+		return ErrInvalidPath
+	}
+	absPath, err := m.resolvePath(filepath.FromSlash(backup.Path))
 	if err != nil {
 		return err
 	}
+	content, err := os.ReadFile(m.backupObject(backup.Checksum))
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(absPath, content, 0644)
+}
 
-	// Extract original path from backup path
-	relPath := strings.TrimPrefix(backupPath, m.config.RootDir)
-	relPath = strings.TrimPrefix(relPath, string(filepath.Separator))
-	relPath = strings.TrimSuffix(relPath, ".bak")
-	relPath = strings.TrimSuffix(relPath, ".ai-backup")
+// IsIgnored reports whether a root-relative path matches the ignore patterns.
+func (m *Manager) IsIgnored(path string, isDir bool) bool {
+	return m.shouldIgnore(path, isDir)
+}
 
-	absPath := filepath.Join(m.config.RootDir, relPath)
-	return os.WriteFile(absPath, content, 0644)
+// Resolve returns the absolute path of path, or ErrPathOutsideRoot if it
+// leads outside the root, through symlinks included.
+func (m *Manager) Resolve(path string) (string, error) {
+	return m.resolvePath(path)
 }
 
 // GetRoot returns root directory.
@@ -293,7 +334,7 @@ func (m *Manager) resolvePath(path string) (string, error) {
 
 	if filepath.IsAbs(path) {
 		rel, err := filepath.Rel(m.config.RootDir, path)
-		if err != nil || strings.HasPrefix(rel, "..") {
+		if err != nil || strings.HasPrefix(rel, "..") || !m.withinRealRoot(path) {
 			return "", ErrPathOutsideRoot
 		}
 		return path, nil
@@ -306,10 +347,36 @@ func (m *Manager) resolvePath(path string) (string, error) {
 	if err != nil || strings.HasPrefix(rel, "..") {
 		return "", ErrPathOutsideRoot
 	}
+	if !m.withinRealRoot(absPath) {
+		return "", ErrPathOutsideRoot
+	}
 
 	return absPath, nil
 }
 
+// withinRealRoot reports whether path, with symlinks in its existing
+// prefix resolved, stays inside the root, so links can't escape it.
+func (m *Manager) withinRealRoot(path string) bool {
+	existing, rest := path, ""
+	for {
+		if _, err := os.Lstat(existing); err == nil {
+			break
+		}
+		parent := filepath.Dir(existing)
+		if parent == existing {
+			return false
+		}
+		rest = filepath.Join(filepath.Base(existing), rest)
+		existing = parent
+	}
+	real, err := filepath.EvalSymlinks(existing)
+	if err != nil {
+		return false
+	}
+	rel, err := filepath.Rel(m.realRoot, filepath.Join(real, rest))
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
 func (m *Manager) shouldIgnore(path string, isDir bool) bool {
 	path = filepath.ToSlash(path)
 	for _, pattern := range m.ignorePatterns {
@@ -320,58 +387,6 @@ func (m *Manager) shouldIgnore(path string, isDir bool) bool {
 	return false
 }
 
-func (m *Manager) createBackup(filePath string) string {
-	content, _ := os.ReadFile(filePath)
-	if content == nil {
-		return ""
-	}
-
-	backupDir := filepath.Join(m.config.RootDir, m.config.BackupDir)
-	os.MkdirAll(backupDir, 0755)
-
-	relPath, _ := filepath.Rel(m.config.RootDir, filePath)
-	backupName := fmt.Sprintf("%s.%s.bak", filepath.Base(filePath), time.Now().Format("20060102-150405"))
-	backupPath := filepath.Join(backupDir, filepath.Dir(relPath), backupName)
-
-	os.MkdirAll(filepath.Dir(backupPath), 0755)
-	os.WriteFile(backupPath, content, 0644)
-
-	// Cleanup old backups
-	m.cleanupOldBackups(filePath)
-
-	return backupPath
-}
-
-func (m *Manager) cleanupOldBackups(filePath string) {
-	if m.config.MaxBackups <= 0 {
-		return
-	}
-
-	backupDir := filepath.Join(m.config.RootDir, m.config.BackupDir)
-	relPath, _ := filepath.Rel(m.config.RootDir, filePath)
-	subDir := filepath.Join(backupDir, filepath.Dir(relPath))
-
-	entries, err := os.ReadDir(subDir)
-	if err != nil {
-		return
-	}
-
-	baseName := filepath.Base(filePath)
-	var backups []string
-	for _, entry := range entries {
-		name := entry.Name()
-		if strings.HasPrefix(name, baseName) && strings.HasSuffix(name, ".bak") {
-			backups = append(backups, filepath.Join(subDir, name))
-		}
-	}
-
-	sort.Strings(backups)
-
-	for i := 0; i < len(backups)-m.config.MaxBackups; i++ {
-		os.Remove(backups[i])
-	}
-}
-
 // Utility functions
 func patternToRegex(pattern string) (*regexp.Regexp, error) {
 	regex := "^"
@@ -395,3 +410,16 @@ func sha256Hash(data []byte) string {
 	hash := sha256.Sum256(data)
 	return hex.EncodeToString(hash[:])
 }
+
+func newFileInfo(relPath, absPath string, info fs.FileInfo) FileInfo {
+	return FileInfo{
+		Path:         relPath,
+		AbsolutePath: absPath,
+		Name:         info.Name(),
+		Extension:    filepath.Ext(info.Name()),
+		Size:         info.Size(),
+		IsDir:        info.IsDir(),
+		IsFile:       !info.IsDir(),
+		ModTime:      info.ModTime(),
+	}
+}
@@ -0,0 +1,164 @@
+package filesystem
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// scanNode is a directory read by the parallel scan: its listed entries
+// in lexical order and, by entry index, the subdirectories to descend.
+type scanNode struct {
+	entries []FileInfo
+	subdirs map[int]*scanNode
+}
+
+// scanJob is a directory waiting to be read into its node.
+type scanJob struct {
+	dir  string
+	node *scanNode
+}
+
+// scanner is a pool of workers reading the directories of a scan. The
+// queue grows as directories are read, so workers never block on each
+// other; the first error stops the scan.
+type scanner struct {
+	m *Manager
+
+	mu      sync.Mutex
+	more    *sync.Cond // signalled when the queue grows or the scan ends
+	queue   []scanJob
+	pending int // directories queued or being read
+	err     error
+}
+
+// scanParallel is the recursive ScanDirectory with ScanWorkers workers
+// reading directories. The result is ordered as walkDirectory orders it.
+func (m *Manager) scanParallel(ctx context.Context, absPath string) ([]FileInfo, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	info, err := os.Lstat(absPath)
+	if err != nil {
+		return nil, err
+	}
+	relPath, _ := filepath.Rel(m.config.RootDir, absPath)
+	if m.shouldIgnore(relPath, info.IsDir()) {
+		return nil, nil
+	}
+	files := []FileInfo{newFileInfo(relPath, absPath, info)}
+	if !info.IsDir() {
+		return files, nil
+	}
+
+	root := &scanNode{}
+	s := &scanner{m: m, queue: []scanJob{{absPath, root}}, pending: 1}
+	s.more = sync.NewCond(&s.mu)
+	var wg sync.WaitGroup
+	for i := 0; i < m.config.ScanWorkers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.work(ctx)
+		}()
+	}
+	wg.Wait()
+	if s.err != nil {
+		return nil, s.err
+	}
+	return root.flatten(files), nil
+}
+
+// work reads queued directories until the scan is done or fails.
+func (s *scanner) work(ctx context.Context) {
+	for {
+		job, ok := s.next()
+		if !ok {
+			return
+		}
+		subdirs, err := s.read(ctx, job.dir, job.node)
+		s.done(job.node, subdirs, err)
+	}
+}
+
+// next takes a directory off the queue, waiting while others are being
+// read. It reports false once nothing is left or the scan failed.
+func (s *scanner) next() (scanJob, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for len(s.queue) == 0 && s.pending > 0 && s.err == nil {
+		s.more.Wait()
+	}
+	if s.err != nil || len(s.queue) == 0 {
+		return scanJob{}, false
+	}
+	// Last in, first out: depth first keeps the queue short.
+	job := s.queue[len(s.queue)-1]
+	s.queue = s.queue[:len(s.queue)-1]
+	return job, true
+}
+
+// done queues the subdirectories read into node, or records the first
+// error, and wakes the waiting workers.
+func (s *scanner) done(node *scanNode, subdirs map[int]string, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.pending--
+	if err != nil && s.err == nil {
+		s.err = err
+	}
+	if s.err == nil {
+		for i, path := range subdirs {
+			child := &scanNode{}
+			node.subdirs[i] = child
+			s.queue = append(s.queue, scanJob{path, child})
+			s.pending++
+		}
+	}
+	s.more.Broadcast()
+}
+
+// read lists the entries of dir that aren't ignored, returning the
+// subdirectories to descend by entry index.
+func (s *scanner) read(ctx context.Context, dir string, node *scanNode) (map[int]string, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	subdirs := make(map[int]string)
+	for _, d := range entries {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		path := filepath.Join(dir, d.Name())
+		relPath, _ := filepath.Rel(s.m.config.RootDir, path)
+		if s.m.shouldIgnore(relPath, d.IsDir()) {
+			continue
+		}
+		info, err := d.Info()
+		if err != nil {
+			continue // removed since the directory was read
+		}
+		if d.IsDir() {
+			subdirs[len(node.entries)] = path
+		}
+		node.entries = append(node.entries, newFileInfo(relPath, path, info))
+	}
+	node.subdirs = make(map[int]*scanNode, len(subdirs))
+	return subdirs, nil
+}
+
+// flatten appends the node's entries to files in pre-order.
+func (n *scanNode) flatten(files []FileInfo) []FileInfo {
+	for i, entry := range n.entries {
+		files = append(files, entry)
+		if child := n.subdirs[i]; child != nil {
+			files = child.flatten(files)
+		}
+	}
+	return files
+}
@@ -0,0 +1,115 @@
+package filesystem
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// makeTree writes a tree of depth levels of fanout directories, each with
+// files files, under root.
+func makeTree(tb testing.TB, root string, depth, fanout, files int) {
+	tb.Helper()
+	var fill func(dir string, level int)
+	fill = func(dir string, level int) {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			tb.Fatal(err)
+		}
+		for i := 0; i < files; i++ {
+			if err := os.WriteFile(filepath.Join(dir, fmt.Sprintf("f%02d.go", i)), []byte("package p\n"), 0644); err != nil {
+				tb.Fatal(err)
+			}
+		}
+		if level == depth {
+			return
+		}
+		for i := 0; i < fanout; i++ {
+			fill(filepath.Join(dir, fmt.Sprintf("d%02d", i)), level+1)
+		}
+	}
+	fill(root, 0)
+}
+
+func newScanManager(tb testing.TB, root string, workers int, ignore ...string) *Manager {
+	tb.Helper()
+	config := DefaultConfig()
+	config.RootDir = root
+	config.ScanWorkers = workers
+	config.IgnorePatterns = ignore
+	m, err := NewManager(config)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	return m
+}
+
+func TestScanParallelMatchesWalk(t *testing.T) {
+	root := t.TempDir()
+	makeTree(t, root, 3, 4, 3)
+	for _, dir := range []string{".git/objects", "node_modules/x", "d00/vendor", "d01/testdata/deep"} {
+		makeTree(t, filepath.Join(root, dir), 0, 0, 2)
+	}
+	for _, file := range []string{"d02/app.log", "d03/gen.pb.go", "d00/.aidev"} {
+		if err := os.WriteFile(filepath.Join(root, file), []byte("x"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	ctx := context.Background()
+
+	for _, path := range []string{".", "d01", "d02/d03", "d03/f00.go"} {
+		seq := newScanManager(t, root, 1, "testdata", "*.pb.go")
+		par := newScanManager(t, root, 8, "testdata", "*.pb.go")
+		want, err := seq.ScanDirectory(ctx, path, true)
+		if err != nil {
+			t.Fatalf("sequential scan of %s: %v", path, err)
+		}
+		got, err := par.ScanDirectory(ctx, path, true)
+		if err != nil {
+			t.Fatalf("parallel scan of %s: %v", path, err)
+		}
+		if len(want) == 0 {
+			t.Fatalf("sequential scan of %s found nothing", path)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("parallel scan of %s: %d entries, want the %d of the walk in its order", path, len(got), len(want))
+			for i := 0; i < len(got) && i < len(want); i++ {
+				if got[i].Path != want[i].Path {
+					t.Errorf("first difference at %d: %s, want %s", i, got[i].Path, want[i].Path)
+					break
+				}
+			}
+		}
+	}
+}
+
+func TestScanParallelCanceled(t *testing.T) {
+	root := t.TempDir()
+	makeTree(t, root, 2, 3, 2)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := newScanManager(t, root, 8).ScanDirectory(ctx, ".", true); !errors.Is(err, context.Canceled) {
+		t.Errorf("scan with a canceled context = %v, want context.Canceled", err)
+	}
+}
+
+// BenchmarkScanDirectory compares the sequential walk with the worker
+// pool on a tree of 1365 directories and 4095 files.
+func BenchmarkScanDirectory(b *testing.B) {
+	root := b.TempDir()
+	makeTree(b, root, 5, 4, 3)
+	for _, workers := range []int{1, 8} {
+		m := newScanManager(b, root, workers)
+		b.Run(fmt.Sprintf("workers=%d", workers), func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if _, err := m.ScanDirectory(context.Background(), ".", true); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
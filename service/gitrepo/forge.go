@@ -0,0 +1,454 @@
+package gitrepo
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Forge kinds.
+const (
+	ForgeGitHub = "github"
+	ForgeGitLab = "gitlab"
+	ForgeGitea  = "gitea"
+)
+
+// Forge is a host serving repositories through a forge API. Remotes are
+// matched to a forge by the host of their clone URL.
+type Forge struct {
+	Kind string // github, gitlab or gitea
+	// URL is the base URL of the forge's web UI, e.g.
+	// https://gitlab.example.com.
+	URL   string
+	Token string
+}
+
+// VCSProvider is the API of a forge: the pull or merge requests of a
+// repository and their discussion. Branches are created with git and
+// pushed with Push.
+type VCSProvider interface {
+	// Kind returns the forge kind.
+	Kind() string
+	// OpenPullRequest opens a pull request and returns its URL.
+	OpenPullRequest(ctx context.Context, pr PullRequest) (string, error)
+	// PullRequestDiff returns the unified diff of pull request number of
+	// the repository at remote.
+	PullRequestDiff(ctx context.Context, remote string, number int) (string, error)
+	// Comment posts a comment on pull request number.
+	Comment(ctx context.Context, remote string, number int, body string) error
+}
+
+// forgeTokenEnv names the environment variable holding the token of each
+// forge kind.
+var forgeTokenEnv = map[string]string{
+	ForgeGitHub: "GITHUB_TOKEN",
+	ForgeGitLab: "GITLAB_TOKEN",
+	ForgeGitea:  "GITEA_TOKEN",
+}
+
+// ParseForges parses a comma-separated list of kind=url forges, as in
+// AIDEV_FORGES. A URL without a scheme is served over HTTPS. Each forge
+// takes its token from the variable of its kind, e.g. GITLAB_TOKEN.
+func ParseForges(spec string) ([]Forge, error) {
+	var forges []Forge
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		kind, base, ok := strings.Cut(entry, "=")
+		env, known := forgeTokenEnv[kind]
+		if !ok || !known || base == "" {
+			return nil, fmt.Errorf("invalid forge %q: want github=, gitlab= or gitea=<url>", entry)
+		}
+		if !strings.Contains(base, "://") {
+			base = "https://" + base
+		}
+		u, err := url.Parse(base)
+		if err != nil || u.Host == "" {
+			return nil, fmt.Errorf("invalid forge %q: bad URL", entry)
+		}
+		forges = append(forges, Forge{Kind: kind, URL: strings.TrimSuffix(base, "/"), Token: os.Getenv(env)})
+	}
+	return forges, nil
+}
+
+// defaultForges are the public forges, followed by those in AIDEV_FORGES.
+// GitHub is configured by Config.Token and Config.APIURL.
+func defaultForges() []Forge {
+	forges := []Forge{{Kind: ForgeGitLab, URL: "https://gitlab.com", Token: os.Getenv("GITLAB_TOKEN")}}
+	// A malformed list is reported by callers that validate it.
+	extra, _ := ParseForges(os.Getenv("AIDEV_FORGES"))
+	return append(forges, extra...)
+}
+
+// Provider returns the forge API of the repository at remote.
+func (c *Client) Provider(remote string) (VCSProvider, error) {
+	host, _, err := splitRemote(remote)
+	if err != nil {
+		return nil, err
+	}
+	if host == "github.com" {
+		return &githubProvider{client: c, api: c.config.APIURL, token: c.config.Token}, nil
+	}
+	f, ok := c.forge(host)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedHost, remote)
+	}
+	switch f.Kind {
+	case ForgeGitHub:
+		// GitHub Enterprise serves its API under /api/v3.
+		return &githubProvider{client: c, api: f.URL + "/api/v3", token: f.Token}, nil
+	case ForgeGitLab:
+		return &gitlabProvider{client: c, api: f.URL + "/api/v4", token: f.Token}, nil
+	default:
+		return &giteaProvider{client: c, api: f.URL + "/api/v1", token: f.Token}, nil
+	}
+}
+
+// githubProvider is the GitHub REST API.
+type githubProvider struct {
+	client *Client
+	api    string
+	token  string
+}
+
+func (p *githubProvider) Kind() string { return ForgeGitHub }
+
+func (p *githubProvider) OpenPullRequest(ctx context.Context, pr PullRequest) (string, error) {
+	repo, err := p.repo(pr.Remote)
+	if err != nil {
+		return "", err
+	}
+	var result struct {
+		HTMLURL string `json:"html_url"`
+	}
+	body := map[string]string{"title": pr.Title, "head": pr.Head, "base": pr.Base, "body": pr.Body}
+	if err := p.call(ctx, "POST", repo+"/pulls", body, &result); err != nil {
+		return "", fmt.Errorf("open pull request: %w", err)
+	}
+	return result.HTMLURL, nil
+}
+
+func (p *githubProvider) PullRequestDiff(ctx context.Context, remote string, number int) (string, error) {
+	repo, err := p.repo(remote)
+	if err != nil {
+		return "", err
+	}
+	diff, err := p.client.request(ctx, "GET", fmt.Sprintf("%s/pulls/%d", repo, number), p.header("application/vnd.github.diff"), nil)
+	if err != nil {
+		return "", fmt.Errorf("pull request %d diff: %w", number, err)
+	}
+	return string(diff), nil
+}
+
+func (p *githubProvider) Comment(ctx context.Context, remote string, number int, body string) error {
+	repo, err := p.repo(remote)
+	if err != nil {
+		return err
+	}
+	if err := p.call(ctx, "POST", fmt.Sprintf("%s/issues/%d/comments", repo, number), map[string]string{"body": body}, nil); err != nil {
+		return fmt.Errorf("comment on pull request %d: %w", number, err)
+	}
+	return nil
+}
+
+func (p *githubProvider) repo(remote string) (string, error) {
+	if p.token == "" {
+		return "", fmt.Errorf("%w for github (set GITHUB_TOKEN)", ErrNoToken)
+	}
+	_, path, err := splitRemote(remote)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSuffix(p.api, "/") + "/repos/" + path, nil
+}
+
+func (p *githubProvider) header(accept string) http.Header {
+	h := http.Header{}
+	h.Set("Authorization", "Bearer "+p.token)
+	h.Set("Accept", accept)
+	return h
+}
+
+func (p *githubProvider) call(ctx context.Context, method, endpoint string, in, out interface{}) error {
+	return p.client.callJSON(ctx, method, endpoint, p.header("application/vnd.github+json"), in, out)
+}
+
+// gitlabProvider is the GitLab REST API, where pull requests are merge
+// requests.
+type gitlabProvider struct {
+	client *Client
+	api    string
+	token  string
+}
+
+func (p *gitlabProvider) Kind() string { return ForgeGitLab }
+
+func (p *gitlabProvider) OpenPullRequest(ctx context.Context, pr PullRequest) (string, error) {
+	project, err := p.project(pr.Remote)
+	if err != nil {
+		return "", err
+	}
+	var result struct {
+		WebURL string `json:"web_url"`
+	}
+	body := map[string]string{"source_branch": pr.Head, "target_branch": pr.Base, "title": pr.Title, "description": pr.Body}
+	if err := p.call(ctx, "POST", project+"/merge_requests", body, &result); err != nil {
+		return "", fmt.Errorf("open merge request: %w", err)
+	}
+	return result.WebURL, nil
+}
+
+// PullRequestDiff assembles the diff of a merge request from its changed
+// files, which GitLab returns without their file headers.
+func (p *gitlabProvider) PullRequestDiff(ctx context.Context, remote string, number int) (string, error) {
+	project, err := p.project(remote)
+	if err != nil {
+		return "", err
+	}
+	var changes []struct {
+		OldPath     string `json:"old_path"`
+		NewPath     string `json:"new_path"`
+		Diff        string `json:"diff"`
+		NewFile     bool   `json:"new_file"`
+		DeletedFile bool   `json:"deleted_file"`
+	}
+	if err := p.call(ctx, "GET", fmt.Sprintf("%s/merge_requests/%d/diffs?per_page=100", project, number), nil, &changes); err != nil {
+		return "", fmt.Errorf("merge request %d diff: %w", number, err)
+	}
+	var diff strings.Builder
+	for _, c := range changes {
+		from, to := "a/"+c.OldPath, "b/"+c.NewPath
+		if c.NewFile {
+			from = "/dev/null"
+		}
+		if c.DeletedFile {
+			to = "/dev/null"
+		}
+		fmt.Fprintf(&diff, "diff --git a/%s b/%s\n--- %s\n+++ %s\n%s", c.OldPath, c.NewPath, from, to, c.Diff)
+		if c.Diff != "" && !strings.HasSuffix(c.Diff, "\n") {
+			diff.WriteByte('\n')
+		}
+	}
+	return diff.String(), nil
+}
+
+func (p *gitlabProvider) Comment(ctx context.Context, remote string, number int, body string) error {
+	project, err := p.project(remote)
+	if err != nil {
+		return err
+	}
+	if err := p.call(ctx, "POST", fmt.Sprintf("%s/merge_requests/%d/notes", project, number), map[string]string{"body": body}, nil); err != nil {
+		return fmt.Errorf("comment on merge request %d: %w", number, err)
+	}
+	return nil
+}
+
+// project returns the API URL of the project at remote, which GitLab
+// addresses by its escaped path.
+func (p *gitlabProvider) project(remote string) (string, error) {
+	if p.token == "" {
+		return "", fmt.Errorf("%w for gitlab (set GITLAB_TOKEN)", ErrNoToken)
+	}
+	_, path, err := splitRemote(remote)
+	if err != nil {
+		return "", err
+	}
+	return p.api + "/projects/" + url.PathEscape(path), nil
+}
+
+func (p *gitlabProvider) call(ctx context.Context, method, endpoint string, in, out interface{}) error {
+	h := http.Header{}
+	h.Set("PRIVATE-TOKEN", p.token)
+	return p.client.callJSON(ctx, method, endpoint, h, in, out)
+}
+
+// giteaProvider is the Gitea (and Forgejo) REST API.
+type giteaProvider struct {
+	client *Client
+	api    string
+	token  string
+}
+
+func (p *giteaProvider) Kind() string { return ForgeGitea }
+
+func (p *giteaProvider) OpenPullRequest(ctx context.Context, pr PullRequest) (string, error) {
+	repo, err := p.repo(pr.Remote)
+	if err != nil {
+		return "", err
+	}
+	var result struct {
+		HTMLURL string `json:"html_url"`
+	}
+	body := map[string]string{"title": pr.Title, "head": pr.Head, "base": pr.Base, "body": pr.Body}
+	if err := p.client.callJSON(ctx, "POST", repo+"/pulls", p.header(), body, &result); err != nil {
+		return "", fmt.Errorf("open pull request: %w", err)
+	}
+	return result.HTMLURL, nil
+}
+
+func (p *giteaProvider) PullRequestDiff(ctx context.Context, remote string, number int) (string, error) {
+	repo, err := p.repo(remote)
+	if err != nil {
+		return "", err
+	}
+	diff, err := p.client.request(ctx, "GET", fmt.Sprintf("%s/pulls/%d.diff", repo, number), p.header(), nil)
+	if err != nil {
+		return "", fmt.Errorf("pull request %d diff: %w", number, err)
+	}
+	return string(diff), nil
+}
+
+func (p *giteaProvider) Comment(ctx context.Context, remote string, number int, body string) error {
+	repo, err := p.repo(remote)
+	if err != nil {
+		return err
+	}
+	if err := p.client.callJSON(ctx, "POST", fmt.Sprintf("%s/issues/%d/comments", repo, number), p.header(), map[string]string{"body": body}, nil); err != nil {
+		return fmt.Errorf("comment on pull request %d: %w", number, err)
+	}
+	return nil
+}
+
+func (p *giteaProvider) repo(remote string) (string, error) {
+	if p.token == "" {
+		return "", fmt.Errorf("%w for gitea (set GITEA_TOKEN)", ErrNoToken)
+	}
+	_, path, err := splitRemote(remote)
+	if err != nil {
+		return "", err
+	}
+	return p.api + "/repos/" + path, nil
+}
+
+func (p *giteaProvider) header() http.Header {
+	h := http.Header{}
+	h.Set("Authorization", "token "+p.token)
+	return h
+}
+
+// Helper functions
+
+// forge returns the configured forge serving host. A host without a port,
+// as in ssh remotes, matches a forge on any port.
+func (c *Client) forge(host string) (Forge, bool) {
+	for _, f := range c.config.Forges {
+		if u, err := url.Parse(f.URL); err == nil && (strings.EqualFold(u.Host, host) || strings.EqualFold(u.Hostname(), host)) {
+			return f, true
+		}
+	}
+	return Forge{}, false
+}
+
+// authEnv passes each forge's token as an HTTP header to that forge only,
+// in GIT_CONFIG_* variables after those already set. Unlike -c options
+// they aren't on the command line, where other users can read them, and
+// like them they never land in the remote URL or .git/config.
+func (c *Client) authEnv() []string {
+	var headers [][2]string
+	if c.config.Token != "" {
+		headers = append(headers, [2]string{"http.https://github.com/.extraHeader", "Authorization: Basic " + basicAuth("x-access-token", c.config.Token)})
+	}
+	for _, f := range c.config.Forges {
+		if f.Token == "" {
+			continue
+		}
+		auth := "Basic " + basicAuth("oauth2", f.Token)
+		switch f.Kind {
+		case ForgeGitHub:
+			auth = "Basic " + basicAuth("x-access-token", f.Token)
+		case ForgeGitea:
+			auth = "token " + f.Token
+		}
+		headers = append(headers, [2]string{"http." + f.URL + "/.extraHeader", "Authorization: " + auth})
+	}
+	if len(headers) == 0 {
+		return nil
+	}
+	n, _ := strconv.Atoi(os.Getenv("GIT_CONFIG_COUNT"))
+	env := make([]string, 0, 2*len(headers)+1)
+	for i, h := range headers {
+		env = append(env, fmt.Sprintf("GIT_CONFIG_KEY_%d=%s", n+i, h[0]), fmt.Sprintf("GIT_CONFIG_VALUE_%d=%s", n+i, h[1]))
+	}
+	return append(env, fmt.Sprintf("GIT_CONFIG_COUNT=%d", n+len(headers)))
+}
+
+func basicAuth(user, token string) string {
+	return base64.StdEncoding.EncodeToString([]byte(user + ":" + token))
+}
+
+// splitRemote returns the host and the owner/name path of a clone URL in
+// HTTPS, ssh:// or scp-like form.
+func splitRemote(remote string) (host, path string, err error) {
+	if u, perr := url.Parse(remote); perr == nil && u.Host != "" {
+		host, path = u.Host, u.Path
+		// Clones over ssh:// use the forge's ssh port, not its web one.
+		if u.Scheme == "ssh" {
+			host = u.Hostname()
+		}
+	} else if at, rest, ok := strings.Cut(remote, "@"); ok && at != "" {
+		host, path, _ = strings.Cut(rest, ":")
+	}
+	path = strings.TrimSuffix(strings.Trim(path, "/"), ".git")
+	if host == "" || !strings.Contains(path, "/") {
+		return "", "", fmt.Errorf("%w: %s", ErrUnsupportedHost, remote)
+	}
+	return host, path, nil
+}
+
+// callJSON sends in as JSON and decodes the JSON response into out.
+func (c *Client) callJSON(ctx context.Context, method, endpoint string, header http.Header, in, out interface{}) error {
+	var body io.Reader
+	if in != nil {
+		data, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(data)
+		header.Set("Content-Type", "application/json")
+	}
+	data, err := c.request(ctx, method, endpoint, header, body)
+	if err != nil {
+		return err
+	}
+	if out == nil {
+		return nil
+	}
+	return json.Unmarshal(data, out)
+}
+
+// request sends an API request and returns the response body, or an error
+// with the forge's message when the status isn't a success.
+func (c *Client) request(ctx context.Context, method, endpoint string, header http.Header, body io.Reader) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, method, endpoint, body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header = header
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		var msg struct {
+			Message interface{} `json:"message"`
+		}
+		json.Unmarshal(data, &msg)
+		return nil, fmt.Errorf("status %d: %v", resp.StatusCode, msg.Message)
+	}
+	return data, nil
+}
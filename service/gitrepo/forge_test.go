@@ -0,0 +1,65 @@
+package gitrepo
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestCommandKeepsTokensOffArgv(t *testing.T) {
+	t.Setenv("GIT_CONFIG_COUNT", "1")
+	c := NewClient(Config{
+		Token: "gh-secret",
+		Forges: []Forge{
+			{Kind: ForgeGitLab, URL: "https://gitlab.example.com", Token: "gl-secret"},
+			{Kind: ForgeGitea, URL: "https://gitea.example.com", Token: "gt-secret"},
+			{Kind: ForgeGitLab, URL: "https://anon.example.com"},
+		},
+	})
+	secrets := []string{"gh-secret", "gl-secret", "gt-secret", basicAuth("x-access-token", "gh-secret"), basicAuth("oauth2", "gl-secret")}
+	tests := []struct {
+		args []string
+		auth bool
+	}{
+		{[]string{"fetch", "-q", "--depth", "1", "--", "origin", "main"}, true},
+		{[]string{"push", "-q", "origin", "aidev/fix:aidev/fix"}, true},
+		{[]string{"ls-remote", "origin"}, true},
+		{[]string{"status", "--porcelain"}, false},
+		{[]string{"remote", "add", "--", "origin", "https://gitlab.example.com/a/b.git"}, false},
+		{[]string{"-c", "user.name=aidev", "commit", "-q", "-m", "fetch"}, false},
+	}
+	for _, tt := range tests {
+		cmd := c.command(context.Background(), t.TempDir(), tt.args...)
+		argv := strings.Join(cmd.Args, " ")
+		for _, s := range secrets {
+			if strings.Contains(argv, s) {
+				t.Errorf("git %s: token %q in argv %q", tt.args[0], s, argv)
+			}
+		}
+		env := make(map[string]string)
+		for _, kv := range cmd.Env {
+			k, v, _ := strings.Cut(kv, "=")
+			env[k] = v
+		}
+		if !tt.auth {
+			if env["GIT_CONFIG_COUNT"] != "1" || env["GIT_CONFIG_KEY_1"] != "" {
+				t.Errorf("git %s: given the tokens: %v", tt.args[0], cmd.Env)
+			}
+			continue
+		}
+		want := map[string]string{
+			"GIT_CONFIG_COUNT":   "4",
+			"GIT_CONFIG_KEY_1":   "http.https://github.com/.extraHeader",
+			"GIT_CONFIG_VALUE_1": "Authorization: Basic " + basicAuth("x-access-token", "gh-secret"),
+			"GIT_CONFIG_KEY_2":   "http.https://gitlab.example.com/.extraHeader",
+			"GIT_CONFIG_VALUE_2": "Authorization: Basic " + basicAuth("oauth2", "gl-secret"),
+			"GIT_CONFIG_KEY_3":   "http.https://gitea.example.com/.extraHeader",
+			"GIT_CONFIG_VALUE_3": "Authorization: token gt-secret",
+		}
+		for k, v := range want {
+			if env[k] != v {
+				t.Errorf("git %s: %s = %q, want %q", tt.args[0], k, env[k], v)
+			}
+		}
+	}
+}
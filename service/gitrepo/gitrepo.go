@@ -0,0 +1,534 @@
+// Package gitrepo checks out remote repositories into local workdirs and
+// publishes the agent's changes back as branches and pull requests.
+package gitrepo
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Errors
+var (
+	ErrGitFailed       = errors.New("git command failed")
+	ErrUnsupportedHost = errors.New("no forge is configured for the repository's host")
+	ErrNoToken         = errors.New("no forge token configured")
+	ErrInvalidRemote   = errors.New("remote must be an https or ssh URL")
+	ErrInvalidRef      = errors.New("invalid ref")
+)
+
+// DefaultAPIURL is the GitHub REST endpoint.
+const DefaultAPIURL = "https://api.github.com"
+
+// Config holds repository client configuration.
+type Config struct {
+	// Token authenticates pushes and pull requests on github.com over
+	// HTTPS.
+	Token  string
+	APIURL string
+	// Forges are the other hosts pull requests can be opened on.
+	Forges  []Forge
+	Timeout time.Duration
+}
+
+// DefaultConfig returns a default configuration with the token taken from
+// GITHUB_TOKEN, gitlab.com, and the forges listed in AIDEV_FORGES.
+func DefaultConfig() Config {
+	return Config{Token: os.Getenv("GITHUB_TOKEN"), APIURL: DefaultAPIURL, Forges: defaultForges(), Timeout: 30 * time.Second}
+}
+
+// Client runs git against local checkouts.
+type Client struct {
+	config Config
+	http   *http.Client
+}
+
+// NewClient creates a new client.
+func NewClient(config Config) *Client {
+	if config.APIURL == "" {
+		config.APIURL = DefaultAPIURL
+	}
+	if config.Timeout == 0 {
+		config.Timeout = 30 * time.Second
+	}
+	return &Client{config: config, http: &http.Client{Timeout: config.Timeout}}
+}
+
+// Checkout fetches a single commit or branch of remote into dir, without
+// history, and checks it out. An empty ref is the remote's default branch.
+func (c *Client) Checkout(ctx context.Context, remote, ref, dir string) error {
+	if err := validate(remote, ref); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	if ref == "" {
+		ref = "HEAD"
+	}
+	steps := [][]string{
+		{"init", "-q"},
+		{"remote", "add", "--", "origin", remote},
+		{"fetch", "-q", "--depth", "1", "--", "origin", ref},
+		{"checkout", "-q", "FETCH_HEAD"},
+	}
+	for _, args := range steps {
+		if _, err := c.git(ctx, dir, args...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Sync brings the cached checkout in dir to ref of remote, discarding local
+// changes except to the paths in keep. A missing cache is checked out anew.
+func (c *Client) Sync(ctx context.Context, remote, ref, dir string, keep ...string) error {
+	if err := validate(remote, ref); err != nil {
+		return err
+	}
+	if _, err := os.Stat(filepath.Join(dir, ".git")); err != nil {
+		return c.Checkout(ctx, remote, ref, dir)
+	}
+	if ref == "" {
+		ref = "HEAD"
+	}
+	clean := []string{"clean", "-fdq"}
+	for _, k := range keep {
+		clean = append(clean, "-e", k)
+	}
+	steps := [][]string{
+		{"remote", "set-url", "--", "origin", remote},
+		{"fetch", "-q", "--depth", "1", "--", "origin", ref},
+		{"checkout", "-q", "-f", "FETCH_HEAD"},
+		clean,
+	}
+	for _, args := range steps {
+		if _, err := c.git(ctx, dir, args...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// validate rejects a remote or ref that git could take for an option or
+// that reaches beyond a network repository, such as a local path or an
+// ext:: transport. Both can come from outside, in a webhook delivery.
+func validate(remote, ref string) error {
+	if err := ValidateRemote(remote); err != nil {
+		return err
+	}
+	if ref == "" {
+		return nil
+	}
+	return ValidateRef(ref)
+}
+
+// ValidateRemote reports whether remote is an https or ssh URL, including
+// the scp-like user@host:path form.
+func ValidateRemote(remote string) error {
+	if remote == "" || strings.HasPrefix(remote, "-") || strings.ContainsAny(remote, " \t\r\n") {
+		return fmt.Errorf("%w: %q", ErrInvalidRemote, remote)
+	}
+	if u, err := url.Parse(remote); err == nil && u.Scheme != "" {
+		if (u.Scheme == "https" || u.Scheme == "ssh") && u.Host != "" && !strings.HasPrefix(u.Host, "-") {
+			return nil
+		}
+		return fmt.Errorf("%w: %q", ErrInvalidRemote, remote)
+	}
+	// user@host:path, which git reads as ssh.
+	at, colon := strings.Index(remote, "@"), strings.Index(remote, ":")
+	if at > 0 && colon > at+1 && colon < len(remote)-1 && !strings.Contains(remote[:colon], "/") && remote[at+1] != '-' {
+		return nil
+	}
+	return fmt.Errorf("%w: %q", ErrInvalidRemote, remote)
+}
+
+// ValidateRef reports whether ref is a commit SHA or a ref name git
+// accepts, and not an option.
+func ValidateRef(ref string) error {
+	if isHexSHA(ref) {
+		return nil
+	}
+	bad := ref == "" || ref == "@" || strings.HasPrefix(ref, "-") || strings.HasPrefix(ref, "/") ||
+		strings.HasSuffix(ref, "/") || strings.HasSuffix(ref, ".") || strings.HasSuffix(ref, ".lock") ||
+		strings.Contains(ref, "..") || strings.Contains(ref, "//") || strings.Contains(ref, "@{") ||
+		strings.Contains(ref, "/.") || strings.HasPrefix(ref, ".")
+	for _, r := range ref {
+		if r < 0x20 || r == 0x7f || strings.ContainsRune(" ~^:?*[\\", r) {
+			bad = true
+		}
+	}
+	if bad {
+		return fmt.Errorf("%w: %q", ErrInvalidRef, ref)
+	}
+	return nil
+}
+
+func isHexSHA(s string) bool {
+	if len(s) < 7 || len(s) > 40 {
+		return false
+	}
+	for _, r := range s {
+		if !strings.ContainsRune("0123456789abcdef", r) {
+			return false
+		}
+	}
+	return true
+}
+
+// Commit commits files. A non-empty branch is first created at HEAD and
+// checked out; otherwise the commit goes to the current branch.
+func (c *Client) Commit(ctx context.Context, dir, branch, message string, files []string) error {
+	if branch != "" {
+		if _, err := c.git(ctx, dir, "checkout", "-q", "-b", branch); err != nil {
+			return err
+		}
+	}
+	if _, err := c.git(ctx, dir, append([]string{"add", "--"}, files...)...); err != nil {
+		return err
+	}
+	_, err := c.git(ctx, dir, "-c", "user.name=aidev", "-c", "user.email=aidev@localhost", "commit", "-q", "-m", message)
+	return err
+}
+
+// Root returns the top-level directory of the work tree containing dir.
+func (c *Client) Root(ctx context.Context, dir string) (string, error) {
+	out, err := c.git(ctx, dir, "rev-parse", "--show-toplevel")
+	return strings.TrimSpace(out), err
+}
+
+// GitDir returns the repository's common git directory, shared by all of
+// its worktrees.
+func (c *Client) GitDir(ctx context.Context, dir string) (string, error) {
+	out, err := c.git(ctx, dir, "rev-parse", "--path-format=absolute", "--git-common-dir")
+	return strings.TrimSpace(out), err
+}
+
+// AddWorktree checks out a new branch at HEAD of the repository in dir
+// into a separate worktree at path.
+func (c *Client) AddWorktree(ctx context.Context, dir, path, branch string) error {
+	_, err := c.git(ctx, dir, "worktree", "add", "-q", "-b", branch, path, "HEAD")
+	return err
+}
+
+// RemoveWorktree removes the worktree at path, discarding its changes.
+func (c *Client) RemoveWorktree(ctx context.Context, dir, path string) error {
+	_, err := c.git(ctx, dir, "worktree", "remove", "--force", path)
+	return err
+}
+
+// DeleteBranch deletes a local branch.
+func (c *Client) DeleteBranch(ctx context.Context, dir, branch string) error {
+	_, err := c.git(ctx, dir, "branch", "-q", "-D", branch)
+	return err
+}
+
+// Modified returns the files, as paths relative to the repository top
+// level, that have uncommitted changes among paths.
+func (c *Client) Modified(ctx context.Context, dir string, paths []string) ([]string, error) {
+	out, err := c.git(ctx, dir, append([]string{"status", "--porcelain", "--untracked-files=no", "--"}, paths...)...)
+	if err != nil {
+		return nil, err
+	}
+	var files []string
+	for _, line := range strings.Split(out, "\n") {
+		if len(line) > 3 {
+			files = append(files, line[3:])
+		}
+	}
+	return files, nil
+}
+
+// Ignored returns which of paths, relative to dir, the ignore rules of
+// the repository and the user exclude. Paths need not exist.
+func (c *Client) Ignored(ctx context.Context, dir string, paths []string) (map[string]bool, error) {
+	cmd := exec.CommandContext(ctx, "git", append([]string{"check-ignore", "--verbose", "--non-matching", "--"}, paths...)...)
+	cmd.Dir = dir
+	var out, stderr bytes.Buffer
+	cmd.Stdout = &out
+	cmd.Stderr = &stderr
+	err := cmd.Run()
+	var exitErr *exec.ExitError
+	if err != nil && !(errors.As(err, &exitErr) && exitErr.ExitCode() == 1) {
+		return nil, fmt.Errorf("%w: git check-ignore: %s", ErrGitFailed, strings.TrimSpace(stderr.String()))
+	}
+
+	// Each line is "source:line:pattern<TAB>path"; the source is empty for
+	// paths no pattern matches, and a "!" pattern re-includes the path.
+	ignored := make(map[string]bool, len(paths))
+	for _, line := range strings.Split(out.String(), "\n") {
+		match, path, ok := strings.Cut(line, "\t")
+		if !ok {
+			continue
+		}
+		parts := strings.SplitN(match, ":", 3)
+		ignored[path] = len(parts) == 3 && parts[0] != "" && !strings.HasPrefix(parts[2], "!")
+	}
+	return ignored, nil
+}
+
+// ExcludesFile returns the user's global ignore file: core.excludesFile,
+// or git's default under the XDG config directory.
+func (c *Client) ExcludesFile(ctx context.Context, dir string) (string, error) {
+	out, err := c.git(ctx, dir, "config", "--path", "--default", "", "core.excludesFile")
+	if err != nil {
+		return "", err
+	}
+	if path := strings.TrimSpace(out); path != "" {
+		return path, nil
+	}
+	config := os.Getenv("XDG_CONFIG_HOME")
+	if config == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", err
+		}
+		config = filepath.Join(home, ".config")
+	}
+	return filepath.Join(config, "git", "ignore"), nil
+}
+
+// Stash stashes the uncommitted changes to paths under message.
+func (c *Client) Stash(ctx context.Context, dir, message string, paths []string) error {
+	_, err := c.git(ctx, dir, append([]string{"stash", "push", "-q", "-m", message, "--"}, paths...)...)
+	return err
+}
+
+// Unstash merges the stash entry saved under message into the current
+// files, so edits made since the stash are kept alongside it. It returns the
+// files left with conflict markers; the entry is dropped only when there
+// are none.
+func (c *Client) Unstash(ctx context.Context, dir, message string) ([]string, error) {
+	ref, err := c.findStash(ctx, dir, message)
+	if err != nil {
+		return nil, err
+	}
+	root, err := c.Root(ctx, dir)
+	if err != nil {
+		return nil, err
+	}
+	out, err := c.git(ctx, root, "stash", "show", "--name-only", ref)
+	if err != nil {
+		return nil, err
+	}
+
+	var conflicts []string
+	for _, file := range strings.Fields(out) {
+		base, err := c.git(ctx, root, "show", ref+"^1:"+file)
+		if err != nil {
+			return conflicts, err
+		}
+		stashed, err := c.git(ctx, root, "show", ref+":"+file)
+		if err != nil {
+			return conflicts, err
+		}
+		conflict, err := mergeFile(ctx, filepath.Join(root, file), base, stashed)
+		if err != nil {
+			return conflicts, err
+		}
+		if conflict {
+			conflicts = append(conflicts, file)
+		}
+	}
+	if len(conflicts) == 0 {
+		_, err = c.git(ctx, root, "stash", "drop", "-q", ref)
+	}
+	return conflicts, err
+}
+
+func (c *Client) findStash(ctx context.Context, dir, message string) (string, error) {
+	out, err := c.git(ctx, dir, "stash", "list", "--format=%gd %s")
+	if err != nil {
+		return "", err
+	}
+	for _, line := range strings.Split(out, "\n") {
+		ref, subject, _ := strings.Cut(line, " ")
+		// Subjects read "On <branch>: <message>".
+		if strings.HasSuffix(subject, ": "+message) {
+			return ref, nil
+		}
+	}
+	return "", fmt.Errorf("%w: no stash named %q", ErrGitFailed, message)
+}
+
+// Diff returns the unified diff of the working tree against base, limited
+// to paths when given, with context lines around each hunk.
+func (c *Client) Diff(ctx context.Context, dir, base string, context int, paths []string) (string, error) {
+	args := []string{"diff", "--no-color", "--no-ext-diff", "--relative", fmt.Sprintf("-U%d", context), base, "--"}
+	return c.git(ctx, dir, append(args, paths...)...)
+}
+
+// BlameLine is the last commit to touch one line of a file.
+type BlameLine struct {
+	Commit string // all zeros for uncommitted lines
+	Author string
+	Time   time.Time
+}
+
+// Blame returns the last commit to touch each line of file.
+func (c *Client) Blame(ctx context.Context, dir, file string) ([]BlameLine, error) {
+	out, err := c.git(ctx, dir, "blame", "--line-porcelain", "--", file)
+	if err != nil {
+		return nil, err
+	}
+	var lines []BlameLine
+	var cur BlameLine
+	for _, line := range strings.Split(out, "\n") {
+		switch {
+		case strings.HasPrefix(line, "\t"):
+			lines = append(lines, cur)
+			cur = BlameLine{}
+		case strings.HasPrefix(line, "author "):
+			cur.Author = strings.TrimPrefix(line, "author ")
+		case strings.HasPrefix(line, "author-time "):
+			var sec int64
+			fmt.Sscanf(strings.TrimPrefix(line, "author-time "), "%d", &sec)
+			cur.Time = time.Unix(sec, 0)
+		case cur.Commit == "" && len(line) >= 40 && !strings.Contains(line[:40], " "):
+			cur.Commit = line[:40]
+		}
+	}
+	return lines, nil
+}
+
+// Push pushes branch to origin.
+func (c *Client) Push(ctx context.Context, dir, branch string) error {
+	_, err := c.git(ctx, dir, "push", "-q", "origin", branch+":"+branch)
+	return err
+}
+
+// PullRequest describes a pull request to open.
+type PullRequest struct {
+	Remote string // clone URL of the repository
+	Head   string // branch with the changes
+	Base   string // branch to merge into
+	Title  string
+	Body   string
+}
+
+// OpenPullRequest opens a pull request on the forge hosting pr.Remote and
+// returns its URL.
+func (c *Client) OpenPullRequest(ctx context.Context, pr PullRequest) (string, error) {
+	provider, err := c.Provider(pr.Remote)
+	if err != nil {
+		return "", err
+	}
+	return provider.OpenPullRequest(ctx, pr)
+}
+
+// ParseSpec splits "url@ref" into the clone URL and ref. The ref is empty
+// when spec names none; the user part of SSH URLs is not mistaken for one.
+func ParseSpec(spec string) (remote, ref string) {
+	i := strings.LastIndex(spec, "@")
+	if i <= 0 || i < strings.LastIndex(spec, "/") {
+		return spec, ""
+	}
+	return spec[:i], spec[i+1:]
+}
+
+// CacheDir returns the checkout directory of remote under root.
+func CacheDir(root, remote string) string {
+	path := remote
+	if u, err := url.Parse(remote); err == nil && u.Host != "" {
+		path = u.Host + u.Path
+	} else if i := strings.Index(remote, "@"); i >= 0 {
+		path = strings.Replace(remote[i+1:], ":", "/", 1)
+	}
+	path = strings.TrimSuffix(strings.Trim(path, "/"), ".git")
+	var parts []string
+	for _, p := range strings.Split(path, "/") {
+		if p != "" && p != "." && p != ".." {
+			parts = append(parts, p)
+		}
+	}
+	return filepath.Join(append([]string{root}, parts...)...)
+}
+
+// Helper functions
+
+// remoteCommands are the git commands that talk to a remote, the only
+// ones given the forges' tokens.
+var remoteCommands = map[string]bool{"fetch": true, "push": true, "ls-remote": true}
+
+// git runs a git command in dir.
+func (c *Client) git(ctx context.Context, dir string, args ...string) (string, error) {
+	cmd := c.command(ctx, dir, args...)
+	var out bytes.Buffer
+	cmd.Stdout = &out
+	cmd.Stderr = &out
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("%w: git %s: %s", ErrGitFailed, strings.Join(args, " "), strings.TrimSpace(out.String()))
+	}
+	return out.String(), nil
+}
+
+// command returns the git command for args in dir, with the forges'
+// tokens in its environment when it talks to a remote.
+func (c *Client) command(ctx context.Context, dir string, args ...string) *exec.Cmd {
+	cmd := exec.CommandContext(ctx, "git", args...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), "GIT_TERMINAL_PROMPT=0")
+	if len(args) > 0 && remoteCommands[args[0]] {
+		cmd.Env = append(cmd.Env, c.authEnv()...)
+	}
+	return cmd
+}
+
+// mergeFile three-way merges other into current, relative to base,
+// reporting whether conflict markers were left. A missing current file is
+// treated as unchanged from base.
+func mergeFile(ctx context.Context, current, base, other string) (bool, error) {
+	data, err := os.ReadFile(current)
+	if os.IsNotExist(err) {
+		return false, os.WriteFile(current, []byte(other), 0644)
+	}
+	if err != nil {
+		return false, err
+	}
+	merged, conflict, err := Merge(ctx, string(data), base, other, [3]string{"current", "base", "stashed"})
+	if err != nil {
+		return false, err
+	}
+	return conflict, os.WriteFile(current, []byte(merged), 0644)
+}
+
+// Merge three-way merges other into current, relative to base, with git
+// merge-file. Conflicting hunks are left between markers labelled with
+// names, of current, base and other. It reports whether there are any.
+func Merge(ctx context.Context, current, base, other string, names [3]string) (string, bool, error) {
+	tmp, err := os.MkdirTemp("", "aidev-merge-")
+	if err != nil {
+		return "", false, err
+	}
+	defer os.RemoveAll(tmp)
+	paths := make([]string, 3)
+	for i, content := range []string{current, base, other} {
+		paths[i] = filepath.Join(tmp, strconv.Itoa(i))
+		if err := os.WriteFile(paths[i], []byte(content), 0644); err != nil {
+			return "", false, err
+		}
+	}
+
+	cmd := exec.CommandContext(ctx, "git", "merge-file", "-p", "-L", names[0], "-L", names[1], "-L", names[2], paths[0], paths[1], paths[2])
+	var out, stderr bytes.Buffer
+	cmd.Stdout = &out
+	cmd.Stderr = &stderr
+	err = cmd.Run()
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && exitErr.ExitCode() > 0 && exitErr.ExitCode() < 128 {
+		return out.String(), true, nil // exit code is the number of conflicts
+	}
+	if err != nil {
+		return "", false, fmt.Errorf("%w: git merge-file: %s", ErrGitFailed, strings.TrimSpace(stderr.String()))
+	}
+	return out.String(), false, nil
+}
@@ -0,0 +1,314 @@
+// Package index maintains a content-hashed index of workspace files.
+package index
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"go/parser"
+	"go/token"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"ai-dev-agent/service/filesystem"
+)
+
+// Entry represents an indexed file.
+type Entry struct {
+	Path    string    `json:"path"`
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"mod_time"`
+	Hash    string    `json:"hash"`
+	Package string    `json:"package,omitempty"`
+	Imports []string  `json:"imports,omitempty"`
+}
+
+// Stats summarizes an index build or update.
+type Stats struct {
+	Files     int
+	Added     int
+	Updated   int
+	Unchanged int
+	Removed   int
+	Duration  time.Duration
+}
+
+// Progress reports a build under way. In the "scan" phase the workspace
+// is being listed and only Elapsed is known; in the "index" phase Files
+// and Bytes count the new and modified files read so far, out of Total
+// and TotalBytes.
+type Progress struct {
+	Phase      string
+	Files      int
+	Total      int
+	Bytes      int64
+	TotalBytes int64
+	Elapsed    time.Duration
+	ETA        time.Duration // zero until enough has been read to estimate
+}
+
+// BuildOptions configures Build.
+type BuildOptions struct {
+	// OnProgress, when set, is called as each phase starts, at most every
+	// ProgressInterval (default 200ms) while files are read, and when
+	// reading ends.
+	OnProgress       func(Progress)
+	ProgressInterval time.Duration
+}
+
+// Index is a path-keyed set of file entries.
+type Index struct {
+	mu      sync.RWMutex
+	fs      *filesystem.Manager
+	entries map[string]*Entry
+}
+
+// New creates an empty index over the manager's root.
+func New(fs *filesystem.Manager) *Index {
+	return &Index{fs: fs, entries: make(map[string]*Entry)}
+}
+
+// Build scans the workspace and reconciles it with the current entries.
+// Files whose size and modification time are unchanged are not re-read.
+// A cancelled build keeps the entries updated so far.
+func (ix *Index) Build(ctx context.Context, opts BuildOptions) (Stats, error) {
+	start := time.Now()
+	var stats Stats
+	report := func(p Progress) {
+		if opts.OnProgress != nil {
+			p.Elapsed = time.Since(start)
+			opts.OnProgress(p)
+		}
+	}
+
+	report(Progress{Phase: "scan"})
+	files, err := ix.fs.ListFiles(ctx, ".", true, nil)
+	if err != nil {
+		return stats, err
+	}
+
+	// Only new and modified files are read, so they alone make up the
+	// progress total.
+	type pending struct {
+		path string
+		size int64
+		old  *Entry
+	}
+	var work []pending
+	var progress Progress
+	seen := make(map[string]bool, len(files))
+	ix.mu.RLock()
+	for _, f := range files {
+		path := filepath.ToSlash(f.Path)
+		seen[path] = true
+		existing := ix.entries[path]
+		if existing != nil && existing.Size == f.Size && existing.ModTime.Equal(f.ModTime) {
+			stats.Unchanged++
+			continue
+		}
+		work = append(work, pending{path, f.Size, existing})
+		progress.TotalBytes += f.Size
+	}
+	ix.mu.RUnlock()
+
+	interval := opts.ProgressInterval
+	if interval <= 0 {
+		interval = 200 * time.Millisecond
+	}
+	progress.Phase, progress.Total = "index", len(work)
+	report(progress)
+	readStart, lastReport := time.Now(), time.Now()
+	for _, w := range work {
+		if err := ctx.Err(); err != nil {
+			stats.Duration = time.Since(start)
+			return stats, err
+		}
+
+		changed, err := ix.Update(w.path)
+		progress.Files++
+		progress.Bytes += w.size
+		if time.Since(lastReport) >= interval {
+			if progress.Bytes > 0 {
+				perByte := float64(time.Since(readStart)) / float64(progress.Bytes)
+				progress.ETA = time.Duration(perByte * float64(progress.TotalBytes-progress.Bytes))
+			}
+			report(progress)
+			lastReport = time.Now()
+		}
+		if err != nil {
+			continue
+		}
+		switch {
+		case w.old == nil:
+			stats.Added++
+		case changed:
+			stats.Updated++
+		default:
+			stats.Unchanged++
+		}
+	}
+	if len(work) > 0 {
+		progress.ETA = 0
+		report(progress)
+	}
+
+	ix.mu.Lock()
+	for path := range ix.entries {
+		if !seen[path] {
+			delete(ix.entries, path)
+			stats.Removed++
+		}
+	}
+	stats.Files = len(ix.entries)
+	ix.mu.Unlock()
+
+	stats.Duration = time.Since(start)
+	return stats, nil
+}
+
+// Update re-indexes a single file. It reports whether the content hash
+// changed; metadata is refreshed either way but the file is only re-parsed
+// when its content differs from the indexed version.
+func (ix *Index) Update(path string) (bool, error) {
+	path = filepath.ToSlash(path)
+	content, err := ix.fs.ReadFile(path)
+	if err != nil {
+		if err == filesystem.ErrFileNotFound {
+			ix.Remove(path)
+		}
+		return false, err
+	}
+
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+
+	entry := ix.entries[path]
+	if entry != nil && entry.Hash == content.Info.Checksum {
+		entry.Size = content.Info.Size
+		entry.ModTime = content.Info.ModTime
+		return false, nil
+	}
+
+	entry = &Entry{
+		Path:    path,
+		Size:    content.Info.Size,
+		ModTime: content.Info.ModTime,
+		Hash:    content.Info.Checksum,
+	}
+	if content.Info.Extension == ".go" {
+		entry.Package, entry.Imports = parseGoImports(path, content.Content)
+	}
+	ix.entries[path] = entry
+	return true, nil
+}
+
+// Remove drops a path, and anything below it, from the index.
+func (ix *Index) Remove(path string) {
+	path = filepath.ToSlash(path)
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+	delete(ix.entries, path)
+	prefix := path + "/"
+	for p := range ix.entries {
+		if len(p) > len(prefix) && p[:len(prefix)] == prefix {
+			delete(ix.entries, p)
+		}
+	}
+}
+
+// below returns the indexed paths that are path or under it, sorted.
+func (ix *Index) below(path string) []string {
+	path = filepath.ToSlash(path)
+	ix.mu.RLock()
+	defer ix.mu.RUnlock()
+	var paths []string
+	prefix := path + "/"
+	for p := range ix.entries {
+		if p == path || len(p) > len(prefix) && p[:len(prefix)] == prefix {
+			paths = append(paths, p)
+		}
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// Get returns the entry for a path.
+func (ix *Index) Get(path string) (Entry, bool) {
+	ix.mu.RLock()
+	defer ix.mu.RUnlock()
+	entry, ok := ix.entries[filepath.ToSlash(path)]
+	if !ok {
+		return Entry{}, false
+	}
+	return *entry, true
+}
+
+// Entries returns all entries sorted by path.
+func (ix *Index) Entries() []Entry {
+	ix.mu.RLock()
+	defer ix.mu.RUnlock()
+	result := make([]Entry, 0, len(ix.entries))
+	for _, e := range ix.entries {
+		result = append(result, *e)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Path < result[j].Path })
+	return result
+}
+
+// Len returns the number of indexed files.
+func (ix *Index) Len() int {
+	ix.mu.RLock()
+	defer ix.mu.RUnlock()
+	return len(ix.entries)
+}
+
+// Load reads an index saved as JSON. A missing file is not an error.
+func (ix *Index) Load(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	var entries []Entry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return fmt.Errorf("parse index: %w", err)
+	}
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+	for i := range entries {
+		ix.entries[entries[i].Path] = &entries[i]
+	}
+	return nil
+}
+
+// Restore replaces the index with previously persisted entries.
+func (ix *Index) Restore(entries []Entry) {
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+	ix.entries = make(map[string]*Entry, len(entries))
+	for i := range entries {
+		ix.entries[entries[i].Path] = &entries[i]
+	}
+}
+
+// Helper functions
+
+func parseGoImports(path, content string) (string, []string) {
+	f, err := parser.ParseFile(token.NewFileSet(), path, content, parser.ImportsOnly)
+	if err != nil || f == nil {
+		return "", nil
+	}
+	var imports []string
+	for _, imp := range f.Imports {
+		if p, err := strconv.Unquote(imp.Path.Value); err == nil {
+			imports = append(imports, p)
+		}
+	}
+	return f.Name.Name, imports
+}
@@ -0,0 +1,147 @@
+package index
+
+import (
+	"context"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// Change describes an incremental index update.
+type Change struct {
+	Path    string
+	Removed bool
+	Changed bool
+}
+
+// WatchOptions configures Watch.
+type WatchOptions struct {
+	// Debounce coalesces bursts of events for the same path.
+	Debounce time.Duration
+	// OnChange is called after each path has been re-indexed.
+	OnChange func(Change)
+	// OnError receives watcher errors; nil ignores them.
+	OnError func(error)
+}
+
+// Watch keeps the index current by re-indexing only the paths reported by
+// filesystem events. It blocks until ctx is cancelled.
+func (ix *Index) Watch(ctx context.Context, opts WatchOptions) error {
+	if opts.Debounce == 0 {
+		opts.Debounce = 200 * time.Millisecond
+	}
+
+	w, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	defer w.Close()
+
+	root := ix.fs.GetRoot()
+	if err := ix.addDirs(w, root); err != nil {
+		return err
+	}
+
+	pending := make(map[string]bool)
+	timer := time.NewTimer(opts.Debounce)
+	timer.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+
+		case event, ok := <-w.Events:
+			if !ok {
+				return nil
+			}
+			rel, err := filepath.Rel(root, event.Name)
+			if err != nil {
+				continue
+			}
+			info, statErr := os.Stat(event.Name)
+			isDir := statErr == nil && info.IsDir()
+			if ix.fs.IsIgnored(rel, isDir) {
+				continue
+			}
+			// A directory created or moved in may already hold files
+			// written before it was watched; applyEvent scans it.
+			if isDir && event.Has(fsnotify.Create) {
+				ix.addDirs(w, event.Name)
+			}
+			if event.Has(fsnotify.Chmod) && !event.Has(fsnotify.Write) {
+				continue
+			}
+			pending[filepath.ToSlash(rel)] = true
+			timer.Reset(opts.Debounce)
+
+		case <-timer.C:
+			for path := range pending {
+				ix.applyEvent(ctx, path, opts.OnChange)
+			}
+			pending = make(map[string]bool)
+
+		case err, ok := <-w.Errors:
+			if !ok {
+				return nil
+			}
+			if opts.OnError != nil {
+				opts.OnError(err)
+			}
+		}
+	}
+}
+
+// applyEvent re-indexes path: a file is updated, a directory scanned for
+// the files in it, and a path that is gone, a file or a directory deleted
+// or moved away, is removed with everything indexed below it.
+func (ix *Index) applyEvent(ctx context.Context, path string, onChange func(Change)) {
+	abs := filepath.Join(ix.fs.GetRoot(), filepath.FromSlash(path))
+	info, err := os.Stat(abs)
+	if err != nil {
+		removed := ix.below(path)
+		ix.Remove(path)
+		if onChange != nil {
+			for _, p := range removed {
+				onChange(Change{Path: p, Removed: true})
+			}
+		}
+		return
+	}
+	if !info.IsDir() {
+		ix.updateFile(path, onChange)
+		return
+	}
+	files, err := ix.fs.ListFiles(ctx, path, true, nil)
+	if err != nil {
+		return
+	}
+	for _, f := range files {
+		ix.updateFile(filepath.ToSlash(f.Path), onChange)
+	}
+}
+
+func (ix *Index) updateFile(path string, onChange func(Change)) {
+	changed, err := ix.Update(path)
+	if err != nil || onChange == nil {
+		return
+	}
+	onChange(Change{Path: path, Changed: changed})
+}
+
+func (ix *Index) addDirs(w *fsnotify.Watcher, dir string) error {
+	root := ix.fs.GetRoot()
+	return filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || !d.IsDir() {
+			return nil
+		}
+		rel, _ := filepath.Rel(root, path)
+		if rel != "." && ix.fs.IsIgnored(rel, true) {
+			return fs.SkipDir
+		}
+		return w.Add(path)
+	})
+}
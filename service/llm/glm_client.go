@@ -20,6 +20,7 @@ var (
         ErrRequestFailed   = errors.New("request failed")
         ErrResponseParse   = errors.New("failed to parse response")
         ErrMaxRetriesExceeded = errors.New("max retries exceeded")
+        ErrStreamStalled   = errors.New("stream stalled")
 )
 
 // APIError represents an API error.
@@ -33,16 +34,52 @@ func (e *APIError) Error() string {
         return fmt.Sprintf("API error: code=%v, message=%s", e.Code, e.Message)
 }
 
-// Message represents a chat message.
+// Message represents a chat message. Images are data or https URLs
+// attached to the message for vision models.
 type Message struct {
-        Role    string `json:"role"`
-        Content string `json:"content"`
+        Role    string   `json:"role"`
+        Content string   `json:"content"`
+        Images  []string `json:"-"`
+}
+
+// contentPart is one part of a multimodal message.
+type contentPart struct {
+        Type     string    `json:"type"`
+        Text     string    `json:"text,omitempty"`
+        ImageURL *imageURL `json:"image_url,omitempty"`
+}
+
+type imageURL struct {
+        URL string `json:"url"`
+}
+
+// MarshalJSON sends a message with images as a list of content parts, the
+// multimodal format shared by GLM-4V and OpenAI-compatible APIs.
+func (m Message) MarshalJSON() ([]byte, error) {
+        if len(m.Images) == 0 {
+                return json.Marshal(struct {
+                        Role    string `json:"role"`
+                        Content string `json:"content"`
+                }{m.Role, m.Content})
+        }
+        parts := make([]contentPart, 0, len(m.Images)+1)
+        for _, url := range m.Images {
+                parts = append(parts, contentPart{Type: "image_url", ImageURL: &imageURL{URL: url}})
+        }
+        parts = append(parts, contentPart{Type: "text", Text: m.Content})
+        return json.Marshal(struct {
+                Role    string        `json:"role"`
+                Content []contentPart `json:"content"`
+        }{m.Role, parts})
 }
 
 // ChatCompletionRequest represents a chat request.
 type ChatCompletionRequest struct {
-        Model    string    `json:"model"`
-        Messages []Message `json:"messages"`
+        Model       string    `json:"model"`
+        Messages    []Message `json:"messages"`
+        Temperature *float64  `json:"temperature,omitempty"`
+        Seed        *int      `json:"seed,omitempty"`
+        DoSample    *bool     `json:"do_sample,omitempty"` // GLM: false for greedy decoding
 }
 
 // ChatCompletionResponse represents a chat response.
@@ -57,7 +94,9 @@ type ChatCompletionResponse struct {
                 FinishReason string `json:"finish_reason"`
         } `json:"choices"`
         Usage struct {
-                TotalTokens int `json:"total_tokens"`
+                PromptTokens     int `json:"prompt_tokens"`
+                CompletionTokens int `json:"completion_tokens"`
+                TotalTokens      int `json:"total_tokens"`
         } `json:"usage"`
         Error *APIError `json:"error,omitempty"`
 }
@@ -69,12 +108,28 @@ type Config struct {
         Model      string
         Timeout    time.Duration
         MaxRetries int
+        // JWT signs requests with short-lived tokens generated from an
+        // "id.secret" key instead of sending the key as a Bearer token.
+        JWT      bool
+        TokenTTL time.Duration
+        // StreamIdleTimeout cancels a stream that delivers no data for
+        // this long (default 30s).
+        StreamIdleTimeout time.Duration
+        // Options are provider-specific fields added to every request body,
+        // e.g. do_sample, reasoning_effort or num_ctx. They never replace
+        // the fields the client sets itself.
+        Options map[string]interface{}
+        // Deterministic pins sampling where the provider supports it:
+        // greedy decoding on GLM, temperature 0 and Seed elsewhere.
+        Deterministic bool
+        Seed          int
 }
 
 // Client is the LLM client.
 type Client struct {
         config     Config
         httpClient *http.Client
+        jwt        *jwtSigner
 }
 
 // NewClient creates a new LLM client.
@@ -94,21 +149,97 @@ func NewClient(config Config) (*Client, error) {
         if config.MaxRetries == 0 {
                 config.MaxRetries = 3
         }
+        if config.StreamIdleTimeout == 0 {
+                config.StreamIdleTimeout = 30 * time.Second
+        }
 
-        return &Client{
+        client := &Client{
                 config:     config,
                 httpClient: &http.Client{Timeout: config.Timeout},
-        }, nil
+        }
+        if config.JWT {
+                signer, err := newJWTSigner(config.APIKey, config.TokenTTL)
+                if err != nil {
+                        return nil, err
+                }
+                client.jwt = signer
+        }
+        return client, nil
+}
+
+// Model returns the configured model name.
+func (c *Client) Model() string {
+        return c.config.Model
+}
+
+// authToken returns the bearer credential: a JWT when enabled, else the key.
+func (c *Client) authToken() string {
+        if c.jwt != nil {
+                return c.jwt.Token()
+        }
+        return c.config.APIKey
+}
+
+// Body returns the JSON body ChatCompletion sends for req, as recorded for
+// Replay.
+func (c *Client) Body(req ChatCompletionRequest) ([]byte, error) {
+        return c.requestBody(c.prepare(req))
+}
+
+// prepare sets the model and, for deterministic clients, the sampling
+// fields of a request.
+func (c *Client) prepare(req ChatCompletionRequest) ChatCompletionRequest {
+        req.Model = c.config.Model
+        if !c.config.Deterministic {
+                return req
+        }
+        if isGLM(req.Model) {
+                doSample := false
+                req.DoSample = &doSample
+                return req
+        }
+        temperature, seed := 0.0, c.config.Seed
+        req.Temperature, req.Seed = &temperature, &seed
+        return req
+}
+
+// requestBody encodes a request with the configured provider options.
+func (c *Client) requestBody(req interface{}) ([]byte, error) {
+        body, err := json.Marshal(req)
+        if err != nil || len(c.config.Options) == 0 {
+                return body, err
+        }
+        fields := make(map[string]json.RawMessage)
+        if err := json.Unmarshal(body, &fields); err != nil {
+                return nil, err
+        }
+        for key, value := range c.config.Options {
+                if _, ok := fields[key]; ok {
+                        continue
+                }
+                raw, err := json.Marshal(value)
+                if err != nil {
+                        return nil, fmt.Errorf("provider option %s: %w", key, err)
+                }
+                fields[key] = raw
+        }
+        return json.Marshal(fields)
 }
 
 // ChatCompletion sends a chat request.
 func (c *Client) ChatCompletion(ctx context.Context, req ChatCompletionRequest) (*ChatCompletionResponse, error) {
-        req.Model = c.config.Model
+        body, err := c.Body(req)
+        if err != nil {
+                return nil, err
+        }
+        return c.Replay(ctx, body)
+}
 
-        body, _ := json.Marshal(req)
+// Replay sends a request body recorded from Body as is.
+func (c *Client) Replay(ctx context.Context, body []byte) (*ChatCompletionResponse, error) {
         httpReq, _ := http.NewRequestWithContext(ctx, "POST", c.config.BaseURL+"/chat/completions", bytes.NewReader(body))
         httpReq.Header.Set("Content-Type", "application/json")
-        httpReq.Header.Set("Authorization", "Bearer "+c.config.APIKey)
+        httpReq.Header.Set("Authorization", "Bearer "+c.authToken())
 
         httpResp, err := c.httpClient.Do(httpReq)
         if err != nil {
@@ -170,6 +301,11 @@ type StreamChunk struct {
                 } `json:"delta"`
                 FinishReason string `json:"finish_reason"`
         } `json:"choices"`
+        Usage *struct {
+                PromptTokens     int `json:"prompt_tokens"`
+                CompletionTokens int `json:"completion_tokens"`
+                TotalTokens      int `json:"total_tokens"`
+        } `json:"usage,omitempty"`
 }
 
 // StreamCallback is callback for streaming.
@@ -177,50 +313,13 @@ type StreamCallback func(chunk string) error
 
 // ChatCompletionStream sends a streaming request.
 func (c *Client) ChatCompletionStream(ctx context.Context, req ChatCompletionRequest, callback StreamCallback) error {
-        req.Model = c.config.Model
-
-        body, _ := json.Marshal(req)
-        httpReq, _ := http.NewRequestWithContext(ctx, "POST", c.config.BaseURL+"/chat/completions", bytes.NewReader(body))
-        httpReq.Header.Set("Content-Type", "application/json")
-        httpReq.Header.Set("Authorization", "Bearer "+c.config.APIKey)
-        httpReq.Header.Set("Accept", "text/event-stream")
-
-        httpResp, err := c.httpClient.Do(httpReq)
-        if err != nil {
-                return fmt.Errorf("%w: %v", ErrRequestFailed, err)
-        }
-        defer httpResp.Body.Close()
+        _, err := c.StreamWithStats(ctx, req, callback)
+        return err
+}
 
-        buf := make([]byte, 4096)
-        for {
-                n, err := httpResp.Body.Read(buf)
-                if err != nil && err != io.EOF {
-                        break
-                }
-                if n > 0 {
-                        data := string(buf[:n])
-                        lines := strings.Split(data, "\n")
-                        for _, line := range lines {
-                                line = strings.TrimSpace(line)
-                                if strings.HasPrefix(line, "data: ") {
-                                        data := strings.TrimPrefix(line, "data: ")
-                                        if data == "[DONE]" {
-                                                return nil
-                                        }
-                                        var chunk StreamChunk
-                                        if json.Unmarshal([]byte(data), &chunk) == nil {
-                                                if len(chunk.Choices) > 0 && chunk.Choices[0].Delta.Content != "" {
-                                                        if err := callback(chunk.Choices[0].Delta.Content); err != nil {
-                                                                return err
-                                                        }
-                                                }
-                                        }
-                                }
-                        }
-                }
-                if err == io.EOF {
-                        break
-                }
-        }
-        return nil
+// isGLM reports whether model is a Zhipu model, which supports do_sample
+// but no seed.
+func isGLM(model string) bool {
+        model = strings.ToLower(model)
+        return strings.HasPrefix(model, "glm-") || strings.HasPrefix(model, "codegeex-")
 }
@@ -0,0 +1,68 @@
+package llm
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrInvalidJWTKey is returned when JWT auth is requested for a key that is
+// not in Zhipu's "id.secret" format.
+var ErrInvalidJWTKey = errors.New(`jwt auth requires an API key of the form "id.secret"`)
+
+// DefaultTokenTTL is the lifetime of generated JWT tokens.
+const DefaultTokenTTL = 30 * time.Minute
+
+// jwtSigner generates and caches Zhipu JWT tokens from an "id.secret" key.
+type jwtSigner struct {
+	id     string
+	secret []byte
+	ttl    time.Duration
+
+	mu      sync.Mutex
+	token   string
+	expires time.Time
+}
+
+func newJWTSigner(apiKey string, ttl time.Duration) (*jwtSigner, error) {
+	id, secret, ok := strings.Cut(apiKey, ".")
+	if !ok || id == "" || secret == "" {
+		return nil, ErrInvalidJWTKey
+	}
+	if ttl <= 0 {
+		ttl = DefaultTokenTTL
+	}
+	return &jwtSigner{id: id, secret: []byte(secret), ttl: ttl}, nil
+}
+
+// Token returns a valid token, regenerating it shortly before it expires.
+func (s *jwtSigner) Token() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	if s.token != "" && now.Add(time.Minute).Before(s.expires) {
+		return s.token
+	}
+	s.expires = now.Add(s.ttl)
+	s.token = s.sign(now)
+	return s.token
+}
+
+func (s *jwtSigner) sign(now time.Time) string {
+	header, _ := json.Marshal(map[string]string{"alg": "HS256", "sign_type": "SIGN"})
+	claims, _ := json.Marshal(map[string]interface{}{
+		"api_key":   s.id,
+		"exp":       s.expires.UnixMilli(),
+		"timestamp": now.UnixMilli(),
+	})
+	enc := base64.RawURLEncoding
+	unsigned := enc.EncodeToString(header) + "." + enc.EncodeToString(claims)
+	mac := hmac.New(sha256.New, s.secret)
+	mac.Write([]byte(unsigned))
+	return unsigned + "." + enc.EncodeToString(mac.Sum(nil))
+}
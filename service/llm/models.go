@@ -0,0 +1,71 @@
+package llm
+
+import (
+	"strings"
+	"sync"
+)
+
+// ModelInfo describes the limits of a model and, when configured, its
+// prices.
+type ModelInfo struct {
+	Name          string  `yaml:"name"`
+	ContextWindow int     `yaml:"context_window"` // tokens, prompt and completion
+	MaxOutput     int     `yaml:"max_output"`     // tokens
+	InputPrice    float64 `yaml:"input_price"`    // per million prompt tokens
+	OutputPrice   float64 `yaml:"output_price"`   // per million completion tokens
+	Vision        bool    `yaml:"vision"`         // accepts image input
+}
+
+// Cost returns the price of a call, or false if the model has no prices.
+func (m ModelInfo) Cost(promptTokens, completionTokens int) (float64, bool) {
+	if m.InputPrice == 0 && m.OutputPrice == 0 {
+		return 0, false
+	}
+	return (float64(promptTokens)*m.InputPrice + float64(completionTokens)*m.OutputPrice) / 1e6, true
+}
+
+var (
+	modelsMu sync.RWMutex
+	models   = map[string]ModelInfo{
+		"glm-4":            {Name: "glm-4", ContextWindow: 128000, MaxOutput: 4096},
+		"glm-4-plus":       {Name: "glm-4-plus", ContextWindow: 128000, MaxOutput: 4096},
+		"glm-4-air":        {Name: "glm-4-air", ContextWindow: 128000, MaxOutput: 4096},
+		"glm-4-airx":       {Name: "glm-4-airx", ContextWindow: 8000, MaxOutput: 4096},
+		"glm-4-flash":      {Name: "glm-4-flash", ContextWindow: 128000, MaxOutput: 4096},
+		"glm-4-flashx":     {Name: "glm-4-flashx", ContextWindow: 128000, MaxOutput: 4096},
+		"glm-4-long":       {Name: "glm-4-long", ContextWindow: 1000000, MaxOutput: 4096},
+		"glm-4v":           {Name: "glm-4v", ContextWindow: 2000, MaxOutput: 1024, Vision: true},
+		"glm-4v-plus":      {Name: "glm-4v-plus", ContextWindow: 8000, MaxOutput: 1024, Vision: true},
+		"glm-4.5":          {Name: "glm-4.5", ContextWindow: 128000, MaxOutput: 96000},
+		"glm-4.5-air":      {Name: "glm-4.5-air", ContextWindow: 128000, MaxOutput: 96000},
+		"glm-4.6":          {Name: "glm-4.6", ContextWindow: 200000, MaxOutput: 128000},
+		"glm-3-turbo":      {Name: "glm-3-turbo", ContextWindow: 128000, MaxOutput: 4096},
+		"glm-zero-preview": {Name: "glm-zero-preview", ContextWindow: 16000, MaxOutput: 12000},
+		"codegeex-4":       {Name: "codegeex-4", ContextWindow: 128000, MaxOutput: 32000},
+	}
+)
+
+// RegisterModel adds or replaces a registry entry.
+func RegisterModel(info ModelInfo) {
+	modelsMu.Lock()
+	defer modelsMu.Unlock()
+	models[info.Name] = info
+}
+
+// LookupModel returns the limits of a model. Dated or suffixed variants
+// (glm-4-flash-250414) match the longest registered prefix.
+func LookupModel(name string) (ModelInfo, bool) {
+	modelsMu.RLock()
+	defer modelsMu.RUnlock()
+	name = strings.ToLower(name)
+	if info, ok := models[name]; ok {
+		return info, true
+	}
+	var best ModelInfo
+	for key, info := range models {
+		if strings.HasPrefix(name, key+"-") && len(key) > len(best.Name) {
+			best = info
+		}
+	}
+	return best, best.Name != ""
+}
@@ -0,0 +1,54 @@
+package llm
+
+// Route sends matching tasks to a model. A task is a command mode (fix,
+// refactor, ...) or an internal task such as review or summarize; size is
+// the number of input bytes.
+type Route struct {
+	Tasks    []string `yaml:"tasks"`
+	MinBytes int      `yaml:"min_bytes"`
+	MaxBytes int      `yaml:"max_bytes"`
+	Model    string   `yaml:"model"`
+}
+
+// Matches reports whether the route applies to the task.
+func (r Route) Matches(task string, size int) bool {
+	if len(r.Tasks) > 0 && !contains(r.Tasks, task) {
+		return false
+	}
+	if r.MinBytes > 0 && size < r.MinBytes {
+		return false
+	}
+	if r.MaxBytes > 0 && size > r.MaxBytes {
+		return false
+	}
+	return r.Model != ""
+}
+
+// Router selects a model per task.
+type Router struct {
+	Default   string
+	Overrides map[string]string // task -> model, always wins
+	Routes    []Route           // first match wins
+}
+
+// Select returns the model for a task of the given input size.
+func (r *Router) Select(task string, size int) string {
+	if model := r.Overrides[task]; model != "" {
+		return model
+	}
+	for _, route := range r.Routes {
+		if route.Matches(task, size) {
+			return route.Model
+		}
+	}
+	return r.Default
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,170 @@
+package llm
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// StreamStats describes a completed or interrupted stream.
+type StreamStats struct {
+	TimeToFirstToken time.Duration
+	Duration         time.Duration
+	Chunks           int
+	CompletionTokens int // reported by the API, else estimated
+	PromptTokens     int
+	TotalTokens      int
+	Retries          int    // stalls retried before the first token
+	FinishReason     string // "stop", or "length" when cut off at the output limit
+}
+
+// TokensPerSecond returns the generation rate after the first token.
+func (s *StreamStats) TokensPerSecond() float64 {
+	gen := s.Duration - s.TimeToFirstToken
+	if gen <= 0 || s.CompletionTokens == 0 {
+		return 0
+	}
+	return float64(s.CompletionTokens) / gen.Seconds()
+}
+
+// StreamError is returned when a stream fails after delivering output.
+type StreamError struct {
+	Err     error
+	Partial string
+	Stats   StreamStats
+}
+
+func (e *StreamError) Error() string {
+	return fmt.Sprintf("%v after %d chars of output", e.Err, len(e.Partial))
+}
+
+func (e *StreamError) Unwrap() error { return e.Err }
+
+// StreamWithStats streams a chat completion and reports timing statistics.
+// A stream that stays idle for StreamIdleTimeout is cancelled; stalls
+// before the first token are retried up to MaxRetries times, later stalls
+// return a StreamError carrying the partial output.
+func (c *Client) StreamWithStats(ctx context.Context, req ChatCompletionRequest, callback StreamCallback) (*StreamStats, error) {
+	stats := &StreamStats{}
+	for attempt := 0; ; attempt++ {
+		partial, err := c.stream(ctx, req, callback, stats)
+		if err == nil {
+			return stats, nil
+		}
+		if errors.Is(err, ErrStreamStalled) && partial == "" && attempt < c.config.MaxRetries {
+			stats.Retries++
+			continue
+		}
+		if partial != "" {
+			return stats, &StreamError{Err: err, Partial: partial, Stats: *stats}
+		}
+		return stats, err
+	}
+}
+
+func (c *Client) stream(ctx context.Context, req ChatCompletionRequest, callback StreamCallback, stats *StreamStats) (string, error) {
+	body, err := c.requestBody(struct {
+		ChatCompletionRequest
+		Stream bool `json:"stream"`
+	}{c.prepare(req), true})
+	if err != nil {
+		return "", err
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	var stalled atomic.Bool
+	watchdog := time.AfterFunc(c.config.StreamIdleTimeout, func() {
+		stalled.Store(true)
+		cancel()
+	})
+	defer watchdog.Stop()
+
+	httpReq, _ := http.NewRequestWithContext(ctx, "POST", c.config.BaseURL+"/chat/completions", bytes.NewReader(body))
+	httpReq.Header.Set("Content-Type", "application/json")
+	httpReq.Header.Set("Authorization", "Bearer "+c.authToken())
+	httpReq.Header.Set("Accept", "text/event-stream")
+
+	start := time.Now()
+	// The stream's lifetime is bounded by the idle watchdog, not the
+	// client's overall request timeout.
+	httpClient := *c.httpClient
+	httpClient.Timeout = 0
+	httpResp, err := httpClient.Do(httpReq)
+	if err != nil {
+		if stalled.Load() {
+			return "", ErrStreamStalled
+		}
+		return "", fmt.Errorf("%w: %v", ErrRequestFailed, err)
+	}
+	defer httpResp.Body.Close()
+	if httpResp.StatusCode != http.StatusOK {
+		var response ChatCompletionResponse
+		if json.NewDecoder(httpResp.Body).Decode(&response) == nil && response.Error != nil {
+			response.Error.HTTPStatus = httpResp.StatusCode
+			return "", response.Error
+		}
+		return "", fmt.Errorf("%w: status %d", ErrRequestFailed, httpResp.StatusCode)
+	}
+
+	var out strings.Builder
+	scanner := bufio.NewScanner(httpResp.Body)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		watchdog.Reset(c.config.StreamIdleTimeout)
+		line := strings.TrimSpace(scanner.Text())
+		if !strings.HasPrefix(line, "data:") {
+			continue
+		}
+		data := strings.TrimSpace(strings.TrimPrefix(line, "data:"))
+		if data == "[DONE]" {
+			break
+		}
+		var chunk StreamChunk
+		if json.Unmarshal([]byte(data), &chunk) != nil {
+			continue
+		}
+		if chunk.Usage != nil {
+			stats.PromptTokens = chunk.Usage.PromptTokens
+			stats.CompletionTokens = chunk.Usage.CompletionTokens
+			stats.TotalTokens = chunk.Usage.TotalTokens
+		}
+		if len(chunk.Choices) > 0 && chunk.Choices[0].FinishReason != "" {
+			stats.FinishReason = chunk.Choices[0].FinishReason
+		}
+		if len(chunk.Choices) == 0 || chunk.Choices[0].Delta.Content == "" {
+			continue
+		}
+		if stats.Chunks == 0 {
+			stats.TimeToFirstToken = time.Since(start)
+		}
+		stats.Chunks++
+		content := chunk.Choices[0].Delta.Content
+		out.WriteString(content)
+		if err := callback(content); err != nil {
+			return out.String(), err
+		}
+	}
+	stats.Duration = time.Since(start)
+	if stats.CompletionTokens == 0 {
+		stats.CompletionTokens = (out.Len() + 3) / 4
+	}
+
+	if err := scanner.Err(); err != nil {
+		if stalled.Load() {
+			return out.String(), ErrStreamStalled
+		}
+		return out.String(), fmt.Errorf("%w: %v", ErrRequestFailed, err)
+	}
+	if stalled.Load() {
+		return out.String(), ErrStreamStalled
+	}
+	return out.String(), nil
+}
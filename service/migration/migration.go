@@ -0,0 +1,447 @@
+// Package migration checks SQL migrations for operations that are unsafe
+// on a live database: destroying data, rewriting or locking tables while
+// the application runs, and foreign keys whose lookups scan the table.
+package migration
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"ai-dev-agent/service/orchestrator"
+)
+
+// Rules of the checks.
+const (
+	RuleDropTable          = "drop_table"
+	RuleDropColumn         = "drop_column"
+	RuleTruncate           = "truncate"
+	RuleUnboundedWrite     = "unbounded_write"
+	RuleRename             = "rename"
+	RuleAlterType          = "alter_type"
+	RuleNotNullNoDefault   = "not_null_without_default"
+	RuleIndexNotConcurrent = "index_not_concurrent"
+	RuleFKWithoutIndex     = "fk_without_index"
+)
+
+// DefaultSeverity is the severity of each rule unless a policy changes it.
+var DefaultSeverity = map[string]string{
+	RuleDropTable:          orchestrator.SeverityBlocking,
+	RuleDropColumn:         orchestrator.SeverityBlocking,
+	RuleTruncate:           orchestrator.SeverityBlocking,
+	RuleUnboundedWrite:     orchestrator.SeverityBlocking,
+	RuleRename:             orchestrator.SeverityBlocking,
+	RuleAlterType:          orchestrator.SeverityBlocking,
+	RuleNotNullNoDefault:   orchestrator.SeverityBlocking,
+	RuleIndexNotConcurrent: orchestrator.SeverityBlocking,
+	RuleFKWithoutIndex:     orchestrator.SeverityNonBlocking,
+}
+
+// Dialects.
+const (
+	DialectPostgres = "postgres"
+	DialectMySQL    = "mysql"
+	DialectSQLite   = "sqlite"
+)
+
+// Policy is a team's rules for the migrations of its database, kept in
+// the YAML file that migration_policy in .aidev.yaml names.
+type Policy struct {
+	// Dialect is postgres (the default), mysql or sqlite. MySQL indexes
+	// foreign keys itself and has no concurrent index builds, so those
+	// rules only apply to the others.
+	Dialect string `yaml:"dialect"`
+	// Severity overrides the severity of rules: blocking, non-blocking
+	// or ignore.
+	Severity map[string]string `yaml:"severity"`
+	// Guidelines are further rules in plain words, such as "migrations
+	// must work with the previous release", given to the reviewer.
+	Guidelines []string `yaml:"guidelines"`
+}
+
+// LoadPolicy reads and checks a policy file.
+func LoadPolicy(path string) (*Policy, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	p := &Policy{}
+	if err := yaml.Unmarshal(data, p); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if err := p.Validate(); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return p, nil
+}
+
+// Validate checks the dialect and the severities.
+func (p *Policy) Validate() error {
+	switch p.Dialect {
+	case "", DialectPostgres, DialectMySQL, DialectSQLite:
+	default:
+		return fmt.Errorf("dialect %q: want postgres, mysql or sqlite", p.Dialect)
+	}
+	for rule, severity := range p.Severity {
+		if _, ok := DefaultSeverity[rule]; !ok {
+			return fmt.Errorf("severity: unknown rule %q: want one of %s", rule, strings.Join(ruleNames(), ", "))
+		}
+		switch severity {
+		case orchestrator.SeverityBlocking, orchestrator.SeverityNonBlocking, orchestrator.SeverityIgnore:
+		default:
+			return fmt.Errorf("severity of %s: %q: want blocking, non-blocking or ignore", rule, severity)
+		}
+	}
+	return nil
+}
+
+// Prompt describes the policy to the reviewer.
+func (p *Policy) Prompt() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "The migrations run on a live %s database while the previous release of the application is still serving.", p.dialect())
+	for _, g := range p.Guidelines {
+		fmt.Fprintf(&b, "\n- %s", g)
+	}
+	return b.String()
+}
+
+// Check returns the findings of the statements of a migration, in order.
+func Check(path, sql string, p *Policy) []orchestrator.Finding {
+	if p == nil {
+		p = &Policy{}
+	}
+	c := &checker{policy: p, path: path, created: make(map[string]bool), indexed: make(map[string]bool)}
+	stmts := Split(sql)
+	// Tables created and columns indexed anywhere in the file count for
+	// every statement, whatever their order.
+	for _, s := range stmts {
+		c.collect(s)
+	}
+	for _, s := range stmts {
+		c.check(s)
+	}
+	return c.findings
+}
+
+// Statement is one SQL statement of a migration.
+type Statement struct {
+	Line int    // where it starts
+	Text string // without comments, whitespace collapsed
+}
+
+// Split splits a migration into its statements, skipping comments and
+// keeping semicolons inside quotes and dollar-quoted bodies.
+func Split(sql string) []Statement {
+	var stmts []Statement
+	var b strings.Builder
+	line, start := 1, 0
+	flush := func() {
+		text := strings.Join(strings.Fields(b.String()), " ")
+		if text != "" {
+			stmts = append(stmts, Statement{Line: start, Text: text})
+		}
+		b.Reset()
+		start = 0
+	}
+	for i := 0; i < len(sql); i++ {
+		ch := sql[i]
+		switch {
+		case ch == '\n':
+			line++
+		case strings.HasPrefix(sql[i:], "--"):
+			for i < len(sql) && sql[i] != '\n' {
+				i++
+			}
+			i--
+			continue
+		case strings.HasPrefix(sql[i:], "/*"):
+			end := strings.Index(sql[i+2:], "*/")
+			if end < 0 {
+				end = len(sql) - i - 2
+			}
+			line += strings.Count(sql[i:i+2+end], "\n")
+			i += end + 3
+			b.WriteByte(' ')
+			continue
+		case ch == ';':
+			flush()
+			continue
+		}
+		if start == 0 && ch != ' ' && ch != '\t' && ch != '\n' && ch != '\r' {
+			start = line
+		}
+		// Quoted text and dollar-quoted bodies are copied whole.
+		var end int
+		switch {
+		case ch == '\'' || ch == '"' || ch == '`':
+			end = closing(sql, i+1, string(ch))
+		case ch == '$':
+			if m := dollarTag.FindString(sql[i:]); m != "" {
+				end = closing(sql, i+len(m), m)
+			}
+		}
+		if end > i {
+			line += strings.Count(sql[i:end], "\n")
+			b.WriteString(sql[i:end])
+			i = end - 1
+			continue
+		}
+		b.WriteByte(ch)
+	}
+	flush()
+	return stmts
+}
+
+// Helper functions
+
+var (
+	dollarTag = regexp.MustCompile(`^\$\w*\$`)
+
+	createTablePattern = regexp.MustCompile(`(?i)^CREATE (?:TEMP(?:ORARY)? |UNLOGGED )?TABLE (?:IF NOT EXISTS )?([\w."` + "`" + `]+)\s*\((.*)\)`)
+	alterTablePattern  = regexp.MustCompile(`(?i)^ALTER TABLE (?:IF EXISTS )?(?:ONLY )?([\w."` + "`" + `]+) (.*)$`)
+	createIndexPattern = regexp.MustCompile(`(?i)^CREATE (?:UNIQUE )?INDEX (CONCURRENTLY )?.*? ON (?:ONLY )?([\w."` + "`" + `]+)(?: USING \w+)?\s*\(\s*([\w"` + "`" + `]+)`)
+	dropIndexPattern   = regexp.MustCompile(`(?i)^DROP INDEX (CONCURRENTLY )?`)
+	dropTablePattern   = regexp.MustCompile(`(?i)^DROP TABLE (?:IF EXISTS )?([\w."` + "`" + `, ]+)`)
+	truncatePattern    = regexp.MustCompile(`(?i)^TRUNCATE (?:TABLE )?([\w."` + "`" + `]+)`)
+	deletePattern      = regexp.MustCompile(`(?i)^DELETE FROM ([\w."` + "`" + `]+)`)
+	updatePattern      = regexp.MustCompile(`(?i)^UPDATE ([\w."` + "`" + `]+) SET `)
+	renameTablePattern = regexp.MustCompile(`(?i)^RENAME TABLE `)
+	wherePattern       = regexp.MustCompile(`(?i)\bWHERE\b`)
+	addPrefix          = regexp.MustCompile(`(?i)^ADD\s+`)
+
+	dropColumnPattern = regexp.MustCompile(`(?i)^DROP (?:COLUMN )?(?:IF EXISTS )?([\w"` + "`" + `]+)`)
+	addColumnPattern  = regexp.MustCompile(`(?i)^ADD (?:COLUMN )?(?:IF NOT EXISTS )?([\w"` + "`" + `]+) (.*)$`)
+	alterTypePattern  = regexp.MustCompile(`(?i)^(?:ALTER (?:COLUMN )?([\w"` + "`" + `]+) (?:SET DATA )?TYPE|MODIFY (?:COLUMN )?([\w"` + "`" + `]+)|CHANGE (?:COLUMN )?([\w"` + "`" + `]+))`)
+	renamePattern     = regexp.MustCompile(`(?i)^RENAME\b`)
+	foreignKeyPattern = regexp.MustCompile(`(?i)FOREIGN KEY\s*\(\s*([\w"` + "`" + `]+)`)
+	referencesPattern = regexp.MustCompile(`(?i)\bREFERENCES\b`)
+	keyPattern        = regexp.MustCompile(`(?i)^(?:CONSTRAINT [\w"` + "`" + `]+ )?(?:PRIMARY KEY|UNIQUE)(?: KEY| INDEX)?(?: [\w"` + "`" + `]+)?\s*\(\s*([\w"` + "`" + `]+)`)
+	inlineKeyPattern  = regexp.MustCompile(`(?i)\b(?:PRIMARY KEY|UNIQUE)\b`)
+	notNullPattern    = regexp.MustCompile(`(?i)\bNOT NULL\b`)
+	defaultPattern    = regexp.MustCompile(`(?i)\bDEFAULT\b|\bGENERATED\b`)
+)
+
+// columnKeywords start the clauses of a table definition that aren't
+// columns.
+var columnKeywords = map[string]bool{"CONSTRAINT": true, "PRIMARY": true, "UNIQUE": true, "FOREIGN": true, "CHECK": true, "KEY": true, "INDEX": true, "EXCLUDE": true}
+
+// dropTargets are what ALTER TABLE ... DROP drops besides columns.
+var dropTargets = map[string]bool{"CONSTRAINT": true, "INDEX": true, "DEFAULT": true, "NOT": true, "PRIMARY": true, "FOREIGN": true, "KEY": true, "IDENTITY": true, "EXPRESSION": true, "CHECK": true}
+
+type checker struct {
+	policy   *Policy
+	path     string
+	created  map[string]bool // tables created by the migration
+	indexed  map[string]bool // table.column leading an index or key
+	findings []orchestrator.Finding
+}
+
+// collect records the tables the migration creates and the columns it
+// indexes.
+func (c *checker) collect(s Statement) {
+	if m := createTablePattern.FindStringSubmatch(s.Text); m != nil {
+		table := name(m[1])
+		c.created[table] = true
+		for _, def := range splitTop(m[2]) {
+			if k := keyPattern.FindStringSubmatch(def); k != nil {
+				c.indexed[table+"."+name(k[1])] = true
+			} else if col, ok := columnName(def); ok && inlineKeyPattern.MatchString(def) {
+				c.indexed[table+"."+col] = true
+			}
+		}
+	}
+	if m := createIndexPattern.FindStringSubmatch(s.Text); m != nil {
+		c.indexed[name(m[2])+"."+name(m[3])] = true
+	}
+	if m := alterTablePattern.FindStringSubmatch(s.Text); m != nil {
+		for _, action := range splitTop(m[2]) {
+			if k := keyPattern.FindStringSubmatch(addPrefix.ReplaceAllString(action, "")); k != nil {
+				c.indexed[name(m[1])+"."+name(k[1])] = true
+			}
+		}
+	}
+}
+
+func (c *checker) check(s Statement) {
+	text := s.Text
+	switch {
+	case dropTablePattern.MatchString(text):
+		tables := dropTablePattern.FindStringSubmatch(text)[1]
+		c.add(s, RuleDropTable, fmt.Sprintf("DROP TABLE %s destroys its data", strings.TrimSpace(tables)),
+			"The running release fails as soon as the table is gone, and the data can't be restored without a backup. Stop using the table in one release and drop it in a later migration.")
+	case truncatePattern.MatchString(text):
+		c.add(s, RuleTruncate, fmt.Sprintf("TRUNCATE %s deletes every row", name(truncatePattern.FindStringSubmatch(text)[1])),
+			"A schema migration shouldn't delete data; if it must, do it in a reviewed data migration with a backup.")
+	case deletePattern.MatchString(text) && !wherePattern.MatchString(text):
+		c.add(s, RuleUnboundedWrite, fmt.Sprintf("DELETE FROM %s has no WHERE clause and deletes every row", name(deletePattern.FindStringSubmatch(text)[1])),
+			"Add the condition that selects the rows to delete, and batch large deletes.")
+	case updatePattern.MatchString(text) && !wherePattern.MatchString(text):
+		table := name(updatePattern.FindStringSubmatch(text)[1])
+		if !c.created[table] {
+			c.add(s, RuleUnboundedWrite, fmt.Sprintf("UPDATE %s has no WHERE clause and rewrites every row in one transaction", table),
+				"Backfill in batches, outside the schema migration, so that the table isn't locked and the log doesn't grow with the whole table.")
+		}
+	case renameTablePattern.MatchString(text):
+		c.add(s, RuleRename, "RENAME TABLE breaks the running release, which still uses the old name",
+			"Create the new table or a view under the new name first, move the code over, then drop the old name in a later migration.")
+	case createIndexPattern.MatchString(text):
+		m := createIndexPattern.FindStringSubmatch(text)
+		if c.policy.dialect() == DialectPostgres && m[1] == "" && !c.created[name(m[2])] {
+			c.add(s, RuleIndexNotConcurrent, fmt.Sprintf("CREATE INDEX on %s without CONCURRENTLY blocks writes to the table while the index builds", name(m[2])),
+				"Use CREATE INDEX CONCURRENTLY, in a migration that doesn't run in a transaction.")
+		}
+	case dropIndexPattern.MatchString(text):
+		if c.policy.dialect() == DialectPostgres && dropIndexPattern.FindStringSubmatch(text)[1] == "" {
+			c.add(s, RuleIndexNotConcurrent, "DROP INDEX without CONCURRENTLY blocks access to the table while it runs",
+				"Use DROP INDEX CONCURRENTLY, in a migration that doesn't run in a transaction.")
+		}
+	case createTablePattern.MatchString(text):
+		m := createTablePattern.FindStringSubmatch(text)
+		table := name(m[1])
+		for _, def := range splitTop(m[2]) {
+			col := ""
+			if k := foreignKeyPattern.FindStringSubmatch(def); k != nil {
+				col = name(k[1])
+			} else if referencesPattern.MatchString(def) {
+				col, _ = columnName(def)
+			}
+			if col != "" {
+				c.foreignKey(s, table, col)
+			}
+		}
+	case alterTablePattern.MatchString(text):
+		m := alterTablePattern.FindStringSubmatch(text)
+		table := name(m[1])
+		for _, action := range splitTop(m[2]) {
+			c.alterAction(s, table, action)
+		}
+	}
+}
+
+func (c *checker) alterAction(s Statement, table, action string) {
+	if strings.HasPrefix(strings.ToUpper(action), "DROP ") {
+		if m := dropColumnPattern.FindStringSubmatch(action); m != nil && !dropTargets[strings.ToUpper(m[1])] {
+			c.add(s, RuleDropColumn, fmt.Sprintf("dropping %s.%s destroys its data", table, name(m[1])),
+				"The running release fails on queries that still name the column. Stop using it in one release and drop it in a later migration.")
+		}
+		return
+	}
+	if renamePattern.MatchString(action) {
+		c.add(s, RuleRename, fmt.Sprintf("renaming in %s breaks the running release, which still uses the old name", table),
+			"Add the new column or table, write to both and backfill, move the code over, then drop the old one in a later migration.")
+		return
+	}
+	if m := alterTypePattern.FindStringSubmatch(action); m != nil {
+		col := name(m[1] + m[2] + m[3])
+		c.add(s, RuleAlterType, fmt.Sprintf("changing the type of %s.%s rewrites the table under an exclusive lock", table, col),
+			"Add a column of the new type, backfill it in batches and switch over, unless the change is known not to rewrite (such as widening a varchar).")
+		return
+	}
+	if m := addColumnPattern.FindStringSubmatch(action); m != nil && !columnKeywords[strings.ToUpper(name(m[1]))] {
+		col := name(m[1])
+		if notNullPattern.MatchString(m[2]) && !defaultPattern.MatchString(m[2]) && !c.created[table] {
+			c.add(s, RuleNotNullNoDefault, fmt.Sprintf("adding NOT NULL column %s.%s without a default fails on a table with rows", table, col),
+				"Add the column as nullable or with a default, backfill it, then add the NOT NULL constraint.")
+		}
+		if referencesPattern.MatchString(m[2]) {
+			c.foreignKey(s, table, col)
+		}
+		return
+	}
+	if k := foreignKeyPattern.FindStringSubmatch(action); k != nil {
+		c.foreignKey(s, table, name(k[1]))
+	}
+}
+
+func (c *checker) foreignKey(s Statement, table, col string) {
+	if c.policy.dialect() == DialectMySQL || c.indexed[table+"."+col] {
+		return
+	}
+	c.add(s, RuleFKWithoutIndex, fmt.Sprintf("foreign key %s.%s has no index", table, col),
+		fmt.Sprintf("Joins on it and deletes from the referenced table scan %s. Add an index whose first column is %s.", table, col))
+}
+
+func (c *checker) add(s Statement, rule, subject, discussion string) {
+	severity := DefaultSeverity[rule]
+	if sev, ok := c.policy.Severity[rule]; ok {
+		severity = sev
+	}
+	f := orchestrator.Finding{File: c.path, Line: s.Line, Subject: subject, Discussion: discussion, Decorations: []string{"migration", rule}}
+	switch severity {
+	case orchestrator.SeverityIgnore:
+		return
+	case orchestrator.SeverityBlocking:
+		f.Label, f.Blocking = orchestrator.LabelIssue, true
+		f.Decorations = append([]string{"blocking"}, f.Decorations...)
+	default:
+		f.Label = orchestrator.LabelSuggestion
+	}
+	c.findings = append(c.findings, f)
+}
+
+func (p *Policy) dialect() string {
+	if p.Dialect == "" {
+		return DialectPostgres
+	}
+	return p.Dialect
+}
+
+// closing returns the offset just past the delim that closes text at
+// from, or 0 when it isn't closed.
+func closing(sql string, from int, delim string) int {
+	if i := strings.Index(sql[from:], delim); i >= 0 {
+		return from + i + len(delim)
+	}
+	return 0
+}
+
+// splitTop splits a list at the commas outside parentheses.
+func splitTop(list string) []string {
+	var parts []string
+	depth, start := 0, 0
+	for i := 0; i < len(list); i++ {
+		switch list[i] {
+		case '(':
+			depth++
+		case ')':
+			depth--
+		case ',':
+			if depth == 0 {
+				parts = append(parts, strings.TrimSpace(list[start:i]))
+				start = i + 1
+			}
+		}
+	}
+	return append(parts, strings.TrimSpace(list[start:]))
+}
+
+// columnName returns the column a table definition clause defines.
+func columnName(def string) (string, bool) {
+	fields := strings.Fields(def)
+	if len(fields) == 0 || columnKeywords[strings.ToUpper(fields[0])] {
+		return "", false
+	}
+	return name(fields[0]), true
+}
+
+// name normalizes an identifier: unquoted, without its schema, lower case.
+func name(ident string) string {
+	ident = strings.Trim(ident, "\"`")
+	if i := strings.LastIndex(ident, "."); i >= 0 {
+		ident = ident[i+1:]
+	}
+	return strings.ToLower(strings.Trim(ident, "\"`"))
+}
+
+func ruleNames() []string {
+	names := make([]string, 0, len(DefaultSeverity))
+	for rule := range DefaultSeverity {
+		names = append(names, rule)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,359 @@
+// Package openapi compares an OpenAPI document with the HTTP handlers a Go
+// project registers: the routes and methods each side has that the other
+// lacks, and the request and response types they disagree on.
+package openapi
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Kinds of drift.
+const (
+	// DriftUndocumented is a registered route the spec doesn't describe.
+	DriftUndocumented = "undocumented"
+	// DriftUnimplemented is a spec operation no handler serves.
+	DriftUnimplemented = "unimplemented"
+	// DriftRequestType and DriftResponseType are an operation whose
+	// handler decodes or encodes a type other than the spec's schema.
+	DriftRequestType  = "request_type"
+	DriftResponseType = "response_type"
+)
+
+// SpecFiles are where FindSpec looks for the spec, in order.
+var SpecFiles = []string{
+	"openapi.yaml", "openapi.yml", "openapi.json",
+	"swagger.yaml", "swagger.yml", "swagger.json",
+	"api/openapi.yaml", "api/openapi.yml", "api/openapi.json",
+	"docs/openapi.yaml", "docs/swagger.yaml", "docs/swagger.json",
+}
+
+// Operation is a method on a path of the spec.
+type Operation struct {
+	Method      string
+	Path        string // as written, without the base path
+	Line        int
+	OperationID string
+	Request     string // schema of the JSON request body, e.g. User
+	Response    string // schema of the first 2xx JSON response, e.g. []User
+}
+
+// Spec is the operations of an OpenAPI 3 or Swagger 2 document.
+type Spec struct {
+	File       string
+	BasePath   string // path of the first server URL, or basePath
+	PathsLine  int    // line of the paths key
+	Operations []Operation
+}
+
+// Route is a handler registration found in the code.
+type Route struct {
+	Method   string // "" when the registration serves every method
+	Path     string // with the prefixes of its groups
+	File     string
+	Line     int
+	Handler  string
+	Request  string // type the handler decodes the body into
+	Response string // type the handler encodes as JSON
+}
+
+// Drift is one difference between the spec and the code. Route and
+// Operation are nil where that side has nothing.
+type Drift struct {
+	Kind      string
+	Route     *Route
+	Operation *Operation
+	Detail    string
+}
+
+// FindSpec returns the first of SpecFiles that exists under root, or "".
+func FindSpec(root string) string {
+	for _, name := range SpecFiles {
+		if _, err := os.Stat(filepath.Join(root, name)); err == nil {
+			return name
+		}
+	}
+	return ""
+}
+
+// LoadSpec reads the operations of a spec in YAML or JSON.
+func LoadSpec(path string) (*Spec, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if len(doc.Content) == 0 || doc.Content[0].Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("%s: not an OpenAPI document", path)
+	}
+	root := doc.Content[0]
+	spec := &Spec{File: path}
+	if base := value(root, "basePath"); base != nil {
+		spec.BasePath = strings.TrimSuffix(base.Value, "/")
+	}
+	if servers := value(root, "servers"); servers != nil && len(servers.Content) > 0 {
+		if u := value(servers.Content[0], "url"); u != nil {
+			if parsed, err := url.Parse(u.Value); err == nil {
+				spec.BasePath = strings.TrimSuffix(parsed.Path, "/")
+			}
+		}
+	}
+	paths, pathsKey := entry(root, "paths")
+	if paths == nil {
+		return nil, fmt.Errorf("%s: no paths", path)
+	}
+	spec.PathsLine = pathsKey.Line
+	for i := 0; i+1 < len(paths.Content); i += 2 {
+		p, item := paths.Content[i].Value, paths.Content[i+1]
+		for j := 0; j+1 < len(item.Content); j += 2 {
+			method := strings.ToUpper(item.Content[j].Value)
+			if !httpMethods[method] {
+				continue // parameters, summary, servers
+			}
+			op := item.Content[j+1]
+			o := Operation{Method: method, Path: p, Line: item.Content[j].Line}
+			if id := value(op, "operationId"); id != nil {
+				o.OperationID = id.Value
+			}
+			o.Request = jsonSchema(root, value(op, "requestBody"))
+			if param := bodyParameter(op); param != nil {
+				o.Request = schemaName(root, value(param, "schema"))
+			}
+			if responses := value(op, "responses"); responses != nil {
+				for k := 0; k+1 < len(responses.Content); k += 2 {
+					if strings.HasPrefix(responses.Content[k].Value, "2") {
+						resp := responses.Content[k+1]
+						o.Response = jsonSchema(root, resp)
+						if s := value(resp, "schema"); s != nil {
+							o.Response = schemaName(root, s)
+						}
+						break
+					}
+				}
+			}
+			spec.Operations = append(spec.Operations, o)
+		}
+	}
+	return spec, nil
+}
+
+// Compare returns the drift between a spec and the routes of the code,
+// undocumented routes first, each in order of the file. With no routes
+// there is nothing to compare: the code's router isn't one FindRoutes
+// recognizes.
+func Compare(spec *Spec, routes []Route) []Drift {
+	if len(routes) == 0 {
+		return nil
+	}
+	var drifts []Drift
+	served := make(map[*Operation]bool)
+	for i := range routes {
+		r := &routes[i]
+		ops := spec.match(r)
+		if len(ops) == 0 {
+			drifts = append(drifts, Drift{Kind: DriftUndocumented, Route: r,
+				Detail: fmt.Sprintf("%s is registered in the code but not described in %s", r.describe(), spec.File)})
+			continue
+		}
+		for _, op := range ops {
+			served[op] = true
+			if r.Request != "" && op.Request != "" && !sameType(r.Request, op.Request) {
+				drifts = append(drifts, Drift{Kind: DriftRequestType, Route: r, Operation: op,
+					Detail: fmt.Sprintf("%s %s decodes %s, but the spec's request body is %s", op.Method, op.Path, r.Request, op.Request)})
+			}
+			if r.Response != "" && op.Response != "" && !sameType(r.Response, op.Response) {
+				drifts = append(drifts, Drift{Kind: DriftResponseType, Route: r, Operation: op,
+					Detail: fmt.Sprintf("%s %s responds with %s, but the spec's response is %s", op.Method, op.Path, r.Response, op.Response)})
+			}
+		}
+	}
+	for i := range spec.Operations {
+		op := &spec.Operations[i]
+		if !served[op] {
+			drifts = append(drifts, Drift{Kind: DriftUnimplemented, Operation: op,
+				Detail: fmt.Sprintf("%s %s is described in %s but no handler is registered for it", op.Method, op.Path, spec.File)})
+		}
+	}
+	return drifts
+}
+
+// NearestRoute returns the registered route whose path shares the longest
+// prefix with path, which is where a missing handler likely belongs.
+func NearestRoute(routes []Route, path string) *Route {
+	var best *Route
+	bestLen := -1
+	for i := range routes {
+		n := commonPrefix(routes[i].Path, path)
+		if n > bestLen {
+			best, bestLen = &routes[i], n
+		}
+	}
+	return best
+}
+
+// Helper functions
+
+var httpMethods = map[string]bool{"GET": true, "POST": true, "PUT": true, "PATCH": true, "DELETE": true, "HEAD": true, "OPTIONS": true, "TRACE": true}
+
+// pathParam matches the parameters of spec and router paths: {id},
+// {id...}, {id:[0-9]+}, :id and *rest.
+var pathParam = regexp.MustCompile(`\{[^}]*\}|:[A-Za-z_]\w*|\*[A-Za-z_]\w*`)
+
+// normalize reduces a path to a form where the router's and the spec's
+// spellings of the same route are equal.
+func normalize(path string) string {
+	path = pathParam.ReplaceAllString(path, "{}")
+	if len(path) > 1 {
+		path = strings.TrimSuffix(path, "/")
+	}
+	if !strings.HasPrefix(path, "/") {
+		path = "/" + path
+	}
+	return path
+}
+
+// match returns the operations a route serves. A route matches with or
+// without the base path, since it may be mounted under it elsewhere.
+func (s *Spec) match(r *Route) []*Operation {
+	path := normalize(r.Path)
+	var ops []*Operation
+	for i := range s.Operations {
+		op := &s.Operations[i]
+		if r.Method != "" && r.Method != op.Method {
+			continue
+		}
+		if p := normalize(op.Path); p == path || normalize(s.BasePath+op.Path) == path {
+			ops = append(ops, op)
+		}
+	}
+	return ops
+}
+
+func (r *Route) describe() string {
+	if r.Method == "" {
+		return r.Path
+	}
+	return r.Method + " " + r.Path
+}
+
+// sameType compares a Go type with a schema name, ignoring pointers and
+// the package qualifier.
+func sameType(goType, schema string) bool {
+	clean := func(s string) string {
+		s = strings.ReplaceAll(s, "*", "")
+		if i := strings.LastIndex(s, "."); i >= 0 {
+			prefix := strings.TrimRight(s[:i], "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789_")
+			s = prefix + s[i+1:]
+		}
+		return strings.ToLower(s)
+	}
+	return clean(goType) == clean(schema)
+}
+
+// jsonSchema returns the schema name of the JSON content of a request
+// body or response.
+func jsonSchema(root, node *yaml.Node) string {
+	node = resolve(root, node)
+	content := value(node, "content")
+	if content == nil {
+		return ""
+	}
+	for i := 0; i+1 < len(content.Content); i += 2 {
+		if strings.Contains(content.Content[i].Value, "json") {
+			return schemaName(root, value(content.Content[i+1], "schema"))
+		}
+	}
+	return ""
+}
+
+// bodyParameter returns the Swagger 2 "in: body" parameter of an operation.
+func bodyParameter(op *yaml.Node) *yaml.Node {
+	params := value(op, "parameters")
+	if params == nil {
+		return nil
+	}
+	for _, p := range params.Content {
+		if in := value(p, "in"); in != nil && in.Value == "body" {
+			return p
+		}
+	}
+	return nil
+}
+
+// schemaName names a schema by its $ref, as []Name for an array of them.
+func schemaName(root, schema *yaml.Node) string {
+	if schema == nil {
+		return ""
+	}
+	if ref := value(schema, "$ref"); ref != nil {
+		return ref.Value[strings.LastIndex(ref.Value, "/")+1:]
+	}
+	if t := value(schema, "type"); t != nil && t.Value == "array" {
+		if item := schemaName(root, value(schema, "items")); item != "" {
+			return "[]" + item
+		}
+	}
+	return ""
+}
+
+// resolve follows a local $ref such as #/components/requestBodies/User.
+func resolve(root, node *yaml.Node) *yaml.Node {
+	ref := value(node, "$ref")
+	if ref == nil || !strings.HasPrefix(ref.Value, "#/") {
+		return node
+	}
+	target := root
+	for _, key := range strings.Split(ref.Value[2:], "/") {
+		if target = value(target, key); target == nil {
+			return node
+		}
+	}
+	return target
+}
+
+// value returns the value of key in a mapping node, or nil.
+func value(node *yaml.Node, key string) *yaml.Node {
+	v, _ := entry(node, key)
+	return v
+}
+
+// entry returns the value and key nodes of key in a mapping node.
+func entry(node *yaml.Node, key string) (*yaml.Node, *yaml.Node) {
+	if node == nil || node.Kind != yaml.MappingNode {
+		return nil, nil
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return node.Content[i+1], node.Content[i]
+		}
+	}
+	return nil, nil
+}
+
+func commonPrefix(a, b string) int {
+	n := 0
+	for n < len(a) && n < len(b) && a[n] == b[n] {
+		n++
+	}
+	return n
+}
+
+// sortRoutes orders routes by file and line.
+func sortRoutes(routes []Route) {
+	sort.SliceStable(routes, func(i, j int) bool {
+		if routes[i].File != routes[j].File {
+			return routes[i].File < routes[j].File
+		}
+		return routes[i].Line < routes[j].Line
+	})
+}
@@ -0,0 +1,398 @@
+package openapi
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// FindRoutes parses the Go files under root and returns the routes they
+// register with net/http (including Go 1.22 "GET /path" patterns), gin,
+// echo, chi, gorilla/mux and httprouter, in order of file and line.
+// Prefixes of groups (Group, Route, PathPrefix) are resolved within a
+// function. Files are relative to root.
+func FindRoutes(root string) ([]Route, error) {
+	fset := token.NewFileSet()
+	var files []*ast.File
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return nil
+		}
+		name := info.Name()
+		if info.IsDir() {
+			if path != root && (strings.HasPrefix(name, ".") || name == "vendor" || name == "testdata" || name == "node_modules") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !strings.HasSuffix(name, ".go") || strings.HasSuffix(name, "_test.go") {
+			return nil
+		}
+		f, err := parser.ParseFile(fset, path, nil, 0)
+		if err != nil {
+			return nil // a file that doesn't parse registers nothing we can see
+		}
+		files = append(files, f)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	funcs := make(map[string]*ast.FuncDecl)
+	for _, f := range files {
+		for _, decl := range f.Decls {
+			if fn, ok := decl.(*ast.FuncDecl); ok && fn.Body != nil {
+				if _, dup := funcs[fn.Name.Name]; !dup {
+					funcs[fn.Name.Name] = fn
+				}
+			}
+		}
+	}
+
+	var routes []Route
+	for _, f := range files {
+		file := fset.Position(f.Pos()).Filename
+		if rel, err := filepath.Rel(root, file); err == nil {
+			file = filepath.ToSlash(rel)
+		}
+		w := &routeWalker{fset: fset, file: file, funcs: funcs, methods: make(map[*ast.CallExpr][]string)}
+		for _, decl := range f.Decls {
+			if fn, ok := decl.(*ast.FuncDecl); ok && fn.Body != nil {
+				w.walk(fn.Body, make(map[string]string))
+			}
+		}
+		routes = append(routes, w.routes...)
+	}
+	sortRoutes(routes)
+	return routes, nil
+}
+
+// routeWalker collects the registrations of one file.
+type routeWalker struct {
+	fset    *token.FileSet
+	file    string
+	funcs   map[string]*ast.FuncDecl // handlers by name, across the project
+	methods map[*ast.CallExpr][]string
+	routes  []Route
+}
+
+// Registration methods by style: a router method per HTTP method (gin,
+// echo upper case; chi lower case), and Handle/HandleFunc taking the
+// pattern first (net/http, gorilla, chi) or the method first
+// (httprouter's Handle, chi's Method).
+var (
+	upperMethods = map[string]string{"GET": "GET", "POST": "POST", "PUT": "PUT", "PATCH": "PATCH", "DELETE": "DELETE", "HEAD": "HEAD", "OPTIONS": "OPTIONS"}
+	chiMethods   = map[string]string{"Get": "GET", "Post": "POST", "Put": "PUT", "Patch": "PATCH", "Delete": "DELETE", "Head": "HEAD", "Options": "OPTIONS"}
+	handleFuncs  = map[string]bool{"Handle": true, "HandleFunc": true, "Method": true, "MethodFunc": true, "Handler": true, "HandlerFunc": true}
+)
+
+// walk visits a function body; prefixes maps router variables to the
+// path prefix of their group.
+func (w *routeWalker) walk(body ast.Node, prefixes map[string]string) {
+	ast.Inspect(body, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.AssignStmt:
+			w.assign(n, prefixes)
+		case *ast.CallExpr:
+			sel, ok := n.Fun.(*ast.SelectorExpr)
+			if !ok {
+				return true
+			}
+			switch sel.Sel.Name {
+			case "Methods":
+				// gorilla: r.HandleFunc("/x", h).Methods("GET", "POST")
+				if inner, ok := sel.X.(*ast.CallExpr); ok {
+					for _, arg := range n.Args {
+						if s, ok := stringLit(arg); ok {
+							w.methods[inner] = append(w.methods[inner], strings.ToUpper(s))
+						}
+					}
+				}
+			case "Route":
+				// chi: r.Route("/x", func(r chi.Router) { ... })
+				if len(n.Args) == 2 {
+					prefix, ok := stringLit(n.Args[0])
+					lit, isLit := n.Args[1].(*ast.FuncLit)
+					if ok && isLit {
+						inner := copyPrefixes(prefixes)
+						if params := lit.Type.Params.List; len(params) == 1 && len(params[0].Names) == 1 {
+							inner[params[0].Names[0].Name] = prefixes[identName(sel.X)] + prefix
+						}
+						w.walk(lit.Body, inner)
+						return false
+					}
+				}
+			}
+			w.register(n, sel, prefixes)
+		}
+		return true
+	})
+}
+
+// assign records the prefix of g := r.Group("/x") and of
+// s := r.PathPrefix("/x").Subrouter().
+func (w *routeWalker) assign(n *ast.AssignStmt, prefixes map[string]string) {
+	if len(n.Lhs) != 1 || len(n.Rhs) != 1 {
+		return
+	}
+	lhs := identName(n.Lhs[0])
+	call, ok := n.Rhs[0].(*ast.CallExpr)
+	if lhs == "" || !ok {
+		return
+	}
+	sel, ok := call.Fun.(*ast.SelectorExpr)
+	if !ok {
+		return
+	}
+	if sel.Sel.Name == "Subrouter" {
+		if inner, ok := sel.X.(*ast.CallExpr); ok {
+			call = inner
+			if sel, ok = inner.Fun.(*ast.SelectorExpr); !ok {
+				return
+			}
+		}
+	}
+	if sel.Sel.Name != "Group" && sel.Sel.Name != "PathPrefix" || len(call.Args) == 0 {
+		return
+	}
+	if prefix, ok := stringLit(call.Args[0]); ok {
+		prefixes[lhs] = prefixes[identName(sel.X)] + prefix
+	}
+}
+
+// register records the route of a registration call, if it is one.
+func (w *routeWalker) register(n *ast.CallExpr, sel *ast.SelectorExpr, prefixes map[string]string) {
+	name := sel.Sel.Name
+	var method, path string
+	var handler ast.Expr
+	switch {
+	case upperMethods[name] != "" || chiMethods[name] != "":
+		if len(n.Args) < 2 {
+			return
+		}
+		p, ok := stringLit(n.Args[0])
+		if !ok || !strings.HasPrefix(p, "/") {
+			return // http.Get(url) and the like
+		}
+		method, path, handler = upperMethods[name]+chiMethods[name], p, n.Args[len(n.Args)-1]
+	case handleFuncs[name]:
+		if len(n.Args) == 3 {
+			m, ok1 := stringLit(n.Args[0])
+			p, ok2 := stringLit(n.Args[1])
+			if !ok1 || !ok2 || !httpMethods[strings.ToUpper(m)] {
+				return
+			}
+			method, path, handler = strings.ToUpper(m), p, n.Args[2]
+			break
+		}
+		if len(n.Args) != 2 {
+			return
+		}
+		p, ok := stringLit(n.Args[0])
+		if !ok {
+			return
+		}
+		// Go 1.22 patterns: "GET /x", "POST example.com/x"
+		if m, rest, found := strings.Cut(p, " "); found && httpMethods[m] {
+			method, p = m, strings.TrimSpace(rest)
+		}
+		if i := strings.Index(p, "/"); i > 0 {
+			p = p[i:] // host of a pattern
+		}
+		if !strings.HasPrefix(p, "/") {
+			return
+		}
+		path, handler = p, n.Args[1]
+	default:
+		return
+	}
+	path = prefixes[identName(sel.X)] + path
+	r := Route{Method: method, Path: path, File: w.file, Line: w.fset.Position(n.Pos()).Line}
+	r.Handler, r.Request, r.Response = w.handlerTypes(handler)
+	if methods := w.methods[n]; len(methods) > 0 && method == "" {
+		for _, m := range methods {
+			r.Method = m
+			w.routes = append(w.routes, r)
+		}
+		return
+	}
+	w.routes = append(w.routes, r)
+}
+
+// handlerTypes names a handler and the types its body decodes and
+// encodes as JSON, where they can be told from the source.
+func (w *routeWalker) handlerTypes(handler ast.Expr) (name, request, response string) {
+	// http.HandlerFunc(h), middleware(h): the last argument is the handler.
+	for {
+		call, ok := handler.(*ast.CallExpr)
+		if !ok || len(call.Args) == 0 {
+			break
+		}
+		handler = call.Args[len(call.Args)-1]
+	}
+	var body *ast.BlockStmt
+	switch h := handler.(type) {
+	case *ast.FuncLit:
+		name, body = "func literal", h.Body
+	case *ast.Ident:
+		name = h.Name
+	case *ast.SelectorExpr:
+		name = h.Sel.Name
+	}
+	if body == nil {
+		if fn := w.funcs[name]; fn != nil {
+			body = fn.Body
+		}
+	}
+	if body == nil {
+		return name, "", ""
+	}
+	request, response = bodyTypes(body)
+	return name, request, response
+}
+
+// bodyTypes finds the JSON request and response types of a handler body.
+func bodyTypes(body *ast.BlockStmt) (request, response string) {
+	vars := localTypes(body)
+	ast.Inspect(body, func(n ast.Node) bool {
+		call, ok := n.(*ast.CallExpr)
+		if !ok {
+			return true
+		}
+		sel, ok := call.Fun.(*ast.SelectorExpr)
+		if !ok || len(call.Args) == 0 {
+			return true
+		}
+		last := call.Args[len(call.Args)-1]
+		switch sel.Sel.Name {
+		case "Decode":
+			if isCall(sel.X, "NewDecoder") && request == "" {
+				request = exprType(last, vars)
+			}
+		case "Unmarshal", "ShouldBindJSON", "BindJSON", "ShouldBind", "Bind":
+			if request == "" {
+				request = exprType(last, vars)
+			}
+		case "Encode":
+			if isCall(sel.X, "NewEncoder") && response == "" {
+				response = exprType(last, vars)
+			}
+		case "JSON", "IndentedJSON", "PureJSON":
+			if len(call.Args) == 2 && response == "" {
+				response = exprType(last, vars)
+			}
+		}
+		return true
+	})
+	return request, response
+}
+
+// localTypes maps the variables of a body to their declared or
+// constructed types: var x T, x := T{}, x := &T{}, x := new(T).
+func localTypes(body *ast.BlockStmt) map[string]string {
+	vars := make(map[string]string)
+	ast.Inspect(body, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.ValueSpec:
+			if n.Type != nil {
+				for _, id := range n.Names {
+					vars[id.Name] = typeName(n.Type)
+				}
+			}
+		case *ast.AssignStmt:
+			if len(n.Lhs) != len(n.Rhs) {
+				return true
+			}
+			for i, lhs := range n.Lhs {
+				if id, ok := lhs.(*ast.Ident); ok {
+					if t := exprType(n.Rhs[i], nil); t != "" {
+						vars[id.Name] = t
+					}
+				}
+			}
+		}
+		return true
+	})
+	return vars
+}
+
+// exprType returns the type of a composite literal, new(T) or a known
+// variable.
+func exprType(e ast.Expr, vars map[string]string) string {
+	switch e := e.(type) {
+	case *ast.UnaryExpr:
+		return exprType(e.X, vars)
+	case *ast.CompositeLit:
+		if e.Type != nil {
+			return typeName(e.Type)
+		}
+	case *ast.CallExpr:
+		if id, ok := e.Fun.(*ast.Ident); ok && id.Name == "new" && len(e.Args) == 1 {
+			return typeName(e.Args[0])
+		}
+	case *ast.Ident:
+		return vars[e.Name]
+	}
+	return ""
+}
+
+// typeName writes a type expression: T, pkg.T, []T; maps and anonymous
+// types are unknown.
+func typeName(e ast.Expr) string {
+	switch e := e.(type) {
+	case *ast.Ident:
+		return e.Name
+	case *ast.SelectorExpr:
+		return identName(e.X) + "." + e.Sel.Name
+	case *ast.StarExpr:
+		return typeName(e.X)
+	case *ast.ArrayType:
+		if elem := typeName(e.Elt); elem != "" {
+			return "[]" + elem
+		}
+	}
+	return ""
+}
+
+func isCall(e ast.Expr, name string) bool {
+	call, ok := e.(*ast.CallExpr)
+	if !ok {
+		return false
+	}
+	switch fn := call.Fun.(type) {
+	case *ast.SelectorExpr:
+		return fn.Sel.Name == name
+	case *ast.Ident:
+		return fn.Name == name
+	}
+	return false
+}
+
+func stringLit(e ast.Expr) (string, bool) {
+	lit, ok := e.(*ast.BasicLit)
+	if !ok || lit.Kind != token.STRING {
+		return "", false
+	}
+	s, err := strconv.Unquote(lit.Value)
+	return s, err == nil
+}
+
+func identName(e ast.Expr) string {
+	if id, ok := e.(*ast.Ident); ok {
+		return id.Name
+	}
+	return ""
+}
+
+func copyPrefixes(m map[string]string) map[string]string {
+	c := make(map[string]string, len(m))
+	for k, v := range m {
+		c[k] = v
+	}
+	return c
+}
@@ -0,0 +1,206 @@
+package orchestrator
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/printer"
+	"go/token"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// setupAPIStable enforces api-stable for refactors. With the apidiff tool
+// (golang.org/x/exp/cmd/apidiff) installed, the export data of the target
+// packages is snapshotted before anything is written and compared after
+// each attempt. Without it, or when the attempt is staged, the exported
+// declarations of the target files are compared instead.
+func setupAPIStable(ctx context.Context, req *Request) (Check, func()) {
+	if req.Mode != ModeRefactor {
+		return nil, nil
+	}
+	if _, err := exec.LookPath("apidiff"); err != nil || req.WorkDir == "" || !isGoModule(req.WorkDir) {
+		return checkExportedDecls, nil
+	}
+	tmp, err := os.MkdirTemp("", "aidev-apidiff-")
+	if err != nil {
+		return checkExportedDecls, nil
+	}
+	cleanup := func() { os.RemoveAll(tmp) }
+
+	snapshots := make(map[string]string) // package pattern -> export data
+	for _, pkg := range targetPackages(req.Files) {
+		file := filepath.Join(tmp, fmt.Sprintf("%d.api", len(snapshots)))
+		if _, err := apidiff(ctx, req.WorkDir, "-w", file, pkg); err != nil {
+			// The package doesn't load as is; compare declarations.
+			cleanup()
+			return checkExportedDecls, nil
+		}
+		snapshots[pkg] = file
+	}
+
+	check := func(ctx context.Context, in *CheckInput) error {
+		if in.Staged {
+			return checkExportedDecls(ctx, in)
+		}
+		for pkg, before := range snapshots {
+			report, err := apidiff(ctx, in.WorkDir, before, pkg)
+			if err != nil {
+				return fmt.Errorf("apidiff %s: %w", pkg, err)
+			}
+			if report != "" {
+				return fmt.Errorf("the exported API of %s changed:\n%s", pkg, report)
+			}
+		}
+		return nil
+	}
+	return check, cleanup
+}
+
+// apidiff runs the apidiff tool in dir and returns its trimmed output.
+func apidiff(ctx context.Context, dir string, args ...string) (string, error) {
+	cmd := exec.CommandContext(ctx, "apidiff", args...)
+	cmd.Dir = dir
+	out, err := cmd.CombinedOutput()
+	report := strings.TrimSpace(string(out))
+	if err != nil && (report == "" || strings.Contains(report, "error")) {
+		return "", fmt.Errorf("%v: %s", err, report)
+	}
+	return report, nil
+}
+
+// targetPackages returns the package patterns ("./dir") of the Go files.
+func targetPackages(files []string) []string {
+	seen := make(map[string]bool)
+	var pkgs []string
+	for _, f := range files {
+		if !strings.HasSuffix(f, ".go") || strings.HasSuffix(f, "_test.go") {
+			continue
+		}
+		pkg := "./" + filepath.ToSlash(filepath.Dir(filepath.Clean(f)))
+		if pkg == "./." {
+			pkg = "."
+		}
+		if !seen[pkg] {
+			seen[pkg] = true
+			pkgs = append(pkgs, pkg)
+		}
+	}
+	sort.Strings(pkgs)
+	return pkgs
+}
+
+// checkExportedDecls compares the exported declarations of each written Go
+// file with the file before the request.
+func checkExportedDecls(ctx context.Context, in *CheckInput) error {
+	var changes []string
+	for path, content := range in.After {
+		if !strings.HasSuffix(path, ".go") || strings.HasSuffix(path, "_test.go") {
+			continue
+		}
+		before, after := exportedDecls(in.Before[path]), exportedDecls(content)
+		for name, sig := range before {
+			switch now, ok := after[name]; {
+			case !ok:
+				changes = append(changes, fmt.Sprintf("%s: %s removed", path, name))
+			case now != sig:
+				changes = append(changes, fmt.Sprintf("%s: %s changed from %s to %s", path, name, sig, now))
+			}
+		}
+		for name := range after {
+			if _, ok := before[name]; !ok {
+				changes = append(changes, fmt.Sprintf("%s: %s added", path, name))
+			}
+		}
+	}
+	if len(changes) > 0 {
+		sort.Strings(changes)
+		return fmt.Errorf("the exported API changed:\n- %s", strings.Join(changes, "\n- "))
+	}
+	return nil
+}
+
+// exportedDecls maps the exported top-level declarations of src to their
+// printed signatures. Struct types list only their exported fields.
+func exportedDecls(src string) map[string]string {
+	decls := make(map[string]string)
+	if src == "" {
+		return decls
+	}
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "", src, parser.SkipObjectResolution)
+	if err != nil {
+		return decls
+	}
+	show := func(node ast.Node) string {
+		var buf bytes.Buffer
+		printer.Fprint(&buf, fset, node)
+		return strings.Join(strings.Fields(buf.String()), " ")
+	}
+	for _, decl := range file.Decls {
+		switch d := decl.(type) {
+		case *ast.FuncDecl:
+			if !d.Name.IsExported() {
+				continue
+			}
+			name := "func " + d.Name.Name
+			if d.Recv != nil && len(d.Recv.List) > 0 {
+				recv := show(d.Recv.List[0].Type)
+				if !ast.IsExported(strings.TrimLeft(recv, "*")) {
+					continue
+				}
+				name = fmt.Sprintf("method (%s) %s", recv, d.Name.Name)
+			}
+			decls[name] = show(d.Type)
+		case *ast.GenDecl:
+			for _, spec := range d.Specs {
+				switch s := spec.(type) {
+				case *ast.TypeSpec:
+					if s.Name.IsExported() {
+						decls["type "+s.Name.Name] = show(exportedView(s.Type))
+					}
+				case *ast.ValueSpec:
+					for _, id := range s.Names {
+						if !id.IsExported() {
+							continue
+						}
+						sig := ""
+						if s.Type != nil {
+							sig = show(s.Type)
+						}
+						decls[d.Tok.String()+" "+id.Name] = sig
+					}
+				}
+			}
+		}
+	}
+	return decls
+}
+
+// exportedView drops the unexported fields of a struct type, which are
+// not part of the API.
+func exportedView(expr ast.Expr) ast.Expr {
+	st, ok := expr.(*ast.StructType)
+	if !ok {
+		return expr
+	}
+	fields := &ast.FieldList{}
+	for _, f := range st.Fields.List {
+		var names []*ast.Ident
+		for _, n := range f.Names {
+			if n.IsExported() {
+				names = append(names, n)
+			}
+		}
+		embedded := len(f.Names) == 0
+		if len(names) > 0 || embedded {
+			fields.List = append(fields.List, &ast.Field{Names: names, Type: f.Type})
+		}
+	}
+	return &ast.StructType{Fields: fields}
+}
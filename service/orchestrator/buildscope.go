@@ -0,0 +1,155 @@
+package orchestrator
+
+import (
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"ai-dev-agent/service/diagnose"
+)
+
+// buildScope narrows build verification to the packages an attempt could
+// have affected: the reverse-dependency closure of the files it edited.
+// It remembers the files as they were last verified and the packages that
+// failed then: the next attempt rebuilds the packages whose files changed
+// since, their importers and the failed packages, and skips the packages
+// that passed and weren't touched.
+type buildScope struct {
+	files  map[string]string // path -> content at the last verification
+	failed map[string]bool   // package directories that failed it
+	all    bool              // it failed without naming its packages
+}
+
+func newBuildScope() *buildScope {
+	return &buildScope{files: make(map[string]string)}
+}
+
+// patterns returns the package patterns to build for the candidate files
+// of an attempt, or nil to build every package.
+func (s *buildScope) patterns(e *Engine, workDir string, candidates map[string]string) []string {
+	if s.all || e.config.Dependents == nil || !isGoModule(workDir) {
+		return nil
+	}
+
+	dirs := make(map[string]bool)
+	for dir := range s.failed {
+		dirs[dir] = true
+	}
+	for _, path := range s.changed(e, candidates) {
+		if !strings.HasSuffix(path, ".go") {
+			return nil // go.mod, embedded files and the like affect any package
+		}
+		dir, ok := packageDir(workDir, path)
+		if !ok {
+			return nil
+		}
+		dirs[dir] = true
+	}
+	if len(dirs) == 0 {
+		return nil
+	}
+
+	list := make([]string, 0, len(dirs))
+	for dir := range dirs {
+		list = append(list, dir)
+	}
+	dependents, ok := e.config.Dependents(workDir, list)
+	if !ok {
+		return nil
+	}
+	for _, dir := range dependents {
+		dirs[dir] = true
+	}
+	return dirPatterns(dirs)
+}
+
+// changed returns the paths whose content differs from the last
+// verification. Paths written then but not by this attempt are compared
+// with what the workspace holds now.
+func (s *buildScope) changed(e *Engine, candidates map[string]string) []string {
+	var paths []string
+	for path, content := range candidates {
+		if was, ok := s.files[path]; !ok || was != content {
+			paths = append(paths, path)
+		}
+	}
+	for path, was := range s.files {
+		if _, ok := candidates[path]; ok {
+			continue
+		}
+		if now, err := e.file.ReadFile(path); err != nil || now != was {
+			paths = append(paths, path)
+		}
+	}
+	return paths
+}
+
+// record notes the outcome of verifying the candidate files of an attempt
+// in workDir.
+func (s *buildScope) record(workDir string, candidates map[string]string, verification *diagnose.VerificationResult) {
+	for path, content := range candidates {
+		s.files[path] = content
+	}
+	s.failed, s.all = nil, false
+	if verification == nil || verification.Passed() {
+		return
+	}
+	s.failed = make(map[string]bool)
+	for _, issue := range verification.Issues {
+		if issue.File == "" {
+			continue
+		}
+		if dir, ok := packageDir(workDir, issue.File); ok {
+			s.failed[dir] = true
+		}
+	}
+	s.all = len(s.failed) == 0
+}
+
+// Helper functions
+
+// packageDir returns the slash-separated directory of path relative to
+// workDir, and false if path lies outside it.
+func packageDir(workDir, path string) (string, bool) {
+	if filepath.IsAbs(path) {
+		rel, err := filepath.Rel(workDir, path)
+		if err != nil {
+			return "", false
+		}
+		path = rel
+	}
+	dir := filepath.ToSlash(filepath.Dir(filepath.Clean(path)))
+	if dir == ".." || strings.HasPrefix(dir, "../") {
+		return "", false
+	}
+	return dir, true
+}
+
+// dirPatterns turns package directories into build patterns. Each covers
+// its subdirectories too, so a directory inside another is dropped, and
+// the wildcard makes go skip directories without buildable files rather
+// than fail on them.
+func dirPatterns(dirs map[string]bool) []string {
+	list := make([]string, 0, len(dirs))
+	for dir := range dirs {
+		list = append(list, dir)
+	}
+	sort.Strings(list)
+
+	var patterns []string
+	var kept []string
+	for _, dir := range list {
+		if dir == "." {
+			return nil
+		}
+		covered := false
+		for _, k := range kept {
+			covered = covered || strings.HasPrefix(dir, k+"/")
+		}
+		if !covered {
+			kept = append(kept, dir)
+			patterns = append(patterns, "./"+dir+"/...")
+		}
+	}
+	return patterns
+}
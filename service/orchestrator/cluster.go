@@ -0,0 +1,185 @@
+package orchestrator
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"regexp"
+	"sort"
+	"strings"
+
+	"ai-dev-agent/service/errparse"
+)
+
+// batchThreshold is the error count above which a failed build is fed back
+// in batches instead of as one wall of errors.
+const batchThreshold = 10
+
+// batchSize bounds the errors of one batch; a cluster is never split.
+const batchSize = 10
+
+// symbolCausePatterns match errors whose root cause is one symbol's
+// definition, wherever its usages are.
+var symbolCausePatterns = []*regexp.Regexp{
+	regexp.MustCompile(`undefined: (\w+(?:\.\w+)?)`),
+	regexp.MustCompile(`(\w+) redeclared`),
+	regexp.MustCompile(`has no field or method (\w+)`),
+}
+
+// errorCluster is a group of build errors that likely share a cause.
+type errorCluster struct {
+	cause  string // symbol or file the errors share
+	file   string // file of the first error
+	symbol bool
+	errors []string
+	uses   int // errors elsewhere naming a declaration of file
+}
+
+// batchErrors clusters a build error by root cause and file and returns the
+// retry feedback for the first batch, with the remaining clusters listed
+// for later. Symbol clusters (a missing or duplicate definition) come
+// first, then files ordered so that definitions precede their usages. It
+// returns "" when the error is small enough to send whole.
+func batchErrors(msg string, files map[string]string) string {
+	clusters, total := clusterErrors(msg)
+	if total <= batchThreshold || len(clusters) < 2 {
+		return ""
+	}
+	orderClusters(clusters, files)
+
+	n := 0
+	batch := 0
+	for batch < len(clusters) && (batch == 0 || n+len(clusters[batch].errors) <= batchSize) {
+		n += len(clusters[batch].errors)
+		batch++
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "The build failed with %d errors in %d groups that likely share a cause. "+
+		"Fix this batch first, definitions before their usages; later errors may go away with it:\n", total, len(clusters))
+	for _, c := range clusters[:batch] {
+		sb.WriteString(strings.Join(c.errors, "\n"))
+		sb.WriteString("\n")
+	}
+	if batch < len(clusters) {
+		sb.WriteString("\nStill failing, to fix afterwards:")
+		for _, c := range clusters[batch:] {
+			fmt.Fprintf(&sb, "\n- %s (%d errors)", c.cause, len(c.errors))
+		}
+	}
+	return sb.String()
+}
+
+// clusterErrors groups the error lines of msg by shared symbol, else by
+// file, in order of first appearance, and counts the errors.
+func clusterErrors(msg string) ([]*errorCluster, int) {
+	var clusters []*errorCluster
+	byCause := make(map[string]*errorCluster)
+	diags := errparse.Parse(msg)
+	for _, d := range diags {
+		cause, symbol := d.File, false
+		for _, p := range symbolCausePatterns {
+			if s := p.FindStringSubmatch(d.Message); s != nil {
+				cause, symbol = s[1], true
+				break
+			}
+		}
+		c, ok := byCause[cause]
+		if !ok {
+			c = &errorCluster{cause: cause, file: d.File, symbol: symbol}
+			byCause[cause] = c
+			clusters = append(clusters, c)
+		}
+		c.errors = append(c.errors, formatDiagnostic(d))
+	}
+	return clusters, len(diags)
+}
+
+// orderClusters puts symbol clusters first, then file clusters whose
+// declarations the other errors mention most.
+func orderClusters(clusters []*errorCluster, files map[string]string) {
+	for _, c := range clusters {
+		if c.symbol {
+			continue
+		}
+		names := declaredNames(sourceOf(c.file, files))
+		for _, other := range clusters {
+			if other == c {
+				continue
+			}
+			for _, e := range other.errors {
+				for _, name := range names {
+					if strings.Contains(e, name) {
+						c.uses++
+						break
+					}
+				}
+			}
+		}
+	}
+	sort.SliceStable(clusters, func(i, j int) bool {
+		if clusters[i].symbol != clusters[j].symbol {
+			return clusters[i].symbol
+		}
+		return clusters[i].uses > clusters[j].uses
+	})
+}
+
+// Helper functions
+
+// formatDiagnostic renders a diagnostic with its notes indented below.
+func formatDiagnostic(d errparse.Diagnostic) string {
+	s := d.String()
+	for _, note := range d.Notes {
+		s += "\n\t" + note
+	}
+	return s
+}
+
+// sourceOf finds the content of an error's file among the request files,
+// which may be named relative to another directory.
+func sourceOf(file string, files map[string]string) string {
+	for path, content := range files {
+		if errparse.SameFile(file, path) {
+			return content
+		}
+	}
+	return ""
+}
+
+// declaredNames returns the top-level names src declares, skipping short
+// ones that would match by accident.
+func declaredNames(src string) []string {
+	if src == "" {
+		return nil
+	}
+	file, _ := parser.ParseFile(token.NewFileSet(), "", src, parser.SkipObjectResolution)
+	if file == nil {
+		return nil
+	}
+	var names []string
+	add := func(id *ast.Ident) {
+		if id != nil && len(id.Name) > 2 && id.Name != "_" {
+			names = append(names, id.Name)
+		}
+	}
+	for _, decl := range file.Decls {
+		switch d := decl.(type) {
+		case *ast.FuncDecl:
+			add(d.Name)
+		case *ast.GenDecl:
+			for _, spec := range d.Specs {
+				switch s := spec.(type) {
+				case *ast.TypeSpec:
+					add(s.Name)
+				case *ast.ValueSpec:
+					for _, id := range s.Names {
+						add(id)
+					}
+				}
+			}
+		}
+	}
+	return names
+}
@@ -0,0 +1,149 @@
+package orchestrator
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"ai-dev-agent/service/deps"
+)
+
+// CheckInput is what a post-write check sees of an attempt.
+type CheckInput struct {
+	Request *Request
+	WorkDir string
+	Before  map[string]string // target files before the request
+	After   map[string]string // files the attempt wrote
+	Staged  bool              // After is staged, not yet in WorkDir
+	// MaxDiffMultiple is Config.MaxDiffMultiple.
+	MaxDiffMultiple float64
+}
+
+// Check inspects an attempt's files before build verification. An error
+// rejects the attempt and is fed back to the model.
+type Check func(ctx context.Context, in *CheckInput) error
+
+// Preset is a named constraint: prompt text plus, where feasible, a check
+// that enforces it.
+type Preset struct {
+	Text  string
+	Check Check
+	// Setup prepares a check for one request, e.g. by snapshotting state
+	// before anything is written. A nil check skips it; cleanup may be nil.
+	Setup func(ctx context.Context, req *Request) (check Check, cleanup func())
+	// NoDependencies keeps Config.Dependencies from adding modules.
+	NoDependencies bool
+}
+
+// Presets are the built-in constraints, usable by name wherever a
+// constraint is accepted.
+var Presets = map[string]Preset{
+	"api-stable": {
+		Text:  "Keep the exported API unchanged: do not add, remove, rename or change the signature of exported identifiers",
+		Setup: setupAPIStable,
+	},
+	"no-deps": {
+		Text:           "Do not add dependencies: import only the standard library and packages the files already import",
+		Check:          checkNoNewImports,
+		NoDependencies: true,
+	},
+	"minimal-diff": {
+		Text:  "Make the smallest change that does the job: do not reformat, reorder or rewrite unrelated code",
+		Check: checkMinimalDiff,
+	},
+}
+
+// PresetNames returns the preset names, sorted.
+func PresetNames() []string {
+	names := make([]string, 0, len(Presets))
+	for name := range Presets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// constraintSet is a request's resolved constraints.
+type constraintSet struct {
+	texts  []string
+	checks []Check
+	setups []func(ctx context.Context, req *Request) (Check, func())
+	noDeps bool
+}
+
+// resolveConstraints expands preset names; anything else is free text
+// for the prompt.
+func resolveConstraints(constraints []string) constraintSet {
+	var set constraintSet
+	seen := make(map[string]bool)
+	for _, c := range constraints {
+		c = strings.TrimSpace(c)
+		if c == "" || seen[c] {
+			continue
+		}
+		seen[c] = true
+		p, ok := Presets[c]
+		if !ok {
+			set.texts = append(set.texts, c)
+			continue
+		}
+		set.texts = append(set.texts, p.Text)
+		if p.Check != nil {
+			set.checks = append(set.checks, p.Check)
+		}
+		if p.Setup != nil {
+			set.setups = append(set.setups, p.Setup)
+		}
+		set.noDeps = set.noDeps || p.NoDependencies
+	}
+	return set
+}
+
+// setup prepares the request's checks and returns a function releasing
+// what they hold.
+func (s *constraintSet) setup(ctx context.Context, req *Request) func() {
+	var cleanups []func()
+	for _, setup := range s.setups {
+		check, cleanup := setup(ctx, req)
+		if check != nil {
+			s.checks = append(s.checks, check)
+		}
+		if cleanup != nil {
+			cleanups = append(cleanups, cleanup)
+		}
+	}
+	return func() {
+		for _, cleanup := range cleanups {
+			cleanup()
+		}
+	}
+}
+
+// runChecks runs the checks in order and returns the first failure.
+func (s constraintSet) runChecks(ctx context.Context, in *CheckInput) error {
+	for _, check := range s.checks {
+		if err := check(ctx, in); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkNoNewImports rejects files importing a third-party package that
+// the module doesn't require yet. Outside a Go module there is nothing to
+// check.
+func checkNoNewImports(ctx context.Context, in *CheckInput) error {
+	missing, err := deps.MissingImports(in.WorkDir, in.After)
+	if err != nil {
+		if errors.Is(err, deps.ErrNoModule) {
+			return nil
+		}
+		return err
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("new dependencies are not allowed: %s", strings.Join(missing, ", "))
+	}
+	return nil
+}
@@ -3,10 +3,21 @@ package orchestrator
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"os"
+	"path/filepath"
 	"regexp"
+	"sort"
 	"strings"
 	"time"
+
+	"ai-dev-agent/service/astmerge"
+	"ai-dev-agent/service/deps"
+	"ai-dev-agent/service/diagnose"
+	"ai-dev-agent/service/errparse"
+	"ai-dev-agent/service/fence"
+	"ai-dev-agent/service/vision"
 )
 
 // Interfaces
@@ -20,15 +31,20 @@ type PromptService interface {
 	SetMode(mode string) PromptService
 	SetInstruction(instruction string) PromptService
 	AddFile(path, content string, isMain bool) PromptService
-	Build() (string, error)
+	AddConstraint(constraint string) PromptService
+	Build() ([]Message, error)
 }
 
+// LLMService sends a conversation to the model and returns its answer.
+// Single-prompt callers can use UserPrompt or TextChatter.
 type LLMService interface {
-	Chat(ctx context.Context, prompt string) (string, error)
+	Chat(ctx context.Context, messages []Message) (string, error)
 }
 
+// CommandService runs a program in a directory. Arguments are passed as
+// given, never through a shell.
 type CommandService interface {
-	ExecuteInDir(ctx context.Context, command, dir string) (int, string, string, error)
+	ExecuteInDir(ctx context.Context, dir, name string, args ...string) (*diagnose.VerificationResult, error)
 }
 
 type Logger interface {
@@ -44,33 +60,152 @@ const (
 	ModeRefactor Mode = "refactor"
 	ModeFix      Mode = "fix"
 	ModeGenerate Mode = "generate"
+	ModeExplain  Mode = "explain"
+	ModeReview   Mode = "review"
+	ModeTest     Mode = "test"
 )
 
+// ReadOnly reports whether the mode only analyzes code and never writes.
+func (m Mode) ReadOnly() bool {
+	return m == ModeExplain || m == ModeReview
+}
+
 type Config struct {
 	MaxRetries  int
 	BuildVerify bool
 	Logger      Logger
+	// StagingDir enables two-phase apply: candidate files are written
+	// there, verified in a copy of the workspace (or through a Go build
+	// overlay for Go modules), and only synced to the workspace once
+	// verification passes.
+	StagingDir string
+	// DryRun stages and verifies candidates but never applies them; the
+	// final candidates are returned in Result.Candidates.
+	DryRun bool
+	// Dependencies, when set, is given the candidate files before build
+	// verification so that newly imported modules can be added first, to
+	// modFile and the go.sum beside it. Staged, these are copies in the
+	// stage, applied with the rest of the attempt once it is verified.
+	Dependencies func(ctx context.Context, workDir, modFile string, files map[string]string) error
+	// Dependents, when set, returns the package directories of workDir
+	// (relative, slash-separated) that import any of dirs, directly or
+	// not. Build verification then covers only the packages an attempt
+	// could affect; unset, or when it reports false, every package is
+	// built.
+	Dependents func(workDir string, dirs []string) ([]string, bool)
+	// Compress, when set, condenses the context files of a request (for
+	// example to summaries) before they are added to the prompt.
+	Compress func(ctx context.Context, files map[string]string) (map[string]string, error)
+	// WriteExtensions lists the extensions of files the model may create
+	// beyond the request's targets; nil means DefaultWriteExtensions.
+	WriteExtensions []string
+	// MaxWriteFiles and MaxWriteBytes cap what one attempt may write; a
+	// response over either is rejected and retried. Zero uses the default.
+	MaxWriteFiles int
+	MaxWriteBytes int
+	// MaxFeedbackTokens bounds the build output quoted in a retry prompt;
+	// longer output is condensed to its errors and summary. Zero uses the
+	// default.
+	MaxFeedbackTokens int
+	// MaxDiffMultiple is how many times the expected change the
+	// minimal-diff constraint allows. Zero uses the default.
+	MaxDiffMultiple float64
+	// PreserveComments merges each rewritten Go file with its original:
+	// unchanged declarations keep their original text and dropped doc
+	// comments are restored.
+	PreserveComments bool
+	// FormatGo gofmts the blocks written to Go files (unless the file
+	// isn't gofmt'ed already) and rejects blocks that don't parse before
+	// anything is written. With a StreamingLLM, blocks are formatted while
+	// the response streams.
+	FormatGo bool
+	// RunTests runs the tests once the build passes: first those of the
+	// affected packages, narrowed to the tests named after the symbols the
+	// attempt changed, and the whole suite only when they pass. A failing
+	// test fails the attempt like a build error.
+	RunTests bool
+	// EnvMatrix lists variables and the values build verification is
+	// also run under once the plain build passes, e.g. CGO_ENABLED: [0, 1]
+	// and GOOS: [linux, darwin]: every combination builds the affected
+	// packages, and the first to fail fails the attempt. It needs a
+	// CommandService that is an EnvCommandService.
+	EnvMatrix map[string][]string
+	// MutationTesting checks generated tests against mutants of the
+	// functions they test, each with one operator flipped, and gives the
+	// mutants they miss to one more round of generation.
+	MutationTesting bool
+	// Layering are rules on which packages may import which, e.g.
+	// "service/* must not import cmd/*". They are constraints of every
+	// request that writes, and an attempt adding an import one forbids is
+	// rejected.
+	Layering []deps.Rule
+	// ReviewPolicy sets the severity of review findings; it is given to
+	// the reviewer and applied to the findings it reports.
+	ReviewPolicy ReviewPolicy
+	// Events, when set, receives typed progress events as they happen. It
+	// is called from the goroutine running Execute.
+	Events func(Event)
+	// Refusals are checked along with DefaultRefusals before any file is
+	// sent to the LLM; a match stops the request.
+	Refusals Refusals
 }
 
+// Default write limits per attempt.
+const (
+	DefaultMaxWriteFiles = 20
+	DefaultMaxWriteBytes = 1 << 20
+)
+
+// DefaultMaxFeedbackTokens is the default retry feedback budget.
+const DefaultMaxFeedbackTokens = 1000
+
 func DefaultConfig() Config {
-	return Config{MaxRetries: 3, BuildVerify: true, Logger: &defaultLogger{}}
+	return Config{MaxRetries: 3, BuildVerify: true, Logger: &defaultLogger{}, MaxWriteFiles: DefaultMaxWriteFiles, MaxWriteBytes: DefaultMaxWriteBytes}
 }
 
 type Request struct {
 	Mode        Mode
 	Files       []string
+	Context     []string // reference files, included but never written
 	Instruction string
 	WorkDir     string
+	// Lines holds error locations by target file. A fix request with them
+	// sends only the enclosing declarations of Go files.
+	Lines map[string][]int
+	// Constraints are preset names (see Presets) or free text for the
+	// prompt; presets may also check the written files.
+	Constraints []string
+	// Images, such as design mockups, are sent with the prompt to vision
+	// models.
+	Images []*vision.Image
+	// Roots are the further workspaces of a multi-root request, by name:
+	// a path whose first element is a root's name lies in that root. The
+	// FileService resolves such paths; each root a file is written to is
+	// build-verified after WorkDir.
+	Roots map[string]string
 }
 
 type Result struct {
-	Success      bool
-	FilesWritten []string
-	Output       string
-	Explanation  string
-	Attempts     int
-	Duration     time.Duration
-	Error        error
+	Success       bool
+	FilesWritten  []string
+	Candidates    map[string]string              // dry-run output, by workspace-relative path
+	Output        string
+	Explanation   string
+	Attempts      int
+	History       []AttemptRecord                // failed attempts, oldest first
+	Verifications []*diagnose.VerificationResult // build verifications, in order
+	Findings      []Finding                      // review findings, in order
+	Mutation      *MutationReport                // mutants the generated tests ran against
+	Duration      time.Duration
+	Error         error
+}
+
+// AttemptRecord describes a failed attempt.
+type AttemptRecord struct {
+	Attempt int
+	Stage   string // read, prompt, llm, parse, limit, write, check, build, test, coverage, mutation
+	Error   string
+	Files   map[string]string // the attempt's output by path, if it got that far
 }
 
 type CodeBlock struct {
@@ -89,7 +224,7 @@ type Engine struct {
 }
 
 func NewEngine(file FileService, prompt PromptService, llm LLMService, exec CommandService, config Config) *Engine {
-	return &Engine{file: file, prompt: prompt, llm: llm, exec: exec, config: config}
+	return &Engine{file: guardedFiles{file}, prompt: prompt, llm: llm, exec: exec, config: config}
 }
 
 func (e *Engine) Execute(ctx context.Context, req *Request) *Result {
@@ -97,31 +232,74 @@ func (e *Engine) Execute(ctx context.Context, req *Request) *Result {
 	result := &Result{Attempts: 0}
 
 	e.logInfo("Starting %s operation on %d file(s)", req.Mode, len(req.Files))
+	e.emit(Event{Type: EventStart, Mode: req.Mode, Files: req.Files})
+	defer func() {
+		ev := Event{Type: EventDone, Mode: req.Mode, Attempt: result.Attempts, Files: result.FilesWritten, DurationMs: result.Duration.Milliseconds(), Success: result.Success}
+		if result.Error != nil {
+			ev.Error = result.Error.Error()
+		}
+		e.emit(ev)
+	}()
 
+	contextFiles, err := e.readContext(ctx, req.Context)
+	if err != nil {
+		result.Error = fmt.Errorf("read context: %w", err)
+		result.Duration = time.Since(start)
+		return result
+	}
+
+	var output []CodeBlock // of the current attempt
+	fail := func(stage string, err error) {
+		result.Error = err
+		result.History = append(result.History, AttemptRecord{Attempt: result.Attempts, Stage: stage, Error: err.Error(), Files: blockFiles(req.Files, output)})
+		e.emit(Event{Type: EventFailure, Attempt: result.Attempts, Stage: stage, Error: err.Error()})
+	}
+
+	constraints := e.constraints(req)
+	defer constraints.setup(ctx, req)()
+	var original map[string]string
+	lines := req.Lines
+	scope := newBuildScope()
 	for attempt := 1; attempt <= e.config.MaxRetries; attempt++ {
 		result.Attempts = attempt
+		output = nil
 		e.logInfo("Attempt %d/%d", attempt, e.config.MaxRetries)
+		e.emit(Event{Type: EventAttempt, Attempt: attempt})
 
 		// Read files
 		fileContents, err := e.readFiles(req.Files)
 		if err != nil {
-			result.Error = fmt.Errorf("read files: %w", err)
+			fail("read", fmt.Errorf("read files: %w", err))
 			e.logError("Failed to read files: %v", err)
+			if errors.Is(err, ErrRefused) {
+				break
+			}
 			continue
 		}
+		if original == nil {
+			original = fileContents
+		}
 
 		// Build prompt
-		prompt, err := e.buildPrompt(req, fileContents)
+		attemptReq := *req
+		attemptReq.Instruction = retryInstruction(req.Instruction, result.History, fileContents, e.feedbackBytes())
+		promptFiles := fileContents
+		cut := e.excerpts(req, fileContents, lines)
+		if cut != nil {
+			promptFiles = cut.rendered
+			attemptReq.Instruction += cut.instruction()
+		}
+		messages, err := e.buildPrompt(&attemptReq, promptFiles, contextFiles)
 		if err != nil {
-			result.Error = fmt.Errorf("build prompt: %w", err)
+			fail("prompt", fmt.Errorf("build prompt: %w", err))
 			e.logError("Failed to build prompt: %v", err)
 			continue
 		}
 
 		// Call LLM
-		response, err := e.llm.Chat(ctx, prompt)
+		response, prep, err := e.chat(ctx, messages)
 		if err != nil {
-			result.Error = fmt.Errorf("LLM call: %w", err)
+			fail("llm", fmt.Errorf("LLM call: %w", err))
 			e.logError("LLM call failed: %v", err)
 			if !e.isRetryable(err) {
 				break
@@ -129,34 +307,173 @@ func (e *Engine) Execute(ctx context.Context, req *Request) *Result {
 			continue
 		}
 		e.logInfo("LLM response received (%d chars)", len(response))
+		e.emit(Event{Type: EventResponse, Attempt: attempt, Chars: len(response)})
+
+		if req.Mode.ReadOnly() {
+			result.Success = true
+			result.Output = response
+			result.Explanation = e.extractExplanation(response)
+			result.Error = nil
+			if req.Mode == ModeReview {
+				result.Findings = e.config.ReviewPolicy.Apply(ParseFindings(response))
+				for i := range result.Findings {
+					e.emit(Event{Type: EventFinding, Finding: &result.Findings[i]})
+				}
+			}
+			break
+		}
 
 		// Parse code blocks
 		codeBlocks := e.parseCodeBlocks(response)
 		if len(codeBlocks) == 0 {
-			result.Error = fmt.Errorf("no code blocks found in response")
+			fail("parse", fmt.Errorf("no code blocks found in response"))
 			e.logError("No code blocks found")
 			continue
 		}
 		e.logInfo("Parsed %d code block(s)", len(codeBlocks))
+		output = codeBlocks
+		if cut != nil {
+			if codeBlocks, err = cut.splice(req.Files, codeBlocks); err != nil {
+				fail("parse", err)
+				e.logError("Failed to splice excerpts: %v", err)
+				continue
+			}
+			output = codeBlocks
+		}
+		if e.config.PreserveComments {
+			e.preserveComments(req.Files, fileContents, codeBlocks)
+		}
+		if e.config.FormatGo {
+			if err := e.formatGo(req.Files, fileContents, codeBlocks, prep); err != nil {
+				fail("parse", fmt.Errorf("syntax error: %w", err))
+				e.logError("Response rejected: %v", err)
+				continue
+			}
+		}
+		if err := checkReadOnly(req, codeBlocks); err != nil {
+			fail("limit", err)
+			e.logError("Response rejected: %v", err)
+			continue
+		}
+		if err := e.checkWriteLimits(req.Files, codeBlocks); err != nil {
+			fail("limit", err)
+			e.logError("Response rejected: %v", err)
+			continue
+		}
 
-		// Write files
-		written, err := e.writeFiles(req.Files, codeBlocks)
+		// Write files (or stage them for verification first)
+		var st *stage
+		var written []string
+		if e.staged() && req.WorkDir != "" {
+			st, err = newStage(e.stagingDir())
+			if err == nil {
+				written, err = e.stageFiles(st, req.WorkDir, req.Files, codeBlocks)
+			}
+		} else {
+			written, err = e.writeFiles(req.Files, codeBlocks)
+		}
 		if err != nil {
-			result.Error = fmt.Errorf("write files: %w", err)
+			if st != nil {
+				st.discard()
+			}
+			fail("write", fmt.Errorf("write files: %w", err))
 			e.logError("Failed to write files: %v", err)
 			continue
 		}
-		result.FilesWritten = written
+		if st == nil {
+			result.FilesWritten = written
+		}
+
+		// Enforce the request's constraints
+		if len(constraints.checks) > 0 {
+			in := &CheckInput{Request: req, WorkDir: req.WorkDir, Before: original, After: e.candidates(st, written), Staged: st != nil, MaxDiffMultiple: e.config.MaxDiffMultiple}
+			if err := constraints.runChecks(ctx, in); err != nil {
+				if st != nil {
+					st.discard()
+				}
+				fail("check", err)
+				e.logError("Constraint check failed: %v", err)
+				continue
+			}
+		}
+
+		// Add new dependencies
+		if e.config.Dependencies != nil && req.WorkDir != "" && !constraints.noDeps {
+			if err := e.addDependencies(ctx, req.WorkDir, st, written); err != nil {
+				e.logError("Dependency check failed: %v", err)
+			}
+		}
 
 		// Verify build
 		if e.config.BuildVerify && req.WorkDir != "" {
-			if err := e.verifyBuild(ctx, req.WorkDir); err != nil {
-				result.Error = fmt.Errorf("build failed: %w", err)
+			verifyDir, overlay := req.WorkDir, ""
+			if st != nil {
+				if isGoModule(req.WorkDir) {
+					overlay, err = st.overlay(req.WorkDir)
+				} else {
+					verifyDir, err = st.tree(req.WorkDir)
+				}
+				if err != nil {
+					st.discard()
+					result.Error = fmt.Errorf("staging: %w", err)
+					e.logError("Failed to prepare staging area: %v", err)
+					break
+				}
+			}
+			candidates := e.candidates(st, written)
+			var patterns []string
+			if len(req.Roots) == 0 {
+				patterns = scope.patterns(e, req.WorkDir, candidates)
+			}
+			verification, err := e.verifyBuild(ctx, attempt, verifyDir, overlay, patterns, result)
+			if verification != nil {
+				scope.record(verifyDir, candidates, verification)
+			}
+			if err == nil && st == nil {
+				err = e.verifyRoots(ctx, attempt, req, written, result)
+			}
+			if err == nil {
+				err = e.verifyMatrix(ctx, attempt, verifyDir, overlay, patterns, result)
+			}
+			if err != nil {
+				if st != nil {
+					st.discard()
+				}
+				fail("build", fmt.Errorf("build failed: %w", err))
 				e.logError("Build verification failed: %v", err)
-				req.Instruction = e.appendBuildError(req.Instruction, err)
+				// Line numbers shift with edits; follow the new errors.
+				if len(lines) > 0 {
+					lines = errorLines(err.Error(), req.Files)
+				}
 				continue
 			}
 			e.logInfo("Build verification passed")
+
+			if e.config.RunTests {
+				if err := e.verifyTests(ctx, attempt, verifyDir, overlay, patterns, changedSymbols(original, candidates), result); err != nil {
+					if st != nil {
+						st.discard()
+					}
+					fail("test", fmt.Errorf("tests failed: %w", err))
+					e.logError("Tests failed: %v", err)
+					continue
+				}
+				e.logInfo("Tests passed")
+			}
+		}
+
+		if st != nil && e.config.DryRun {
+			result.Candidates = st.files
+			st.discard()
+		} else if st != nil {
+			err := e.applyStage(st)
+			st.discard()
+			if err != nil {
+				result.Error = fmt.Errorf("apply staged files: %w", err)
+				e.logError("Failed to apply staged files: %v", err)
+				break
+			}
+			result.FilesWritten = written
 		}
 
 		result.Success = true
@@ -170,6 +487,8 @@ func (e *Engine) Execute(ctx context.Context, req *Request) *Result {
 	return result
 }
 
+// readFiles reads files to send to the LLM, refusing any that match a
+// refusal rule.
 func (e *Engine) readFiles(files []string) (map[string]string, error) {
 	contents := make(map[string]string)
 	for _, path := range files {
@@ -177,42 +496,150 @@ func (e *Engine) readFiles(files []string) (map[string]string, error) {
 		if err != nil {
 			return nil, fmt.Errorf("%s: %w", path, err)
 		}
+		if err := e.screen(path, content); err != nil {
+			return nil, err
+		}
 		contents[path] = content
 	}
 	return contents, nil
 }
 
-func (e *Engine) buildPrompt(req *Request, files map[string]string) (string, error) {
+// screen checks a file against DefaultRefusals and the configured rules.
+func (e *Engine) screen(path, content string) error {
+	if err := DefaultRefusals.Check(path, content); err != nil {
+		return err
+	}
+	return e.config.Refusals.Check(path, content)
+}
+
+func (e *Engine) buildPrompt(req *Request, files, contextFiles map[string]string) ([]Message, error) {
 	builder := e.prompt.SetMode(string(req.Mode)).SetInstruction(req.Instruction)
 	for path, content := range files {
 		builder = builder.AddFile(path, content, true)
 	}
-	return builder.Build()
+	for path, content := range contextFiles {
+		builder = builder.AddFile(path, content, false)
+	}
+	for _, c := range e.constraints(req).texts {
+		builder = builder.AddConstraint(c)
+	}
+	if req.Mode == ModeReview && len(e.config.ReviewPolicy) > 0 {
+		builder = builder.AddConstraint(e.config.ReviewPolicy.Prompt())
+	}
+	messages, err := builder.Build()
+	if err != nil {
+		return nil, err
+	}
+	return withImages(req.Images, messages), nil
+}
+
+// readContext reads the context files once per request and compresses
+// them when a compressor is configured.
+func (e *Engine) readContext(ctx context.Context, paths []string) (map[string]string, error) {
+	if len(paths) == 0 {
+		return nil, nil
+	}
+	files, err := e.readFiles(paths)
+	if err != nil {
+		return nil, err
+	}
+	if e.config.Compress == nil {
+		return files, nil
+	}
+	compressed, err := e.config.Compress(ctx, files)
+	if err != nil {
+		e.logError("Context compression incomplete: %v", err)
+	}
+	if compressed == nil {
+		return files, nil
+	}
+	e.logInfo("Context: %d file(s), %d → %d bytes", len(files), totalSize(files), totalSize(compressed))
+	return compressed, nil
 }
 
+// parseCodeBlocks returns the fenced blocks of a response. Fences nest by
+// length, so a markdown file in a ```` block keeps its ``` examples; a block
+// cut off by the end of the response is dropped.
 func (e *Engine) parseCodeBlocks(response string) []CodeBlock {
 	blocks := []CodeBlock{}
-	re := regexp.MustCompile("```(\\w*)\n?([\\s\\S]*?)```")
-	matches := re.FindAllStringSubmatch(response, -1)
-
-	for _, match := range matches {
-		code := strings.TrimSpace(match[2])
+	prev := 0
+	for _, b := range fence.Parse(response) {
+		if !b.Closed {
+			break
+		}
+		code := strings.TrimSpace(b.Code)
 		if code != "" {
-			blocks = append(blocks, CodeBlock{Language: match[1], Code: code})
+			blocks = append(blocks, CodeBlock{Language: b.Lang, Code: code, Filename: fileHeader(response[prev:b.Start])})
 		}
+		prev = b.End
 	}
 	return blocks
 }
 
+// preserveComments merges the blocks for Go targets with the files' current
+// content. A block that can't be merged is kept as is.
+func (e *Engine) preserveComments(files []string, contents map[string]string, blocks []CodeBlock) {
+	for i := range blocks {
+		if i >= len(files) || !strings.HasSuffix(files[i], ".go") || contents[files[i]] == "" {
+			continue
+		}
+		merged, err := astmerge.Merge(contents[files[i]], blocks[i].Code)
+		if err != nil {
+			e.logError("Keeping %s as returned: %v", files[i], err)
+			continue
+		}
+		blocks[i].Code = merged
+	}
+}
+
+var fileHeaderPattern = regexp.MustCompile(`(?m)^--- FILE: (\S+)(?: \(.*\))? ---\s*$`)
+
+// fileHeader returns the path of a "--- FILE: path ---" header, as the
+// prompt labels files, that the model put right before a code block.
+func fileHeader(text string) string {
+	text = strings.TrimSpace(text)
+	m := fileHeaderPattern.FindAllStringSubmatchIndex(text, -1)
+	if len(m) == 0 || m[len(m)-1][1] != len(text) {
+		return ""
+	}
+	last := m[len(m)-1]
+	return text[last[2]:last[3]]
+}
+
+// checkWriteLimits rejects a response that would write more files or bytes
+// than the configured limits.
+func (e *Engine) checkWriteLimits(files []string, blocks []CodeBlock) error {
+	maxFiles, maxBytes := e.config.MaxWriteFiles, e.config.MaxWriteBytes
+	if maxFiles <= 0 {
+		maxFiles = DefaultMaxWriteFiles
+	}
+	if maxBytes <= 0 {
+		maxBytes = DefaultMaxWriteBytes
+	}
+	count, size := 0, 0
+	for i, block := range blocks {
+		if i < len(files) || block.Filename != "" {
+			count++
+			size += len(block.Code)
+		}
+	}
+	if count > maxFiles {
+		return fmt.Errorf("%d files exceed the limit of %d per response", count, maxFiles)
+	}
+	if size > maxBytes {
+		return fmt.Errorf("%d bytes exceed the limit of %d per response", size, maxBytes)
+	}
+	return nil
+}
+
 func (e *Engine) writeFiles(files []string, blocks []CodeBlock) ([]string, error) {
 	written := []string{}
 	for i, block := range blocks {
-		var targetPath string
-		if i < len(files) {
-			targetPath = files[i]
-		} else if block.Filename != "" {
-			targetPath = block.Filename
-		} else {
+		targetPath, err := e.blockTarget(i, files, block)
+		if err != nil {
+			return written, err
+		}
+		if targetPath == "" {
 			continue
 		}
 		if err := e.file.WriteFile(targetPath, block.Code); err != nil {
@@ -220,28 +647,237 @@ func (e *Engine) writeFiles(files []string, blocks []CodeBlock) ([]string, error
 		}
 		written = append(written, targetPath)
 		e.logInfo("Wrote: %s", targetPath)
+		e.emit(Event{Type: EventWrite, File: targetPath})
 	}
 	return written, nil
 }
 
-func (e *Engine) verifyBuild(ctx context.Context, workDir string) error {
-	exitCode, _, stderr, err := e.exec.ExecuteInDir(ctx, "go build ./...", workDir)
-	if err != nil {
-		return err
+// blockFiles maps the code blocks of a response to the files they are
+// written to, skipping blocks that name none.
+func blockFiles(files []string, blocks []CodeBlock) map[string]string {
+	if len(blocks) == 0 {
+		return nil
+	}
+	out := make(map[string]string, len(blocks))
+	for i, block := range blocks {
+		target := block.Filename
+		if i < len(files) {
+			target = files[i]
+		}
+		if target != "" {
+			out[target] = block.Code
+		}
 	}
-	if exitCode != 0 {
-		return fmt.Errorf("%s", stderr)
+	return out
+}
+
+// verifyBuild builds the packages matching patterns in workDir, or all of
+// them when patterns is empty. A build scoped to patterns also compiles
+// the packages' tests, which is cheap for the few packages an attempt
+// affects, unless RunTests runs them anyway. The last verification run is
+// returned.
+func (e *Engine) verifyBuild(ctx context.Context, attempt int, workDir, overlay string, patterns []string, result *Result) (*diagnose.VerificationResult, error) {
+	commands := [][]string{{"build"}}
+	if len(patterns) == 0 {
+		patterns = []string{"./..."}
+	} else if !e.config.RunTests {
+		commands = append(commands, []string{"test", "-run=^$"})
+	}
+
+	var last *diagnose.VerificationResult
+	for _, args := range commands {
+		if overlay != "" {
+			args = append(args, "-overlay="+overlay)
+		}
+		verification, err := e.runVerification(ctx, attempt, workDir, append(args, patterns...), result)
+		if verification != nil {
+			last = verification
+		}
+		if err != nil {
+			return last, err
+		}
+	}
+	return last, nil
+}
+
+// verifyRoots builds each further root of req that a file was written to.
+func (e *Engine) verifyRoots(ctx context.Context, attempt int, req *Request, written []string, result *Result) error {
+	seen := make(map[string]bool)
+	var names []string
+	for _, path := range written {
+		name, _, _ := strings.Cut(filepath.ToSlash(path), "/")
+		if _, ok := req.Roots[name]; ok && !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if _, err := e.verifyBuild(ctx, attempt, req.Roots[name], "", nil, result); err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
 	}
 	return nil
 }
 
-func (e *Engine) appendBuildError(instruction string, buildErr error) string {
-	return fmt.Sprintf("%s\n\nPrevious attempt failed:\n%s\nPlease fix the code.", instruction, buildErr.Error())
+// runVerification runs go with args in workDir, adds its verification to
+// result and reports it. The error is the command's failure, if any.
+func (e *Engine) runVerification(ctx context.Context, attempt int, workDir string, args []string, result *Result) (*diagnose.VerificationResult, error) {
+	return e.runVerificationEnv(ctx, attempt, workDir, nil, args, result)
+}
+
+// runVerificationEnv is runVerification with env set over the command's
+// environment, which its verification names.
+func (e *Engine) runVerificationEnv(ctx context.Context, attempt int, workDir string, env map[string]string, args []string, result *Result) (*diagnose.VerificationResult, error) {
+	var verification *diagnose.VerificationResult
+	var err error
+	if exec, ok := e.exec.(EnvCommandService); ok && len(env) > 0 {
+		verification, err = exec.ExecuteInDirEnv(ctx, env, workDir, "go", args...)
+		if verification != nil {
+			verification.Command = FormatEnv(env) + " " + verification.Command
+		}
+	} else {
+		verification, err = e.exec.ExecuteInDir(ctx, workDir, "go", args...)
+	}
+	if verification == nil {
+		return nil, err
+	}
+	result.Verifications = append(result.Verifications, verification)
+	ev := Event{Type: EventVerify, Attempt: attempt, Command: verification.Command, ExitCode: verification.ExitCode, DurationMs: verification.Duration.Milliseconds(), Success: verification.Passed()}
+	if verr := verification.Err(); verr != nil {
+		ev.Error = firstErrorLine(verr.Error())
+	}
+	e.emit(ev)
+	if err == nil {
+		err = verification.Err()
+	}
+	return verification, err
+}
+
+// candidates returns the contents of this attempt's files.
+func (e *Engine) candidates(st *stage, written []string) map[string]string {
+	if st != nil {
+		return st.files
+	}
+	files := make(map[string]string, len(written))
+	for _, path := range written {
+		if content, err := e.file.ReadFile(path); err == nil {
+			files[path] = content
+		}
+	}
+	return files
+}
+
+func totalSize(files map[string]string) int {
+	n := 0
+	for _, content := range files {
+		n += len(content)
+	}
+	return n
+}
+
+func (e *Engine) staged() bool {
+	return e.config.StagingDir != "" || e.config.DryRun
+}
+
+func (e *Engine) stagingDir() string {
+	if e.config.StagingDir != "" {
+		return e.config.StagingDir
+	}
+	return os.TempDir()
+}
+
+// retryInstruction adds feedback from failed attempts to the original
+// instruction: the latest build error (condensed to maxBytes, or batched
+// when it has many errors) and a one-line summary of earlier ones, so
+// prompts don't grow with every retry. A response rejected for its size
+// gets a corrective note instead.
+func retryInstruction(instruction string, history []AttemptRecord, files map[string]string, maxBytes int) string {
+	if n := len(history); n > 0 && history[n-1].Stage == "limit" {
+		return fmt.Sprintf("%s\n\nYour previous response was rejected: %s. Return only the files that must change, each in full, and nothing else.",
+			instruction, history[n-1].Error)
+	}
+	if n := len(history); n > 0 && history[n-1].Stage == "parse" && strings.HasPrefix(history[n-1].Error, "syntax error") {
+		return fmt.Sprintf("%s\n\nYour previous response did not compile: %s. Return each file in full as valid Go.",
+			instruction, history[n-1].Error)
+	}
+	if n := len(history); n > 0 && history[n-1].Stage == "check" {
+		return fmt.Sprintf("%s\n\nYour previous response broke a constraint: %s. Keep the requested change but satisfy every constraint.",
+			instruction, history[n-1].Error)
+	}
+	if n := len(history); n > 0 && history[n-1].Stage == "test" {
+		msg := errparse.Condense(strings.TrimPrefix(history[n-1].Error, "tests failed: "), maxBytes)
+		return fmt.Sprintf("%s\n\nYour previous response built, but tests failed:\n%s\nFix the code so the tests pass; don't change the tests unless asked to.",
+			instruction, msg)
+	}
+	var builds []AttemptRecord
+	for _, h := range history {
+		if h.Stage == "build" {
+			builds = append(builds, h)
+		}
+	}
+	if len(builds) == 0 {
+		return instruction
+	}
+
+	var sb strings.Builder
+	sb.WriteString(instruction)
+	last := builds[len(builds)-1]
+	if len(builds) > 1 {
+		sb.WriteString("\n\nEarlier attempts also failed to build:")
+		for _, h := range builds[:len(builds)-1] {
+			fmt.Fprintf(&sb, "\n- attempt %d: %s", h.Attempt, firstErrorLine(h.Error))
+		}
+	}
+	msg := strings.TrimPrefix(last.Error, "build failed: ")
+	failed := "Previous attempt failed"
+	if env, rest, ok := cutEnv(msg); ok {
+		failed, msg = "Previous attempt failed to build with "+env, rest
+	}
+	if batch := batchErrors(msg, files); batch != "" {
+		fmt.Fprintf(&sb, "\n\n%s:\n%s\nPlease fix the code.", failed, batch)
+		return sb.String()
+	}
+	// Compiler errors are restated one per line without package headers
+	// and other noise; unparsable output is quoted as is.
+	if diags := errparse.Parse(msg); len(diags) > 0 {
+		lines := make([]string, len(diags))
+		for i, d := range diags {
+			lines[i] = "- " + formatDiagnostic(d)
+		}
+		msg = fmt.Sprintf("%d build error(s):\n%s", len(diags), strings.Join(lines, "\n"))
+	}
+	msg = errparse.Condense(msg, maxBytes)
+	fmt.Fprintf(&sb, "\n\n%s:\n%s\nPlease fix the code.", failed, msg)
+	return sb.String()
+}
+
+// feedbackBytes is the retry feedback budget in bytes, at about four
+// bytes per token.
+func (e *Engine) feedbackBytes() int {
+	tokens := e.config.MaxFeedbackTokens
+	if tokens <= 0 {
+		tokens = DefaultMaxFeedbackTokens
+	}
+	return tokens * 4
+}
+
+// firstErrorLine returns the first diagnostic of a build error, or else
+// its first line that isn't a "# package" header.
+func firstErrorLine(msg string) string {
+	if diags := errparse.Parse(strings.TrimPrefix(msg, "build failed: ")); len(diags) > 0 {
+		return diags[0].String()
+	}
+	for _, line := range strings.Split(strings.TrimPrefix(msg, "build failed: "), "\n") {
+		if line = strings.TrimSpace(line); line != "" && !strings.HasPrefix(line, "#") {
+			return line
+		}
+	}
+	return msg
 }
 
 func (e *Engine) extractExplanation(response string) string {
-	re := regexp.MustCompile("```[\\s\\S]*?```")
-	return strings.TrimSpace(re.ReplaceAllString(response, ""))
+	return strings.TrimSpace(fence.Strip(response))
 }
 
 func (e *Engine) isRetryable(err error) bool {
@@ -250,7 +886,7 @@ func (e *Engine) isRetryable(err error) bool {
 	}
 	msg := strings.ToLower(err.Error())
 	return strings.Contains(msg, "timeout") || strings.Contains(msg, "connection") ||
-		strings.Contains(msg, "rate limit") || strings.Contains(msg, "503") || strings.Contains(msg, "502")
+		strings.Contains(msg, "rate limit") || strings.Contains(msg, "stalled") || strings.Contains(msg, "503") || strings.Contains(msg, "502")
 }
 
 func (e *Engine) Refactor(ctx context.Context, files []string, instruction, workDir string) *Result {
@@ -0,0 +1,109 @@
+package orchestrator
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"ai-dev-agent/service/diagnose"
+)
+
+// EnvCommandService is a CommandService that can also run a program with
+// environment variables set over its own. Verification under
+// Config.EnvMatrix needs one.
+type EnvCommandService interface {
+	ExecuteInDirEnv(ctx context.Context, env map[string]string, dir, name string, args ...string) (*diagnose.VerificationResult, error)
+}
+
+// EnvPermutations expands a matrix of variables to every combination of
+// their values, in a stable order: {CGO_ENABLED: [0, 1], GOOS: [linux,
+// darwin]} gives four environments.
+func EnvPermutations(matrix map[string][]string) []map[string]string {
+	names := make([]string, 0, len(matrix))
+	for name, values := range matrix {
+		if len(values) > 0 {
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 {
+		return nil
+	}
+	sort.Strings(names)
+	envs := []map[string]string{{}}
+	for _, name := range names {
+		var next []map[string]string
+		for _, env := range envs {
+			for _, value := range matrix[name] {
+				e := make(map[string]string, len(env)+1)
+				for k, v := range env {
+					e[k] = v
+				}
+				e[name] = value
+				next = append(next, e)
+			}
+		}
+		envs = next
+	}
+	return envs
+}
+
+// FormatEnv writes an environment as NAME=value pairs sorted by name.
+func FormatEnv(env map[string]string) string {
+	names := make([]string, 0, len(env))
+	for name := range env {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	pairs := make([]string, len(names))
+	for i, name := range names {
+		pairs[i] = name + "=" + env[name]
+	}
+	return strings.Join(pairs, " ")
+}
+
+// verifyMatrix builds the packages matching patterns once for every
+// environment of the matrix. All of them run, so that the verifications
+// report each one's result; the error is that of the first to fail,
+// prefixed with its environment for the retry prompt.
+func (e *Engine) verifyMatrix(ctx context.Context, attempt int, workDir, overlay string, patterns []string, result *Result) error {
+	envs := EnvPermutations(e.config.EnvMatrix)
+	if len(envs) == 0 {
+		return nil
+	}
+	if _, ok := e.exec.(EnvCommandService); !ok {
+		e.logError("Skipping the environment matrix: the command service can't set the environment")
+		return nil
+	}
+	args := []string{"build"}
+	if overlay != "" {
+		args = append(args, "-overlay="+overlay)
+	}
+	if len(patterns) == 0 {
+		patterns = []string{"./..."}
+	}
+	var first error
+	for _, env := range envs {
+		_, err := e.runVerificationEnv(ctx, attempt, workDir, env, append(args, patterns...), result)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err != nil && first == nil {
+			first = fmt.Errorf("under %s: %w", FormatEnv(env), err)
+		}
+	}
+	return first
+}
+
+// envPrefix matches the environment verifyMatrix puts before a failure.
+var envPrefix = regexp.MustCompile(`^under ((?:\w+=\S*)(?: \w+=\S*)*): `)
+
+// cutEnv splits the environment off a build failure of the matrix.
+func cutEnv(msg string) (env, rest string, ok bool) {
+	m := envPrefix.FindStringSubmatch(msg)
+	if m == nil {
+		return "", msg, false
+	}
+	return m[1], msg[len(m[0]):], true
+}
@@ -0,0 +1,56 @@
+package orchestrator
+
+import "time"
+
+// EventType identifies an orchestrator event.
+type EventType string
+
+const (
+	EventStart    EventType = "start"    // Execute began
+	EventAttempt  EventType = "attempt"  // an attempt began
+	EventResponse EventType = "response" // the model answered
+	EventWrite    EventType = "write"    // a file was written (or staged)
+	EventVerify   EventType = "verify"   // a build verification finished
+	EventFailure  EventType = "failure"  // an attempt failed at Stage
+	EventDone     EventType = "done"     // Execute finished
+	EventProgress EventType = "progress" // a long scan or index build advanced
+	EventFinding  EventType = "finding"  // a review reported a finding
+)
+
+// Event reports the progress of a request. Fields that don't apply to the
+// event's type are left empty; Error is set on failures and failed
+// verifications.
+type Event struct {
+	Type       EventType `json:"type"`
+	Time       time.Time `json:"time"`
+	Mode       Mode      `json:"mode,omitempty"`
+	Attempt    int       `json:"attempt,omitempty"`
+	Stage      string    `json:"stage,omitempty"`
+	File       string    `json:"file,omitempty"`
+	Files      []string  `json:"files,omitempty"`
+	Command    string    `json:"command,omitempty"`
+	ExitCode   int       `json:"exit_code,omitempty"`
+	Chars      int       `json:"chars,omitempty"`
+	DurationMs int64     `json:"duration_ms,omitempty"`
+	Success    bool      `json:"success,omitempty"`
+	Error      string    `json:"error,omitempty"`
+	// Progress events count Done of Total items and the bytes read, with
+	// the estimated time left once known.
+	Done  int   `json:"done,omitempty"`
+	Total int   `json:"total,omitempty"`
+	Bytes int64 `json:"bytes,omitempty"`
+	EtaMs int64 `json:"eta_ms,omitempty"`
+	// Finding events carry one review finding.
+	Finding *Finding `json:"finding,omitempty"`
+}
+
+// emit sends an event to the configured handler.
+func (e *Engine) emit(ev Event) {
+	if e.config.Events == nil {
+		return
+	}
+	if ev.Time.IsZero() {
+		ev.Time = time.Now()
+	}
+	e.config.Events(ev)
+}
@@ -0,0 +1,96 @@
+package orchestrator
+
+import (
+	"fmt"
+	"strings"
+
+	"ai-dev-agent/service/excerpt"
+)
+
+// excerptRatio is the largest share of a file its excerpts may cover;
+// beyond it the whole file is sent, as cutting saves too little.
+const excerptRatio = 0.7
+
+// excerpts is the declaration-level view of a fix request's target files.
+type excerpts struct {
+	regions  map[string][]excerpt.Region
+	sources  map[string]string
+	rendered map[string]string
+	count    int
+}
+
+// excerpts cuts the target files down to the declarations enclosing the
+// error lines. It returns nil, meaning whole files are sent, unless every
+// target is a Go file with error lines that cuts down well.
+func (e *Engine) excerpts(req *Request, files map[string]string, lines map[string][]int) *excerpts {
+	if req.Mode != ModeFix || len(lines) == 0 {
+		return nil
+	}
+	cut := &excerpts{
+		regions:  make(map[string][]excerpt.Region),
+		sources:  files,
+		rendered: make(map[string]string),
+	}
+	for _, path := range req.Files {
+		src := files[path]
+		if !strings.HasSuffix(path, ".go") || len(lines[path]) == 0 {
+			return nil
+		}
+		regions, err := excerpt.Regions(src, lines[path])
+		if err != nil {
+			e.logInfo("Sending whole files: %s: %v", path, err)
+			return nil
+		}
+		if float64(excerpt.Size(regions)) > excerptRatio*float64(len(src)) {
+			return nil
+		}
+		cut.regions[path] = regions
+		cut.rendered[path] = excerpt.Render(src, regions)
+		cut.count += len(regions)
+	}
+	e.logInfo("Sending %d declaration(s) around the errors instead of whole files", cut.count)
+	return cut
+}
+
+// instruction explains the excerpt format and the expected reply.
+func (c *excerpts) instruction() string {
+	return fmt.Sprintf("\n\nThe files are shown as excerpts: only the declarations around the errors, each under a "+
+		"\"// --- region N\" header. Reply with exactly %d code blocks, one per region in the order shown, each "+
+		"containing the complete corrected declaration and nothing else.", c.count)
+}
+
+// splice maps the reply's code blocks back onto the regions and returns
+// one block with the full new content per target file.
+func (c *excerpts) splice(files []string, blocks []CodeBlock) ([]CodeBlock, error) {
+	if len(blocks) != c.count {
+		return nil, fmt.Errorf("expected %d code blocks, one per region, got %d", c.count, len(blocks))
+	}
+	var out []CodeBlock
+	next := 0
+	for _, path := range files {
+		regions := c.regions[path]
+		replacements := make([]string, len(regions))
+		for i := range regions {
+			replacements[i] = blocks[next].Code
+			next++
+		}
+		content, err := excerpt.Splice(c.sources[path], regions, replacements)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		out = append(out, CodeBlock{Language: "go", Code: content})
+	}
+	return out, nil
+}
+
+// errorLines collects the lines of the target files that a build error
+// points at.
+func errorLines(msg string, files []string) map[string][]int {
+	lines := make(map[string][]int)
+	for _, path := range files {
+		if l := excerpt.ErrorLines(msg, path); len(l) > 0 {
+			lines[path] = l
+		}
+	}
+	return lines
+}
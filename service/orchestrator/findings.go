@@ -0,0 +1,114 @@
+package orchestrator
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Conventional comment labels of review findings
+// (https://conventionalcomments.org).
+const (
+	LabelPraise     = "praise"
+	LabelNitpick    = "nitpick"
+	LabelSuggestion = "suggestion"
+	LabelIssue      = "issue"
+	LabelQuestion   = "question"
+)
+
+// Labels are the finding labels, most severe first.
+var Labels = []string{LabelIssue, LabelSuggestion, LabelQuestion, LabelNitpick, LabelPraise}
+
+// Finding is a review comment in conventional comment form.
+type Finding struct {
+	Label string `json:"label"`
+	// Blocking findings must be resolved before the change is merged.
+	// Issues block unless decorated non-blocking; other labels block
+	// only when decorated blocking.
+	Blocking    bool     `json:"blocking"`
+	Decorations []string `json:"decorations,omitempty"`
+	File        string   `json:"file,omitempty"`
+	Line        int      `json:"line,omitempty"`
+	Subject     string   `json:"subject"`
+	Discussion  string   `json:"discussion,omitempty"`
+}
+
+// findingPattern matches the first line of a conventional comment, with
+// the markdown emphasis and list markers models like to add.
+var findingPattern = regexp.MustCompile(`(?i)^[-*>\s]*\**(praise|nitpick|suggestion|issue|question)\**\s*(?:\(([^)]*)\))?\s*\**:\**\s*(.*)$`)
+
+// locationPattern matches a file:line location that starts a subject.
+var locationPattern = regexp.MustCompile("^`?([\\w./\\\\-]+\\.\\w+):(\\d+)(?::\\d+)?`?:?\\s*")
+
+// ParseFindings extracts the conventional comments of a review. Lines
+// that follow a comment, up to a blank line or the next comment, are its
+// discussion.
+func ParseFindings(review string) []Finding {
+	var findings []Finding
+	var current *Finding
+	var discussion []string
+	flush := func() {
+		if current != nil {
+			current.Discussion = strings.TrimSpace(strings.Join(discussion, "\n"))
+			findings = append(findings, *current)
+		}
+		current, discussion = nil, nil
+	}
+	for _, line := range strings.Split(review, "\n") {
+		m := findingPattern.FindStringSubmatch(line)
+		if m == nil {
+			if current == nil {
+				continue
+			}
+			if strings.TrimSpace(line) == "" {
+				flush()
+				continue
+			}
+			discussion = append(discussion, strings.TrimSpace(line))
+			continue
+		}
+		flush()
+		label := strings.ToLower(m[1])
+		f := Finding{Label: label, Blocking: label == LabelIssue}
+		for _, d := range strings.Split(m[2], ",") {
+			d = strings.ToLower(strings.TrimSpace(d))
+			switch d {
+			case "":
+				continue
+			case "blocking":
+				f.Blocking = true
+			case "non-blocking":
+				f.Blocking = false
+			}
+			f.Decorations = append(f.Decorations, d)
+		}
+		subject := strings.TrimSpace(m[3])
+		if loc := locationPattern.FindStringSubmatch(subject); loc != nil {
+			f.File = filepathSlash(loc[1])
+			f.Line, _ = strconv.Atoi(loc[2])
+			subject = subject[len(loc[0]):]
+		}
+		f.Subject = subject
+		current = &f
+	}
+	flush()
+	return findings
+}
+
+// CountFindings counts findings by label, and the blocking ones.
+func CountFindings(findings []Finding) (byLabel map[string]int, blocking int) {
+	byLabel = make(map[string]int)
+	for _, f := range findings {
+		byLabel[f.Label]++
+		if f.Blocking {
+			blocking++
+		}
+	}
+	return byLabel, blocking
+}
+
+// Helper functions
+
+func filepathSlash(path string) string {
+	return strings.ReplaceAll(path, `\`, "/")
+}
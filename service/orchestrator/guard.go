@@ -0,0 +1,113 @@
+package orchestrator
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// Errors
+var (
+	ErrUnsafePath     = errors.New("unsafe write path")
+	ErrReadOnlyTarget = errors.New("response rewrites a read-only context file")
+)
+
+// DefaultWriteExtensions are the file types a model may create beyond the
+// request's target files. Shell scripts are left out: verification could
+// run one.
+var DefaultWriteExtensions = []string{
+	".go", ".mod", ".sum", ".md", ".txt", ".json", ".yaml", ".yml", ".toml",
+	".sql", ".proto", ".html", ".css", ".js", ".ts",
+}
+
+// protectedDirs never receive agent writes, wherever they appear in a path.
+var protectedDirs = map[string]bool{".git": true, ".ai-backup": true, ".aidev": true}
+
+// ValidatePath rejects writes that escape the workspace through ".." or
+// land in version control or agent state directories.
+func ValidatePath(path string) error {
+	clean := filepath.ToSlash(filepath.Clean(path))
+	if clean == ".." || strings.HasPrefix(clean, "../") {
+		return fmt.Errorf("%w: %s escapes the workspace", ErrUnsafePath, path)
+	}
+	for _, part := range strings.Split(clean, "/") {
+		if protectedDirs[part] {
+			return fmt.Errorf("%w: %s is inside %s", ErrUnsafePath, path, part)
+		}
+	}
+	return nil
+}
+
+// validateModelPath additionally checks a path chosen by the model rather
+// than the user: it must be relative and have an allowed extension.
+func validateModelPath(path string, extensions []string) error {
+	if filepath.IsAbs(path) || strings.HasPrefix(path, "/") || strings.HasPrefix(path, `\`) {
+		return fmt.Errorf("%w: %s is absolute", ErrUnsafePath, path)
+	}
+	if err := ValidatePath(path); err != nil {
+		return err
+	}
+	ext := strings.ToLower(filepath.Ext(path))
+	for _, allowed := range extensions {
+		if ext == allowed {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: %s has an unexpected extension", ErrUnsafePath, path)
+}
+
+// checkReadOnly rejects a response with a block labeled as one of the
+// request's context files, which are shown for reference only. A context
+// file that is also a target stays editable.
+func checkReadOnly(req *Request, blocks []CodeBlock) error {
+	targets := make(map[string]bool, len(req.Files))
+	for _, f := range req.Files {
+		targets[filepath.Clean(f)] = true
+	}
+	for _, c := range req.Context {
+		c = filepath.Clean(c)
+		if targets[c] {
+			continue
+		}
+		for _, block := range blocks {
+			if block.Filename != "" && filepath.Clean(block.Filename) == c {
+				return fmt.Errorf("%w: %s", ErrReadOnlyTarget, block.Filename)
+			}
+		}
+	}
+	return nil
+}
+
+// guardedFiles validates every write before passing it on, so no caller
+// of the engine's FileService can bypass the path rules.
+type guardedFiles struct {
+	FileService
+}
+
+func (g guardedFiles) WriteFile(path, content string) error {
+	if err := ValidatePath(path); err != nil {
+		return err
+	}
+	return g.FileService.WriteFile(path, content)
+}
+
+// blockTarget returns where the i-th code block goes: the i-th request
+// target, else the model-provided filename once validated. An empty path
+// means the block is skipped.
+func (e *Engine) blockTarget(i int, files []string, block CodeBlock) (string, error) {
+	if i < len(files) {
+		return files[i], nil
+	}
+	if block.Filename == "" {
+		return "", nil
+	}
+	extensions := e.config.WriteExtensions
+	if extensions == nil {
+		extensions = DefaultWriteExtensions
+	}
+	if err := validateModelPath(block.Filename, extensions); err != nil {
+		return "", err
+	}
+	return block.Filename, nil
+}
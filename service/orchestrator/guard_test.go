@@ -0,0 +1,119 @@
+package orchestrator
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestValidatePath(t *testing.T) {
+	tests := []struct {
+		path string
+		ok   bool
+	}{
+		{"main.go", true},
+		{"service/store/store.go", true},
+		{"./docs/../README.md", true},
+		{"a/b/../../c.go", true},
+		{"..", false},
+		{"../main.go", false},
+		{"a/../../main.go", false},
+		{"service/../../etc/passwd", false},
+		{".git/config", false},
+		{".git/hooks/pre-commit", false},
+		{"sub/.git/config", false},
+		{".ai-backup/main.go", false},
+		{"vendor/.ai-backup/x.go", false},
+		{".aidev/history.db", false},
+		{"a/.aidev", false},
+		{".gitignore", true},
+		{".github/workflows/ci.yml", true},
+		{"..foo/main.go", true},
+	}
+	for _, tt := range tests {
+		err := ValidatePath(tt.path)
+		if tt.ok && err != nil {
+			t.Errorf("ValidatePath(%q) = %v, want nil", tt.path, err)
+		}
+		if !tt.ok && !errors.Is(err, ErrUnsafePath) {
+			t.Errorf("ValidatePath(%q) = %v, want ErrUnsafePath", tt.path, err)
+		}
+	}
+}
+
+func TestValidateModelPath(t *testing.T) {
+	tests := []struct {
+		path string
+		ok   bool
+	}{
+		{"main.go", true},
+		{"docs/usage.md", true},
+		{"config/app.YAML", true},
+		{"go.mod", true},
+		{"/etc/passwd.txt", false},
+		{"/tmp/x.go", false},
+		{`\server\share.go`, false},
+		{"../x.go", false},
+		{".git/x.go", false},
+		{".aidev/x.json", false},
+		{"deploy.sh", false},
+		{"scripts/install.sh", false},
+		{"Makefile", false},
+		{"main", false},
+		{"lib.so", false},
+		{"run.py", false},
+	}
+	for _, tt := range tests {
+		err := validateModelPath(tt.path, DefaultWriteExtensions)
+		if tt.ok && err != nil {
+			t.Errorf("validateModelPath(%q) = %v, want nil", tt.path, err)
+		}
+		if !tt.ok && !errors.Is(err, ErrUnsafePath) {
+			t.Errorf("validateModelPath(%q) = %v, want ErrUnsafePath", tt.path, err)
+		}
+	}
+
+	if err := validateModelPath("run.py", []string{".py"}); err != nil {
+		t.Errorf("validateModelPath with .py allowed = %v, want nil", err)
+	}
+	if err := validateModelPath("main.go", []string{}); !errors.Is(err, ErrUnsafePath) {
+		t.Errorf("validateModelPath with no extensions allowed = %v, want ErrUnsafePath", err)
+	}
+}
+
+func TestDefaultWriteExtensionsExcludeScripts(t *testing.T) {
+	for _, ext := range DefaultWriteExtensions {
+		switch ext {
+		case ".sh", ".bash", ".bat", ".cmd", ".ps1", ".exe":
+			t.Errorf("DefaultWriteExtensions contains %s", ext)
+		}
+	}
+}
+
+type memFiles map[string]string
+
+func (m memFiles) ReadFile(path string) (string, error) { return m[path], nil }
+func (m memFiles) WriteFile(path, content string) error { m[path] = content; return nil }
+func (m memFiles) FileExists(path string) bool          { _, ok := m[path]; return ok }
+
+func TestGuardedFiles(t *testing.T) {
+	files := memFiles{}
+	g := guardedFiles{files}
+
+	if err := g.WriteFile("main.go", "package main"); err != nil {
+		t.Fatalf("WriteFile(main.go) = %v", err)
+	}
+	if files["main.go"] != "package main" {
+		t.Errorf("main.go = %q, want it written through", files["main.go"])
+	}
+	for _, path := range []string{"../main.go", ".git/config", "x/.ai-backup/main.go", ".aidev/state.json"} {
+		if err := g.WriteFile(path, "x"); !errors.Is(err, ErrUnsafePath) {
+			t.Errorf("WriteFile(%q) = %v, want ErrUnsafePath", path, err)
+		}
+		if _, ok := files[path]; ok {
+			t.Errorf("WriteFile(%q) reached the file service", path)
+		}
+	}
+	if !g.FileExists("main.go") {
+		t.Error("FileExists(main.go) = false through the guard")
+	}
+}
@@ -0,0 +1,47 @@
+package orchestrator
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"ai-dev-agent/service/deps"
+)
+
+// constraints resolves a request's constraints and, for requests that
+// write, adds the layering rules of Config.Layering: to the prompt, and
+// as a check rejecting attempts that import what they forbid.
+func (e *Engine) constraints(req *Request) constraintSet {
+	set := resolveConstraints(req.Constraints)
+	if len(e.config.Layering) == 0 || req.Mode.ReadOnly() {
+		return set
+	}
+	rules := make([]string, len(e.config.Layering))
+	for i, r := range e.config.Layering {
+		rules[i] = r.String()
+	}
+	set.texts = append(set.texts, "Keep to the project's layering rules (package directories relative to the module root): "+strings.Join(rules, "; "))
+	set.checks = append(set.checks, e.checkLayering)
+	return set
+}
+
+// checkLayering rejects an attempt whose files add imports a layering
+// rule forbids. Outside a Go module there is nothing to check.
+func (e *Engine) checkLayering(ctx context.Context, in *CheckInput) error {
+	violations, err := deps.NewViolations(in.WorkDir, e.config.Layering, in.Before, in.After)
+	if err != nil {
+		if errors.Is(err, deps.ErrNoModule) {
+			return nil
+		}
+		return err
+	}
+	if len(violations) == 0 {
+		return nil
+	}
+	problems := make([]string, len(violations))
+	for i, v := range violations {
+		problems[i] = fmt.Sprintf("%s imports %s, which %q forbids", v.File, v.Import, v.Rule)
+	}
+	return fmt.Errorf("the change breaks the layering rules: %s; remove those imports and put the code where the rules allow it", strings.Join(problems, "; "))
+}
@@ -0,0 +1,68 @@
+package orchestrator
+
+import (
+	"context"
+	"strings"
+
+	"ai-dev-agent/service/vision"
+)
+
+// Message roles.
+const (
+	RoleSystem    = "system"
+	RoleUser      = "user"
+	RoleAssistant = "assistant"
+	RoleTool      = "tool"
+)
+
+// Message is one turn of a conversation with the model.
+type Message struct {
+	Role    string
+	Content string
+	Images  []*vision.Image // for vision models
+}
+
+// UserPrompt returns a conversation of a single user prompt.
+func UserPrompt(prompt string) []Message {
+	return []Message{{Role: RoleUser, Content: prompt}}
+}
+
+// TextChatter adapts an LLMService for callers that send a single prompt
+// string, such as the summarizer.
+type TextChatter struct {
+	LLM LLMService
+}
+
+// Chat sends prompt as the only user message.
+func (t TextChatter) Chat(ctx context.Context, prompt string) (string, error) {
+	return t.LLM.Chat(ctx, UserPrompt(prompt))
+}
+
+// withSystem puts system first in messages, ahead of any system message
+// they already start with.
+func withSystem(system string, messages []Message) []Message {
+	if system == "" {
+		return messages
+	}
+	if len(messages) > 0 && messages[0].Role == RoleSystem {
+		out := append([]Message(nil), messages...)
+		out[0].Content = strings.TrimSpace(system + "\n\n" + out[0].Content)
+		return out
+	}
+	return append([]Message{{Role: RoleSystem, Content: system}}, messages...)
+}
+
+// withImages attaches images to the last user message.
+func withImages(images []*vision.Image, messages []Message) []Message {
+	if len(images) == 0 {
+		return messages
+	}
+	for i := len(messages) - 1; i >= 0; i-- {
+		if messages[i].Role == RoleUser {
+			out := append([]Message(nil), messages...)
+			out[i].Images = append(append([]*vision.Image(nil), out[i].Images...), images...)
+			return out
+		}
+	}
+	return append(messages, Message{Role: RoleUser, Images: images})
+}
@@ -0,0 +1,79 @@
+package orchestrator
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"ai-dev-agent/service/diff"
+)
+
+// DefaultMaxDiffMultiple is how many times the expected change an attempt
+// may change under minimal-diff.
+const DefaultMaxDiffMultiple = 3
+
+// The change expected of a file: a tenth of its lines, or a few lines per
+// reported error line, and never less than minExpectedLines.
+const (
+	expectedShare    = 0.1
+	linesPerError    = 10
+	minExpectedLines = 10
+)
+
+// checkMinimalDiff rejects attempts that write files outside the request's
+// targets, or change a target by more than MaxDiffMultiple times the
+// expected change, as models that reformat whole files do.
+func checkMinimalDiff(ctx context.Context, in *CheckInput) error {
+	targets := make(map[string]bool, len(in.Request.Files))
+	for _, f := range in.Request.Files {
+		targets[filepath.Clean(f)] = true
+	}
+	multiple := in.MaxDiffMultiple
+	if multiple <= 0 {
+		multiple = DefaultMaxDiffMultiple
+	}
+
+	var outside, problems []string
+	for path, content := range in.After {
+		if !targets[filepath.Clean(path)] {
+			outside = append(outside, path)
+			continue
+		}
+		before, ok := in.Before[path]
+		if !ok || before == "" {
+			continue // a new file has no smaller diff
+		}
+		stats := diff.Count(before, content)
+		changed := stats.Added
+		if stats.Removed > changed {
+			changed = stats.Removed
+		}
+		allowed := int(multiple * float64(expectedChange(before, in.Request.Lines[path])))
+		if changed > allowed {
+			problems = append(problems, fmt.Sprintf("%s changes %d lines, at most %d expected", path, changed, allowed))
+		}
+	}
+	if len(outside) > 0 {
+		sort.Strings(outside)
+		return fmt.Errorf("the change touches files outside the targets: %s", strings.Join(outside, ", "))
+	}
+	if len(problems) > 0 {
+		sort.Strings(problems)
+		return fmt.Errorf("the diff is too large (%s); change only the lines the task needs and keep the rest byte for byte", strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// expectedChange estimates how many lines of a file a task changes.
+func expectedChange(before string, errorLines []int) int {
+	expected := int(expectedShare * float64(len(diff.Lines(before))))
+	if len(errorLines) > 0 {
+		expected = linesPerError * len(errorLines)
+	}
+	if expected < minExpectedLines {
+		expected = minExpectedLines
+	}
+	return expected
+}
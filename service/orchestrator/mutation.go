@@ -0,0 +1,206 @@
+package orchestrator
+
+import (
+	"context"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// DefaultMaxMutants bounds the mutants of one mutation pass.
+const DefaultMaxMutants = 25
+
+// mutationOps maps each operator a mutant may flip to its replacement:
+// conditions are negated and arithmetic inverted.
+var mutationOps = map[token.Token]token.Token{
+	token.EQL: token.NEQ, token.NEQ: token.EQL,
+	token.LSS: token.GEQ, token.GEQ: token.LSS,
+	token.GTR: token.LEQ, token.LEQ: token.GTR,
+	token.LAND: token.LOR, token.LOR: token.LAND,
+	token.ADD: token.SUB, token.SUB: token.ADD,
+	token.MUL: token.QUO, token.QUO: token.MUL,
+}
+
+// Mutant is a copy of a target function with one operator flipped. Tests
+// that still pass against it leave that behavior unchecked.
+type Mutant struct {
+	File   string `json:"file"`
+	Line   int    `json:"line"`
+	Func   string `json:"func"`
+	From   string `json:"from"` // the expression mutated, e.g. n < max
+	To     string `json:"to"`   // and what it became, e.g. n >= max
+	Killed bool   `json:"killed"`
+
+	source string // the file with the mutation applied
+}
+
+// MutationReport records which mutants of the target functions the
+// generated tests caught. Mutants that don't compile aren't counted.
+type MutationReport struct {
+	Mutants []Mutant `json:"mutants"`
+	Killed  int      `json:"killed"`
+}
+
+// Survivors returns the mutants no test caught.
+func (r *MutationReport) Survivors() []Mutant {
+	var survivors []Mutant
+	for _, m := range r.Mutants {
+		if !m.Killed {
+			survivors = append(survivors, m)
+		}
+	}
+	return survivors
+}
+
+// mutationPass runs the new tests of each package against every mutant
+// of its target functions. Each mutant replaces its file through a build
+// overlay in a scratch directory, so the workspace is never touched.
+func (e *Engine) mutationPass(ctx context.Context, workDir string, targets []string, before map[string]string, funcs []targetFunc) (*MutationReport, error) {
+	files := make(map[string]string)
+	for _, f := range funcs {
+		if _, ok := files[f.File]; ok {
+			continue
+		}
+		content, err := e.file.ReadFile(f.File)
+		if err != nil {
+			return nil, err
+		}
+		files[f.File] = content
+	}
+	st, err := newStage(e.stagingDir())
+	if err != nil {
+		return nil, err
+	}
+	defer st.discard()
+
+	report := &MutationReport{}
+	for _, m := range mutants(files, funcs, DefaultMaxMutants) {
+		dir := filepath.Dir(m.File)
+		run, err := e.newTestPattern(dir, targets, before)
+		if err != nil {
+			return nil, err
+		}
+		st.files = make(map[string]string)
+		if err := st.put(filepath.ToSlash(m.File), m.source); err != nil {
+			return nil, err
+		}
+		overlay, err := st.overlay(workDir)
+		if err != nil {
+			return nil, err
+		}
+		verification, err := e.exec.ExecuteInDir(ctx, workDir, "go", "test", "-overlay="+overlay, "-timeout=30s", run, "./"+filepath.ToSlash(dir))
+		if verification == nil {
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			return nil, err
+		}
+		if strings.Contains(verification.Output, "[build failed]") || strings.Contains(verification.Output, "[setup failed]") {
+			continue
+		}
+		m.Killed = !verification.Passed()
+		if m.Killed {
+			report.Killed++
+		}
+		m.source = ""
+		report.Mutants = append(report.Mutants, m)
+	}
+	e.logInfo("Mutation pass: %d of %d mutants killed", report.Killed, len(report.Mutants))
+	return report, nil
+}
+
+// Helper functions
+
+// mutants returns up to max single-operator mutants of funcs, spread
+// evenly over their mutation sites.
+func mutants(files map[string]string, funcs []targetFunc, max int) []Mutant {
+	var all []Mutant
+	paths := make([]string, 0, len(files))
+	for path := range files {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	for _, path := range paths {
+		src := files[path]
+		fset := token.NewFileSet()
+		file, err := parser.ParseFile(fset, path, src, 0)
+		if err != nil {
+			continue
+		}
+		ast.Inspect(file, func(n ast.Node) bool {
+			b, ok := n.(*ast.BinaryExpr)
+			if !ok {
+				return true
+			}
+			to, ok := mutationOps[b.Op]
+			if !ok || b.Op == token.ADD && (isStringLit(b.X) || isStringLit(b.Y)) {
+				return true
+			}
+			pos := fset.Position(b.OpPos)
+			f := enclosingFunc(funcs, path, pos.Line)
+			if f == nil {
+				return true
+			}
+			start, end := fset.Position(b.Pos()).Offset, fset.Position(b.End()).Offset
+			op := pos.Offset
+			from := src[start:end]
+			mutated := src[start:op] + to.String() + src[op+len(b.Op.String()):end]
+			all = append(all, Mutant{
+				File:   path,
+				Line:   pos.Line,
+				Func:   f.Name,
+				From:   shorten(from),
+				To:     shorten(mutated),
+				source: src[:start] + mutated + src[end:],
+			})
+			return true
+		})
+	}
+	if len(all) <= max {
+		return all
+	}
+	picked := make([]Mutant, max)
+	for i := range picked {
+		picked[i] = all[i*len(all)/max]
+	}
+	return picked
+}
+
+// mutationFeedback describes the surviving mutants for the next round.
+func mutationFeedback(report *MutationReport) string {
+	survivors := report.Survivors()
+	var b strings.Builder
+	fmt.Fprintf(&b, "%d of %d mutants survived:", len(survivors), len(report.Mutants))
+	for _, m := range survivors {
+		fmt.Fprintf(&b, "\n- %s:%d in %s: %s became %s", m.File, m.Line, m.Func, m.From, m.To)
+	}
+	return b.String()
+}
+
+func enclosingFunc(funcs []targetFunc, path string, line int) *targetFunc {
+	for i := range funcs {
+		f := &funcs[i]
+		if f.File == path && line >= f.Start && line <= f.End {
+			return f
+		}
+	}
+	return nil
+}
+
+func isStringLit(expr ast.Expr) bool {
+	lit, ok := expr.(*ast.BasicLit)
+	return ok && lit.Kind == token.STRING
+}
+
+// shorten keeps an expression on one line and under 60 bytes.
+func shorten(expr string) string {
+	expr = strings.Join(strings.Fields(expr), " ")
+	if len(expr) > 60 {
+		expr = expr[:57] + "..."
+	}
+	return expr
+}
@@ -0,0 +1,256 @@
+package orchestrator
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"ai-dev-agent/service/fence"
+)
+
+// Role is one agent in a pipeline.
+type Role struct {
+	Name   string
+	System string
+	LLM    LLMService // nil uses the engine's LLM
+}
+
+// PipelineConfig configures an implement → review → test pipeline.
+type PipelineConfig struct {
+	Implementer Role
+	Reviewer    Role
+	Tester      *Role // nil skips the test-writing stage
+	// MaxRounds bounds how often the reviewer can bounce work back.
+	MaxRounds int
+}
+
+// DefaultPipelineConfig returns a pipeline with the built-in role prompts.
+func DefaultPipelineConfig() PipelineConfig {
+	return PipelineConfig{
+		Implementer: Role{Name: "implementer", System: implementerSystem},
+		Reviewer:    Role{Name: "reviewer", System: reviewerSystem},
+		Tester:      &Role{Name: "tester", System: testerSystem},
+		MaxRounds:   2,
+	}
+}
+
+// Review is one reviewer verdict.
+type Review struct {
+	Round    int
+	Approved bool
+	Feedback string
+}
+
+// PipelineResult extends Result with the review history.
+type PipelineResult struct {
+	*Result
+	Rounds    int
+	Reviews   []Review
+	TestFiles []string
+}
+
+const (
+	implementerSystem = "You are the implementer. Produce complete, compilable code for each file, in order, in fenced code blocks."
+	reviewerSystem    = "You are a strict code reviewer. Check the change for bugs, missed requirements and unsafe code. " +
+		"Answer APPROVED on the first line if it is acceptable; otherwise answer REJECTED on the first line followed by concrete, actionable feedback."
+	testerSystem = "You are a test writer. Write table-driven Go tests for the given code using only the standard library. " +
+		"Return one fenced code block per test file, in order."
+)
+
+// RunPipeline runs the implementer, lets the reviewer approve or reject the
+// result (re-running the implementer with the feedback up to MaxRounds
+// times), and finally has the tester write tests for the approved files.
+func (e *Engine) RunPipeline(ctx context.Context, req *Request, pc PipelineConfig) *PipelineResult {
+	start := time.Now()
+	if pc.MaxRounds < 1 {
+		pc.MaxRounds = 1
+	}
+	instruction := req.Instruction
+	out := &PipelineResult{Result: &Result{}}
+	attempts := 0
+
+	for round := 1; round <= pc.MaxRounds; round++ {
+		out.Rounds = round
+		e.logInfo("[%s] round %d/%d", pc.Implementer.Name, round, pc.MaxRounds)
+
+		implementer := e.withRole(pc.Implementer)
+		result := implementer.Execute(ctx, &Request{Mode: req.Mode, Files: req.Files, Context: req.Context, Instruction: instruction, WorkDir: req.WorkDir, Constraints: req.Constraints, Images: req.Images})
+		attempts += result.Attempts
+		out.Result = result
+		if !result.Success {
+			break
+		}
+
+		e.logInfo("[%s] reviewing %d file(s)", pc.Reviewer.Name, len(result.FilesWritten)+len(result.Candidates))
+		review, err := e.review(ctx, pc.Reviewer, req, e.changedFiles(result))
+		if err != nil {
+			e.logError("Review failed: %v", err)
+			break
+		}
+		review.Round = round
+		out.Reviews = append(out.Reviews, review)
+		if review.Approved {
+			e.logInfo("[%s] approved", pc.Reviewer.Name)
+			break
+		}
+
+		e.logInfo("[%s] rejected: %s", pc.Reviewer.Name, firstLine(review.Feedback))
+		if round == pc.MaxRounds {
+			result.Success = false
+			result.Error = fmt.Errorf("reviewer rejected the change after %d round(s): %s", round, review.Feedback)
+			break
+		}
+		instruction = fmt.Sprintf("%s\n\nReviewer feedback on the previous attempt:\n%s\nAddress every point.", req.Instruction, review.Feedback)
+	}
+
+	if out.Success && pc.Tester != nil {
+		if e.config.DryRun {
+			e.logInfo("[%s] skipped in dry run", pc.Tester.Name)
+		} else if files, err := e.writeTests(ctx, *pc.Tester, req); err != nil {
+			e.logError("Test writing failed: %v", err)
+		} else {
+			out.TestFiles = files
+			out.FilesWritten = append(out.FilesWritten, files...)
+		}
+	}
+
+	out.Attempts = attempts
+	out.Duration = time.Since(start)
+	return out
+}
+
+// withRole returns an engine that talks to the role's model with its
+// system prompt.
+func (e *Engine) withRole(role Role) *Engine {
+	sub := *e
+	sub.llm = roleLLM{llm: e.roleService(role), system: role.System}
+	return &sub
+}
+
+func (e *Engine) roleService(role Role) LLMService {
+	if role.LLM != nil {
+		return role.LLM
+	}
+	return e.llm
+}
+
+// review asks the reviewer for a verdict on the changed files.
+func (e *Engine) review(ctx context.Context, role Role, req *Request, files map[string]string) (Review, error) {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "Task (%s): %s\n\nChanged files:\n", req.Mode, req.Instruction)
+	for _, path := range sortedKeys(files) {
+		f := fence.For(files[path])
+		fmt.Fprintf(&sb, "\n### %s\n%s%s\n%s\n%s\n", path, f, strings.TrimPrefix(filepath.Ext(path), "."), files[path], f)
+	}
+
+	response, err := roleLLM{llm: e.roleService(role), system: role.System}.Chat(ctx, UserPrompt(sb.String()))
+	if err != nil {
+		return Review{}, err
+	}
+	return parseReview(response), nil
+}
+
+// writeTests has the tester write a _test.go file for each Go source file.
+func (e *Engine) writeTests(ctx context.Context, role Role, req *Request) ([]string, error) {
+	var sources, targets []string
+	for _, path := range req.Files {
+		if strings.HasSuffix(path, ".go") && !strings.HasSuffix(path, "_test.go") {
+			sources = append(sources, path)
+			targets = append(targets, strings.TrimSuffix(path, ".go")+"_test.go")
+		}
+	}
+	if len(sources) == 0 {
+		return nil, nil
+	}
+	e.logInfo("[%s] writing tests for %d file(s)", role.Name, len(sources))
+
+	contents, err := e.readFiles(sources)
+	if err != nil {
+		return nil, err
+	}
+	instruction := fmt.Sprintf("Write tests for: %s\nTest files, in order: %s", req.Instruction, strings.Join(targets, ", "))
+	messages, err := e.buildPrompt(&Request{Mode: "test", Instruction: instruction}, contents, nil)
+	if err != nil {
+		return nil, err
+	}
+	response, err := roleLLM{llm: e.roleService(role), system: role.System}.Chat(ctx, messages)
+	if err != nil {
+		return nil, err
+	}
+	blocks := e.parseCodeBlocks(response)
+	if len(blocks) == 0 {
+		return nil, fmt.Errorf("no code blocks found in response")
+	}
+	if len(blocks) > len(targets) {
+		blocks = blocks[:len(targets)]
+	}
+	return e.writeFiles(targets, blocks)
+}
+
+// changedFiles returns the content of the files a result produced.
+func (e *Engine) changedFiles(result *Result) map[string]string {
+	if result.Candidates != nil {
+		return result.Candidates
+	}
+	return e.candidates(nil, result.FilesWritten)
+}
+
+// roleLLM sends conversations with a role's system prompt ahead of the
+// mode's.
+type roleLLM struct {
+	llm    LLMService
+	system string
+}
+
+func (r roleLLM) Chat(ctx context.Context, messages []Message) (string, error) {
+	return r.llm.Chat(ctx, withSystem(r.system, messages))
+}
+
+// ChatStream streams when the role's LLM can.
+func (r roleLLM) ChatStream(ctx context.Context, messages []Message, onChunk func(string)) (string, error) {
+	if s, ok := r.llm.(StreamingLLM); ok {
+		return s.ChatStream(ctx, withSystem(r.system, messages), onChunk)
+	}
+	response, err := r.Chat(ctx, messages)
+	if err == nil {
+		onChunk(response)
+	}
+	return response, err
+}
+
+// Helper functions
+
+func parseReview(response string) Review {
+	text := strings.TrimSpace(response)
+	verdict, feedback := text, ""
+	if i := strings.IndexByte(text, '\n'); i >= 0 {
+		verdict, feedback = text[:i], strings.TrimSpace(text[i+1:])
+	}
+	verdict = strings.ToUpper(strings.Trim(verdict, "*# :"))
+	if strings.HasPrefix(verdict, "APPROVED") {
+		return Review{Approved: true, Feedback: feedback}
+	}
+	if feedback == "" {
+		feedback = text
+	}
+	return Review{Approved: false, Feedback: feedback}
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func firstLine(s string) string {
+	if i := strings.IndexByte(s, '\n'); i >= 0 {
+		return s[:i]
+	}
+	return s
+}
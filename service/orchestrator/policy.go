@@ -0,0 +1,128 @@
+package orchestrator
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Policy severities besides the finding labels.
+const (
+	SeverityBlocking    = "blocking"
+	SeverityNonBlocking = "non-blocking"
+	SeverityIgnore      = "ignore"
+)
+
+// PolicyRule sets the severity of the review findings it matches, so that
+// a team gets the same severity for the same kind of finding in every
+// review.
+type PolicyRule struct {
+	// Match is a case-insensitive regular expression, usually a few
+	// words, matched against a finding's subject, discussion and
+	// decorations.
+	Match string `yaml:"match"`
+	// Severity is blocking (a blocking issue), non-blocking, a label
+	// (issue, suggestion, question, nitpick, praise) or ignore, which
+	// drops the finding.
+	Severity string `yaml:"severity"`
+
+	re *regexp.Regexp
+}
+
+// ReviewPolicy is a team's list of severity rules; the first rule that
+// matches a finding applies.
+type ReviewPolicy []PolicyRule
+
+// Compile checks the rules and compiles their patterns.
+func (p ReviewPolicy) Compile() error {
+	for i := range p {
+		r := &p[i]
+		if !validSeverity(r.Severity) {
+			return fmt.Errorf("review_policy[%d]: severity %q: want blocking, non-blocking, ignore or one of %s", i, r.Severity, strings.Join(Labels, ", "))
+		}
+		re, err := regexp.Compile("(?i)" + r.Match)
+		if err != nil || r.Match == "" {
+			return fmt.Errorf("review_policy[%d]: match %q is not a valid pattern", i, r.Match)
+		}
+		r.re = re
+	}
+	return nil
+}
+
+// Prompt describes the policy to the reviewer.
+func (p ReviewPolicy) Prompt() string {
+	if len(p) == 0 {
+		return ""
+	}
+	var b strings.Builder
+	b.WriteString("Classify findings by the team's review policy; the first matching rule applies:")
+	for _, r := range p {
+		if r.Severity == SeverityIgnore {
+			fmt.Fprintf(&b, "\n- %s: don't report", r.Match)
+			continue
+		}
+		fmt.Fprintf(&b, "\n- %s: %s", r.Match, r.Severity)
+	}
+	return b.String()
+}
+
+// Apply reclassifies findings by the first rule each matches and drops
+// the ignored ones. A finding no rule matches keeps its severity.
+func (p ReviewPolicy) Apply(findings []Finding) []Finding {
+	if len(p) == 0 {
+		return findings
+	}
+	kept := findings[:0:0]
+	for _, f := range findings {
+		r := p.match(f)
+		if r == nil {
+			kept = append(kept, f)
+			continue
+		}
+		switch r.Severity {
+		case SeverityIgnore:
+			continue
+		case SeverityBlocking:
+			f.Label, f.Blocking = LabelIssue, true
+		case SeverityNonBlocking:
+			f.Blocking = false
+		default:
+			f.Label, f.Blocking = r.Severity, r.Severity == LabelIssue
+		}
+		kept = append(kept, f)
+	}
+	return kept
+}
+
+// Helper functions
+
+func (p ReviewPolicy) match(f Finding) *PolicyRule {
+	text := f.Subject + "\n" + f.Discussion + "\n" + strings.Join(f.Decorations, " ")
+	for i := range p {
+		r := &p[i]
+		if r.re == nil {
+			// An uncompiled rule that doesn't compile never matches.
+			if re, err := regexp.Compile("(?i)" + r.Match); err == nil && r.Match != "" {
+				r.re = re
+			} else {
+				continue
+			}
+		}
+		if r.re.MatchString(text) {
+			return r
+		}
+	}
+	return nil
+}
+
+func validSeverity(s string) bool {
+	if s == SeverityBlocking || s == SeverityNonBlocking || s == SeverityIgnore {
+		return true
+	}
+	for _, l := range Labels {
+		if s == l {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,129 @@
+package orchestrator
+
+import (
+	"context"
+	"fmt"
+	"go/format"
+	"strings"
+	"sync"
+
+	"ai-dev-agent/service/fence"
+)
+
+// StreamingLLM is implemented by LLM services that can deliver a response
+// as it is generated. The engine then formats each Go block as soon as its
+// closing fence arrives, while the rest of the response streams.
+type StreamingLLM interface {
+	ChatStream(ctx context.Context, messages []Message, onChunk func(chunk string)) (string, error)
+}
+
+// formatted is the gofmt result of a Go block.
+type formatted struct {
+	code string
+	err  error
+}
+
+// preparer formats the Go blocks of a streaming response in the
+// background, keyed by their trimmed code.
+type preparer struct {
+	mu      sync.Mutex
+	wg      sync.WaitGroup
+	text    strings.Builder
+	scanned int
+	results map[string]formatted
+}
+
+func newPreparer() *preparer {
+	return &preparer{results: make(map[string]formatted)}
+}
+
+// write adds a chunk and starts formatting the blocks it completes.
+func (p *preparer) write(chunk string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.text.WriteString(chunk)
+	// Only whole lines are scanned: a partial "```" may yet grow longer.
+	text := p.text.String()
+	end := strings.LastIndexByte(text, '\n') + 1
+	base := p.scanned
+	if end <= base {
+		return
+	}
+	for _, b := range fence.Parse(text[base:end]) {
+		if !b.Closed {
+			break
+		}
+		p.scanned = base + b.End
+		if b.Lang != "go" && b.Lang != "golang" {
+			continue
+		}
+		code := strings.TrimSpace(b.Code)
+		p.wg.Add(1)
+		go func() {
+			defer p.wg.Done()
+			out, err := format.Source([]byte(code))
+			p.mu.Lock()
+			p.results[code] = formatted{code: string(out), err: err}
+			p.mu.Unlock()
+		}()
+	}
+}
+
+// wait returns the formatted blocks once all have finished.
+func (p *preparer) wait() map[string]formatted {
+	if p == nil {
+		return nil
+	}
+	p.wg.Wait()
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.results
+}
+
+// chat sends messages, streaming the response through a preparer when
+// the LLM supports it and Go blocks are formatted.
+func (e *Engine) chat(ctx context.Context, messages []Message) (string, *preparer, error) {
+	s, ok := e.llm.(StreamingLLM)
+	if !ok || !e.config.FormatGo {
+		response, err := e.llm.Chat(ctx, messages)
+		return response, nil, err
+	}
+	prep := newPreparer()
+	response, err := s.ChatStream(ctx, messages, prep.write)
+	return response, prep, err
+}
+
+// formatGo gofmts the blocks written to Go files, using the results the
+// preparer already has. Files not kept in gofmt style are left as they
+// are, but every Go block must parse.
+func (e *Engine) formatGo(files []string, contents map[string]string, blocks []CodeBlock, prep *preparer) error {
+	done := prep.wait()
+	for i := range blocks {
+		target := blocks[i].Filename
+		if i < len(files) {
+			target = files[i]
+		}
+		if !strings.HasSuffix(target, ".go") {
+			continue
+		}
+		r, ok := done[blocks[i].Code]
+		if !ok {
+			out, err := format.Source([]byte(blocks[i].Code))
+			r = formatted{code: string(out), err: err}
+		}
+		if r.err != nil {
+			return fmt.Errorf("%s: %w", target, r.err)
+		}
+		if original := contents[target]; original == "" || isGofmted(original) {
+			blocks[i].Code = strings.TrimSpace(r.code)
+		}
+	}
+	return nil
+}
+
+// isGofmted reports whether src is gofmt'ed, ignoring the final newline
+// that written blocks lack.
+func isGofmted(src string) bool {
+	out, err := format.Source([]byte(src))
+	return err == nil && strings.TrimSpace(string(out)) == strings.TrimSpace(src)
+}
@@ -0,0 +1,107 @@
+package orchestrator
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// ErrRefused stops a request that would send sensitive content to the
+// LLM. It is never retried.
+var ErrRefused = errors.New("refused to send to the LLM")
+
+// RefusalRule matches content that must never leave the machine, by path
+// or by what it contains.
+type RefusalRule struct {
+	// Path is a pattern in the manner of .gitignore: one ending in /
+	// matches what is under a directory, and one without another /
+	// matches at any depth, e.g. deploy/prod/ or *.tfstate.
+	Path string `yaml:"path"`
+	// Content is text the content contains, e.g. a key's PEM header.
+	Content string `yaml:"content"`
+	Reason  string `yaml:"reason"`
+}
+
+// Refusals are the rules a request is checked against before anything is
+// sent.
+type Refusals []RefusalRule
+
+// DefaultRefusals always apply: private keys and terraform state, which
+// holds the secrets of the resources it manages in plain text.
+var DefaultRefusals = Refusals{
+	// The PEM label is split so this file isn't refused itself.
+	{Content: "PRIVATE " + "KEY-----", Reason: "private key"},
+	{Path: "*.tfstate", Reason: "terraform state, which holds secrets in plain text"},
+	{Path: "*.tfstate.backup", Reason: "terraform state, which holds secrets in plain text"},
+}
+
+// Check returns an ErrRefused error explaining the first rule a file
+// matches.
+func (r Refusals) Check(file, content string) error {
+	slashed := filepath.ToSlash(filepath.Clean(file))
+	for _, rule := range r {
+		if rule.Path != "" && matchPath(rule.Path, slashed) {
+			return rule.refuse(file, "path "+rule.Path)
+		}
+		if rule.Content != "" && strings.Contains(content, rule.Content) {
+			return rule.refuse(file, "content "+rule.Content)
+		}
+	}
+	return nil
+}
+
+// CheckContent is Check of text that isn't a file, such as a prompt,
+// against the rules of content.
+func (r Refusals) CheckContent(what, text string) error {
+	for _, rule := range r {
+		if rule.Content != "" && strings.Contains(text, rule.Content) {
+			return rule.refuse(what, "content "+rule.Content)
+		}
+	}
+	return nil
+}
+
+// Validate rejects rules that match nothing and malformed patterns.
+func (r Refusals) Validate() error {
+	for i, rule := range r {
+		if rule.Path == "" && rule.Content == "" {
+			return fmt.Errorf("rule %d has neither a path nor content", i+1)
+		}
+		if _, err := path.Match(strings.Trim(rule.Path, "/"), ""); err != nil {
+			return fmt.Errorf("rule %d: %s: %w", i+1, rule.Path, err)
+		}
+	}
+	return nil
+}
+
+func (rule RefusalRule) refuse(what, matched string) error {
+	reason := rule.Reason
+	if reason == "" {
+		reason = "sensitive"
+	}
+	return fmt.Errorf("%w: %s: %s (rule: %s); leave it out of the request", ErrRefused, what, reason, matched)
+}
+
+// matchPath reports whether a slash-separated path matches a refusal
+// rule's pattern.
+func matchPath(pattern, p string) bool {
+	dir := strings.HasSuffix(pattern, "/")
+	pattern = strings.Trim(pattern, "/")
+	parts := strings.Split(p, "/")
+	n := strings.Count(pattern, "/") + 1
+	for i := 0; i+n <= len(parts); i++ {
+		if n > 1 && i > 0 {
+			break // anchored at the root
+		}
+		// A directory has something under it; a file is the last element.
+		if end := i + n; dir != (end < len(parts)) {
+			continue
+		}
+		if ok, _ := path.Match(pattern, strings.Join(parts[i:i+n], "/")); ok {
+			return true
+		}
+	}
+	return false
+}
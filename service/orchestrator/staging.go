@@ -0,0 +1,231 @@
+package orchestrator
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// stagingSkipDirs are never copied into a verification tree.
+var stagingSkipDirs = map[string]bool{".git": true, ".aidev": true, ".ai-backup": true}
+
+// stage holds the candidate files of one attempt until they are verified.
+type stage struct {
+	dir   string
+	files map[string]string // workspace-relative path -> content
+}
+
+func newStage(baseDir string) (*stage, error) {
+	if err := os.MkdirAll(baseDir, 0755); err != nil {
+		return nil, err
+	}
+	dir, err := os.MkdirTemp(baseDir, "attempt-")
+	if err != nil {
+		return nil, err
+	}
+	return &stage{dir: dir, files: make(map[string]string)}, nil
+}
+
+// put writes a candidate file into the staging directory.
+func (s *stage) put(path, content string) error {
+	target := filepath.Join(s.dir, filepath.FromSlash(path))
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return err
+	}
+	if err := os.WriteFile(target, []byte(content), 0644); err != nil {
+		return err
+	}
+	s.files[path] = content
+	return nil
+}
+
+// paths returns the staged paths in a stable order.
+func (s *stage) paths() []string {
+	paths := make([]string, 0, len(s.files))
+	for p := range s.files {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// tree materializes a copy of workDir with the staged files applied and
+// returns its location. The copy lives inside the staging directory.
+func (s *stage) tree(workDir string) (string, error) {
+	root := filepath.Join(s.dir, ".tree")
+	err := filepath.WalkDir(workDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, _ := filepath.Rel(workDir, path)
+		if d.IsDir() {
+			if stagingSkipDirs[d.Name()] && rel != "." {
+				return fs.SkipDir
+			}
+			return os.MkdirAll(filepath.Join(root, rel), 0755)
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		return copyFile(path, filepath.Join(root, rel))
+	})
+	if err != nil {
+		return "", fmt.Errorf("copy tree: %w", err)
+	}
+
+	for path, content := range s.files {
+		target := filepath.Join(root, filepath.FromSlash(path))
+		if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			return "", err
+		}
+		if err := os.WriteFile(target, []byte(content), 0644); err != nil {
+			return "", err
+		}
+	}
+	return root, nil
+}
+
+// overlay writes a `go build -overlay` file that maps the real paths of the
+// staged files to their staged copies, and returns its path. The workspace
+// itself is never modified.
+func (s *stage) overlay(workDir string) (string, error) {
+	absWork, err := filepath.Abs(workDir)
+	if err != nil {
+		return "", err
+	}
+	replace := make(map[string]string, len(s.files))
+	for path := range s.files {
+		real := filepath.Join(absWork, filepath.FromSlash(path))
+		replace[real] = filepath.Join(s.dir, filepath.FromSlash(path))
+	}
+	data, err := json.MarshalIndent(map[string]map[string]string{"Replace": replace}, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	overlayPath := filepath.Join(s.dir, "overlay.json")
+	if err := os.WriteFile(overlayPath, data, 0644); err != nil {
+		return "", err
+	}
+	return overlayPath, nil
+}
+
+// discard removes the staging directory.
+func (s *stage) discard() {
+	os.RemoveAll(s.dir)
+}
+
+// stageFiles maps code blocks to target files like writeFiles, but only
+// writes them into the staging area.
+func (e *Engine) stageFiles(st *stage, workDir string, files []string, blocks []CodeBlock) ([]string, error) {
+	written := []string{}
+	for i, block := range blocks {
+		targetPath, err := e.blockTarget(i, files, block)
+		if err != nil {
+			return written, err
+		}
+		if targetPath == "" {
+			continue
+		}
+		rel, err := workspaceRel(workDir, targetPath)
+		if err == nil {
+			err = ValidatePath(rel)
+		}
+		if err != nil {
+			return written, fmt.Errorf("%s: %w", targetPath, err)
+		}
+		if err := st.put(rel, block.Code); err != nil {
+			return written, fmt.Errorf("%s: %w", targetPath, err)
+		}
+		written = append(written, targetPath)
+		e.logInfo("Staged: %s", targetPath)
+		e.emit(Event{Type: EventWrite, File: targetPath})
+	}
+	return written, nil
+}
+
+// applyStage syncs verified staged files into the workspace.
+func (e *Engine) applyStage(st *stage) error {
+	for _, path := range st.paths() {
+		if err := e.file.WriteFile(path, st.files[path]); err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		e.logInfo("Wrote: %s", path)
+	}
+	return nil
+}
+
+// addDependencies runs the Dependencies hook on the candidates. Staged,
+// it edits copies of go.mod and go.sum in the stage, so the workspace's
+// are only changed when the attempt is applied; copies it leaves as they
+// were are dropped.
+func (e *Engine) addDependencies(ctx context.Context, workDir string, st *stage, written []string) error {
+	candidates := e.candidates(st, written)
+	if st == nil {
+		return e.config.Dependencies(ctx, workDir, filepath.Join(workDir, "go.mod"), candidates)
+	}
+	if !isGoModule(workDir) {
+		return nil
+	}
+	original := make(map[string]string)
+	for _, name := range []string{"go.mod", "go.sum"} {
+		if _, ok := st.files[name]; ok {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(workDir, name))
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		if err := st.put(name, string(data)); err != nil {
+			return err
+		}
+		original[name] = string(data)
+	}
+	hookErr := e.config.Dependencies(ctx, workDir, filepath.Join(st.dir, "go.mod"), candidates)
+	for _, name := range []string{"go.mod", "go.sum"} {
+		data, err := os.ReadFile(filepath.Join(st.dir, name))
+		if err != nil {
+			return err
+		}
+		if before, copied := original[name]; copied && before == string(data) {
+			delete(st.files, name)
+		} else {
+			st.files[name] = string(data)
+		}
+	}
+	return hookErr
+}
+
+// Helper functions
+
+func workspaceRel(workDir, path string) (string, error) {
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(workDir, path)
+	}
+	rel, err := filepath.Rel(workDir, filepath.Clean(path))
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("path outside workspace")
+	}
+	return filepath.ToSlash(rel), nil
+}
+
+func isGoModule(dir string) bool {
+	_, err := os.Stat(filepath.Join(dir, "go.mod"))
+	return err == nil
+}
+
+func copyFile(src, dst string) error {
+	data, err := os.ReadFile(src)
+	if err != nil {
+		return err
+	}
+	info, err := os.Stat(src)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(dst, data, info.Mode().Perm())
+}
@@ -0,0 +1,77 @@
+package orchestrator
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const testGoMod = "module example.com/m\n\ngo 1.21\n"
+
+func TestAddDependenciesStaged(t *testing.T) {
+	workDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(workDir, "go.mod"), []byte(testGoMod), 0644); err != nil {
+		t.Fatal(err)
+	}
+	st, err := newStage(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer st.discard()
+	if err := st.put("main.go", "package main\n"); err != nil {
+		t.Fatal(err)
+	}
+
+	required := testGoMod + "\nrequire example.com/dep v1.0.0\n"
+	e := &Engine{config: Config{Dependencies: func(ctx context.Context, dir, modFile string, files map[string]string) error {
+		if dir != workDir {
+			t.Errorf("hook ran in %s, want %s", dir, workDir)
+		}
+		if _, ok := files["main.go"]; !ok {
+			t.Error("hook wasn't given the candidates")
+		}
+		if err := os.WriteFile(modFile, []byte(required), 0644); err != nil {
+			return err
+		}
+		return os.WriteFile(filepath.Join(filepath.Dir(modFile), "go.sum"), []byte("example.com/dep v1.0.0 h1:x=\n"), 0644)
+	}}}
+	if err := e.addDependencies(context.Background(), workDir, st, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if data, _ := os.ReadFile(filepath.Join(workDir, "go.mod")); string(data) != testGoMod {
+		t.Errorf("workspace go.mod was edited before verification:\n%s", data)
+	}
+	if _, err := os.Stat(filepath.Join(workDir, "go.sum")); !os.IsNotExist(err) {
+		t.Errorf("workspace go.sum was written before verification")
+	}
+	if st.files["go.mod"] != required {
+		t.Errorf("staged go.mod = %q, want the hook's edit", st.files["go.mod"])
+	}
+	if _, ok := st.files["go.sum"]; !ok {
+		t.Error("go.sum wasn't staged")
+	}
+}
+
+func TestAddDependenciesStagedUnchanged(t *testing.T) {
+	workDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(workDir, "go.mod"), []byte(testGoMod), 0644); err != nil {
+		t.Fatal(err)
+	}
+	st, err := newStage(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer st.discard()
+
+	e := &Engine{config: Config{Dependencies: func(ctx context.Context, dir, modFile string, files map[string]string) error {
+		return nil
+	}}}
+	if err := e.addDependencies(context.Background(), workDir, st, nil); err != nil {
+		t.Fatal(err)
+	}
+	if len(st.files) != 0 {
+		t.Errorf("staged %v, want nothing for a hook that added no module", st.paths())
+	}
+}
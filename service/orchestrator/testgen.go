@@ -0,0 +1,536 @@
+package orchestrator
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"ai-dev-agent/service/errparse"
+)
+
+// goldenFlagPattern matches a boolean flag declared by a test file, such
+// as var update = flag.Bool("update", false, "update golden files").
+var goldenFlagPattern = regexp.MustCompile(`flag\.Bool\(\s*"([\w.-]+)"`)
+
+// testFuncPattern matches the top-level test functions of a test file.
+var testFuncPattern = regexp.MustCompile(`(?m)^func (Test\w*)\(`)
+
+// identPattern matches the identifiers, and Type.Method selectors, of an
+// instruction.
+var identPattern = regexp.MustCompile(`[\w.]+`)
+
+// goldenConvention is how a package's tests keep their expected output in
+// golden files: a test file declares a flag that rewrites them.
+type goldenConvention struct {
+	Flag string // without the dash, e.g. update
+	File string // the test file declaring it
+}
+
+// targetFunc is a function whose coverage the generated tests must raise
+// above zero.
+type targetFunc struct {
+	Name       string // F, or T.M for methods
+	File       string
+	Start, End int // lines
+}
+
+// GenerateTests writes tests for the Go source files of req, x_test.go
+// for x.go, with the fixtures they read under the package's testdata.
+// Tests of a package that keeps expected output in golden files follow
+// its convention; their golden files are written by running the new
+// tests with the package's update flag rather than by the model. An
+// attempt passes once the tests pass and exercise every target function:
+// those the instruction names, else the exported ones. Tests that leave a
+// target uncovered are retried with the functions they missed. With
+// MutationTesting, tests that pass are run against mutants of the target
+// functions, and the mutants they miss are fed back for one more round.
+func (e *Engine) GenerateTests(ctx context.Context, req *Request) *Result {
+	start := time.Now()
+	result := &Result{}
+
+	e.logInfo("Starting %s operation on %d file(s)", ModeTest, len(req.Files))
+	e.emit(Event{Type: EventStart, Mode: ModeTest, Files: req.Files})
+	defer func() {
+		result.Duration = time.Since(start)
+		ev := Event{Type: EventDone, Mode: ModeTest, Attempt: result.Attempts, Files: result.FilesWritten, DurationMs: result.Duration.Milliseconds(), Success: result.Success}
+		if result.Error != nil {
+			ev.Error = result.Error.Error()
+		}
+		e.emit(ev)
+	}()
+
+	var sources, targets []string
+	for _, path := range req.Files {
+		if strings.HasSuffix(path, ".go") && !strings.HasSuffix(path, "_test.go") {
+			sources = append(sources, path)
+			targets = append(targets, strings.TrimSuffix(path, ".go")+"_test.go")
+		}
+	}
+	if len(sources) == 0 {
+		result.Error = fmt.Errorf("no Go source files to write tests for")
+		return result
+	}
+
+	contextFiles, err := e.readContext(ctx, req.Context)
+	if err != nil {
+		result.Error = fmt.Errorf("read context: %w", err)
+		return result
+	}
+	if contextFiles == nil {
+		contextFiles = make(map[string]string)
+	}
+	dirs := packageDirs(sources)
+	goldens := make(map[string]*goldenConvention)
+	for _, dir := range dirs {
+		g := detectGolden(req.WorkDir, dir)
+		if g == nil {
+			continue
+		}
+		goldens[dir] = g
+		e.logInfo("%s keeps golden files (-%s in %s)", dir, g.Flag, g.File)
+		if content, err := e.file.ReadFile(g.File); err == nil {
+			contextFiles[g.File] = content
+		}
+	}
+
+	// Tests already in the target files aren't new, whatever attempt
+	// rewrites them.
+	original := make(map[string]string)
+	for _, target := range targets {
+		if e.file.FileExists(target) {
+			content, err := e.file.ReadFile(target)
+			if err != nil {
+				result.Error = fmt.Errorf("read files: %w", err)
+				return result
+			}
+			original[target] = content
+		}
+		delete(contextFiles, target)
+	}
+
+	var output []CodeBlock // of the current attempt
+	fail := func(stage string, err error) {
+		result.Error = err
+		result.History = append(result.History, AttemptRecord{Attempt: result.Attempts, Stage: stage, Error: err.Error(), Files: blockFiles(targets, output)})
+		e.emit(Event{Type: EventFailure, Attempt: result.Attempts, Stage: stage, Error: err.Error()})
+	}
+
+	strengthened := false
+	for attempt := 1; attempt <= e.config.MaxRetries; attempt++ {
+		result.Attempts = attempt
+		output = nil
+		e.logInfo("Attempt %d/%d", attempt, e.config.MaxRetries)
+		e.emit(Event{Type: EventAttempt, Attempt: attempt})
+
+		files, err := e.readFiles(sources)
+		if err != nil {
+			fail("read", fmt.Errorf("read files: %w", err))
+			if errors.Is(err, ErrRefused) {
+				break
+			}
+			continue
+		}
+		funcs := targetFuncs(files, req.Instruction)
+		refused := false
+		for _, target := range targets {
+			if e.file.FileExists(target) {
+				if content, err := e.file.ReadFile(target); err == nil {
+					if err := e.screen(target, content); err != nil {
+						fail("read", err)
+						refused = true
+						break
+					}
+					files[target] = content
+				}
+			}
+		}
+		if refused {
+			break
+		}
+
+		instruction := testInstruction(req.Instruction, targets, goldens) + testFeedback(result.History, e.feedbackBytes())
+		messages, err := e.buildPrompt(&Request{Mode: ModeTest, Instruction: instruction, Constraints: req.Constraints}, files, contextFiles)
+		if err != nil {
+			fail("prompt", fmt.Errorf("build prompt: %w", err))
+			continue
+		}
+		response, err := e.llm.Chat(ctx, messages)
+		if err != nil {
+			fail("llm", fmt.Errorf("LLM call: %w", err))
+			if !e.isRetryable(err) {
+				break
+			}
+			continue
+		}
+		e.logInfo("LLM response received (%d chars)", len(response))
+		e.emit(Event{Type: EventResponse, Attempt: attempt, Chars: len(response)})
+
+		blocks := e.parseCodeBlocks(response)
+		if len(blocks) == 0 {
+			fail("parse", fmt.Errorf("no code blocks found in response"))
+			continue
+		}
+		output = blocks
+		if err := e.checkWriteLimits(targets, blocks); err != nil {
+			fail("limit", err)
+			continue
+		}
+		written, err := e.writeTestFiles(targets, dirs, blocks)
+		result.FilesWritten = mergeWritten(result.FilesWritten, written)
+		if err != nil {
+			fail("write", fmt.Errorf("write files: %w", err))
+			continue
+		}
+
+		if stage, err := e.verifyGeneratedTests(ctx, attempt, req.WorkDir, dirs, targets, original, goldens, funcs, result); err != nil {
+			fail(stage, err)
+			e.logError("Generated tests rejected: %v", err)
+			continue
+		}
+		if e.config.MutationTesting {
+			report, err := e.mutationPass(ctx, req.WorkDir, targets, original, funcs)
+			if err != nil {
+				// The tests themselves passed.
+				e.logError("Mutation pass failed: %v", err)
+			}
+			result.Mutation = report
+			// Weak tests get one more round, when the budget allows.
+			if report != nil && len(report.Survivors()) > 0 && !strengthened && attempt < e.config.MaxRetries {
+				strengthened = true
+				fail("mutation", fmt.Errorf("%s", mutationFeedback(report)))
+				continue
+			}
+		}
+		result.Success = true
+		result.Error = nil
+		result.Explanation = e.extractExplanation(response)
+		break
+	}
+	return result
+}
+
+// verifyGeneratedTests runs the new tests of each package, first with
+// the package's golden-file flag so the golden files they compare against
+// exist, then plainly with coverage. It returns the stage that failed.
+func (e *Engine) verifyGeneratedTests(ctx context.Context, attempt int, workDir string, dirs, targets []string, before map[string]string, goldens map[string]*goldenConvention, funcs []targetFunc, result *Result) (string, error) {
+	for _, dir := range dirs {
+		pkg := "./" + filepath.ToSlash(dir)
+		run, err := e.newTestPattern(dir, targets, before)
+		if err != nil {
+			return "test", err
+		}
+
+		if g := goldens[dir]; g != nil {
+			testdata := filepath.Join(dir, "testdata")
+			old := readDir(workDir, testdata)
+			// Update flags seldom create the directory they write to.
+			if err := os.MkdirAll(filepath.Join(workDir, testdata), 0755); err != nil {
+				return "write", err
+			}
+			if _, err := e.runVerification(ctx, attempt, workDir, []string{"test", run, pkg, "-args", "-" + g.Flag}, result); err != nil {
+				return "test", fmt.Errorf("tests failed: %w", err)
+			}
+			for name, content := range readDir(workDir, testdata) {
+				if prev, ok := old[name]; !ok || prev != content {
+					path := filepath.Join(testdata, name)
+					result.FilesWritten = mergeWritten(result.FilesWritten, []string{path})
+					e.logInfo("Wrote: %s (-%s)", path, g.Flag)
+					e.emit(Event{Type: EventWrite, File: path})
+				}
+			}
+		}
+
+		profile, err := os.CreateTemp("", "aidev-cover-*.out")
+		if err != nil {
+			return "test", err
+		}
+		profile.Close()
+		defer os.Remove(profile.Name())
+		if _, err := e.runVerification(ctx, attempt, workDir, []string{"test", run, "-coverprofile=" + profile.Name(), pkg}, result); err != nil {
+			return "test", fmt.Errorf("tests failed: %w", err)
+		}
+		data, err := os.ReadFile(profile.Name())
+		if err != nil {
+			return "test", fmt.Errorf("read coverage: %w", err)
+		}
+		var missed []string
+		for _, f := range funcs {
+			if filepath.Dir(f.File) == dir && !coversFunc(string(data), f) {
+				missed = append(missed, f.Name)
+			}
+		}
+		if len(missed) > 0 {
+			return "coverage", fmt.Errorf("%s: the new tests never call %s", pkg, strings.Join(missed, ", "))
+		}
+	}
+	return "", nil
+}
+
+// newTestPattern returns the -run flag selecting the test functions of
+// the package in dir that before lacks.
+func (e *Engine) newTestPattern(dir string, targets []string, before map[string]string) (string, error) {
+	var names []string
+	for _, target := range targets {
+		if filepath.Dir(target) != dir {
+			continue
+		}
+		content, err := e.file.ReadFile(target)
+		if err != nil {
+			return "", err
+		}
+		names = append(names, newTests(before[target], content)...)
+	}
+	if len(names) == 0 {
+		return "", fmt.Errorf("./%s: no new Test functions were written", filepath.ToSlash(dir))
+	}
+	return "-run=^(" + strings.Join(names, "|") + ")$", nil
+}
+
+// writeTestFiles writes the test files, then the fixtures: further blocks
+// named after a file in a package's testdata directory.
+func (e *Engine) writeTestFiles(targets, dirs []string, blocks []CodeBlock) ([]string, error) {
+	var written []string
+	for i, block := range blocks {
+		path := ""
+		if i < len(targets) {
+			path = targets[i]
+		} else if block.Filename != "" {
+			if !isFixture(block.Filename, dirs) {
+				return written, fmt.Errorf("%w: %s is neither a test file nor a testdata fixture", ErrUnsafePath, block.Filename)
+			}
+			if err := validateModelPath(block.Filename, []string{strings.ToLower(filepath.Ext(block.Filename))}); err != nil {
+				return written, err
+			}
+			path = block.Filename
+		}
+		if path == "" {
+			continue
+		}
+		if err := e.file.WriteFile(path, block.Code); err != nil {
+			return written, fmt.Errorf("%s: %w", path, err)
+		}
+		written = append(written, path)
+		e.logInfo("Wrote: %s", path)
+		e.emit(Event{Type: EventWrite, File: path})
+	}
+	return written, nil
+}
+
+// detectGolden returns the golden-file convention of the package in dir,
+// if its tests have one: a flag named like update or golden, declared by
+// a test file that reads testdata.
+func detectGolden(workDir, dir string) *goldenConvention {
+	entries, err := os.ReadDir(filepath.Join(workDir, dir))
+	if err != nil {
+		return nil
+	}
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasSuffix(name, "_test.go") {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(workDir, dir, name))
+		if err != nil || !strings.Contains(string(data), "testdata") {
+			continue
+		}
+		for _, m := range goldenFlagPattern.FindAllStringSubmatch(string(data), -1) {
+			flag := strings.ToLower(m[1])
+			if strings.Contains(flag, "update") || strings.Contains(flag, "golden") {
+				return &goldenConvention{Flag: m[1], File: filepath.Join(dir, name)}
+			}
+		}
+	}
+	return nil
+}
+
+// Helper functions
+
+func testInstruction(instruction string, targets []string, goldens map[string]*goldenConvention) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Write tests for: %s\nTest files, in order: %s", instruction, strings.Join(targets, ", "))
+	b.WriteString("\nReturn each test file in full, keeping its existing tests. Put input fixtures the tests read under the package's testdata directory, each in a further code block preceded by its own line: --- FILE: <path> ---")
+	dirs := make([]string, 0, len(goldens))
+	for dir := range goldens {
+		dirs = append(dirs, dir)
+	}
+	sort.Strings(dirs)
+	for _, dir := range dirs {
+		g := goldens[dir]
+		fmt.Fprintf(&b, "\nThe tests in %s compare output with golden files under testdata, rewritten when run with -%s (see %s). Follow that pattern and reuse its flag; don't write the golden files, they are generated by running the new tests with -%s.", dir, g.Flag, g.File, g.Flag)
+	}
+	return b.String()
+}
+
+// testFeedback tells the next attempt why the last one was rejected.
+func testFeedback(history []AttemptRecord, maxBytes int) string {
+	n := len(history)
+	if n == 0 {
+		return ""
+	}
+	last := history[n-1]
+	switch last.Stage {
+	case "coverage":
+		return fmt.Sprintf("\n\nYour previous tests passed but don't exercise every target: %s. Add test cases that call them.", last.Error)
+	case "test":
+		return fmt.Sprintf("\n\nYour previous tests failed:\n%s\nFix the tests and fixtures; the code under test is not to be changed.", errparse.Condense(strings.TrimPrefix(last.Error, "tests failed: "), maxBytes))
+	case "mutation":
+		return fmt.Sprintf("\n\nYour previous tests passed, but they miss behavior: each change below to the code under test left them passing.\n%s\nKeep the tests and add assertions that fail for these changes.", last.Error)
+	case "limit", "write":
+		return fmt.Sprintf("\n\nYour previous response was rejected: %s. Return only the test files and testdata fixtures.", last.Error)
+	}
+	return ""
+}
+
+// targetFuncs returns the functions of the Go files in files that the
+// instruction names, or the exported ones when it names none (all of
+// them in a package with nothing exported).
+func targetFuncs(files map[string]string, instruction string) []targetFunc {
+	var all []targetFunc
+	paths := make([]string, 0, len(files))
+	for path := range files {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	for _, path := range paths {
+		fset := token.NewFileSet()
+		file, err := parser.ParseFile(fset, path, files[path], 0)
+		if err != nil {
+			continue
+		}
+		for _, decl := range file.Decls {
+			fn, ok := decl.(*ast.FuncDecl)
+			if !ok || fn.Body == nil || fn.Name.Name == "init" || fn.Name.Name == "main" {
+				continue
+			}
+			name := fn.Name.Name
+			if fn.Recv != nil && len(fn.Recv.List) > 0 {
+				name = receiverType(fn.Recv.List[0].Type) + "." + name
+			}
+			all = append(all, targetFunc{Name: name, File: path, Start: fset.Position(fn.Pos()).Line, End: fset.Position(fn.End()).Line})
+		}
+	}
+
+	words := make(map[string]bool)
+	for _, w := range identPattern.FindAllString(instruction, -1) {
+		words[w] = true
+	}
+	var named, exported []targetFunc
+	for _, f := range all {
+		_, method, isMethod := strings.Cut(f.Name, ".")
+		if words[f.Name] || isMethod && words[method] {
+			named = append(named, f)
+		}
+		last := f.Name
+		if isMethod {
+			last = method
+		}
+		if ast.IsExported(last) {
+			exported = append(exported, f)
+		}
+	}
+	switch {
+	case len(named) > 0:
+		return named
+	case len(exported) > 0:
+		return exported
+	}
+	return all
+}
+
+// coversFunc reports whether a coverage profile counts a run of any
+// statement of f.
+func coversFunc(profile string, f targetFunc) bool {
+	suffix := "/" + filepath.Base(f.File) + ":"
+	for _, line := range strings.Split(profile, "\n") {
+		// path/file.go:startLine.startCol,endLine.endCol statements count
+		i := strings.LastIndex(line, ":")
+		if i < 0 || !strings.HasSuffix(line[:i+1], suffix) {
+			continue
+		}
+		fields := strings.Fields(line[i+1:])
+		if len(fields) != 3 || fields[2] == "0" {
+			continue
+		}
+		startLine, _, _ := strings.Cut(fields[0], ".")
+		n, err := strconv.Atoi(startLine)
+		if err == nil && n >= f.Start && n <= f.End {
+			return true
+		}
+	}
+	return false
+}
+
+// newTests returns the test functions of after that before lacks.
+func newTests(before, after string) []string {
+	old := make(map[string]bool)
+	for _, m := range testFuncPattern.FindAllStringSubmatch(before, -1) {
+		old[m[1]] = true
+	}
+	var names []string
+	for _, m := range testFuncPattern.FindAllStringSubmatch(after, -1) {
+		if !old[m[1]] {
+			names = append(names, m[1])
+		}
+	}
+	return names
+}
+
+func packageDirs(sources []string) []string {
+	seen := make(map[string]bool)
+	var dirs []string
+	for _, path := range sources {
+		if dir := filepath.Dir(path); !seen[dir] {
+			seen[dir] = true
+			dirs = append(dirs, dir)
+		}
+	}
+	return dirs
+}
+
+func isFixture(path string, dirs []string) bool {
+	clean := filepath.Clean(path)
+	for _, dir := range dirs {
+		if strings.HasPrefix(clean, filepath.Join(dir, "testdata")+string(filepath.Separator)) {
+			return true
+		}
+	}
+	return false
+}
+
+// readDir returns the contents of the files in dir, by name.
+func readDir(workDir, dir string) map[string]string {
+	files := make(map[string]string)
+	entries, _ := os.ReadDir(filepath.Join(workDir, dir))
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		if data, err := os.ReadFile(filepath.Join(workDir, dir, entry.Name())); err == nil {
+			files[entry.Name()] = string(data)
+		}
+	}
+	return files
+}
+
+func mergeWritten(all, written []string) []string {
+	for _, path := range written {
+		seen := false
+		for _, p := range all {
+			seen = seen || p == path
+		}
+		if !seen {
+			all = append(all, path)
+		}
+	}
+	return all
+}
@@ -0,0 +1,134 @@
+package orchestrator
+
+import (
+	"context"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// verifyTests runs the tests for an attempt that built. The tests of the
+// packages matching patterns run first, limited to those named after
+// symbols when there are any; the whole suite runs only once they pass,
+// so a broken fix fails after seconds rather than after the full suite.
+func (e *Engine) verifyTests(ctx context.Context, attempt int, workDir, overlay string, patterns, symbols []string, result *Result) error {
+	args := []string{"test"}
+	if overlay != "" {
+		args = append(args, "-overlay="+overlay)
+	}
+
+	if len(patterns) > 0 || len(symbols) > 0 {
+		targeted := append([]string(nil), args...)
+		if len(symbols) > 0 {
+			targeted = append(targeted, "-run="+testPattern(symbols))
+		}
+		if len(patterns) == 0 {
+			patterns = []string{"./..."}
+		}
+		if _, err := e.runVerification(ctx, attempt, workDir, append(targeted, patterns...), result); err != nil {
+			return err
+		}
+	}
+	_, err := e.runVerification(ctx, attempt, workDir, append(args, "./..."), result)
+	return err
+}
+
+// changedSymbols returns the top-level functions and types of the Go
+// files in after that are new or differ from before. Methods count as
+// their receiver type, which is what their tests are usually named after.
+func changedSymbols(before, after map[string]string) []string {
+	seen := make(map[string]bool)
+	for path, content := range after {
+		if !strings.HasSuffix(path, ".go") || strings.HasSuffix(path, "_test.go") {
+			continue
+		}
+		old := declSources(before[path])
+		for key, src := range declSources(content) {
+			if old[key] == src {
+				continue
+			}
+			if name, _, _ := strings.Cut(key, "."); name != "" {
+				seen[name] = true
+			}
+		}
+	}
+	symbols := make([]string, 0, len(seen))
+	for name := range seen {
+		symbols = append(symbols, name)
+	}
+	sort.Strings(symbols)
+	return symbols
+}
+
+// Helper functions
+
+// declSources maps the top-level functions ("F"), methods ("T.M") and
+// types ("T") of a Go file to their source. A file that doesn't parse
+// has none.
+func declSources(src string) map[string]string {
+	decls := make(map[string]string)
+	if src == "" {
+		return decls
+	}
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "", src, 0)
+	if err != nil {
+		return decls
+	}
+	text := func(n ast.Node) string {
+		return src[fset.Position(n.Pos()).Offset:fset.Position(n.End()).Offset]
+	}
+	for _, decl := range file.Decls {
+		switch d := decl.(type) {
+		case *ast.FuncDecl:
+			key := d.Name.Name
+			if d.Recv != nil && len(d.Recv.List) > 0 {
+				key = receiverType(d.Recv.List[0].Type) + "." + key
+			}
+			decls[key] = text(d)
+		case *ast.GenDecl:
+			if d.Tok != token.TYPE {
+				continue
+			}
+			for _, spec := range d.Specs {
+				ts := spec.(*ast.TypeSpec)
+				decls[ts.Name.Name] = text(ts)
+			}
+		}
+	}
+	return decls
+}
+
+// receiverType returns the type name of a method receiver.
+func receiverType(expr ast.Expr) string {
+	for {
+		switch t := expr.(type) {
+		case *ast.StarExpr:
+			expr = t.X
+		case *ast.IndexExpr:
+			expr = t.X
+		case *ast.IndexListExpr:
+			expr = t.X
+		case *ast.Ident:
+			return t.Name
+		default:
+			return ""
+		}
+	}
+}
+
+// testPattern is a -run pattern for the tests named after symbols:
+// TestParse and TestParse_empty for parse, TestClient_Do for Client.
+func testPattern(symbols []string) string {
+	names := make([]string, len(symbols))
+	for i, s := range symbols {
+		r, n := utf8.DecodeRuneInString(s)
+		names[i] = regexp.QuoteMeta(string(unicode.ToUpper(r)) + s[n:])
+	}
+	return "^Test(" + strings.Join(names, "|") + ")"
+}
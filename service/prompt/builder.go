@@ -3,13 +3,20 @@ package prompt
 
 import (
         "encoding/json"
+        "errors"
         "fmt"
         "path/filepath"
-        "regexp"
         "sort"
         "strings"
+
+        "ai-dev-agent/service/fence"
+        "ai-dev-agent/service/llm"
 )
 
+// ErrPromptTooLarge is returned when a prompt does not fit the model's
+// context window after reserving room for the output.
+var ErrPromptTooLarge = errors.New("prompt exceeds the model context window")
+
 // InstructionMode defines the type of instruction.
 type InstructionMode string
 
@@ -58,6 +65,22 @@ func DefaultConfig() Config {
         }
 }
 
+// ConfigForModel returns a config sized to the model's context window and
+// output limit, falling back to DefaultConfig for unknown models.
+func ConfigForModel(model string) Config {
+        info, ok := llm.LookupModel(model)
+        if !ok {
+                return DefaultConfig()
+        }
+        return Config{MaxTotalTokens: info.ContextWindow, MaxOutputTokens: info.MaxOutput}
+}
+
+// EstimateTokens approximates the token count of text (about four
+// characters per token for code and English).
+func EstimateTokens(text string) int {
+        return (len(text) + 3) / 4
+}
+
 // ModeTemplates contains system prompts.
 var ModeTemplates = map[string]string{
         "refactor": `You are an expert software architect. Refactor the provided code according to the instructions.
@@ -91,7 +114,13 @@ Rules:
 Return your explanation in clear, structured text.`,
 
         "review": `You are an expert code reviewer. Review the provided code.
-Identify issues, suggest improvements, and rate the code quality.`,
+Identify issues, suggest improvements, and rate the code quality.
+
+Report each finding as a conventional comment, one per paragraph:
+<label> (<decorations>): <file>:<line>: <subject>
+<discussion, optional, on the following lines>
+
+The label is one of praise, nitpick, suggestion, issue or question. The decorations are blocking or non-blocking, optionally followed by the topic, e.g. (blocking, security). Cite the file and line of each finding; leave them out only for findings about the code as a whole.`,
 
         "test": `You are an expert test engineer. Generate comprehensive tests for the provided code.
 Return the test code in a markdown code block.`,
@@ -103,14 +132,18 @@ type Builder struct {
         mode        string
         instruction string
         files       map[string]string
+        loaders     map[string]func() (string, error)
+        readOnly    map[string]bool
         constraints []string
 }
 
 // NewBuilder creates a new builder.
 func NewBuilder(config Config) *Builder {
         return &Builder{
-                config: config,
-                files:  make(map[string]string),
+                config:   config,
+                files:    make(map[string]string),
+                loaders:  make(map[string]func() (string, error)),
+                readOnly: make(map[string]bool),
         }
 }
 
@@ -126,40 +159,64 @@ func (b *Builder) SetInstruction(instruction string) *Builder {
         return b
 }
 
-// AddFile adds a file.
+// AddFile adds a file. Files that aren't main are shown for reference and
+// labeled read-only.
 func (b *Builder) AddFile(path, content string, isMain bool) *Builder {
         b.files[path] = content
+        delete(b.loaders, path)
+        b.setReadOnly(path, !isMain)
+        return b
+}
+
+// AddFileFunc adds a file whose content is loaded by load when the prompt
+// is built, so that a caller offering many files holds none of them until
+// then.
+func (b *Builder) AddFileFunc(path string, load func() (string, error), isMain bool) *Builder {
+        b.loaders[path] = load
+        delete(b.files, path)
+        b.setReadOnly(path, !isMain)
         return b
 }
 
+func (b *Builder) setReadOnly(path string, readOnly bool) {
+        if readOnly {
+                b.readOnly[path] = true
+        } else {
+                delete(b.readOnly, path)
+        }
+}
+
 // AddConstraint adds a constraint.
 func (b *Builder) AddConstraint(constraint string) *Builder {
         b.constraints = append(b.constraints, constraint)
         return b
 }
 
-// Build builds the prompt.
+// Build builds the prompt. The files added with AddFileFunc are loaded
+// here, and the prompt's size is checked against the context window
+// before it is assembled.
 func (b *Builder) Build() (*PromptResult, error) {
-        var messages []Message
-
-        // System message
+        files, err := b.promptFiles()
+        if err != nil {
+                return nil, err
+        }
         systemPrompt := b.getSystemPrompt()
-        messages = append(messages, Message{
-                Role:    RoleSystem,
-                Content: systemPrompt,
-        })
+        size := b.userPromptSize(files)
 
-        // User message
-        userPrompt := b.buildUserPrompt()
-        messages = append(messages, Message{
-                Role:    RoleUser,
-                Content: userPrompt,
-        })
+        if b.config.MaxTotalTokens > 0 {
+                budget := b.config.MaxTotalTokens - b.config.MaxOutputTokens
+                if used := EstimateTokens(systemPrompt) + (size+3)/4; used > budget {
+                        return nil, fmt.Errorf("%w: ~%d tokens, limit %d", ErrPromptTooLarge, used, budget)
+                }
+        }
 
         return &PromptResult{
-                Version:  "1.0",
-                Mode:     b.mode,
-                Messages: messages,
+                Version: "1.0",
+                Mode:    b.mode,
+                Messages: []Message{
+                        {Role: RoleSystem, Content: systemPrompt},
+                        {Role: RoleUser, Content: b.buildUserPrompt(files, size)},
+                },
         }, nil
 }
 
@@ -170,47 +227,137 @@ func (b *Builder) getSystemPrompt() string {
         return ModeTemplates["generate"]
 }
 
-func (b *Builder) buildUserPrompt() string {
+// promptFile is a file as it appears in the user prompt.
+type promptFile struct {
+        path    string
+        label   string
+        fence   string
+        lang    string
+        content string
+}
+
+// promptFiles loads the files of the prompt in order, editable ones first.
+func (b *Builder) promptFiles() ([]promptFile, error) {
+        paths := make([]string, 0, len(b.files)+len(b.loaders))
+        for p := range b.files {
+                paths = append(paths, p)
+        }
+        for p := range b.loaders {
+                paths = append(paths, p)
+        }
+        sort.Slice(paths, func(i, j int) bool {
+                if b.readOnly[paths[i]] != b.readOnly[paths[j]] {
+                        return !b.readOnly[paths[i]]
+                }
+                return paths[i] < paths[j]
+        })
+
+        files := make([]promptFile, len(paths))
+        for i, path := range paths {
+                content, ok := b.files[path]
+                if !ok {
+                        var err error
+                        if content, err = b.loaders[path](); err != nil {
+                                return nil, fmt.Errorf("load %s: %w", path, err)
+                        }
+                }
+                f := promptFile{path: path, fence: fence.For(content), lang: detectLanguage(path), content: content}
+                if b.readOnly[path] {
+                        f.label = readOnlyLabel
+                }
+                files[i] = f
+        }
+        return files, nil
+}
+
+// The fixed parts of the user prompt.
+const (
+        readOnlyLabel  = " (read-only, for reference)"
+        readOnlyRule   = "Files marked read-only are for reference only: do not return code for them"
+        responseFormat = "\nProvide your response with code in markdown code blocks (```language\\ncode\\n```)." +
+                " Fence a file that itself contains ``` with four or more backticks (````)."
+)
+
+// userPromptSize is the length of the user prompt for files, so that it
+// can be checked and written into a buffer of the right size: with
+// hundreds of files, growing the buffer copied every file several times.
+func (b *Builder) userPromptSize(files []promptFile) int {
+        n := len(responseFormat)
+        if b.instruction != "" {
+                n += len("## Task: \n\n### Instruction:\n\n\n") + len(b.mode) + len(b.instruction)
+        }
+        if constraints := b.promptConstraints(); len(constraints) > 0 {
+                n += len("### Constraints:\n\n")
+                for _, c := range constraints {
+                        n += len("- \n") + len(c)
+                }
+        }
+        if len(files) > 0 {
+                n += len("### Files:\n")
+        }
+        for _, f := range files {
+                n += len("\n--- FILE:  ---\n\n\n\n") + len(f.path) + len(f.label) + 2*len(f.fence) + len(f.lang) + len(f.content)
+        }
+        return n
+}
+
+// buildUserPrompt writes the user prompt into a buffer of size bytes.
+func (b *Builder) buildUserPrompt(files []promptFile, size int) string {
         var sb strings.Builder
+        sb.Grow(size)
 
         // Instruction
         if b.instruction != "" {
-                sb.WriteString(fmt.Sprintf("## Task: %s\n\n", strings.Title(b.mode)))
-                sb.WriteString(fmt.Sprintf("### Instruction:\n%s\n\n", b.instruction))
+                sb.WriteString("## Task: ")
+                sb.WriteString(strings.Title(b.mode))
+                sb.WriteString("\n\n### Instruction:\n")
+                sb.WriteString(b.instruction)
+                sb.WriteString("\n\n")
         }
 
         // Constraints
-        if len(b.constraints) > 0 {
+        if constraints := b.promptConstraints(); len(constraints) > 0 {
                 sb.WriteString("### Constraints:\n")
-                for _, c := range b.constraints {
-                        sb.WriteString(fmt.Sprintf("- %s\n", c))
+                for _, c := range constraints {
+                        sb.WriteString("- ")
+                        sb.WriteString(c)
+                        sb.WriteString("\n")
                 }
                 sb.WriteString("\n")
         }
 
         // Files
-        if len(b.files) > 0 {
+        if len(files) > 0 {
                 sb.WriteString("### Files:\n")
-
-                // Sort files for consistent ordering
-                paths := make([]string, 0, len(b.files))
-                for p := range b.files {
-                        paths = append(paths, p)
-                }
-                sort.Strings(paths)
-
-                for _, path := range paths {
-                        content := b.files[path]
-                        lang := detectLanguage(path)
-                        sb.WriteString(fmt.Sprintf("\n--- FILE: %s ---\n```%s\n%s\n```\n", path, lang, content))
-                }
+        }
+        for _, f := range files {
+                sb.WriteString("\n--- FILE: ")
+                sb.WriteString(f.path)
+                sb.WriteString(f.label)
+                sb.WriteString(" ---\n")
+                sb.WriteString(f.fence)
+                sb.WriteString(f.lang)
+                sb.WriteString("\n")
+                sb.WriteString(f.content)
+                sb.WriteString("\n")
+                sb.WriteString(f.fence)
+                sb.WriteString("\n")
         }
 
-        sb.WriteString("\nProvide your response with code in markdown code blocks (```language\\ncode\\n```).")
-
+        sb.WriteString(responseFormat)
         return sb.String()
 }
 
+// promptConstraints returns the constraints of the prompt, with the rule
+// for read-only files when there are any.
+func (b *Builder) promptConstraints() []string {
+        constraints := b.constraints
+        if len(b.readOnly) > 0 {
+                constraints = append(constraints[:len(constraints):len(constraints)], readOnlyRule)
+        }
+        return constraints
+}
+
 // ToJSON returns JSON representation.
 func (r *PromptResult) ToJSON() (string, error) {
         data, err := json.MarshalIndent(r, "", "  ")
@@ -218,16 +365,15 @@ func (r *PromptResult) ToJSON() (string, error) {
 }
 
 // Helper functions
+var langMap = map[string]string{
+        "go": "go", "py": "python", "js": "javascript", "ts": "typescript",
+        "tsx": "typescript", "jsx": "javascript", "java": "java", "kt": "kotlin",
+        "rs": "rust", "c": "c", "cpp": "cpp", "cs": "csharp",
+        "rb": "ruby", "php": "php", "swift": "swift", "scala": "scala",
+}
+
 func detectLanguage(path string) string {
         ext := strings.ToLower(strings.TrimPrefix(filepath.Ext(path), "."))
-
-        langMap := map[string]string{
-                "go": "go", "py": "python", "js": "javascript", "ts": "typescript",
-                "tsx": "typescript", "jsx": "javascript", "java": "java", "kt": "kotlin",
-                "rs": "rust", "c": "c", "cpp": "cpp", "cs": "csharp",
-                "rb": "ruby", "php": "php", "swift": "swift", "scala": "scala",
-        }
-
         if lang, ok := langMap[ext]; ok {
                 return lang
         }
@@ -237,13 +383,13 @@ func detectLanguage(path string) string {
 // ExtractCodeBlocks extracts code blocks from response.
 func ExtractCodeBlocks(response string) []CodeBlock {
         blocks := []CodeBlock{}
-        re := regexp.MustCompile("```(\\w*)\n?([\\s\\S]*?)```")
-        matches := re.FindAllStringSubmatch(response, -1)
-
-        for _, match := range matches {
+        for _, b := range fence.Parse(response) {
+                if !b.Closed {
+                        continue
+                }
                 blocks = append(blocks, CodeBlock{
-                        Language: match[1],
-                        Code:     strings.TrimSpace(match[2]),
+                        Language: b.Lang,
+                        Code:     strings.TrimSpace(b.Code),
                 })
         }
         return blocks
@@ -257,6 +403,5 @@ type CodeBlock struct {
 
 // ExtractExplanation extracts explanation text.
 func ExtractExplanation(response string) string {
-        re := regexp.MustCompile("```[\\s\\S]*?```")
-        return strings.TrimSpace(re.ReplaceAllString(response, ""))
+        return strings.TrimSpace(fence.Strip(response))
 }
@@ -0,0 +1,92 @@
+package prompt
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// benchFiles returns n Go files of about size bytes each.
+func benchFiles(n, size int) map[string]string {
+	files := make(map[string]string, n)
+	for i := 0; i < n; i++ {
+		var b strings.Builder
+		fmt.Fprintf(&b, "package pkg%d\n\n", i)
+		for j := 0; b.Len() < size; j++ {
+			fmt.Fprintf(&b, "// F%d returns the sum of its arguments.\nfunc F%d(a, b int) int {\n\treturn a + b + %d\n}\n\n", j, j, j)
+		}
+		files[fmt.Sprintf("service/pkg%d/file.go", i)] = b.String()
+	}
+	return files
+}
+
+// benchConfig fits the 500 files of 20KB of the benchmarks, ~2.5M tokens.
+var benchConfig = Config{MaxTotalTokens: 4 << 20, MaxOutputTokens: 4096}
+
+func BenchmarkBuild(b *testing.B) {
+	files := benchFiles(500, 20<<10)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		builder := NewBuilder(benchConfig).SetMode(string(ModeRefactor)).SetInstruction("Rename F0 to Sum.")
+		main := true
+		for path, content := range files {
+			builder.AddFile(path, content, main)
+			main = false
+		}
+		if _, err := builder.Build(); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkBuildLazy(b *testing.B) {
+	files := benchFiles(500, 20<<10)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		builder := NewBuilder(benchConfig).SetMode(string(ModeRefactor)).SetInstruction("Rename F0 to Sum.")
+		main := true
+		for path, content := range files {
+			content := content
+			builder.AddFileFunc(path, func() (string, error) { return content, nil }, main)
+			main = false
+		}
+		if _, err := builder.Build(); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestBuildSizesPromptExactly(t *testing.T) {
+	files := benchFiles(20, 2<<10)
+	builder := NewBuilder(benchConfig).SetMode(string(ModeFix)).SetInstruction("Fix it.").AddConstraint("Keep the API.")
+	for path, content := range files {
+		builder.AddFile(path, content, path == "service/pkg0/file.go")
+	}
+	result, err := builder.Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	user := result.Messages[1].Content
+	fs, err := builder.promptFiles()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if size := builder.userPromptSize(fs); len(user) != size {
+		t.Errorf("user prompt is %d bytes, userPromptSize says %d", len(user), size)
+	}
+	for path, content := range files {
+		if !strings.Contains(user, path) || !strings.Contains(user, content) {
+			t.Errorf("user prompt is missing %s", path)
+		}
+	}
+}
+
+func TestBuildTooLarge(t *testing.T) {
+	builder := NewBuilder(Config{MaxTotalTokens: 1000, MaxOutputTokens: 100}).SetMode(string(ModeFix))
+	builder.AddFile("big.go", strings.Repeat("x", 8000), true)
+	if _, err := builder.Build(); err == nil || !strings.Contains(err.Error(), ErrPromptTooLarge.Error()) {
+		t.Errorf("Build() = %v, want ErrPromptTooLarge", err)
+	}
+}
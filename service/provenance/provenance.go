@@ -0,0 +1,188 @@
+// Package provenance records which changes were authored by the agent and
+// how they were produced, optionally signing the run manifest.
+package provenance
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Errors
+var (
+	ErrNoManifest       = errors.New("no provenance manifest")
+	ErrInvalidKey       = errors.New("signing key must be a PEM-encoded ed25519 private key")
+	ErrSignatureInvalid = errors.New("manifest signature does not match")
+)
+
+// FileRecord identifies one agent-written file version.
+type FileRecord struct {
+	Path   string `json:"path"`
+	SHA256 string `json:"sha256"`
+}
+
+// Manifest describes how a run's changes were generated.
+type Manifest struct {
+	SessionID    string       `json:"session_id"`
+	Tool         string       `json:"tool"`
+	Version      string       `json:"version"`
+	Mode         string       `json:"mode"`
+	Model        string       `json:"model"`
+	PromptHashes []string     `json:"prompt_hashes"`
+	Timestamp    time.Time    `json:"timestamp"`
+	Files        []FileRecord `json:"files"`
+}
+
+// Signature is stored next to a signed manifest.
+type Signature struct {
+	PublicKey string `json:"public_key"`
+	Signature string `json:"signature"`
+}
+
+// Hash returns the hex SHA-256 of content, as used in manifests.
+func Hash(content string) string {
+	sum := sha256.Sum256([]byte(content))
+	return hex.EncodeToString(sum[:])
+}
+
+// Write stores the manifest as <dir>/<session>.json. When key is non-nil
+// the exact manifest bytes are signed into <dir>/<session>.sig.
+func Write(dir string, m *Manifest, key ed25519.PrivateKey) (string, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	path := filepath.Join(dir, m.SessionID+".json")
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return "", err
+	}
+
+	if key != nil {
+		sig := Signature{
+			PublicKey: base64.StdEncoding.EncodeToString(key.Public().(ed25519.PublicKey)),
+			Signature: base64.StdEncoding.EncodeToString(ed25519.Sign(key, data)),
+		}
+		sigData, _ := json.MarshalIndent(sig, "", "  ")
+		if err := os.WriteFile(filepath.Join(dir, m.SessionID+".sig"), sigData, 0644); err != nil {
+			return path, err
+		}
+	}
+	return path, nil
+}
+
+// Read loads a manifest by session ID.
+func Read(dir, sessionID string) (*Manifest, error) {
+	data, err := os.ReadFile(filepath.Join(dir, sessionID+".json"))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, ErrNoManifest
+		}
+		return nil, err
+	}
+	var m Manifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("parse manifest: %w", err)
+	}
+	return &m, nil
+}
+
+// List returns all manifests in dir, oldest first.
+func List(dir string) ([]Manifest, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var manifests []Manifest
+	for _, entry := range entries {
+		name := entry.Name()
+		if filepath.Ext(name) != ".json" {
+			continue
+		}
+		m, err := Read(dir, name[:len(name)-len(".json")])
+		if err != nil {
+			continue
+		}
+		manifests = append(manifests, *m)
+	}
+	return manifests, nil
+}
+
+// Verify checks the signature of a manifest. It reports whether the
+// manifest is signed and, if so, the fingerprint of the signing key.
+func Verify(dir, sessionID string) (bool, string, error) {
+	data, err := os.ReadFile(filepath.Join(dir, sessionID+".json"))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return false, "", ErrNoManifest
+		}
+		return false, "", err
+	}
+	sigData, err := os.ReadFile(filepath.Join(dir, sessionID+".sig"))
+	if os.IsNotExist(err) {
+		return false, "", nil
+	}
+	if err != nil {
+		return false, "", err
+	}
+
+	var sig Signature
+	if err := json.Unmarshal(sigData, &sig); err != nil {
+		return true, "", fmt.Errorf("parse signature: %w", err)
+	}
+	pub, err := base64.StdEncoding.DecodeString(sig.PublicKey)
+	if err != nil || len(pub) != ed25519.PublicKeySize {
+		return true, "", ErrSignatureInvalid
+	}
+	raw, err := base64.StdEncoding.DecodeString(sig.Signature)
+	if err != nil {
+		return true, "", ErrSignatureInvalid
+	}
+	fingerprint := Fingerprint(ed25519.PublicKey(pub))
+	if !ed25519.Verify(ed25519.PublicKey(pub), data, raw) {
+		return true, fingerprint, ErrSignatureInvalid
+	}
+	return true, fingerprint, nil
+}
+
+// Fingerprint returns a short identifier for a public key.
+func Fingerprint(pub ed25519.PublicKey) string {
+	sum := sha256.Sum256(pub)
+	return "SHA256:" + base64.RawStdEncoding.EncodeToString(sum[:])
+}
+
+// LoadKey reads a PKCS#8 PEM ed25519 private key, as produced by
+// `openssl genpkey -algorithm ed25519`.
+func LoadKey(path string) (ed25519.PrivateKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, ErrInvalidKey
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, ErrInvalidKey
+	}
+	edKey, ok := key.(ed25519.PrivateKey)
+	if !ok {
+		return nil, ErrInvalidKey
+	}
+	return edKey, nil
+}
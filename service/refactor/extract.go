@@ -0,0 +1,675 @@
+package refactor
+
+import (
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/token"
+	"go/types"
+	"path"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Extracted is what an extract refactor made, for naming it afterwards.
+type Extracted struct {
+	File  string   // the file the code went to
+	Func  string   // placeholder name of an extracted function
+	Decls []string // declarations moved to another package, by their new name
+}
+
+// Extract splices lines start to end out of a file. Whole statements of a
+// function body become a function called in their place, in the package
+// of the directory into or, if into is empty, the same package: its
+// parameters are the variables the statements read and its results those
+// they set that are read afterwards. Whole declarations move to the
+// package of into, their references qualified and, where other code uses
+// them, exported. The function gets a placeholder name; naming it is
+// left to the caller.
+func (m *Module) Extract(file string, start, end int, into string) (*Result, *Extracted, error) {
+	file = path.Clean(file)
+	f := m.files[file]
+	p := m.pkgOf(f)
+	if f == nil || p == nil || p.types == nil {
+		return nil, nil, fmt.Errorf("%s is not a Go file of the module built here", file)
+	}
+	tf := m.fset.File(f.Pos())
+	if start < 1 || end < start || end > tf.LineCount() {
+		return nil, nil, fmt.Errorf("%s has no lines %d-%d", file, start, end)
+	}
+	from, to := tf.LineStart(start), token.Pos(tf.Base()+tf.Size())
+	if end < tf.LineCount() {
+		to = tf.LineStart(end + 1)
+	}
+	if into != "" {
+		if !inModule(into) {
+			return nil, nil, fmt.Errorf("can only extract into a package within the module")
+		}
+		if into = path.Clean(into); into == p.dir {
+			into = ""
+		}
+	}
+
+	var decls []ast.Decl
+	for _, d := range f.Decls {
+		begin := declStart(d)
+		switch {
+		case d.End() <= from || begin >= to:
+		case begin >= from && d.End() <= to:
+			decls = append(decls, d)
+		case len(decls) == 0:
+			if fn, ok := d.(*ast.FuncDecl); ok && fn.Body != nil && fn.Body.Lbrace < from && to <= fn.Body.Rbrace {
+				return m.extractFunc(p, file, fn, from, to, into)
+			}
+			fallthrough
+		default:
+			return nil, nil, fmt.Errorf("lines %d-%d split the declaration at line %d", start, end, tf.Line(begin))
+		}
+	}
+	if len(decls) == 0 {
+		return nil, nil, fmt.Errorf("lines %d-%d of %s hold no declaration or statement", start, end, file)
+	}
+	if into == "" {
+		return nil, nil, fmt.Errorf("declarations are extracted into another package; name its directory")
+	}
+	return m.extractDecls(p, file, decls, into)
+}
+
+// extractFunc makes the statements of fn between from and to a function.
+func (m *Module) extractFunc(p *pkg, file string, fn *ast.FuncDecl, from, to token.Pos, into string) (*Result, *Extracted, error) {
+	list := stmtsIn(fn.Body, from, to)
+	if len(list) == 0 {
+		return nil, nil, fmt.Errorf("the lines aren't whole statements of %s", fn.Name.Name)
+	}
+	first, last := list[0], list[len(list)-1]
+	inRange := func(pos token.Pos) bool { return pos >= first.Pos() && pos < last.End() }
+	local := func(o types.Object) (*types.Var, bool) {
+		v, ok := o.(*types.Var)
+		return v, ok && !v.IsField() && v.Pos() >= fn.Pos() && v.Pos() < fn.End()
+	}
+	readAfter := func(v *types.Var) bool {
+		for id, o := range p.info.Uses {
+			if o == v && id.Pos() >= last.End() && id.Pos() < fn.End() {
+				return true
+			}
+		}
+		return false
+	}
+	result := &Result{}
+
+	// Variables only assigned in the range aren't parameters, and those
+	// written are results if read afterwards.
+	assigned := make(map[*ast.Ident]bool)
+	written := make(map[*ast.Ident]bool)
+	for _, s := range list {
+		ast.Inspect(s, func(n ast.Node) bool {
+			switch n := n.(type) {
+			case *ast.AssignStmt:
+				for _, lhs := range n.Lhs {
+					if id, ok := lhs.(*ast.Ident); ok {
+						written[id] = true
+						assigned[id] = n.Tok == token.ASSIGN || n.Tok == token.DEFINE
+					}
+				}
+			case *ast.IncDecStmt:
+				if id, ok := n.X.(*ast.Ident); ok {
+					written[id] = true
+				}
+			}
+			return true
+		})
+	}
+	var params, results []*types.Var
+	defined := make(map[*types.Var]bool)
+	seen := make(map[*types.Var]bool)
+	for _, s := range list {
+		ast.Inspect(s, func(n ast.Node) bool {
+			id, ok := n.(*ast.Ident)
+			if !ok {
+				return true
+			}
+			if v, ok := local(p.info.Defs[id]); ok && !seen[v] && readAfter(v) {
+				seen[v] = true
+				defined[v] = true
+				results = append(results, v)
+			}
+			v, ok := local(p.info.Uses[id])
+			if !ok || inRange(v.Pos()) {
+				return true
+			}
+			if !assigned[id] && !containsVar(params, v) {
+				params = append(params, v)
+			}
+			if written[id] && !seen[v] && readAfter(v) {
+				seen[v] = true
+				results = append(results, v)
+			}
+			return true
+		})
+	}
+	result.Conflicts = m.controlFlowConflicts(p, list, inRange)
+
+	// Where the function goes, and how its types are spelled there.
+	destPath, destName := p.importPath(m.Path), p.name
+	var dest *pkg
+	if into != "" {
+		destPath = m.Path + "/" + into
+		if dest = m.lookup(into); dest != nil {
+			destName = dest.name
+		} else if destName = path.Base(into); !token.IsIdentifier(destName) {
+			return nil, nil, fmt.Errorf("%s is not a valid package name; create the package first", destName)
+		}
+	}
+	srcImports := importNames(p.info, m.files[file])
+	needed := make(map[string]string) // import path -> name, for into
+	reported := make(map[types.Object]bool)
+	qualifier := func(pkg *types.Package) string {
+		if pkg.Path() == destPath {
+			return ""
+		}
+		if pkg == p.types {
+			return p.name
+		}
+		name := srcImports[pkg.Path()]
+		if name == "" {
+			name = pkg.Name()
+		}
+		needed[pkg.Path()] = name
+		return name
+	}
+	srcQualifier := types.RelativeTo(p.types)
+	if into != "" {
+		for _, s := range list {
+			ast.Inspect(s, func(n ast.Node) bool {
+				id, ok := n.(*ast.Ident)
+				if !ok {
+					return true
+				}
+				switch o := p.info.Uses[id].(type) {
+				case *types.PkgName:
+					needed[o.Imported().Path()] = o.Name()
+				case nil:
+				default:
+					if o.Parent() == p.types.Scope() && !reported[o] {
+						reported[o] = true
+						result.Conflicts = append(result.Conflicts, m.conflict(id.Pos(), "%s stays in package %s, which %s can't import back", o.Name(), p.name, destName))
+					}
+				}
+				return true
+			})
+		}
+		for _, v := range append(append([]*types.Var(nil), params...), results...) {
+			if strings.Contains(types.TypeString(v.Type(), qualifier), p.name+".") {
+				result.Conflicts = append(result.Conflicts, m.conflict(v.Pos(), "the type of %s is declared in package %s", v.Name(), p.name))
+			}
+		}
+	}
+
+	scope := p.types.Scope()
+	name := "extracted"
+	if into != "" {
+		name = "Extracted"
+		scope = nil
+		if dest != nil && dest.types != nil {
+			scope = dest.types.Scope()
+		}
+	}
+	for i := 2; scope != nil && scope.Lookup(name) != nil; i++ {
+		name = fmt.Sprintf("%s%d", strings.TrimRight(name, "0123456789"), i)
+	}
+
+	// The function.
+	src := m.src[file]
+	var sig []string
+	for _, v := range params {
+		sig = append(sig, v.Name()+" "+types.TypeString(v.Type(), qualifier))
+	}
+	var resultTypes, resultNames []string
+	for _, v := range results {
+		resultTypes = append(resultTypes, types.TypeString(v.Type(), qualifier))
+		resultNames = append(resultNames, v.Name())
+	}
+	var ret string
+	switch len(resultTypes) {
+	case 0:
+	case 1:
+		ret = " " + resultTypes[0]
+	default:
+		ret = " (" + strings.Join(resultTypes, ", ") + ")"
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "func %s(%s)%s {\n", name, strings.Join(sig, ", "), ret)
+	b.Write(src[m.lineStart(first.Pos()):m.offset(last.End())])
+	b.WriteString("\n")
+	if len(results) > 0 {
+		fmt.Fprintf(&b, "\treturn %s\n", strings.Join(resultNames, ", "))
+	}
+	b.WriteString("}\n")
+
+	// The call in place of the statements.
+	indent := string(src[m.lineStart(first.Pos()):m.offset(first.Pos())])
+	var args []string
+	for _, v := range params {
+		args = append(args, v.Name())
+	}
+	call := name + "(" + strings.Join(args, ", ") + ")"
+	if into != "" {
+		call = destName + "." + call
+	}
+	newVars, oldVars := 0, 0
+	for _, v := range results {
+		if defined[v] {
+			newVars++
+		} else {
+			oldVars++
+		}
+	}
+	switch {
+	case len(results) == 0:
+	case oldVars == 0:
+		call = strings.Join(resultNames, ", ") + " := " + call
+	case newVars == 0:
+		call = strings.Join(resultNames, ", ") + " = " + call
+	default:
+		var decls []string
+		for _, v := range results {
+			if defined[v] {
+				decls = append(decls, fmt.Sprintf("var %s %s\n%s", v.Name(), types.TypeString(v.Type(), srcQualifier), indent))
+			}
+		}
+		call = strings.Join(decls, "") + strings.Join(resultNames, ", ") + " = " + call
+	}
+
+	e := make(edits)
+	e.replace(file, m.lineStart(first.Pos()), m.offset(last.End()), indent+call)
+	result.References = len(params) + len(results)
+	extracted := &Extracted{File: file, Func: name}
+	if into == "" {
+		e.replace(file, m.offset(fn.End()), m.offset(fn.End()), "\n\n"+strings.TrimSuffix(b.String(), "\n"))
+	} else {
+		m.addImport(e, file, destPath, destName)
+		m.dropUnusedImports(e, p.info, file, inRange)
+		extracted.File = path.Join(into, path.Base(file))
+		delete(needed, destPath)
+		m.addToPackage(e, result, extracted.File, destName, needed, b.String())
+	}
+	result.Files = mergeFiles(result.Files, e.apply(m))
+	sortConflicts(result.Conflicts)
+	return result, extracted, nil
+}
+
+// extractDecls moves declarations to the package of into.
+func (m *Module) extractDecls(p *pkg, file string, decls []ast.Decl, into string) (*Result, *Extracted, error) {
+	begin, end := declStart(decls[0]), decls[len(decls)-1].End()
+	inRange := func(pos token.Pos) bool { return pos >= begin && pos < end && m.fset.Position(pos).Filename == file }
+	destPath := m.Path + "/" + into
+	dest := m.lookup(into)
+	destName := path.Base(into)
+	if dest != nil {
+		destName = dest.name
+	} else if !token.IsIdentifier(destName) {
+		return nil, nil, fmt.Errorf("%s is not a valid package name; create the package first", destName)
+	}
+	result := &Result{}
+
+	// The package-level objects moved, and their name in into.
+	moved := make(map[types.Object]string)
+	var order []types.Object
+	for _, d := range decls {
+		switch d := d.(type) {
+		case *ast.FuncDecl:
+			if d.Recv == nil {
+				order = append(order, p.info.Defs[d.Name])
+			}
+		case *ast.GenDecl:
+			if d.Tok == token.IMPORT {
+				return nil, nil, fmt.Errorf("the lines include imports; only declarations are extracted")
+			}
+			for _, spec := range d.Specs {
+				switch s := spec.(type) {
+				case *ast.TypeSpec:
+					order = append(order, p.info.Defs[s.Name])
+				case *ast.ValueSpec:
+					for _, id := range s.Names {
+						if id.Name != "_" {
+							order = append(order, p.info.Defs[id])
+						}
+					}
+				}
+			}
+		}
+	}
+	for _, o := range order {
+		if o == nil {
+			continue
+		}
+		name := o.Name()
+		if !o.Exported() && m.usedOutside(o, inRange) {
+			r, size := utf8.DecodeRuneInString(name)
+			name = string(unicode.ToUpper(r)) + name[size:]
+		}
+		moved[o] = name
+		if dest != nil && dest.types != nil && dest.types.Scope().Lookup(name) != nil {
+			result.Conflicts = append(result.Conflicts, m.conflict(o.Pos(), "package %s already declares %s", destName, name))
+		}
+	}
+
+	for _, d := range decls {
+		if fn, ok := d.(*ast.FuncDecl); ok && fn.Recv != nil {
+			if obj, ok := p.info.Defs[fn.Name].(*types.Func); ok {
+				if named, ok := recvType(obj).(*types.Named); ok && moved[named.Obj()] == "" {
+					result.Conflicts = append(result.Conflicts, m.conflict(fn.Pos(), "method %s must stay with type %s", fn.Name.Name, named.Obj().Name()))
+				}
+			}
+		}
+	}
+
+	// Inside the moved code: renames, imports, and what it leaves behind.
+	var inner []edit
+	needed := make(map[string]string)
+	reported := make(map[types.Object]bool)
+	e := make(edits)
+	for id, o := range p.info.Uses {
+		if !inRange(id.Pos()) {
+			continue
+		}
+		switch {
+		case moved[o] != "":
+			if moved[o] != o.Name() {
+				inner = append(inner, edit{m.offset(id.Pos()), m.offset(id.End()), moved[o]})
+			}
+		case o.Parent() == p.types.Scope() && !reported[o]:
+			reported[o] = true
+			result.Conflicts = append(result.Conflicts, m.conflict(id.Pos(), "%s stays in package %s, which %s can't import back", o.Name(), p.name, destName))
+		}
+		if pn, ok := o.(*types.PkgName); ok {
+			needed[pn.Imported().Path()] = pn.Name()
+		}
+	}
+	for o, name := range moved {
+		if name == o.Name() {
+			continue
+		}
+		inner = append(inner, edit{m.offset(o.Pos()), m.offset(o.Pos()) + len(o.Name()), name})
+		if doc := m.docComment(p, o); doc != nil && strings.HasPrefix(doc.List[0].Text, "// "+o.Name()+" ") {
+			at := m.offset(doc.List[0].Slash) + 3
+			inner = append(inner, edit{at, at + len(o.Name()), name})
+		}
+	}
+
+	// Outside it: references qualified, and what can't follow reported.
+	for _, q := range m.pkgs {
+		if q.info == nil {
+			continue
+		}
+		changed := make(map[string]bool)
+		qualified := make(map[token.Pos]bool)
+		for _, qf := range q.files {
+			qfile := m.fset.Position(qf.Pos()).Filename
+			ast.Inspect(qf, func(n ast.Node) bool {
+				switch n := n.(type) {
+				case *ast.FuncDecl:
+					if n.Recv == nil || inRange(n.Pos()) {
+						return true
+					}
+					if obj, ok := q.info.Defs[n.Name].(*types.Func); ok {
+						if named, ok := recvType(obj).(*types.Named); ok && moved[named.Obj()] != "" {
+							result.Conflicts = append(result.Conflicts, m.conflict(n.Pos(), "method %s must move with type %s", n.Name.Name, named.Obj().Name()))
+						}
+					}
+				case *ast.SelectorExpr:
+					// pkg.Name from another package.
+					x, ok := n.X.(*ast.Ident)
+					if !ok {
+						return true
+					}
+					pn, ok := q.info.Uses[x].(*types.PkgName)
+					if !ok || pn.Imported() != p.types {
+						return true
+					}
+					if name := moved[q.info.Uses[n.Sel]]; name != "" {
+						e.add(m, x.Pos(), x.Name, destName)
+						qualified[x.Pos()] = true
+						changed[qfile] = true
+						result.References++
+					}
+					return false
+				case *ast.Ident:
+					if q != p || inRange(n.Pos()) {
+						return true
+					}
+					o := q.info.Uses[n]
+					if name := moved[o]; name != "" {
+						e.add(m, n.Pos(), n.Name, destName+"."+name)
+						changed[qfile] = true
+						result.References++
+					} else if o != nil && o.Pkg() == p.types && !o.Exported() && o.Parent() != p.types.Scope() && inRange(o.Pos()) && !reported[o] {
+						reported[o] = true
+						result.Conflicts = append(result.Conflicts, m.conflict(n.Pos(), "%s is unexported in package %s", n.Name, destName))
+					}
+				}
+				return true
+			})
+		}
+		for qfile := range changed {
+			m.addImport(e, qfile, destPath, destName)
+			if q != p {
+				m.dropUnusedImports(e, q.info, qfile, func(pos token.Pos) bool { return qualified[pos] })
+			}
+		}
+	}
+
+	// The declarations leave the file for into.
+	src := m.src[file]
+	startOff, endOff := m.offset(begin), m.offset(end)
+	var text strings.Builder
+	sort.Slice(inner, func(i, j int) bool { return inner[i].start < inner[j].start })
+	at := startOff
+	for _, ed := range inner {
+		text.Write(src[at:ed.start])
+		text.WriteString(ed.text)
+		at = ed.end
+	}
+	text.Write(src[at:endOff])
+	text.WriteString("\n")
+	m.removeLines(e, file, begin, end)
+	m.dropUnusedImports(e, p.info, file, inRange)
+
+	extracted := &Extracted{File: path.Join(into, path.Base(file))}
+	for _, o := range order {
+		if o != nil {
+			extracted.Decls = append(extracted.Decls, moved[o])
+			result.References++
+		}
+	}
+	delete(needed, destPath)
+	m.addToPackage(e, result, extracted.File, destName, needed, text.String())
+	result.Files = mergeFiles(result.Files, e.apply(m))
+	sortConflicts(result.Conflicts)
+	return result, extracted, nil
+}
+
+// addToPackage appends code to a file, which is created with the package
+// clause name if it doesn't exist yet, and adds the imports it needs.
+func (m *Module) addToPackage(e edits, result *Result, file, name string, imports map[string]string, code string) {
+	paths := make([]string, 0, len(imports))
+	for p := range imports {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+	if m.files[file] != nil {
+		size := len(m.src[file])
+		e.replace(file, size, size, "\n"+code)
+		for _, p := range paths {
+			m.addImport(e, file, p, imports[p])
+		}
+		return
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "package %s\n\n", name)
+	if len(paths) > 0 {
+		b.WriteString("import (\n")
+		for _, p := range paths {
+			if imports[p] != path.Base(p) {
+				fmt.Fprintf(&b, "\t%s %q\n", imports[p], p)
+			} else {
+				fmt.Fprintf(&b, "\t%q\n", p)
+			}
+		}
+		b.WriteString(")\n\n")
+	}
+	b.WriteString(code)
+	out := []byte(b.String())
+	if formatted, err := format.Source(out); err == nil {
+		out = formatted
+	}
+	result.Files = mergeFiles(result.Files, map[string]string{file: string(out)})
+}
+
+// controlFlowConflicts reports statements that mean something else once
+// moved to a function of their own: returns, defers, and jumps out of the
+// range.
+func (m *Module) controlFlowConflicts(p *pkg, list []ast.Stmt, inRange func(token.Pos) bool) []Conflict {
+	var conflicts []Conflict
+	for _, s := range list {
+		var stack []ast.Node
+		ast.Inspect(s, func(n ast.Node) bool {
+			if n == nil {
+				stack = stack[:len(stack)-1]
+				return true
+			}
+			switch n := n.(type) {
+			case *ast.FuncLit:
+				return false
+			case *ast.ReturnStmt:
+				conflicts = append(conflicts, m.conflict(n.Pos(), "return leaves the enclosing function, not the extracted one"))
+			case *ast.DeferStmt:
+				conflicts = append(conflicts, m.conflict(n.Pos(), "defer would run when the extracted function returns"))
+			case *ast.BranchStmt:
+				switch {
+				case n.Tok == token.GOTO:
+					conflicts = append(conflicts, m.conflict(n.Pos(), "goto can't leave the extracted function"))
+				case n.Label != nil:
+					if l := p.info.Uses[n.Label]; l != nil && !inRange(l.Pos()) {
+						conflicts = append(conflicts, m.conflict(n.Pos(), "%s %s jumps out of the extracted lines", n.Tok, n.Label.Name))
+					}
+				case !enclosed(stack, n.Tok):
+					conflicts = append(conflicts, m.conflict(n.Pos(), "%s jumps out of the extracted lines", n.Tok))
+				}
+			}
+			stack = append(stack, n)
+			return true
+		})
+	}
+	return conflicts
+}
+
+// enclosed reports whether a break or continue has its target on stack.
+func enclosed(stack []ast.Node, tok token.Token) bool {
+	for _, n := range stack {
+		switch n.(type) {
+		case *ast.ForStmt, *ast.RangeStmt:
+			return true
+		case *ast.SwitchStmt, *ast.TypeSwitchStmt, *ast.SelectStmt:
+			if tok == token.BREAK {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// stmtsIn returns the statements of a block of body from and to cover
+// entirely, or nil if they cover a statement in part.
+func stmtsIn(body *ast.BlockStmt, from, to token.Pos) []ast.Stmt {
+	var found []ast.Stmt
+	split := false
+	ast.Inspect(body, func(n ast.Node) bool {
+		if found != nil || split {
+			return false
+		}
+		var list []ast.Stmt
+		switch n := n.(type) {
+		case *ast.BlockStmt:
+			list = n.List
+		case *ast.CaseClause:
+			list = n.Body
+		case *ast.CommClause:
+			list = n.Body
+		default:
+			return true
+		}
+		var inside []ast.Stmt
+		for _, s := range list {
+			switch {
+			case s.End() <= from || s.Pos() >= to:
+			case s.Pos() >= from && s.End() <= to:
+				inside = append(inside, s)
+			case s.Pos() < from && to <= s.End():
+				return true // the range is within s
+			default:
+				split = true
+				return false
+			}
+		}
+		if len(inside) > 0 {
+			found = inside
+		}
+		return true
+	})
+	if split {
+		return nil
+	}
+	return found
+}
+
+// usedOutside reports whether an object is referred to outside a range.
+func (m *Module) usedOutside(o types.Object, inRange func(token.Pos) bool) bool {
+	for _, q := range m.pkgs {
+		if q.info == nil {
+			continue
+		}
+		for id, u := range q.info.Uses {
+			if u == o && !inRange(id.Pos()) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// declStart returns where a declaration begins, its doc comment included.
+func declStart(d ast.Decl) token.Pos {
+	switch d := d.(type) {
+	case *ast.FuncDecl:
+		if d.Doc != nil {
+			return d.Doc.Pos()
+		}
+	case *ast.GenDecl:
+		if d.Doc != nil {
+			return d.Doc.Pos()
+		}
+	}
+	return d.Pos()
+}
+
+func containsVar(vars []*types.Var, v *types.Var) bool {
+	for _, w := range vars {
+		if w == v {
+			return true
+		}
+	}
+	return false
+}
+
+func mergeFiles(into, files map[string]string) map[string]string {
+	if into == nil {
+		into = make(map[string]string)
+	}
+	for file, content := range files {
+		into[file] = content
+	}
+	return into
+}
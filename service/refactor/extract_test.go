@@ -0,0 +1,186 @@
+package refactor
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestExtractFunc(t *testing.T) {
+	tests := []struct {
+		name       string
+		src        string
+		start, end int
+		contains   []string // substrings of the rewritten file
+		refs       int
+	}{
+		{
+			name: "multiple return values",
+			src: `package a
+
+func F(n int) int {
+	x := n * 2
+	y := n + 1
+	return x + y
+}
+`,
+			start: 4, end: 5,
+			contains: []string{
+				"\tx, y := extracted(n)\n\treturn x + y\n",
+				"func extracted(n int) (int, int) {\n\tx := n * 2\n\ty := n + 1\n\treturn x, y\n}",
+			},
+			refs: 3,
+		},
+		{
+			name: "results both declared and assigned",
+			src: `package a
+
+func G(n int) int {
+	total := 0
+	total += n
+	extra := n * 3
+	return total + extra
+}
+`,
+			start: 5, end: 6,
+			contains: []string{
+				"\tvar extra int\n\ttotal, extra = extracted(total, n)\n",
+				"func extracted(total int, n int) (int, int) {\n\ttotal += n\n\textra := n * 3\n\treturn total, extra\n}",
+			},
+			refs: 4,
+		},
+		{
+			name: "captured locals become parameters",
+			src: `package a
+
+func H(items []string, sep string) string {
+	out := ""
+	for _, it := range items {
+		out += it + sep
+	}
+	return out
+}
+`,
+			start: 5, end: 7,
+			contains: []string{
+				"\tout = extracted(items, out, sep)\n",
+				"func extracted(items []string, out string, sep string) string {",
+				"\treturn out\n}",
+			},
+			refs: 4,
+		},
+		{
+			name: "locals captured by a closure",
+			src: `package a
+
+func K(n int) func() int {
+	base := n
+	f := func() int { return base + n }
+	return f
+}
+`,
+			start: 5, end: 5,
+			contains: []string{
+				"\tf := extracted(base, n)\n\treturn f\n",
+				"func extracted(base int, n int) func() int {\n\tf := func() int { return base + n }\n\treturn f\n}",
+			},
+			refs: 3,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := load(t, map[string]string{"a/a.go": tt.src})
+			result, extracted, err := m.Extract("a/a.go", tt.start, tt.end, "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if extracted.Func != "extracted" {
+				t.Errorf("func = %q, want extracted", extracted.Func)
+			}
+			if len(result.Conflicts) > 0 {
+				t.Errorf("conflicts = %v, want none", result.Conflicts)
+			}
+			got := result.Files["a/a.go"]
+			for _, want := range tt.contains {
+				if !strings.Contains(got, want) {
+					t.Errorf("a/a.go lacks %q:\n%s", want, got)
+				}
+			}
+			if result.References != tt.refs {
+				t.Errorf("references = %d, want %d", result.References, tt.refs)
+			}
+		})
+	}
+}
+
+func TestExtractReturnConflict(t *testing.T) {
+	m := load(t, map[string]string{"a/a.go": `package a
+
+func G(n int) int {
+	if n > 0 {
+		return n
+	}
+	return 0
+}
+`})
+	result, _, err := m.Extract("a/a.go", 4, 6, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "a/a.go:5: return leaves the enclosing function, not the extracted one"
+	if len(result.Conflicts) != 1 || result.Conflicts[0].String() != want {
+		t.Errorf("conflicts = %v, want [%s]", result.Conflicts, want)
+	}
+}
+
+func TestExtractRejected(t *testing.T) {
+	const src = `package a
+
+func F(n int) int {
+	x := n * 2
+	if x > 3 {
+		x = 3
+	}
+	xs := []int{
+		x,
+		n,
+	}
+
+	return x + len(xs)
+}
+
+var y = 1
+`
+	tests := []struct {
+		name       string
+		start, end int
+		errorHas   string
+	}{
+		{"statement and the head of an if", 4, 5, "aren't whole statements of F"},
+		{"body and closing brace of an if", 6, 7, "aren't whole statements of F"},
+		{"inside a composite literal", 9, 10, "aren't whole statements of F"},
+		{"blank line", 12, 12, "aren't whole statements of F"},
+		{"past the end of the function", 13, 16, "split the declaration at line 3"},
+		{"past the end of the file", 40, 41, "has no lines 40-41"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root := fixture(t, map[string]string{"a/a.go": src})
+			before := snapshot(t, root)
+			m, err := Load(root)
+			if err != nil {
+				t.Fatal(err)
+			}
+			result, extracted, err := m.Extract("a/a.go", tt.start, tt.end, "")
+			if err == nil || !strings.Contains(err.Error(), tt.errorHas) {
+				t.Fatalf("error = %v, want one with %q", err, tt.errorHas)
+			}
+			if result != nil || extracted != nil {
+				t.Errorf("result = %+v, %+v, want none", result, extracted)
+			}
+			if after := snapshot(t, root); !reflect.DeepEqual(after, before) {
+				t.Errorf("tree changed:\nbefore %v\nafter  %v", before, after)
+			}
+		})
+	}
+}
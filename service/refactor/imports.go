@@ -0,0 +1,131 @@
+package refactor
+
+import (
+	"go/ast"
+	"go/token"
+	"go/types"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// importNames maps the paths a file imports to the names it refers to
+// them by.
+func importNames(info *types.Info, f *ast.File) map[string]string {
+	names := make(map[string]string)
+	for _, spec := range f.Imports {
+		importPath, _ := strconv.Unquote(spec.Path.Value)
+		if pn := importedName(info, spec); pn != nil {
+			names[importPath] = pn.Name()
+		} else if spec.Name != nil {
+			names[importPath] = spec.Name.Name
+		} else {
+			names[importPath] = guessName(importPath)
+		}
+	}
+	return names
+}
+
+// importedName returns the package name an import declares.
+func importedName(info *types.Info, spec *ast.ImportSpec) *types.PkgName {
+	if info == nil {
+		return nil
+	}
+	var obj types.Object
+	if spec.Name != nil {
+		obj = info.Defs[spec.Name]
+	} else {
+		obj = info.Implicits[spec]
+	}
+	pn, _ := obj.(*types.PkgName)
+	return pn
+}
+
+// addImport adds an import of importPath to a file that lacks one, named
+// if name isn't what the path suggests.
+func (m *Module) addImport(e edits, file, importPath, name string) {
+	f := m.files[file]
+	for _, spec := range f.Imports {
+		if p, _ := strconv.Unquote(spec.Path.Value); p == importPath {
+			return
+		}
+	}
+	spec := strconv.Quote(importPath)
+	if name != "" && name != path.Base(importPath) {
+		spec = name + " " + spec
+	}
+	for _, decl := range f.Decls {
+		gen, ok := decl.(*ast.GenDecl)
+		if !ok || gen.Tok != token.IMPORT {
+			continue
+		}
+		switch {
+		case gen.Lparen.IsValid() && !m.isStd(importPath) && len(gen.Specs) > 0:
+			// After the last import, in a group of its own if that's of
+			// the standard library.
+			last := gen.Specs[len(gen.Specs)-1].(*ast.ImportSpec)
+			sep := "\n\t"
+			if p, _ := strconv.Unquote(last.Path.Value); m.isStd(p) {
+				sep = "\n\n\t"
+			}
+			e.replace(file, m.offset(last.End()), m.offset(last.End()), sep+spec)
+		case gen.Lparen.IsValid():
+			e.replace(file, m.offset(gen.Lparen)+1, m.offset(gen.Lparen)+1, "\n\t"+spec)
+		default:
+			e.replace(file, m.offset(gen.End()), m.offset(gen.End()), "\nimport "+spec)
+		}
+		return
+	}
+	e.replace(file, m.offset(f.Name.End()), m.offset(f.Name.End()), "\n\nimport "+spec)
+}
+
+// isStd reports whether an import path is of the standard library.
+func (m *Module) isStd(importPath string) bool {
+	first, _, _ := strings.Cut(importPath, "/")
+	return !strings.Contains(first, ".") && !within(importPath, m.Path)
+}
+
+// dropUnusedImports removes the imports of a file whose every reference is
+// gone.
+func (m *Module) dropUnusedImports(e edits, info *types.Info, file string, gone func(token.Pos) bool) {
+	uses := make(map[*types.PkgName]int)
+	left := make(map[*types.PkgName]int)
+	for id, o := range info.Uses {
+		if pn, ok := o.(*types.PkgName); ok && m.fset.Position(id.Pos()).Filename == file {
+			uses[pn]++
+			if !gone(id.Pos()) {
+				left[pn]++
+			}
+		}
+	}
+	for _, spec := range m.files[file].Imports {
+		if pn := importedName(info, spec); pn != nil && uses[pn] > 0 && left[pn] == 0 {
+			m.removeLines(e, file, spec.Pos(), spec.End())
+		}
+	}
+}
+
+// removeLines removes the lines from the one of start through the one of
+// end.
+func (m *Module) removeLines(e edits, file string, start, end token.Pos) {
+	e.replace(file, m.lineStart(start), m.lineEnd(end), "")
+}
+
+func (m *Module) offset(pos token.Pos) int {
+	return m.fset.Position(pos).Offset
+}
+
+// lineStart returns the offset of the line of pos.
+func (m *Module) lineStart(pos token.Pos) int {
+	tf := m.fset.File(pos)
+	return tf.Offset(tf.LineStart(tf.Line(pos)))
+}
+
+// lineEnd returns the offset past the line of pos, its newline included.
+func (m *Module) lineEnd(pos token.Pos) int {
+	tf := m.fset.File(pos)
+	if line := tf.Line(pos); line < tf.LineCount() {
+		return tf.Offset(tf.LineStart(line + 1))
+	}
+	return tf.Size()
+}
@@ -0,0 +1,262 @@
+package refactor
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+	"go/types"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// MoveFile moves a file, into a directory if to is one. A Go file moved
+// to another package takes its package clause; what it shares with the
+// files it leaves behind is reported as conflicts.
+func (m *Module) MoveFile(from, to string) (*Result, error) {
+	from, to = path.Clean(from), cleanTarget(to)
+	if !inModule(from) || !inModule(to) {
+		return nil, fmt.Errorf("can only move a file within the module")
+	}
+	if info, err := os.Stat(filepath.Join(m.Root, from)); err != nil || info.IsDir() {
+		return nil, fmt.Errorf("%s is not a file", from)
+	}
+	if info, err := os.Stat(filepath.Join(m.Root, to)); strings.HasSuffix(to, "/") || (err == nil && info.IsDir()) {
+		to = path.Join(to, path.Base(from))
+	}
+	if _, err := os.Stat(filepath.Join(m.Root, to)); err == nil {
+		return nil, fmt.Errorf("%s already exists", to)
+	}
+	result := &Result{Moves: map[string]string{from: to}}
+	f := m.files[from]
+	if f == nil || path.Dir(from) == path.Dir(to) {
+		return result, nil
+	}
+
+	dest := m.lookup(path.Dir(to))
+	name := path.Base(path.Dir(to))
+	if dest != nil {
+		name = dest.name
+	} else if !token.IsIdentifier(name) {
+		return nil, fmt.Errorf("%s is not a valid package name; create the package first", name)
+	}
+	if strings.HasSuffix(f.Name.Name, "_test") {
+		name += "_test"
+	}
+	e := make(edits)
+	if f.Name.Name != name {
+		e.add(m, f.Name.Pos(), f.Name.Name, name)
+	}
+	result.Files = e.apply(m)
+	if result.Files[from] == "" {
+		result.Files[from] = string(m.src[from])
+	}
+	result.Files[to] = result.Files[from]
+	delete(result.Files, from)
+
+	if !m.other[from] {
+		result.Conflicts = m.moveConflicts(from, dest)
+	}
+	for _, spec := range f.Imports {
+		if p, _ := strconv.Unquote(spec.Path.Value); dest != nil && p == dest.importPath(m.Path) {
+			result.Conflicts = append(result.Conflicts, m.conflict(spec.Pos(), "the file imports the package it moves into"))
+		}
+	}
+	sortConflicts(result.Conflicts)
+	return result, nil
+}
+
+// moveConflicts reports what ties the file to the package it leaves: its
+// declarations used by other files, the other files' declarations it uses,
+// and its names the destination package already declares.
+func (m *Module) moveConflicts(file string, dest *pkg) []Conflict {
+	p := m.pkgOf(m.files[file])
+	if p == nil || p.types == nil {
+		return nil
+	}
+	inFile := func(o types.Object) bool { return m.fset.Position(o.Pos()).Filename == file }
+	declared := make(map[types.Object]bool)
+	for _, o := range p.info.Defs {
+		if o != nil && o.Parent() == p.types.Scope() && inFile(o) {
+			declared[o] = true
+		}
+	}
+
+	var conflicts []Conflict
+	reported := make(map[types.Object]bool)
+	for _, q := range m.pkgs {
+		if q.info == nil {
+			continue
+		}
+		for id, o := range q.info.Uses {
+			o = origin(o)
+			if reported[o] {
+				continue
+			}
+			usedHere := m.fset.Position(id.Pos()).Filename == file
+			switch {
+			case declared[o] && !usedHere:
+				conflicts = append(conflicts, m.conflict(id.Pos(), "%s, declared in %s, is used here", o.Name(), file))
+				reported[o] = true
+			case usedHere && o.Pkg() == p.types && o.Parent() == p.types.Scope() && !inFile(o):
+				conflicts = append(conflicts, m.conflict(id.Pos(), "%s, used by the moved file, stays in package %s", o.Name(), p.name))
+				reported[o] = true
+			}
+		}
+	}
+	// Methods can only be declared in the package of their type.
+	for _, decl := range m.files[file].Decls {
+		if fn, ok := decl.(*ast.FuncDecl); ok && fn.Recv != nil {
+			if obj, ok := p.info.Defs[fn.Name].(*types.Func); ok {
+				if named, ok := recvType(obj).(*types.Named); ok && !inFile(named.Obj()) {
+					conflicts = append(conflicts, m.conflict(fn.Pos(), "method %s must stay with type %s", fn.Name.Name, named.Obj().Name()))
+				}
+			}
+		}
+	}
+	if dest != nil && dest.types != nil {
+		for o := range declared {
+			if dest.types.Scope().Lookup(o.Name()) != nil {
+				conflicts = append(conflicts, m.conflict(o.Pos(), "package %s already declares %s", dest.name, o.Name()))
+			}
+		}
+	}
+	return conflicts
+}
+
+// MovePackage moves a directory with everything in it, and updates the
+// import paths of it and its subpackages throughout the module. A package
+// named after its directory is renamed after the new one, along with the
+// references of its importers.
+func (m *Module) MovePackage(from, to string) (*Result, error) {
+	from, to = path.Clean(from), path.Clean(cleanTarget(to))
+	if from == "." || to == "." || !inModule(from) || !inModule(to) {
+		return nil, fmt.Errorf("can only move a directory within the module")
+	}
+	if within(to, from) {
+		return nil, fmt.Errorf("can't move %s into itself", from)
+	}
+	if info, err := os.Stat(filepath.Join(m.Root, from)); err != nil || !info.IsDir() {
+		return nil, fmt.Errorf("%s is not a directory", from)
+	}
+	if _, err := os.Stat(filepath.Join(m.Root, to)); err == nil {
+		return nil, fmt.Errorf("%s already exists", to)
+	}
+
+	result := &Result{Moves: make(map[string]string)}
+	err := filepath.WalkDir(filepath.Join(m.Root, from), func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		rel, _ := filepath.Rel(m.Root, p)
+		rel = filepath.ToSlash(rel)
+		result.Moves[rel] = to + strings.TrimPrefix(rel, from)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	oldPath, newPath := m.Path+"/"+from, m.Path+"/"+to
+	oldName, newName := path.Base(from), path.Base(to)
+	p := m.lookup(from)
+	rename := p != nil && p.name == oldName && newName != oldName && token.IsIdentifier(newName)
+
+	e := make(edits)
+	for _, rel := range sortedFiles(m.files) {
+		f := m.files[rel]
+		if rename && path.Dir(rel) == from && (f.Name.Name == oldName || f.Name.Name == oldName+"_test") {
+			e.add(m, f.Name.Pos(), oldName, newName+strings.TrimPrefix(f.Name.Name, oldName))
+		}
+		for _, spec := range f.Imports {
+			imp, _ := strconv.Unquote(spec.Path.Value)
+			if !within(imp, oldPath) {
+				continue
+			}
+			text := strconv.Quote(newPath + strings.TrimPrefix(imp, oldPath))
+			if imp == oldPath && rename && spec.Name == nil {
+				if m.renameQualifier(e, rel, oldPath, oldName, newName) {
+					result.References++
+				} else {
+					text = oldName + " " + text // newName is taken here
+				}
+			}
+			e.add(m, spec.Path.Pos(), spec.Path.Value, text)
+			result.References++
+		}
+	}
+	result.Files = make(map[string]string)
+	for file, content := range e.apply(m) {
+		if moved, ok := result.Moves[file]; ok {
+			file = moved
+		}
+		result.Files[file] = content
+	}
+	return result, nil
+}
+
+// renameQualifier rewrites the references of a file to an unnamed import
+// of oldPath, unless newName already means something in it.
+func (m *Module) renameQualifier(e edits, file, oldPath, oldName, newName string) bool {
+	f := m.files[file]
+	taken := false
+	ast.Inspect(f, func(n ast.Node) bool {
+		if id, ok := n.(*ast.Ident); ok && id.Name == newName {
+			taken = true
+		}
+		return !taken
+	})
+	var info *types.Info
+	if q := m.pkgOf(f); q != nil {
+		info = q.info
+		if q.types != nil && q.types.Scope().Lookup(newName) != nil {
+			taken = true
+		}
+	}
+	if taken {
+		return false
+	}
+	if info == nil {
+		// Not type-checked: a selector on an unresolved oldName can only
+		// be the import.
+		ast.Inspect(f, func(n ast.Node) bool {
+			if sel, ok := n.(*ast.SelectorExpr); ok {
+				if id, ok := sel.X.(*ast.Ident); ok && id.Name == oldName && id.Obj == nil {
+					e.add(m, id.Pos(), oldName, newName)
+				}
+			}
+			return true
+		})
+		return true
+	}
+	for id, o := range info.Uses {
+		if pn, ok := o.(*types.PkgName); ok && pn.Imported().Path() == oldPath && m.fset.Position(id.Pos()).Filename == file {
+			e.add(m, id.Pos(), oldName, newName)
+		}
+	}
+	return true
+}
+
+// cleanTarget cleans a destination path, keeping a trailing slash that
+// asks for a directory.
+func cleanTarget(to string) string {
+	to = filepath.ToSlash(to)
+	if strings.HasSuffix(to, "/") {
+		return path.Clean(to) + "/"
+	}
+	return path.Clean(to)
+}
+
+// inModule reports whether the relative path p stays inside the module
+// root once cleaned.
+func inModule(p string) bool {
+	p = path.Clean(filepath.ToSlash(p))
+	return !filepath.IsAbs(p) && !path.IsAbs(p) && p != ".." && !strings.HasPrefix(p, "../")
+}
+
+func within(p, dir string) bool {
+	return p == dir || strings.HasPrefix(p, dir+"/")
+}
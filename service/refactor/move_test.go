@@ -0,0 +1,360 @@
+package refactor
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// fixture is a small module: go.mod declaring example.com/m plus files,
+// by slash-separated path.
+func fixture(t *testing.T, files map[string]string) string {
+	t.Helper()
+	root := t.TempDir()
+	files["go.mod"] = "module example.com/m\n\ngo 1.21\n"
+	for name, content := range files {
+		p := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return root
+}
+
+// snapshot reads every file under root, by slash-separated path.
+func snapshot(t *testing.T, root string) map[string]string {
+	t.Helper()
+	files := make(map[string]string)
+	err := filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		content, err := os.ReadFile(p)
+		rel, _ := filepath.Rel(root, p)
+		files[filepath.ToSlash(rel)] = string(content)
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return files
+}
+
+// load loads the fixture module of files.
+func load(t *testing.T, files map[string]string) *Module {
+	t.Helper()
+	m, err := Load(fixture(t, files))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+// utilModule is a package util used by the root package.
+func utilModule() map[string]string {
+	return map[string]string{
+		"main.go": `package main
+
+import "example.com/m/lib/util"
+
+func main() {
+	util.Hello()
+}
+`,
+		"lib/util/util.go": `package util
+
+// Hello greets.
+func Hello() {}
+`,
+		"lib/util/inner/inner.go": `package inner
+
+import "example.com/m/lib/util"
+
+func Call() { util.Hello() }
+`,
+	}
+}
+
+func TestMovePackage(t *testing.T) {
+	tests := []struct {
+		name     string
+		files    map[string]string
+		from, to string
+		moves    map[string]string
+		contains map[string][]string // file -> substrings of its new content
+		refs     int
+	}{
+		{
+			name:  "import paths and qualifiers rewritten",
+			files: utilModule(),
+			from:  "lib/util", to: "pkg/helpers",
+			moves: map[string]string{
+				"lib/util/util.go":        "pkg/helpers/util.go",
+				"lib/util/inner/inner.go": "pkg/helpers/inner/inner.go",
+			},
+			contains: map[string][]string{
+				"main.go":                    {`import "example.com/m/pkg/helpers"`, "\thelpers.Hello()\n"},
+				"pkg/helpers/util.go":        {"package helpers\n"},
+				"pkg/helpers/inner/inner.go": {`import "example.com/m/pkg/helpers"`, "helpers.Hello()"},
+			},
+			refs: 4,
+		},
+		{
+			name: "subpackage import path rewritten",
+			files: map[string]string{
+				"main.go": `package main
+
+import "example.com/m/lib/util/inner"
+
+func main() { inner.Call() }
+`,
+				"lib/util/util.go":        "package util\n",
+				"lib/util/inner/inner.go": "package inner\n\nfunc Call() {}\n",
+			},
+			from: "lib/util", to: "lib/tools",
+			moves: map[string]string{
+				"lib/util/util.go":        "lib/tools/util.go",
+				"lib/util/inner/inner.go": "lib/tools/inner/inner.go",
+			},
+			contains: map[string][]string{
+				"main.go":           {`import "example.com/m/lib/tools/inner"`, "inner.Call()"},
+				"lib/tools/util.go": {"package tools\n"},
+			},
+			refs: 1,
+		},
+		{
+			name: "new name taken by a local keeps the old one",
+			files: map[string]string{
+				"main.go": `package main
+
+import "example.com/m/lib/util"
+
+func main() {
+	helpers := 1
+	_ = helpers
+	util.Hello()
+}
+`,
+				"lib/util/util.go": "package util\n\nfunc Hello() {}\n",
+			},
+			from: "lib/util", to: "pkg/helpers",
+			moves: map[string]string{"lib/util/util.go": "pkg/helpers/util.go"},
+			contains: map[string][]string{
+				"main.go":             {`import util "example.com/m/pkg/helpers"`, "\tutil.Hello()\n", "helpers := 1"},
+				"pkg/helpers/util.go": {"package helpers\n"},
+			},
+			refs: 1,
+		},
+		{
+			name: "new name taken by a package declaration keeps the old one",
+			files: map[string]string{
+				"main.go": `package main
+
+import "example.com/m/lib/util"
+
+var helpers = 2
+
+func main() { util.Hello() }
+`,
+				"lib/util/util.go": "package util\n\nfunc Hello() {}\n",
+			},
+			from: "lib/util", to: "pkg/helpers",
+			moves: map[string]string{"lib/util/util.go": "pkg/helpers/util.go"},
+			contains: map[string][]string{
+				"main.go": {`import util "example.com/m/pkg/helpers"`, "util.Hello()"},
+			},
+			refs: 1,
+		},
+		{
+			name: "package not named after its directory keeps its name",
+			files: map[string]string{
+				"main.go": `package main
+
+import "example.com/m/lib/util"
+
+func main() { tools.Hello() }
+`,
+				"lib/util/util.go": "package tools\n\nfunc Hello() {}\n",
+			},
+			from: "lib/util", to: "pkg/helpers",
+			moves: map[string]string{"lib/util/util.go": "pkg/helpers/util.go"},
+			contains: map[string][]string{
+				"main.go": {`import "example.com/m/pkg/helpers"`, "tools.Hello()"},
+			},
+			refs: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := load(t, tt.files)
+			result, err := m.MovePackage(tt.from, tt.to)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(result.Moves, tt.moves) {
+				t.Errorf("moves = %v, want %v", result.Moves, tt.moves)
+			}
+			for file, wants := range tt.contains {
+				got, ok := result.Files[file]
+				if !ok {
+					t.Errorf("%s not rewritten; rewritten: %v", file, result.Changed())
+					continue
+				}
+				for _, want := range wants {
+					if !strings.Contains(got, want) {
+						t.Errorf("%s lacks %q:\n%s", file, want, got)
+					}
+				}
+			}
+			if result.References != tt.refs {
+				t.Errorf("references = %d, want %d", result.References, tt.refs)
+			}
+		})
+	}
+}
+
+func TestMoveFile(t *testing.T) {
+	tests := []struct {
+		name      string
+		files     map[string]string
+		from, to  string
+		moved     string   // the new path
+		contains  []string // substrings of the moved file's content
+		conflicts []string // substrings of the conflicts, in order
+	}{
+		{
+			name: "into a directory of the same package",
+			files: map[string]string{
+				"a/x.go": "package a\n\nfunc X() {}\n",
+			},
+			from: "a/x.go", to: "a/sub/",
+			moved: "a/sub/x.go",
+		},
+		{
+			name: "takes the package clause of the destination",
+			files: map[string]string{
+				"a/x.go": "package a\n\nfunc X() {}\n",
+				"b/b.go": "package bee\n\nfunc B() {}\n",
+			},
+			from: "a/x.go", to: "b",
+			moved:    "b/x.go",
+			contains: []string{"package bee\n", "func X() {}"},
+		},
+		{
+			name: "name the destination already declares",
+			files: map[string]string{
+				"a/x.go": "package a\n\nfunc Shared() {}\n",
+				"b/b.go": "package b\n\nfunc Shared() {}\n",
+			},
+			from: "a/x.go", to: "b/x.go",
+			moved:     "b/x.go",
+			contains:  []string{"package b\n"},
+			conflicts: []string{"a/x.go:3: package b already declares Shared"},
+		},
+		{
+			name: "declarations shared with the files left behind",
+			files: map[string]string{
+				"a/x.go": "package a\n\nfunc X() int { return y }\n",
+				"a/y.go": "package a\n\nvar y = 1\n\nfunc Z() int { return X() }\n",
+			},
+			from: "a/x.go", to: "c/x.go",
+			moved:    "c/x.go",
+			contains: []string{"package c\n"},
+			conflicts: []string{
+				"a/x.go:3: y, used by the moved file, stays in package a",
+				"a/y.go:5: X, declared in a/x.go, is used here",
+			},
+		},
+		{
+			name: "method away from its type",
+			files: map[string]string{
+				"a/t.go": "package a\n\ntype T struct{}\n",
+				"a/m.go": "package a\n\nfunc (T) M() {}\n",
+			},
+			from: "a/m.go", to: "b/m.go",
+			moved:     "b/m.go",
+			conflicts: []string{"T, used by the moved file, stays in package a", "method M must stay with type T"},
+		},
+		{
+			name: "into the package it imports",
+			files: map[string]string{
+				"a/x.go": "package a\n\nimport \"example.com/m/b\"\n\nvar X = b.B\n",
+				"b/b.go": "package b\n\nvar B = 1\n",
+			},
+			from: "a/x.go", to: "b/x.go",
+			moved:     "b/x.go",
+			conflicts: []string{"a/x.go:3: the file imports the package it moves into"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := load(t, tt.files)
+			result, err := m.MoveFile(tt.from, tt.to)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want := map[string]string{tt.from: tt.moved}; !reflect.DeepEqual(result.Moves, want) {
+				t.Errorf("moves = %v, want %v", result.Moves, want)
+			}
+			for _, want := range tt.contains {
+				if !strings.Contains(result.Files[tt.moved], want) {
+					t.Errorf("%s lacks %q:\n%s", tt.moved, want, result.Files[tt.moved])
+				}
+			}
+			if len(result.Conflicts) != len(tt.conflicts) {
+				t.Fatalf("conflicts = %v, want %d", result.Conflicts, len(tt.conflicts))
+			}
+			for i, want := range tt.conflicts {
+				if got := result.Conflicts[i].String(); !strings.Contains(got, want) {
+					t.Errorf("conflict %d = %q, want %q", i, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestMoveRejected(t *testing.T) {
+	tests := []struct {
+		name     string
+		move     func(m *Module) (*Result, error)
+		errorHas string
+	}{
+		{"file onto an existing file", func(m *Module) (*Result, error) { return m.MoveFile("lib/util/util.go", "main.go") }, "already exists"},
+		{"file out of the module", func(m *Module) (*Result, error) { return m.MoveFile("main.go", "../main.go") }, "within the module"},
+		{"file from out of the module", func(m *Module) (*Result, error) { return m.MoveFile("../go.mod", "x/go.mod") }, "within the module"},
+		{"missing file", func(m *Module) (*Result, error) { return m.MoveFile("nope.go", "x/nope.go") }, "is not a file"},
+		{"directory as a file", func(m *Module) (*Result, error) { return m.MoveFile("lib/util", "x/util.go") }, "is not a file"},
+		{"file into an invalid package name", func(m *Module) (*Result, error) { return m.MoveFile("lib/util/util.go", "my-pkg/util.go") }, "not a valid package name"},
+		{"package into itself", func(m *Module) (*Result, error) { return m.MovePackage("lib/util", "lib/util/inner/util") }, "into itself"},
+		{"package onto an existing directory", func(m *Module) (*Result, error) { return m.MovePackage("lib/util/inner", "lib") }, "already exists"},
+		{"package out of the module", func(m *Module) (*Result, error) { return m.MovePackage("lib/util", "../util") }, "within the module"},
+		{"module root", func(m *Module) (*Result, error) { return m.MovePackage(".", "sub") }, "within the module"},
+		{"file as a package", func(m *Module) (*Result, error) { return m.MovePackage("main.go", "cmd") }, "is not a directory"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root := fixture(t, utilModule())
+			before := snapshot(t, root)
+			m, err := Load(root)
+			if err != nil {
+				t.Fatal(err)
+			}
+			result, err := tt.move(m)
+			if err == nil || !strings.Contains(err.Error(), tt.errorHas) {
+				t.Fatalf("error = %v, want one with %q", err, tt.errorHas)
+			}
+			if result != nil {
+				t.Errorf("result = %+v, want none", result)
+			}
+			if after := snapshot(t, root); !reflect.DeepEqual(after, before) {
+				t.Errorf("tree changed:\nbefore %v\nafter  %v", before, after)
+			}
+		})
+	}
+}
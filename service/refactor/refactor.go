@@ -0,0 +1,363 @@
+// Package refactor performs mechanical refactors of a Go module without a
+// model: renaming a symbol and moving a file or a package, with every
+// reference the type checker resolves updated. What it can't do safely it
+// reports as conflicts rather than guessing.
+package refactor
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/build"
+	"go/format"
+	"go/importer"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"ai-dev-agent/service/deps"
+)
+
+// Module is a Go module loaded for refactoring: the packages of its Go
+// files for the host platform, type-checked in import order. Files built
+// only elsewhere are parsed but not type-checked. Imports from other
+// modules are stubs, so references through them aren't resolved; the
+// build after a refactor catches what that misses.
+type Module struct {
+	Root string // directory
+	Path string // module path
+
+	fset  *token.FileSet
+	pkgs  []*pkg
+	files map[string]*ast.File // Go file, relative to Root -> syntax
+	src   map[string][]byte    // Go file -> content
+	other map[string]bool      // Go files not type-checked
+}
+
+// Result is what a refactor changes, not yet applied. Paths are relative
+// to the module root and slash-separated.
+type Result struct {
+	// Files is the new content of the files changed, under their new
+	// path for those moved.
+	Files map[string]string
+	// Moves maps moved files to their new path.
+	Moves map[string]string
+	// References counts the identifiers and import paths rewritten.
+	References int
+	// Conflicts are what the refactor couldn't resolve by itself.
+	Conflicts []Conflict
+}
+
+// Conflict is a place a refactor leaves broken or ambiguous.
+type Conflict struct {
+	File    string
+	Line    int
+	Message string
+}
+
+func (c Conflict) String() string {
+	if c.Line > 0 {
+		return fmt.Sprintf("%s:%d: %s", c.File, c.Line, c.Message)
+	}
+	return fmt.Sprintf("%s: %s", c.File, c.Message)
+}
+
+// Changed returns the files a result writes or moves, sorted.
+func (r *Result) Changed() []string {
+	seen := make(map[string]bool)
+	for f := range r.Files {
+		seen[f] = true
+	}
+	for _, to := range r.Moves {
+		seen[to] = true
+	}
+	files := make([]string, 0, len(seen))
+	for f := range seen {
+		files = append(files, f)
+	}
+	sort.Strings(files)
+	return files
+}
+
+// pkg is a type-checked package: a directory's files of one package
+// clause, so that an external test package is a pkg of its own.
+type pkg struct {
+	dir   string // relative to the root, "." for the root
+	name  string
+	files []*ast.File
+	types *types.Package
+	info  *types.Info
+}
+
+func (p *pkg) importPath(module string) string {
+	if p.dir == "." {
+		return module
+	}
+	return module + "/" + p.dir
+}
+
+// Load parses and type-checks the module rooted at root.
+func Load(root string) (*Module, error) {
+	mod, err := deps.ReadGoMod(root)
+	if err != nil {
+		return nil, err
+	}
+	m := &Module{
+		Root:  root,
+		Path:  mod.Module,
+		fset:  token.NewFileSet(),
+		files: make(map[string]*ast.File),
+		src:   make(map[string][]byte),
+		other: make(map[string]bool),
+	}
+	byKey := make(map[string]*pkg)
+	err = filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, _ := filepath.Rel(root, p)
+		rel = filepath.ToSlash(rel)
+		if d.IsDir() {
+			if rel != "." && skipDir(p, d.Name()) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !strings.HasSuffix(rel, ".go") {
+			return nil
+		}
+		content, err := os.ReadFile(p)
+		if err != nil {
+			return err
+		}
+		matched, _ := build.Default.MatchFile(filepath.Dir(p), d.Name())
+		f, err := parser.ParseFile(m.fset, rel, content, parser.ParseComments)
+		if err != nil {
+			if !matched {
+				return nil // not built here, nor refactored
+			}
+			return fmt.Errorf("%s: %w", rel, err)
+		}
+		m.files[rel] = f
+		m.src[rel] = content
+		if !matched {
+			m.other[rel] = true
+			return nil
+		}
+		key := path.Dir(rel) + " " + f.Name.Name
+		if byKey[key] == nil {
+			byKey[key] = &pkg{dir: path.Dir(rel), name: f.Name.Name}
+			m.pkgs = append(m.pkgs, byKey[key])
+		}
+		byKey[key].files = append(byKey[key].files, f)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(m.pkgs, func(i, j int) bool {
+		if m.pkgs[i].dir != m.pkgs[j].dir {
+			return m.pkgs[i].dir < m.pkgs[j].dir
+		}
+		return m.pkgs[i].name < m.pkgs[j].name
+	})
+	m.check()
+	return m, nil
+}
+
+// check type-checks the packages, each after the ones of the module it
+// imports, and the standard library from its export data. Errors are
+// ignored: what doesn't resolve isn't rewritten.
+func (m *Module) check() {
+	std := importer.ForCompiler(m.fset, "gc", nil)
+	byPath := make(map[string]*pkg)
+	for _, p := range m.pkgs {
+		if !strings.HasSuffix(p.name, "_test") {
+			byPath[p.importPath(m.Path)] = p
+		}
+	}
+	stubs := make(map[string]*types.Package)
+	var visit func(p *pkg)
+	importer := importerFunc(func(importPath string) (*types.Package, error) {
+		if p := byPath[importPath]; p != nil {
+			visit(p)
+			if p.types != nil {
+				return p.types, nil
+			}
+		}
+		if m.isStd(importPath) && stubs[importPath] == nil {
+			if pkg, err := std.Import(importPath); err == nil {
+				return pkg, nil
+			}
+		}
+		if stubs[importPath] == nil {
+			stubs[importPath] = types.NewPackage(importPath, guessName(importPath))
+			stubs[importPath].MarkComplete()
+		}
+		return stubs[importPath], nil
+	})
+	checking := make(map[*pkg]bool)
+	visit = func(p *pkg) {
+		if p.types != nil || checking[p] {
+			return // done, or an import cycle
+		}
+		checking[p] = true
+		p.info = &types.Info{
+			Defs:      make(map[*ast.Ident]types.Object),
+			Uses:      make(map[*ast.Ident]types.Object),
+			Implicits: make(map[ast.Node]types.Object),
+			Scopes:    make(map[ast.Node]*types.Scope),
+		}
+		conf := types.Config{Importer: importer, Error: func(error) {}, FakeImportC: true}
+		p.types, _ = conf.Check(p.importPath(m.Path), m.fset, p.files, p.info)
+	}
+	for _, p := range m.pkgs {
+		visit(p)
+	}
+}
+
+// lookup returns the package of dir, not its external tests.
+func (m *Module) lookup(dir string) *pkg {
+	for _, p := range m.pkgs {
+		if p.dir == dir && !strings.HasSuffix(p.name, "_test") {
+			return p
+		}
+	}
+	return nil
+}
+
+// pkgOf returns the package of a file, nil if it isn't type-checked.
+func (m *Module) pkgOf(f *ast.File) *pkg {
+	for _, p := range m.pkgs {
+		for _, pf := range p.files {
+			if pf == f {
+				return p
+			}
+		}
+	}
+	return nil
+}
+
+// Helper functions
+
+type importerFunc func(path string) (*types.Package, error)
+
+func (f importerFunc) Import(path string) (*types.Package, error) { return f(path) }
+
+// guessName returns the likely name of an imported package: the last
+// element of its path without a major version suffix.
+func guessName(importPath string) string {
+	elems := strings.Split(importPath, "/")
+	name := elems[len(elems)-1]
+	if len(elems) > 1 && len(name) > 1 && name[0] == 'v' && strings.Trim(name[1:], "0123456789") == "" {
+		name = elems[len(elems)-2]
+	}
+	if i := strings.Index(name, ".v"); i > 0 {
+		name = name[:i] // gopkg.in/yaml.v3
+	}
+	name = strings.TrimPrefix(name, "go-")
+	return strings.Map(func(r rune) rune {
+		if r == '-' || r == '.' {
+			return '_'
+		}
+		return r
+	}, name)
+}
+
+// skipDir reports whether the go command ignores a directory, or it holds
+// a module of its own.
+func skipDir(dir, name string) bool {
+	if name == "vendor" || name == "testdata" || strings.HasPrefix(name, ".") || strings.HasPrefix(name, "_") {
+		return true
+	}
+	_, err := os.Stat(filepath.Join(dir, "go.mod"))
+	return err == nil
+}
+
+// edit replaces the bytes [start, end) of a file.
+type edit struct {
+	start, end int
+	text       string
+}
+
+// edits collects edits by file.
+type edits map[string][]edit
+
+func (e edits) add(m *Module, pos token.Pos, old, text string) {
+	p := m.fset.Position(pos)
+	e.replace(p.Filename, p.Offset, p.Offset+len(old), text)
+}
+
+func (e edits) replace(file string, start, end int, text string) {
+	e[file] = append(e[file], edit{start, end, text})
+}
+
+// apply returns the edited content of each file, gofmt'ed if it was.
+func (e edits) apply(m *Module) map[string]string {
+	files := make(map[string]string, len(e))
+	for file, list := range e {
+		src := m.src[file]
+		// Back to front, so offsets stay valid; an insertion goes before
+		// what's replaced at the same offset.
+		sort.SliceStable(list, func(i, j int) bool {
+			if list[i].start != list[j].start {
+				return list[i].start > list[j].start
+			}
+			return list[i].end > list[j].end
+		})
+		out := append([]byte(nil), src...)
+		var last *edit
+		for i, ed := range list {
+			if last != nil && *last == ed {
+				continue // the same identifier reached twice
+			}
+			last = &list[i]
+			out = append(out[:ed.start], append([]byte(ed.text), out[ed.end:]...)...)
+		}
+		if formatted, err := format.Source(src); err == nil && bytes.Equal(formatted, src) {
+			if f, err := format.Source(out); err == nil {
+				out = f
+			}
+		}
+		files[file] = string(out)
+	}
+	return files
+}
+
+func sortedKeys(set map[string]bool) []string {
+	keys := make([]string, 0, len(set))
+	for k := range set {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func (m *Module) conflict(pos token.Pos, format string, args ...interface{}) Conflict {
+	p := m.fset.Position(pos)
+	return Conflict{File: p.Filename, Line: p.Line, Message: fmt.Sprintf(format, args...)}
+}
+
+func sortedFiles(files map[string]*ast.File) []string {
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func sortConflicts(conflicts []Conflict) {
+	sort.Slice(conflicts, func(i, j int) bool {
+		if conflicts[i].File != conflicts[j].File {
+			return conflicts[i].File < conflicts[j].File
+		}
+		return conflicts[i].Line < conflicts[j].Line
+	})
+}
@@ -0,0 +1,270 @@
+package refactor
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+	"go/types"
+	"strings"
+)
+
+// Rename renames a symbol of the package in dir: a package-level name
+// ("Open") or a method or field of a package type ("Store.Open"). Every
+// declaration and reference the type checker resolves is rewritten, along
+// with a doc comment starting with the old name.
+func (m *Module) Rename(dir, symbol, newName string) (*Result, error) {
+	if !token.IsIdentifier(newName) {
+		return nil, fmt.Errorf("%q is not a Go identifier", newName)
+	}
+	p := m.lookup(dir)
+	if p == nil || p.types == nil {
+		return nil, fmt.Errorf("no Go package in %s", dir)
+	}
+	obj, err := lookupSymbol(p.types, symbol)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", dir, err)
+	}
+	oldName := obj.Name()
+	result := &Result{}
+	if oldName == newName {
+		return result, nil
+	}
+	result.Conflicts = m.renameConflicts(p, obj, newName)
+
+	e := make(edits)
+	for _, q := range m.pkgs {
+		if q.info == nil {
+			continue
+		}
+		for id, o := range q.info.Defs {
+			if o != nil && origin(o) == obj {
+				e.add(m, id.Pos(), oldName, newName)
+				result.References++
+			}
+		}
+		for id, o := range q.info.Uses {
+			if o == nil || origin(o) != obj {
+				continue
+			}
+			e.add(m, id.Pos(), oldName, newName)
+			result.References++
+			if q != p && !token.IsExported(newName) {
+				result.Conflicts = append(result.Conflicts, m.conflict(id.Pos(), "%s is used outside its package, where unexported %s isn't visible", oldName, newName))
+				continue
+			}
+			// An unqualified reference is shadowed by a newName declared
+			// in between.
+			if scope := q.types.Scope().Innermost(id.Pos()); scope != nil && obj.Parent() == p.types.Scope() {
+				if _, other := scope.LookupParent(newName, id.Pos()); other != nil && other != obj && other.Parent() != p.types.Scope() {
+					result.Conflicts = append(result.Conflicts, m.conflict(id.Pos(), "%s would refer to the %s declared here", newName, objectKind(other)))
+				}
+			}
+		}
+	}
+	result.Conflicts = append(result.Conflicts, m.unchecked(oldName)...)
+	if doc := m.docComment(p, obj); doc != nil {
+		text := doc.List[0].Text
+		if strings.HasPrefix(text, "// "+oldName+" ") || text == "// "+oldName {
+			e.add(m, doc.List[0].Slash+3, oldName, newName)
+		}
+	}
+	result.Files = e.apply(m)
+	sortConflicts(result.Conflicts)
+	return result, nil
+}
+
+// unchecked reports the files not type-checked that mention name: they
+// may refer to what's renamed, but aren't rewritten.
+func (m *Module) unchecked(name string) []Conflict {
+	var conflicts []Conflict
+	for _, rel := range sortedKeys(m.other) {
+		found := false
+		ast.Inspect(m.files[rel], func(n ast.Node) bool {
+			if id, ok := n.(*ast.Ident); ok && id.Name == name && !found {
+				conflicts = append(conflicts, m.conflict(id.Pos(), "not built for this platform; check %s here by hand", name))
+				found = true
+			}
+			return !found
+		})
+	}
+	return conflicts
+}
+
+// lookupSymbol finds a package-level object, or a method or field of a
+// package type, declared in pkg.
+func lookupSymbol(pkg *types.Package, symbol string) (types.Object, error) {
+	typeName, member, isMember := strings.Cut(symbol, ".")
+	obj := pkg.Scope().Lookup(typeName)
+	if obj == nil {
+		return nil, fmt.Errorf("no %s declared", typeName)
+	}
+	if !isMember {
+		return obj, nil
+	}
+	if _, ok := obj.(*types.TypeName); !ok {
+		return nil, fmt.Errorf("%s is not a type", typeName)
+	}
+	m, _, _ := types.LookupFieldOrMethod(obj.Type(), true, pkg, member)
+	if m == nil {
+		return nil, fmt.Errorf("%s has no field or method %s", typeName, member)
+	}
+	if m.Pkg() != pkg {
+		return nil, fmt.Errorf("%s.%s is promoted from %s; rename it there", typeName, member, m.Pkg().Path())
+	}
+	if sel := types.NewMethodSet(types.NewPointer(obj.Type())).Lookup(pkg, member); sel != nil && len(sel.Index()) > 1 {
+		return nil, fmt.Errorf("%s.%s is promoted from an embedded field; rename it there", typeName, member)
+	}
+	return m, nil
+}
+
+// renameConflicts reports what newName already names where obj is
+// declared.
+func (m *Module) renameConflicts(p *pkg, obj types.Object, newName string) []Conflict {
+	var conflicts []Conflict
+	if obj.Parent() == p.types.Scope() {
+		if other := p.types.Scope().Lookup(newName); other != nil {
+			conflicts = append(conflicts, m.conflict(other.Pos(), "%s is already declared in package %s", newName, p.name))
+		}
+		for _, f := range p.files {
+			if s := p.info.Scopes[f]; s != nil && s.Lookup(newName) != nil {
+				conflicts = append(conflicts, m.conflict(f.Name.Pos(), "the file imports a package named %s", newName))
+			}
+		}
+		return conflicts
+	}
+	recv := recvType(obj)
+	if recv == nil {
+		return nil
+	}
+	if other, _, _ := types.LookupFieldOrMethod(recv, true, p.types, newName); other != nil {
+		conflicts = append(conflicts, m.conflict(other.Pos(), "%s already has a field or method %s", types.TypeString(recv, types.RelativeTo(p.types)), newName))
+	}
+	if fn, ok := obj.(*types.Func); ok {
+		// Interfaces of the module the method satisfies lose it.
+		for _, q := range m.pkgs {
+			if q.types == nil {
+				continue
+			}
+			scope := q.types.Scope()
+			for _, name := range scope.Names() {
+				iface, ok := scope.Lookup(name).Type().Underlying().(*types.Interface)
+				if !ok || scope.Lookup(name).Type() == recv {
+					continue
+				}
+				if im, _, _ := types.LookupFieldOrMethod(iface, false, fn.Pkg(), fn.Name()); im != nil && (types.Implements(recv, iface) || types.Implements(types.NewPointer(recv), iface)) {
+					conflicts = append(conflicts, m.conflict(im.Pos(), "%s satisfies %s.%s through %s, which the rename breaks", types.TypeString(recv, types.RelativeTo(p.types)), q.name, name, fn.Name()))
+				}
+			}
+		}
+	}
+	return conflicts
+}
+
+// docComment returns the doc comment of obj's declaration.
+func (m *Module) docComment(p *pkg, obj types.Object) *ast.CommentGroup {
+	var doc *ast.CommentGroup
+	for _, f := range p.files {
+		if f.Pos() > obj.Pos() || obj.Pos() > f.End() {
+			continue
+		}
+		ast.Inspect(f, func(n ast.Node) bool {
+			if doc != nil {
+				return false
+			}
+			switch n := n.(type) {
+			case *ast.FuncDecl:
+				if n.Name.Pos() == obj.Pos() {
+					doc = n.Doc
+				}
+			case *ast.GenDecl:
+				for _, spec := range n.Specs {
+					var names []*ast.Ident
+					var specDoc *ast.CommentGroup
+					switch s := spec.(type) {
+					case *ast.TypeSpec:
+						names, specDoc = []*ast.Ident{s.Name}, s.Doc
+					case *ast.ValueSpec:
+						names, specDoc = s.Names, s.Doc
+					}
+					for _, name := range names {
+						if name.Pos() == obj.Pos() {
+							doc = specDoc
+							if doc == nil && len(n.Specs) == 1 {
+								doc = n.Doc
+							}
+						}
+					}
+				}
+			case *ast.Field:
+				for _, name := range n.Names {
+					if name.Pos() == obj.Pos() {
+						doc = n.Doc
+					}
+				}
+			}
+			return true
+		})
+	}
+	if doc == nil || len(doc.List) == 0 {
+		return nil
+	}
+	return doc
+}
+
+// origin returns the generic object an instantiated one comes from.
+func origin(o types.Object) types.Object {
+	switch o := o.(type) {
+	case *types.Func:
+		return o.Origin()
+	case *types.Var:
+		return o.Origin()
+	}
+	return o
+}
+
+// recvType returns the named type a method or field belongs to.
+func recvType(obj types.Object) types.Type {
+	switch o := obj.(type) {
+	case *types.Func:
+		sig, _ := o.Type().(*types.Signature)
+		if sig == nil || sig.Recv() == nil {
+			return nil
+		}
+		t := sig.Recv().Type()
+		if ptr, ok := t.(*types.Pointer); ok {
+			t = ptr.Elem()
+		}
+		return t
+	case *types.Var:
+		// A field: find the struct type of the package declaring it.
+		scope := o.Pkg().Scope()
+		for _, name := range scope.Names() {
+			tn, ok := scope.Lookup(name).(*types.TypeName)
+			if !ok {
+				continue
+			}
+			if st, ok := tn.Type().Underlying().(*types.Struct); ok {
+				for i := 0; i < st.NumFields(); i++ {
+					if st.Field(i) == o {
+						return tn.Type()
+					}
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func objectKind(o types.Object) string {
+	switch o.(type) {
+	case *types.Func:
+		return "function " + o.Name()
+	case *types.TypeName:
+		return "type " + o.Name()
+	case *types.PkgName:
+		return "import " + o.Name()
+	case *types.Const:
+		return "constant " + o.Name()
+	}
+	return "variable " + o.Name()
+}
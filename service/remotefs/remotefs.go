@@ -0,0 +1,233 @@
+// Package remotefs reads and writes the files of a project on another
+// machine, and runs commands there, over ssh. The agent keeps running
+// locally while the code and the toolchain that verifies it live on a
+// remote dev box or container.
+package remotefs
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"ai-dev-agent/service/executor"
+)
+
+// Errors
+var (
+	ErrFileNotFound    = errors.New("file not found")
+	ErrPathOutsideRoot = errors.New("path is outside root directory")
+	ErrReadOnly        = errors.New("read-only mode: writes are disabled")
+	ErrSSHFailed       = errors.New("ssh command failed")
+)
+
+// missingStatus is the exit status of a read of a file that doesn't exist.
+const missingStatus = 3
+
+// Config holds the remote host and project.
+type Config struct {
+	// Target is the ssh destination, [user@]host or a Host of
+	// ~/.ssh/config.
+	Target string
+	// Root is the project directory on the host.
+	Root         string
+	Port         int
+	IdentityFile string
+	// Options are further ssh -o options, e.g. "ConnectTimeout=10".
+	Options []string
+	// Timeout bounds each file operation.
+	Timeout time.Duration
+	// BackupEnabled copies a file to .ai-backup on the host before it is
+	// overwritten.
+	BackupEnabled bool
+	ReadOnly      bool
+}
+
+// DefaultConfig returns a default configuration.
+func DefaultConfig() Config {
+	return Config{Timeout: 30 * time.Second, BackupEnabled: true}
+}
+
+// ParseSpec splits a [user@]host:dir spec into its target and directory.
+func ParseSpec(spec string) (target, root string, err error) {
+	target, root, ok := strings.Cut(spec, ":")
+	if !ok || target == "" || root == "" {
+		return "", "", fmt.Errorf("invalid ssh spec %q: want [user@]host:/path/to/project", spec)
+	}
+	return target, root, nil
+}
+
+// Client operates on a project on a remote host.
+type Client struct {
+	config Config
+}
+
+// NewClient creates a new client. The root must be absolute.
+func NewClient(config Config) (*Client, error) {
+	if config.Target == "" {
+		return nil, fmt.Errorf("ssh: no host")
+	}
+	if !path.IsAbs(config.Root) {
+		return nil, fmt.Errorf("ssh: project directory %q must be absolute", config.Root)
+	}
+	if config.Timeout == 0 {
+		config.Timeout = 30 * time.Second
+	}
+	config.Root = path.Clean(config.Root)
+	return &Client{config: config}, nil
+}
+
+// GetRoot returns the project directory on the host.
+func (c *Client) GetRoot() string {
+	return c.config.Root
+}
+
+// Target returns the ssh destination.
+func (c *Client) Target() string {
+	return c.config.Target
+}
+
+// Check connects to the host and checks that the project directory exists.
+func (c *Client) Check(ctx context.Context) error {
+	if _, err := c.run(ctx, "test -d "+quote(c.config.Root), nil); err != nil {
+		return fmt.Errorf("%s:%s: %w", c.config.Target, c.config.Root, err)
+	}
+	return nil
+}
+
+// ReadFile reads a file of the project.
+func (c *Client) ReadFile(file string) (string, error) {
+	p, err := c.resolvePath(file)
+	if err != nil {
+		return "", err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), c.config.Timeout)
+	defer cancel()
+	script := fmt.Sprintf("test -f %s || exit %d; cat %s", quote(p), missingStatus, quote(p))
+	out, err := c.run(ctx, script, nil)
+	if err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) && exitErr.ExitCode() == missingStatus {
+			return "", ErrFileNotFound
+		}
+		return "", err
+	}
+	return out, nil
+}
+
+// WriteFile writes a file of the project, creating its directory. The
+// content is written next to the file and renamed over it, so an
+// interrupted write leaves the old file in place.
+func (c *Client) WriteFile(file, content string) error {
+	if c.config.ReadOnly {
+		return ErrReadOnly
+	}
+	p, err := c.resolvePath(file)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), c.config.Timeout)
+	defer cancel()
+
+	var script strings.Builder
+	script.WriteString("set -e; mkdir -p " + quote(path.Dir(p)) + "; ")
+	if c.config.BackupEnabled {
+		rel := strings.TrimPrefix(p, c.config.Root+"/")
+		backup := path.Join(c.config.Root, ".ai-backup", rel+"."+strconv.FormatInt(time.Now().Unix(), 10))
+		fmt.Fprintf(&script, "if [ -f %s ]; then mkdir -p %s; cp %s %s; fi; ", quote(p), quote(path.Dir(backup)), quote(p), quote(backup))
+	}
+	tmp := p + ".aidev-tmp"
+	fmt.Fprintf(&script, "cat > %s; mv %s %s", quote(tmp), quote(tmp), quote(p))
+	_, err = c.run(ctx, script.String(), strings.NewReader(content))
+	return err
+}
+
+// FileExists reports whether a file of the project exists.
+func (c *Client) FileExists(file string) bool {
+	p, err := c.resolvePath(file)
+	if err != nil {
+		return false
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), c.config.Timeout)
+	defer cancel()
+	_, err = c.run(ctx, "test -e "+quote(p), nil)
+	return err == nil
+}
+
+// Command returns the local command that runs name with args on the host,
+// in the project directory dir, a path relative to the root. It is meant
+// for an executor, which applies its own timeout and captures the output.
+func (c *Client) Command(dir, name string, args ...string) (string, []string, error) {
+	p, err := c.resolvePath(dir)
+	if err != nil {
+		return "", nil, err
+	}
+	script := "cd " + quote(p) + " && exec " + executor.QuoteArgs(name, args...)
+	return "ssh", c.sshArgs(script), nil
+}
+
+// Helper functions
+
+// run runs a shell script on the host and returns its output.
+func (c *Client) run(ctx context.Context, script string, stdin *strings.Reader) (string, error) {
+	cmd := exec.CommandContext(ctx, "ssh", c.sshArgs(script)...)
+	var out, errOut bytes.Buffer
+	cmd.Stdout = &out
+	cmd.Stderr = &errOut
+	if stdin != nil {
+		cmd.Stdin = stdin
+	}
+	if err := cmd.Run(); err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) && exitErr.ExitCode() == missingStatus {
+			return "", err
+		}
+		if msg := strings.TrimSpace(errOut.String()); msg != "" {
+			err = errors.New(msg)
+		}
+		return "", fmt.Errorf("%w: %s: %v", ErrSSHFailed, c.config.Target, err)
+	}
+	return out.String(), nil
+}
+
+// sshArgs are the ssh arguments that run script on the host. Batch mode
+// fails rather than prompts for a password, which would hang a run.
+func (c *Client) sshArgs(script string) []string {
+	args := []string{"-o", "BatchMode=yes"}
+	for _, o := range c.config.Options {
+		args = append(args, "-o", o)
+	}
+	if c.config.Port != 0 {
+		args = append(args, "-p", strconv.Itoa(c.config.Port))
+	}
+	if c.config.IdentityFile != "" {
+		args = append(args, "-i", c.config.IdentityFile)
+	}
+	return append(args, "--", c.config.Target, script)
+}
+
+// resolvePath returns the path on the host of a project path, which must
+// lie within the root.
+func (c *Client) resolvePath(file string) (string, error) {
+	file = strings.ReplaceAll(file, `\`, "/")
+	var p string
+	if path.IsAbs(file) {
+		p = path.Clean(file)
+	} else {
+		p = path.Join(c.config.Root, file)
+	}
+	if p != c.config.Root && !strings.HasPrefix(p, strings.TrimSuffix(c.config.Root, "/")+"/") {
+		return "", ErrPathOutsideRoot
+	}
+	return p, nil
+}
+
+// quote quotes s as one word for the remote shell.
+func quote(s string) string {
+	return executor.QuoteArgs(s)
+}
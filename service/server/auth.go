@@ -0,0 +1,121 @@
+package server
+
+import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Errors
+var (
+	ErrUnauthorized = errors.New("missing or invalid token")
+	ErrForbidden    = errors.New("token does not permit this request")
+)
+
+// Access levels of a token.
+const (
+	AccessReadOnly  = "read-only"
+	AccessReadWrite = "read-write"
+)
+
+// Token grants access to one workspace root.
+type Token struct {
+	Name   string `yaml:"name"`
+	Token  string `yaml:"token"`
+	Root   string `yaml:"root"`
+	Access string `yaml:"access"` // read-only or read-write (default)
+}
+
+// ReadOnly reports whether the token only permits analysis requests.
+func (t Token) ReadOnly() bool {
+	return t.Access == AccessReadOnly
+}
+
+// LoadTokens reads a tokens file:
+//
+//	tokens:
+//	  - name: editor
+//	    token: <secret>
+//	    root: /home/me/project
+//	    access: read-write
+func LoadTokens(path string) ([]Token, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var file struct {
+		Tokens []Token `yaml:"tokens"`
+	}
+	if err := yaml.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	for i, t := range file.Tokens {
+		if t.Token == "" || t.Root == "" {
+			return nil, fmt.Errorf("%s: token %d needs token and root", path, i+1)
+		}
+		switch t.Access {
+		case "":
+			file.Tokens[i].Access = AccessReadWrite
+		case AccessReadOnly, AccessReadWrite:
+		default:
+			return nil, fmt.Errorf("%s: token %q: unknown access %q", path, t.Name, t.Access)
+		}
+		root, err := filepath.Abs(t.Root)
+		if err != nil {
+			return nil, err
+		}
+		file.Tokens[i].Root = root
+		if t.Name == "" {
+			file.Tokens[i].Name = fmt.Sprintf("token-%d", i+1)
+		}
+	}
+	return file.Tokens, nil
+}
+
+// authenticate returns the token matching the request's bearer credential.
+// Without configured tokens, every request gets read-write access to the
+// default root.
+func (s *Server) authenticate(authHeader string) (Token, error) {
+	if len(s.config.Tokens) == 0 {
+		return Token{Name: "local", Root: s.config.Root, Access: AccessReadWrite}, nil
+	}
+	secret := strings.TrimPrefix(authHeader, "Bearer ")
+	if secret == "" || secret == authHeader {
+		return Token{}, ErrUnauthorized
+	}
+	for _, t := range s.config.Tokens {
+		if subtle.ConstantTimeCompare([]byte(secret), []byte(t.Token)) == 1 {
+			return t, nil
+		}
+	}
+	return Token{}, ErrUnauthorized
+}
+
+// scope resolves a requested workdir inside the token's root.
+func (t Token) scope(workDir string) (string, error) {
+	if workDir == "" {
+		return t.Root, nil
+	}
+	if !filepath.IsAbs(workDir) {
+		workDir = filepath.Join(t.Root, workDir)
+	}
+	workDir = filepath.Clean(workDir)
+	real, err := filepath.EvalSymlinks(workDir)
+	if err != nil {
+		return "", fmt.Errorf("workdir: %w", err)
+	}
+	realRoot, err := filepath.EvalSymlinks(t.Root)
+	if err != nil {
+		return "", fmt.Errorf("root: %w", err)
+	}
+	rel, err := filepath.Rel(realRoot, real)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("%w: workdir outside %s", ErrForbidden, t.Root)
+	}
+	return workDir, nil
+}
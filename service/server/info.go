@@ -0,0 +1,144 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"ai-dev-agent/service/orchestrator"
+)
+
+// maxRequestBytes bounds the body of a request.
+const maxRequestBytes = 1 << 20
+
+// jobModes are the modes POST /v1/jobs accepts, the analysis ones last.
+var jobModes = []orchestrator.Mode{
+	orchestrator.ModeRefactor, orchestrator.ModeFix, orchestrator.ModeGenerate,
+	orchestrator.ModeReview, orchestrator.ModeExplain,
+}
+
+// Info describes the server to a client, so it can check the version and
+// what it may ask for before submitting jobs. The caller fills in the
+// version, providers and engine limits; the server adds the rest.
+type Info struct {
+	Version   string     `json:"version"`
+	Providers []Provider `json:"providers"`
+	// Modes are the job modes the client's token may submit.
+	Modes  []string `json:"modes"`
+	Access string   `json:"access"`
+	Limits Limits   `json:"limits"`
+}
+
+// Provider is an LLM provider the server calls, with the models it is
+// configured to use.
+type Provider struct {
+	Name   string   `json:"name"`
+	Models []string `json:"models"`
+}
+
+// Limits bound what a job may do and how many run.
+type Limits struct {
+	Workers         int    `json:"workers"`
+	ClientCap       int    `json:"client_cap"`
+	RetainedJobs    int    `json:"retained_jobs"`
+	MaxRequestBytes int    `json:"max_request_bytes"`
+	MaxRetries      int    `json:"max_retries"`
+	Timeout         string `json:"timeout"` // of a model request
+	MaxWriteFiles   int    `json:"max_write_files"`
+	MaxWriteBytes   int    `json:"max_write_bytes"`
+	ContextWindow   int    `json:"context_window,omitempty"` // of the default model, in tokens
+}
+
+// info returns the server's Info as seen by token.
+func (s *Server) info(token Token) Info {
+	info := s.config.Info
+	info.Modes = nil
+	for _, mode := range jobModes {
+		if !token.ReadOnly() || mode.ReadOnly() {
+			info.Modes = append(info.Modes, string(mode))
+		}
+	}
+	info.Access = AccessReadWrite
+	if token.ReadOnly() {
+		info.Access = AccessReadOnly
+	}
+	info.Limits.Workers = s.queue.config.Workers
+	info.Limits.ClientCap = s.queue.config.ClientCap
+	info.Limits.RetainedJobs = s.queue.config.Retain
+	info.Limits.MaxRequestBytes = maxRequestBytes
+	return info
+}
+
+func (s *Server) handleInfo(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	token, err := s.authenticate(r.Header.Get("Authorization"))
+	if err != nil {
+		writeError(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, s.info(token))
+}
+
+// JSON-RPC 2.0 error codes.
+const (
+	rpcParseError     = -32700
+	rpcInvalidRequest = -32600
+	rpcMethodNotFound = -32601
+)
+
+type rpcRequest struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params,omitempty"`
+}
+
+type rpcResponse struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id"`
+	Result  interface{}     `json:"result,omitempty"`
+	Error   *rpcError       `json:"error,omitempty"`
+}
+
+type rpcError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+// handleRPC serves JSON-RPC 2.0 calls for clients, such as editor plugins,
+// that speak it. initialize returns the server's Info; jobs are submitted
+// over the REST endpoints.
+func (s *Server) handleRPC(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	token, err := s.authenticate(r.Header.Get("Authorization"))
+	if err != nil {
+		writeError(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+	var req rpcRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxRequestBytes)).Decode(&req); err != nil {
+		writeRPC(w, rpcResponse{ID: json.RawMessage("null"), Error: &rpcError{rpcParseError, "parse error: " + err.Error()}})
+		return
+	}
+	if req.ID == nil {
+		req.ID = json.RawMessage("null")
+	}
+	switch {
+	case req.JSONRPC != "2.0" || req.Method == "":
+		writeRPC(w, rpcResponse{ID: req.ID, Error: &rpcError{rpcInvalidRequest, "invalid request: want jsonrpc 2.0 and a method"}})
+	case req.Method == "initialize":
+		writeRPC(w, rpcResponse{ID: req.ID, Result: s.info(token)})
+	default:
+		writeRPC(w, rpcResponse{ID: req.ID, Error: &rpcError{rpcMethodNotFound, "method not found: " + req.Method}})
+	}
+}
+
+func writeRPC(w http.ResponseWriter, resp rpcResponse) {
+	resp.JSONRPC = "2.0"
+	writeJSON(w, http.StatusOK, resp)
+}
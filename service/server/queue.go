@@ -0,0 +1,277 @@
+// Package server runs agent jobs behind an HTTP API with a priority queue.
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"ai-dev-agent/service/orchestrator"
+)
+
+// Errors
+var (
+	ErrJobNotFound = errors.New("job not found")
+	ErrQueueClosed = errors.New("queue closed")
+)
+
+// Priority orders jobs; lower values run first.
+type Priority int
+
+const (
+	PriorityInteractive Priority = iota // editor requests
+	PriorityBatch                       // scripted/CI requests
+	PriorityWatch                       // background watch jobs
+)
+
+// ParsePriority maps a name to a Priority. Unknown names are batch.
+func ParsePriority(name string) Priority {
+	switch name {
+	case "interactive":
+		return PriorityInteractive
+	case "watch":
+		return PriorityWatch
+	}
+	return PriorityBatch
+}
+
+func (p Priority) String() string {
+	switch p {
+	case PriorityInteractive:
+		return "interactive"
+	case PriorityWatch:
+		return "watch"
+	}
+	return "batch"
+}
+
+// JobStatus is the lifecycle state of a job.
+type JobStatus string
+
+const (
+	StatusQueued    JobStatus = "queued"
+	StatusRunning   JobStatus = "running"
+	StatusSucceeded JobStatus = "succeeded"
+	StatusFailed    JobStatus = "failed"
+)
+
+// Job is one queued agent request.
+type Job struct {
+	ID         string
+	Client     string
+	Priority   Priority
+	Request    orchestrator.Request
+	ReadOnly   bool       // the job may not write to its workspace
+	CI         *CIFailure // set for CI webhook jobs, which fix a remote checkout
+	Status     JobStatus
+	Result     *orchestrator.Result
+	CreatedAt  time.Time
+	StartedAt  time.Time
+	FinishedAt time.Time
+
+	token string // name of the submitting token
+	seq   int64
+}
+
+// Runner executes a job.
+type Runner func(ctx context.Context, job *Job) *orchestrator.Result
+
+// QueueConfig holds queue configuration.
+type QueueConfig struct {
+	Workers   int // jobs running at once
+	ClientCap int // jobs running at once per client
+	// Retain bounds how many finished jobs are kept for status queries.
+	Retain int
+}
+
+// DefaultQueueConfig returns a default configuration.
+func DefaultQueueConfig() QueueConfig {
+	return QueueConfig{Workers: 2, ClientCap: 1, Retain: 200}
+}
+
+// Queue schedules jobs by priority, then arrival, honoring per-client caps.
+type Queue struct {
+	mu      sync.Mutex
+	cond    *sync.Cond
+	config  QueueConfig
+	run     Runner
+	pending []*Job // in run order
+	jobs    map[string]*Job
+	done    []string
+	running map[string]int // client -> running jobs
+	seq     int64
+	closed  bool
+	wg      sync.WaitGroup
+}
+
+// NewQueue creates a queue; Start launches its workers.
+func NewQueue(config QueueConfig, run Runner) *Queue {
+	if config.Workers < 1 {
+		config.Workers = 1
+	}
+	if config.ClientCap < 1 {
+		config.ClientCap = config.Workers
+	}
+	q := &Queue{config: config, run: run, jobs: make(map[string]*Job), running: make(map[string]int)}
+	q.cond = sync.NewCond(&q.mu)
+	return q
+}
+
+// Start launches the workers; they stop when ctx is done or Close is called.
+func (q *Queue) Start(ctx context.Context) {
+	for i := 0; i < q.config.Workers; i++ {
+		q.wg.Add(1)
+		go q.worker(ctx)
+	}
+	go func() {
+		<-ctx.Done()
+		q.Close()
+	}()
+}
+
+// Close stops accepting jobs and waits for running ones.
+func (q *Queue) Close() {
+	q.mu.Lock()
+	q.closed = true
+	q.cond.Broadcast()
+	q.mu.Unlock()
+	q.wg.Wait()
+}
+
+// Submit enqueues a job, assigning its ID and queued state.
+func (q *Queue) Submit(job *Job) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.closed {
+		return ErrQueueClosed
+	}
+	q.seq++
+	job.ID = fmt.Sprintf("job-%d", q.seq)
+	job.Status = StatusQueued
+	job.CreatedAt = time.Now()
+	job.seq = q.seq
+	q.jobs[job.ID] = job
+	i := sort.Search(len(q.pending), func(i int) bool { return job.before(q.pending[i]) })
+	q.pending = append(q.pending, nil)
+	copy(q.pending[i+1:], q.pending[i:])
+	q.pending[i] = job
+	q.cond.Broadcast()
+	return nil
+}
+
+// JobInfo is a snapshot of a job with its queue position (1-based, 0 when
+// not queued).
+type JobInfo struct {
+	Job
+	Position int
+}
+
+// Get returns a snapshot of a job.
+func (q *Queue) Get(id string) (JobInfo, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	job, ok := q.jobs[id]
+	if !ok {
+		return JobInfo{}, ErrJobNotFound
+	}
+	return JobInfo{Job: *job, Position: q.position(job)}, nil
+}
+
+// Stats summarizes the queue.
+type Stats struct {
+	Queued  int            `json:"queued"`
+	Running int            `json:"running"`
+	Clients map[string]int `json:"clients"` // running jobs per client
+	Waiting []string       `json:"waiting"` // queued job IDs in run order
+}
+
+// Stats returns a snapshot of the queue.
+func (q *Queue) Stats() Stats {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	s := Stats{Queued: len(q.pending), Clients: make(map[string]int)}
+	for client, n := range q.running {
+		s.Running += n
+		s.Clients[client] = n
+	}
+	for _, job := range q.pending {
+		s.Waiting = append(s.Waiting, job.ID)
+	}
+	return s
+}
+
+func (q *Queue) worker(ctx context.Context) {
+	defer q.wg.Done()
+	for {
+		job := q.next()
+		if job == nil {
+			return
+		}
+		result := q.run(ctx, job)
+		q.finish(job, result)
+	}
+}
+
+// next blocks until a job whose client is under its cap is available.
+func (q *Queue) next() *Job {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for {
+		if q.closed {
+			return nil
+		}
+		for i, job := range q.pending {
+			if q.running[job.Client] < q.config.ClientCap {
+				q.pending = append(q.pending[:i], q.pending[i+1:]...)
+				job.Status = StatusRunning
+				job.StartedAt = time.Now()
+				q.running[job.Client]++
+				return job
+			}
+		}
+		q.cond.Wait()
+	}
+}
+
+func (q *Queue) finish(job *Job, result *orchestrator.Result) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	job.Result = result
+	job.FinishedAt = time.Now()
+	job.Status = StatusFailed
+	if result != nil && result.Success {
+		job.Status = StatusSucceeded
+	}
+	if q.running[job.Client]--; q.running[job.Client] <= 0 {
+		delete(q.running, job.Client)
+	}
+
+	q.done = append(q.done, job.ID)
+	if q.config.Retain > 0 && len(q.done) > q.config.Retain {
+		delete(q.jobs, q.done[0])
+		q.done = q.done[1:]
+	}
+	q.cond.Broadcast()
+}
+
+func (q *Queue) position(job *Job) int {
+	if job.Status != StatusQueued {
+		return 0
+	}
+	for i, j := range q.pending {
+		if j == job {
+			return i + 1
+		}
+	}
+	return 0
+}
+
+func (j *Job) before(other *Job) bool {
+	if j.Priority != other.Priority {
+		return j.Priority < other.Priority
+	}
+	return j.seq < other.seq
+}
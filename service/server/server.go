@@ -0,0 +1,252 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"ai-dev-agent/service/orchestrator"
+)
+
+// Config holds server configuration.
+type Config struct {
+	Addr  string
+	Queue QueueConfig
+	// Root is the workspace of unauthenticated requests when no tokens
+	// are configured.
+	Root    string
+	Tokens  []Token
+	Webhook WebhookConfig
+	// Info is what /v1/info and the initialize call report, completed
+	// with the queue's limits and the modes of the client's token.
+	Info Info
+}
+
+// DefaultConfig returns a default configuration.
+func DefaultConfig() Config {
+	return Config{Addr: "127.0.0.1:8421", Queue: DefaultQueueConfig(), Webhook: DefaultWebhookConfig()}
+}
+
+// Server exposes the job queue over HTTP.
+type Server struct {
+	config  Config
+	queue   *Queue
+	limiter *rateLimiter
+	http    *http.Server
+}
+
+// New creates a server that runs jobs with run.
+func New(config Config, run Runner) *Server {
+	s := &Server{
+		config:  config,
+		queue:   NewQueue(config.Queue, run),
+		limiter: newRateLimiter(config.Webhook.Rate, config.Webhook.Burst),
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v1/jobs", s.handleJobs)
+	mux.HandleFunc("/v1/jobs/", s.handleJob)
+	mux.HandleFunc("/v1/status", s.handleStatus)
+	mux.HandleFunc("/v1/info", s.handleInfo)
+	mux.HandleFunc("/v1/rpc", s.handleRPC)
+	if config.Webhook.Secret != "" {
+		mux.HandleFunc("/v1/webhooks/ci", s.handleCIWebhook)
+	}
+	s.http = &http.Server{Addr: config.Addr, Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	return s
+}
+
+// Queue returns the server's job queue.
+func (s *Server) Queue() *Queue {
+	return s.queue
+}
+
+// ListenAndServe serves until ctx is done, then drains running jobs.
+func (s *Server) ListenAndServe(ctx context.Context) error {
+	s.queue.Start(ctx)
+	errCh := make(chan error, 1)
+	go func() { errCh <- s.http.ListenAndServe() }()
+
+	select {
+	case err := <-errCh:
+		return err
+	case <-ctx.Done():
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		s.http.Shutdown(shutdownCtx)
+		s.queue.Close()
+		return nil
+	}
+}
+
+// JobRequest is the body of POST /v1/jobs.
+type JobRequest struct {
+	Mode        string   `json:"mode"`
+	Files       []string `json:"files"`
+	Context     []string `json:"context,omitempty"`
+	Instruction string   `json:"instruction"`
+	WorkDir     string   `json:"workdir,omitempty"`
+	Priority    string   `json:"priority,omitempty"` // interactive, batch (default) or watch
+}
+
+// JobResponse describes a job.
+type JobResponse struct {
+	ID           string                 `json:"id"`
+	Client       string                 `json:"client"`
+	Priority     string                 `json:"priority"`
+	Status       string                 `json:"status"`
+	Position     int                    `json:"position,omitempty"`
+	FilesWritten []string               `json:"files_written,omitempty"`
+	Output       string                 `json:"output,omitempty"`
+	Findings     []orchestrator.Finding `json:"findings,omitempty"`
+	Attempts     int                    `json:"attempts,omitempty"`
+	Error        string                 `json:"error,omitempty"`
+	CreatedAt    string                 `json:"created_at"`
+	Duration     string                 `json:"duration,omitempty"`
+}
+
+func (s *Server) handleJobs(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	token, err := s.authenticate(r.Header.Get("Authorization"))
+	if err != nil {
+		writeError(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+	var req JobRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxRequestBytes)).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request: "+err.Error())
+		return
+	}
+	mode := orchestrator.Mode(req.Mode)
+	switch mode {
+	case orchestrator.ModeRefactor, orchestrator.ModeFix, orchestrator.ModeGenerate:
+		if token.ReadOnly() {
+			writeError(w, http.StatusForbidden, "read-only token: only review and explain are allowed")
+			return
+		}
+	case orchestrator.ModeReview, orchestrator.ModeExplain:
+	default:
+		writeError(w, http.StatusBadRequest, "mode must be refactor, fix, generate, review or explain")
+		return
+	}
+	if len(req.Files) == 0 && mode != orchestrator.ModeGenerate {
+		writeError(w, http.StatusBadRequest, "no target files specified")
+		return
+	}
+	workDir, err := token.scope(req.WorkDir)
+	if err != nil {
+		writeError(w, http.StatusForbidden, err.Error())
+		return
+	}
+
+	client := token.Name
+	if len(s.config.Tokens) == 0 {
+		client = clientID(r)
+	}
+	job := &Job{
+		Client:   client,
+		Priority: ParsePriority(req.Priority),
+		ReadOnly: token.ReadOnly() || mode.ReadOnly(),
+		Request: orchestrator.Request{
+			Mode:        mode,
+			Files:       req.Files,
+			Context:     req.Context,
+			Instruction: req.Instruction,
+			WorkDir:     workDir,
+		},
+		token: token.Name,
+	}
+	if err := s.queue.Submit(job); err != nil {
+		writeError(w, http.StatusServiceUnavailable, err.Error())
+		return
+	}
+	info, _ := s.queue.Get(job.ID)
+	writeJSON(w, http.StatusAccepted, jobResponse(info))
+}
+
+func (s *Server) handleJob(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	token, err := s.authenticate(r.Header.Get("Authorization"))
+	if err != nil {
+		writeError(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+	info, err := s.queue.Get(strings.TrimPrefix(r.URL.Path, "/v1/jobs/"))
+	// Jobs are only visible to the token that submitted them.
+	if errors.Is(err, ErrJobNotFound) || info.token != token.Name {
+		writeError(w, http.StatusNotFound, ErrJobNotFound.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, jobResponse(info))
+}
+
+func (s *Server) handleStatus(w http.ResponseWriter, r *http.Request) {
+	if _, err := s.authenticate(r.Header.Get("Authorization")); err != nil {
+		writeError(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, s.queue.Stats())
+}
+
+// Helper functions
+
+// clientID identifies the caller for per-client concurrency caps.
+func clientID(r *http.Request) string {
+	if id := r.Header.Get("X-Client-ID"); id != "" {
+		return id
+	}
+	return remoteHost(r)
+}
+
+// remoteHost returns the address of the connection's peer.
+func remoteHost(r *http.Request) string {
+	host := r.RemoteAddr
+	if i := strings.LastIndexByte(host, ':'); i >= 0 {
+		host = host[:i]
+	}
+	return host
+}
+
+func jobResponse(info JobInfo) JobResponse {
+	resp := JobResponse{
+		ID:        info.ID,
+		Client:    info.Client,
+		Priority:  info.Priority.String(),
+		Status:    string(info.Status),
+		Position:  info.Position,
+		CreatedAt: info.CreatedAt.UTC().Format(time.RFC3339),
+	}
+	if res := info.Result; res != nil {
+		resp.FilesWritten = res.FilesWritten
+		if info.Request.Mode.ReadOnly() || info.CI != nil {
+			resp.Output = res.Output
+			resp.Findings = res.Findings
+		}
+		resp.Attempts = res.Attempts
+		if res.Error != nil {
+			resp.Error = res.Error.Error()
+		}
+	}
+	if !info.FinishedAt.IsZero() {
+		resp.Duration = info.FinishedAt.Sub(info.StartedAt).Round(time.Millisecond).String()
+	}
+	return resp
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, msg string) {
+	writeJSON(w, status, map[string]string{"error": msg})
+}
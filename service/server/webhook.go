@@ -0,0 +1,194 @@
+package server
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"ai-dev-agent/service/gitrepo"
+	"ai-dev-agent/service/orchestrator"
+)
+
+// SignatureHeader carries the hex HMAC-SHA256 of a webhook body, prefixed
+// with "sha256=" as GitHub sends it.
+const SignatureHeader = "X-Hub-Signature-256"
+
+// WebhookConfig holds CI webhook configuration.
+type WebhookConfig struct {
+	// Secret signs webhook bodies. The endpoint is disabled without one.
+	Secret string
+	// Rate and Burst bound accepted deliveries per source and per repo.
+	Rate  time.Duration // one delivery per Rate
+	Burst int
+	// Repos lists the repositories that may be fixed; deliveries for any
+	// other, or all of them when it is empty, are refused.
+	Repos []string
+}
+
+// DefaultWebhookConfig returns a default configuration.
+func DefaultWebhookConfig() WebhookConfig {
+	return WebhookConfig{Rate: time.Minute, Burst: 5}
+}
+
+// CIFailure is the body of POST /v1/webhooks/ci.
+type CIFailure struct {
+	Repo   string `json:"repo"`   // clone URL
+	Commit string `json:"commit"` // failing commit
+	Branch string `json:"branch"` // branch the pull request targets
+	Job    string `json:"job"`    // name of the failing CI job
+	Log    string `json:"log"`    // output of the failing job
+}
+
+func (s *Server) handleCIWebhook(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, 4<<20))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request: "+err.Error())
+		return
+	}
+	if !validSignature(s.config.Webhook.Secret, body, r.Header.Get(SignatureHeader)) {
+		writeError(w, http.StatusUnauthorized, "invalid signature")
+		return
+	}
+	// X-Client-ID is caller-controlled, so public deliveries are limited
+	// by address.
+	if !s.limiter.Allow("source:" + remoteHost(r)) {
+		writeError(w, http.StatusTooManyRequests, "rate limit exceeded")
+		return
+	}
+
+	var failure CIFailure
+	if err := json.Unmarshal(body, &failure); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request: "+err.Error())
+		return
+	}
+	if failure.Repo == "" || failure.Commit == "" || failure.Branch == "" || failure.Log == "" {
+		writeError(w, http.StatusBadRequest, "repo, commit, branch and log are required")
+		return
+	}
+	if err := gitrepo.ValidateRemote(failure.Repo); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err := gitrepo.ValidateRef(failure.Commit); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if !s.repoAllowed(failure.Repo) {
+		writeError(w, http.StatusForbidden, "repository not allowed")
+		return
+	}
+	if !s.limiter.Allow("repo:" + failure.Repo) {
+		writeError(w, http.StatusTooManyRequests, "rate limit exceeded for repository")
+		return
+	}
+
+	job := &Job{
+		Client:   "webhook",
+		Priority: PriorityBatch,
+		Request:  orchestrator.Request{Mode: orchestrator.ModeFix},
+		CI:       &failure,
+		token:    "webhook",
+	}
+	if err := s.queue.Submit(job); err != nil {
+		writeError(w, http.StatusServiceUnavailable, err.Error())
+		return
+	}
+	info, _ := s.queue.Get(job.ID)
+	writeJSON(w, http.StatusAccepted, jobResponse(info))
+}
+
+func (s *Server) repoAllowed(repo string) bool {
+	for _, r := range s.config.Webhook.Repos {
+		if strings.TrimSuffix(r, ".git") == strings.TrimSuffix(repo, ".git") {
+			return true
+		}
+	}
+	return false
+}
+
+// Helper functions
+
+func validSignature(secret string, body []byte, header string) bool {
+	sig, ok := strings.CutPrefix(header, "sha256=")
+	if !ok {
+		return false
+	}
+	got, err := hex.DecodeString(sig)
+	if err != nil {
+		return false
+	}
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hmac.Equal(got, mac.Sum(nil))
+}
+
+// maxBuckets bounds the limiter's memory; full buckets are dropped first.
+const maxBuckets = 4096
+
+// rateLimiter is a token bucket per key.
+type rateLimiter struct {
+	mu      sync.Mutex
+	rate    time.Duration
+	burst   int
+	buckets map[string]*bucket
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+func newRateLimiter(rate time.Duration, burst int) *rateLimiter {
+	if rate <= 0 {
+		rate = time.Minute
+	}
+	if burst < 1 {
+		burst = 1
+	}
+	return &rateLimiter{rate: rate, burst: burst, buckets: make(map[string]*bucket)}
+}
+
+// Allow takes a token from key's bucket, reporting whether one was left.
+func (l *rateLimiter) Allow(key string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := time.Now()
+	if len(l.buckets) >= maxBuckets {
+		l.prune(now)
+	}
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(l.burst), last: now}
+		l.buckets[key] = b
+	}
+	b.tokens += float64(now.Sub(b.last)) / float64(l.rate)
+	if b.tokens > float64(l.burst) {
+		b.tokens = float64(l.burst)
+	}
+	b.last = now
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// prune drops buckets that have refilled, since a new bucket starts full.
+func (l *rateLimiter) prune(now time.Time) {
+	full := time.Duration(l.burst) * l.rate
+	for key, b := range l.buckets {
+		if now.Sub(b.last) >= full {
+			delete(l.buckets, key)
+		}
+	}
+}
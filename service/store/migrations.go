@@ -0,0 +1,143 @@
+package store
+
+// migrations are applied in order; never edit an entry once released,
+// append a new one instead.
+var migrations = []string{
+	// 1: initial schema
+	`CREATE TABLE sessions (
+		id          TEXT PRIMARY KEY,
+		mode        TEXT NOT NULL,
+		instruction TEXT NOT NULL DEFAULT '',
+		workdir     TEXT NOT NULL DEFAULT '',
+		model       TEXT NOT NULL DEFAULT '',
+		started_at  DATETIME NOT NULL,
+		finished_at DATETIME,
+		success     BOOLEAN NOT NULL DEFAULT 0,
+		attempts    INTEGER NOT NULL DEFAULT 0,
+		error       TEXT NOT NULL DEFAULT ''
+	);
+	CREATE INDEX idx_sessions_started ON sessions(started_at);
+
+	CREATE TABLE session_files (
+		session_id TEXT NOT NULL REFERENCES sessions(id) ON DELETE CASCADE,
+		path       TEXT NOT NULL,
+		before     TEXT NOT NULL DEFAULT '',
+		after      TEXT NOT NULL DEFAULT '',
+		PRIMARY KEY (session_id, path)
+	);
+	CREATE INDEX idx_session_files_path ON session_files(path);
+
+	CREATE TABLE usage (
+		id                INTEGER PRIMARY KEY AUTOINCREMENT,
+		session_id        TEXT NOT NULL DEFAULT '',
+		model             TEXT NOT NULL DEFAULT '',
+		prompt_tokens     INTEGER NOT NULL DEFAULT 0,
+		completion_tokens INTEGER NOT NULL DEFAULT 0,
+		total_tokens      INTEGER NOT NULL DEFAULT 0,
+		created_at        DATETIME NOT NULL
+	);
+	CREATE INDEX idx_usage_created ON usage(created_at);
+
+	CREATE TABLE cache (
+		key        TEXT PRIMARY KEY,
+		value      TEXT NOT NULL,
+		created_at DATETIME NOT NULL
+	);
+
+	CREATE TABLE index_entries (
+		path     TEXT PRIMARY KEY,
+		size     INTEGER NOT NULL,
+		mod_time DATETIME NOT NULL,
+		hash     TEXT NOT NULL,
+		package  TEXT NOT NULL DEFAULT '',
+		imports  TEXT NOT NULL DEFAULT '[]'
+	);
+
+	CREATE TABLE backups (
+		id          INTEGER PRIMARY KEY AUTOINCREMENT,
+		path        TEXT NOT NULL,
+		backup_path TEXT NOT NULL,
+		checksum    TEXT NOT NULL,
+		created_at  DATETIME NOT NULL
+	);
+	CREATE INDEX idx_backups_path ON backups(path);`,
+
+	// 2: requests of deterministic runs, for replay
+	`CREATE TABLE requests (
+		id          INTEGER PRIMARY KEY AUTOINCREMENT,
+		session_id  TEXT NOT NULL REFERENCES sessions(id) ON DELETE CASCADE,
+		model       TEXT NOT NULL DEFAULT '',
+		seed        INTEGER NOT NULL DEFAULT 0,
+		prompt_hash TEXT NOT NULL DEFAULT '',
+		body        TEXT NOT NULL,
+		response    TEXT NOT NULL DEFAULT '',
+		created_at  DATETIME NOT NULL
+	);
+	CREATE INDEX idx_requests_session ON requests(session_id);`,
+
+	// 3: commands run by the agent, for cmdlog
+	`CREATE TABLE commands (
+		id          INTEGER PRIMARY KEY AUTOINCREMENT,
+		session_id  TEXT NOT NULL DEFAULT '',
+		command     TEXT NOT NULL,
+		args        TEXT NOT NULL DEFAULT '[]',
+		dir         TEXT NOT NULL DEFAULT '',
+		env         TEXT NOT NULL DEFAULT '{}',
+		exit_code   INTEGER NOT NULL,
+		duration_ms INTEGER NOT NULL,
+		created_at  DATETIME NOT NULL
+	);
+	CREATE INDEX idx_commands_session ON commands(session_id);`,
+
+	// 4: build footprints of diagnose runs
+	`CREATE TABLE footprints (
+		id            INTEGER PRIMARY KEY AUTOINCREMENT,
+		build_time_ms INTEGER NOT NULL,
+		binary_size   INTEGER NOT NULL DEFAULT 0,
+		binaries      TEXT NOT NULL DEFAULT '{}',
+		modules       TEXT NOT NULL DEFAULT '[]',
+		created_at    DATETIME NOT NULL
+	);`,
+
+	// 5: the output of each attempt of a session, kept for salvage
+	`CREATE TABLE attempts (
+		session_id TEXT NOT NULL REFERENCES sessions(id) ON DELETE CASCADE,
+		attempt    INTEGER NOT NULL,
+		stage      TEXT NOT NULL DEFAULT '',
+		error      TEXT NOT NULL DEFAULT '',
+		files      TEXT NOT NULL DEFAULT '{}',
+		created_at DATETIME NOT NULL,
+		PRIMARY KEY (session_id, attempt)
+	);`,
+}
+
+// migrate applies pending migrations inside a transaction each.
+func (s *Store) migrate() error {
+	if _, err := s.db.Exec(`CREATE TABLE IF NOT EXISTS schema_migrations (version INTEGER PRIMARY KEY)`); err != nil {
+		return err
+	}
+
+	var current int
+	if err := s.db.QueryRow(`SELECT COALESCE(MAX(version), 0) FROM schema_migrations`).Scan(&current); err != nil {
+		return err
+	}
+
+	for i := current; i < len(migrations); i++ {
+		tx, err := s.db.Begin()
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec(migrations[i]); err != nil {
+			tx.Rollback()
+			return err
+		}
+		if _, err := tx.Exec(`INSERT INTO schema_migrations (version) VALUES (?)`, i+1); err != nil {
+			tx.Rollback()
+			return err
+		}
+		if err := tx.Commit(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,712 @@
+// Package store provides the SQLite-backed agent state database.
+// It consolidates sessions, usage, cache entries, index metadata and the
+// backups manifest in a single .aidev/state.db file per project.
+package store
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"ai-dev-agent/service/index"
+
+	_ "modernc.org/sqlite"
+)
+
+// Errors
+var (
+	ErrNotFound = errors.New("not found")
+)
+
+// FileName is the database file name inside the state directory.
+const FileName = "state.db"
+
+// Session represents one agent operation.
+type Session struct {
+	ID          string
+	Mode        string
+	Instruction string
+	WorkDir     string
+	Model       string
+	StartedAt   time.Time
+	FinishedAt  time.Time
+	Success     bool
+	Attempts    int
+	Error       string
+}
+
+// SessionFile records the content of a file before and after an operation.
+type SessionFile struct {
+	SessionID string
+	Path      string
+	Before    string
+	After     string
+}
+
+// Attempt is the output of one attempt of a session. A failed attempt
+// has the stage it failed at and the error; its files may still be close
+// to right.
+type Attempt struct {
+	SessionID string
+	Attempt   int
+	Stage     string
+	Error     string
+	Files     map[string]string // content by path
+	CreatedAt time.Time
+}
+
+// Usage records token consumption of a single LLM call.
+type Usage struct {
+	SessionID        string
+	Model            string
+	PromptTokens     int
+	CompletionTokens int
+	TotalTokens      int
+	CreatedAt        time.Time
+}
+
+// Request is an LLM request of a deterministic run, recorded with its
+// response so it can be replayed.
+type Request struct {
+	ID         int64
+	SessionID  string
+	Model      string
+	Seed       int
+	PromptHash string
+	Body       string // JSON request body, as sent
+	Response   string
+	CreatedAt  time.Time
+}
+
+// Command is a command the agent ran, recorded so it can be inspected and
+// run again by hand.
+type Command struct {
+	ID        int64
+	SessionID string
+	Command   string            // as displayed
+	Args      []string          // the program and its arguments
+	Dir       string            // working directory
+	Env       map[string]string // environment variables of interest, as set
+	ExitCode  int
+	Duration  time.Duration
+	CreatedAt time.Time
+}
+
+// Footprint is the build time and binary size measured by a diagnose
+// run, and the modules the binaries link.
+type Footprint struct {
+	BuildTime  time.Duration
+	BinarySize int64
+	Binaries   map[string]int64 // size by name
+	Modules    []string
+	CreatedAt  time.Time
+}
+
+// ModelUsage is the aggregated usage of one model.
+type ModelUsage struct {
+	Model            string
+	Calls            int
+	PromptTokens     int
+	CompletionTokens int
+	TotalTokens      int
+}
+
+// Backup is an entry of the backups manifest.
+type Backup struct {
+	Path       string
+	BackupPath string
+	Checksum   string
+	CreatedAt  time.Time
+}
+
+// SessionFilter narrows ListSessions results.
+type SessionFilter struct {
+	Since time.Time
+	File  string // only sessions that touched this path
+	Grep  string // substring of the instruction, error or a touched path
+	Limit int
+}
+
+// Store wraps the state database.
+type Store struct {
+	db   *sql.DB
+	path string
+}
+
+// Open opens (creating if needed) the state database in dir and applies
+// any pending migrations.
+func Open(dir string) (*Store, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	path := filepath.Join(dir, FileName)
+	db, err := sql.Open("sqlite", path+"?_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)")
+	if err != nil {
+		return nil, err
+	}
+	db.SetMaxOpenConns(1)
+
+	s := &Store{db: db, path: path}
+	if err := s.migrate(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("migrate: %w", err)
+	}
+	return s, nil
+}
+
+// Close closes the database.
+func (s *Store) Close() error {
+	return s.db.Close()
+}
+
+// Path returns the database file path.
+func (s *Store) Path() string {
+	return s.path
+}
+
+// NewSessionID returns a sortable, unique session identifier.
+func NewSessionID() string {
+	buf := make([]byte, 3)
+	rand.Read(buf)
+	return time.Now().Format("20060102-150405") + "-" + hex.EncodeToString(buf)
+}
+
+// SaveSession inserts or updates a session.
+func (s *Store) SaveSession(sess *Session) error {
+	_, err := s.db.Exec(`INSERT INTO sessions (id, mode, instruction, workdir, model, started_at, finished_at, success, attempts, error)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT(id) DO UPDATE SET finished_at = excluded.finished_at, success = excluded.success,
+			attempts = excluded.attempts, error = excluded.error`,
+		sess.ID, sess.Mode, sess.Instruction, sess.WorkDir, sess.Model,
+		sess.StartedAt.UTC(), sess.FinishedAt.UTC(), sess.Success, sess.Attempts, sess.Error)
+	return err
+}
+
+// GetSession returns a session by ID. A unique ID prefix is accepted.
+func (s *Store) GetSession(id string) (*Session, error) {
+	rows, err := s.querySessions(`WHERE id LIKE ? ORDER BY started_at DESC LIMIT 2`, id+"%")
+	if err != nil {
+		return nil, err
+	}
+	switch len(rows) {
+	case 0:
+		return nil, ErrNotFound
+	case 1:
+		return &rows[0], nil
+	}
+	if rows[0].ID == id {
+		return &rows[0], nil
+	}
+	return nil, fmt.Errorf("ambiguous session id %q", id)
+}
+
+// ListSessions returns sessions, newest first.
+func (s *Store) ListSessions(filter SessionFilter) ([]Session, error) {
+	where := "WHERE started_at >= ?"
+	args := []interface{}{filter.Since.UTC()}
+	if filter.File != "" {
+		where += " AND id IN (SELECT session_id FROM session_files WHERE path = ?)"
+		args = append(args, filter.File)
+	}
+	if filter.Grep != "" {
+		pattern := "%" + likeEscape(filter.Grep) + "%"
+		where += ` AND (instruction LIKE ? ESCAPE '\' OR error LIKE ? ESCAPE '\'
+			OR id IN (SELECT session_id FROM session_files WHERE path LIKE ? ESCAPE '\'))`
+		args = append(args, pattern, pattern, pattern)
+	}
+	query := where + " ORDER BY started_at DESC"
+	if filter.Limit > 0 {
+		query += fmt.Sprintf(" LIMIT %d", filter.Limit)
+	}
+	return s.querySessions(query, args...)
+}
+
+func (s *Store) querySessions(clause string, args ...interface{}) ([]Session, error) {
+	rows, err := s.db.Query(`SELECT id, mode, instruction, workdir, model, started_at, finished_at, success, attempts, error
+		FROM sessions `+clause, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var sessions []Session
+	for rows.Next() {
+		var sess Session
+		if err := rows.Scan(&sess.ID, &sess.Mode, &sess.Instruction, &sess.WorkDir, &sess.Model,
+			&sess.StartedAt, &sess.FinishedAt, &sess.Success, &sess.Attempts, &sess.Error); err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, sess)
+	}
+	return sessions, rows.Err()
+}
+
+// AddSessionFile records a file touched by a session.
+func (s *Store) AddSessionFile(f SessionFile) error {
+	_, err := s.db.Exec(`INSERT INTO session_files (session_id, path, before, after) VALUES (?, ?, ?, ?)
+		ON CONFLICT(session_id, path) DO UPDATE SET after = excluded.after`,
+		f.SessionID, f.Path, f.Before, f.After)
+	return err
+}
+
+// SessionFiles returns the files recorded for a session.
+func (s *Store) SessionFiles(sessionID string) ([]SessionFile, error) {
+	rows, err := s.db.Query(`SELECT session_id, path, before, after FROM session_files WHERE session_id = ? ORDER BY path`, sessionID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var files []SessionFile
+	for rows.Next() {
+		var f SessionFile
+		if err := rows.Scan(&f.SessionID, &f.Path, &f.Before, &f.After); err != nil {
+			return nil, err
+		}
+		files = append(files, f)
+	}
+	return files, rows.Err()
+}
+
+// AddAttempt records an attempt of a session.
+func (s *Store) AddAttempt(a Attempt) error {
+	if a.CreatedAt.IsZero() {
+		a.CreatedAt = time.Now()
+	}
+	files, err := json.Marshal(a.Files)
+	if err != nil {
+		return err
+	}
+	_, err = s.db.Exec(`INSERT INTO attempts (session_id, attempt, stage, error, files, created_at) VALUES (?, ?, ?, ?, ?, ?)
+		ON CONFLICT(session_id, attempt) DO UPDATE SET stage = excluded.stage, error = excluded.error, files = excluded.files`,
+		a.SessionID, a.Attempt, a.Stage, a.Error, string(files), a.CreatedAt.UTC())
+	return err
+}
+
+// Attempts returns the attempts recorded for a session, in order.
+func (s *Store) Attempts(sessionID string) ([]Attempt, error) {
+	rows, err := s.db.Query(`SELECT session_id, attempt, stage, error, files, created_at
+		FROM attempts WHERE session_id = ? ORDER BY attempt`, sessionID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var attempts []Attempt
+	for rows.Next() {
+		var a Attempt
+		var filesJSON string
+		if err := rows.Scan(&a.SessionID, &a.Attempt, &a.Stage, &a.Error, &filesJSON, &a.CreatedAt); err != nil {
+			return nil, err
+		}
+		json.Unmarshal([]byte(filesJSON), &a.Files)
+		attempts = append(attempts, a)
+	}
+	return attempts, rows.Err()
+}
+
+// RecordUsage stores token usage for an LLM call.
+func (s *Store) RecordUsage(u Usage) error {
+	if u.CreatedAt.IsZero() {
+		u.CreatedAt = time.Now()
+	}
+	_, err := s.db.Exec(`INSERT INTO usage (session_id, model, prompt_tokens, completion_tokens, total_tokens, created_at)
+		VALUES (?, ?, ?, ?, ?, ?)`,
+		u.SessionID, u.Model, u.PromptTokens, u.CompletionTokens, u.TotalTokens, u.CreatedAt.UTC())
+	return err
+}
+
+// SessionUsage returns the summed token usage of a session.
+func (s *Store) SessionUsage(sessionID string) (Usage, error) {
+	u := Usage{SessionID: sessionID}
+	err := s.db.QueryRow(`SELECT COALESCE(SUM(prompt_tokens), 0), COALESCE(SUM(completion_tokens), 0), COALESCE(SUM(total_tokens), 0)
+		FROM usage WHERE session_id = ?`, sessionID).Scan(&u.PromptTokens, &u.CompletionTokens, &u.TotalTokens)
+	return u, err
+}
+
+// UsageByModel aggregates usage recorded since the given time per model,
+// largest consumer first.
+func (s *Store) UsageByModel(since time.Time) ([]ModelUsage, error) {
+	rows, err := s.db.Query(`SELECT model, COUNT(*), SUM(prompt_tokens), SUM(completion_tokens), SUM(total_tokens)
+		FROM usage WHERE created_at >= ? GROUP BY model ORDER BY SUM(total_tokens) DESC`, since.UTC())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var result []ModelUsage
+	for rows.Next() {
+		var u ModelUsage
+		if err := rows.Scan(&u.Model, &u.Calls, &u.PromptTokens, &u.CompletionTokens, &u.TotalTokens); err != nil {
+			return nil, err
+		}
+		result = append(result, u)
+	}
+	return result, rows.Err()
+}
+
+// AddRequest records an LLM request of a session.
+func (s *Store) AddRequest(r Request) error {
+	if r.CreatedAt.IsZero() {
+		r.CreatedAt = time.Now()
+	}
+	_, err := s.db.Exec(`INSERT INTO requests (session_id, model, seed, prompt_hash, body, response, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		r.SessionID, r.Model, r.Seed, r.PromptHash, r.Body, r.Response, r.CreatedAt.UTC())
+	return err
+}
+
+// SessionRequests returns the requests recorded for a session in the
+// order they were sent.
+func (s *Store) SessionRequests(sessionID string) ([]Request, error) {
+	rows, err := s.db.Query(`SELECT id, session_id, model, seed, prompt_hash, body, response, created_at
+		FROM requests WHERE session_id = ? ORDER BY id`, sessionID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var requests []Request
+	for rows.Next() {
+		var r Request
+		if err := rows.Scan(&r.ID, &r.SessionID, &r.Model, &r.Seed, &r.PromptHash, &r.Body, &r.Response, &r.CreatedAt); err != nil {
+			return nil, err
+		}
+		requests = append(requests, r)
+	}
+	return requests, rows.Err()
+}
+
+// AddCommand records a command the agent ran.
+func (s *Store) AddCommand(c Command) error {
+	if c.CreatedAt.IsZero() {
+		c.CreatedAt = time.Now()
+	}
+	args, err := json.Marshal(c.Args)
+	if err != nil {
+		return err
+	}
+	env, err := json.Marshal(c.Env)
+	if err != nil {
+		return err
+	}
+	_, err = s.db.Exec(`INSERT INTO commands (session_id, command, args, dir, env, exit_code, duration_ms, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		c.SessionID, c.Command, string(args), c.Dir, string(env), c.ExitCode, c.Duration.Milliseconds(), c.CreatedAt.UTC())
+	return err
+}
+
+// GetCommand returns a recorded command by ID.
+func (s *Store) GetCommand(id int64) (*Command, error) {
+	commands, err := s.queryCommands(`WHERE id = ?`, id)
+	if err != nil {
+		return nil, err
+	}
+	if len(commands) == 0 {
+		return nil, ErrNotFound
+	}
+	return &commands[0], nil
+}
+
+// Commands returns the commands recorded for a session, or for all
+// sessions if sessionID is empty, newest first. A limit of 0 returns all.
+func (s *Store) Commands(sessionID string, limit int) ([]Command, error) {
+	clause := `WHERE session_id = ? OR ? = '' ORDER BY id DESC`
+	args := []interface{}{sessionID, sessionID}
+	if limit > 0 {
+		clause += ` LIMIT ?`
+		args = append(args, limit)
+	}
+	return s.queryCommands(clause, args...)
+}
+
+func (s *Store) queryCommands(clause string, args ...interface{}) ([]Command, error) {
+	rows, err := s.db.Query(`SELECT id, session_id, command, args, dir, env, exit_code, duration_ms, created_at
+		FROM commands `+clause, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var commands []Command
+	for rows.Next() {
+		var c Command
+		var argsJSON, envJSON string
+		var ms int64
+		if err := rows.Scan(&c.ID, &c.SessionID, &c.Command, &argsJSON, &c.Dir, &envJSON, &c.ExitCode, &ms, &c.CreatedAt); err != nil {
+			return nil, err
+		}
+		json.Unmarshal([]byte(argsJSON), &c.Args)
+		json.Unmarshal([]byte(envJSON), &c.Env)
+		c.Duration = time.Duration(ms) * time.Millisecond
+		commands = append(commands, c)
+	}
+	return commands, rows.Err()
+}
+
+// AddFootprint records the footprint of a diagnose run.
+func (s *Store) AddFootprint(f Footprint) error {
+	if f.CreatedAt.IsZero() {
+		f.CreatedAt = time.Now()
+	}
+	binaries, err := json.Marshal(f.Binaries)
+	if err != nil {
+		return err
+	}
+	modules, err := json.Marshal(f.Modules)
+	if err != nil {
+		return err
+	}
+	_, err = s.db.Exec(`INSERT INTO footprints (build_time_ms, binary_size, binaries, modules, created_at)
+		VALUES (?, ?, ?, ?, ?)`,
+		f.BuildTime.Milliseconds(), f.BinarySize, string(binaries), string(modules), f.CreatedAt.UTC())
+	return err
+}
+
+// Footprints returns the newest recorded footprints, newest first.
+func (s *Store) Footprints(limit int) ([]Footprint, error) {
+	rows, err := s.db.Query(`SELECT build_time_ms, binary_size, binaries, modules, created_at
+		FROM footprints ORDER BY id DESC LIMIT ?`, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var footprints []Footprint
+	for rows.Next() {
+		var f Footprint
+		var ms int64
+		var binariesJSON, modulesJSON string
+		if err := rows.Scan(&ms, &f.BinarySize, &binariesJSON, &modulesJSON, &f.CreatedAt); err != nil {
+			return nil, err
+		}
+		json.Unmarshal([]byte(binariesJSON), &f.Binaries)
+		json.Unmarshal([]byte(modulesJSON), &f.Modules)
+		f.BuildTime = time.Duration(ms) * time.Millisecond
+		footprints = append(footprints, f)
+	}
+	return footprints, rows.Err()
+}
+
+// CacheGet returns a cached value.
+func (s *Store) CacheGet(key string) (string, error) {
+	var value string
+	err := s.db.QueryRow(`SELECT value FROM cache WHERE key = ?`, key).Scan(&value)
+	if err == sql.ErrNoRows {
+		return "", ErrNotFound
+	}
+	return value, err
+}
+
+// CachePut stores a cached value.
+func (s *Store) CachePut(key, value string) error {
+	_, err := s.db.Exec(`INSERT INTO cache (key, value, created_at) VALUES (?, ?, ?)
+		ON CONFLICT(key) DO UPDATE SET value = excluded.value, created_at = excluded.created_at`,
+		key, value, time.Now().UTC())
+	return err
+}
+
+// SaveIndex replaces the stored index metadata.
+func (s *Store) SaveIndex(entries []index.Entry) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`DELETE FROM index_entries`); err != nil {
+		return err
+	}
+	stmt, err := tx.Prepare(`INSERT INTO index_entries (path, size, mod_time, hash, package, imports) VALUES (?, ?, ?, ?, ?, ?)`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	for _, e := range entries {
+		imports, _ := json.Marshal(e.Imports)
+		if _, err := stmt.Exec(e.Path, e.Size, e.ModTime.UTC(), e.Hash, e.Package, string(imports)); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// LoadIndex returns the stored index metadata.
+func (s *Store) LoadIndex() ([]index.Entry, error) {
+	rows, err := s.db.Query(`SELECT path, size, mod_time, hash, package, imports FROM index_entries ORDER BY path`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entries []index.Entry
+	for rows.Next() {
+		var e index.Entry
+		var imports string
+		if err := rows.Scan(&e.Path, &e.Size, &e.ModTime, &e.Hash, &e.Package, &imports); err != nil {
+			return nil, err
+		}
+		json.Unmarshal([]byte(imports), &e.Imports)
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
+
+// AddBackup records a backup in the manifest.
+func (s *Store) AddBackup(b Backup) error {
+	if b.CreatedAt.IsZero() {
+		b.CreatedAt = time.Now()
+	}
+	_, err := s.db.Exec(`INSERT INTO backups (path, backup_path, checksum, created_at) VALUES (?, ?, ?, ?)`,
+		b.Path, b.BackupPath, b.Checksum, b.CreatedAt.UTC())
+	return err
+}
+
+// Backups returns manifest entries for a path, newest first. An empty path
+// returns all entries.
+func (s *Store) Backups(path string) ([]Backup, error) {
+	query := `SELECT path, backup_path, checksum, created_at FROM backups`
+	var args []interface{}
+	if path != "" {
+		query += ` WHERE path = ?`
+		args = append(args, path)
+	}
+	rows, err := s.db.Query(query+` ORDER BY created_at DESC`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var backups []Backup
+	for rows.Next() {
+		var b Backup
+		if err := rows.Scan(&b.Path, &b.BackupPath, &b.Checksum, &b.CreatedAt); err != nil {
+			return nil, err
+		}
+		backups = append(backups, b)
+	}
+	return backups, rows.Err()
+}
+
+// PruneStats reports what Prune removed.
+type PruneStats struct {
+	Sessions     int // with their file contents, attempts and recorded requests
+	CacheEntries int
+	Backups      int   // manifest entries
+	Bytes        int64 // by which the database file shrank
+}
+
+// Prune deletes sessions started before the cutoff, together with their
+// file contents, attempts, recorded requests and commands, cache entries stored before it,
+// and backup entries made before it or whose backup file is gone. Usage
+// records are kept for spend limits and reports. The database is then
+// compacted.
+func (s *Store) Prune(before time.Time) (PruneStats, error) {
+	var stats PruneStats
+	sizeBefore := s.size()
+
+	missing, err := s.missingBackups()
+	if err != nil {
+		return stats, err
+	}
+	tx, err := s.db.Begin()
+	if err != nil {
+		return stats, err
+	}
+	defer tx.Rollback()
+
+	cutoff := before.UTC()
+	steps := []struct {
+		query string
+		count *int
+	}{
+		{`DELETE FROM session_files WHERE session_id IN (SELECT id FROM sessions WHERE started_at < ?)`, nil},
+		{`DELETE FROM attempts WHERE session_id IN (SELECT id FROM sessions WHERE started_at < ?)`, nil},
+		{`DELETE FROM requests WHERE session_id IN (SELECT id FROM sessions WHERE started_at < ?)`, nil},
+		{`DELETE FROM commands WHERE created_at < ?`, nil},
+		{`DELETE FROM sessions WHERE started_at < ?`, &stats.Sessions},
+		{`DELETE FROM cache WHERE created_at < ?`, &stats.CacheEntries},
+		{`DELETE FROM backups WHERE created_at < ?`, &stats.Backups},
+	}
+	for _, step := range steps {
+		res, err := tx.Exec(step.query, cutoff)
+		if err != nil {
+			return stats, err
+		}
+		if step.count != nil {
+			n, _ := res.RowsAffected()
+			*step.count = int(n)
+		}
+	}
+	for _, id := range missing {
+		res, err := tx.Exec(`DELETE FROM backups WHERE id = ?`, id)
+		if err != nil {
+			return stats, err
+		}
+		n, _ := res.RowsAffected()
+		stats.Backups += int(n)
+	}
+	if err := tx.Commit(); err != nil {
+		return stats, err
+	}
+
+	if stats.Sessions+stats.CacheEntries+stats.Backups > 0 {
+		if _, err := s.db.Exec(`VACUUM`); err != nil {
+			return stats, err
+		}
+		if _, err := s.db.Exec(`PRAGMA wal_checkpoint(TRUNCATE)`); err != nil {
+			return stats, err
+		}
+		if shrunk := sizeBefore - s.size(); shrunk > 0 {
+			stats.Bytes = shrunk
+		}
+	}
+	return stats, nil
+}
+
+// missingBackups returns the IDs of backup entries whose file is gone.
+func (s *Store) missingBackups() ([]int64, error) {
+	rows, err := s.db.Query(`SELECT id, backup_path FROM backups`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		var path string
+		if err := rows.Scan(&id, &path); err != nil {
+			return nil, err
+		}
+		if _, err := os.Stat(path); os.IsNotExist(err) {
+			ids = append(ids, id)
+		}
+	}
+	return ids, rows.Err()
+}
+
+// size returns the size of the database and its write-ahead log.
+func (s *Store) size() int64 {
+	var total int64
+	for _, path := range []string{s.path, s.path + "-wal"} {
+		if info, err := os.Stat(path); err == nil {
+			total += info.Size()
+		}
+	}
+	return total
+}
+
+// Helper functions
+
+func likeEscape(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
@@ -0,0 +1,136 @@
+// Package summarize condenses context files to signature-level summaries
+// so that large multi-file prompts fit smaller models.
+package summarize
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Chatter sends a single prompt to a model.
+type Chatter interface {
+	Chat(ctx context.Context, prompt string) (string, error)
+}
+
+// Cache stores summaries across runs.
+type Cache interface {
+	Get(key string) (string, bool)
+	Put(key, value string)
+}
+
+// Config holds summarizer configuration.
+type Config struct {
+	// Threshold is the total context size in bytes above which files are
+	// summarized. Smaller contexts are passed through verbatim.
+	Threshold int
+	// Concurrency bounds parallel summary calls.
+	Concurrency int
+}
+
+// DefaultConfig returns a default configuration.
+func DefaultConfig() Config {
+	return Config{Threshold: 24000, Concurrency: 4}
+}
+
+// Summarizer maps context files to summaries.
+type Summarizer struct {
+	llm    Chatter
+	model  string
+	cache  Cache
+	config Config
+}
+
+// New creates a summarizer. model is only used to key the cache; cache
+// may be nil.
+func New(llm Chatter, model string, cache Cache, config Config) *Summarizer {
+	if config.Concurrency < 1 {
+		config.Concurrency = 1
+	}
+	return &Summarizer{llm: llm, model: model, cache: cache, config: config}
+}
+
+const summaryPrompt = `Summarize the following %s file for use as reference context by another engineer.
+Keep only the package/module name, imports, exported and unexported type definitions, function and method signatures,
+constants and a one-line description of each. Omit function bodies. Answer with the summary only, no commentary.
+
+--- FILE: %s ---
+%s`
+
+// Summarize returns the summary of one file, using the cache when possible.
+func (s *Summarizer) Summarize(ctx context.Context, path, content string) (string, error) {
+	key := s.key(path, content)
+	if s.cache != nil {
+		if summary, ok := s.cache.Get(key); ok {
+			return summary, nil
+		}
+	}
+	lang := strings.TrimPrefix(filepath.Ext(path), ".")
+	summary, err := s.llm.Chat(ctx, fmt.Sprintf(summaryPrompt, lang, path, content))
+	if err != nil {
+		return "", fmt.Errorf("summarize %s: %w", path, err)
+	}
+	summary = strings.TrimSpace(summary)
+	if s.cache != nil {
+		s.cache.Put(key, summary)
+	}
+	return summary, nil
+}
+
+// Compress summarizes all files when their combined size exceeds the
+// threshold. Files whose summary fails are kept verbatim.
+func (s *Summarizer) Compress(ctx context.Context, files map[string]string) (map[string]string, error) {
+	total := 0
+	for _, content := range files {
+		total += len(content)
+	}
+	if total <= s.config.Threshold {
+		return files, nil
+	}
+
+	paths := make([]string, 0, len(files))
+	for p := range files {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+
+	out := make(map[string]string, len(files))
+	var (
+		mu       sync.Mutex
+		wg       sync.WaitGroup
+		firstErr error
+	)
+	sem := make(chan struct{}, s.config.Concurrency)
+	for _, path := range paths {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(path string) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			summary, err := s.Summarize(ctx, path, files[path])
+
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil || len(summary) >= len(files[path]) {
+				out[path] = files[path]
+				if err != nil && firstErr == nil {
+					firstErr = err
+				}
+				return
+			}
+			out[path] = summary
+		}(path)
+	}
+	wg.Wait()
+	return out, firstErr
+}
+
+func (s *Summarizer) key(path, content string) string {
+	sum := sha256.Sum256([]byte(s.model + "\x00" + filepath.Ext(path) + "\x00" + content))
+	return "summary:" + hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,153 @@
+// Package telemetry keeps opt-in, anonymous usage statistics: how often
+// each command runs, succeeds and retries. It never records code,
+// prompts, paths or errors. The statistics stay in a local file, readable
+// by the user, and are only reported to an endpoint the user configures.
+package telemetry
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"time"
+)
+
+// FileName is the statistics file inside the user's configuration
+// directory.
+const FileName = "aidev/telemetry.json"
+
+// ReportInterval is how often statistics are reported, at most.
+const ReportInterval = 24 * time.Hour
+
+// Stats are the statistics kept while telemetry is on.
+type Stats struct {
+	Enabled  bool                     `json:"enabled"`
+	ID       string                   `json:"id,omitempty"` // random; identifies nothing but this file
+	Since    time.Time                `json:"since,omitempty"`
+	Commands map[string]*CommandStats `json:"commands,omitempty"`
+	Reported time.Time                `json:"reported,omitempty"`
+}
+
+// CommandStats are the totals of one command.
+type CommandStats struct {
+	Runs      int `json:"runs"`
+	Succeeded int `json:"succeeded"`
+	Retries   int `json:"retries"` // attempts after the first
+}
+
+// Path returns the statistics file of the current user.
+func Path() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, FileName), nil
+}
+
+// Load reads the statistics file. A missing file is telemetry off.
+func Load(path string) (*Stats, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return &Stats{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var s Stats
+	if err := json.Unmarshal(data, &s); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return &s, nil
+}
+
+// Save writes the statistics file.
+func (s *Stats) Save(path string) error {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0644)
+}
+
+// Enable turns telemetry on with a new random ID.
+func (s *Stats) Enable() {
+	if s.Enabled {
+		return
+	}
+	buf := make([]byte, 8)
+	rand.Read(buf)
+	*s = Stats{Enabled: true, ID: hex.EncodeToString(buf), Since: time.Now().UTC()}
+}
+
+// Disable turns telemetry off and forgets the statistics and the ID.
+func (s *Stats) Disable() {
+	*s = Stats{}
+}
+
+// Record adds a run of command to the statistics, if telemetry is on.
+func (s *Stats) Record(command string, success bool, retries int) {
+	if !s.Enabled {
+		return
+	}
+	if s.Commands == nil {
+		s.Commands = make(map[string]*CommandStats)
+	}
+	c, ok := s.Commands[command]
+	if !ok {
+		c = &CommandStats{}
+		s.Commands[command] = c
+	}
+	c.Runs++
+	if success {
+		c.Succeeded++
+	}
+	c.Retries += retries
+}
+
+// Due reports whether the statistics should be reported again.
+func (s *Stats) Due(now time.Time) bool {
+	return s.Enabled && len(s.Commands) > 0 && now.Sub(s.Reported) >= ReportInterval
+}
+
+// Report is what is sent to the endpoint: the statistics with the tool's
+// version and platform, nothing else.
+type Report struct {
+	ID       string                   `json:"id"`
+	Version  string                   `json:"version"`
+	OS       string                   `json:"os"`
+	Arch     string                   `json:"arch"`
+	Since    time.Time                `json:"since"`
+	Commands map[string]*CommandStats `json:"commands"`
+}
+
+// Send posts the statistics to endpoint as a Report.
+func (s *Stats) Send(ctx context.Context, endpoint, version string) error {
+	body, err := json.Marshal(Report{ID: s.ID, Version: version, OS: runtime.GOOS, Arch: runtime.GOARCH, Since: s.Since, Commands: s.Commands})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("telemetry endpoint: %s", resp.Status)
+	}
+	s.Reported = time.Now().UTC()
+	return nil
+}
@@ -0,0 +1,240 @@
+// Package tracker fetches issues from Jira and GitHub Issues, so that an
+// issue can be fixed from its own description and discussion.
+package tracker
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Errors
+var (
+	ErrInvalidRef = errors.New("invalid issue reference")
+	ErrNoJira     = errors.New("no Jira configured (set JIRA_URL)")
+)
+
+// DefaultGitHubAPIURL is the GitHub REST endpoint.
+const DefaultGitHubAPIURL = "https://api.github.com"
+
+// maxComments bounds how many of the latest comments are fetched.
+const maxComments = 20
+
+var (
+	jiraKeyPattern   = regexp.MustCompile(`^[A-Z][A-Z0-9_]+-\d+$`)
+	githubRefPattern = regexp.MustCompile(`^([\w.-]+)/([\w.-]+)#(\d+)$`)
+	githubURLPattern = regexp.MustCompile(`^https://github\.com/([\w.-]+)/([\w.-]+)/issues/(\d+)/?$`)
+)
+
+// Config holds the trackers' endpoints and credentials.
+type Config struct {
+	// JiraURL is the base URL of the Jira site. JiraUser and JiraToken
+	// authenticate as in Jira Cloud; a token without a user is sent as
+	// a personal access token, as Jira Server expects.
+	JiraURL   string
+	JiraUser  string
+	JiraToken string
+
+	GitHubAPIURL string
+	GitHubToken  string
+	Timeout      time.Duration
+}
+
+// DefaultConfig returns a configuration taken from JIRA_URL, JIRA_USER,
+// JIRA_TOKEN and GITHUB_TOKEN.
+func DefaultConfig() Config {
+	return Config{
+		JiraURL:      strings.TrimSuffix(os.Getenv("JIRA_URL"), "/"),
+		JiraUser:     os.Getenv("JIRA_USER"),
+		JiraToken:    os.Getenv("JIRA_TOKEN"),
+		GitHubAPIURL: DefaultGitHubAPIURL,
+		GitHubToken:  os.Getenv("GITHUB_TOKEN"),
+		Timeout:      30 * time.Second,
+	}
+}
+
+// Issue is an issue with its discussion.
+type Issue struct {
+	// Ref is how commits and pull requests refer to the issue:
+	// PROJ-123 or owner/repo#123.
+	Ref         string
+	URL         string
+	Title       string
+	Description string
+	Comments    []Comment
+}
+
+// Comment is a comment on an issue.
+type Comment struct {
+	Author string
+	Body   string
+}
+
+// Instruction returns the issue as an instruction for the model.
+func (i *Issue) Instruction() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Fix issue %s: %s", i.Ref, i.Title)
+	if d := strings.TrimSpace(i.Description); d != "" {
+		b.WriteString("\n\n" + d)
+	}
+	if len(i.Comments) > 0 {
+		b.WriteString("\n\nDiscussion on the issue:")
+		for _, c := range i.Comments {
+			fmt.Fprintf(&b, "\n- %s: %s", c.Author, strings.TrimSpace(c.Body))
+		}
+	}
+	return b.String()
+}
+
+// Client fetches issues.
+type Client struct {
+	config Config
+	http   *http.Client
+}
+
+// NewClient creates a new client.
+func NewClient(config Config) *Client {
+	if config.GitHubAPIURL == "" {
+		config.GitHubAPIURL = DefaultGitHubAPIURL
+	}
+	if config.Timeout == 0 {
+		config.Timeout = 30 * time.Second
+	}
+	return &Client{config: config, http: &http.Client{Timeout: config.Timeout}}
+}
+
+// IsJira reports whether ref is a Jira key such as PROJ-123.
+func IsJira(ref string) bool {
+	return jiraKeyPattern.MatchString(ref)
+}
+
+// Fetch fetches the issue ref: a Jira key such as PROJ-123, a GitHub
+// owner/repo#123 or a GitHub issue URL.
+func (c *Client) Fetch(ctx context.Context, ref string) (*Issue, error) {
+	if IsJira(ref) {
+		return c.fetchJira(ctx, ref)
+	}
+	m := githubRefPattern.FindStringSubmatch(ref)
+	if m == nil {
+		m = githubURLPattern.FindStringSubmatch(ref)
+	}
+	if m == nil {
+		return nil, fmt.Errorf("%w %q: want PROJ-123, owner/repo#123 or a GitHub issue URL", ErrInvalidRef, ref)
+	}
+	number, _ := strconv.Atoi(m[3])
+	return c.fetchGitHub(ctx, m[1], m[2], number)
+}
+
+// Helper functions
+
+func (c *Client) fetchJira(ctx context.Context, key string) (*Issue, error) {
+	if c.config.JiraURL == "" {
+		return nil, ErrNoJira
+	}
+	var data struct {
+		Fields struct {
+			Summary     string `json:"summary"`
+			Description string `json:"description"`
+			Comment     struct {
+				Comments []struct {
+					Author struct {
+						DisplayName string `json:"displayName"`
+					} `json:"author"`
+					Body string `json:"body"`
+				} `json:"comments"`
+			} `json:"comment"`
+		} `json:"fields"`
+	}
+	// API version 2 returns descriptions and comments as text rather than
+	// as documents.
+	endpoint := fmt.Sprintf("%s/rest/api/2/issue/%s?fields=summary,description,comment", c.config.JiraURL, url.PathEscape(key))
+	if err := c.get(ctx, endpoint, c.jiraAuth(), &data); err != nil {
+		return nil, fmt.Errorf("jira %s: %w", key, err)
+	}
+	issue := &Issue{Ref: key, URL: c.config.JiraURL + "/browse/" + key, Title: data.Fields.Summary, Description: data.Fields.Description}
+	comments := data.Fields.Comment.Comments
+	if len(comments) > maxComments {
+		comments = comments[len(comments)-maxComments:]
+	}
+	for _, cm := range comments {
+		issue.Comments = append(issue.Comments, Comment{Author: cm.Author.DisplayName, Body: cm.Body})
+	}
+	return issue, nil
+}
+
+func (c *Client) fetchGitHub(ctx context.Context, owner, repo string, number int) (*Issue, error) {
+	ref := fmt.Sprintf("%s/%s#%d", owner, repo, number)
+	base := fmt.Sprintf("%s/repos/%s/%s/issues/%d", strings.TrimSuffix(c.config.GitHubAPIURL, "/"), owner, repo, number)
+	auth := ""
+	if c.config.GitHubToken != "" {
+		auth = "Bearer " + c.config.GitHubToken
+	}
+
+	var data struct {
+		Title   string `json:"title"`
+		Body    string `json:"body"`
+		HTMLURL string `json:"html_url"`
+	}
+	if err := c.get(ctx, base, auth, &data); err != nil {
+		return nil, fmt.Errorf("github %s: %w", ref, err)
+	}
+	var comments []struct {
+		User struct {
+			Login string `json:"login"`
+		} `json:"user"`
+		Body string `json:"body"`
+	}
+	if err := c.get(ctx, fmt.Sprintf("%s/comments?per_page=%d", base, maxComments), auth, &comments); err != nil {
+		return nil, fmt.Errorf("github %s comments: %w", ref, err)
+	}
+	issue := &Issue{Ref: ref, URL: data.HTMLURL, Title: data.Title, Description: data.Body}
+	for _, cm := range comments {
+		issue.Comments = append(issue.Comments, Comment{Author: cm.User.Login, Body: cm.Body})
+	}
+	return issue, nil
+}
+
+func (c *Client) jiraAuth() string {
+	if c.config.JiraToken == "" {
+		return ""
+	}
+	if c.config.JiraUser == "" {
+		return "Bearer " + c.config.JiraToken
+	}
+	return "Basic " + base64.StdEncoding.EncodeToString([]byte(c.config.JiraUser+":"+c.config.JiraToken))
+}
+
+// get fetches endpoint and decodes its JSON response into out.
+func (c *Client) get(ctx context.Context, endpoint, auth string, out interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, "GET", endpoint, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	if auth != "" {
+		req.Header.Set("Authorization", auth)
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("status %d", resp.StatusCode)
+	}
+	return json.Unmarshal(body, out)
+}
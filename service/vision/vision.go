@@ -0,0 +1,166 @@
+// Package vision prepares images to attach to model prompts: it decodes
+// them, downscales large ones and re-encodes them within a size limit.
+package vision
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"net/http"
+	"os"
+
+	_ "image/gif" // decoder
+)
+
+// Errors
+var (
+	ErrUnsupportedFormat = errors.New("unsupported image format (want PNG, JPEG or GIF)")
+	ErrTooLarge          = errors.New("image too large")
+)
+
+// Config bounds attached images.
+type Config struct {
+	// MaxDimension is the longest side an image is downscaled to.
+	MaxDimension int
+	// MaxBytes is the largest encoded image accepted after downscaling.
+	MaxBytes int
+	// MaxInputBytes rejects files too large to decode safely.
+	MaxInputBytes int64
+	// JPEGQuality is used when an image is re-encoded as JPEG.
+	JPEGQuality int
+}
+
+// DefaultConfig returns limits that suit the GLM and OpenAI vision models.
+func DefaultConfig() Config {
+	return Config{MaxDimension: 1568, MaxBytes: 4 << 20, MaxInputBytes: 32 << 20, JPEGQuality: 85}
+}
+
+// Image is an encoded image ready to attach.
+type Image struct {
+	Path   string
+	MIME   string
+	Data   []byte
+	Width  int
+	Height int
+}
+
+// DataURL returns the image as a base64 data URL.
+func (img Image) DataURL() string {
+	return "data:" + img.MIME + ";base64," + base64.StdEncoding.EncodeToString(img.Data)
+}
+
+// Load reads an image file. Images within the limits are kept as they
+// are; larger ones are downscaled and re-encoded (PNG for images with
+// transparency, JPEG otherwise).
+func Load(path string, config Config) (*Image, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if config.MaxInputBytes > 0 && info.Size() > config.MaxInputBytes {
+		return nil, fmt.Errorf("%s: %w: %d bytes, limit %d", path, ErrTooLarge, info.Size(), config.MaxInputBytes)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	mime := http.DetectContentType(data)
+	switch mime {
+	case "image/png", "image/jpeg", "image/gif":
+	default:
+		return nil, fmt.Errorf("%s: %w, got %s", path, ErrUnsupportedFormat, mime)
+	}
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	fits := config.MaxDimension <= 0 || (cfg.Width <= config.MaxDimension && cfg.Height <= config.MaxDimension)
+	if fits && (config.MaxBytes <= 0 || len(data) <= config.MaxBytes) && mime != "image/gif" {
+		return &Image{Path: path, MIME: mime, Data: data, Width: cfg.Width, Height: cfg.Height}, nil
+	}
+
+	src, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	dst := src
+	if !fits {
+		dst = downscale(src, config.MaxDimension)
+	}
+	out, mime, err := encode(dst, config.JPEGQuality)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if config.MaxBytes > 0 && len(out) > config.MaxBytes {
+		return nil, fmt.Errorf("%s: %w: %d bytes after downscaling, limit %d", path, ErrTooLarge, len(out), config.MaxBytes)
+	}
+	b := dst.Bounds()
+	return &Image{Path: path, MIME: mime, Data: out, Width: b.Dx(), Height: b.Dy()}, nil
+}
+
+// Helper functions
+
+func encode(img image.Image, quality int) ([]byte, string, error) {
+	var buf bytes.Buffer
+	if opaque(img) {
+		if quality <= 0 {
+			quality = jpeg.DefaultQuality
+		}
+		err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: quality})
+		return buf.Bytes(), "image/jpeg", err
+	}
+	err := png.Encode(&buf, img)
+	return buf.Bytes(), "image/png", err
+}
+
+func opaque(img image.Image) bool {
+	if o, ok := img.(interface{ Opaque() bool }); ok {
+		return o.Opaque()
+	}
+	return false
+}
+
+// downscale shrinks img so its longest side is max, averaging the source
+// pixels that fall into each destination pixel.
+func downscale(img image.Image, max int) image.Image {
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	nw, nh := max, h*max/w
+	if h > w {
+		nw, nh = w*max/h, max
+	}
+	if nw < 1 {
+		nw = 1
+	}
+	if nh < 1 {
+		nh = 1
+	}
+	dst := image.NewNRGBA(image.Rect(0, 0, nw, nh))
+	for y := 0; y < nh; y++ {
+		y0, y1 := b.Min.Y+y*h/nh, b.Min.Y+(y+1)*h/nh
+		for x := 0; x < nw; x++ {
+			x0, x1 := b.Min.X+x*w/nw, b.Min.X+(x+1)*w/nw
+			var r, g, bl, a, n uint64
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					c := color.NRGBAModel.Convert(img.At(sx, sy)).(color.NRGBA)
+					r += uint64(c.R)
+					g += uint64(c.G)
+					bl += uint64(c.B)
+					a += uint64(c.A)
+					n++
+				}
+			}
+			if n > 0 {
+				dst.SetNRGBA(x, y, color.NRGBA{R: uint8(r / n), G: uint8(g / n), B: uint8(bl / n), A: uint8(a / n)})
+			}
+		}
+	}
+	return dst
+}